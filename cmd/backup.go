@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// backupCMD 通过管理api在线备份节点数据
+type backupCMD struct {
+	ctx    *WuKongIMContext
+	addrs  []string
+	token  string
+	output string
+}
+
+func newBackupCMD(ctx *WuKongIMContext) *backupCMD {
+	return &backupCMD{
+		ctx: ctx,
+	}
+}
+
+func (b *backupCMD) CMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "online backup of WuKongIM nodes, one tarball per node",
+		Long:  "Online backup of WuKongIM nodes through the manager api. To back up a whole cluster, pass the manager address of every node with --addr.",
+		RunE:  b.run,
+	}
+	cmd.Flags().StringSliceVar(&b.addrs, "addr", nil, "manager address of the nodes to back up, default is the manager address of the config")
+	cmd.Flags().StringVar(&b.token, "token", "", "manager token, default is the manager token of the config")
+	cmd.Flags().StringVarP(&b.output, "output", "o", ".", "output directory of the backup tarballs")
+	return cmd
+}
+
+func (b *backupCMD) run(cmd *cobra.Command, args []string) error {
+	addrs := b.addrs
+	if len(addrs) == 0 {
+		_, port, _ := strings.Cut(serverOpts.Manager.Addr, ":")
+		addrs = []string{fmt.Sprintf("http://127.0.0.1:%s", port)}
+	}
+	token := b.token
+	if token == "" {
+		token = serverOpts.ManagerToken
+	}
+	if err := os.MkdirAll(b.output, 0755); err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	for _, addr := range addrs {
+		file, err := b.backup(addr, token)
+		if err != nil {
+			fmt.Printf("Error: backup %s failed: %v\n", addr, err)
+			return err
+		}
+		fmt.Printf("Backup of %s saved to %s\n", addr, file)
+	}
+	return nil
+}
+
+// backup 下载节点的备份包到输出目录，返回备份包路径
+func (b *backupCMD) backup(addr string, token string) (string, error) {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/backup", nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("status: %d body: %s", resp.StatusCode, string(body))
+	}
+
+	fileName := fmt.Sprintf("wukongim-%s.tar.gz", time.Now().Format("20060102150405"))
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		fileName = path.Base(params["filename"])
+	}
+	file := path.Join(b.output, fileName)
+	tmpFile := file + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmpFile)
+		return "", err
+	}
+	return file, os.Rename(tmpFile, file)
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	cluster "github.com/WuKongIM/WuKongIM/pkg/cluster/clusterserver"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/spf13/cobra"
+)
+
+// dbCMD 数据库维护命令（需要在服务停止后执行）
+type dbCMD struct {
+	ctx       *WuKongIMContext
+	from      int // 重新分区前的分区数量
+	to        int // 重新分区后的分区数量
+	slotCount int // 集群的槽数量
+}
+
+func newDbCMD(ctx *WuKongIMContext) *dbCMD {
+	return &dbCMD{
+		ctx: ctx,
+	}
+}
+
+func (d *dbCMD) CMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "database maintenance, the WuKongIM server must be stopped",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rebuildSearchIndex",
+		Short: "rebuild the full-text search index of all messages",
+		RunE:  d.rebuildSearchIndex,
+	})
+
+	reshardCmd := &cobra.Command{
+		Use:   "reshard",
+		Short: "change the shard num of the database (db.shardNum)",
+		Long:  "Move all data from the old shards into a new layout with the same routing, verify the key count of every table and the totals, then swap the directories. The old data is moved to a reshard-bak-<time> directory in the data directory. Set db.shardNum to the new value before starting the server.",
+		RunE:  d.reshard,
+	}
+	reshardCmd.Flags().IntVar(&d.from, "from", 0, "current shard num")
+	reshardCmd.Flags().IntVar(&d.to, "to", 0, "new shard num")
+	reshardCmd.Flags().IntVar(&d.slotCount, "slotCount", 0, "slot count of the cluster, default is the slot count of the config")
+	_ = reshardCmd.MarkFlagRequired("from")
+	_ = reshardCmd.MarkFlagRequired("to")
+	cmd.AddCommand(reshardCmd)
+	return cmd
+}
+
+func (d *dbCMD) rebuildSearchIndex(cmd *cobra.Command, args []string) error {
+	if serverRunning() {
+		err := fmt.Errorf("the WuKongIM server is running, stop it first")
+		fmt.Println("Error: ", err)
+		return err
+	}
+	db := d.openDB()
+	if err := db.Open(); err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	defer db.Close()
+
+	count, err := db.RebuildMessageSearchIndex()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	fmt.Printf("Message search index rebuilt, %d messages indexed\n", count)
+	return nil
+}
+
+func (d *dbCMD) reshard(cmd *cobra.Command, args []string) error {
+	if err := d.reshardAll(); err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	return nil
+}
+
+// reshardAll 重新分区频道db和槽日志db（槽日志db的分区数量也是db.shardNum），都校验通过后才替换目录
+func (d *dbCMD) reshardAll() error {
+	if serverRunning() {
+		return fmt.Errorf("the WuKongIM server is running, stop it first")
+	}
+	if d.from <= 0 || d.to <= 0 {
+		return fmt.Errorf("invalid shard num, from: %d to: %d", d.from, d.to)
+	}
+	if d.from == d.to {
+		return fmt.Errorf("the shard num is already %d", d.from)
+	}
+	slotCount := d.slotCount
+	if slotCount <= 0 {
+		slotCount = serverOpts.Cluster.SlotCount
+	}
+
+	dataDir := serverOpts.DataDir
+	dirs := []string{path.Join(dataDir, "db", "wukongimdb")} // 需要替换的目录
+	if err := checkShardNum(dirs[0], d.from); err != nil {
+		return err
+	}
+	logDir := path.Join(dataDir, "cluster", "logdb")
+	if _, err := os.Stat(logDir); err == nil {
+		if err = checkShardNum(logDir, d.from); err != nil {
+			return err
+		}
+		dirs = append(dirs, logDir)
+	}
+
+	swapped := false
+	defer func() {
+		if !swapped {
+			for _, dir := range dirs {
+				_ = os.RemoveAll(dir + "-reshard")
+			}
+		}
+	}()
+
+	stats, err := wkdb.Reshard(dirs[0], dirs[0]+"-reshard", d.from, d.to)
+	if err != nil {
+		return err
+	}
+	for _, stat := range stats {
+		fmt.Printf("%-28s %d keys\n", stat.Table, stat.Keys)
+	}
+	if len(dirs) > 1 {
+		count, err := cluster.ReshardPebbleShardLogStorage(logDir, logDir+"-reshard", uint32(d.from), uint32(d.to), uint32(slotCount))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-28s %d keys\n", "slotLog", count)
+	}
+
+	// 替换目录，失败时回滚已经替换的目录
+	bakDir := path.Join(dataDir, fmt.Sprintf("reshard-bak-%s", time.Now().Format("20060102150405")))
+	if err = os.MkdirAll(bakDir, 0755); err != nil {
+		return err
+	}
+	done := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		bak := path.Join(bakDir, path.Base(dir))
+		if err = os.Rename(dir, bak); err == nil {
+			if err = os.Rename(dir+"-reshard", dir); err != nil {
+				_ = os.Rename(bak, dir)
+			}
+		}
+		if err != nil {
+			for _, doneDir := range done {
+				_ = os.Rename(doneDir, doneDir+"-reshard")
+				_ = os.Rename(path.Join(bakDir, path.Base(doneDir)), doneDir)
+			}
+			return err
+		}
+		done = append(done, dir)
+	}
+	swapped = true
+	fmt.Printf("Resharded from %d to %d, previous data moved to %s\n", d.from, d.to, bakDir)
+	fmt.Printf("Set db.shardNum to %d in the config before starting the server\n", d.to)
+	return nil
+}
+
+// checkShardNum 校验目录下的分区数量与shardNum一致
+func checkShardNum(dir string, shardNum int) error {
+	for i := 0; ; i++ {
+		_, err := os.Stat(path.Join(dir, fmt.Sprintf("shard%03d", i)))
+		if os.IsNotExist(err) {
+			if i != shardNum {
+				return fmt.Errorf("%s has %d shards, but --from is %d", dir, i, shardNum)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dbCMD) openDB() wkdb.DB {
+	return wkdb.NewWukongDB(wkdb.NewOptions(
+		wkdb.WithDir(path.Join(serverOpts.DataDir, "db")),
+		wkdb.WithShardNum(serverOpts.Db.ShardNum),
+		wkdb.WithNodeId(serverOpts.Cluster.NodeId),
+		wkdb.WithSlotCount(serverOpts.Cluster.SlotCount),
+		wkdb.WithIsCmdChannel(serverOpts.IsCmdChannel),
+		wkdb.WithMessageSearchIndexOn(true),
+	))
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// exportCMD 通过管理api导出节点的用户、频道、成员、最近会话和消息（jsonl）
+type exportCMD struct {
+	ctx    *WuKongIMContext
+	addrs  []string
+	token  string
+	output string
+}
+
+func newExportCMD(ctx *WuKongIMContext) *exportCMD {
+	return &exportCMD{
+		ctx: ctx,
+	}
+}
+
+func (e *exportCMD) CMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export users, channels, subscribers, conversations and messages as jsonl",
+		Long:  "Export data through the manager api as jsonl. Every node only exports the data it leads, to export a whole cluster pass the manager address of every node with --addr.",
+		RunE:  e.run,
+	}
+	cmd.Flags().StringSliceVar(&e.addrs, "addr", nil, "manager address of the nodes to export, default is the manager address of the config")
+	cmd.Flags().StringVar(&e.token, "token", "", "manager token, default is the manager token of the config")
+	cmd.Flags().StringVarP(&e.output, "output", "o", "wukongim-export.jsonl", "output file")
+	return cmd
+}
+
+func (e *exportCMD) run(cmd *cobra.Command, args []string) error {
+	addrs := managerAddrs(e.addrs)
+	token := managerToken(e.token)
+
+	tmpFile := e.output + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	total := 0
+	for _, addr := range addrs {
+		count, err := e.export(addr, token, w)
+		if err != nil {
+			f.Close()
+			os.Remove(tmpFile)
+			fmt.Printf("Error: export %s failed: %v\n", addr, err)
+			return err
+		}
+		total += count
+		fmt.Printf("Exported %d records from %s\n", count, addr)
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, e.output)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		fmt.Println("Error: ", err)
+		return err
+	}
+	fmt.Printf("Exported %d records to %s\n", total, e.output)
+	return nil
+}
+
+// export 导出节点的数据写入w，去掉结束行，返回导出的行数；没有结束行说明节点导出中断
+func (e *exportCMD) export(addr string, token string, w io.Writer) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, managerURL(addr, "/manager/export"), nil)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("status: %d body: %s", resp.StatusCode, string(body))
+	}
+
+	reader := bufio.NewReaderSize(resp.Body, 64*1024)
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+				return count, err
+			}
+			if record.Type == "end" {
+				return count, nil
+			}
+			if _, err := w.Write(line); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err == io.EOF {
+			return count, fmt.Errorf("export is incomplete")
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// managerAddrs 管理api地址，默认为配置的本机管理地址
+func managerAddrs(addrs []string) []string {
+	if len(addrs) > 0 {
+		return addrs
+	}
+	_, port, _ := strings.Cut(serverOpts.Manager.Addr, ":")
+	return []string{fmt.Sprintf("http://127.0.0.1:%s", port)}
+}
+
+// managerToken 管理api的token，默认为配置的管理token
+func managerToken(token string) string {
+	if token != "" {
+		return token
+	}
+	return serverOpts.ManagerToken
+}
+
+func managerURL(addr string, path string) string {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/") + path
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// importCMD 通过管理api导入export命令导出的数据（jsonl）
+type importCMD struct {
+	ctx   *WuKongIMContext
+	addr  string
+	token string
+	input string
+}
+
+func newImportCMD(ctx *WuKongIMContext) *importCMD {
+	return &importCMD{
+		ctx: ctx,
+	}
+}
+
+func (i *importCMD) CMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "import users, channels, subscribers, conversations and messages from jsonl",
+		Long:  "Import the jsonl exported by the export command through the manager api of any node. The data is proposed to the cluster, message seqs are preserved and importing the same file again is safe.",
+		RunE:  i.run,
+	}
+	cmd.Flags().StringVar(&i.addr, "addr", "", "manager address of the node to import to, default is the manager address of the config")
+	cmd.Flags().StringVar(&i.token, "token", "", "manager token, default is the manager token of the config")
+	cmd.Flags().StringVarP(&i.input, "input", "i", "", "jsonl file to import")
+	_ = cmd.MarkFlagRequired("input")
+	return cmd
+}
+
+func (i *importCMD) run(cmd *cobra.Command, args []string) error {
+	var addrs []string
+	if i.addr != "" {
+		addrs = []string{i.addr}
+	}
+	addr := managerAddrs(addrs)[0]
+
+	f, err := os.Open(i.input)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequest(http.MethodPost, managerURL(addr, "/manager/import"), f)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if token := managerToken(i.token); token != "" {
+		req.Header.Set("token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status: %d body: %s", resp.StatusCode, string(body))
+		fmt.Println("Error: import failed: ", err)
+		return err
+	}
+	fmt.Printf("Imported %s to %s: %s\n", i.input, addr, string(body))
+	return nil
+}
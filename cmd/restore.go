@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkbackup"
+	"github.com/spf13/cobra"
+)
+
+// restoreDirs 备份包里的数据目录，恢复时整体替换数据目录下的同名目录
+var restoreDirs = []string{"db", "cluster", "conversation"}
+
+// restoreCMD 从备份包恢复节点数据（需要在服务停止后执行）
+type restoreCMD struct {
+	ctx       *WuKongIMContext
+	input     string
+	allowNode bool // 是否允许恢复其他节点的备份
+}
+
+func newRestoreCMD(ctx *WuKongIMContext) *restoreCMD {
+	return &restoreCMD{
+		ctx: ctx,
+	}
+}
+
+func (r *restoreCMD) CMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "restore the node data from a backup tarball, the WuKongIM server must be stopped",
+		Long:  "Restore the node data from a backup tarball, the WuKongIM server must be stopped. To rebuild a whole cluster, restore the backup of every node on that node and then start all nodes. The current data is moved to a restore-bak-<time> directory in the data directory.",
+		RunE:  r.run,
+	}
+	cmd.Flags().StringVar(&r.input, "input", "", "backup tarball")
+	cmd.Flags().BoolVar(&r.allowNode, "allowOtherNode", false, "allow restoring the backup of another node id")
+	_ = cmd.MarkFlagRequired("input")
+	return cmd
+}
+
+func (r *restoreCMD) run(cmd *cobra.Command, args []string) error {
+	if err := r.restore(); err != nil {
+		fmt.Println("Error: ", err)
+		return err
+	}
+	return nil
+}
+
+func (r *restoreCMD) restore() error {
+	if serverRunning() {
+		return fmt.Errorf("the WuKongIM server is running, stop it first")
+	}
+	f, err := os.Open(r.input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dataDir := serverOpts.DataDir
+	now := time.Now().Format("20060102150405")
+	stagingDir := path.Join(dataDir, fmt.Sprintf("restore-%s", now))
+	defer os.RemoveAll(stagingDir)
+
+	// 解压时校验每个文件的校验和
+	manifest, err := wkbackup.Extract(f, stagingDir)
+	if err != nil {
+		return err
+	}
+	if manifest.NodeId != serverOpts.Cluster.NodeId && !r.allowNode {
+		return fmt.Errorf("backup of node %d can not be restored to node %d", manifest.NodeId, serverOpts.Cluster.NodeId)
+	}
+	if manifest.DbShardNum != serverOpts.Db.ShardNum {
+		return fmt.Errorf("db shard num of backup is %d, but config is %d", manifest.DbShardNum, serverOpts.Db.ShardNum)
+	}
+	// 槽日志的分片数量也是db.shardNum
+	if manifest.SlotDbShardNum != serverOpts.Db.ShardNum {
+		return fmt.Errorf("slot log shard num of backup is %d, but config is %d", manifest.SlotDbShardNum, serverOpts.Db.ShardNum)
+	}
+
+	// 替换目录，失败时回滚已经替换的目录
+	bakDir := path.Join(dataDir, fmt.Sprintf("restore-bak-%s", now))
+	type replaced struct {
+		dir      string
+		backuped bool // 原目录是否已移到bakDir
+		restored bool // 备份里的目录是否已移到原位置
+	}
+	done := make([]replaced, 0, len(restoreDirs))
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			r := done[i]
+			current := path.Join(dataDir, r.dir)
+			if r.restored {
+				_ = os.Rename(current, path.Join(stagingDir, r.dir))
+			}
+			if r.backuped {
+				_ = os.Rename(path.Join(bakDir, r.dir), current)
+			}
+		}
+	}
+	for _, dir := range restoreDirs {
+		r := replaced{dir: dir}
+		current := path.Join(dataDir, dir)
+		if _, err = os.Stat(current); err == nil {
+			if err = os.MkdirAll(bakDir, 0755); err == nil {
+				if err = os.Rename(current, path.Join(bakDir, dir)); err == nil {
+					r.backuped = true
+				}
+			}
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+		if err == nil {
+			staged := path.Join(stagingDir, dir)
+			if _, err = os.Stat(staged); err == nil {
+				if err = os.Rename(staged, current); err == nil {
+					r.restored = true
+				}
+			} else if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		done = append(done, r)
+		if err != nil {
+			rollback()
+			return err
+		}
+	}
+	fmt.Printf("Backup of node %d created at %s restored to %s (%d files)\n", manifest.NodeId, time.Unix(manifest.CreatedAt, 0).Format(time.RFC3339), dataDir, len(manifest.Files))
+	if _, err = os.Stat(bakDir); err == nil {
+		fmt.Printf("Previous data moved to %s\n", bakDir)
+	}
+	return nil
+}
+
+// serverRunning pid文件里的进程是否还在运行
+func serverRunning() bool {
+	data, err := os.ReadFile(path.Join(installDir, pidfile))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -133,6 +133,11 @@ func addCommand(cmd CMD) {
 func Execute() {
 	ctx := &WuKongIMContext{}
 	addCommand(newStopCMD(ctx))
+	addCommand(newDbCMD(ctx))
+	addCommand(newBackupCMD(ctx))
+	addCommand(newRestoreCMD(ctx))
+	addCommand(newExportCMD(ctx))
+	addCommand(newImportCMD(ctx))
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
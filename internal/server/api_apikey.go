@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/auth"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// APIKeyAPI http api密钥管理
+type APIKeyAPI struct {
+	s *Server
+	wklog.Log
+}
+
+// NewAPIKeyAPI 创建API
+func NewAPIKeyAPI(s *Server) *APIKeyAPI {
+	return &APIKeyAPI{
+		s:   s,
+		Log: wklog.NewWKLog("APIKeyAPI"),
+	}
+}
+
+// Route 路由
+func (a *APIKeyAPI) Route(r *wkhttp.WKHttp) {
+	r.POST("/apikey/create", a.create) // 创建密钥（密钥明文只在创建和轮换时返回）
+	r.POST("/apikey/rotate", a.rotate) // 轮换密钥（旧密钥立即失效）
+	r.POST("/apikey/revoke", a.revoke) // 吊销密钥
+	r.GET("/apikey", a.get)            // 获取密钥信息
+}
+
+func (a *APIKeyAPI) create(c *wkhttp.Context) {
+	var req struct {
+		Name        string `json:"name"`        // 名称
+		Permissions string `json:"permissions"` // 权限 格式 resource:actions,resource:actions 例如 message:rw,channelInfo:r
+		ExpireAt    int64  `json:"expire_at"`   // 过期时间（unix秒），0表示不过期
+		AppId       string `json:"app_id"`      // 租户id，不为空时密钥只能访问该租户的用户和频道
+	}
+	if err := c.BindJSON(&req); err != nil {
+		a.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if len(auth.ParsePermissions(req.Permissions)) == 0 {
+		c.ResponseError(errors.New("permissions格式有误！"))
+		return
+	}
+	if req.AppId != "" {
+		if _, ok := a.s.opts.TenantApp(req.AppId); !ok || !a.s.opts.Tenant.On {
+			c.ResponseError(errors.New("租户不存在！"))
+			return
+		}
+	}
+
+	keyId, err := generateAPIKeyId()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	key, secretHash, err := generateAPIKey(keyId)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	apiKey := wkdb.APIKey{
+		KeyId:       keyId,
+		SecretHash:  secretHash,
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		CreatedAt:   time.Now().Unix(),
+		ExpireAt:    req.ExpireAt,
+		AppId:       req.AppId,
+	}
+	if err = a.s.store.AddOrUpdateAPIKey(apiKey); err != nil {
+		a.Error("创建api密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建api密钥失败！"))
+		return
+	}
+	// 清除各节点缓存的密钥不存在的结果
+	a.invalidate(keyId)
+
+	c.JSON(http.StatusOK, gin.H{
+		"key_id":      keyId,
+		"key":         key,
+		"name":        apiKey.Name,
+		"permissions": apiKey.Permissions,
+		"expire_at":   apiKey.ExpireAt,
+		"app_id":      apiKey.AppId,
+	})
+}
+
+func (a *APIKeyAPI) rotate(c *wkhttp.Context) {
+	var req struct {
+		KeyId string `json:"key_id"`
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		a.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if a.forwardToKeyLeader(c, req.KeyId, bodyBytes) {
+		return
+	}
+	apiKey, err := a.getAPIKey(c, req.KeyId)
+	if err != nil {
+		return
+	}
+	if apiKey.RevokedAt > 0 {
+		c.ResponseError(errors.New("api密钥已吊销！"))
+		return
+	}
+	key, secretHash, err := generateAPIKey(apiKey.KeyId)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	apiKey.SecretHash = secretHash
+	apiKey.RotatedAt = time.Now().Unix()
+	if err = a.s.store.AddOrUpdateAPIKey(apiKey); err != nil {
+		a.Error("轮换api密钥失败！", zap.Error(err), zap.String("keyId", apiKey.KeyId))
+		c.ResponseError(errors.New("轮换api密钥失败！"))
+		return
+	}
+	a.invalidate(apiKey.KeyId)
+
+	c.JSON(http.StatusOK, gin.H{
+		"key_id": apiKey.KeyId,
+		"key":    key,
+	})
+}
+
+func (a *APIKeyAPI) revoke(c *wkhttp.Context) {
+	var req struct {
+		KeyId string `json:"key_id"`
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		a.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if a.forwardToKeyLeader(c, req.KeyId, bodyBytes) {
+		return
+	}
+	apiKey, err := a.getAPIKey(c, req.KeyId)
+	if err != nil {
+		return
+	}
+	if apiKey.RevokedAt == 0 {
+		apiKey.RevokedAt = time.Now().Unix()
+		if err = a.s.store.AddOrUpdateAPIKey(apiKey); err != nil {
+			a.Error("吊销api密钥失败！", zap.Error(err), zap.String("keyId", apiKey.KeyId))
+			c.ResponseError(errors.New("吊销api密钥失败！"))
+			return
+		}
+	}
+	a.invalidate(apiKey.KeyId)
+	c.ResponseOK()
+}
+
+func (a *APIKeyAPI) get(c *wkhttp.Context) {
+	keyId := c.Query("key_id")
+	if a.forwardToKeyLeader(c, keyId, nil) {
+		return
+	}
+	apiKey, err := a.getAPIKey(c, keyId)
+	if err != nil {
+		return
+	}
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// getAPIKey 获取密钥，获取失败时直接响应错误
+func (a *APIKeyAPI) getAPIKey(c *wkhttp.Context, keyId string) (wkdb.APIKey, error) {
+	apiKey, err := a.s.store.GetAPIKey(keyId)
+	if err != nil {
+		if err == wkdb.ErrNotFound {
+			c.ResponseError(errors.New("api密钥不存在！"))
+			return wkdb.APIKey{}, err
+		}
+		a.Error("获取api密钥失败！", zap.Error(err), zap.String("keyId", keyId))
+		c.ResponseError(errors.New("获取api密钥失败！"))
+		return wkdb.APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+// forwardToKeyLeader 密钥不在本节点时转发请求给密钥所在槽的领导节点，已转发或出错返回true
+func (a *APIKeyAPI) forwardToKeyLeader(c *wkhttp.Context, keyId string, bodyBytes []byte) bool {
+	if strings.TrimSpace(keyId) == "" {
+		c.ResponseError(errors.New("key_id不能为空！"))
+		return true
+	}
+	if !a.s.opts.ClusterOn() {
+		return false
+	}
+	leaderInfo, err := a.s.cluster.SlotLeaderOfChannel(keyId, wkproto.ChannelTypePerson)
+	if err != nil {
+		a.Error("获取密钥所在节点失败！", zap.Error(err), zap.String("keyId", keyId))
+		c.ResponseError(errors.New("获取密钥所在节点失败！"))
+		return true
+	}
+	if leaderInfo.Id != a.s.opts.Cluster.NodeId {
+		a.Debug("转发请求：", zap.String("url", fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path)))
+		c.ForwardWithBody(fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path), bodyBytes)
+		return true
+	}
+	return false
+}
+
+// invalidate 清除所有节点缓存的密钥
+func (a *APIKeyAPI) invalidate(keyId string) {
+	a.s.apiKeyManager.invalidate(keyId)
+	a.s.broadcastRequest("/wk/apiKeyInvalidate", []byte(keyId))
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -57,6 +58,8 @@ func (ch *ChannelAPI) Route(r *wkhttp.WKHttp) {
 	r.POST("/channel/messagesync", ch.syncMessages)
 	//	获取某个频道最大的消息序号
 	r.GET("/channel/max_message_seq", ch.getChannelMaxMessageSeq)
+	//################### 数据源 ###################
+	r.POST("/channel/datasource_invalidate", ch.datasourceInvalidate) // 清除数据源缓存（channel_id为空清除所有）
 
 }
 
@@ -76,6 +79,10 @@ func (ch *ChannelAPI) channelCreateOrUpdate(c *wkhttp.Context) {
 		c.ResponseError(errors.New("暂不支持个人频道！"))
 		return
 	}
+	if err := ch.checkReplicaPolicy(req.ChannelInfoReq); err != nil {
+		c.ResponseError(err)
+		return
+	}
 
 	if ch.s.opts.ClusterOn() {
 		leaderInfo, err := ch.s.cluster.SlotLeaderOfChannel(req.ChannelID, req.ChannelType) // 获取频道的槽领导节点
@@ -93,7 +100,12 @@ func (ch *ChannelAPI) channelCreateOrUpdate(c *wkhttp.Context) {
 	}
 
 	// channelInfo := wkstore.NewChannelInfo(req.ChannelID, req.ChannelType)
-	channelInfo := req.ToChannelInfo()
+	channelInfo, err := ch.toChannelInfo(req.ChannelInfoReq)
+	if err != nil {
+		c.ResponseError(err)
+		ch.Error("获取频道信息失败！", zap.Error(err))
+		return
+	}
 
 	err = ch.s.store.AddOrUpdateChannel(channelInfo)
 	if err != nil {
@@ -101,6 +113,12 @@ func (ch *ChannelAPI) channelCreateOrUpdate(c *wkhttp.Context) {
 		ch.Error("创建频道失败！", zap.Error(err))
 		return
 	}
+	err = ch.updateChannelReplicaPolicy(req.ChannelInfoReq, channelInfo)
+	if err != nil {
+		ch.Error("更新频道副本策略失败！", zap.Error(err), zap.String("channelID", req.ChannelID), zap.Uint8("channelType", req.ChannelType))
+		c.ResponseError(errors.New("更新频道副本策略失败！"))
+		return
+	}
 	err = ch.s.store.RemoveAllSubscriber(req.ChannelID, req.ChannelType)
 	if err != nil {
 		ch.Error("移除所有订阅者失败！", zap.Error(err))
@@ -134,6 +152,10 @@ func (ch *ChannelAPI) updateOrAddChannelInfo(c *wkhttp.Context) {
 		c.ResponseError(errors.New("数据格式有误！"))
 		return
 	}
+	if err := ch.checkReplicaPolicy(req); err != nil {
+		c.ResponseError(err)
+		return
+	}
 
 	if ch.s.opts.ClusterOn() {
 		leaderInfo, err := ch.s.cluster.SlotLeaderOfChannel(req.ChannelID, req.ChannelType) // 获取频道的领导节点
@@ -150,13 +172,24 @@ func (ch *ChannelAPI) updateOrAddChannelInfo(c *wkhttp.Context) {
 		}
 	}
 
-	channelInfo := req.ToChannelInfo()
+	channelInfo, err := ch.toChannelInfo(req)
+	if err != nil {
+		ch.Error("获取频道信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取频道信息失败！"))
+		return
+	}
 	err = ch.s.store.AddOrUpdateChannel(channelInfo)
 	if err != nil {
 		ch.Error("添加或更新频道信息失败！", zap.Error(err))
 		c.ResponseError(errors.New("添加或更新频道信息失败！"))
 		return
 	}
+	err = ch.updateChannelReplicaPolicy(req, channelInfo)
+	if err != nil {
+		ch.Error("更新频道副本策略失败！", zap.Error(err), zap.String("channelID", req.ChannelID), zap.Uint8("channelType", req.ChannelType))
+		c.ResponseError(errors.New("更新频道副本策略失败！"))
+		return
+	}
 	channelKey := wkutil.ChannelToKey(req.ChannelID, req.ChannelType)
 	cacheChannel := ch.s.channelReactor.reactorSub(channelKey).channel(channelKey)
 	if cacheChannel != nil {
@@ -165,6 +198,42 @@ func (ch *ChannelAPI) updateOrAddChannelInfo(c *wkhttp.Context) {
 	c.ResponseOK()
 }
 
+// 检查频道的副本策略，指定的优先领导节点必须是集群里的节点
+func (ch *ChannelAPI) checkReplicaPolicy(req ChannelInfoReq) error {
+	if err := req.CheckReplicaPolicy(); err != nil {
+		return err
+	}
+	if req.PreferredLeader != nil && *req.PreferredLeader != 0 && ch.s.opts.ClusterOn() {
+		nodeInfo, err := ch.s.cluster.NodeInfoById(*req.PreferredLeader)
+		if err != nil || nodeInfo == nil {
+			return errors.New("优先领导节点不存在！")
+		}
+		if !nodeInfo.AllowVote {
+			return errors.New("优先领导节点不能是代理节点！")
+		}
+	}
+	return nil
+}
+
+// 请求里没有指定的副本策略保持频道现有的设置
+func (ch *ChannelAPI) toChannelInfo(req ChannelInfoReq) (wkdb.ChannelInfo, error) {
+	existing, err := ch.s.store.GetChannel(req.ChannelID, req.ChannelType)
+	if err != nil {
+		return wkdb.EmptyChannelInfo, err
+	}
+	return req.ToChannelInfo(existing), nil
+}
+
+// 将频道的副本策略应用到频道的分布式配置，请求里没有指定副本策略时不更新
+func (ch *ChannelAPI) updateChannelReplicaPolicy(req ChannelInfoReq, channelInfo wkdb.ChannelInfo) error {
+	if !ch.s.opts.ClusterOn() || !req.HasReplicaPolicy() {
+		return nil
+	}
+	timeoutCtx, cancel := context.WithTimeout(ch.s.ctx, ch.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	return ch.s.cluster.UpdateChannelReplicaPolicy(timeoutCtx, channelInfo)
+}
+
 func (ch *ChannelAPI) addSubscriber(c *wkhttp.Context) {
 	var req subscriberAddReq
 	bodyBytes, err := BindJSON(&req, c)
@@ -766,6 +835,9 @@ func (ch *ChannelAPI) syncMessages(c *wkhttp.Context) {
 			}
 		}
 	}
+	// 客户端可能在流进行中重连，这里把流片段合并到流的开始消息上
+	messageResps = ch.reassembleStreams(fakeChannelID, req.ChannelType, messageResps)
+
 	c.JSON(http.StatusOK, syncMessageResp{
 		StartMessageSeq: req.StartMessageSeq,
 		EndMessageSeq:   req.EndMessageSeq,
@@ -774,6 +846,52 @@ func (ch *ChannelAPI) syncMessages(c *wkhttp.Context) {
 	})
 }
 
+// reassembleStreams 将流片段合并到流的开始消息上，开始消息不在本次结果内的片段原样返回（客户端已有开始消息）
+func (ch *ChannelAPI) reassembleStreams(channelId string, channelType uint8, messageResps []*MessageResp) []*MessageResp {
+	starts := make(map[string]*MessageResp)
+	for _, messageResp := range messageResps {
+		if messageResp.StreamNo != "" && messageResp.StreamFlag == wkproto.StreamFlagStart {
+			starts[messageResp.StreamNo] = messageResp
+		}
+	}
+	if len(starts) == 0 {
+		return messageResps
+	}
+
+	for streamNo, startResp := range starts {
+		meta, err := ch.s.store.GetStreamMeta(channelId, channelType, streamNo)
+		if err != nil {
+			if err != wkdb.ErrNotFound {
+				ch.Error("获取流元数据失败！", zap.Error(err), zap.String("streamNo", streamNo))
+			}
+			delete(starts, streamNo)
+			continue
+		}
+		items, err := ch.s.store.GetStreamItems(channelId, channelType, streamNo)
+		if err != nil {
+			ch.Error("获取流片段失败！", zap.Error(err), zap.String("streamNo", streamNo))
+			delete(starts, streamNo)
+			continue
+		}
+		streams := make([]*StreamItemResp, 0, len(items))
+		for _, item := range items {
+			streams = append(streams, newStreamItemResp(item))
+		}
+		startResp.Streams = streams
+		startResp.StreamSeq = meta.LastStreamSeq
+		startResp.StreamFlag = meta.StreamFlag
+	}
+
+	results := make([]*MessageResp, 0, len(messageResps))
+	for _, messageResp := range messageResps {
+		if startResp, ok := starts[messageResp.StreamNo]; ok && startResp != messageResp { // 已合并到开始消息
+			continue
+		}
+		results = append(results, messageResp)
+	}
+	return results
+}
+
 func (ch *ChannelAPI) getChannelMaxMessageSeq(c *wkhttp.Context) {
 	channelId := c.Query("channel_id")
 	channelType := wkutil.StringToUint8(c.Query("channel_type"))
@@ -810,3 +928,20 @@ func (ch *ChannelAPI) getChannelMaxMessageSeq(c *wkhttp.Context) {
 		"message_seq": msgSeq,
 	})
 }
+
+// 业务数据变更后清除数据源缓存，所有节点都会清除
+func (ch *ChannelAPI) datasourceInvalidate(c *wkhttp.Context) {
+	var req datasourceInvalidateReq
+	if err := c.BindJSON(&req); err != nil {
+		ch.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if !ch.s.opts.HasDatasource() {
+		c.ResponseError(errors.New("没有配置数据源！"))
+		return
+	}
+	ch.s.invalidateDatasource(strings.TrimSpace(req.ChannelID), req.ChannelType)
+	ch.s.broadcastDatasourceInvalidate(&req)
+	c.ResponseOK()
+}
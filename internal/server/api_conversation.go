@@ -152,6 +152,8 @@ func (s *ConversationAPI) clearConversationUnread(c *wkhttp.Context) {
 
 	s.s.conversationManager.DeleteUserConversationFromCache(req.UID, fakeChannelId, req.ChannelType)
 
+	s.s.receiptManager.readed(req.UID, fakeChannelId, req.ChannelType, msgSeq)
+
 	c.ResponseOK()
 }
 
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/auth"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.uber.org/zap"
+)
+
+// api密钥的前缀，完整格式为 wk_<keyId>_<secret>
+const apiKeyPrefix = "wk_"
+
+// 密钥id和secret的长度（都是十六进制字符串）
+const (
+	apiKeyIdLen     = 16
+	apiKeySecretLen = 64
+)
+
+type apiKeyCacheItem struct {
+	apiKey      wkdb.APIKey // KeyId为空表示密钥不存在
+	permissions auth.PermissionConfigs
+	expireAt    time.Time
+}
+
+// apiKeyManager http api密钥管理
+// 密钥保存在密钥id所在的槽里，各节点缓存密钥，本节点不是槽领导节点时向槽领导节点获取
+type apiKeyManager struct {
+	s *Server
+
+	cache *lru.Cache[string, apiKeyCacheItem]
+
+	audit wklog.Log // 审计日志，记录每个写操作使用的密钥
+	wklog.Log
+}
+
+func newAPIKeyManager(s *Server) *apiKeyManager {
+	cache, err := lru.New[string, apiKeyCacheItem](s.opts.APIKey.CacheSize)
+	if err != nil {
+		panic(err)
+	}
+	return &apiKeyManager{
+		s:     s,
+		cache: cache,
+		audit: wklog.NewWKLog("APIAudit"),
+		Log:   wklog.NewWKLog("apiKeyManager"),
+	}
+}
+
+// authenticate 校验api密钥，返回密钥信息和权限
+func (a *apiKeyManager) authenticate(key string) (apiKeyCacheItem, error) {
+	keyId, secret, ok := parseAPIKey(key)
+	if !ok {
+		return apiKeyCacheItem{}, ErrAPIKeyInvalid
+	}
+	item, err := a.get(keyId)
+	if err != nil {
+		return apiKeyCacheItem{}, err
+	}
+	if item.apiKey.KeyId == "" {
+		return apiKeyCacheItem{}, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(item.apiKey.SecretHash)) != 1 {
+		return apiKeyCacheItem{}, ErrAPIKeyInvalid
+	}
+	if !item.apiKey.Valid(time.Now().Unix()) {
+		return apiKeyCacheItem{}, ErrAPIKeyInvalid
+	}
+	return item, nil
+}
+
+// get 获取密钥，先从缓存获取
+func (a *apiKeyManager) get(keyId string) (apiKeyCacheItem, error) {
+	item, ok := a.cache.Get(keyId)
+	if ok && time.Now().Before(item.expireAt) {
+		return item, nil
+	}
+
+	apiKey, err := a.load(keyId)
+	if err != nil && err != wkdb.ErrNotFound {
+		return apiKeyCacheItem{}, err
+	}
+	ttl := a.s.opts.APIKey.CacheTTL
+	if apiKey.KeyId == "" { // 不存在的密钥只短暂缓存，避免无效密钥的请求每次都查询
+		ttl = a.s.opts.APIKey.NegativeCacheTTL
+	}
+	item = apiKeyCacheItem{
+		apiKey:      apiKey,
+		permissions: auth.ParsePermissions(apiKey.Permissions),
+		expireAt:    time.Now().Add(ttl),
+	}
+	a.cache.Add(keyId, item)
+	return item, nil
+}
+
+// load 从密钥所在槽的领导节点获取密钥
+func (a *apiKeyManager) load(keyId string) (wkdb.APIKey, error) {
+	leaderId := a.s.opts.Cluster.NodeId
+	if a.s.opts.ClusterOn() {
+		var err error
+		leaderId, err = a.s.cluster.SlotLeaderIdOfChannel(keyId, wkproto.ChannelTypePerson)
+		if err != nil {
+			return wkdb.APIKey{}, err
+		}
+	}
+	if leaderId == a.s.opts.Cluster.NodeId {
+		return a.s.store.GetAPIKey(keyId)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(a.s.ctx, a.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := a.s.cluster.RequestWithContext(timeoutCtx, leaderId, "/wk/apiKeyGet", []byte(keyId))
+	if err != nil {
+		return wkdb.APIKey{}, err
+	}
+	if resp.Status == proto.Status_NotFound {
+		return wkdb.APIKey{}, wkdb.ErrNotFound
+	}
+	if resp.Status != proto.Status_OK {
+		return wkdb.APIKey{}, fmt.Errorf("get api key failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	apiKey := wkdb.APIKey{}
+	if err = apiKey.Unmarshal(resp.Body); err != nil {
+		return wkdb.APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+// invalidate 清除密钥缓存
+func (a *apiKeyManager) invalidate(keyId string) {
+	a.cache.Remove(keyId)
+}
+
+// auditWrite 记录写操作的审计日志
+func (a *apiKeyManager) auditWrite(keyId string, name string, method string, path string, status int, clientIP string) {
+	a.audit.Info("api write",
+		zap.String("keyId", keyId),
+		zap.String("keyName", name),
+		zap.String("method", method),
+		zap.String("path", path),
+		zap.Int("status", status),
+		zap.String("clientIP", clientIP),
+	)
+}
+
+// generateAPIKey 生成密钥，返回密钥明文和密钥secret的hash
+func generateAPIKey(keyId string) (string, string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+	secret := hex.EncodeToString(secretBytes)
+	return fmt.Sprintf("%s%s_%s", apiKeyPrefix, keyId, secret), hashAPIKeySecret(secret), nil
+}
+
+// generateAPIKeyId 生成密钥id
+func generateAPIKeyId() (string, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(idBytes), nil
+}
+
+// parseAPIKey 解析密钥，格式不对的密钥不会去查询
+func parseAPIKey(key string) (string, string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", false
+	}
+	keyId, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || len(keyId) != apiKeyIdLen || len(secret) != apiKeySecretLen || !isHex(keyId) || !isHex(secret) {
+		return "", "", false
+	}
+	return keyId, secret, true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
@@ -20,16 +22,27 @@ type MessageAPI struct {
 	s *Server
 	wklog.Log
 
-	syncRecordMap  map[string][]*syncRecord // 记录最后一次同步命令的记录（TODO：这个是临时方案，为了兼容老版本）
-	syncRecordLock sync.RWMutex
+	syncRecordMap          map[string][]*syncRecord    // 记录最后一次同步命令的记录（TODO：这个是临时方案，为了兼容老版本）
+	syncQueueRecordMap     map[string]*syncQueueRecord // 记录最后一次同步到的用户消息队列序号，回执后删除
+	syncQueueRecordPruneAt time.Time                   // 上次清理过期队列同步记录的时间
+	syncRecordLock         sync.RWMutex
+}
+
+// syncQueueRecordTTL 用户消息队列同步记录的有效期，超过有效期还没回执的记录会被清理
+const syncQueueRecordTTL = time.Minute * 5
+
+type syncQueueRecord struct {
+	queueLastSeq uint64
+	syncAt       time.Time
 }
 
 // NewMessageAPI NewMessageAPI
 func NewMessageAPI(s *Server) *MessageAPI {
 	return &MessageAPI{
-		s:             s,
-		Log:           wklog.NewWKLog("MessageApi"),
-		syncRecordMap: map[string][]*syncRecord{},
+		s:                  s,
+		Log:                wklog.NewWKLog("MessageApi"),
+		syncRecordMap:      map[string][]*syncRecord{},
+		syncQueueRecordMap: map[string]*syncQueueRecord{},
 	}
 }
 
@@ -39,12 +52,17 @@ func (m *MessageAPI) Route(r *wkhttp.WKHttp) {
 	// r.POST("/message/sendbatch", m.sendBatch) // 批量发送消息
 	r.POST("/message/sync", m.sync)       // 消息同步(写模式)
 	r.POST("/message/syncack", m.syncack) // 消息同步回执(写模式)
+	r.POST("/message/revoke", m.revoke)   // 撤回消息
+	r.POST("/message/edit", m.edit)       // 编辑消息
 
-	// // r.POST("/streammessage/start", m.streamMessageStart) // 流消息开始
-	// // r.POST("/streammessage/end", m.streamMessageEnd)     // 流消息结束
+	r.POST("/streammessage/start", m.streamMessageStart) // 流消息开始
+	r.POST("/streammessage/end", m.streamMessageEnd)     // 流消息结束
 
 	r.POST("/messages", m.searchMessages) // 查询消息
 
+	r.POST("/message/readed", m.readed)   // 查询消息的已读未读成员
+	r.POST("/message/receipt", m.receipt) // 批量查询消息的已读数
+
 }
 
 func (m *MessageAPI) send(c *wkhttp.Context) {
@@ -146,7 +164,7 @@ func (m *MessageAPI) sendMessageToChannel(req MessageSendReq, channelId string,
 
 	// 将消息提交到频道
 	systemDeviceId := req.FromUID
-	messageId, err := channel.proposeSend(req.FromUID, systemDeviceId, 0, m.s.opts.Cluster.NodeId, false, &wkproto.SendPacket{
+	messageId, err := channel.proposeStreamSend(req.FromUID, systemDeviceId, 0, m.s.opts.Cluster.NodeId, false, streamFlag, &wkproto.SendPacket{
 		Framer: wkproto.Framer{
 			RedDot:    wkutil.IntToBool(req.Header.RedDot),
 			SyncOnce:  wkutil.IntToBool(req.Header.SyncOnce),
@@ -167,6 +185,82 @@ func (m *MessageAPI) sendMessageToChannel(req MessageSendReq, channelId string,
 	return messageId, nil
 }
 
+// 流消息开始，返回流编号，之后通过/message/send携带stream_no发送流片段
+func (m *MessageAPI) streamMessageStart(c *wkhttp.Context) {
+	var req MessageStreamStartReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.FromUID) == "" {
+		req.FromUID = m.s.opts.SystemUID
+	}
+
+	clientMsgNo := req.ClientMsgNo
+	if strings.TrimSpace(clientMsgNo) == "" {
+		clientMsgNo = fmt.Sprintf("%s0", wkutil.GenUUID())
+	}
+	streamNo := wkutil.GenUUID()
+
+	messageId, err := m.sendMessageToChannel(MessageSendReq{
+		Header:      req.Header,
+		ClientMsgNo: clientMsgNo,
+		StreamNo:    streamNo,
+		FromUID:     req.FromUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload:     req.Payload,
+	}, req.ChannelID, req.ChannelType, clientMsgNo, wkproto.StreamFlagStart)
+	if err != nil {
+		m.Error("发送流开始消息失败！", zap.Error(err), zap.String("channelId", req.ChannelID), zap.Uint8("channelType", req.ChannelType))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOKWithData(map[string]interface{}{
+		"message_id":    messageId,
+		"client_msg_no": clientMsgNo,
+		"stream_no":     streamNo,
+	})
+}
+
+// 流消息结束
+func (m *MessageAPI) streamMessageEnd(c *wkhttp.Context) {
+	var req MessageStreamEndReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.FromUID) == "" {
+		req.FromUID = m.s.opts.SystemUID
+	}
+
+	clientMsgNo := fmt.Sprintf("%s0", wkutil.GenUUID())
+	_, err := m.sendMessageToChannel(MessageSendReq{
+		ClientMsgNo: clientMsgNo,
+		StreamNo:    req.StreamNo,
+		FromUID:     req.FromUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload:     req.Payload,
+	}, req.ChannelID, req.ChannelType, clientMsgNo, wkproto.StreamFlagEnd)
+	if err != nil {
+		m.Error("发送流结束消息失败！", zap.Error(err), zap.String("streamNo", req.StreamNo))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
 // 消息同步
 func (m *MessageAPI) sync(c *wkhttp.Context) {
 
@@ -298,6 +392,52 @@ func (m *MessageAPI) sync(c *wkhttp.Context) {
 		}
 	}
 
+	// ==================== 用户消息队列里的命令消息 ====================
+	cursor, err := m.s.store.GetMessageOfUserCursor(req.UID)
+	if err != nil {
+		m.Error("获取用户消息队列游标失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("获取用户消息队列游标失败！"))
+		return
+	}
+	queueMessages, err := m.s.store.LoadMessagesOfUser(req.UID, cursor+1, req.Limit)
+	if err != nil {
+		m.Error("获取用户消息队列消息失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("获取用户消息队列消息失败！"))
+		return
+	}
+	existMessageIds := make(map[int64]struct{}, len(messageResps))
+	for _, messageResp := range messageResps {
+		existMessageIds[messageResp.MessageId] = struct{}{}
+	}
+	var queueLastSeq uint64
+	for _, queueMessage := range queueMessages {
+		if _, ok := existMessageIds[queueMessage.MessageID]; !ok { // 已通过最近会话同步的消息不重复返回
+			if len(messageResps) >= req.Limit {
+				break
+			}
+			messageResp := &MessageResp{}
+			messageResp.from(queueMessage)
+			messageResps = append(messageResps, messageResp)
+		}
+		queueLastSeq = queueMessage.QueueSeq
+	}
+	m.syncRecordLock.Lock()
+	now := time.Now()
+	if now.Sub(m.syncQueueRecordPruneAt) > syncQueueRecordTTL {
+		for uid, record := range m.syncQueueRecordMap {
+			if now.Sub(record.syncAt) > syncQueueRecordTTL {
+				delete(m.syncQueueRecordMap, uid)
+			}
+		}
+		m.syncQueueRecordPruneAt = now
+	}
+	if queueLastSeq > 0 {
+		m.syncQueueRecordMap[req.UID] = &syncQueueRecord{queueLastSeq: queueLastSeq, syncAt: now}
+	} else {
+		delete(m.syncQueueRecordMap, req.UID)
+	}
+	m.syncRecordLock.Unlock()
+
 	c.JSON(http.StatusOK, messageResps)
 
 }
@@ -335,8 +475,23 @@ func (m *MessageAPI) syncack(c *wkhttp.Context) {
 		return
 	}
 
+	// 更新用户消息队列的游标，已确认的消息会被清理
+	m.syncRecordLock.Lock()
+	queueRecord := m.syncQueueRecordMap[req.UID]
+	delete(m.syncQueueRecordMap, req.UID)
+	m.syncRecordLock.Unlock()
+	if queueRecord != nil {
+		err = m.s.store.UpdateMessageOfUserCursorIfNeed(req.UID, queueRecord.queueLastSeq)
+		if err != nil {
+			m.Error("更新用户消息队列游标失败！", zap.Error(err), zap.String("uid", req.UID), zap.Uint64("queueLastSeq", queueRecord.queueLastSeq))
+			c.ResponseError(errors.New("更新用户消息队列游标失败！"))
+			return
+		}
+	}
+
 	m.syncRecordLock.RLock()
 	defer m.syncRecordLock.RUnlock()
+
 	if len(m.syncRecordMap[req.UID]) == 0 {
 		c.ResponseOK()
 		return
@@ -409,6 +564,198 @@ func (m *MessageAPI) syncack(c *wkhttp.Context) {
 	c.ResponseOK()
 }
 
+// 撤回消息
+func (m *MessageAPI) revoke(c *wkhttp.Context) {
+	var req messageRevokeReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	m.handleMessageOp(c, bodyBytes, req, wkdb.MessageOpRevoke, nil)
+}
+
+// 编辑消息
+func (m *MessageAPI) edit(c *wkhttp.Context) {
+	var req messageEditReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	m.handleMessageOp(c, bodyBytes, req.messageRevokeReq, wkdb.MessageOpEdit, req.Payload)
+}
+
+// handleMessageOp 撤回和编辑都作为操作消息提交到频道日志，由各副本按日志顺序应用到目标消息上
+func (m *MessageAPI) handleMessageOp(c *wkhttp.Context, bodyBytes []byte, req messageRevokeReq, opType wkdb.MessageOpType, payload []byte) {
+	fakeChannelId := req.ChannelID
+	notifyFromUid := req.LoginUID
+	if req.ChannelType == wkproto.ChannelTypePerson {
+		if req.LoginUID == m.s.opts.SystemUID && strings.TrimSpace(req.UID) == "" {
+			c.ResponseError(errors.New("系统账号操作个人频道消息时uid不能为空！"))
+			return
+		}
+		fakeChannelId = GetFakeChannelIDWith(req.ownerUid(), req.ChannelID)
+		notifyFromUid = req.ownerUid() // 个人频道接收者看到的频道是发送者，所以以会话所属的用户发送通知
+	}
+
+	if m.s.opts.ClusterOn() {
+		timeoutCtx, cancel := context.WithTimeout(m.s.ctx, time.Second*5)
+		leaderInfo, err := m.s.cluster.LeaderOfChannel(timeoutCtx, fakeChannelId, req.ChannelType) // 获取频道的领导节点
+		cancel()
+		if err != nil {
+			m.Error("获取频道所在节点失败！", zap.Error(err), zap.String("channelID", req.ChannelID), zap.Uint8("channelType", req.ChannelType))
+			c.ResponseError(errors.New("获取频道所在节点失败！"))
+			return
+		}
+		if leaderInfo.Id != m.s.opts.Cluster.NodeId {
+			m.Debug("转发请求：", zap.String("url", fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path)))
+			c.ForwardWithBody(fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path), bodyBytes)
+			return
+		}
+	}
+
+	targetMsg, err := m.s.store.LoadMsg(fakeChannelId, req.ChannelType, req.MessageSeq)
+	if err != nil {
+		if errors.Is(err, wkdb.ErrNotFound) {
+			c.ResponseError(errors.New("消息不存在！"))
+			return
+		}
+		m.Error("获取消息失败！", zap.Error(err), zap.Any("req", req))
+		c.ResponseError(err)
+		return
+	}
+	if targetMsg.IsOp() {
+		c.ResponseError(errors.New("不能操作此类消息！"))
+		return
+	}
+	if targetMsg.Revoke {
+		c.ResponseError(errors.New("消息已撤回！"))
+		return
+	}
+	if req.LoginUID != targetMsg.FromUID && req.LoginUID != m.s.opts.SystemUID { // 只有发送者或系统账号可以操作
+		c.ResponseError(errors.New("无权操作此消息！"))
+		return
+	}
+
+	opMsg := wkdb.Message{
+		RecvPacket: wkproto.RecvPacket{
+			MessageID:   m.s.channelReactor.messageIDGen.Generate().Int64(),
+			ClientMsgNo: fmt.Sprintf("%s0", wkutil.GenUUID()),
+			FromUID:     req.LoginUID,
+			ChannelID:   fakeChannelId,
+			ChannelType: req.ChannelType,
+			Timestamp:   int32(time.Now().Unix()),
+			Payload:     payload,
+		},
+		OpType:      opType,
+		OpTargetSeq: req.MessageSeq,
+	}
+	timeoutCtx, cancel := context.WithTimeout(m.s.ctx, time.Second*5)
+	defer cancel()
+	results, err := m.s.store.AppendMessages(timeoutCtx, fakeChannelId, req.ChannelType, []wkdb.Message{opMsg})
+	if err != nil {
+		m.Error("提交消息操作失败！", zap.Error(err), zap.Any("req", req))
+		c.ResponseError(err)
+		return
+	}
+	if len(results) > 0 {
+		opMsg.MessageSeq = uint32(results[0].LogIndex())
+	}
+
+	// 操作在日志提交后才应用到目标消息上，等本节点应用完再读取最新状态
+	if err := m.waitChannelApplied(timeoutCtx, fakeChannelId, req.ChannelType, uint64(opMsg.MessageSeq)); err != nil {
+		m.Error("等待消息操作应用失败！", zap.Error(err), zap.Any("req", req))
+		c.ResponseError(err)
+		return
+	}
+	targetMsg, err = m.s.store.LoadMsg(fakeChannelId, req.ChannelType, req.MessageSeq)
+	if err != nil {
+		m.Error("获取消息失败！", zap.Error(err), zap.Any("req", req))
+		c.ResponseError(err)
+		return
+	}
+
+	m.notifyMessageOp(fakeChannelId, req.ChannelID, notifyFromUid, opMsg, targetMsg)
+
+	c.ResponseOKWithData(map[string]interface{}{
+		"message_id":   opMsg.MessageID,
+		"message_seq":  opMsg.MessageSeq,
+		"edit_version": targetMsg.EditVersion,
+	})
+}
+
+// waitChannelApplied 等待频道日志在本节点应用到index
+func (m *MessageAPI) waitChannelApplied(ctx context.Context, channelId string, channelType uint8, index uint64) error {
+	tick := time.NewTicker(time.Millisecond * 10)
+	defer tick.Stop()
+	for {
+		appliedIndex, err := m.s.store.DB().GetChannelAppliedIndex(channelId, channelType)
+		if err != nil {
+			return err
+		}
+		if appliedIndex >= index {
+			return nil
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notifyMessageOp 通知在线订阅者消息已被撤回或编辑，离线的订阅者通过/channel/messagesync同步
+func (m *MessageAPI) notifyMessageOp(fakeChannelId string, channelId string, fromUid string, opMsg wkdb.Message, targetMsg wkdb.Message) {
+	notify := messageOpNotify{
+		Type:        messageOpNotifyTypeRevoke,
+		ChannelID:   channelId,
+		ChannelType: opMsg.ChannelType,
+		MessageId:   targetMsg.MessageID,
+		MessageSeq:  uint64(targetMsg.MessageSeq),
+		Revoke:      wkutil.BoolToInt(targetMsg.Revoke),
+		EditVersion: targetMsg.EditVersion,
+		EditorUid:   targetMsg.EditorUid,
+		EditedAt:    targetMsg.EditedAt,
+	}
+	if opMsg.OpType == wkdb.MessageOpEdit {
+		notify.Type = messageOpNotifyTypeEdit
+		notify.Payload = targetMsg.Payload
+	}
+
+	ch := m.s.channelReactor.loadOrCreateChannel(fakeChannelId, opMsg.ChannelType)
+	m.s.deliverManager.deliver(&deliverReq{
+		ch:          ch,
+		channelId:   fakeChannelId,
+		channelType: opMsg.ChannelType,
+		channelKey:  wkutil.ChannelToKey(fakeChannelId, opMsg.ChannelType),
+		tagKey:      ch.receiverTagKey.Load(),
+		messages: []ReactorChannelMessage{
+			{
+				FromUid:    fromUid,
+				MessageId:  opMsg.MessageID,
+				MessageSeq: opMsg.MessageSeq,
+				SendPacket: &wkproto.SendPacket{
+					ClientMsgNo: opMsg.ClientMsgNo,
+					ChannelID:   channelId,
+					ChannelType: opMsg.ChannelType,
+					Payload:     []byte(wkutil.ToJSON(notify)),
+				},
+			},
+		},
+	})
+}
+
 func (m *MessageAPI) searchMessages(c *wkhttp.Context) {
 	var req struct {
 		LoginUid    string   `json:"login_uid"`
@@ -460,3 +807,120 @@ func (m *MessageAPI) searchMessages(c *wkhttp.Context) {
 		Messages: resps,
 	})
 }
+
+// 查询消息的已读未读成员
+func (m *MessageAPI) readed(c *wkhttp.Context) {
+	var req MessageReadedReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !m.s.opts.Receipt.On {
+		c.ResponseError(ErrReceiptOff)
+		return
+	}
+
+	fakeChannelId := req.ChannelID
+	if req.ChannelType == wkproto.ChannelTypePerson {
+		fakeChannelId = GetFakeChannelIDWith(req.LoginUid, req.ChannelID)
+	}
+	if m.forwardToChannelSlotLeaderIfNeed(c, fakeChannelId, req.ChannelType, bodyBytes) {
+		return
+	}
+
+	members, cursorMap, err := m.s.receiptManager.channelReceipts(fakeChannelId, req.ChannelType)
+	if err != nil {
+		m.Error("获取频道回执失败！", zap.Error(err), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", req.ChannelType))
+		c.ResponseError(err)
+		return
+	}
+	resp := MessageReadedResp{
+		MessageSeq: req.MessageSeq,
+		ReadedUids: make([]string, 0),
+		UnreadUids: make([]string, 0),
+	}
+	for _, member := range members {
+		if cursorMap[member] >= req.MessageSeq {
+			resp.ReadedUids = append(resp.ReadedUids, member)
+		} else {
+			resp.UnreadUids = append(resp.UnreadUids, member)
+		}
+	}
+	resp.ReadedCount = len(resp.ReadedUids)
+	resp.UnreadCount = len(resp.UnreadUids)
+	c.JSON(http.StatusOK, resp)
+}
+
+// 批量查询消息的已读数
+func (m *MessageAPI) receipt(c *wkhttp.Context) {
+	var req MessageReceiptReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !m.s.opts.Receipt.On {
+		c.ResponseError(ErrReceiptOff)
+		return
+	}
+
+	fakeChannelId := req.ChannelID
+	if req.ChannelType == wkproto.ChannelTypePerson {
+		fakeChannelId = GetFakeChannelIDWith(req.LoginUid, req.ChannelID)
+	}
+	if m.forwardToChannelSlotLeaderIfNeed(c, fakeChannelId, req.ChannelType, bodyBytes) {
+		return
+	}
+
+	members, cursorMap, err := m.s.receiptManager.channelReceipts(fakeChannelId, req.ChannelType)
+	if err != nil {
+		m.Error("获取频道回执失败！", zap.Error(err), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", req.ChannelType))
+		c.ResponseError(err)
+		return
+	}
+	resps := make([]*MessageReceiptResp, 0, len(req.MessageSeqs))
+	for _, messageSeq := range req.MessageSeqs {
+		resp := &MessageReceiptResp{
+			MessageSeq: messageSeq,
+		}
+		for _, member := range members {
+			if cursorMap[member] >= messageSeq {
+				resp.ReadedCount++
+			} else {
+				resp.UnreadCount++
+			}
+		}
+		resps = append(resps, resp)
+	}
+	c.JSON(http.StatusOK, resps)
+}
+
+// forwardToChannelSlotLeaderIfNeed 频道的订阅者和已读位置保存在频道所在的槽，本节点不是槽领导则转发请求
+func (m *MessageAPI) forwardToChannelSlotLeaderIfNeed(c *wkhttp.Context, fakeChannelId string, channelType uint8, bodyBytes []byte) bool {
+	if !m.s.opts.ClusterOn() {
+		return false
+	}
+	leaderInfo, err := m.s.cluster.SlotLeaderOfChannel(fakeChannelId, channelType)
+	if err != nil {
+		m.Error("获取频道所在节点失败！", zap.Error(err), zap.String("channelID", fakeChannelId), zap.Uint8("channelType", channelType))
+		c.ResponseError(errors.New("获取频道所在节点失败！"))
+		return true
+	}
+	if leaderInfo.Id == m.s.opts.Cluster.NodeId {
+		return false
+	}
+	m.Debug("转发请求：", zap.String("url", fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path)))
+	c.ForwardWithBody(fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path), bodyBytes)
+	return true
+}
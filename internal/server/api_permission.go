@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/WuKongIM/WuKongIM/pkg/auth"
+	"github.com/WuKongIM/WuKongIM/pkg/auth/resource"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// apiPermission 接口需要的资源和操作
+type apiPermission struct {
+	resource resource.Id
+	action   auth.Action
+	public   bool // 公开接口，不需要认证
+}
+
+func readPermission(rs resource.Id) apiPermission {
+	return apiPermission{resource: rs, action: auth.ActionRead}
+}
+
+func writePermission(rs resource.Id) apiPermission {
+	return apiPermission{resource: rs, action: auth.ActionWrite}
+}
+
+// apiPermissions 接口对应的资源和操作 key为 method + 空格 + 路由
+// 新增接口时需要在这里添加，没有添加的接口使用api密钥访问时需要所有资源的权限
+var apiPermissions = map[string]apiPermission{
+	"GET /health":         {public: true},
+	"POST /manager/login": {public: true},
+
+	// 用户
+	"POST /user/token":                 writePermission(resource.User.Token),
+	"POST /user/device_quit":           writePermission(resource.User.Token),
+	"POST /user/token_deny":            writePermission(resource.User.Token),
+	"POST /user/token_deny_remove":     writePermission(resource.User.Token),
+	"POST /user/onlinestatus":          readPermission(resource.User.Status),
+	"POST /user/presence/subscribe":    writePermission(resource.User.Status),
+	"POST /user/presence/unsubscribe":  writePermission(resource.User.Status),
+	"POST /user/presence_setting":      writePermission(resource.User.Status),
+	"POST /user/systemuids_add":        writePermission(resource.User.SystemUID),
+	"POST /user/systemuids_remove":     writePermission(resource.User.SystemUID),
+	"POST /user/push_token":            writePermission(resource.User.Push),
+	"POST /user/push_setting":          writePermission(resource.User.Push),
+	"GET /route":                       readPermission(resource.Route),
+	"POST /route/batch":                readPermission(resource.Route),
+	"GET /connz":                       readPermission(resource.Connz),
+	"POST /conversations/clearUnread":  writePermission(resource.Conversation),
+	"POST /conversations/setUnread":    writePermission(resource.Conversation),
+	"POST /conversations/delete":       writePermission(resource.Conversation),
+	"POST /conversation/sync":          readPermission(resource.Conversation),
+	"POST /conversation/syncMessages":  readPermission(resource.Conversation),
+	"GET /webhook/outbox":              readPermission(resource.Webhook),
+	"GET /webhook/deadletters":         readPermission(resource.Webhook),
+	"POST /webhook/deadletters/replay": writePermission(resource.Webhook),
+	"POST /webhook/deadletters/remove": writePermission(resource.Webhook),
+
+	// 频道
+	"POST /channel":                       writePermission(resource.Channel.Info),
+	"POST /channel/info":                  writePermission(resource.Channel.Info),
+	"POST /channel/delete":                writePermission(resource.Channel.Info),
+	"POST /channel/subscriber_add":        writePermission(resource.Channel.Subscriber),
+	"POST /channel/subscriber_remove":     writePermission(resource.Channel.Subscriber),
+	"POST /channel/blacklist_add":         writePermission(resource.Channel.Blacklist),
+	"POST /channel/blacklist_set":         writePermission(resource.Channel.Blacklist),
+	"POST /channel/blacklist_remove":      writePermission(resource.Channel.Blacklist),
+	"POST /channel/whitelist_add":         writePermission(resource.Channel.Whitelist),
+	"POST /channel/whitelist_set":         writePermission(resource.Channel.Whitelist),
+	"POST /channel/whitelist_remove":      writePermission(resource.Channel.Whitelist),
+	"GET /channel/whitelist":              readPermission(resource.Channel.Whitelist),
+	"POST /channel/messagesync":           readPermission(resource.Channel.Message),
+	"GET /channel/max_message_seq":        readPermission(resource.Channel.Message),
+	"POST /channel/datasource_invalidate": writePermission(resource.Channel.Datasource),
+
+	// 消息
+	"POST /message/send":        writePermission(resource.Message.Message),
+	"POST /message/revoke":      writePermission(resource.Message.Message),
+	"POST /message/edit":        writePermission(resource.Message.Message),
+	"POST /message/sync":        readPermission(resource.Message.Message),
+	"POST /message/syncack":     writePermission(resource.Message.Message),
+	"POST /messages":            readPermission(resource.Message.Message),
+	"POST /streammessage/start": writePermission(resource.Message.Stream),
+	"POST /streammessage/end":   writePermission(resource.Message.Stream),
+	"POST /message/readed":      readPermission(resource.Message.Receipt),
+	"POST /message/receipt":     readPermission(resource.Message.Receipt),
+
+	// api密钥
+	"POST /apikey/create": writePermission(resource.APIKey),
+	"POST /apikey/rotate": writePermission(resource.APIKey),
+	"POST /apikey/revoke": writePermission(resource.APIKey),
+	"GET /apikey":         readPermission(resource.APIKey),
+
+	// 备份
+	"GET /backup": readPermission(resource.Backup),
+
+	// 数据导入导出
+	"GET /manager/export":  readPermission(resource.Data),
+	"POST /manager/import": writePermission(resource.Data),
+}
+
+// tenantDeniedResources 租户的api密钥不能访问的全局资源
+var tenantDeniedResources = map[resource.Id]bool{
+	resource.User.SystemUID: true,
+	resource.Connz:          true,
+	resource.Webhook:        true,
+	resource.APIKey:         true,
+	resource.Backup:         true,
+	resource.Data:           true,
+}
+
+// tenantScopedFields 请求中的uid和频道id字段，租户的api密钥只能访问自己租户的uid和频道
+var tenantScopedFields = map[string]bool{
+	"uid":         true,
+	"uids":        true,
+	"channel_id":  true,
+	"from_uid":    true,
+	"login_uid":   true,
+	"subscribers": true,
+	"editor_uid":  true,
+	"to_uids":     true,
+}
+
+// getAPIPermission 获取接口需要的资源和操作
+func getAPIPermission(method string, fullPath string) (apiPermission, bool) {
+	permission, ok := apiPermissions[method+" "+fullPath]
+	return permission, ok
+}
+
+// isWriteRequest 是否是写操作，没有配置权限的接口除GET外都认为是写操作
+func isWriteRequest(c *wkhttp.Context, permission apiPermission) bool {
+	return permission.action != auth.ActionRead && c.Request.Method != http.MethodGet
+}
+
+// apiAuthMiddleware 业务api的认证和鉴权
+// 请求头token为管理者token时拥有所有权限；开启了api密钥时通过 Authorization: Bearer <api key> 认证并校验接口对应资源的权限，写操作记录审计日志；
+// 都没有配置时不认证
+func (s *APIServer) apiAuthMiddleware() wkhttp.HandlerFunc {
+	return func(c *wkhttp.Context) {
+		permission, ok := getAPIPermission(c.Request.Method, c.FullPath())
+		if ok && permission.public {
+			c.Next()
+			return
+		}
+
+		managerToken := strings.TrimSpace(s.s.opts.ManagerToken)
+		if managerToken != "" && c.GetHeader("token") == managerToken {
+			c.Next()
+			if isWriteRequest(c, permission) {
+				s.s.apiKeyManager.auditWrite(s.s.opts.ManagerUID, "managerToken", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP())
+			}
+			return
+		}
+
+		if !s.s.opts.APIKey.On {
+			if managerToken != "" { // 管理者权限判断
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "api key is required", "status": http.StatusUnauthorized})
+			return
+		}
+		item, err := s.s.apiKeyManager.authenticate(key)
+		if err != nil {
+			if err != ErrAPIKeyInvalid {
+				s.Error("authenticate api key failed", zap.Error(err))
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": ErrAPIKeyInvalid.Error(), "status": http.StatusUnauthorized})
+			return
+		}
+		if !ok { // 没有配置权限的接口需要所有资源的权限
+			permission = apiPermission{resource: resource.All, action: auth.ActionAll}
+		}
+		if !item.permissions.HasPermission(permission.resource, permission.action) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "permission denied", "status": http.StatusForbidden})
+			return
+		}
+		if item.apiKey.AppId != "" {
+			if !ok || tenantDeniedResources[permission.resource] || !s.tenantRequestAllowed(c, item.apiKey.AppId) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "permission denied", "status": http.StatusForbidden})
+				return
+			}
+		}
+		c.Set("apiKeyId", item.apiKey.KeyId)
+		c.Next()
+
+		if isWriteRequest(c, permission) {
+			s.s.apiKeyManager.auditWrite(item.apiKey.KeyId, item.apiKey.Name, c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP())
+		}
+	}
+}
+
+// tenantRequestAllowed 请求参数和请求体里的uid和频道id是否都属于租户
+func (s *APIServer) tenantRequestAllowed(c *wkhttp.Context, appId string) bool {
+	for field := range tenantScopedFields {
+		if value := c.Query(field); value != "" && s.s.opts.AppIdOf(value) != appId {
+			return false
+		}
+	}
+	if c.Request.Body == nil {
+		return true
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body)) // 后续的处理还需要读取请求体
+	if len(bytes.TrimSpace(body)) == 0 {
+		return true
+	}
+	var data interface{}
+	if err = json.Unmarshal(body, &data); err != nil {
+		return false
+	}
+	return s.tenantValueAllowed(data, appId, false)
+}
+
+// tenantValueAllowed 递归校验json值，scoped为true表示值属于uid或频道id字段
+func (s *APIServer) tenantValueAllowed(value interface{}, appId string, scoped bool) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, fieldValue := range v {
+			if !s.tenantValueAllowed(fieldValue, appId, tenantScopedFields[key]) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !s.tenantValueAllowed(item, appId, scoped) {
+				return false
+			}
+		}
+	case string:
+		if scoped && v != "" && s.s.opts.AppIdOf(v) != appId {
+			return false
+		}
+	}
+	return true
+}
+
+// permissionMiddleware 管理api的鉴权，开启了鉴权时校验登录用户是否有接口对应资源的权限（管理者拥有所有权限）
+func (m *ManagerServer) permissionMiddleware() wkhttp.HandlerFunc {
+	return func(c *wkhttp.Context) {
+		permission, ok := getAPIPermission(c.Request.Method, c.FullPath())
+		if !ok || permission.public || !m.s.opts.Auth.On || c.Username() == m.s.opts.ManagerUID {
+			c.Next()
+			return
+		}
+		if !m.s.opts.Auth.HasPermissionWithContext(c, permission.resource, permission.action) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "permission denied", "status": http.StatusForbidden})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/auth"
+	"github.com/WuKongIM/WuKongIM/pkg/auth/resource"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIPermissionsCoverAllRoutes(t *testing.T) {
+	s := &Server{opts: NewOptions()}
+	apiServer := &APIServer{r: wkhttp.New(), s: s}
+	apiServer.setRoutes()
+
+	for _, route := range apiServer.r.GetGinRoute().Routes() {
+		_, ok := getAPIPermission(route.Method, route.Path)
+		assert.True(t, ok, "route %s %s has no permission", route.Method, route.Path)
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	keyId, err := generateAPIKeyId()
+	assert.NoError(t, err)
+	key, secretHash, err := generateAPIKey(keyId)
+	assert.NoError(t, err)
+
+	parsedKeyId, secret, ok := parseAPIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, keyId, parsedKeyId)
+	assert.Equal(t, secretHash, hashAPIKeySecret(secret))
+
+	_, _, ok = parseAPIKey("abc")
+	assert.False(t, ok)
+	_, _, ok = parseAPIKey("wk__secret")
+	assert.False(t, ok)
+	_, _, ok = parseAPIKey("wk_" + keyId + "_secret") // secret长度不对
+	assert.False(t, ok)
+	_, _, ok = parseAPIKey(strings.Replace(key, keyId, strings.Repeat("z", len(keyId)), 1)) // 密钥id不是十六进制
+	assert.False(t, ok)
+}
+
+func TestParsePermissions(t *testing.T) {
+	permissions := auth.ParsePermissions("message:rw, channelInfo:r")
+	assert.True(t, permissions.HasPermission(resource.Message.Message, auth.ActionWrite))
+	assert.True(t, permissions.HasPermission(resource.Channel.Info, auth.ActionRead))
+	assert.False(t, permissions.HasPermission(resource.Channel.Info, auth.ActionWrite))
+	assert.False(t, permissions.HasPermission(resource.User.Token, auth.ActionRead))
+	assert.False(t, permissions.HasPermission(resource.All, auth.ActionAll))
+
+	permissions = auth.ParsePermissions("*:*")
+	assert.True(t, permissions.HasPermission(resource.All, auth.ActionAll))
+	assert.True(t, permissions.HasPermission(resource.User.Token, auth.ActionWrite))
+}
+
+func TestAPIAuthMiddleware(t *testing.T) {
+	opts := NewOptions(WithAPIKeyOn(true))
+	opts.ManagerToken = "managerToken"
+	s := &Server{opts: opts}
+	s.apiKeyManager = newAPIKeyManager(s)
+
+	// 直接放入缓存，避免查询存储
+	addKey := func(permissions string, revokedAt int64) string {
+		keyId, err := generateAPIKeyId()
+		assert.NoError(t, err)
+		key, secretHash, err := generateAPIKey(keyId)
+		assert.NoError(t, err)
+		s.apiKeyManager.cache.Add(keyId, apiKeyCacheItem{
+			apiKey: wkdb.APIKey{
+				KeyId:       keyId,
+				SecretHash:  secretHash,
+				Permissions: permissions,
+				RevokedAt:   revokedAt,
+			},
+			permissions: auth.ParsePermissions(permissions),
+			expireAt:    time.Now().Add(time.Minute),
+		})
+		return key
+	}
+
+	apiServer := &APIServer{r: wkhttp.New(), s: s}
+	apiServer.r.Use(apiServer.apiAuthMiddleware())
+	ok := func(c *wkhttp.Context) { c.ResponseOK() }
+	apiServer.r.GET("/health", ok)
+	apiServer.r.POST("/message/send", ok)
+	apiServer.r.POST("/channel/info", ok)
+	apiServer.r.POST("/unlisted", ok)
+
+	request := func(path string, header string, value string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+		if path == "/health" {
+			req = httptest.NewRequest(http.MethodGet, path, nil)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		apiServer.r.GetGinRoute().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	messageKey := addKey("message:rw", 0)
+	allKey := addKey("*:*", 0)
+	revokedKey := addKey("*:*", time.Now().Unix())
+
+	assert.Equal(t, http.StatusOK, request("/health", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("/message/send", "", ""))
+	assert.Equal(t, http.StatusOK, request("/message/send", "token", "managerToken"))
+	assert.Equal(t, http.StatusOK, request("/unlisted", "token", "managerToken"))
+
+	assert.Equal(t, http.StatusOK, request("/message/send", "Authorization", "Bearer "+messageKey))
+	assert.Equal(t, http.StatusForbidden, request("/channel/info", "Authorization", "Bearer "+messageKey))
+	assert.Equal(t, http.StatusForbidden, request("/unlisted", "Authorization", "Bearer "+messageKey))
+	assert.Equal(t, http.StatusOK, request("/unlisted", "Authorization", "Bearer "+allKey))
+	assert.Equal(t, http.StatusUnauthorized, request("/message/send", "Authorization", "Bearer "+revokedKey))
+	assert.Equal(t, http.StatusUnauthorized, request("/message/send", "Authorization", "Bearer "+messageKey+"x"))
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,6 +39,15 @@ func (u *UserAPI) Route(r *wkhttp.WKHttp) {
 	r.POST("/user/onlinestatus", u.getOnlineStatus)       // 获取用户在线状态
 	r.POST("/user/systemuids_add", u.systemUIDsAdd)       // 添加系统uid
 	r.POST("/user/systemuids_remove", u.systemUIDsRemove) // 移除系统uid
+	r.POST("/user/push_token", u.updatePushToken)         // 更新设备的离线推送token
+	r.POST("/user/push_setting", u.updatePushSetting)     // 更新用户的离线推送设置
+
+	r.POST("/user/presence/subscribe", u.presenceSubscribe)     // 订阅用户的在线状态
+	r.POST("/user/presence/unsubscribe", u.presenceUnsubscribe) // 取消订阅用户的在线状态
+	r.POST("/user/presence_setting", u.updatePresenceSetting)   // 更新用户的在线状态隐私设置
+
+	r.POST("/user/token_deny", u.tokenDeny)              // 将设备token（jwt）加入拒绝名单
+	r.POST("/user/token_deny_remove", u.tokenDenyRemove) // 将设备token（jwt）移出拒绝名单
 
 }
 
@@ -312,6 +322,191 @@ func (u *UserAPI) updateToken(c *wkhttp.Context) {
 	c.ResponseOK()
 }
 
+// 更新设备的离线推送token
+func (u *UserAPI) updatePushToken(c *wkhttp.Context) {
+	var req UpdatePushTokenReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if req.PushToken != "" && u.s.pushManager.provider(req.Provider) == nil {
+		c.ResponseError(fmt.Errorf("不支持的推送服务商[%s]！", req.Provider))
+		return
+	}
+	if u.forwardToUserLeader(c, req.UID, bodyBytes) {
+		return
+	}
+
+	device, err := u.s.store.GetDevice(req.UID, uint64(req.DeviceFlag))
+	if err != nil {
+		if err == wkdb.ErrNotFound {
+			c.ResponseError(errors.New("设备不存在，请先更新用户token！"))
+			return
+		}
+		u.Error("获取设备信息失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("获取设备信息失败！"))
+		return
+	}
+	device.PushProvider = req.Provider
+	device.PushToken = req.PushToken
+	if req.PushToken == "" {
+		device.PushProvider = ""
+	}
+	if err = u.s.store.AddOrUpdateDevice(device); err != nil {
+		u.Error("更新推送token失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("更新推送token失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 更新用户的离线推送设置
+func (u *UserAPI) updatePushSetting(c *wkhttp.Context) {
+	var req struct {
+		UID  string `json:"uid"`  // 用户uid
+		Mute int    `json:"mute"` // 是否免打扰 1.免打扰 0.正常推送
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.UID) == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	if u.forwardToUserLeader(c, req.UID, bodyBytes) {
+		return
+	}
+
+	if err = u.s.store.UpdateUserPushMute(req.UID, req.Mute == 1); err != nil {
+		u.Error("更新推送设置失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("更新推送设置失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// forwardToUserLeader 用户数据不在本节点时转发请求给用户所在的领导节点，已转发返回true
+func (u *UserAPI) forwardToUserLeader(c *wkhttp.Context, uid string, bodyBytes []byte) bool {
+	return u.forwardToChannelLeader(c, uid, wkproto.ChannelTypePerson, bodyBytes)
+}
+
+// forwardToChannelLeader 频道数据不在本节点时转发请求给频道所在的槽领导节点，已转发返回true
+func (u *UserAPI) forwardToChannelLeader(c *wkhttp.Context, channelId string, channelType uint8, bodyBytes []byte) bool {
+	leaderInfo, err := u.s.cluster.SlotLeaderOfChannel(channelId, channelType) // 获取频道的领导节点
+	if err != nil {
+		u.Error("获取频道所在节点失败！", zap.Error(err), zap.String("channelID", channelId), zap.Uint8("channelType", channelType))
+		c.ResponseError(errors.New("获取频道所在节点失败！"))
+		return true
+	}
+	if leaderInfo.Id != u.s.opts.Cluster.NodeId {
+		u.Debug("转发请求：", zap.String("url", fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path)))
+		c.ForwardWithBody(fmt.Sprintf("%s%s", leaderInfo.ApiServerAddr, c.Request.URL.Path), bodyBytes)
+		return true
+	}
+	return false
+}
+
+// 更新用户的在线状态隐私设置
+func (u *UserAPI) updatePresenceSetting(c *wkhttp.Context) {
+	var req struct {
+		UID    string `json:"uid"`    // 用户uid
+		Hidden int    `json:"hidden"` // 是否隐藏在线状态 1.隐藏 0.公开
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.UID) == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	if u.forwardToUserLeader(c, req.UID, bodyBytes) {
+		return
+	}
+
+	if err = u.s.store.UpdateUserPresenceHidden(req.UID, req.Hidden == 1); err != nil {
+		u.Error("更新在线状态设置失败！", zap.Error(err), zap.String("uid", req.UID))
+		c.ResponseError(errors.New("更新在线状态设置失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 订阅用户的在线状态，被订阅用户上线、离线时推送给订阅者的在线设备
+func (u *UserAPI) presenceSubscribe(c *wkhttp.Context) {
+	u.handlePresenceSubscribe(c, false)
+}
+
+// 取消订阅用户的在线状态
+func (u *UserAPI) presenceUnsubscribe(c *wkhttp.Context) {
+	u.handlePresenceSubscribe(c, true)
+}
+
+func (u *UserAPI) handlePresenceSubscribe(c *wkhttp.Context, unsubscribe bool) {
+	var req PresenceSubscribeReq
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if err := req.Check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !u.s.opts.Presence.On {
+		c.ResponseError(ErrPresenceOff)
+		return
+	}
+
+	uids := req.Uids
+	if strings.TrimSpace(req.ChannelID) != "" {
+		if req.ChannelType == wkproto.ChannelTypePerson {
+			uids = append(uids, req.ChannelID)
+		} else {
+			// 频道的订阅者在频道所在的槽领导节点，订阅时展开为订阅者列表
+			if u.forwardToChannelLeader(c, req.ChannelID, req.ChannelType, bodyBytes) {
+				return
+			}
+			subscribers, err := u.s.store.GetSubscribers(req.ChannelID, req.ChannelType)
+			if err != nil {
+				u.Error("获取频道订阅者失败！", zap.Error(err), zap.String("channelId", req.ChannelID), zap.Uint8("channelType", req.ChannelType))
+				c.ResponseError(errors.New("获取频道订阅者失败！"))
+				return
+			}
+			uids = append(uids, subscribers...)
+		}
+	}
+	if len(uids) > u.s.opts.Presence.MaxSubscribeCount {
+		c.ResponseError(fmt.Errorf("一次最多订阅%d个用户！", u.s.opts.Presence.MaxSubscribeCount))
+		return
+	}
+	uids = wkutil.RemoveRepeatedElement(uids)
+
+	statuses, err := u.s.presenceManager.subscribe(req.Uid, uids, unsubscribe)
+	if err != nil {
+		u.Error("订阅在线状态失败！", zap.Error(err), zap.String("uid", req.Uid), zap.Bool("unsubscribe", unsubscribe))
+		c.ResponseError(errors.New("订阅在线状态失败！"))
+		return
+	}
+	if unsubscribe {
+		c.ResponseOK()
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
 // 添加系统uid
 func (u *UserAPI) systemUIDsAdd(c *wkhttp.Context) {
 	var req struct {
@@ -395,8 +590,112 @@ func (u UpdateTokenReq) Check() error {
 	return nil
 }
 
+// UpdatePushTokenReq 更新离线推送token请求
+type UpdatePushTokenReq struct {
+	UID        string             `json:"uid"`         // 用户唯一uid
+	DeviceFlag wkproto.DeviceFlag `json:"device_flag"` // 设备标识  0.app 1.web 2.pc
+	Provider   string             `json:"provider"`    // 推送服务商 apns或fcm
+	PushToken  string             `json:"push_token"`  // 推送token，为空则清除
+}
+
+// Check 检查输入
+func (u UpdatePushTokenReq) Check() error {
+	if u.UID == "" {
+		return errors.New("uid不能为空！")
+	}
+	if u.PushToken != "" && u.Provider == "" {
+		return errors.New("provider不能为空！")
+	}
+	return nil
+}
+
 type OnlinestatusResp struct {
 	UID        string `json:"uid"`         // 在线用户uid
 	DeviceFlag uint8  `json:"device_flag"` // 设备标记 0. APP 1.web
 	Online     int    `json:"online"`      // 是否在线
 }
+
+// 将设备token（jwt）加入拒绝名单，jti为空表示拒绝用户在此之前签发的所有token，已连接的设备会被踢下线
+func (u *UserAPI) tokenDeny(c *wkhttp.Context) {
+	var req struct {
+		UID      string `json:"uid"`       // 用户uid
+		Jti      string `json:"jti"`       // token的唯一id（jwt的jti），为空表示拒绝此前签发的所有token
+		ExpireAt int64  `json:"expire_at"` // 拒绝名单的过期时间（unix秒），一般为token的过期时间，0表示不过期
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.UID) == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	if u.forwardToUserLeader(c, req.UID, bodyBytes) {
+		return
+	}
+
+	deny := wkdb.TokenDeny{
+		Uid:      req.UID,
+		Jti:      req.Jti,
+		DeniedAt: time.Now().UnixMilli(),
+		ExpireAt: req.ExpireAt,
+	}
+	if err = u.s.store.AddTokenDeny(deny); err != nil {
+		u.Error("添加token拒绝名单失败！", zap.Error(err), zap.String("uid", req.UID), zap.String("jti", req.Jti))
+		c.ResponseError(errors.New("添加token拒绝名单失败！"))
+		return
+	}
+
+	// 踢掉使用被拒绝token的连接
+	conns := u.s.userReactor.getConnContexts(req.UID)
+	for _, conn := range conns {
+		if !conn.isAuth.Load() {
+			continue
+		}
+		if deny.Jti == "" {
+			if conn.tokenIssuedAt >= deny.DeniedAt {
+				continue
+			}
+		} else if conn.tokenId != deny.Jti {
+			continue
+		}
+		u.Info("token被拒绝，踢掉连接", zap.String("uid", req.UID), zap.Int64("connId", conn.connId), zap.String("jti", conn.tokenId))
+		_ = u.s.userReactor.writePacket(conn, &wkproto.DisconnectPacket{
+			ReasonCode: wkproto.ReasonConnectKick,
+			Reason:     "token已失效",
+		})
+		u.s.timingWheel.AfterFunc(time.Second*10, func() {
+			conn.close()
+		})
+	}
+	c.ResponseOK()
+}
+
+// 将设备token（jwt）移出拒绝名单
+func (u *UserAPI) tokenDenyRemove(c *wkhttp.Context) {
+	var req struct {
+		UID string `json:"uid"` // 用户uid
+		Jti string `json:"jti"` // token的唯一id（jwt的jti）
+	}
+	bodyBytes, err := BindJSON(&req, c)
+	if err != nil {
+		u.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.UID) == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	if u.forwardToUserLeader(c, req.UID, bodyBytes) {
+		return
+	}
+	if err = u.s.store.RemoveTokenDeny(req.UID, req.Jti); err != nil {
+		u.Error("移除token拒绝名单失败！", zap.Error(err), zap.String("uid", req.UID), zap.String("jti", req.Jti))
+		c.ResponseError(errors.New("移除token拒绝名单失败！"))
+		return
+	}
+	c.ResponseOK()
+}
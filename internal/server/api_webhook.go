@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// WebhookAPI webhook事件管理api（只管理本节点的事件）
+type WebhookAPI struct {
+	wklog.Log
+	s *Server
+}
+
+func NewWebhookAPI(s *Server) *WebhookAPI {
+	return &WebhookAPI{
+		Log: wklog.NewWKLog("WebhookAPI"),
+		s:   s,
+	}
+}
+
+func (w *WebhookAPI) Route(r *wkhttp.WKHttp) {
+	r.GET("/webhook/outbox", w.outbox)                         // 待发送的事件
+	r.GET("/webhook/deadletters", w.deadLetters)               // 发送失败的事件
+	r.POST("/webhook/deadletters/replay", w.replayDeadLetters) // 重放发送失败的事件
+	r.POST("/webhook/deadletters/remove", w.removeDeadLetters) // 删除发送失败的事件
+}
+
+func (w *WebhookAPI) outbox(c *wkhttp.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	events, err := w.s.store.GetWebhookEvents(math.MaxUint64, limit)
+	if err != nil {
+		w.Error("获取webhook待发送事件失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookEventResps(events))
+}
+
+func (w *WebhookAPI) deadLetters(c *wkhttp.Context) {
+	startId, _ := strconv.ParseUint(c.Query("start_id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	events, err := w.s.store.GetWebhookDeadLetters(startId, limit)
+	if err != nil {
+		w.Error("获取webhook死信失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookEventResps(events))
+}
+
+func (w *WebhookAPI) replayDeadLetters(c *wkhttp.Context) {
+	var req struct {
+		Ids []string `json:"ids"` // 需要重放的事件id，为空则重放所有死信
+	}
+	if err := c.BindJSON(&req); err != nil {
+		w.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	ids, err := parseWebhookEventIds(req.Ids)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := w.s.store.ReplayWebhookDeadLetters(ids, uint64(time.Now().UnixMilli()))
+	if err != nil {
+		w.Error("重放webhook死信失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"count": count,
+	})
+}
+
+func (w *WebhookAPI) removeDeadLetters(c *wkhttp.Context) {
+	var req struct {
+		Ids []string `json:"ids"` // 需要删除的事件id
+	}
+	if err := c.BindJSON(&req); err != nil {
+		w.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if len(req.Ids) == 0 {
+		c.ResponseError(errors.New("ids不能为空！"))
+		return
+	}
+	ids, err := parseWebhookEventIds(req.Ids)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err = w.s.store.RemoveWebhookDeadLetters(ids); err != nil {
+		w.Error("删除webhook死信失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// 事件id超过了js的整数精度，所以用字符串传递
+func parseWebhookEventIds(idStrs []string) ([]uint64, error) {
+	ids := make([]uint64, 0, len(idStrs))
+	for _, idStr := range idStrs {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("事件id[%s]格式有误！", idStr)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type webhookEventResp struct {
+	Id          string          `json:"id"`
+	Event       string          `json:"event"`
+	Data        json.RawMessage `json:"data"`
+	RetryCount  uint32          `json:"retry_count"`
+	NextRetryAt uint64          `json:"next_retry_at"` // 毫秒
+	LastError   string          `json:"last_error"`
+	CreatedAt   uint64          `json:"created_at"` // 毫秒
+}
+
+func newWebhookEventResps(events []wkdb.WebhookEvent) []*webhookEventResp {
+	resps := make([]*webhookEventResp, 0, len(events))
+	for _, e := range events {
+		data := json.RawMessage(e.Data)
+		if !json.Valid(e.Data) {
+			data, _ = json.Marshal(string(e.Data))
+		}
+		resps = append(resps, &webhookEventResp{
+			Id:          strconv.FormatUint(e.Id, 10),
+			Event:       e.Event,
+			Data:        data,
+			RetryCount:  e.RetryCount,
+			NextRetryAt: e.NextRetryAt,
+			LastError:   e.LastError,
+			CreatedAt:   e.CreatedAt,
+		})
+	}
+	return resps
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	cluster "github.com/WuKongIM/WuKongIM/pkg/cluster/clusterserver"
+	"github.com/WuKongIM/WuKongIM/pkg/wkbackup"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/version"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+var ErrBackupInProgress = errors.New("backup is in progress")
+
+// BackupAPI 节点数据在线备份api（只备份本节点的数据，整个集群需要备份每个节点）
+type BackupAPI struct {
+	wklog.Log
+	s       *Server
+	running atomic.Bool // 是否有备份正在进行
+}
+
+func NewBackupAPI(s *Server) *BackupAPI {
+	return &BackupAPI{
+		Log: wklog.NewWKLog("BackupAPI"),
+		s:   s,
+	}
+}
+
+func (b *BackupAPI) Route(r *wkhttp.WKHttp) {
+	r.GET("/backup", b.backup) // 下载本节点的备份包
+}
+
+func (b *BackupAPI) backup(c *wkhttp.Context) {
+	if !b.running.CompareAndSwap(false, true) {
+		c.ResponseError(ErrBackupInProgress)
+		return
+	}
+	defer b.running.Store(false)
+
+	dir, manifest, err := b.s.checkpoint()
+	if dir != "" {
+		defer os.RemoveAll(dir)
+	}
+	if err != nil {
+		b.Error("备份失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+
+	// 快照已生成，之后的错误只能中断传输，下载方通过校验和发现
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", backupFileName(manifest.NodeId, time.Unix(manifest.CreatedAt, 0))))
+	c.Status(http.StatusOK)
+	if err = wkbackup.Write(c.Writer, dir, manifest); err != nil {
+		b.Error("写入备份包失败！", zap.Error(err))
+		return
+	}
+	b.Info("备份完成", zap.String("remoteAddr", c.Request.RemoteAddr))
+}
+
+func backupFileName(nodeId uint64, t time.Time) string {
+	return fmt.Sprintf("wukongim-%d-%s.tar.gz", nodeId, t.Format("20060102150405"))
+}
+
+// checkpoint 在数据目录下生成本节点所有数据的快照，返回快照目录（调用方负责删除）和清单
+// 快照目录的结构与数据目录一致：db（频道数据），cluster/logdb（槽日志），cluster/config（集群配置），conversation（最近会话）
+// 槽日志和db的快照在暂停应用槽日志期间生成，db里的数据和槽日志里已应用的下标一致；
+// 频道消息日志以及各个库的各个分片不是同一时刻的原子快照
+func (s *Server) checkpoint() (string, wkbackup.Manifest, error) {
+	now := time.Now()
+	manifest := wkbackup.Manifest{
+		NodeId:         s.opts.Cluster.NodeId,
+		AppVersion:     version.Version,
+		CreatedAt:      now.Unix(),
+		DbShardNum:     s.opts.Db.ShardNum,
+		SlotDbShardNum: s.opts.Db.ShardNum,
+	}
+	dir := path.Join(s.opts.DataDir, fmt.Sprintf("backup-%d", now.UnixNano()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", manifest, err
+	}
+	checkpointDb := func() error {
+		return s.store.DB().Checkpoint(path.Join(dir, "db"))
+	}
+	if clusterServer, ok := s.cluster.(*cluster.Server); ok {
+		if err := clusterServer.Checkpoint(path.Join(dir, "cluster"), checkpointDb); err != nil {
+			return dir, manifest, err
+		}
+	} else if err := checkpointDb(); err != nil {
+		return dir, manifest, err
+	}
+	if err := s.conversationManager.saveTo(path.Join(dir, "conversation")); err != nil {
+		return dir, manifest, err
+	}
+	return dir, manifest, nil
+}
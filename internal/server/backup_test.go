@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkbackup"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupCheckpoint(t *testing.T) {
+	s := NewTestServer(t, WithDemoOn(false))
+	s.opts.Mode = TestMode
+	err := s.Start()
+	assert.NoError(t, err)
+
+	err = s.store.DB().AddOrUpdateAPIKey(wkdb.APIKey{KeyId: "key1", Name: "backup"})
+	assert.NoError(t, err)
+
+	dir, manifest, err := s.checkpoint()
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.Equal(t, s.opts.Cluster.NodeId, manifest.NodeId)
+
+	for _, p := range []string{"db/wukongimdb/shard000", "cluster/logdb/shard000", "cluster/config/cfglogdb", "cluster/config/remote.json", "cluster/config/local.json"} {
+		_, err = os.Stat(path.Join(dir, p))
+		assert.NoError(t, err, p)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, wkbackup.Write(buf, dir, manifest))
+	assert.NoError(t, s.Stop())
+
+	// 恢复的数据可以打开并读取备份前写入的数据
+	restoreDir := t.TempDir()
+	_, err = wkbackup.Extract(buf, restoreDir)
+	assert.NoError(t, err)
+	db := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(path.Join(restoreDir, "db")), wkdb.WithShardNum(s.opts.Db.ShardNum), wkdb.WithNodeId(s.opts.Cluster.NodeId)))
+	assert.NoError(t, db.Open())
+	defer db.Close()
+	apiKey, err := db.GetAPIKey("key1")
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", apiKey.Name)
+}
@@ -340,6 +340,11 @@ func (c *channel) tickProxy() {
 }
 
 func (c *channel) proposeSend(fromUid string, fromDeviceId string, fromConnId int64, fromNodeId uint64, isEncrypt bool, sendPacket *wkproto.SendPacket) (int64, error) {
+	return c.proposeStreamSend(fromUid, fromDeviceId, fromConnId, fromNodeId, isEncrypt, wkproto.StreamFlagIng, sendPacket)
+}
+
+// proposeStreamSend 提案消息并指定流标记（只有sendPacket开启了流时有效）
+func (c *channel) proposeStreamSend(fromUid string, fromDeviceId string, fromConnId int64, fromNodeId uint64, isEncrypt bool, streamFlag wkproto.StreamFlag, sendPacket *wkproto.SendPacket) (int64, error) {
 
 	c.sendTick = 0
 
@@ -352,6 +357,7 @@ func (c *channel) proposeSend(fromUid string, fromDeviceId string, fromConnId in
 		SendPacket:   sendPacket,
 		MessageId:    messageId,
 		IsEncrypt:    isEncrypt,
+		StreamFlag:   streamFlag,
 	}
 
 	c.sub.step(c, &ChannelAction{
@@ -459,7 +465,11 @@ func (c *channel) makeReceiverTag() (*tag, error) {
 		if c.r.s.opts.IsCmdChannel(c.channelId) {
 			realChannelId = c.r.opts.CmdChannelConvertOrginalChannel(c.channelId)
 		}
-		subscribers, err = c.r.s.store.GetSubscribers(realChannelId, c.channelType)
+		if c.r.s.opts.HasDatasource() { // 配置了数据源，订阅者从数据源获取
+			subscribers, err = c.r.s.datasource.GetSubscribers(realChannelId, c.channelType)
+		} else {
+			subscribers, err = c.r.s.store.GetSubscribers(realChannelId, c.channelType)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
 	"go.uber.org/zap"
 )
@@ -23,16 +24,63 @@ func (r *channelReactor) addInitReq(req *initReq) {
 }
 
 func (r *channelReactor) processInitLoop() {
+	reqs := make([]*initReq, 0, 100)
+	done := false
 	for {
 		select {
 		case req := <-r.processInitC:
-			r.processInit(req)
+			reqs = append(reqs, req)
+			// 取出所有等待初始化的频道，批量获取频道信息
+			for !done {
+				select {
+				case req := <-r.processInitC:
+					reqs = append(reqs, req)
+				default:
+					done = true
+				}
+			}
+			r.loadChannelInfos(reqs)
+			for _, req := range reqs {
+				r.processInit(req)
+			}
+			reqs = reqs[:0]
+			done = false
 		case <-r.stopper.ShouldStop():
 			return
 		}
 	}
 }
 
+// loadChannelInfos 开启了数据源的频道信息时，批量从数据源获取初始化频道的信息
+func (r *channelReactor) loadChannelInfos(reqs []*initReq) {
+	if !r.s.opts.HasDatasource() || !r.s.opts.Datasource.ChannelInfoOn {
+		return
+	}
+	channels := make([]wkproto.Channel, 0, len(reqs))
+	chs := make([]*channel, 0, len(reqs))
+	for _, req := range reqs {
+		if req.ch.channelType == wkproto.ChannelTypePerson || r.s.opts.IsCmdChannel(req.ch.channelId) {
+			continue
+		}
+		channels = append(channels, wkproto.Channel{
+			ChannelID:   req.ch.channelId,
+			ChannelType: req.ch.channelType,
+		})
+		chs = append(chs, req.ch)
+	}
+	if len(channels) == 0 {
+		return
+	}
+	channelInfos, err := r.s.datasource.GetChannelInfos(channels)
+	if err != nil {
+		r.Error("loadChannelInfos: get channel infos from datasource failed", zap.Error(err), zap.Int("count", len(channels)))
+		return
+	}
+	for i, ch := range chs {
+		ch.info = channelInfos[i]
+	}
+}
+
 func (r *channelReactor) processInit(req *initReq) {
 	timeoutCtx, cancel := context.WithTimeout(r.s.ctx, time.Second*5)
 	defer cancel()
@@ -334,6 +382,19 @@ func (r *channelReactor) processPermission(req *permissionReq) {
 		})
 		return
 	}
+	// 租户隔离和配额
+	if reasonCode == wkproto.ReasonSuccess {
+		if reasonCode = r.s.tenantManager.allowSend(req.fromUid, req.ch.channelId, req.ch.channelType, req.messages); reasonCode != wkproto.ReasonSuccess {
+			r.Warn("tenant refused the messages", zap.String("fromUid", req.fromUid), zap.String("channelId", req.ch.channelId), zap.Uint8("channelType", req.ch.channelType), zap.String("reasonCode", reasonCode.String()))
+		}
+	}
+	// 频道发送限速（系统账号不限速）
+	if reasonCode == wkproto.ReasonSuccess && !r.s.systemUIDManager.SystemUID(req.fromUid) {
+		if !r.s.sendRateLimiter.allowChannel(req.ch.key, req.ch.info, len(req.messages)) {
+			r.Warn("channel send rate limited", zap.String("channelId", req.ch.channelId), zap.Uint8("channelType", req.ch.channelType), zap.Int("messageCount", len(req.messages)))
+			reasonCode = wkproto.ReasonRateLimit
+		}
+	}
 	reason := ReasonSuccess
 	if reasonCode != wkproto.ReasonSuccess {
 		reason = ReasonError
@@ -386,7 +447,7 @@ func (r *channelReactor) hasPermission(channelId string, channelType uint8, from
 	}
 
 	// 判断是否是黑名单内
-	isDenylist, err := r.s.store.ExistDenylist(channelId, channelType, fromUid)
+	isDenylist, err := r.existDenylist(channelId, channelType, fromUid)
 	if err != nil {
 		r.Error("ExistDenylist error", zap.Error(err))
 		return wkproto.ReasonSystemError, err
@@ -396,7 +457,7 @@ func (r *channelReactor) hasPermission(channelId string, channelType uint8, from
 	}
 
 	// 判断是否是订阅者
-	isSubscriber, err := r.s.store.ExistSubscriber(channelId, channelType, fromUid)
+	isSubscriber, err := r.existSubscriber(channelId, channelType, fromUid)
 	if err != nil {
 		r.Error("ExistSubscriber error", zap.Error(err))
 		return wkproto.ReasonSystemError, err
@@ -407,14 +468,14 @@ func (r *channelReactor) hasPermission(channelId string, channelType uint8, from
 
 	// 判断是否在白名单内
 	if !r.opts.WhitelistOffOfPerson || channelType != wkproto.ChannelTypePerson { // 如果不是个人频道或者个人频道白名单开关打开，则判断是否在白名单内
-		hasAllowlist, err := r.s.store.HasAllowlist(channelId, channelType)
+		hasAllowlist, err := r.hasAllowlist(channelId, channelType)
 		if err != nil {
 			r.Error("HasAllowlist error", zap.Error(err))
 			return wkproto.ReasonSystemError, err
 		}
 
 		if hasAllowlist { // 如果频道有白名单，则判断是否在白名单内
-			isAllowlist, err := r.s.store.ExistAllowlist(channelId, channelType, fromUid)
+			isAllowlist, err := r.existAllowlist(channelId, channelType, fromUid)
 			if err != nil {
 				r.Error("ExistAllowlist error", zap.Error(err))
 				return wkproto.ReasonSystemError, err
@@ -465,7 +526,7 @@ func (r *channelReactor) requestAllowSend(from, to string) (wkproto.ReasonCode,
 
 func (r *channelReactor) allowSend(from, to string) (wkproto.ReasonCode, error) {
 	// 判断是否是黑名单内
-	isDenylist, err := r.s.store.ExistDenylist(to, wkproto.ChannelTypePerson, from)
+	isDenylist, err := r.existDenylist(to, wkproto.ChannelTypePerson, from)
 	if err != nil {
 		r.Error("ExistDenylist error", zap.String("from", from), zap.String("to", to), zap.Error(err))
 		return wkproto.ReasonSystemError, err
@@ -476,7 +537,7 @@ func (r *channelReactor) allowSend(from, to string) (wkproto.ReasonCode, error)
 
 	if !r.opts.WhitelistOffOfPerson {
 		// 判断是否在白名单内
-		isAllowlist, err := r.s.store.ExistAllowlist(to, wkproto.ChannelTypePerson, from)
+		isAllowlist, err := r.existAllowlist(to, wkproto.ChannelTypePerson, from)
 		if err != nil {
 			r.Error("ExistAllowlist error", zap.Error(err))
 			return wkproto.ReasonSystemError, err
@@ -489,6 +550,54 @@ func (r *channelReactor) allowSend(from, to string) (wkproto.ReasonCode, error)
 	return wkproto.ReasonSuccess, nil
 }
 
+// existDenylist 是否在黑名单内，配置了数据源时从数据源获取
+func (r *channelReactor) existDenylist(channelId string, channelType uint8, uid string) (bool, error) {
+	if !r.s.opts.HasDatasource() {
+		return r.s.store.ExistDenylist(channelId, channelType, uid)
+	}
+	blacklist, err := r.s.datasource.GetBlacklist(channelId, channelType)
+	if err != nil {
+		return false, err
+	}
+	return wkutil.ArrayContains(blacklist, uid), nil
+}
+
+// existSubscriber 是否是订阅者，配置了数据源时从数据源获取
+func (r *channelReactor) existSubscriber(channelId string, channelType uint8, uid string) (bool, error) {
+	if !r.s.opts.HasDatasource() {
+		return r.s.store.ExistSubscriber(channelId, channelType, uid)
+	}
+	subscribers, err := r.s.datasource.GetSubscribers(channelId, channelType)
+	if err != nil {
+		return false, err
+	}
+	return wkutil.ArrayContains(subscribers, uid), nil
+}
+
+// hasAllowlist 频道是否设置了白名单，配置了数据源时从数据源获取
+func (r *channelReactor) hasAllowlist(channelId string, channelType uint8) (bool, error) {
+	if !r.s.opts.HasDatasource() {
+		return r.s.store.HasAllowlist(channelId, channelType)
+	}
+	whitelist, err := r.s.datasource.GetWhitelist(channelId, channelType)
+	if err != nil {
+		return false, err
+	}
+	return len(whitelist) > 0, nil
+}
+
+// existAllowlist 是否在白名单内，配置了数据源时从数据源获取
+func (r *channelReactor) existAllowlist(channelId string, channelType uint8, uid string) (bool, error) {
+	if !r.s.opts.HasDatasource() {
+		return r.s.store.ExistAllowlist(channelId, channelType, uid)
+	}
+	whitelist, err := r.s.datasource.GetWhitelist(channelId, channelType)
+	if err != nil {
+		return false, err
+	}
+	return wkutil.ArrayContains(whitelist, uid), nil
+}
+
 type permissionReq struct {
 	fromUid  string
 	ch       *channel
@@ -546,11 +655,14 @@ func (r *channelReactor) processStorageLoop() {
 
 func (r *channelReactor) processStorage(reqs []*storageReq) {
 
+reqLoop:
 	for _, req := range reqs {
 		dbMsgs := make([]wkdb.Message, 0, len(req.messages))
 
+		streamSeqs := make(map[string]uint32) // 本批次内每个流最后分配的序号
+
 		// 将reactorChannelMessage转换为wkdb.Message
-		for _, reactorMsg := range req.messages {
+		for i, reactorMsg := range req.messages {
 
 			if reactorMsg.ReasonCode != wkproto.ReasonSuccess {
 				r.Debug("msg reasonCode is not success, no storage", zap.Uint64("messageId", uint64(reactorMsg.MessageId)), zap.String("channelId", req.ch.channelId), zap.Uint8("channelType", req.ch.channelType))
@@ -558,6 +670,18 @@ func (r *channelReactor) processStorage(reqs []*storageReq) {
 
 			}
 
+			// 流片段由频道领导分配流序号
+			if reactorMsg.isStreamChunk() {
+				streamSeq, err := r.nextStreamSeq(req.ch, reactorMsg.SendPacket.StreamNo, streamSeqs)
+				if err != nil { // 拿不到流的序号时不能从1重新开始，否则会覆盖已有的片段
+					r.Error("get last stream seq error", zap.Error(err), zap.String("channelId", req.ch.channelId), zap.Uint8("channelType", req.ch.channelType), zap.String("streamNo", reactorMsg.SendPacket.StreamNo))
+					r.respStoreResult(req, ReasonError)
+					continue reqLoop
+				}
+				reactorMsg.StreamSeq = streamSeq
+				req.messages[i] = reactorMsg
+			}
+
 			msg := wkdb.Message{
 				RecvPacket: wkproto.RecvPacket{
 					Framer: wkproto.Framer{
@@ -576,6 +700,12 @@ func (r *channelReactor) processStorage(reqs []*storageReq) {
 					Payload:     reactorMsg.SendPacket.Payload,
 				},
 			}
+			if reactorMsg.SendPacket.Setting.IsSet(wkproto.SettingStream) && reactorMsg.SendPacket.StreamNo != "" {
+				msg.Setting = msg.Setting.Set(wkproto.SettingStream)
+				msg.StreamNo = reactorMsg.SendPacket.StreamNo
+				msg.StreamSeq = reactorMsg.StreamSeq
+				msg.StreamFlag = reactorMsg.StreamFlag
+			}
 			dbMsgs = append(dbMsgs, msg)
 		}
 
@@ -607,6 +737,9 @@ func (r *channelReactor) processStorage(reqs []*storageReq) {
 		if err != nil {
 			r.Error("AppendMessages error", zap.Error(err))
 		}
+		if err == nil {
+			r.s.tenantManager.addStorage(req.ch.channelId, sotreMessages)
+		}
 		if len(results) > 0 {
 			for _, result := range results {
 				msgLen := len(req.messages)
@@ -622,6 +755,12 @@ func (r *channelReactor) processStorage(reqs []*storageReq) {
 					}
 				}
 			}
+			// 发送者视为已读到自己发送的消息
+			for _, msg := range req.messages {
+				if msg.MessageSeq > 0 {
+					r.s.receiptManager.readed(msg.FromUid, req.ch.channelId, req.ch.channelType, uint64(msg.MessageSeq))
+				}
+			}
 		}
 		var reason Reason
 		if err != nil {
@@ -636,6 +775,20 @@ func (r *channelReactor) processStorage(reqs []*storageReq) {
 
 }
 
+// nextStreamSeq 获取流的下一个序号，频道的存储是串行的，所以上一批次的片段已经追加到了频道日志里（可能还没提交）
+func (r *channelReactor) nextStreamSeq(ch *channel, streamNo string, streamSeqs map[string]uint32) (uint32, error) {
+	seq, ok := streamSeqs[streamNo]
+	if !ok {
+		var err error
+		if seq, err = r.s.store.LastStreamSeq(ch.channelId, ch.channelType, streamNo); err != nil {
+			return 0, err
+		}
+	}
+	seq++
+	streamSeqs[streamNo] = seq
+	return seq, nil
+}
+
 func (r *channelReactor) respStoreResult(req *storageReq, reason Reason) {
 	sub := r.reactorSub(req.ch.key)
 	lastIndex := req.messages[len(req.messages)-1].Index
@@ -843,6 +996,7 @@ type deliverReq struct {
 	channelKey  string
 	tagKey      string
 	messages    []ReactorChannelMessage
+	toUids      []string // 指定接收者（需是本节点的用户），不为空时只投递给这些用户的在线设备
 }
 
 // =================================== 关闭请求 ===================================
@@ -140,6 +140,7 @@ func (c *channel) stepLeader(a *ChannelAction) error {
 				storedMsg := a.Messages[j]
 				if msg.MessageId == storedMsg.MessageId {
 					msg.MessageSeq = storedMsg.MessageSeq
+					msg.StreamSeq = storedMsg.StreamSeq
 					c.msgQueue.messages[i] = msg
 					break
 				}
@@ -150,6 +150,8 @@ const (
 	UserActionClose // 关闭
 
 	UserActionCheckLeader // 检查领导
+
+	UserActionPresence // 在线状态变更通知，转发给订阅者的领导节点
 )
 
 func (u UserActionType) String() string {
@@ -196,6 +198,8 @@ func (u UserActionType) String() string {
 		return "UserActionClose"
 	case UserActionCheckLeader:
 		return "UserActionCheckLeader"
+	case UserActionPresence:
+		return "UserActionPresence"
 
 	}
 	return "unknow"
@@ -39,6 +39,11 @@ type connInfo struct {
 	aesIV        string
 	protoVersion uint8
 
+	tokenId       string // 设备token（jwt）的唯一id
+	tokenIssuedAt int64  // 设备token（jwt）的签发时间
+
+	appId string // 连接计入的租户，连接关闭时从租户的连接数中减去
+
 	closed atomic.Bool
 
 	isAuth atomic.Bool // 是否已经认证
@@ -58,6 +63,8 @@ type connContext struct {
 
 	lastActivity atomic.Time // 最后活动时间
 
+	mqtt *mqttSession // mqtt会话（mqtt连接才有）
+
 	wklog.Log
 }
 
@@ -172,6 +179,35 @@ func (c *connContext) addSendPacket(packet *wkproto.SendPacket) {
 		return
 	}
 
+	// 临时事件走单独的事件通道
+	if isEventPacket(packet) {
+		if !c.subReactor.r.s.sendRateLimiter.allowUserEvent(c.uid, 1) {
+			c.Warn("addSendPacket failed, user event rate limited", zap.String("uid", c.uid), zap.String("channelId", packet.ChannelID))
+			_ = c.writeDirectlyPacket(&wkproto.SendackPacket{
+				Framer:      packet.Framer,
+				ClientSeq:   packet.ClientSeq,
+				ClientMsgNo: packet.ClientMsgNo,
+				ReasonCode:  wkproto.ReasonRateLimit,
+			})
+			return
+		}
+		c.subReactor.r.s.eventManager.send(c, packet)
+		return
+	}
+
+	// 用户发送限速
+	if !c.subReactor.r.s.sendRateLimiter.allowUser(c.uid, 1) {
+		c.Warn("addSendPacket failed, user send rate limited", zap.String("uid", c.uid), zap.String("channelId", packet.ChannelID))
+		sendack := &wkproto.SendackPacket{
+			Framer:      packet.Framer,
+			ClientSeq:   packet.ClientSeq,
+			ClientMsgNo: packet.ClientMsgNo,
+			ReasonCode:  wkproto.ReasonRateLimit,
+		}
+		_ = c.writeDirectlyPacket(sendack)
+		return
+	}
+
 	// 提案发送至频道
 	_ = c.subReactor.proposeSend(c, packet)
 }
@@ -235,6 +271,9 @@ func (c *connContext) writeDirectly(data []byte, recvFrameCount uint32) error {
 		c.Error("writeDirectly failed, conn is nil", zap.String("conn", c.String()))
 		return errors.New("writeDirectly failed, conn is nil")
 	}
+	if c.mqtt != nil { // mqtt连接需要把悟空协议的包转换为mqtt报文
+		return c.mqtt.write(c, data)
+	}
 	conn := c.conn
 	wsConn, wsok := conn.(wknet.IWSConn) // websocket连接
 	if wsok {
@@ -44,6 +44,18 @@ func (c *ConversationManager) Push(fakeChannelId string, channelType uint8, uids
 		return
 	}
 
+	// 临时事件不更新最近会话
+	hasMessage := false
+	for _, message := range messages {
+		if !message.isEvent() {
+			hasMessage = true
+			break
+		}
+	}
+	if !hasMessage {
+		return
+	}
+
 	// 处理发送者的最近会话
 	for _, message := range messages {
 		if message.FromUid == "" {
@@ -131,27 +143,39 @@ func (c *ConversationManager) saveToFile() {
 	c.Lock()
 	defer c.Unlock()
 
-	conversationDir := path.Join(c.s.opts.DataDir, "conversation")
-	err := os.MkdirAll(conversationDir, 0755)
+	err := c.saveTo(path.Join(c.s.opts.DataDir, "conversation"))
 	if err != nil {
-		c.Error("mkdir conversation dir err", zap.Error(err))
-		return
+		c.Error("save conversation file err", zap.Error(err))
+	}
+}
+
+// saveTo 将内存中的最近会话写入目录dir下的conversation.json，运行中调用时（如备份）会话可能正在被修改，所以复制后再写入
+func (c *ConversationManager) saveTo(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
 	}
 
 	jsonMap := make(map[string][]*channelConversation)
 	for _, w := range c.workers {
+		w.Lock()
 		for _, cc := range w.userConversations {
-			jsonMap[cc.uid] = cc.conversations
+			cc.RLock()
+			conversations := make([]*channelConversation, 0, len(cc.conversations))
+			for _, conversation := range cc.conversations {
+				cp := *conversation
+				conversations = append(conversations, &cp)
+			}
+			cc.RUnlock()
+			jsonMap[cc.uid] = conversations
 		}
+		w.Unlock()
 	}
 	if len(jsonMap) == 0 {
-		return
+		return nil
 	}
 
-	err = os.WriteFile(path.Join(conversationDir, "conversation.json"), []byte(wkutil.ToJSON(jsonMap)), 0644)
-	if err != nil {
-		c.Error("write conversation file err", zap.Error(err))
-	}
+	return os.WriteFile(path.Join(dir, "conversation.json"), []byte(wkutil.ToJSON(jsonMap)), 0644)
 }
 
 func (c *ConversationManager) recoverFromFile() {
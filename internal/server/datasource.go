@@ -1,12 +1,27 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
-	"github.com/WuKongIM/WuKongIM/pkg/network"
+	"github.com/WuKongIM/WuKongIM/pkg/grpcpool"
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhook"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
 // IDatasource 数据源第三方应用可以提供
@@ -21,124 +36,489 @@ type IDatasource interface {
 	GetSystemUIDs() ([]string, error)
 	// 获取频道信息
 	GetChannelInfo(channelID string, channelType uint8) (wkdb.ChannelInfo, error)
+	// 批量获取频道信息，返回结果与channels的顺序一致
+	GetChannelInfos(channels []wkproto.Channel) ([]wkdb.ChannelInfo, error)
+	// 清除频道的缓存
+	InvalidateChannel(channelID string, channelType uint8)
+	// 清除所有缓存
+	InvalidateAll()
+}
+
+const (
+	datasourceCMDGetSubscribers  = "getSubscribers"
+	datasourceCMDGetBlacklist    = "getBlacklist"
+	datasourceCMDGetWhitelist    = "getWhitelist"
+	datasourceCMDGetSystemUIDs   = "getSystemUIDs"
+	datasourceCMDGetChannelInfo  = "getChannelInfo"
+	datasourceCMDGetChannelInfos = "getChannelInfos"
+)
+
+// 频道相关的缓存命令，清除频道缓存时使用
+var datasourceChannelCMDs = []string{datasourceCMDGetSubscribers, datasourceCMDGetBlacklist, datasourceCMDGetWhitelist, datasourceCMDGetChannelInfo}
+
+type datasourceCacheItem struct {
+	value    interface{}
+	expireAt time.Time
 }
 
 // Datasource Datasource
+// 请求结果按命令和频道缓存（LRU+TTL），同一频道的并发请求合并为一次请求
+// 每个缓存key有一个版本号，清除缓存时递增，请求期间版本号变了说明结果可能是旧的，不再写入缓存
 type Datasource struct {
-	s *Server
+	s     *Server
+	cache *lru.Cache[string, datasourceCacheItem] // 为nil表示不缓存
+	group singleflight.Group
+
+	versionLock  sync.Mutex
+	versions     *lru.Cache[string, uint64] // 清除过的缓存key的版本号
+	versionFloor uint64                     // 不在versions里的key的版本号（被淘汰的版本号的最大值）
+	nextVersion  uint64
+
+	httpClient *http.Client
+	grpcPool   *grpcpool.Pool // grpc数据源客户端
+	wklog.Log
 }
 
 // NewDatasource 创建一个数据源
 func NewDatasource(s *Server) IDatasource {
+	var (
+		cache    *lru.Cache[string, datasourceCacheItem]
+		grpcPool *grpcpool.Pool
+		err      error
+	)
+	if s.opts.Datasource.CacheSize > 0 && s.opts.Datasource.CacheTTL > 0 {
+		cache, err = lru.New[string, datasourceCacheItem](s.opts.Datasource.CacheSize)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if s.opts.DatasourceGRPCOn() {
+		grpcPool, err = grpcpool.New(func() (*grpc.ClientConn, error) {
+			return grpc.Dial(s.opts.Datasource.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:    5 * time.Minute, // send pings every 5 minute if there is no activity
+				Timeout: 2 * time.Second, // wait 1 second for ping ack before considering the connection dead
+			}))
+		}, 2, 20, time.Minute*5) // 初始化2个连接 最多20个连接
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	return &Datasource{
-		s: s,
+	d := &Datasource{
+		s:        s,
+		cache:    cache,
+		grpcPool: grpcPool,
+		httpClient: &http.Client{
+			Timeout: s.opts.Datasource.Timeout,
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   5 * time.Second,
+					KeepAlive: 5 * time.Second,
+				}).DialContext,
+				MaxIdleConns:        200,
+				MaxIdleConnsPerHost: 200,
+				IdleConnTimeout:     300 * time.Second,
+			},
+		},
+		Log: wklog.NewWKLog("Datasource"),
+	}
+	if cache != nil {
+		// 版本号被淘汰时提高版本号下限，保证请求期间被清除的key版本号一定会变（回调时已持有versionLock）
+		d.versions, err = lru.NewWithEvict[string, uint64](s.opts.Datasource.CacheSize, func(_ string, version uint64) {
+			if version > d.versionFloor {
+				d.versionFloor = version
+			}
+		})
+		if err != nil {
+			panic(err)
+		}
 	}
+	return d
 }
 
 func (d *Datasource) GetChannelInfo(channelID string, channelType uint8) (wkdb.ChannelInfo, error) {
-	result, err := d.requestCMD("getChannelInfo", map[string]interface{}{
-		"channel_id":   channelID,
-		"channel_type": channelType,
+	value, err := d.getWithCache(datasourceCMDGetChannelInfo, channelID, channelType, func() (interface{}, error) {
+		result, err := d.requestCMD(d.s.opts.AppIdOf(channelID), datasourceCMDGetChannelInfo, map[string]interface{}{
+			"channel_id":   channelID,
+			"channel_type": channelType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var channelInfoResp ChannelInfoResp
+		err = wkutil.ReadJSONByByte([]byte(result), &channelInfoResp)
+		if err != nil {
+			return nil, err
+		}
+		channelInfo := channelInfoResp.ToChannelInfo()
+		channelInfo.ChannelId = channelID
+		channelInfo.ChannelType = channelType
+		return *channelInfo, nil
 	})
 	if err != nil {
 		return wkdb.EmptyChannelInfo, err
 	}
-	var channelInfoResp ChannelInfoResp
-	err = wkutil.ReadJSONByByte([]byte(result), &channelInfoResp)
-	if err != nil {
-		return wkdb.EmptyChannelInfo, err
+	return value.(wkdb.ChannelInfo), nil
+}
+
+// GetChannelInfos 批量获取频道信息，已缓存的直接返回，未缓存的通过getChannelInfos命令一次请求
+func (d *Datasource) GetChannelInfos(channels []wkproto.Channel) ([]wkdb.ChannelInfo, error) {
+	channelInfos := make([]wkdb.ChannelInfo, len(channels))
+	missIndexes := make(map[string][]int)
+	missChannels := make([]wkproto.Channel, 0, len(channels))
+	missVersions := make(map[string]uint64)
+	for i, channel := range channels {
+		if value, ok := d.getCache(datasourceCMDGetChannelInfo, channel.ChannelID, channel.ChannelType); ok {
+			channelInfos[i] = value.(wkdb.ChannelInfo)
+			continue
+		}
+		channelKey := wkutil.ChannelToKey(channel.ChannelID, channel.ChannelType)
+		if _, ok := missIndexes[channelKey]; !ok {
+			missChannels = append(missChannels, channel)
+			missVersions[channelKey] = d.version(d.cacheKey(datasourceCMDGetChannelInfo, channel.ChannelID, channel.ChannelType))
+		}
+		missIndexes[channelKey] = append(missIndexes[channelKey], i)
+	}
+	if len(missChannels) == 0 {
+		return channelInfos, nil
 	}
-	channelInfo := channelInfoResp.ToChannelInfo()
-	channelInfo.ChannelId = channelID
-	channelInfo.ChannelType = channelType
-	return wkdb.EmptyChannelInfo, nil
 
+	// 不同租户的频道请求各自的数据源
+	appChannels := make(map[string][]wkproto.Channel)
+	appIds := make([]string, 0, 1)
+	for _, channel := range missChannels {
+		appId := d.s.opts.AppIdOf(channel.ChannelID)
+		if _, ok := appChannels[appId]; !ok {
+			appIds = append(appIds, appId)
+		}
+		appChannels[appId] = append(appChannels[appId], channel)
+	}
+	respMap := make(map[string]ChannelInfoResp, len(missChannels))
+	for _, appId := range appIds {
+		result, err := d.requestCMD(appId, datasourceCMDGetChannelInfos, map[string]interface{}{
+			"channels": appChannels[appId],
+		})
+		if err != nil {
+			return nil, err
+		}
+		var channelInfoResps []ChannelInfoResp
+		err = wkutil.ReadJSONByByte([]byte(result), &channelInfoResps)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range channelInfoResps {
+			respMap[wkutil.ChannelToKey(resp.ChannelID, resp.ChannelType)] = resp
+		}
+	}
+	for _, channel := range missChannels {
+		channelKey := wkutil.ChannelToKey(channel.ChannelID, channel.ChannelType)
+		// 数据源没有返回的频道使用默认的频道信息
+		channelInfo := respMap[channelKey].ToChannelInfo()
+		channelInfo.ChannelId = channel.ChannelID
+		channelInfo.ChannelType = channel.ChannelType
+		d.setCache(datasourceCMDGetChannelInfo, channel.ChannelID, channel.ChannelType, missVersions[channelKey], *channelInfo)
+		for _, idx := range missIndexes[channelKey] {
+			channelInfos[idx] = *channelInfo
+		}
+	}
+	return channelInfos, nil
 }
 
 // GetSubscribers 获取频道的订阅者
 func (d *Datasource) GetSubscribers(channelID string, channelType uint8) ([]string, error) {
+	return d.getUidsWithCache(datasourceCMDGetSubscribers, channelID, channelType)
+}
 
-	result, err := d.requestCMD("getSubscribers", map[string]interface{}{
-		"channel_id":   channelID,
-		"channel_type": channelType,
+// GetBlacklist 获取频道的黑名单
+func (d *Datasource) GetBlacklist(channelID string, channelType uint8) ([]string, error) {
+	return d.getUidsWithCache(datasourceCMDGetBlacklist, channelID, channelType)
+}
+
+// GetWhitelist 获取频道的白明单
+func (d *Datasource) GetWhitelist(channelID string, channelType uint8) ([]string, error) {
+	return d.getUidsWithCache(datasourceCMDGetWhitelist, channelID, channelType)
+}
+
+// GetSystemUIDs 获取系统账号，开启多租户时合并各租户数据源返回的系统账号
+func (d *Datasource) GetSystemUIDs() ([]string, error) {
+	value, err, _ := d.group.Do(datasourceCMDGetSystemUIDs, func() (interface{}, error) {
+		appIds := []string{""}
+		if d.s.opts.Tenant.On {
+			for _, app := range d.s.opts.Tenant.Apps {
+				if app.DatasourceAddr != "" {
+					appIds = append(appIds, app.AppId)
+				}
+			}
+		}
+		var uids []string
+		for _, appId := range appIds {
+			result, err := d.requestCMD(appId, datasourceCMDGetSystemUIDs, map[string]interface{}{})
+			if err != nil {
+				return nil, err
+			}
+			var appUids []string
+			err = wkutil.ReadJSONByByte([]byte(result), &appUids)
+			if err != nil {
+				return nil, err
+			}
+			uids = append(uids, appUids...)
+		}
+		return uids, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	var subscribers []string
-	err = wkutil.ReadJSONByByte([]byte(result), &subscribers)
-	if err != nil {
-		return nil, err
+	return value.([]string), nil
+}
+
+func (d *Datasource) InvalidateChannel(channelID string, channelType uint8) {
+	if d.cache == nil {
+		return
+	}
+	d.versionLock.Lock()
+	for _, cmd := range datasourceChannelCMDs {
+		key := d.cacheKey(cmd, channelID, channelType)
+		d.nextVersion++
+		d.versions.Add(key, d.nextVersion)
+		d.cache.Remove(key)
 	}
-	return subscribers, nil
+	d.versionLock.Unlock()
 }
 
-// GetBlacklist 获取频道的黑名单
-func (d *Datasource) GetBlacklist(channelID string, channelType uint8) ([]string, error) {
+func (d *Datasource) InvalidateAll() {
+	if d.cache == nil {
+		return
+	}
+	d.versionLock.Lock()
+	d.nextVersion++
+	d.versions.Purge()
+	d.versionFloor = d.nextVersion // Purge会触发淘汰回调，这里在之后设置
+	d.cache.Purge()
+	d.versionLock.Unlock()
+}
 
-	result, err := d.requestCMD("getBlacklist", map[string]interface{}{
-		"channel_id":   channelID,
-		"channel_type": channelType,
+// version 获取缓存key当前的版本号
+func (d *Datasource) version(key string) uint64 {
+	if d.cache == nil {
+		return 0
+	}
+	d.versionLock.Lock()
+	defer d.versionLock.Unlock()
+	if version, ok := d.versions.Get(key); ok {
+		return version
+	}
+	return d.versionFloor
+}
+
+func (d *Datasource) getUidsWithCache(cmd string, channelID string, channelType uint8) ([]string, error) {
+	value, err := d.getWithCache(cmd, channelID, channelType, func() (interface{}, error) {
+		result, err := d.requestCMD(d.s.opts.AppIdOf(channelID), cmd, map[string]interface{}{
+			"channel_id":   channelID,
+			"channel_type": channelType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var uids []string
+		err = wkutil.ReadJSONByByte([]byte(result), &uids)
+		if err != nil {
+			return nil, err
+		}
+		return uids, nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	return value.([]string), nil
+}
 
-	var blacklists []string
-	err = wkutil.ReadJSONByByte([]byte(result), &blacklists)
-	if err != nil {
-		return nil, err
+// getWithCache 先从缓存获取，没有则请求数据源，同一个key的并发请求只会请求一次
+func (d *Datasource) getWithCache(cmd string, channelID string, channelType uint8, load func() (interface{}, error)) (interface{}, error) {
+	if value, ok := d.getCache(cmd, channelID, channelType); ok {
+		return value, nil
 	}
-	return blacklists, nil
+	key := d.cacheKey(cmd, channelID, channelType)
+	value, err, _ := d.group.Do(key, func() (interface{}, error) {
+		version := d.version(key)
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		d.setCache(cmd, channelID, channelType, version, value)
+		return value, nil
+	})
+	return value, err
 }
 
-// GetWhitelist 获取频道的白明单
-func (d *Datasource) GetWhitelist(channelID string, channelType uint8) ([]string, error) {
+func (d *Datasource) getCache(cmd string, channelID string, channelType uint8) (interface{}, bool) {
+	if d.cache == nil {
+		return nil, false
+	}
+	key := d.cacheKey(cmd, channelID, channelType)
+	item, ok := d.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expireAt) {
+		d.cache.Remove(key)
+		return nil, false
+	}
+	return item.value, true
+}
 
-	result, err := d.requestCMD("getWhitelist", map[string]interface{}{
-		"channel_id":   channelID,
-		"channel_type": channelType,
-	})
-	if err != nil {
-		return nil, err
+// setCache 写入缓存，version为请求前的版本号，请求期间缓存被清除过则不写入
+func (d *Datasource) setCache(cmd string, channelID string, channelType uint8, version uint64, value interface{}) {
+	if d.cache == nil {
+		return
 	}
-	var whitelists []string
-	err = wkutil.ReadJSONByByte([]byte(result), &whitelists)
-	if err != nil {
-		return nil, err
+	key := d.cacheKey(cmd, channelID, channelType)
+	d.versionLock.Lock()
+	defer d.versionLock.Unlock()
+	currentVersion, ok := d.versions.Get(key)
+	if !ok {
+		currentVersion = d.versionFloor
 	}
-	return whitelists, nil
+	if currentVersion != version {
+		return
+	}
+	d.cache.Add(key, datasourceCacheItem{
+		value:    value,
+		expireAt: time.Now().Add(d.s.opts.Datasource.CacheTTL),
+	})
 }
 
-// GetSystemUIDs 获取系统账号
-func (d *Datasource) GetSystemUIDs() ([]string, error) {
-	result, err := d.requestCMD("getSystemUIDs", map[string]interface{}{})
-	if err != nil {
-		return nil, err
+func (d *Datasource) cacheKey(cmd string, channelID string, channelType uint8) string {
+	return fmt.Sprintf("%s:%s", cmd, wkutil.ChannelToKey(channelID, channelType))
+}
+
+// requestCMD 请求数据源，租户配置了数据源地址时请求租户的数据源
+func (d *Datasource) requestCMD(appId string, cmd string, param map[string]interface{}) (string, error) {
+	if appId != "" {
+		if app, ok := d.s.opts.TenantApp(appId); ok && app.DatasourceAddr != "" {
+			return d.requestCMDForHttp(app.DatasourceAddr, cmd, param)
+		}
 	}
-	var uids []string
-	err = wkutil.ReadJSONByByte([]byte(result), &uids)
-	if err != nil {
-		return nil, err
+	if d.grpcPool != nil {
+		return d.requestCMDForGRPC(cmd, param)
 	}
-	return uids, nil
+	return d.requestCMDForHttp(d.s.opts.Datasource.Addr, cmd, param)
 }
 
-func (d *Datasource) requestCMD(cmd string, param map[string]interface{}) (string, error) {
+func (d *Datasource) requestCMDForHttp(addr string, cmd string, param map[string]interface{}) (string, error) {
 	dataMap := map[string]interface{}{
 		"cmd": cmd,
 	}
 	if param != nil {
 		dataMap["data"] = param
 	}
-	resp, err := network.Post(d.s.opts.Datasource.Addr, []byte(wkutil.ToJSON(dataMap)), nil)
+	resp, err := d.httpClient.Post(addr, "application/json", bytes.NewBufferString(wkutil.ToJSON(dataMap)))
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("http状态码错误！[%d]", resp.StatusCode)
 	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (d *Datasource) requestCMDForGRPC(cmd string, param map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.s.opts.Datasource.Timeout)
+	defer cancel()
+	clientConn, err := d.grpcPool.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer clientConn.Close()
+
+	var data []byte
+	if param != nil {
+		data = []byte(wkutil.ToJSON(param))
+	}
+	cli := wkhook.NewDatasourceServiceClient(clientConn)
+	resp, err := cli.Request(ctx, &wkhook.DatasourceReq{
+		Cmd:  cmd,
+		Data: data,
+	})
+	if err != nil {
+		d.Warn("grpc数据源请求失败！", zap.String("cmd", cmd), zap.Error(err))
+		return "", err
+	}
+	if resp.Status != http.StatusOK {
+		return "", fmt.Errorf("grpc数据源返回状态错误！[%d]", resp.Status)
+	}
+	return string(resp.Data), nil
+}
+
+// invalidateDatasource 清除本节点的数据源缓存并刷新已加载频道的接收者和频道信息，channelId为空表示清除所有
+func (s *Server) invalidateDatasource(channelId string, channelType uint8) {
+	if !s.opts.HasDatasource() {
+		return
+	}
+	if channelId == "" {
+		s.datasource.InvalidateAll()
+		s.refreshDatasourceChannels()
+		return
+	}
+	s.datasource.InvalidateChannel(channelId, channelType)
+
+	channelKey := wkutil.ChannelToKey(channelId, channelType)
+	ch := s.channelReactor.reactorSub(channelKey).channel(channelKey)
+	if ch == nil {
+		return
+	}
+	if _, err := ch.makeReceiverTag(); err != nil {
+		s.Error("invalidateDatasource: makeReceiverTag failed", zap.Error(err), zap.String("channelId", channelId), zap.Uint8("channelType", channelType))
+	}
+	if s.opts.Datasource.ChannelInfoOn && channelType != wkproto.ChannelTypePerson {
+		channelInfo, err := s.datasource.GetChannelInfo(channelId, channelType)
+		if err != nil {
+			s.Error("invalidateDatasource: get channel info failed", zap.Error(err), zap.String("channelId", channelId), zap.Uint8("channelType", channelType))
+			return
+		}
+		ch.info = channelInfo
+	}
+}
+
+// refreshDatasourceChannels 已加载的频道在下次使用时重新生成接收者tag，频道信息批量重新获取
+func (s *Server) refreshDatasourceChannels() {
+	chs := make([]*channel, 0)
+	for _, sub := range s.channelReactor.subs {
+		sub.channelQueue.iter(func(ch *channel) {
+			chs = append(chs, ch)
+		})
+	}
+	channels := make([]wkproto.Channel, 0, len(chs))
+	infoChs := make([]*channel, 0, len(chs))
+	for _, ch := range chs {
+		if ch.receiverTagKey.Load() != "" {
+			s.tagManager.releaseReceiverTag(ch.receiverTagKey.Load())
+			ch.receiverTagKey.Store("")
+		}
+		if ch.channelType == wkproto.ChannelTypePerson || s.opts.IsCmdChannel(ch.channelId) {
+			continue
+		}
+		channels = append(channels, wkproto.Channel{ChannelID: ch.channelId, ChannelType: ch.channelType})
+		infoChs = append(infoChs, ch)
+	}
+	if !s.opts.Datasource.ChannelInfoOn || len(channels) == 0 {
+		return
+	}
+	channelInfos, err := s.datasource.GetChannelInfos(channels)
+	if err != nil {
+		s.Error("refreshDatasourceChannels: get channel infos failed", zap.Error(err), zap.Int("count", len(channels)))
+		return
+	}
+	for i, ch := range infoChs {
+		ch.info = channelInfos[i]
+	}
+}
 
-	return resp.Body, nil
+// broadcastDatasourceInvalidate 通知其他节点清除数据源缓存
+func (s *Server) broadcastDatasourceInvalidate(req *datasourceInvalidateReq) {
+	s.broadcastRequest("/wk/datasourceInvalidate", []byte(wkutil.ToJSON(req)))
 }
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+type datasourceTestReq struct {
+	Cmd  string `json:"cmd"`
+	Data struct {
+		ChannelID string            `json:"channel_id"`
+		Channels  []wkproto.Channel `json:"channels"`
+	} `json:"data"`
+}
+
+func newDatasourceTestServer(t *testing.T, delay time.Duration) (*httptest.Server, map[string]int, *sync.Mutex) {
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req datasourceTestReq
+		body, _ := io.ReadAll(r.Body)
+		err := wkutil.ReadJSONByByte(body, &req)
+		assert.NoError(t, err)
+
+		mu.Lock()
+		counts[req.Cmd]++
+		mu.Unlock()
+
+		time.Sleep(delay)
+		switch req.Cmd {
+		case datasourceCMDGetSubscribers:
+			_, _ = rw.Write([]byte(wkutil.ToJSON([]string{"u1", "u2"})))
+		case datasourceCMDGetChannelInfos:
+			resps := make([]ChannelInfoResp, 0, len(req.Data.Channels))
+			for _, channel := range req.Data.Channels {
+				if channel.ChannelID == "g3" { // 数据源没有返回的频道
+					continue
+				}
+				resps = append(resps, ChannelInfoResp{ChannelID: channel.ChannelID, ChannelType: channel.ChannelType, Ban: 1})
+			}
+			_, _ = rw.Write([]byte(wkutil.ToJSON(resps)))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv, counts, &mu
+}
+
+func TestDatasourceCacheAndInvalidate(t *testing.T) {
+	srv, counts, mu := newDatasourceTestServer(t, 0)
+	defer srv.Close()
+
+	d := NewDatasource(&Server{opts: NewOptions(WithDatasourceAddr(srv.URL), WithDatasourceCache(100, time.Minute))})
+
+	for i := 0; i < 3; i++ {
+		subscribers, err := d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"u1", "u2"}, subscribers)
+	}
+	mu.Lock()
+	assert.Equal(t, 1, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+
+	d.InvalidateChannel("g1", wkproto.ChannelTypeGroup)
+	_, err := d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, 2, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+
+	d.InvalidateAll()
+	_, err = d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, 3, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+}
+
+func TestDatasourceCoalesce(t *testing.T) {
+	srv, counts, mu := newDatasourceTestServer(t, time.Millisecond*200)
+	defer srv.Close()
+
+	// 不缓存时并发请求同一频道也只请求一次
+	d := NewDatasource(&Server{opts: NewOptions(WithDatasourceAddr(srv.URL), WithDatasourceCache(0, 0))})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			subscribers, err := d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+			assert.NoError(t, err)
+			assert.Len(t, subscribers, 2)
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	assert.Equal(t, 1, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+}
+
+func TestDatasourceGetChannelInfos(t *testing.T) {
+	srv, counts, mu := newDatasourceTestServer(t, 0)
+	defer srv.Close()
+
+	d := NewDatasource(&Server{opts: NewOptions(WithDatasourceAddr(srv.URL), WithDatasourceCache(100, time.Minute))})
+
+	channels := []wkproto.Channel{
+		{ChannelID: "g1", ChannelType: wkproto.ChannelTypeGroup},
+		{ChannelID: "g2", ChannelType: wkproto.ChannelTypeGroup},
+		{ChannelID: "g3", ChannelType: wkproto.ChannelTypeGroup},
+	}
+	channelInfos, err := d.GetChannelInfos(channels)
+	assert.NoError(t, err)
+	assert.Len(t, channelInfos, 3)
+	assert.Equal(t, "g1", channelInfos[0].ChannelId)
+	assert.True(t, channelInfos[0].Ban)
+	assert.Equal(t, "g2", channelInfos[1].ChannelId)
+	assert.True(t, channelInfos[1].Ban)
+	assert.Equal(t, "g3", channelInfos[2].ChannelId)
+	assert.False(t, channelInfos[2].Ban)
+
+	// 已缓存的频道不再请求
+	channelInfo, err := d.GetChannelInfo("g2", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	assert.True(t, channelInfo.Ban)
+	channelInfos, err = d.GetChannelInfos(channels)
+	assert.NoError(t, err)
+	assert.Len(t, channelInfos, 3)
+
+	mu.Lock()
+	assert.Equal(t, 1, counts[datasourceCMDGetChannelInfos])
+	assert.Equal(t, 0, counts[datasourceCMDGetChannelInfo])
+	mu.Unlock()
+}
+
+func TestDatasourceInvalidateDuringLoad(t *testing.T) {
+	srv, counts, mu := newDatasourceTestServer(t, time.Millisecond*200)
+	defer srv.Close()
+
+	d := NewDatasource(&Server{opts: NewOptions(WithDatasourceAddr(srv.URL), WithDatasourceCache(100, time.Minute))})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	// 请求期间清除缓存，请求结果不能写入缓存
+	d.InvalidateChannel("g1", wkproto.ChannelTypeGroup)
+	wg.Wait()
+
+	_, err := d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, 2, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+
+	// 没有清除时正常缓存
+	_, err = d.GetSubscribers("g1", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, 2, counts[datasourceCMDGetSubscribers])
+	mu.Unlock()
+}
@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
@@ -84,8 +86,9 @@ func (d *deliverManager) nextDeliver() *deliverr {
 }
 
 type deliverr struct {
-	reqC chan *deliverReq
-	dm   *deliverManager
+	reqC       chan *deliverReq
+	userQueueC chan *userQueueReq // 待写入用户消息队列的消息，和投递分开处理，避免提案阻塞投递
+	dm         *deliverManager
 	wklog.Log
 	stopper *syncutil.Stopper
 }
@@ -93,15 +96,17 @@ type deliverr struct {
 func newDeliverr(index int, dm *deliverManager) *deliverr {
 
 	return &deliverr{
-		stopper: syncutil.NewStopper(),
-		reqC:    make(chan *deliverReq, 1024),
-		Log:     wklog.NewWKLog(fmt.Sprintf("deliverr[%d]", index)),
-		dm:      dm,
+		stopper:    syncutil.NewStopper(),
+		reqC:       make(chan *deliverReq, 1024),
+		userQueueC: make(chan *userQueueReq, 1024),
+		Log:        wklog.NewWKLog(fmt.Sprintf("deliverr[%d]", index)),
+		dm:         dm,
 	}
 }
 
 func (d *deliverr) start() error {
 	d.stopper.RunWorker(d.loop)
+	d.stopper.RunWorker(d.userQueueLoop)
 	return nil
 }
 
@@ -161,6 +166,11 @@ func (d *deliverr) requestNodeChannelTag(nodeId uint64, req *tagReq) (*tagResp,
 }
 func (d *deliverr) handleDeliverReq(req *deliverReq) {
 
+	if len(req.toUids) > 0 { // 指定了接收者，直接投递
+		d.deliver(req, req.toUids)
+		return
+	}
+
 	// ================== 获取tag信息 ==================
 	var tg = d.dm.s.tagManager.getReceiverTag(req.tagKey)
 	if tg == nil {
@@ -202,6 +212,9 @@ func (d *deliverr) handleDeliverReq(req *deliverReq) {
 			// 更新最近会话
 			d.dm.s.conversationManager.Push(req.channelId, req.channelType, nodeUser.uids, req.messages)
 
+			// 命令消息写入接收者的消息队列（本节点是这些用户的槽领导）
+			d.addSyncOnceMessagesToUserQueue(req, nodeUser.uids)
+
 			// 投递消息
 			d.deliver(req, nodeUser.uids)
 
@@ -212,6 +225,106 @@ func (d *deliverr) handleDeliverReq(req *deliverReq) {
 	}
 }
 
+type userQueueReq struct {
+	channelId   string
+	channelType uint8
+	messages    []wkdb.Message
+	uids        []string
+}
+
+// addSyncOnceMessagesToUserQueue 将需要存储的syncOnce消息交给用户消息队列的协程写入，离线用户上线后通过/message/sync同步
+func (d *deliverr) addSyncOnceMessagesToUserQueue(req *deliverReq, uids []string) {
+	var messages []wkdb.Message
+	for _, message := range req.messages {
+		sendPacket := message.SendPacket
+		if sendPacket == nil || !sendPacket.SyncOnce || sendPacket.NoPersist {
+			continue
+		}
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				Framer: wkproto.Framer{
+					RedDot:   sendPacket.RedDot,
+					SyncOnce: sendPacket.SyncOnce,
+				},
+				Setting:     sendPacket.Setting,
+				MessageID:   message.MessageId,
+				MessageSeq:  message.MessageSeq,
+				ClientMsgNo: sendPacket.ClientMsgNo,
+				FromUID:     message.FromUid,
+				Expire:      sendPacket.Expire,
+				ChannelID:   sendPacket.ChannelID,
+				ChannelType: sendPacket.ChannelType,
+				Topic:       sendPacket.Topic,
+				Timestamp:   int32(time.Now().Unix()),
+				Payload:     sendPacket.Payload,
+			},
+		})
+	}
+	if len(messages) == 0 {
+		return
+	}
+	select {
+	case d.userQueueC <- &userQueueReq{
+		channelId:   req.channelId,
+		channelType: req.channelType,
+		messages:    messages,
+		uids:        uids,
+	}:
+	case <-d.stopper.ShouldStop():
+	}
+}
+
+func (d *deliverr) userQueueLoop() {
+	for {
+		select {
+		case req := <-d.userQueueC:
+			d.appendMessagesToUserQueue(req)
+		case <-d.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+// appendMessagesToUserQueue 将消息写入每个接收者的消息队列
+func (d *deliverr) appendMessagesToUserQueue(req *userQueueReq) {
+	messages := req.messages
+	uids := req.uids
+	// 按用户所在的槽分组，每个槽只提案一次
+	slotUserMessages := make(map[uint32]map[string][]wkdb.Message)
+	for _, uid := range uids {
+		if uid == d.dm.s.opts.SystemUID {
+			continue
+		}
+		userMessages := make([]wkdb.Message, 0, len(messages))
+		for _, msg := range messages {
+			// 个人频道接收者看到的频道是发送者
+			if msg.ChannelType == wkproto.ChannelTypePerson && msg.ChannelID == uid {
+				msg.ChannelID = msg.FromUID
+			}
+			userMessages = append(userMessages, msg)
+		}
+		slotId := d.dm.s.getSlotId(uid)
+		if slotUserMessages[slotId] == nil {
+			slotUserMessages[slotId] = make(map[string][]wkdb.Message)
+		}
+		slotUserMessages[slotId][uid] = userMessages
+	}
+	// 不同的槽并发提案
+	timeoutCtx, cancel := context.WithTimeout(d.dm.s.ctx, d.dm.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for slotId, userMessages := range slotUserMessages {
+		wg.Add(1)
+		go func(slotId uint32, userMessages map[string][]wkdb.Message) {
+			defer wg.Done()
+			if err := d.dm.s.store.AppendMessagesOfUsers(timeoutCtx, slotId, userMessages); err != nil {
+				d.Error("AppendMessagesOfUsers failed", zap.Error(err), zap.Uint32("slotId", slotId), zap.Int("userCount", len(userMessages)), zap.String("channelId", req.channelId), zap.Uint8("channelType", req.channelType))
+			}
+		}(slotId, userMessages)
+	}
+	wg.Wait()
+}
+
 func (d *deliverr) deliver(req *deliverReq, uids []string) {
 	if len(uids) == 0 {
 		return
@@ -255,7 +368,8 @@ func (d *deliverr) deliver(req *deliverReq, uids []string) {
 					MessageSeq:  message.MessageSeq,
 					ClientMsgNo: sendPacket.ClientMsgNo,
 					StreamNo:    sendPacket.StreamNo,
-					StreamFlag:  wkproto.StreamFlagIng,
+					StreamSeq:   message.StreamSeq,
+					StreamFlag:  message.StreamFlag,
 					FromUID:     message.FromUid,
 					Expire:      sendPacket.Expire,
 					ChannelID:   sendPacket.ChannelID,
@@ -304,6 +418,9 @@ func (d *deliverr) deliver(req *deliverReq, uids []string) {
 						uid:            toUid,
 						connId:         conn.connId,
 						messageId:      message.MessageId,
+						channelId:      req.channelId,
+						channelType:    req.channelType,
+						messageSeq:     message.MessageSeq,
 						recvPacketData: recvPacketData,
 					})
 				}
@@ -322,9 +439,13 @@ func (d *deliverr) deliver(req *deliverReq, uids []string) {
 
 	}
 
-	if len(offlineUids) > 0 { // 有离线用户，发送webhook
+	if len(offlineUids) > 0 && len(req.toUids) == 0 { // 有离线用户，发送webhook和离线推送
 		for _, message := range req.messages {
+			if message.isEvent() { // 临时事件只投递在线连接
+				continue
+			}
 			d.dm.s.webhook.notifyOfflineMsg(message, offlineUids)
+			d.dm.s.pushManager.push(message, offlineUids)
 		}
 	}
 }
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDeviceTokenUidNotMatch        = errors.New("device token uid not match")
+	ErrDeviceTokenDeviceFlagNotMatch = errors.New("device token device flag not match")
+	ErrDeviceTokenDenied             = errors.New("device token is denied")
+)
+
+// deviceTokenClaims 设备token（jwt）携带的信息
+type deviceTokenClaims struct {
+	Uid         string `json:"uid,omitempty"`          // 用户uid，为空时取sub
+	DeviceFlag  *uint8 `json:"device_flag,omitempty"`  // 设备标识，不为空时校验与连接的设备标识一致
+	DeviceLevel uint8  `json:"device_level,omitempty"` // 设备等级 0.为从设备 1.为主设备
+	jwt.RegisteredClaims
+}
+
+func (d *deviceTokenClaims) uid() string {
+	if d.Uid != "" {
+		return d.Uid
+	}
+	return d.Subject
+}
+
+func (d *deviceTokenClaims) issuedAt() int64 {
+	if d.IssuedAt == nil {
+		return 0
+	}
+	return d.IssuedAt.UnixMilli()
+}
+
+// deviceTokenVerifier 校验无状态的设备token，签名和过期时间在本地校验，不需要查询存储的token
+type deviceTokenVerifier struct {
+	s      *Server
+	secret []byte                 // HS256密钥
+	keys   map[string]interface{} // RS256/ES256公钥 kid -> 公钥
+	parser *jwt.Parser
+	wklog.Log
+}
+
+func newDeviceTokenVerifier(s *Server) (*deviceTokenVerifier, error) {
+	v := &deviceTokenVerifier{
+		s:    s,
+		keys: make(map[string]interface{}),
+		Log:  wklog.NewWKLog("deviceTokenVerifier"),
+	}
+	methods := make([]string, 0, 3)
+	if strings.TrimSpace(s.opts.DeviceToken.Secret) != "" {
+		v.secret = []byte(s.opts.DeviceToken.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if strings.TrimSpace(s.opts.DeviceToken.JWKSFile) != "" {
+		data, err := os.ReadFile(s.opts.DeviceToken.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		if v.keys, err = parseJWKS(data); err != nil {
+			return nil, err
+		}
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("deviceToken.secret or deviceToken.jwksFile is required when deviceToken.mode is jwt")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(s.opts.DeviceToken.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if s.opts.DeviceToken.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.opts.DeviceToken.Issuer))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// verify 校验连接的设备token，返回token携带的信息
+func (v *deviceTokenVerifier) verify(uid string, deviceFlag wkproto.DeviceFlag, token string) (*deviceTokenClaims, error) {
+	claims, err := v.parse(uid, deviceFlag, token)
+	if err != nil {
+		return nil, err
+	}
+	denies, err := v.s.store.GetTokenDenies(uid)
+	if err != nil {
+		return nil, err
+	}
+	if isDeviceTokenDenied(claims, denies) {
+		return nil, ErrDeviceTokenDenied
+	}
+	return claims, nil
+}
+
+// parse 校验token的签名、有效期以及是否属于此用户和设备
+func (v *deviceTokenVerifier) parse(uid string, deviceFlag wkproto.DeviceFlag, token string) (*deviceTokenClaims, error) {
+	claims := &deviceTokenClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+	if claims.uid() != uid {
+		return nil, ErrDeviceTokenUidNotMatch
+	}
+	if claims.DeviceFlag != nil && *claims.DeviceFlag != deviceFlag.ToUint8() {
+		return nil, ErrDeviceTokenDeviceFlagNotMatch
+	}
+	return claims, nil
+}
+
+func (v *deviceTokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		return v.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(v.keys) == 1 { // 只有一个公钥时可以不指定kid
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt kid: %s", kid)
+	}
+	return key, nil
+}
+
+// isDeviceTokenDenied token是否在拒绝名单里
+func isDeviceTokenDenied(claims *deviceTokenClaims, denies []wkdb.TokenDeny) bool {
+	for _, deny := range denies {
+		if deny.Jti == "" {
+			if claims.issuedAt() < deny.DeniedAt {
+				return true
+			}
+			continue
+		}
+		if deny.Jti == claims.ID {
+			return true
+		}
+	}
+	return false
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS 解析JWKS格式的公钥，支持RSA和P-256的EC公钥
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeJWKInt(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeJWKInt(k.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				return nil, fmt.Errorf("unsupported jwk crv: %s", k.Crv)
+			}
+			x, err := decodeJWKInt(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeJWKInt(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		default:
+			return nil, fmt.Errorf("unsupported jwk kty: %s", k.Kty)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no keys")
+	}
+	return keys, nil
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceTokenParseHS256(t *testing.T) {
+	opts := NewOptions(WithDeviceTokenJWT("testSecret", ""), WithDeviceTokenClockSkew(time.Second*10))
+	v, err := newDeviceTokenVerifier(&Server{opts: opts})
+	assert.NoError(t, err)
+
+	deviceFlag := wkproto.APP.ToUint8()
+	newToken := func(uid string, expire time.Duration, secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &deviceTokenClaims{
+			Uid:         uid,
+			DeviceFlag:  &deviceFlag,
+			DeviceLevel: uint8(wkproto.DeviceLevelMaster),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "t1",
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
+			},
+		}).SignedString([]byte(secret))
+		assert.NoError(t, err)
+		return token
+	}
+
+	claims, err := v.parse("u1", wkproto.APP, newToken("u1", time.Hour, "testSecret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", claims.ID)
+	assert.Equal(t, uint8(wkproto.DeviceLevelMaster), claims.DeviceLevel)
+
+	// 时钟偏差内的过期token仍然有效
+	_, err = v.parse("u1", wkproto.APP, newToken("u1", -time.Second*5, "testSecret"))
+	assert.NoError(t, err)
+
+	_, err = v.parse("u1", wkproto.APP, newToken("u1", -time.Minute, "testSecret"))
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	_, err = v.parse("u1", wkproto.APP, newToken("u1", time.Hour, "otherSecret"))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	_, err = v.parse("u2", wkproto.APP, newToken("u1", time.Hour, "testSecret"))
+	assert.ErrorIs(t, err, ErrDeviceTokenUidNotMatch)
+
+	_, err = v.parse("u1", wkproto.PC, newToken("u1", time.Hour, "testSecret"))
+	assert.ErrorIs(t, err, ErrDeviceTokenDeviceFlagNotMatch)
+}
+
+func TestDeviceTokenParseES256(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": "k1",
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(privKey.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(privKey.Y.Bytes()),
+			},
+		},
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(jwksFile, []byte(wkutil.ToJSON(jwks)), 0644)
+	assert.NoError(t, err)
+
+	v, err := newDeviceTokenVerifier(&Server{opts: NewOptions(WithDeviceTokenJWT("", jwksFile))})
+	assert.NoError(t, err)
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodES256, &deviceTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	jwtToken.Header["kid"] = "k1"
+	token, err := jwtToken.SignedString(privKey)
+	assert.NoError(t, err)
+
+	claims, err := v.parse("u1", wkproto.APP, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", claims.uid())
+
+	// 没有配置HS256密钥时不接受HS256签名的token
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &deviceTokenClaims{
+		Uid: "u1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte("testSecret"))
+	assert.NoError(t, err)
+	_, err = v.parse("u1", wkproto.APP, hsToken)
+	assert.Error(t, err)
+}
+
+func TestDeviceTokenDenied(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := &deviceTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       "t1",
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+	}
+	assert.False(t, isDeviceTokenDenied(claims, nil))
+	assert.True(t, isDeviceTokenDenied(claims, []wkdb.TokenDeny{{Uid: "u1", Jti: "t1"}}))
+	assert.False(t, isDeviceTokenDenied(claims, []wkdb.TokenDeny{{Uid: "u1", Jti: "t2"}}))
+	// 拒绝此前签发的所有token
+	assert.True(t, isDeviceTokenDenied(claims, []wkdb.TokenDeny{{Uid: "u1", DeniedAt: now.UnixMilli() + 1}}))
+	// 拒绝之后签发的token（包括同一毫秒签发的）不受影响
+	assert.False(t, isDeviceTokenDenied(claims, []wkdb.TokenDeny{{Uid: "u1", DeniedAt: now.UnixMilli()}}))
+	assert.False(t, isDeviceTokenDenied(claims, []wkdb.TokenDeny{{Uid: "u1", DeniedAt: now.UnixMilli() - 10000}}))
+}
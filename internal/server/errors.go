@@ -6,6 +6,9 @@ var (
 	ErrConnNotFound     = fmt.Errorf("conn not found")
 	ErrReactorStopped   = fmt.Errorf("reactor stopped")
 	ErrChannelIdIsEmpty = fmt.Errorf("channel id is empty")
+	ErrReceiptOff       = fmt.Errorf("receipt is off")
+	ErrPresenceOff      = fmt.Errorf("presence is off")
+	ErrAPIKeyInvalid    = fmt.Errorf("api key is invalid")
 )
 
 type errCode int32
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/panjf2000/ants/v2"
+	"go.uber.org/zap"
+)
+
+// EventTopic 事件包的topic，客户端发送的SEND包带上此topic表示这是一个临时事件（正在输入、正在录音、自定义信令等），接收者收到的RECV包也带有此topic
+// 事件不存储、不更新最近会话、不进入重试队列，权限校验通过后只投递给频道当前在线的连接
+// 使用协议已有的topic字段标记事件，不占用协议的setting位
+const EventTopic = "__wk_event"
+
+// isEventPacket 是否是临时事件包
+func isEventPacket(packet *wkproto.SendPacket) bool {
+	return packet != nil && packet.Setting.IsSet(wkproto.SettingTopic) && packet.Topic == EventTopic
+}
+
+// eventManager 临时事件管理，事件不走频道的消息队列
+type eventManager struct {
+	s    *Server
+	pool *ants.Pool
+	wklog.Log
+}
+
+func newEventManager(s *Server) *eventManager {
+	pool, err := ants.NewPool(s.opts.Event.PoolSize, ants.WithNonblocking(true), ants.WithPanicHandler(func(err interface{}) {
+		s.Error("event panic", zap.Any("err", err), zap.Stack("stack"))
+	}))
+	if err != nil {
+		panic(err)
+	}
+	return &eventManager{
+		s:    s,
+		pool: pool,
+		Log:  wklog.NewWKLog("eventManager"),
+	}
+}
+
+func (e *eventManager) stop() {
+	e.pool.Release()
+}
+
+// send 发送连接上来的事件包，处理完成后给连接回复sendack
+func (e *eventManager) send(conn *connContext, packet *wkproto.SendPacket) {
+	err := e.pool.Submit(func() {
+		reasonCode, messageId := e.handleConnEvent(conn, packet)
+		sendack := &wkproto.SendackPacket{
+			Framer:      packet.Framer,
+			MessageID:   messageId,
+			ClientSeq:   packet.ClientSeq,
+			ClientMsgNo: packet.ClientMsgNo,
+			ReasonCode:  reasonCode,
+		}
+		if err := conn.writeDirectlyPacket(sendack); err != nil {
+			e.Warn("write event sendack failed", zap.Error(err), zap.String("uid", conn.uid))
+		}
+	})
+	if err != nil { // 协程池满了，事件直接丢弃
+		e.Warn("submit event failed", zap.Error(err), zap.String("uid", conn.uid), zap.String("channelId", packet.ChannelID))
+		_ = conn.writeDirectlyPacket(&wkproto.SendackPacket{
+			Framer:      packet.Framer,
+			ClientSeq:   packet.ClientSeq,
+			ClientMsgNo: packet.ClientMsgNo,
+			ReasonCode:  wkproto.ReasonSystemError,
+		})
+	}
+}
+
+func (e *eventManager) handleConnEvent(conn *connContext, packet *wkproto.SendPacket) (wkproto.ReasonCode, int64) {
+	// 事件不经过频道的解密流程，这里直接解密
+	payload, err := e.s.checkAndDecodePayload(packet, conn)
+	if err != nil {
+		e.Warn("decrypt event payload failed", zap.Error(err), zap.String("uid", conn.uid), zap.String("deviceId", conn.deviceId))
+		return wkproto.ReasonPayloadDecodeError, 0
+	}
+	packet.Payload = payload
+	packet.NoPersist = true
+	packet.RedDot = false
+	packet.SyncOnce = false
+
+	msg := ReactorChannelMessage{
+		FromConnId:   conn.connId,
+		FromUid:      conn.uid,
+		FromDeviceId: conn.deviceId,
+		FromNodeId:   e.s.opts.Cluster.NodeId,
+		MessageId:    e.s.channelReactor.messageIDGen.Generate().Int64(),
+		SendPacket:   packet,
+	}
+
+	fakeChannelId := packet.ChannelID
+	if packet.ChannelType == wkproto.ChannelTypePerson {
+		fakeChannelId = GetFakeChannelIDWith(conn.uid, packet.ChannelID)
+	}
+
+	// 事件由频道领导节点校验权限和投递
+	leaderId := e.s.opts.Cluster.NodeId
+	if e.s.opts.ClusterOn() {
+		timeoutCtx, cancel := context.WithTimeout(e.s.ctx, e.s.opts.Cluster.ReqTimeout)
+		leaderId, err = e.s.cluster.LeaderIdOfChannel(timeoutCtx, fakeChannelId, packet.ChannelType)
+		cancel()
+		if err != nil {
+			e.Warn("get channel leader failed", zap.Error(err), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", packet.ChannelType))
+			return wkproto.ReasonSystemError, 0
+		}
+	}
+	if leaderId == e.s.opts.Cluster.NodeId {
+		return e.handleEvent(fakeChannelId, packet.ChannelType, msg), msg.MessageId
+	}
+	reasonCode, err := e.forwardEvent(leaderId, msg)
+	if err != nil {
+		e.Warn("forward event failed", zap.Error(err), zap.Uint64("leaderId", leaderId), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", packet.ChannelType))
+		return wkproto.ReasonSystemError, 0
+	}
+	return reasonCode, msg.MessageId
+}
+
+func (e *eventManager) forwardEvent(nodeId uint64, msg ReactorChannelMessage) (wkproto.ReasonCode, error) {
+	data, err := msg.Marshal()
+	if err != nil {
+		return wkproto.ReasonSystemError, err
+	}
+	timeoutCtx, cancel := context.WithTimeout(e.s.ctx, e.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := e.s.cluster.RequestWithContext(timeoutCtx, nodeId, "/wk/channelEvent", data)
+	if err != nil {
+		return wkproto.ReasonSystemError, err
+	}
+	if resp.Status == proto.Status_OK {
+		return wkproto.ReasonSuccess, nil
+	}
+	if resp.Status == proto.Status_ERROR {
+		return wkproto.ReasonSystemError, errors.New(string(resp.Body))
+	}
+	return wkproto.ReasonCode(resp.Status), nil
+}
+
+// handleEvent 校验发送者权限后通过接收者tag投递事件（本节点为频道领导节点）
+func (e *eventManager) handleEvent(fakeChannelId string, channelType uint8, msg ReactorChannelMessage) wkproto.ReasonCode {
+	if strings.TrimSpace(fakeChannelId) == "" {
+		return wkproto.ReasonChannelIDError
+	}
+	ch := e.s.channelReactor.loadOrCreateChannel(fakeChannelId, channelType)
+	if ch == nil {
+		return wkproto.ReasonChannelNotExist
+	}
+	reasonCode, err := e.s.channelReactor.hasPermission(fakeChannelId, channelType, msg.FromUid, ch)
+	if err != nil {
+		e.Error("event hasPermission error", zap.Error(err), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", channelType), zap.String("fromUid", msg.FromUid))
+		return wkproto.ReasonSystemError
+	}
+	if reasonCode != wkproto.ReasonSuccess {
+		return reasonCode
+	}
+
+	tagKey := ch.receiverTagKey.Load()
+	tg := e.s.tagManager.getReceiverTag(tagKey)
+	if tg == nil {
+		tg, err = ch.makeReceiverTag()
+		if err != nil {
+			e.Error("event makeReceiverTag failed", zap.Error(err), zap.String("channelId", fakeChannelId), zap.Uint8("channelType", channelType))
+			return wkproto.ReasonSystemError
+		}
+	}
+
+	e.s.deliverManager.deliver(&deliverReq{
+		ch:          ch,
+		channelId:   fakeChannelId,
+		channelType: channelType,
+		channelKey:  wkutil.ChannelToKey(fakeChannelId, channelType),
+		tagKey:      tg.key,
+		messages:    []ReactorChannelMessage{msg},
+	})
+	return wkproto.ReasonSuccess
+}
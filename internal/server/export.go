@@ -0,0 +1,600 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	cluster "github.com/WuKongIM/WuKongIM/pkg/cluster/clusterserver"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// 导出文件每一行的数据类型
+const (
+	exportTypeUser         = "user"
+	exportTypeDevice       = "device"
+	exportTypeChannel      = "channel"
+	exportTypeSubscribers  = "subscribers"
+	exportTypeDenylist     = "denylist"
+	exportTypeAllowlist    = "allowlist"
+	exportTypeConversation = "conversation"
+	exportTypeMessage      = "message"
+	exportTypeEnd          = "end" // 导出结束（没有这一行说明导出不完整）
+)
+
+const (
+	exportMessageBatchSize = 500  // 导出时每次读取的消息数量
+	exportMemberBatchSize  = 1000 // 导出时每行最多包含的成员数量，成员多的频道分多行导出
+	importMessageBatchSize = 100  // 导入时每次提案的消息数量
+)
+
+var (
+	ErrExportInProgress = errors.New("export or import is in progress")
+	ErrImportSeqGap     = errors.New("message seq is not continuous, the message seq can not be preserved")
+	ErrImportIncomplete = errors.New("the import data is incomplete")
+)
+
+// exportRecord 导出文件（jsonl）的一行
+type exportRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// exportMembers 频道的订阅者、黑名单或白名单
+type exportMembers struct {
+	ChannelId   string   `json:"channel_id"`
+	ChannelType uint8    `json:"channel_type"`
+	Uids        []string `json:"uids"`
+}
+
+// exportEnd 导出结束行，Count为之前的行数
+type exportEnd struct {
+	Count int `json:"count"`
+}
+
+// exportMessage 导出的消息，频道id为存储的频道id（个人频道为两个uid组合的频道id）
+type exportMessage struct {
+	Header      MessageHeader      `json:"header"`
+	Setting     uint8              `json:"setting"`
+	MessageId   int64              `json:"message_id"`
+	MessageSeq  uint64             `json:"message_seq"`
+	ClientMsgNo string             `json:"client_msg_no"`
+	StreamNo    string             `json:"stream_no,omitempty"`
+	StreamSeq   uint32             `json:"stream_seq,omitempty"`
+	StreamFlag  wkproto.StreamFlag `json:"stream_flag,omitempty"`
+	FromUID     string             `json:"from_uid"`
+	ChannelID   string             `json:"channel_id"`
+	ChannelType uint8              `json:"channel_type"`
+	Topic       string             `json:"topic,omitempty"`
+	Expire      uint32             `json:"expire,omitempty"`
+	Timestamp   int32              `json:"timestamp"`
+	Payload     []byte             `json:"payload"`
+	Revoke      bool               `json:"revoke,omitempty"`
+	EditVersion uint32             `json:"edit_version,omitempty"`
+	EditorUid   string             `json:"editor_uid,omitempty"`
+	EditedAt    int64              `json:"edited_at,omitempty"`
+	OpType      uint8              `json:"op_type,omitempty"`
+	OpTargetSeq uint64             `json:"op_target_seq,omitempty"`
+}
+
+func newExportMessage(m wkdb.Message) exportMessage {
+	return exportMessage{
+		Header: MessageHeader{
+			NoPersist: wkutil.BoolToInt(m.NoPersist),
+			RedDot:    wkutil.BoolToInt(m.RedDot),
+			SyncOnce:  wkutil.BoolToInt(m.SyncOnce),
+		},
+		Setting:     m.Setting.Uint8(),
+		MessageId:   m.MessageID,
+		MessageSeq:  uint64(m.MessageSeq),
+		ClientMsgNo: m.ClientMsgNo,
+		StreamNo:    m.StreamNo,
+		StreamSeq:   m.StreamSeq,
+		StreamFlag:  m.StreamFlag,
+		FromUID:     m.FromUID,
+		ChannelID:   m.ChannelID,
+		ChannelType: m.ChannelType,
+		Topic:       m.Topic,
+		Expire:      m.Expire,
+		Timestamp:   m.Timestamp,
+		Payload:     m.Payload,
+		Revoke:      m.Revoke,
+		EditVersion: m.EditVersion,
+		EditorUid:   m.EditorUid,
+		EditedAt:    m.EditedAt,
+		OpType:      uint8(m.OpType),
+		OpTargetSeq: m.OpTargetSeq,
+	}
+}
+
+func (e exportMessage) toMessage() wkdb.Message {
+	m := wkdb.Message{
+		RecvPacket: wkproto.RecvPacket{
+			Framer: wkproto.Framer{
+				NoPersist: e.Header.NoPersist == 1,
+				RedDot:    e.Header.RedDot == 1,
+				SyncOnce:  e.Header.SyncOnce == 1,
+			},
+			Setting:     wkproto.Setting(e.Setting),
+			MessageID:   e.MessageId,
+			MessageSeq:  uint32(e.MessageSeq),
+			ClientMsgNo: e.ClientMsgNo,
+			StreamNo:    e.StreamNo,
+			StreamSeq:   e.StreamSeq,
+			StreamFlag:  e.StreamFlag,
+			FromUID:     e.FromUID,
+			ChannelID:   e.ChannelID,
+			ChannelType: e.ChannelType,
+			Topic:       e.Topic,
+			Expire:      e.Expire,
+			Timestamp:   e.Timestamp,
+			Payload:     e.Payload,
+		},
+		Revoke:      e.Revoke,
+		EditVersion: e.EditVersion,
+		EditorUid:   e.EditorUid,
+		EditedAt:    e.EditedAt,
+		OpType:      wkdb.MessageOpType(e.OpType),
+		OpTargetSeq: e.OpTargetSeq,
+	}
+	return m
+}
+
+// importResult 导入的数据数量
+type importResult struct {
+	Users           int `json:"users"`
+	Devices         int `json:"devices"`
+	Channels        int `json:"channels"`
+	Subscribers     int `json:"subscribers"`
+	Denylists       int `json:"denylists"`
+	Allowlists      int `json:"allowlists"`
+	Conversations   int `json:"conversations"`
+	Messages        int `json:"messages"`
+	SkippedMessages int `json:"skipped_messages"` // 已经存在的消息（重复导入）
+}
+
+// ExportAPI 用户、频道、订阅者、黑白名单、最近会话和消息的导出导入api
+// 集群的每个节点只导出自己是领导的数据（槽数据按槽领导，消息按频道领导），整个集群需要导出每个节点；导入的数据通过提案写入，会复制到所有副本
+type ExportAPI struct {
+	wklog.Log
+	s       *Server
+	running atomic.Bool // 是否有导出或导入正在进行
+}
+
+func NewExportAPI(s *Server) *ExportAPI {
+	return &ExportAPI{
+		Log: wklog.NewWKLog("ExportAPI"),
+		s:   s,
+	}
+}
+
+func (e *ExportAPI) Route(r *wkhttp.WKHttp) {
+	r.GET("/manager/export", e.export)      // 导出本节点的数据（jsonl）
+	r.POST("/manager/import", e.importData) // 导入数据（jsonl）
+}
+
+func (e *ExportAPI) export(c *wkhttp.Context) {
+	if !e.running.CompareAndSwap(false, true) {
+		c.ResponseError(ErrExportInProgress)
+		return
+	}
+	defer e.running.Store(false)
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=wukongim-export-%d-%s.jsonl", e.s.opts.Cluster.NodeId, time.Now().Format("20060102150405")))
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriter(c.Writer)
+	count, err := e.exportTo(w)
+	if err != nil {
+		// 已经开始传输，只能中断，导入方通过没有结束行发现
+		e.Error("导出失败！", zap.Error(err))
+		return
+	}
+	if err = w.Flush(); err != nil {
+		e.Error("导出失败！", zap.Error(err))
+		return
+	}
+	e.Info("导出完成", zap.Int("count", count), zap.String("remoteAddr", c.Request.RemoteAddr))
+}
+
+// exportTo 将本节点负责的数据写入w，返回写入的行数
+func (e *ExportAPI) exportTo(w io.Writer) (int, error) {
+	var (
+		db    = e.s.store.DB()
+		enc   = json.NewEncoder(w)
+		count int
+	)
+	write := func(tp string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		count++
+		return enc.Encode(exportRecord{Type: tp, Data: data})
+	}
+
+	err := db.ForEachUser(func(u wkdb.User) error {
+		if !e.ownedSlot(u.Uid) {
+			return nil
+		}
+		return write(exportTypeUser, u)
+	})
+	if err != nil {
+		return count, err
+	}
+	err = db.ForEachDevice(func(d wkdb.Device) error {
+		if !e.ownedSlot(d.Uid) {
+			return nil
+		}
+		return write(exportTypeDevice, d)
+	})
+	if err != nil {
+		return count, err
+	}
+	err = db.ForEachChannel(func(ch wkdb.ChannelInfo) error {
+		if !e.ownedSlot(ch.ChannelId) {
+			return nil
+		}
+		if err := write(exportTypeChannel, ch); err != nil {
+			return err
+		}
+		members := []struct {
+			tp  string
+			get func(channelId string, channelType uint8) ([]string, error)
+		}{
+			{exportTypeSubscribers, db.GetSubscribers},
+			{exportTypeDenylist, db.GetDenylist},
+			{exportTypeAllowlist, db.GetAllowlist},
+		}
+		for _, member := range members {
+			uids, err := member.get(ch.ChannelId, ch.ChannelType)
+			if err != nil {
+				return err
+			}
+			for start := 0; start < len(uids); start += exportMemberBatchSize {
+				end := start + exportMemberBatchSize
+				if end > len(uids) {
+					end = len(uids)
+				}
+				if err = write(member.tp, exportMembers{ChannelId: ch.ChannelId, ChannelType: ch.ChannelType, Uids: uids[start:end]}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	err = db.ForEachConversation(func(conversation wkdb.Conversation) error {
+		if !e.ownedSlot(conversation.Uid) {
+			return nil
+		}
+		return write(exportTypeConversation, conversation)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	// 同一个频道的消息按序号升序连续导出，导入时按这个顺序提案才能保留消息序号
+	// 导出原始的日志（包含已过期和已清理内容的消息），否则序号不连续导入会失败
+	err = db.ForEachMessageChannel(func(channelId string, channelType uint8) error {
+		if !e.ownedChannel(channelId, channelType) {
+			return nil
+		}
+		lastSeq, _, err := db.GetChannelLastMessageSeq(channelId, channelType)
+		if err != nil {
+			return err
+		}
+		for start := uint64(1); start <= lastSeq; start += exportMessageBatchSize {
+			end := min(start+exportMessageBatchSize, lastSeq+1)
+			messages, err := db.LoadNextRangeMsgsForSize(channelId, channelType, start, end, 0)
+			if err != nil {
+				return err
+			}
+			for _, m := range messages {
+				if err = write(exportTypeMessage, newExportMessage(m)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, write(exportTypeEnd, exportEnd{Count: count})
+}
+
+// ownedSlot 本节点是否是v所在槽的领导
+func (e *ExportAPI) ownedSlot(v string) bool {
+	if !e.s.opts.ClusterOn() {
+		return true
+	}
+	leaderId, err := e.s.cluster.SlotLeaderIdOfChannel(v, wkproto.ChannelTypePerson)
+	return err == nil && leaderId == e.s.opts.Cluster.NodeId
+}
+
+// ownedChannel 本节点是否是频道的领导，频道没有分布式配置时按槽领导
+func (e *ExportAPI) ownedChannel(channelId string, channelType uint8) bool {
+	if !e.s.opts.ClusterOn() {
+		return true
+	}
+	leader, err := e.s.cluster.LeaderOfChannelForRead(channelId, channelType)
+	if err != nil {
+		return e.ownedSlot(channelId)
+	}
+	return leader.Id == e.s.opts.Cluster.NodeId
+}
+
+func (e *ExportAPI) importData(c *wkhttp.Context) {
+	if !e.running.CompareAndSwap(false, true) {
+		c.ResponseError(ErrExportInProgress)
+		return
+	}
+	defer e.running.Store(false)
+
+	result, line, err := e.importFrom(c.Request.Body)
+	if err != nil {
+		e.Error("导入失败！", zap.Error(err), zap.Int("line", line))
+		c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"msg":      fmt.Sprintf("line %d: %s", line, err.Error()),
+			"status":   http.StatusBadRequest,
+			"line":     line,
+			"imported": result,
+		})
+		return
+	}
+	e.Info("导入完成", zap.Any("result", result))
+	c.JSON(http.StatusOK, result)
+}
+
+// importFrom 从r读取导出的数据并通过提案写入，返回导入的数量和出错的行号
+// 重复导入是安全的：用户、设备、频道和最近会话会被更新，已存在的成员和消息会被跳过
+func (e *ExportAPI) importFrom(r io.Reader) (importResult, int, error) {
+	var (
+		result  importResult
+		reader  = bufio.NewReaderSize(r, 64*1024)
+		line    int
+		ended   bool           // 是否读到了结束行
+		pending []wkdb.Message // 同一个频道等待提案的消息
+		lastSeq uint64         // pending所在频道的最后一条消息序号
+	)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		msgs := pending
+		pending = nil
+		if err := e.appendMessages(msgs); err != nil {
+			return err
+		}
+		result.Messages += len(msgs)
+		return nil
+	}
+
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			var record exportRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return result, line, err
+			}
+			if record.Type != exportTypeMessage {
+				if err := flush(); err != nil {
+					return result, line, err
+				}
+			}
+			var err error
+			switch record.Type {
+			case exportTypeUser:
+				err = e.importUser(record.Data)
+				result.Users++
+			case exportTypeDevice:
+				err = e.importDevice(record.Data)
+				result.Devices++
+			case exportTypeChannel:
+				var ch wkdb.ChannelInfo
+				if err = json.Unmarshal(record.Data, &ch); err == nil {
+					err = e.s.store.AddOrUpdateChannel(ch)
+				}
+				result.Channels++
+			case exportTypeSubscribers:
+				var n int
+				n, err = e.importMembers(record.Data, e.s.store.ExistSubscriber, e.s.store.AddSubscribers)
+				result.Subscribers += n
+			case exportTypeDenylist:
+				var n int
+				n, err = e.importMembers(record.Data, e.s.store.ExistDenylist, e.s.store.AddDenylist)
+				result.Denylists += n
+			case exportTypeAllowlist:
+				var n int
+				n, err = e.importMembers(record.Data, e.s.store.ExistAllowlist, e.s.store.AddAllowlist)
+				result.Allowlists += n
+			case exportTypeConversation:
+				var conversation wkdb.Conversation
+				if err = json.Unmarshal(record.Data, &conversation); err == nil {
+					conversation.Id = 0
+					err = e.s.store.AddOrUpdateConversations(conversation.Uid, []wkdb.Conversation{conversation})
+				}
+				result.Conversations++
+			case exportTypeMessage:
+				var em exportMessage
+				if err = json.Unmarshal(record.Data, &em); err != nil {
+					break
+				}
+				m := em.toMessage()
+				if len(pending) > 0 && (pending[0].ChannelID != m.ChannelID || pending[0].ChannelType != m.ChannelType || len(pending) >= importMessageBatchSize) {
+					first := pending[0]
+					if err = flush(); err != nil {
+						break
+					}
+					if first.ChannelID != m.ChannelID || first.ChannelType != m.ChannelType {
+						lastSeq = 0
+					}
+				}
+				if len(pending) == 0 && lastSeq == 0 {
+					if lastSeq, err = e.channelLastMsgSeq(m.ChannelID, m.ChannelType); err != nil {
+						break
+					}
+				}
+				seq := uint64(m.MessageSeq)
+				if seq <= lastSeq {
+					result.SkippedMessages++
+					break
+				}
+				if seq != lastSeq+1 {
+					err = fmt.Errorf("%w, channel: %s last seq: %d message seq: %d", ErrImportSeqGap, m.ChannelID, lastSeq, seq)
+					break
+				}
+				pending = append(pending, m)
+				lastSeq = seq
+			case exportTypeEnd:
+				var end exportEnd
+				if err = json.Unmarshal(record.Data, &end); err == nil && end.Count != line-1 {
+					err = fmt.Errorf("%w, exported %d lines but read %d", ErrImportIncomplete, end.Count, line-1)
+				}
+				ended = true
+			default:
+				err = fmt.Errorf("unknown type %s", record.Type)
+			}
+			if err != nil {
+				return result, line, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return result, line, readErr
+		}
+	}
+	if err := flush(); err != nil {
+		return result, line, err
+	}
+	if !ended {
+		return result, line, fmt.Errorf("%w, no end line after %d lines, imported: %s", ErrImportIncomplete, line, wkutil.ToJSON(result))
+	}
+	return result, line, nil
+}
+
+func (e *ExportAPI) importUser(data []byte) error {
+	var u wkdb.User
+	if err := json.Unmarshal(data, &u); err != nil {
+		return err
+	}
+	// 主键和设备数量以本集群为准，连接相关的数量是运行时状态
+	u.Id, u.DeviceCount, u.ConnCount, u.OnlineDeviceCount = 0, 0, 0, 0
+	existUser, err := e.s.store.GetUser(u.Uid)
+	if err != nil && err != wkdb.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		u.Id, u.DeviceCount = existUser.Id, existUser.DeviceCount
+	}
+	return e.s.store.AddOrUpdateUser(u)
+}
+
+func (e *ExportAPI) importDevice(data []byte) error {
+	var d wkdb.Device
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	d.Id, d.ConnCount = 0, 0
+	existDevice, err := e.s.store.GetDevice(d.Uid, d.DeviceFlag)
+	if err != nil && err != wkdb.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		d.Id = existDevice.Id
+	}
+	return e.s.store.AddOrUpdateDevice(d)
+}
+
+// importMembers 导入频道的成员（订阅者、黑名单或白名单），跳过已经存在的成员，返回导入的数量
+func (e *ExportAPI) importMembers(data []byte, exist func(channelId string, channelType uint8, uid string) (bool, error), add func(channelId string, channelType uint8, uids []string) error) (int, error) {
+	var members exportMembers
+	if err := json.Unmarshal(data, &members); err != nil {
+		return 0, err
+	}
+	uids := make([]string, 0, len(members.Uids))
+	for _, uid := range members.Uids {
+		ok, err := exist(members.ChannelId, members.ChannelType, uid)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return 0, nil
+	}
+	return len(uids), add(members.ChannelId, members.ChannelType, uids)
+}
+
+// appendMessages 提案同一个频道的连续消息，校验提案后的消息序号与导出的一致
+func (e *ExportAPI) appendMessages(messages []wkdb.Message) error {
+	channelId, channelType := messages[0].ChannelID, messages[0].ChannelType
+	results, err := e.s.store.AppendMessages(e.s.ctx, channelId, channelType, messages)
+	if err != nil {
+		return err
+	}
+	for i, result := range results {
+		if i < len(messages) && result.LogIndex() != uint64(messages[i].MessageSeq) {
+			return fmt.Errorf("%w, channel: %s expect seq: %d actual seq: %d", ErrImportSeqGap, channelId, messages[i].MessageSeq, result.LogIndex())
+		}
+	}
+	e.s.tenantManager.addStorage(channelId, messages)
+	return nil
+}
+
+// channelLastMsgSeq 获取频道最后一条消息的序号，本节点不是频道领导时向领导节点获取
+func (e *ExportAPI) channelLastMsgSeq(channelId string, channelType uint8) (uint64, error) {
+	if !e.s.opts.ClusterOn() {
+		return e.s.store.GetLastMsgSeq(channelId, channelType)
+	}
+	leader, err := e.s.cluster.LeaderOfChannelForRead(channelId, channelType)
+	if err != nil {
+		if errors.Is(err, cluster.ErrChannelClusterConfigNotFound) { // 频道还没有消息
+			return 0, nil
+		}
+		return 0, err
+	}
+	if leader.Id == e.s.opts.Cluster.NodeId {
+		return e.s.store.GetLastMsgSeq(channelId, channelType)
+	}
+	req := &channelLastMsgSeqReq{ChannelId: channelId, ChannelType: channelType}
+	data, err := req.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	timeoutCtx, cancel := context.WithTimeout(e.s.ctx, e.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := e.s.cluster.RequestWithContext(timeoutCtx, leader.Id, "/wk/channelLastMsgSeq", data)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Status != proto.Status_OK {
+		return 0, fmt.Errorf("get channel last msg seq failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	if len(resp.Body) < 8 {
+		return 0, fmt.Errorf("invalid channel last msg seq response")
+	}
+	return binary.BigEndian.Uint64(resp.Body), nil
+}
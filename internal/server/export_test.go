@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	s := NewTestServer(t, WithDemoOn(false))
+	err := s.Start()
+	assert.NoError(t, err)
+	defer func() {
+		_ = s.Stop()
+	}()
+	s.clusterServer.MustWaitAllSlotsReady()
+	time.Sleep(time.Millisecond * 200) // 等待槽领导可以提案
+
+	assert.NoError(t, s.store.AddOrUpdateUser(wkdb.User{Uid: "u1"}))
+	assert.NoError(t, s.store.AddOrUpdateDevice(wkdb.Device{Uid: "u1", DeviceFlag: 1, Token: "token1"}))
+	assert.NoError(t, s.store.AddOrUpdateChannel(wkdb.ChannelInfo{ChannelId: "g1", ChannelType: wkproto.ChannelTypeGroup, Large: true}))
+	assert.NoError(t, s.store.AddSubscribers("g1", wkproto.ChannelTypeGroup, []string{"u1", "u2"}))
+	assert.NoError(t, s.store.AddDenylist("g1", wkproto.ChannelTypeGroup, []string{"u3"}))
+	assert.NoError(t, s.store.AddOrUpdateConversations("u1", []wkdb.Conversation{{Uid: "u1", ChannelId: "g1", ChannelType: wkproto.ChannelTypeGroup, ReadedToMsgSeq: 2}}))
+	messages := make([]wkdb.Message, 0, 3)
+	for i := 0; i < 3; i++ {
+		messages = append(messages, wkdb.Message{RecvPacket: wkproto.RecvPacket{MessageID: int64(i + 1), ChannelID: "g1", ChannelType: wkproto.ChannelTypeGroup, FromUID: "u1", Timestamp: int32(time.Now().Unix()), Payload: []byte("hello")}})
+	}
+	// 第一条消息已过期，依然需要导出，否则导入时序号不连续
+	messages[0].Timestamp = int32(time.Now().Add(-time.Minute).Unix())
+	messages[0].Expire = 10
+	_, err = s.store.AppendMessages(context.Background(), "g1", wkproto.ChannelTypeGroup, messages)
+	assert.NoError(t, err)
+
+	// 槽数据是异步应用的，等待全部写入
+	buf := bytes.NewBuffer(nil)
+	assert.Eventually(t, func() bool {
+		buf.Reset()
+		count, err := NewExportAPI(s).exportTo(buf)
+		return err == nil && count == 10 // 用户、设备、频道、订阅者、黑名单、最近会话、3条消息和结束行
+	}, time.Second*5, time.Millisecond*50)
+	data := buf.String()
+
+	// 重复导入不会产生重复数据
+	exportAPI := NewExportAPI(s)
+	result, _, err := exportAPI.importFrom(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, importResult{Users: 1, Devices: 1, Channels: 1, Conversations: 1, SkippedMessages: 3}, result)
+
+	// 没有结束行说明导出不完整，已读取的数据依然导入，但返回错误
+	truncated := data[:strings.LastIndex(strings.TrimSuffix(data, "\n"), "\n")+1]
+	result, line, err := exportAPI.importFrom(strings.NewReader(truncated))
+	assert.ErrorIs(t, err, ErrImportIncomplete)
+	assert.Equal(t, 9, line)
+	assert.Equal(t, importResult{Users: 1, Devices: 1, Channels: 1, Conversations: 1, SkippedMessages: 3}, result)
+
+	// 以新的uid和频道导入，相当于导入到新的集群
+	data = strings.NewReplacer(`"u1"`, `"u11"`, `"g1"`, `"g11"`).Replace(data)
+	result, _, err = exportAPI.importFrom(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, importResult{Users: 1, Devices: 1, Channels: 1, Subscribers: 2, Denylists: 1, Conversations: 1, Messages: 3}, result)
+
+	assert.Eventually(t, func() bool {
+		_, err := s.store.GetConversation("u11", "g11", wkproto.ChannelTypeGroup)
+		return err == nil
+	}, time.Second*5, time.Millisecond*50)
+
+	device, err := s.store.GetDevice("u11", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "token1", device.Token)
+	channelInfo, err := s.store.GetChannel("g11", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	assert.True(t, channelInfo.Large)
+	subscribers, err := s.store.GetSubscribers("g11", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"u11", "u2"}, subscribers)
+	exist, err := s.store.ExistDenylist("g11", wkproto.ChannelTypeGroup, "u3")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	conversation, err := s.store.GetConversation("u11", "g11", wkproto.ChannelTypeGroup)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), conversation.ReadedToMsgSeq)
+
+	// 消息序号保持不变，过期消息依然不可见
+	importedMessages, err := s.store.LoadNextRangeMsgs("g11", wkproto.ChannelTypeGroup, 1, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, importedMessages, 2)
+	for i, m := range importedMessages {
+		assert.Equal(t, uint32(i+2), m.MessageSeq)
+		assert.Equal(t, int64(i+2), m.MessageID)
+		assert.Equal(t, "u11", m.FromUID)
+	}
+
+	// 消息序号不连续时报错
+	gap := `{"type":"message","data":{"message_seq":5,"channel_id":"g11","channel_type":2,"from_uid":"u11"}}` + "\n"
+	_, line, err = exportAPI.importFrom(strings.NewReader(gap))
+	assert.ErrorIs(t, err, ErrImportSeqGap)
+	assert.Equal(t, 1, line)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +28,48 @@ type ReactorChannelMessage struct {
 	IsEncrypt    bool // SendPacket的payload是否加密
 	ReasonCode   wkproto.ReasonCode
 	Index        uint64
+	StreamSeq    uint32             // 流序号（频道领导存储时分配）
+	StreamFlag   wkproto.StreamFlag // 流标记（SendPacket开启了流时有效）
+}
+
+// isStreamChunk 是否是流的片段消息（流开始之后的消息）
+func (r *ReactorChannelMessage) isStreamChunk() bool {
+	if r.SendPacket == nil || !r.SendPacket.Setting.IsSet(wkproto.SettingStream) || r.SendPacket.StreamNo == "" {
+		return false
+	}
+	return r.StreamFlag != wkproto.StreamFlagStart
+}
+
+// isEvent 是否是临时事件
+func (r *ReactorChannelMessage) isEvent() bool {
+	return isEventPacket(r.SendPacket)
+}
+
+// 流信息追加在消息列表之后编码，兼容没有流信息的旧数据
+func encodeReactorChannelMessageStreams(enc *wkproto.Encoder, msgs []ReactorChannelMessage) {
+	for _, m := range msgs {
+		enc.WriteUint32(m.StreamSeq)
+		enc.WriteUint8(uint8(m.StreamFlag))
+	}
+}
+
+func decodeReactorChannelMessageStreams(dec *wkproto.Decoder, msgs []ReactorChannelMessage) error {
+	for i := range msgs {
+		if dec.Len() == 0 { // 旧数据没有流信息，流消息默认为进行中
+			msgs[i].StreamFlag = wkproto.StreamFlagIng
+			continue
+		}
+		var err error
+		if msgs[i].StreamSeq, err = dec.Uint32(); err != nil {
+			return err
+		}
+		var streamFlag uint8
+		if streamFlag, err = dec.Uint8(); err != nil {
+			return err
+		}
+		msgs[i].StreamFlag = wkproto.StreamFlag(streamFlag)
+	}
+	return nil
 }
 
 func (r *ReactorChannelMessage) Marshal() ([]byte, error) {
@@ -47,6 +90,7 @@ func (r *ReactorChannelMessage) Marshal() ([]byte, error) {
 		}
 	}
 	enc.WriteBinary(packetData)
+	encodeReactorChannelMessageStreams(enc, []ReactorChannelMessage{*r})
 
 	return enc.Bytes(), nil
 }
@@ -85,6 +129,12 @@ func (r *ReactorChannelMessage) Unmarshal(data []byte) error {
 		r.SendPacket = packet.(*wkproto.SendPacket)
 	}
 
+	msgs := []ReactorChannelMessage{*r}
+	if err = decodeReactorChannelMessageStreams(dec, msgs); err != nil {
+		return err
+	}
+	*r = msgs[0]
+
 	return nil
 }
 
@@ -98,6 +148,8 @@ func (m *ReactorChannelMessage) Size() uint64 {
 	size += 8 // FromNodeId
 	size += 8 // messageId
 	size += 4 // messageSeq
+	size += 4 // streamSeq
+	size += 1 // streamFlag
 	if m.SendPacket != nil {
 		size += uint64(m.SendPacket.RemainingLength) + 2
 	} else {
@@ -135,6 +187,7 @@ func (r ChannelFowardReq) Marshal() ([]byte, error) {
 		}
 		enc.WriteBinary(packetData)
 	}
+	encodeReactorChannelMessageStreams(enc, r.Messages)
 	return enc.Bytes(), nil
 }
 
@@ -182,7 +235,7 @@ func (r *ChannelFowardReq) Unmarshal(data []byte) error {
 		m.SendPacket = packet.(*wkproto.SendPacket)
 		r.Messages = append(r.Messages, m)
 	}
-	return nil
+	return decodeReactorChannelMessageStreams(dec, r.Messages)
 
 }
 
@@ -212,6 +265,7 @@ func (rs ReactorChannelMessageSet) Marshal() ([]byte, error) {
 		}
 		enc.WriteBinary(packetData)
 	}
+	encodeReactorChannelMessageStreams(enc, rs)
 
 	return enc.Bytes(), nil
 }
@@ -257,7 +311,7 @@ func (rs *ReactorChannelMessageSet) Unmarshal(data []byte) error {
 		r.SendPacket = packet.(*wkproto.SendPacket)
 		*rs = append(*rs, r)
 	}
-	return nil
+	return decodeReactorChannelMessageStreams(dec, *rs)
 }
 
 var EmptyReactorUserMessage = ReactorUserMessage{}
@@ -367,23 +421,29 @@ type ChannelAction struct {
 
 // MessageResp 消息返回
 type MessageResp struct {
-	Header       MessageHeader      `json:"header"`                // 消息头
-	Setting      uint8              `json:"setting"`               // 设置
-	MessageId    int64              `json:"message_id"`            // 服务端的消息ID(全局唯一)
-	MessageIdStr string             `json:"message_idstr"`         // 服务端的消息ID(全局唯一)
-	ClientMsgNo  string             `json:"client_msg_no"`         // 客户端消息唯一编号
-	StreamNo     string             `json:"stream_no,omitempty"`   // 流编号
-	StreamSeq    uint32             `json:"stream_seq,omitempty"`  // 流序号
-	StreamFlag   wkproto.StreamFlag `json:"stream_flag,omitempty"` // 流标记
-	MessageSeq   uint64             `json:"message_seq"`           // 消息序列号 （用户唯一，有序递增）
-	FromUID      string             `json:"from_uid"`              // 发送者UID
-	ChannelID    string             `json:"channel_id"`            // 频道ID
-	ChannelType  uint8              `json:"channel_type"`          // 频道类型
-	Topic        string             `json:"topic,omitempty"`       // 话题ID
-	Expire       uint32             `json:"expire"`                // 消息过期时间
-	Timestamp    int32              `json:"timestamp"`             // 服务器消息时间戳(10位，到秒)
-	Payload      []byte             `json:"payload"`               // 消息内容
-	// Streams      []*StreamItemResp  `json:"streams,omitempty"`     // 消息流内容
+	Header       MessageHeader      `json:"header"`                  // 消息头
+	Setting      uint8              `json:"setting"`                 // 设置
+	MessageId    int64              `json:"message_id"`              // 服务端的消息ID(全局唯一)
+	MessageIdStr string             `json:"message_idstr"`           // 服务端的消息ID(全局唯一)
+	ClientMsgNo  string             `json:"client_msg_no"`           // 客户端消息唯一编号
+	StreamNo     string             `json:"stream_no,omitempty"`     // 流编号
+	StreamSeq    uint32             `json:"stream_seq,omitempty"`    // 流序号
+	StreamFlag   wkproto.StreamFlag `json:"stream_flag,omitempty"`   // 流标记
+	MessageSeq   uint64             `json:"message_seq"`             // 消息序列号 （用户唯一，有序递增）
+	FromUID      string             `json:"from_uid"`                // 发送者UID
+	ChannelID    string             `json:"channel_id"`              // 频道ID
+	ChannelType  uint8              `json:"channel_type"`            // 频道类型
+	Topic        string             `json:"topic,omitempty"`         // 话题ID
+	Expire       uint32             `json:"expire"`                  // 消息过期时间
+	Timestamp    int32              `json:"timestamp"`               // 服务器消息时间戳(10位，到秒)
+	Payload      []byte             `json:"payload"`                 // 消息内容
+	Revoke       int                `json:"revoke,omitempty"`        // 是否已撤回
+	EditVersion  uint32             `json:"edit_version,omitempty"`  // 编辑版本
+	EditorUid    string             `json:"editor_uid,omitempty"`    // 最后一次撤回或编辑的操作者
+	EditedAt     int64              `json:"edited_at,omitempty"`     // 最后一次撤回或编辑的时间
+	OpType       uint8              `json:"op_type,omitempty"`       // 操作类型 1.撤回 2.编辑（不为0时表示此消息是对op_target_seq消息的操作）
+	OpTargetSeq  uint64             `json:"op_target_seq,omitempty"` // 被操作的消息序号
+	Streams      []*StreamItemResp  `json:"streams,omitempty"`       // 消息流内容（只有流的开始消息有）
 }
 
 func (m *MessageResp) from(messageD wkdb.Message) {
@@ -417,36 +477,30 @@ func (m *MessageResp) from(messageD wkdb.Message) {
 	m.ChannelType = messageD.ChannelType
 	m.Topic = messageD.Topic
 	m.Payload = messageD.Payload
+	m.Revoke = wkutil.BoolToInt(messageD.Revoke)
+	m.EditVersion = messageD.EditVersion
+	m.EditorUid = messageD.EditorUid
+	m.EditedAt = messageD.EditedAt
+	m.OpType = uint8(messageD.OpType)
+	m.OpTargetSeq = messageD.OpTargetSeq
+}
 
-	// if strings.TrimSpace(messageD.StreamNo) != "" && store != nil {
-	// 	streamItems, err := store.GetStreamItems(GetFakeChannelIDWith(messageD.FromUID, messageD.ChannelID), messageD.ChannelType, messageD.StreamNo)
-	// 	if err != nil {
-	// 		wklog.Error("获取streamItems失败！", zap.Error(err))
-	// 	}
-	// 	if len(streamItems) > 0 {
-	// 		streamItemResps := make([]*StreamItemResp, 0, len(streamItems))
-	// 		for _, streamItem := range streamItems {
-	// 			streamItemResps = append(streamItemResps, newStreamItemResp(streamItem))
-	// 		}
-	// 		m.Streams = streamItemResps
-	// 	}
-	// }
-}
-
-// type StreamItemResp struct {
-// 	StreamSeq   uint32 `json:"stream_seq"`    // 流序号
-// 	ClientMsgNo string `json:"client_msg_no"` // 客户端消息唯一编号
-// 	Blob        []byte `json:"blob"`          // 消息内容
-// }
-
-// func newStreamItemResp(m *wkstore.StreamItem) *StreamItemResp {
-
-// 	return &StreamItemResp{
-// 		StreamSeq:   m.StreamSeq,
-// 		ClientMsgNo: m.ClientMsgNo,
-// 		Blob:        m.Blob,
-// 	}
-// }
+type StreamItemResp struct {
+	StreamSeq   uint32 `json:"stream_seq"`    // 流序号
+	ClientMsgNo string `json:"client_msg_no"` // 客户端消息唯一编号
+	MessageSeq  uint64 `json:"message_seq"`   // 片段消息的序列号
+	Blob        []byte `json:"blob"`          // 消息内容
+}
+
+func newStreamItemResp(m wkdb.StreamItem) *StreamItemResp {
+
+	return &StreamItemResp{
+		StreamSeq:   m.StreamSeq,
+		ClientMsgNo: m.ClientMsgNo,
+		MessageSeq:  m.MessageSeq,
+		Blob:        m.Blob,
+	}
+}
 
 type MessageOfflineNotify struct {
 	MessageResp
@@ -464,15 +518,18 @@ type MessageHeader struct {
 }
 
 type ChannelInfoResp struct {
-	Large   int `json:"large"`   // 是否是超大群
-	Ban     int `json:"ban"`     // 是否封禁频道（封禁后此频道所有人都将不能发消息，除了系统账号）
-	Disband int `json:"disband"` // 是否解散频道
+	ChannelID   string `json:"channel_id,omitempty"`   // 频道ID（批量获取时返回）
+	ChannelType uint8  `json:"channel_type,omitempty"` // 频道类型（批量获取时返回）
+	Large       int    `json:"large"`                  // 是否是超大群
+	Ban         int    `json:"ban"`                    // 是否封禁频道（封禁后此频道所有人都将不能发消息，除了系统账号）
+	Disband     int    `json:"disband"`                // 是否解散频道
 }
 
 func (c ChannelInfoResp) ToChannelInfo() *wkdb.ChannelInfo {
 	return &wkdb.ChannelInfo{
-		Large: c.Large == 1,
-		Ban:   c.Ban == 1,
+		Large:   c.Large == 1,
+		Ban:     c.Ban == 1,
+		Disband: c.Disband == 1,
 	}
 }
 
@@ -836,6 +893,12 @@ func (s syncackReq) Check() error {
 	return nil
 }
 
+// datasourceInvalidateReq 清除数据源缓存请求，ChannelID为空表示清除所有
+type datasourceInvalidateReq struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+}
+
 // ChannelInfoReq ChannelInfoReq
 type ChannelInfoReq struct {
 	ChannelID   string `json:"channel_id"`   // 频道ID
@@ -843,16 +906,59 @@ type ChannelInfoReq struct {
 	Large       int    `json:"large"`        // 是否是超大群
 	Ban         int    `json:"ban"`          // 是否封禁频道（封禁后此频道所有人都将不能发消息，除了系统账号）
 	Disband     int    `json:"disband"`      // 是否解散频道
+	// SendRateLimit 频道每秒允许发送的消息数量，0为使用全局配置
+	SendRateLimit int `json:"send_rate_limit"`
+	// SendRateBurst 频道允许突发发送的消息数量，0为与SendRateLimit相同
+	SendRateBurst int `json:"send_rate_burst"`
+	// 以下为副本策略，不传时保持频道现有的设置
+	// ReplicaCount 频道的副本数量，0为使用全局配置
+	ReplicaCount *int `json:"replica_count,omitempty"`
+	// AckMode 频道消息的确认模式（0.使用默认 1.只需领导确认 2.多数副本确认 3.所有副本确认）
+	AckMode *int `json:"ack_mode,omitempty"`
+	// PreferredLeader 优先作为频道领导的节点ID，0为不指定
+	PreferredLeader *uint64 `json:"preferred_leader,omitempty"`
 }
 
-func (c ChannelInfoReq) ToChannelInfo() wkdb.ChannelInfo {
-	return wkdb.ChannelInfo{
-		ChannelId:   c.ChannelID,
-		ChannelType: c.ChannelType,
-		Large:       c.Large == 1,
-		Ban:         c.Ban == 1,
-		Disband:     c.Disband == 1,
+// CheckReplicaPolicy 检查频道的副本策略参数
+func (c ChannelInfoReq) CheckReplicaPolicy() error {
+	if c.ReplicaCount != nil && (*c.ReplicaCount < 0 || *c.ReplicaCount > math.MaxUint16) {
+		return errors.New("副本数量错误！")
+	}
+	if c.AckMode != nil && (*c.AckMode < int(wkdb.ChannelAckModeDefault) || *c.AckMode > int(wkdb.ChannelAckModeAll)) {
+		return errors.New("确认模式错误！")
 	}
+	return nil
+}
+
+// HasReplicaPolicy 是否指定了副本策略
+func (c ChannelInfoReq) HasReplicaPolicy() bool {
+	return c.ReplicaCount != nil || c.AckMode != nil || c.PreferredLeader != nil
+}
+
+// ToChannelInfo 转换为频道信息，没有指定的副本策略使用existing（频道现有的信息）里的
+func (c ChannelInfoReq) ToChannelInfo(existing wkdb.ChannelInfo) wkdb.ChannelInfo {
+	channelInfo := wkdb.ChannelInfo{
+		ChannelId:       c.ChannelID,
+		ChannelType:     c.ChannelType,
+		Large:           c.Large == 1,
+		Ban:             c.Ban == 1,
+		Disband:         c.Disband == 1,
+		SendRateLimit:   c.SendRateLimit,
+		SendRateBurst:   c.SendRateBurst,
+		ReplicaCount:    existing.ReplicaCount,
+		AckMode:         existing.AckMode,
+		PreferredLeader: existing.PreferredLeader,
+	}
+	if c.ReplicaCount != nil {
+		channelInfo.ReplicaCount = *c.ReplicaCount
+	}
+	if c.AckMode != nil {
+		channelInfo.AckMode = wkdb.ChannelAckMode(*c.AckMode)
+	}
+	if c.PreferredLeader != nil {
+		channelInfo.PreferredLeader = *c.PreferredLeader
+	}
+	return channelInfo
 }
 
 // MessageSendReq 消息发送请求
@@ -876,6 +982,113 @@ func (m MessageSendReq) Check() error {
 	return nil
 }
 
+// MessageStreamStartReq 流消息开始请求
+type MessageStreamStartReq struct {
+	Header      MessageHeader `json:"header"`        // 消息头
+	ClientMsgNo string        `json:"client_msg_no"` // 客户端消息编号
+	FromUID     string        `json:"from_uid"`      // 发送者UID
+	ChannelID   string        `json:"channel_id"`    // 频道ID
+	ChannelType uint8         `json:"channel_type"`  // 频道类型
+	Payload     []byte        `json:"payload"`       // 流开始消息的内容
+}
+
+func (m MessageStreamStartReq) Check() error {
+	if strings.TrimSpace(m.ChannelID) == "" {
+		return errors.New("channel_id不能为空！")
+	}
+	if len(m.Payload) == 0 {
+		return errors.New("payload不能为空！")
+	}
+	return nil
+}
+
+// MessageStreamEndReq 流消息结束请求
+type MessageStreamEndReq struct {
+	StreamNo    string `json:"stream_no"`    // 消息流编号
+	FromUID     string `json:"from_uid"`     // 发送者UID
+	ChannelID   string `json:"channel_id"`   // 频道ID
+	ChannelType uint8  `json:"channel_type"` // 频道类型
+	Payload     []byte `json:"payload"`      // 最后一个片段的内容（可为空）
+}
+
+func (m MessageStreamEndReq) Check() error {
+	if strings.TrimSpace(m.StreamNo) == "" {
+		return errors.New("stream_no不能为空！")
+	}
+	if strings.TrimSpace(m.ChannelID) == "" {
+		return errors.New("channel_id不能为空！")
+	}
+	return nil
+}
+
+// messageRevokeReq 撤回消息请求
+type messageRevokeReq struct {
+	LoginUID    string `json:"login_uid"`    // 操作者uid（个人频道时用于定位频道）
+	UID         string `json:"uid"`          // 个人频道时channel_id对应的会话所属的用户，为空时为login_uid（系统账号操作个人频道消息时必填）
+	ChannelID   string `json:"channel_id"`   // 频道ID
+	ChannelType uint8  `json:"channel_type"` // 频道类型
+	MessageSeq  uint64 `json:"message_seq"`  // 被撤回的消息序号
+}
+
+// ownerUid 个人频道会话所属的用户
+func (r messageRevokeReq) ownerUid() string {
+	if strings.TrimSpace(r.UID) != "" {
+		return r.UID
+	}
+	return r.LoginUID
+}
+
+func (r messageRevokeReq) Check() error {
+	if strings.TrimSpace(r.LoginUID) == "" {
+		return errors.New("login_uid不能为空！")
+	}
+	if strings.TrimSpace(r.ChannelID) == "" {
+		return errors.New("channel_id不能为空！")
+	}
+	if r.ChannelType == 0 {
+		return errors.New("channel_type不能为0！")
+	}
+	if r.MessageSeq == 0 {
+		return errors.New("message_seq不能为0！")
+	}
+	return nil
+}
+
+// messageEditReq 编辑消息请求
+type messageEditReq struct {
+	messageRevokeReq
+	Payload []byte `json:"payload"` // 编辑后的消息内容
+}
+
+func (r messageEditReq) Check() error {
+	if err := r.messageRevokeReq.Check(); err != nil {
+		return err
+	}
+	if len(r.Payload) == 0 {
+		return errors.New("payload不能为空！")
+	}
+	return nil
+}
+
+// messageOpNotify 消息撤回/编辑后推送给在线订阅者的通知内容
+type messageOpNotify struct {
+	Type        int    `json:"type"`              // 通知类型
+	ChannelID   string `json:"channel_id"`        // 频道ID
+	ChannelType uint8  `json:"channel_type"`      // 频道类型
+	MessageId   int64  `json:"message_id"`        // 被操作的消息ID
+	MessageSeq  uint64 `json:"message_seq"`       // 被操作的消息序号
+	Revoke      int    `json:"revoke"`            // 是否已撤回
+	EditVersion uint32 `json:"edit_version"`      // 编辑版本
+	EditorUid   string `json:"editor_uid"`        // 操作者
+	EditedAt    int64  `json:"edited_at"`         // 操作时间
+	Payload     []byte `json:"payload,omitempty"` // 编辑后的内容
+}
+
+const (
+	messageOpNotifyTypeRevoke = 1006 // 消息撤回通知
+	messageOpNotifyTypeEdit   = 1007 // 消息编辑通知
+)
+
 type allowSendReq struct {
 	From string `json:"from"` // 发送者
 	To   string `json:"to"`   // 接收者
@@ -900,3 +1113,331 @@ func (a *allowSendReq) Marshal() ([]byte, error) {
 	enc.WriteString(a.To)
 	return enc.Bytes(), nil
 }
+
+// channelLastMsgSeqReq 获取频道最后一条消息序号的请求
+type channelLastMsgSeqReq struct {
+	ChannelId   string
+	ChannelType uint8
+}
+
+func (c *channelLastMsgSeqReq) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if c.ChannelId, err = dec.String(); err != nil {
+		return err
+	}
+	if c.ChannelType, err = dec.Uint8(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *channelLastMsgSeqReq) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(c.ChannelId)
+	enc.WriteUint8(c.ChannelType)
+	return enc.Bytes(), nil
+}
+
+// receiptNotify 消息已读回执通知，推送给消息发送者的在线设备
+type receiptNotify struct {
+	Type        int      `json:"type"`          // 通知类型
+	ChannelID   string   `json:"channel_id"`    // 频道ID（发送者看到的频道）
+	ChannelType uint8    `json:"channel_type"`  // 频道类型
+	Uid         string   `json:"uid"`           // 已读的成员
+	ReadedToSeq uint64   `json:"readed_to_seq"` // 成员已读到的消息序号
+	MessageIds  []int64  `json:"message_ids"`   // 本次被已读的发送者的消息ID
+	MessageSeqs []uint64 `json:"message_seqs"`  // 本次被已读的发送者的消息序号
+}
+
+const messageReceiptNotifyType = 1008 // 消息已读回执通知
+
+// receiptReadedReq 转发给频道领导节点的成员已读位置
+type receiptReadedReq struct {
+	ChannelId   string
+	ChannelType uint8
+	Cursors     []wkdb.ReadCursor
+}
+
+type receiptReadedReqSet []*receiptReadedReq
+
+func (r receiptReadedReqSet) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(uint32(len(r)))
+	for _, req := range r {
+		enc.WriteString(req.ChannelId)
+		enc.WriteUint8(req.ChannelType)
+		enc.WriteUint32(uint32(len(req.Cursors)))
+		for _, cursor := range req.Cursors {
+			enc.WriteString(cursor.Uid)
+			enc.WriteUint64(cursor.ReadedToSeq)
+		}
+	}
+	return enc.Bytes(), nil
+}
+
+func (r *receiptReadedReqSet) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	count, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		req := &receiptReadedReq{}
+		if req.ChannelId, err = dec.String(); err != nil {
+			return err
+		}
+		if req.ChannelType, err = dec.Uint8(); err != nil {
+			return err
+		}
+		var cursorCount uint32
+		if cursorCount, err = dec.Uint32(); err != nil {
+			return err
+		}
+		for j := uint32(0); j < cursorCount; j++ {
+			var cursor wkdb.ReadCursor
+			if cursor.Uid, err = dec.String(); err != nil {
+				return err
+			}
+			if cursor.ReadedToSeq, err = dec.Uint64(); err != nil {
+				return err
+			}
+			req.Cursors = append(req.Cursors, cursor)
+		}
+		*r = append(*r, req)
+	}
+	return nil
+}
+
+// receiptNotifyReq 转发给消息发送者所在节点的回执通知
+type receiptNotifyReq struct {
+	ToUid   string // 消息发送者
+	Payload []byte // receiptNotify的json数据
+}
+
+type receiptNotifyReqSet []*receiptNotifyReq
+
+func (r receiptNotifyReqSet) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(uint32(len(r)))
+	for _, req := range r {
+		enc.WriteString(req.ToUid)
+		enc.WriteUint32(uint32(len(req.Payload)))
+		enc.WriteBytes(req.Payload)
+	}
+	return enc.Bytes(), nil
+}
+
+func (r *receiptNotifyReqSet) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	count, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		req := &receiptNotifyReq{}
+		if req.ToUid, err = dec.String(); err != nil {
+			return err
+		}
+		var payloadLen uint32
+		if payloadLen, err = dec.Uint32(); err != nil {
+			return err
+		}
+		var payload []byte
+		if payload, err = dec.Bytes(int(payloadLen)); err != nil {
+			return err
+		}
+		// 投递是异步的，这里复制一份，避免data被复用
+		req.Payload = make([]byte, len(payload))
+		copy(req.Payload, payload)
+		*r = append(*r, req)
+	}
+	return nil
+}
+
+// presenceNotify 在线状态变更通知，推送给订阅者的在线设备
+type presenceNotify struct {
+	Type     int    `json:"type"`      // 通知类型
+	Uid      string `json:"uid"`       // 状态变更的用户
+	Online   int    `json:"online"`    // 是否在线 1.在线 0.离线
+	LastSeen int64  `json:"last_seen"` // 最后在线时间（秒）
+}
+
+const presenceNotifyType = 1009 // 在线状态变更通知
+
+// presenceSubscribeReq 发给被订阅用户领导节点的订阅请求
+type presenceSubscribeReq struct {
+	Subscriber  string   // 订阅者
+	Uids        []string // 被订阅的用户
+	Unsubscribe bool     // 是否是取消订阅
+}
+
+func (p *presenceSubscribeReq) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(p.Subscriber)
+	enc.WriteUint8(wkutil.BoolToUint8(p.Unsubscribe))
+	enc.WriteUint32(uint32(len(p.Uids)))
+	for _, uid := range p.Uids {
+		enc.WriteString(uid)
+	}
+	return enc.Bytes(), nil
+}
+
+func (p *presenceSubscribeReq) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if p.Subscriber, err = dec.String(); err != nil {
+		return err
+	}
+	var unsubscribe uint8
+	if unsubscribe, err = dec.Uint8(); err != nil {
+		return err
+	}
+	p.Unsubscribe = wkutil.Uint8ToBool(unsubscribe)
+	count, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		uid, err := dec.String()
+		if err != nil {
+			return err
+		}
+		p.Uids = append(p.Uids, uid)
+	}
+	return nil
+}
+
+// PresenceStatus 用户的在线状态
+type PresenceStatus struct {
+	Uid      string `json:"uid"`       // 用户uid
+	Online   int    `json:"online"`    // 是否在线 1.在线 0.离线
+	LastSeen int64  `json:"last_seen"` // 最后在线时间（秒），隐藏在线状态的用户为0
+}
+
+type PresenceStatusSet []*PresenceStatus
+
+func (p PresenceStatusSet) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(uint32(len(p)))
+	for _, status := range p {
+		enc.WriteString(status.Uid)
+		enc.WriteUint8(uint8(status.Online))
+		enc.WriteInt64(status.LastSeen)
+	}
+	return enc.Bytes(), nil
+}
+
+func (p *PresenceStatusSet) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	count, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		status := &PresenceStatus{}
+		if status.Uid, err = dec.String(); err != nil {
+			return err
+		}
+		var online uint8
+		if online, err = dec.Uint8(); err != nil {
+			return err
+		}
+		status.Online = int(online)
+		if status.LastSeen, err = dec.Int64(); err != nil {
+			return err
+		}
+		*p = append(*p, status)
+	}
+	return nil
+}
+
+// PresenceSubscribeReq 订阅（或取消订阅）用户的在线状态
+type PresenceSubscribeReq struct {
+	Uid         string   `json:"uid"`          // 订阅者uid
+	Uids        []string `json:"uids"`         // 需要订阅的用户
+	ChannelID   string   `json:"channel_id"`   // 订阅频道的所有订阅者（订阅时展开）
+	ChannelType uint8    `json:"channel_type"` // 频道类型
+}
+
+func (p PresenceSubscribeReq) Check() error {
+	if strings.TrimSpace(p.Uid) == "" {
+		return errors.New("uid不能为空！")
+	}
+	if len(p.Uids) == 0 && strings.TrimSpace(p.ChannelID) == "" {
+		return errors.New("uids和channel_id不能同时为空！")
+	}
+	if strings.TrimSpace(p.ChannelID) != "" && p.ChannelType == 0 {
+		return errors.New("channel_type不能为空！")
+	}
+	return nil
+}
+
+// MessageReadedReq 查询消息的已读未读成员
+type MessageReadedReq struct {
+	LoginUid    string `json:"login_uid"` // 个人频道时必填，当前登录用户
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	MessageSeq  uint64 `json:"message_seq"`
+}
+
+func (m MessageReadedReq) Check() error {
+	if strings.TrimSpace(m.ChannelID) == "" {
+		return errors.New("channel_id不能为空！")
+	}
+	if m.ChannelType == 0 {
+		return errors.New("channel_type不能为空！")
+	}
+	if m.ChannelType == wkproto.ChannelTypePerson && strings.TrimSpace(m.LoginUid) == "" {
+		return errors.New("个人频道login_uid不能为空！")
+	}
+	if m.MessageSeq == 0 {
+		return errors.New("message_seq不能为空！")
+	}
+	return nil
+}
+
+// MessageReceiptReq 批量查询消息的已读数
+type MessageReceiptReq struct {
+	LoginUid    string   `json:"login_uid"` // 个人频道时必填，当前登录用户
+	ChannelID   string   `json:"channel_id"`
+	ChannelType uint8    `json:"channel_type"`
+	MessageSeqs []uint64 `json:"message_seqs"`
+}
+
+func (m MessageReceiptReq) Check() error {
+	if strings.TrimSpace(m.ChannelID) == "" {
+		return errors.New("channel_id不能为空！")
+	}
+	if m.ChannelType == 0 {
+		return errors.New("channel_type不能为空！")
+	}
+	if m.ChannelType == wkproto.ChannelTypePerson && strings.TrimSpace(m.LoginUid) == "" {
+		return errors.New("个人频道login_uid不能为空！")
+	}
+	if len(m.MessageSeqs) == 0 {
+		return errors.New("message_seqs不能为空！")
+	}
+	return nil
+}
+
+// MessageReadedResp 消息的已读未读成员
+type MessageReadedResp struct {
+	MessageSeq  uint64   `json:"message_seq"`
+	ReadedCount int      `json:"readed_count"` // 已读人数
+	UnreadCount int      `json:"unread_count"` // 未读人数
+	ReadedUids  []string `json:"readed_uids"`  // 已读成员
+	UnreadUids  []string `json:"unread_uids"`  // 未读成员
+}
+
+// MessageReceiptResp 消息的已读数
+type MessageReceiptResp struct {
+	MessageSeq  uint64 `json:"message_seq"`
+	ReadedCount int    `json:"readed_count"` // 已读人数
+	UnreadCount int    `json:"unread_count"` // 未读人数
+}
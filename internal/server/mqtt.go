@@ -0,0 +1,699 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/mqtt"
+	"github.com/WuKongIM/WuKongIM/pkg/wknet"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// mqtt网关
+// 主题格式为 {channelType}/{channelId} 例如：2/group1
+// 客户端的CONNECT会转换为悟空协议的CONNECT走同样的认证流程（username为uid，没有则使用clientId，password为token）
+// PUBLISH转换为SEND，RECV转换为PUBLISH，QoS1的PUBACK转换为RECVACK，未确认的消息由重试机制以DUP重发
+
+// mqtt连接的最大QoS
+const mqttMaxQoS byte = 1
+
+// qos0的PUBLISH转换为SEND时使用的clientSeq从此值开始，不会与packetId冲突
+const mqttQoS0ClientSeqStart uint64 = 0xFFFF
+
+// 认证完成前最多缓存的报文数量
+const mqttMaxPendingPackets = 128
+
+type mqttInflight struct {
+	messageId  int64
+	messageSeq uint32
+}
+
+// mqttSession mqtt连接的会话状态
+type mqttSession struct {
+	version          byte
+	clientId         string
+	assignedClientId bool   // clientId是否是服务端分配的
+	keepAlive        uint16 // 保持连接的时间（秒）
+
+	qos0ClientSeq atomic.Uint64
+
+	mu            sync.Mutex
+	subscriptions map[string]byte         // 主题过滤器对应的QoS
+	pubSeqs       map[uint64]uint16       // qos1的PUBLISH转换的SEND的clientSeq对应的packetId
+	nextPacketId  uint16                  // 下发PUBLISH的packetId
+	inflight      map[uint16]mqttInflight // 已下发但未确认的PUBLISH
+	inflightMsgs  map[int64]uint16        // 消息id对应的packetId（重试时复用）
+	connacked     bool                    // CONNACK是否已下发且之前缓存的报文已处理完
+	pending       []mqtt.ControlPacket    // 认证完成前收到的报文（客户端可以不等CONNACK就发送报文）
+
+	asyncMu      sync.Mutex
+	asyncTasks   []func() // 写入流程里需要异步执行的任务（提交RECVACK、处理缓存的报文），按提交顺序串行执行
+	asyncRunning bool
+}
+
+func newMQTTSession(connectPacket *mqtt.ConnectPacket) *mqttSession {
+	m := &mqttSession{
+		version:       connectPacket.Version,
+		clientId:      connectPacket.ClientID,
+		keepAlive:     connectPacket.KeepAlive,
+		subscriptions: make(map[string]byte),
+		pubSeqs:       make(map[uint64]uint16),
+		inflight:      make(map[uint16]mqttInflight),
+		inflightMsgs:  make(map[int64]uint16),
+	}
+	if m.clientId == "" {
+		m.clientId = wkutil.GenUUID()
+		m.assignedClientId = true
+	}
+	m.qos0ClientSeq.Store(mqttQoS0ClientSeqStart)
+	return m
+}
+
+func (s *Server) onMQTTData(conn wknet.Conn) error {
+	buff, err := conn.Peek(-1)
+	if err != nil {
+		return err
+	}
+	if len(buff) == 0 {
+		return nil
+	}
+	var connCtx *connContext
+	if connCtxObj := conn.Context(); connCtxObj != nil {
+		connCtx = connCtxObj.(*connContext)
+	}
+
+	offset := 0
+	for len(buff) > offset {
+		version := mqtt.Version311
+		if connCtx != nil {
+			version = connCtx.mqtt.version
+		}
+		packet, size, err := mqtt.DecodePacket(buff[offset:], version)
+		if err != nil {
+			s.Warn("Failed to decode the mqtt packet,conn will be closed", zap.Error(err))
+			if errors.Is(err, mqtt.ErrUnsupportedVersion) && connCtx == nil {
+				s.writeMQTTPacket(conn, &mqtt.ConnackPacket{Version: mqtt.Version311, ReasonCode: mqtt.ReasonCode(mqtt.ConnRefusedBadProtocolVersion)})
+			}
+			conn.Close()
+			return nil
+		}
+		if packet == nil {
+			break
+		}
+		offset += size
+
+		if connCtx == nil {
+			connectPacket, ok := packet.(*mqtt.ConnectPacket)
+			if !ok {
+				s.Warn("请先进行连接！", zap.String("packetType", packet.Type().String()))
+				conn.Close()
+				return nil
+			}
+			connCtx = s.handleMQTTConnect(conn, connectPacket)
+			if connCtx == nil {
+				return nil
+			}
+			continue
+		}
+		if err = s.handleMQTTPacket(connCtx, packet); err != nil {
+			s.Warn("handle mqtt packet failed,conn will be closed", zap.String("uid", connCtx.uid), zap.String("packetType", packet.Type().String()), zap.Error(err))
+			conn.Close()
+			return nil
+		}
+	}
+	_, _ = conn.Discard(offset)
+	return nil
+}
+
+// handleMQTTConnect 将mqtt的CONNECT转换为悟空协议的CONNECT
+func (s *Server) handleMQTTConnect(conn wknet.Conn, connectPacket *mqtt.ConnectPacket) *connContext {
+	uid := connectPacket.Username
+	if strings.TrimSpace(uid) == "" {
+		uid = connectPacket.ClientID
+	}
+	if strings.TrimSpace(uid) == "" || IsSpecialChar(uid) {
+		s.Warn("mqtt uid is illegal,conn will be closed", zap.String("uid", uid), zap.String("clientId", connectPacket.ClientID))
+		code := mqtt.ReasonCode(mqtt.ConnRefusedIDRejected)
+		if connectPacket.Version == mqtt.Version5 {
+			code = mqtt.NotAuthorized
+		}
+		s.writeMQTTPacket(conn, &mqtt.ConnackPacket{Version: connectPacket.Version, ReasonCode: code})
+		conn.Close()
+		return nil
+	}
+
+	session := newMQTTSession(connectPacket)
+
+	// mqtt客户端不参与密钥协商，由服务端代为生成客户端的密钥，消息内容在网关处加解密
+	_, clientPublicKey := wkutil.GetCurve25519KeypPair()
+	wkConnectPacket := &wkproto.ConnectPacket{
+		Version:         wkproto.LatestVersion,
+		ClientKey:       base64.StdEncoding.EncodeToString(clientPublicKey[:]),
+		DeviceID:        session.clientId,
+		DeviceFlag:      s.opts.MQTT.DeviceFlag,
+		ClientTimestamp: time.Now().UnixNano() / 1000 / 1000,
+		UID:             uid,
+		Token:           string(connectPacket.Password),
+	}
+
+	sub := s.userReactor.reactorSub(uid)
+	connInfo := connInfo{
+		connId:       conn.ID(),
+		uid:          uid,
+		deviceId:     wkConnectPacket.DeviceID,
+		deviceFlag:   wkConnectPacket.DeviceFlag,
+		protoVersion: wkConnectPacket.Version,
+	}
+	appId, reasonCode := s.tenantManager.connect(uid)
+	if reasonCode != wkproto.ReasonSuccess {
+		s.Warn("tenant refused the mqtt conn,conn will be closed", zap.String("uid", uid), zap.String("reasonCode", reasonCode.String()))
+		s.writeMQTTPacket(conn, &mqtt.ConnackPacket{Version: connectPacket.Version, ReasonCode: mqttConnackReasonCode(connectPacket.Version, reasonCode)})
+		conn.Close()
+		return nil
+	}
+
+	connCtx := newConnContext(connInfo, conn, sub)
+	connCtx.mqtt = session
+	connCtx.appId = appId
+	conn.SetContext(connCtx)
+
+	s.userReactor.addConnContext(connCtx)
+
+	connCtx.addConnectPacket(wkConnectPacket)
+	return connCtx
+}
+
+func (s *Server) handleMQTTPacket(connCtx *connContext, packet mqtt.ControlPacket) error {
+	session := connCtx.mqtt
+	session.mu.Lock()
+	if !session.connacked { // 认证完成前收到的报文先缓存，下发CONNACK后按顺序处理
+		if len(session.pending) >= mqttMaxPendingPackets {
+			session.mu.Unlock()
+			return mqtt.ErrProtocolError
+		}
+		session.pending = append(session.pending, packet)
+		session.mu.Unlock()
+		return nil
+	}
+	session.mu.Unlock()
+	return s.processMQTTPacket(connCtx, packet)
+}
+
+// handlePendingMQTTPackets 按顺序处理认证完成前缓存的报文，处理期间新收到的报文继续缓存
+func (s *Server) handlePendingMQTTPackets(connCtx *connContext) {
+	session := connCtx.mqtt
+	for {
+		session.mu.Lock()
+		packets := session.pending
+		session.pending = nil
+		if len(packets) == 0 {
+			session.connacked = true
+			session.mu.Unlock()
+			return
+		}
+		session.mu.Unlock()
+		for _, packet := range packets {
+			if err := s.processMQTTPacket(connCtx, packet); err != nil {
+				s.Warn("handle pending mqtt packet failed,conn will be closed", zap.String("uid", connCtx.uid), zap.String("packetType", packet.Type().String()), zap.Error(err))
+				connCtx.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) processMQTTPacket(connCtx *connContext, packet mqtt.ControlPacket) error {
+	session := connCtx.mqtt
+	switch p := packet.(type) {
+	case *mqtt.PublishPacket:
+		return s.handleMQTTPublish(connCtx, p)
+	case *mqtt.PubackPacket:
+		if p.Type() != mqtt.PUBACK {
+			return mqtt.ErrProtocolError
+		}
+		session.mu.Lock()
+		inflight, ok := session.inflight[p.PacketID]
+		if ok {
+			delete(session.inflight, p.PacketID)
+			delete(session.inflightMsgs, inflight.messageId)
+		}
+		session.mu.Unlock()
+		if ok {
+			connCtx.addOtherPacket(&wkproto.RecvackPacket{
+				MessageID:  inflight.messageId,
+				MessageSeq: inflight.messageSeq,
+			})
+		}
+	case *mqtt.SubscribePacket:
+		suback := &mqtt.SubackPacket{
+			Version:  session.version,
+			PacketID: p.PacketID,
+		}
+		session.mu.Lock()
+		for _, subscription := range p.Subscriptions {
+			suback.ReasonCodes = append(suback.ReasonCodes, session.subscribe(subscription))
+		}
+		session.mu.Unlock()
+		s.writeMQTTPacketAndWake(connCtx, suback)
+	case *mqtt.UnsubscribePacket:
+		unsuback := &mqtt.UnsubackPacket{
+			Version:  session.version,
+			PacketID: p.PacketID,
+		}
+		session.mu.Lock()
+		for _, topic := range p.Topics {
+			code := mqtt.Success
+			if _, ok := session.subscriptions[topic]; !ok {
+				code = mqtt.NoSubscriptionExisted
+			}
+			delete(session.subscriptions, topic)
+			unsuback.ReasonCodes = append(unsuback.ReasonCodes, code)
+		}
+		session.mu.Unlock()
+		s.writeMQTTPacketAndWake(connCtx, unsuback)
+	case *mqtt.PingreqPacket:
+		connCtx.addOtherPacket(&wkproto.PingPacket{})
+	case *mqtt.DisconnectPacket:
+		connCtx.close()
+	default:
+		return mqtt.ErrProtocolError
+	}
+	return nil
+}
+
+// handleMQTTPublish 将PUBLISH转换为悟空协议的SEND
+func (s *Server) handleMQTTPublish(connCtx *connContext, publishPacket *mqtt.PublishPacket) error {
+	session := connCtx.mqtt
+	if publishPacket.QoS > mqttMaxQoS {
+		s.writeMQTTDisconnect(connCtx, mqtt.QoSNotSupported)
+		return mqtt.ErrProtocolError
+	}
+	if publishPacket.Properties != nil && publishPacket.Properties.TopicAlias != nil { // 不支持主题别名（CONNACK里TopicAliasMaximum为0）
+		s.writeMQTTDisconnect(connCtx, mqtt.TopicAliasInvalid)
+		return mqtt.ErrProtocolError
+	}
+	channelId, channelType, ok := parseMQTTTopic(publishPacket.Topic)
+	if !ok {
+		if publishPacket.QoS > 0 && session.version == mqtt.Version5 {
+			s.writeMQTTPacketAndWake(connCtx, &mqtt.PubackPacket{
+				Version:    session.version,
+				PacketID:   publishPacket.PacketID,
+				ReasonCode: mqtt.TopicNameInvalid,
+			})
+			return nil
+		}
+		s.writeMQTTDisconnect(connCtx, mqtt.TopicNameInvalid)
+		return mqtt.ErrProtocolError
+	}
+
+	var clientSeq uint64
+	if publishPacket.QoS > 0 {
+		clientSeq = uint64(publishPacket.PacketID)
+		session.mu.Lock()
+		session.pubSeqs[clientSeq] = publishPacket.PacketID
+		session.mu.Unlock()
+	} else {
+		clientSeq = session.qos0ClientSeq.Inc()
+	}
+
+	clientMsgNo := publishPacket.Properties.GetUser("client_msg_no")
+	if clientMsgNo == "" {
+		clientMsgNo = wkutil.GenUUID()
+	}
+	sendPacket := &wkproto.SendPacket{
+		ClientSeq:   clientSeq,
+		ClientMsgNo: clientMsgNo,
+		ChannelID:   channelId,
+		ChannelType: channelType,
+	}
+	if publishPacket.Properties != nil && publishPacket.Properties.MessageExpiry != nil {
+		sendPacket.Expire = *publishPacket.Properties.MessageExpiry
+	}
+
+	// 连接上的SEND都按加密处理，这里代替客户端加密和签名
+	payloadEnc, err := encryptMessagePayload(publishPacket.Payload, connCtx)
+	if err != nil {
+		return err
+	}
+	sendPacket.Payload = payloadEnc
+	msgKey, err := makeMsgKey(sendPacket.VerityString(), connCtx)
+	if err != nil {
+		return err
+	}
+	sendPacket.MsgKey = msgKey
+
+	connCtx.addSendPacket(sendPacket)
+	return nil
+}
+
+// subscribe 添加订阅，返回SUBACK的原因码
+func (m *mqttSession) subscribe(subscription mqtt.Subscription) mqtt.ReasonCode {
+	if !mqtt.ValidTopicFilter(subscription.Topic) {
+		if m.version == mqtt.Version5 {
+			return mqtt.TopicFilterInvalid
+		}
+		return mqtt.ReasonCode(mqtt.SubackFailure)
+	}
+	if strings.HasPrefix(subscription.Topic, "$share/") {
+		if m.version == mqtt.Version5 {
+			return mqtt.SharedSubscriptionsNotSupported
+		}
+		return mqtt.ReasonCode(mqtt.SubackFailure)
+	}
+	qos := subscription.QoS
+	if qos > mqttMaxQoS {
+		qos = mqttMaxQoS
+	}
+	m.subscriptions[subscription.Topic] = qos
+	return mqtt.ReasonCode(qos)
+}
+
+// matchQoS 主题匹配的订阅中最大的QoS，没有匹配的订阅返回false
+func (m *mqttSession) matchQoS(topic string) (byte, bool) {
+	var (
+		qos     byte
+		matched bool
+	)
+	for filter, subQoS := range m.subscriptions {
+		if !mqtt.MatchTopic(filter, topic) {
+			continue
+		}
+		matched = true
+		if subQoS > qos {
+			qos = subQoS
+		}
+	}
+	return qos, matched
+}
+
+// allocPacketId 分配下发PUBLISH的packetId
+func (m *mqttSession) allocPacketId() (uint16, bool) {
+	for i := 0; i < 0xFFFF; i++ {
+		m.nextPacketId++
+		if m.nextPacketId == 0 {
+			m.nextPacketId = 1
+		}
+		if _, ok := m.inflight[m.nextPacketId]; !ok {
+			return m.nextPacketId, true
+		}
+	}
+	return 0, false
+}
+
+// write 将悟空协议的数据转换为mqtt报文写入连接
+func (m *mqttSession) write(c *connContext, data []byte) error {
+	s := c.subReactor.r.s
+	mqttConn, ok := c.conn.(wknet.IMQTTConn)
+	if !ok {
+		return errors.New("conn is not mqtt conn")
+	}
+	var (
+		recvacks  []*wkproto.RecvackPacket
+		closeConn bool
+		connacked bool
+	)
+	offset := 0
+	for len(data) > offset {
+		frame, size, err := s.opts.Proto.DecodeFrame(data[offset:], c.protoVersion)
+		if err != nil {
+			c.Warn("decode frame failed", zap.Error(err))
+			return err
+		}
+		if frame == nil {
+			break
+		}
+		offset += size
+
+		var packet mqtt.ControlPacket
+		switch f := frame.(type) {
+		case *wkproto.ConnackPacket:
+			packet = m.toConnack(c, f)
+			closeConn = f.ReasonCode != wkproto.ReasonSuccess
+			connacked = !closeConn
+		case *wkproto.SendackPacket:
+			m.mu.Lock()
+			packetId, ok := m.pubSeqs[f.ClientSeq]
+			delete(m.pubSeqs, f.ClientSeq)
+			m.mu.Unlock()
+			if ok { // 只有qos1需要回复PUBACK
+				packet = &mqtt.PubackPacket{
+					Version:    m.version,
+					PacketID:   packetId,
+					ReasonCode: mqttReasonCode(f.ReasonCode),
+				}
+			}
+		case *wkproto.RecvPacket:
+			var recvack *wkproto.RecvackPacket
+			packet, recvack = m.toPublish(c, f)
+			if recvack != nil {
+				recvacks = append(recvacks, recvack)
+			}
+		case *wkproto.PongPacket:
+			packet = &mqtt.PingrespPacket{}
+		case *wkproto.DisconnectPacket:
+			if m.version == mqtt.Version5 {
+				packet = &mqtt.DisconnectPacket{
+					Version:    m.version,
+					ReasonCode: mqtt.SessionTakenOver,
+					Properties: &mqtt.Properties{ReasonString: f.Reason},
+				}
+			}
+			closeConn = true
+		}
+		if packet == nil {
+			continue
+		}
+		if err = mqttConn.WriteMQTTPacket(packet); err != nil {
+			c.Warn("Failed to write the mqtt packet", zap.String("packetType", packet.Type().String()), zap.Error(err))
+		}
+	}
+
+	if len(recvacks) > 0 { // 写入是在用户reactor的处理流程里，这里异步提交，避免阻塞
+		m.runAsync(func() {
+			for _, recvack := range recvacks {
+				c.addOtherPacket(recvack)
+			}
+		})
+	}
+	if connacked { // CONNACK已下发，处理认证完成前缓存的报文
+		m.runAsync(func() {
+			s.handlePendingMQTTPackets(c)
+		})
+	}
+	err := c.conn.WakeWrite()
+	if closeConn {
+		s.timingWheel.AfterFunc(time.Second, c.close)
+	}
+	return err
+}
+
+// runAsync 异步执行任务，同一个会话的任务按提交顺序串行执行
+func (m *mqttSession) runAsync(task func()) {
+	m.asyncMu.Lock()
+	m.asyncTasks = append(m.asyncTasks, task)
+	if m.asyncRunning {
+		m.asyncMu.Unlock()
+		return
+	}
+	m.asyncRunning = true
+	m.asyncMu.Unlock()
+
+	go func() {
+		for {
+			m.asyncMu.Lock()
+			if len(m.asyncTasks) == 0 {
+				m.asyncRunning = false
+				m.asyncMu.Unlock()
+				return
+			}
+			task := m.asyncTasks[0]
+			m.asyncTasks[0] = nil
+			m.asyncTasks = m.asyncTasks[1:]
+			m.asyncMu.Unlock()
+			task()
+		}
+	}()
+}
+
+func (m *mqttSession) toConnack(c *connContext, connack *wkproto.ConnackPacket) *mqtt.ConnackPacket {
+	packet := &mqtt.ConnackPacket{
+		Version:    m.version,
+		ReasonCode: mqttConnackReasonCode(m.version, connack.ReasonCode),
+	}
+	if connack.ReasonCode != wkproto.ReasonSuccess {
+		return packet
+	}
+	if m.keepAlive > 0 { // 超过1.5倍的保持连接时间没有收到报文则断开
+		c.conn.SetMaxIdle(time.Duration(m.keepAlive) * time.Second * 3 / 2)
+	}
+	if m.version == mqtt.Version5 {
+		maxQoS := mqttMaxQoS
+		var unavailable byte
+		packet.Properties = &mqtt.Properties{
+			MaximumQoS:         &maxQoS,
+			RetainAvailable:    &unavailable,
+			SharedSubAvailable: &unavailable,
+			SubIDAvailable:     &unavailable,
+		}
+		if m.assignedClientId {
+			packet.Properties.AssignedClientID = m.clientId
+		}
+	}
+	return packet
+}
+
+// toPublish 将RECV转换为PUBLISH，不需要客户端确认的消息直接返回RECVACK
+// 没有订阅主题或分配不到packetId的消息不下发也不确认，留给重试机制，之后订阅或有空闲的packetId时再下发
+func (m *mqttSession) toPublish(c *connContext, recvPacket *wkproto.RecvPacket) (*mqtt.PublishPacket, *wkproto.RecvackPacket) {
+	recvack := &wkproto.RecvackPacket{
+		MessageID:  recvPacket.MessageID,
+		MessageSeq: recvPacket.MessageSeq,
+	}
+	payload, err := wkutil.AesDecryptPkcs7Base64(recvPacket.Payload, []byte(c.aesKey), []byte(c.aesIV))
+	if err != nil {
+		c.Warn("decrypt recv payload failed", zap.Int64("messageId", recvPacket.MessageID), zap.Error(err))
+		return nil, recvack
+	}
+	topic := mqttTopic(recvPacket.ChannelID, recvPacket.ChannelType)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	qos, ok := m.matchQoS(topic)
+	if !ok { // 没有订阅此主题
+		return nil, nil
+	}
+	publishPacket := &mqtt.PublishPacket{
+		Version: m.version,
+		QoS:     qos,
+		Topic:   topic,
+		Payload: payload,
+	}
+	if m.version == mqtt.Version5 {
+		publishPacket.Properties = &mqtt.Properties{
+			User: []mqtt.UserProperty{
+				{Key: "from_uid", Value: recvPacket.FromUID},
+				{Key: "message_id", Value: strconv.FormatInt(recvPacket.MessageID, 10)},
+				{Key: "message_seq", Value: strconv.FormatUint(uint64(recvPacket.MessageSeq), 10)},
+				{Key: "client_msg_no", Value: recvPacket.ClientMsgNo},
+				{Key: "timestamp", Value: strconv.FormatInt(int64(recvPacket.Timestamp), 10)},
+			},
+		}
+		if recvPacket.Expire > 0 {
+			expire := recvPacket.Expire
+			publishPacket.Properties.MessageExpiry = &expire
+		}
+	}
+	if qos == 0 {
+		return publishPacket, recvack
+	}
+	if packetId, ok := m.inflightMsgs[recvPacket.MessageID]; ok { // 重试的消息复用packetId
+		publishPacket.PacketID = packetId
+		publishPacket.Dup = true
+		return publishPacket, nil
+	}
+	packetId, ok := m.allocPacketId()
+	if !ok {
+		c.Warn("no available mqtt packet id", zap.Int("inflight", len(m.inflight)))
+		return nil, nil
+	}
+	publishPacket.PacketID = packetId
+	m.inflight[packetId] = mqttInflight{
+		messageId:  recvPacket.MessageID,
+		messageSeq: recvPacket.MessageSeq,
+	}
+	m.inflightMsgs[recvPacket.MessageID] = packetId
+	return publishPacket, nil
+}
+
+func (s *Server) writeMQTTPacket(conn wknet.Conn, packet mqtt.ControlPacket) {
+	mqttConn, ok := conn.(wknet.IMQTTConn)
+	if !ok {
+		return
+	}
+	if err := mqttConn.WriteMQTTPacket(packet); err != nil {
+		s.Warn("Failed to write the mqtt packet", zap.String("packetType", packet.Type().String()), zap.Error(err))
+		return
+	}
+	_ = conn.WakeWrite()
+}
+
+func (s *Server) writeMQTTPacketAndWake(connCtx *connContext, packet mqtt.ControlPacket) {
+	connCtx.outPacketCount.Add(1)
+	s.writeMQTTPacket(connCtx.conn, packet)
+}
+
+// writeMQTTDisconnect MQTT 5.0 服务端可以在断开前发送DISCONNECT告知原因
+func (s *Server) writeMQTTDisconnect(connCtx *connContext, code mqtt.ReasonCode) {
+	if connCtx.mqtt.version != mqtt.Version5 {
+		return
+	}
+	s.writeMQTTPacketAndWake(connCtx, &mqtt.DisconnectPacket{
+		Version:    connCtx.mqtt.version,
+		ReasonCode: code,
+	})
+}
+
+func mqttTopic(channelId string, channelType uint8) string {
+	return strconv.Itoa(int(channelType)) + "/" + channelId
+}
+
+// parseMQTTTopic 解析主题 {channelType}/{channelId}
+func parseMQTTTopic(topic string) (string, uint8, bool) {
+	channelTypeStr, channelId, ok := strings.Cut(topic, "/")
+	if !ok || strings.TrimSpace(channelId) == "" || strings.ContainsAny(channelId, "+#") {
+		return "", 0, false
+	}
+	channelType, err := strconv.ParseUint(channelTypeStr, 10, 8)
+	if err != nil || channelType == 0 {
+		return "", 0, false
+	}
+	return channelId, uint8(channelType), true
+}
+
+// mqttConnackReasonCode 悟空协议CONNACK的原因码转换为mqtt的原因码
+func mqttConnackReasonCode(version byte, code wkproto.ReasonCode) mqtt.ReasonCode {
+	if version == mqtt.Version5 {
+		switch code {
+		case wkproto.ReasonSuccess:
+			return mqtt.Success
+		case wkproto.ReasonAuthFail:
+			return mqtt.NotAuthorized
+		case wkproto.ReasonBan:
+			return mqtt.Banned
+		case wkproto.ReasonRateLimit:
+			return mqtt.QuotaExceeded
+		}
+		return mqtt.UnspecifiedError
+	}
+	switch code {
+	case wkproto.ReasonSuccess:
+		return mqtt.ReasonCode(mqtt.ConnAccepted)
+	case wkproto.ReasonAuthFail:
+		return mqtt.ReasonCode(mqtt.ConnRefusedBadUsernamePassword)
+	case wkproto.ReasonBan:
+		return mqtt.ReasonCode(mqtt.ConnRefusedNotAuthorized)
+	}
+	return mqtt.ReasonCode(mqtt.ConnRefusedServerUnavailable)
+}
+
+// mqttReasonCode 悟空协议SENDACK的原因码转换为PUBACK的原因码（MQTT 3.1.1的PUBACK没有原因码）
+func mqttReasonCode(code wkproto.ReasonCode) mqtt.ReasonCode {
+	switch code {
+	case wkproto.ReasonSuccess:
+		return mqtt.Success
+	case wkproto.ReasonSubscriberNotExist, wkproto.ReasonInBlacklist, wkproto.ReasonNotInWhitelist, wkproto.ReasonNotAllowSend, wkproto.ReasonBan, wkproto.ReasonDisband:
+		return mqtt.NotAuthorized
+	case wkproto.ReasonChannelIDError, wkproto.ReasonChannelNotExist, wkproto.ReasonNotSupportChannelType:
+		return mqtt.TopicNameInvalid
+	case wkproto.ReasonRateLimit:
+		return mqtt.QuotaExceeded
+	}
+	return mqtt.UnspecifiedError
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"testing"
 
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
 	"github.com/stretchr/testify/assert"
 )
@@ -34,3 +36,109 @@ func TestChannelMessagesSetMarshal(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(channelMessages))
 }
+
+func TestChannelFowardReqStreamMarshal(t *testing.T) {
+	req := ChannelFowardReq{
+		ChannelId:   "test",
+		ChannelType: 2,
+		Messages: []ReactorChannelMessage{
+			{
+				MessageId:  1,
+				FromUid:    "bot",
+				StreamSeq:  3,
+				StreamFlag: wkproto.StreamFlagEnd,
+				SendPacket: &wkproto.SendPacket{
+					Setting:     wkproto.SettingStream,
+					StreamNo:    "stream1",
+					ChannelID:   "test",
+					ChannelType: 2,
+					Payload:     []byte("hello"),
+				},
+			},
+		},
+	}
+	data, err := req.Marshal()
+	assert.Nil(t, err)
+
+	resultReq := &ChannelFowardReq{}
+	err = resultReq.Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(resultReq.Messages))
+	msg := resultReq.Messages[0]
+	assert.Equal(t, "stream1", msg.SendPacket.StreamNo)
+	assert.Equal(t, uint32(3), msg.StreamSeq)
+	assert.Equal(t, wkproto.StreamFlagEnd, msg.StreamFlag)
+	assert.True(t, msg.isStreamChunk())
+
+	// 旧版本节点转发的数据没有流信息，默认为进行中
+	resultReq = &ChannelFowardReq{}
+	err = resultReq.Unmarshal(data[:len(data)-5])
+	assert.Nil(t, err)
+	assert.Equal(t, wkproto.StreamFlagIng, resultReq.Messages[0].StreamFlag)
+}
+
+func TestReceiptReqSetMarshal(t *testing.T) {
+	readedSet := receiptReadedReqSet{
+		{
+			ChannelId:   "group1",
+			ChannelType: 2,
+			Cursors: []wkdb.ReadCursor{
+				{Uid: "u1", ReadedToSeq: 10},
+				{Uid: "u2", ReadedToSeq: 20},
+			},
+		},
+	}
+	data, err := readedSet.Marshal()
+	assert.Nil(t, err)
+
+	var resultReadedSet receiptReadedReqSet
+	err = resultReadedSet.Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(resultReadedSet))
+	assert.Equal(t, "group1", resultReadedSet[0].ChannelId)
+	assert.Equal(t, uint8(2), resultReadedSet[0].ChannelType)
+	assert.Equal(t, readedSet[0].Cursors, resultReadedSet[0].Cursors)
+
+	notifySet := receiptNotifyReqSet{
+		{
+			ToUid:   "u1",
+			Payload: []byte(`{"type":1008}`),
+		},
+	}
+	data, err = notifySet.Marshal()
+	assert.Nil(t, err)
+
+	var resultNotifySet receiptNotifyReqSet
+	err = resultNotifySet.Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(resultNotifySet))
+	assert.Equal(t, "u1", resultNotifySet[0].ToUid)
+	assert.Equal(t, []byte(`{"type":1008}`), resultNotifySet[0].Payload)
+}
+
+func TestPresenceReqMarshal(t *testing.T) {
+	req := &presenceSubscribeReq{
+		Subscriber:  "u1",
+		Uids:        []string{"u2", "u3"},
+		Unsubscribe: true,
+	}
+	data, err := req.Marshal()
+	assert.Nil(t, err)
+
+	resultReq := &presenceSubscribeReq{}
+	err = resultReq.Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, req, resultReq)
+
+	statuses := PresenceStatusSet{
+		{Uid: "u2", Online: 1},
+		{Uid: "u3", LastSeen: 1700000000},
+	}
+	data, err = statuses.Marshal()
+	assert.Nil(t, err)
+
+	var resultStatuses PresenceStatusSet
+	err = resultStatuses.Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, statuses, resultStatuses)
+}
@@ -48,6 +48,25 @@ const (
 	RoleProxy   Role = "proxy"
 )
 
+type DeviceTokenMode string
+
+const (
+	// 校验通过/user/token存储的token
+	DeviceTokenModeStore DeviceTokenMode = "store"
+	// 校验无状态的jwt
+	DeviceTokenModeJWT DeviceTokenMode = "jwt"
+)
+
+// TenantApp 租户配置
+type TenantApp struct {
+	AppId           string // 租户id
+	WebhookHTTPAddr string // 租户的webhook地址，为空则使用全局的webhook配置
+	DatasourceAddr  string // 租户的数据源地址，为空则使用全局的数据源配置
+	MaxConnections  int    // 每个节点最多允许的连接数，0为不限制
+	MessageRate     int    // 每秒允许发送的消息数量，0为不限制（在频道领导节点限速）
+	MaxStorage      int64  // 最多允许存储的消息字节数，0为不限制
+}
+
 type Options struct {
 	vp          *viper.Viper // 内部配置对象
 	Mode        Mode         // 模式 debug 测试 release 正式 bench 压力测试
@@ -102,11 +121,42 @@ type Options struct {
 		GRPCAddr                    string        //  webhook的grpc地址 如果此地址有值 则不会再调用HttpAddr配置的地址,格式为 ip:port
 		MsgNotifyEventPushInterval  time.Duration // 消息通知事件推送间隔，默认500毫秒发起一次推送
 		MsgNotifyEventCountPerPush  int           // 每次webhook消息通知事件推送消息数量限制 默认一次请求最多推送100条
-		MsgNotifyEventRetryMaxCount int           // 消息通知事件消息推送失败最大重试次数 默认为5次，超过将丢弃
+		MsgNotifyEventRetryMaxCount int           // 消息通知事件消息推送失败最大重试次数 默认为5次，超过将移入死信
+		EventRetryMaxCount          int           // 其他事件推送失败最大重试次数 默认为10次，超过将移入死信
+		EventRetryBaseInterval      time.Duration // 事件推送失败后第一次重试的间隔，之后每次翻倍 默认为1秒
+		EventRetryMaxInterval       time.Duration // 事件推送失败重试的最大间隔 默认为10分钟
+		Secret                      string        // 签名密钥，配置后请求头会带上X-WK-Signature（HMAC-SHA256）
+	}
+	Push struct { // 离线推送配置，开启后离线用户将通过设备上报的推送token直接推送
+		On       bool          // 是否开启离线推送
+		Title    string        // 推送标题，为空则使用发送者uid
+		Body     string        // 消息内容无法解析时的推送内容
+		Timeout  time.Duration // 请求推送服务的超时时间
+		PoolSize int           // 推送协程池大小
+		BadgeOn  bool          // 是否根据最近会话未读数计算角标
+		APNs     struct {
+			Endpoint  string // APNs服务地址，默认为 https://api.push.apple.com
+			Topic     string // apns-topic，一般为app的bundle id
+			AuthToken string // 请求APNs的bearer token，不填写则不启用APNs
+		}
+		FCM struct {
+			Endpoint  string // FCM的消息发送地址，格式为 https://fcm.googleapis.com/v1/projects/{项目id}/messages:send，不填写则不启用FCM
+			ServerKey string // 请求FCM的bearer token
+		}
+	}
+	Receipt struct { // 消息回执配置
+		On                bool          // 是否开启消息回执，开启后将记录成员的已读位置
+		FlushInterval     time.Duration // 已读位置批量保存的间隔
+		NotifyMaxMessages int           // 每次回执通知最多包含的消息数量，0表示不通知发送者
+		CacheSize         int           // 本节点最多缓存的已通知已读位置数量
 	}
 	Datasource struct { // 数据源配置，不填写则使用自身数据存储逻辑，如果填写则使用第三方数据源，数据格式请查看文档
-		Addr          string // 数据源地址
-		ChannelInfoOn bool   // 是否开启频道信息获取
+		Addr          string        // 数据源地址
+		GRPCAddr      string        // grpc数据源地址，配置后优先通过grpc请求数据源
+		ChannelInfoOn bool          // 是否开启频道信息获取
+		Timeout       time.Duration // 请求数据源的超时时间
+		CacheSize     int           // 本节点最多缓存的数据源结果数量，0表示不缓存
+		CacheTTL      time.Duration // 数据源结果的缓存时间
 	}
 	Conversation struct {
 		On                 bool          // 是否开启最近会话
@@ -136,11 +186,45 @@ type Options struct {
 	TimingWheelTick time.Duration // The time-round training interval must be 1ms or more
 	TimingWheelSize int64         // Time wheel size
 
-	UserMsgQueueMaxSize int // 用户消息队列最大大小，超过此大小此用户将被限速，0为不限制
+	UserMsgQueueMaxSize int // 用户消息队列最大大小，超过此大小此用户将被限速，0为不限制（作为用户发送令牌桶的容量）
+
+	Event struct { // 临时事件配置（正在输入等，SEND包setting设置了事件标记）
+		UserRate  int // 每个用户每秒允许发送的事件数量，0为不限制
+		UserBurst int // 用户允许突发发送的事件数量，0为与UserRate相同
+		PoolSize  int // 处理事件的协程池大小
+	}
+
+	Presence struct { // 在线状态订阅配置
+		On                bool          // 是否开启在线状态推送，开启后会记录用户的最后在线时间
+		NotifyInterval    time.Duration // 在线状态变更批量通知的间隔
+		SubscribeTTL      time.Duration // 订阅的有效期，过期后需要重新订阅
+		MaxSubscribeCount int           // 一次最多订阅的用户数量
+	}
+
+	SendRateLimit struct { // 发送消息限速配置（令牌桶）
+		UserRate     int // 每个用户每秒允许发送的消息数量，0为与UserMsgQueueMaxSize相同
+		ChannelRate  int // 每个频道每秒允许发送的消息数量，0为不限制（频道信息里可单独设置）
+		ChannelBurst int // 频道允许突发发送的消息数量，0为与ChannelRate相同
+		CacheSize    int // 本节点最多缓存的用户和频道令牌桶数量
+	}
+
+	Tenant struct { // 多租户配置，开启后uid和频道id需要带上租户前缀（格式为 <appId>:<id>），不同租户的用户和频道互相隔离
+		On                bool
+		Apps              []TenantApp   // 租户列表
+		UsageSyncInterval time.Duration // 租户存储用量的提交和刷新间隔
+	}
 
 	TokenAuthOn bool // 是否开启token验证 不配置将根据mode属性判断 debug模式下默认为false release模式为true
 
-	EventPoolSize int // 事件协程池大小,此池主要处理im的一些通知事件 比如webhook，上下线等等 默认为1024
+	DeviceToken struct { // 设备token配置（开启token验证时有效）
+		Mode      DeviceTokenMode // 设备token认证方式 store: 校验通过/user/token存储的token jwt: 校验业务方签发的jwt，不需要调用/user/token
+		Secret    string          // jwt为HS256签名时的密钥
+		JWKSFile  string          // jwt为RS256/ES256签名时的公钥文件（JWKS格式）
+		Issuer    string          // 不为空时校验jwt的签发者
+		ClockSkew time.Duration   // 校验jwt的过期时间等允许的时钟偏差
+	}
+
+	EventPoolSize int // 事件协程池大小,此池主要处理im的一些通知事件 比如上下线等等 默认为1024
 
 	WhitelistOffOfPerson bool // 是否关闭个人白名单验证
 	DeliveryMsgPoolSize  int  // 投递消息协程池大小，此池的协程主要用来将消息投递给在线用户 默认大小为 10240
@@ -168,6 +252,10 @@ type Options struct {
 		ChannelReplicaCount int           // 每个频道的副本数量
 		SlotCount           int           // 槽数量
 		InitNodes           []*Node       // 集群初始节点地址
+		Zone                string        // 节点所在的可用区，槽和频道的副本会尽量分散到不同的可用区
+		Rack                string        // 节点所在的机架，同一可用区内副本会尽量分散到不同的机架
+
+		PreferredLeaderZones []string // 槽领导优先分布的可用区，为空表示不限制
 
 		TickInterval time.Duration // 分布式tick间隔
 
@@ -178,6 +266,18 @@ type Options struct {
 		SlotReactorSubCount    int // 槽reactor sub的数量
 
 		PongMaxTick int // 节点超过多少tick没有回应心跳就认为是掉线
+
+		SlotLogCompactInterval time.Duration // 槽日志压缩间隔，0表示不压缩
+		SlotLogRetainCount     int           // 槽日志压缩后保留的日志数量
+
+		TLS struct {
+			On             bool          // 节点之间是否使用mTLS通讯
+			CAFile         string        // ca证书文件，用于校验其他节点的证书
+			CertFile       string        // 本节点的证书文件，证书的CommonName或DNS名称必须为节点id
+			KeyFile        string        // 本节点的证书私钥文件
+			ReloadInterval time.Duration // 检查证书文件变化的间隔，证书文件变化后新连接使用新证书
+		}
+		Secret string // 集群共享密钥，不为空时节点之间连接需要校验密钥签名的token（所有节点必须一致）
 	}
 
 	Trace struct {
@@ -212,8 +312,15 @@ type Options struct {
 	}
 
 	Db struct {
-		ShardNum     int // 频道db分片数量
-		SlotShardNum int // 槽db分片数量
+		ShardNum             int           // 频道db分片数量，修改需要停止服务后执行 wk db reshard
+		SlotShardNum         int           // 槽db分片数量
+		ExpireCheckInterval  time.Duration // 过期消息清理的检查间隔
+		MessageSearchIndexOn bool          // 是否开启消息全文检索的倒排索引（开启前的消息需执行 wk db rebuildSearchIndex 重建）
+	}
+
+	MQTT struct { // mqtt网关配置
+		Addr       string             // mqtt监听地址 例如：tcp://0.0.0.0:1883 不填写则不开启
+		DeviceFlag wkproto.DeviceFlag // mqtt连接使用的设备标识
 	}
 
 	Auth auth.AuthConfig // 认证配置
@@ -223,6 +330,13 @@ type Options struct {
 		Expire time.Duration // jwt expire
 		Issuer string        // jwt 发行者名字
 	}
+
+	APIKey struct { // http api密钥配置
+		On               bool          // 是否开启api密钥认证，开启后业务api需要通过请求头 Authorization: Bearer <api key> 认证（管理者token仍然有效）
+		CacheTTL         time.Duration // 密钥在各节点的缓存时间，吊销和轮换会通知所有节点清除缓存
+		CacheSize        int           // 各节点最多缓存的密钥数量
+		NegativeCacheTTL time.Duration // 不存在的密钥的缓存时间，避免无效密钥的请求每次都查询
+	}
 	PprofOn bool // 是否开启pprof
 }
 
@@ -261,6 +375,40 @@ func NewOptions(op ...Option) *Options {
 		WSSAddr:             "",
 		ConnIdleTime:        time.Minute * 3,
 		UserMsgQueueMaxSize: 0,
+		SendRateLimit: struct {
+			UserRate     int
+			ChannelRate  int
+			ChannelBurst int
+			CacheSize    int
+		}{
+			CacheSize: 100000,
+		},
+		Event: struct {
+			UserRate  int
+			UserBurst int
+			PoolSize  int
+		}{
+			UserRate:  10,
+			UserBurst: 20,
+			PoolSize:  1024,
+		},
+		Presence: struct {
+			On                bool
+			NotifyInterval    time.Duration
+			SubscribeTTL      time.Duration
+			MaxSubscribeCount int
+		}{
+			NotifyInterval:    time.Millisecond * 500,
+			SubscribeTTL:      time.Hour * 24,
+			MaxSubscribeCount: 1000,
+		},
+		Tenant: struct {
+			On                bool
+			Apps              []TenantApp
+			UsageSyncInterval time.Duration
+		}{
+			UsageSyncInterval: time.Second * 5,
+		},
 		TmpChannel: struct {
 			Suffix     string
 			CacheCount int
@@ -281,12 +429,29 @@ func NewOptions(op ...Option) *Options {
 		},
 		Datasource: struct {
 			Addr          string
+			GRPCAddr      string
 			ChannelInfoOn bool
+			Timeout       time.Duration
+			CacheSize     int
+			CacheTTL      time.Duration
 		}{
 			Addr:          "",
 			ChannelInfoOn: false,
+			Timeout:       time.Second * 5,
+			CacheSize:     10000,
+			CacheTTL:      time.Minute * 5,
 		},
 		TokenAuthOn: false,
+		DeviceToken: struct {
+			Mode      DeviceTokenMode
+			Secret    string
+			JWKSFile  string
+			Issuer    string
+			ClockSkew time.Duration
+		}{
+			Mode:      DeviceTokenModeStore,
+			ClockSkew: time.Second * 30,
+		},
 		Conversation: struct {
 			On                 bool
 			CacheExpire        time.Duration
@@ -327,10 +492,56 @@ func NewOptions(op ...Option) *Options {
 			MsgNotifyEventPushInterval  time.Duration
 			MsgNotifyEventCountPerPush  int
 			MsgNotifyEventRetryMaxCount int
+			EventRetryMaxCount          int
+			EventRetryBaseInterval      time.Duration
+			EventRetryMaxInterval       time.Duration
+			Secret                      string
 		}{
 			MsgNotifyEventPushInterval:  time.Millisecond * 500,
 			MsgNotifyEventCountPerPush:  100,
 			MsgNotifyEventRetryMaxCount: 5,
+			EventRetryMaxCount:          10,
+			EventRetryBaseInterval:      time.Second,
+			EventRetryMaxInterval:       time.Minute * 10,
+		},
+		Push: struct {
+			On       bool
+			Title    string
+			Body     string
+			Timeout  time.Duration
+			PoolSize int
+			BadgeOn  bool
+			APNs     struct {
+				Endpoint  string
+				Topic     string
+				AuthToken string
+			}
+			FCM struct {
+				Endpoint  string
+				ServerKey string
+			}
+		}{
+			Body:     "您收到一条新消息",
+			Timeout:  time.Second * 5,
+			PoolSize: 100,
+			BadgeOn:  true,
+			APNs: struct {
+				Endpoint  string
+				Topic     string
+				AuthToken string
+			}{
+				Endpoint: "https://api.push.apple.com",
+			},
+		},
+		Receipt: struct {
+			On                bool
+			FlushInterval     time.Duration
+			NotifyMaxMessages int
+			CacheSize         int
+		}{
+			FlushInterval:     time.Second,
+			NotifyMaxMessages: 100,
+			CacheSize:         100000,
 		},
 		Manager: struct {
 			On   bool
@@ -358,12 +569,25 @@ func NewOptions(op ...Option) *Options {
 			ChannelReplicaCount    int
 			SlotCount              int
 			InitNodes              []*Node
+			Zone                   string
+			Rack                   string
+			PreferredLeaderZones   []string
 			TickInterval           time.Duration
 			HeartbeatIntervalTick  int
 			ElectionIntervalTick   int
 			ChannelReactorSubCount int
 			SlotReactorSubCount    int
 			PongMaxTick            int
+			SlotLogCompactInterval time.Duration
+			SlotLogRetainCount     int
+			TLS                    struct {
+				On             bool
+				CAFile         string
+				CertFile       string
+				KeyFile        string
+				ReloadInterval time.Duration
+			}
+			Secret string
 		}{
 			NodeId:                 1001,
 			Addr:                   "tcp://0.0.0.0:11110",
@@ -379,6 +603,17 @@ func NewOptions(op ...Option) *Options {
 			ChannelReactorSubCount: 64,
 			SlotReactorSubCount:    64,
 			PongMaxTick:            30,
+			SlotLogCompactInterval: time.Minute * 10,
+			SlotLogRetainCount:     10000,
+			TLS: struct {
+				On             bool
+				CAFile         string
+				CertFile       string
+				KeyFile        string
+				ReloadInterval time.Duration
+			}{
+				ReloadInterval: time.Minute,
+			},
 		},
 		Trace: struct {
 			Endpoint         string
@@ -429,11 +664,20 @@ func NewOptions(op ...Option) *Options {
 			// DeliverWorkerCountPerNode: 10,
 		},
 		Db: struct {
-			ShardNum     int
-			SlotShardNum int
+			ShardNum             int
+			SlotShardNum         int
+			ExpireCheckInterval  time.Duration
+			MessageSearchIndexOn bool
 		}{
-			ShardNum:     16,
-			SlotShardNum: 16,
+			ShardNum:            16,
+			SlotShardNum:        16,
+			ExpireCheckInterval: time.Minute,
+		},
+		MQTT: struct {
+			Addr       string
+			DeviceFlag wkproto.DeviceFlag
+		}{
+			DeviceFlag: wkproto.APP,
 		},
 
 		Jwt: struct {
@@ -445,6 +689,16 @@ func NewOptions(op ...Option) *Options {
 			Expire: time.Hour * 24 * 30,
 			Issuer: "wukongim",
 		},
+		APIKey: struct {
+			On               bool
+			CacheTTL         time.Duration
+			CacheSize        int
+			NegativeCacheTTL time.Duration
+		}{
+			CacheTTL:         time.Second * 30,
+			CacheSize:        10000,
+			NegativeCacheTTL: time.Second * 5,
+		},
 	}
 
 	for _, o := range op {
@@ -521,8 +775,28 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	o.TimingWheelSize = o.getInt64("timingWheelSize", o.TimingWheelSize)
 
 	o.UserMsgQueueMaxSize = o.getInt("userMsgQueueMaxSize", o.UserMsgQueueMaxSize)
+	o.SendRateLimit.UserRate = o.getInt("sendRateLimit.userRate", o.SendRateLimit.UserRate)
+	o.SendRateLimit.ChannelRate = o.getInt("sendRateLimit.channelRate", o.SendRateLimit.ChannelRate)
+	o.SendRateLimit.ChannelBurst = o.getInt("sendRateLimit.channelBurst", o.SendRateLimit.ChannelBurst)
+	o.SendRateLimit.CacheSize = o.getInt("sendRateLimit.cacheSize", o.SendRateLimit.CacheSize)
+
+	o.Event.UserRate = o.getInt("event.userRate", o.Event.UserRate)
+	o.Event.UserBurst = o.getInt("event.userBurst", o.Event.UserBurst)
+	o.Event.PoolSize = o.getInt("event.poolSize", o.Event.PoolSize)
+
+	o.Presence.On = o.getBool("presence.on", o.Presence.On)
+	o.Presence.NotifyInterval = o.getDuration("presence.notifyInterval", o.Presence.NotifyInterval)
+	o.Presence.SubscribeTTL = o.getDuration("presence.subscribeTTL", o.Presence.SubscribeTTL)
+	o.Presence.MaxSubscribeCount = o.getInt("presence.maxSubscribeCount", o.Presence.MaxSubscribeCount)
+
+	o.configureTenant()
 
 	o.TokenAuthOn = o.getBool("tokenAuthOn", o.TokenAuthOn)
+	o.DeviceToken.Mode = DeviceTokenMode(o.getString("deviceToken.mode", string(o.DeviceToken.Mode)))
+	o.DeviceToken.Secret = o.getString("deviceToken.secret", o.DeviceToken.Secret)
+	o.DeviceToken.JWKSFile = o.getString("deviceToken.jwksFile", o.DeviceToken.JWKSFile)
+	o.DeviceToken.Issuer = o.getString("deviceToken.issuer", o.DeviceToken.Issuer)
+	o.DeviceToken.ClockSkew = o.getDuration("deviceToken.clockSkew", o.DeviceToken.ClockSkew)
 
 	o.UnitTest = o.vp.GetBool("unitTest")
 
@@ -531,6 +805,27 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	o.Webhook.MsgNotifyEventRetryMaxCount = o.getInt("webhook.msgNotifyEventRetryMaxCount", o.Webhook.MsgNotifyEventRetryMaxCount)
 	o.Webhook.MsgNotifyEventCountPerPush = o.getInt("webhook.msgNotifyEventCountPerPush", o.Webhook.MsgNotifyEventCountPerPush)
 	o.Webhook.MsgNotifyEventPushInterval = o.getDuration("webhook.msgNotifyEventPushInterval", o.Webhook.MsgNotifyEventPushInterval)
+	o.Webhook.EventRetryMaxCount = o.getInt("webhook.eventRetryMaxCount", o.Webhook.EventRetryMaxCount)
+	o.Webhook.EventRetryBaseInterval = o.getDuration("webhook.eventRetryBaseInterval", o.Webhook.EventRetryBaseInterval)
+	o.Webhook.EventRetryMaxInterval = o.getDuration("webhook.eventRetryMaxInterval", o.Webhook.EventRetryMaxInterval)
+	o.Webhook.Secret = o.getString("webhook.secret", o.Webhook.Secret)
+
+	o.Push.On = o.getBool("push.on", o.Push.On)
+	o.Push.Title = o.getString("push.title", o.Push.Title)
+	o.Push.Body = o.getString("push.body", o.Push.Body)
+	o.Push.Timeout = o.getDuration("push.timeout", o.Push.Timeout)
+	o.Push.PoolSize = o.getInt("push.poolSize", o.Push.PoolSize)
+	o.Push.BadgeOn = o.getBool("push.badgeOn", o.Push.BadgeOn)
+	o.Push.APNs.Endpoint = o.getString("push.apns.endpoint", o.Push.APNs.Endpoint)
+	o.Push.APNs.Topic = o.getString("push.apns.topic", o.Push.APNs.Topic)
+	o.Push.APNs.AuthToken = o.getString("push.apns.authToken", o.Push.APNs.AuthToken)
+	o.Push.FCM.Endpoint = o.getString("push.fcm.endpoint", o.Push.FCM.Endpoint)
+	o.Push.FCM.ServerKey = o.getString("push.fcm.serverKey", o.Push.FCM.ServerKey)
+
+	o.Receipt.On = o.getBool("receipt.on", o.Receipt.On)
+	o.Receipt.FlushInterval = o.getDuration("receipt.flushInterval", o.Receipt.FlushInterval)
+	o.Receipt.NotifyMaxMessages = o.getInt("receipt.notifyMaxMessages", o.Receipt.NotifyMaxMessages)
+	o.Receipt.CacheSize = o.getInt("receipt.cacheSize", o.Receipt.CacheSize)
 
 	o.EventPoolSize = o.getInt("eventPoolSize", o.EventPoolSize)
 	o.DeliveryMsgPoolSize = o.getInt("deliveryMsgPoolSize", o.DeliveryMsgPoolSize)
@@ -540,7 +835,11 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	o.TmpChannel.Suffix = o.getString("tmpChannel.suffix", o.TmpChannel.Suffix)
 
 	o.Datasource.Addr = o.getString("datasource.addr", o.Datasource.Addr)
+	o.Datasource.GRPCAddr = o.getString("datasource.grpcAddr", o.Datasource.GRPCAddr)
 	o.Datasource.ChannelInfoOn = o.getBool("datasource.channelInfoOn", o.Datasource.ChannelInfoOn)
+	o.Datasource.Timeout = o.getDuration("datasource.timeout", o.Datasource.Timeout)
+	o.Datasource.CacheSize = o.getInt("datasource.cacheSize", o.Datasource.CacheSize)
+	o.Datasource.CacheTTL = o.getDuration("datasource.cacheTTL", o.Datasource.CacheTTL)
 
 	o.WhitelistOffOfPerson = o.getBool("whitelistOffOfPerson", o.WhitelistOffOfPerson)
 
@@ -637,6 +936,8 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	o.Cluster.ChannelReplicaCount = o.getInt("cluster.channelReplicaCount", o.Cluster.ChannelReplicaCount)
 	o.Cluster.ServerAddr = o.getString("cluster.serverAddr", o.Cluster.ServerAddr)
 	o.Cluster.PongMaxTick = o.getInt("cluster.pongMaxTick", o.Cluster.PongMaxTick)
+	o.Cluster.SlotLogCompactInterval = o.getDuration("cluster.slotLogCompactInterval", o.Cluster.SlotLogCompactInterval)
+	o.Cluster.SlotLogRetainCount = o.getInt("cluster.slotLogRetainCount", o.Cluster.SlotLogRetainCount)
 
 	o.Cluster.ReqTimeout = o.getDuration("cluster.reqTimeout", o.Cluster.ReqTimeout)
 	o.Cluster.Seed = o.getString("cluster.seed", o.Cluster.Seed)
@@ -671,6 +972,20 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	o.Cluster.ChannelReactorSubCount = o.getInt("cluster.channelReactorSubCount", o.Cluster.ChannelReactorSubCount)
 	o.Cluster.SlotReactorSubCount = o.getInt("cluster.slotReactorSubCount", o.Cluster.SlotReactorSubCount)
 	o.Cluster.APIUrl = o.getString("cluster.apiUrl", o.Cluster.APIUrl)
+	o.Cluster.Zone = o.getString("cluster.zone", o.Cluster.Zone)
+	o.Cluster.Rack = o.getString("cluster.rack", o.Cluster.Rack)
+	if zones := o.getStringSlice("cluster.preferredLeaderZones"); len(zones) > 0 {
+		o.Cluster.PreferredLeaderZones = zones
+	}
+	o.Cluster.TLS.On = o.getBool("cluster.tls.on", o.Cluster.TLS.On)
+	o.Cluster.TLS.CAFile = o.getString("cluster.tls.caFile", o.Cluster.TLS.CAFile)
+	o.Cluster.TLS.CertFile = o.getString("cluster.tls.certFile", o.Cluster.TLS.CertFile)
+	o.Cluster.TLS.KeyFile = o.getString("cluster.tls.keyFile", o.Cluster.TLS.KeyFile)
+	o.Cluster.TLS.ReloadInterval = o.getDuration("cluster.tls.reloadInterval", o.Cluster.TLS.ReloadInterval)
+	if o.Cluster.TLS.On && (o.Cluster.TLS.CAFile == "" || o.Cluster.TLS.CertFile == "" || o.Cluster.TLS.KeyFile == "") {
+		wklog.Panic("cluster.tls.caFile, cluster.tls.certFile and cluster.tls.keyFile are required when cluster.tls.on is true")
+	}
+	o.Cluster.Secret = o.getString("cluster.secret", o.Cluster.Secret)
 
 	// =================== trace ===================
 	o.Trace.Endpoint = o.getString("trace.endpoint", o.Trace.Endpoint)
@@ -698,6 +1013,12 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 	// =================== db ===================
 	o.Db.ShardNum = o.getInt("db.shardNum", o.Db.ShardNum)
 	o.Db.SlotShardNum = o.getInt("db.slotShardNum", o.Db.SlotShardNum)
+	o.Db.ExpireCheckInterval = o.getDuration("db.expireCheckInterval", o.Db.ExpireCheckInterval)
+	o.Db.MessageSearchIndexOn = o.getBool("db.messageSearchIndexOn", o.Db.MessageSearchIndexOn)
+
+	// =================== mqtt ===================
+	o.MQTT.Addr = o.getString("mqtt.addr", o.MQTT.Addr)
+	o.MQTT.DeviceFlag = wkproto.DeviceFlag(o.getInt("mqtt.deviceFlag", int(o.MQTT.DeviceFlag)))
 
 	// =================== auth ===================
 	o.configureAuth()
@@ -710,6 +1031,28 @@ func (o *Options) ConfigureWithViper(vp *viper.Viper) {
 }
 
 // 认证配置
+func (o *Options) configureTenant() {
+	o.Tenant.On = o.getBool("tenant.on", o.Tenant.On)
+	o.Tenant.UsageSyncInterval = o.getDuration("tenant.usageSyncInterval", o.Tenant.UsageSyncInterval)
+	if o.vp.IsSet("tenant.apps") {
+		apps := make([]TenantApp, 0)
+		if err := o.vp.UnmarshalKey("tenant.apps", &apps); err != nil {
+			wklog.Panic("tenant apps format error", zap.Error(err))
+		}
+		o.Tenant.Apps = apps
+	}
+	appIds := make(map[string]struct{}, len(o.Tenant.Apps))
+	for _, app := range o.Tenant.Apps {
+		if strings.TrimSpace(app.AppId) == "" || strings.Contains(app.AppId, tenantSeparator) {
+			wklog.Panic("tenant appId is illegal", zap.String("appId", app.AppId))
+		}
+		if _, ok := appIds[app.AppId]; ok {
+			wklog.Panic("tenant appId is duplicate", zap.String("appId", app.AppId))
+		}
+		appIds[app.AppId] = struct{}{}
+	}
+}
+
 func (o *Options) configureAuth() {
 
 	// =================== jwt ===================
@@ -717,6 +1060,12 @@ func (o *Options) configureAuth() {
 	o.Jwt.Expire = o.getDuration("jwt.expire", o.Jwt.Expire)
 	o.Jwt.Issuer = o.getString("jwt.issuer", o.Jwt.Issuer)
 
+	// =================== api key ===================
+	o.APIKey.On = o.getBool("apiKey.on", o.APIKey.On)
+	o.APIKey.CacheTTL = o.getDuration("apiKey.cacheTTL", o.APIKey.CacheTTL)
+	o.APIKey.CacheSize = o.getInt("apiKey.cacheSize", o.APIKey.CacheSize)
+	o.APIKey.NegativeCacheTTL = o.getDuration("apiKey.negativeCacheTTL", o.APIKey.NegativeCacheTTL)
+
 	// =================== auth ===================
 	o.Auth.On = o.getBool("auth.on", o.Auth.On)
 	o.Auth.SuperToken = o.getString("auth.superToken", o.Auth.SuperToken)
@@ -848,6 +1197,14 @@ func (o *Options) Check() error {
 	if o.Cluster.NodeId == 0 {
 		return errors.New("cluster.nodeId must be set")
 	}
+	if o.Cluster.Role == RoleProxy { // 代理节点不存储数据，只能通过种子节点加入已有的集群
+		if strings.TrimSpace(o.Cluster.Seed) == "" {
+			return errors.New("cluster.seed must be set when cluster.role is proxy")
+		}
+		if len(o.Cluster.InitNodes) > 0 {
+			return errors.New("cluster.initNodes can not be set when cluster.role is proxy")
+		}
+	}
 
 	return nil
 }
@@ -953,7 +1310,17 @@ func (o *Options) getDuration(key string, defaultValue time.Duration) time.Durat
 
 // WebhookOn WebhookOn
 func (o *Options) WebhookOn() bool {
-	return strings.TrimSpace(o.Webhook.HTTPAddr) != "" || o.WebhookGRPCOn()
+	if strings.TrimSpace(o.Webhook.HTTPAddr) != "" || o.WebhookGRPCOn() {
+		return true
+	}
+	if o.Tenant.On { // 只配置了租户的webhook
+		for _, app := range o.Tenant.Apps {
+			if strings.TrimSpace(app.WebhookHTTPAddr) != "" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // WebhookGRPCOn 是否配置了webhook grpc地址
@@ -961,9 +1328,49 @@ func (o *Options) WebhookGRPCOn() bool {
 	return strings.TrimSpace(o.Webhook.GRPCAddr) != ""
 }
 
+// TenantApp 获取租户配置
+func (o *Options) TenantApp(appId string) (TenantApp, bool) {
+	for _, app := range o.Tenant.Apps {
+		if app.AppId == appId {
+			return app, true
+		}
+	}
+	return TenantApp{}, false
+}
+
+// AppIdOf 获取uid或频道id所属的租户id，未开启多租户或没有租户前缀返回空
+// 个人频道的id为 <appId>:<uid1>@<appId>:<uid2>，cmd频道为原频道id加后缀，前缀都是租户id
+func (o *Options) AppIdOf(id string) string {
+	if !o.Tenant.On {
+		return ""
+	}
+	appId, _, ok := strings.Cut(id, tenantSeparator)
+	if !ok {
+		return ""
+	}
+	return appId
+}
+
 // HasDatasource 是否有配置数据源
 func (o *Options) HasDatasource() bool {
-	return strings.TrimSpace(o.Datasource.Addr) != ""
+	return strings.TrimSpace(o.Datasource.Addr) != "" || o.DatasourceGRPCOn()
+}
+
+// DatasourceGRPCOn 是否通过grpc请求数据源
+func (o *Options) DatasourceGRPCOn() bool {
+	return strings.TrimSpace(o.Datasource.GRPCAddr) != ""
+}
+
+// userSendRateLimit 用户发送限速的速率和容量，速率为0表示不限速
+func (o *Options) userSendRateLimit() (int, int) {
+	rate, burst := o.SendRateLimit.UserRate, o.UserMsgQueueMaxSize
+	if rate <= 0 {
+		rate = burst
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return rate, burst
 }
 
 // 获取客服频道的访客id
@@ -1094,6 +1501,12 @@ func WithWSSAddr(wssAddr string) Option {
 	}
 }
 
+func WithMQTTAddr(mqttAddr string) Option {
+	return func(opts *Options) {
+		opts.MQTT.Addr = mqttAddr
+	}
+}
+
 func WithWSSConfig(certFile, keyFile string) Option {
 	return func(opts *Options) {
 		opts.WSSConfig.CertFile = certFile
@@ -1227,6 +1640,43 @@ func WithUserMsgQueueMaxSize(userMsgQueueMaxSize int) Option {
 	}
 }
 
+func WithEventUserRate(userRate int, userBurst int) Option {
+	return func(opts *Options) {
+		opts.Event.UserRate = userRate
+		opts.Event.UserBurst = userBurst
+	}
+}
+
+func WithPresenceOn(on bool) Option {
+	return func(opts *Options) {
+		opts.Presence.On = on
+	}
+}
+
+func WithPresenceNotifyInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.Presence.NotifyInterval = interval
+	}
+}
+
+func WithSendRateLimitUserRate(userRate int) Option {
+	return func(opts *Options) {
+		opts.SendRateLimit.UserRate = userRate
+	}
+}
+
+func WithSendRateLimitChannelRate(channelRate int) Option {
+	return func(opts *Options) {
+		opts.SendRateLimit.ChannelRate = channelRate
+	}
+}
+
+func WithSendRateLimitChannelBurst(channelBurst int) Option {
+	return func(opts *Options) {
+		opts.SendRateLimit.ChannelBurst = channelBurst
+	}
+}
+
 func WithTmpChannelSuffix(suffix string) Option {
 	return func(opts *Options) {
 		opts.TmpChannel.Suffix = suffix
@@ -1245,6 +1695,19 @@ func WithDatasourceAddr(addr string) Option {
 	}
 }
 
+func WithDatasourceGRPCAddr(addr string) Option {
+	return func(opts *Options) {
+		opts.Datasource.GRPCAddr = addr
+	}
+}
+
+func WithDatasourceCache(size int, ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.Datasource.CacheSize = size
+		opts.Datasource.CacheTTL = ttl
+	}
+}
+
 func WithDatasourceChannelInfoOn(channelInfoOn bool) Option {
 	return func(opts *Options) {
 		opts.Datasource.ChannelInfoOn = channelInfoOn
@@ -1263,6 +1726,33 @@ func WithTokenAuthOn(tokenAuthOn bool) Option {
 	}
 }
 
+func WithDeviceTokenJWT(secret string, jwksFile string) Option {
+	return func(opts *Options) {
+		opts.DeviceToken.Mode = DeviceTokenModeJWT
+		opts.DeviceToken.Secret = secret
+		opts.DeviceToken.JWKSFile = jwksFile
+	}
+}
+
+func WithDeviceTokenClockSkew(clockSkew time.Duration) Option {
+	return func(opts *Options) {
+		opts.DeviceToken.ClockSkew = clockSkew
+	}
+}
+
+func WithTenantApps(apps ...TenantApp) Option {
+	return func(opts *Options) {
+		opts.Tenant.On = true
+		opts.Tenant.Apps = apps
+	}
+}
+
+func WithAPIKeyOn(on bool) Option {
+	return func(opts *Options) {
+		opts.APIKey.On = on
+	}
+}
+
 func WithEventPoolSize(eventPoolSize int) Option {
 	return func(opts *Options) {
 		opts.EventPoolSize = eventPoolSize
@@ -1377,6 +1867,71 @@ func WithWebhookMsgNotifyEventRetryMaxCount(retryMaxCount int) Option {
 	}
 }
 
+func WithWebhookEventRetry(maxCount int, baseInterval time.Duration, maxInterval time.Duration) Option {
+	return func(opts *Options) {
+		opts.Webhook.EventRetryMaxCount = maxCount
+		opts.Webhook.EventRetryBaseInterval = baseInterval
+		opts.Webhook.EventRetryMaxInterval = maxInterval
+	}
+}
+
+func WithWebhookSecret(secret string) Option {
+	return func(opts *Options) {
+		opts.Webhook.Secret = secret
+	}
+}
+
+func WithPushOn(on bool) Option {
+	return func(opts *Options) {
+		opts.Push.On = on
+	}
+}
+
+func WithPushTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.Push.Timeout = timeout
+	}
+}
+
+func WithPushBadgeOn(badgeOn bool) Option {
+	return func(opts *Options) {
+		opts.Push.BadgeOn = badgeOn
+	}
+}
+
+func WithPushAPNs(endpoint string, topic string, authToken string) Option {
+	return func(opts *Options) {
+		opts.Push.APNs.Endpoint = endpoint
+		opts.Push.APNs.Topic = topic
+		opts.Push.APNs.AuthToken = authToken
+	}
+}
+
+func WithPushFCM(endpoint string, serverKey string) Option {
+	return func(opts *Options) {
+		opts.Push.FCM.Endpoint = endpoint
+		opts.Push.FCM.ServerKey = serverKey
+	}
+}
+
+func WithReceiptOn(on bool) Option {
+	return func(opts *Options) {
+		opts.Receipt.On = on
+	}
+}
+
+func WithReceiptFlushInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.Receipt.FlushInterval = interval
+	}
+}
+
+func WithReceiptNotifyMaxMessages(maxMessages int) Option {
+	return func(opts *Options) {
+		opts.Receipt.NotifyMaxMessages = maxMessages
+	}
+}
+
 func WithClusterNodeId(nodeId uint64) Option {
 	return func(opts *Options) {
 		opts.Cluster.NodeId = nodeId
@@ -1474,6 +2029,18 @@ func WithClusterPongMaxTick(pongMaxTick int) Option {
 	}
 }
 
+func WithClusterSlotLogCompactInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.Cluster.SlotLogCompactInterval = interval
+	}
+}
+
+func WithClusterSlotLogRetainCount(count int) Option {
+	return func(opts *Options) {
+		opts.Cluster.SlotLogRetainCount = count
+	}
+}
+
 func WithTraceEndpoint(endpoint string) Option {
 	return func(opts *Options) {
 		opts.Trace.Endpoint = endpoint
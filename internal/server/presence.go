@@ -0,0 +1,381 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/lni/goutils/syncutil"
+	"go.uber.org/zap"
+)
+
+// presenceManager 在线状态订阅管理
+// 订阅关系保存在被订阅用户的领导节点内存里，用户上线、离线时由用户领导节点批量通知订阅者，
+// 订阅者不在本节点的通过 /wk/userAction 转发给订阅者的领导节点，只投递给订阅者的在线设备
+type presenceManager struct {
+	s *Server
+
+	mu       sync.Mutex
+	watchers map[string]map[string]int64 // 被订阅的uid -> 订阅者uid -> 订阅过期时间
+	changed  map[string]int64            // 待通知的状态变更 uid -> 变更时间
+
+	stopper *syncutil.Stopper
+	wklog.Log
+}
+
+func newPresenceManager(s *Server) *presenceManager {
+	return &presenceManager{
+		s:        s,
+		watchers: make(map[string]map[string]int64),
+		changed:  make(map[string]int64),
+		stopper:  syncutil.NewStopper(),
+		Log:      wklog.NewWKLog("presenceManager"),
+	}
+}
+
+func (p *presenceManager) start() {
+	if !p.s.opts.Presence.On {
+		return
+	}
+	p.stopper.RunWorker(p.loop)
+}
+
+func (p *presenceManager) stop() {
+	if !p.s.opts.Presence.On {
+		return
+	}
+	p.stopper.Stop()
+}
+
+// statusChanged 用户第一个连接认证成功或最后一个连接断开（本节点为用户领导节点）
+func (p *presenceManager) statusChanged(uid string) {
+	if !p.s.opts.Presence.On || p.s.systemUIDManager.SystemUID(uid) {
+		return
+	}
+	p.mu.Lock()
+	p.changed[uid] = time.Now().Unix()
+	p.mu.Unlock()
+}
+
+func (p *presenceManager) loop() {
+	tk := time.NewTicker(p.s.opts.Presence.NotifyInterval)
+	defer tk.Stop()
+	cleanTk := time.NewTicker(time.Minute)
+	defer cleanTk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			p.flush()
+		case <-cleanTk.C:
+			p.removeExpired()
+		case <-p.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+func (p *presenceManager) flush() {
+	p.mu.Lock()
+	if len(p.changed) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	changed := p.changed
+	p.changed = make(map[string]int64)
+	p.mu.Unlock()
+
+	// 以通知时的真实状态为准，短时间内上线又离线的只通知最后的状态
+	onlines := make(map[string]bool, len(changed))
+	slotLastSeens := make(map[uint32]map[string]int64)
+	for uid, changedAt := range changed {
+		online := p.isOnline(uid)
+		onlines[uid] = online
+		if !online {
+			slotId := p.s.getSlotId(uid)
+			if slotLastSeens[slotId] == nil {
+				slotLastSeens[slotId] = make(map[string]int64)
+			}
+			slotLastSeens[slotId][uid] = changedAt
+		}
+	}
+	// 按槽批量更新最后在线时间，只更新这一列，避免覆盖同时修改的免打扰等设置
+	for slotId, lastSeens := range slotLastSeens {
+		timeoutCtx, cancel := context.WithTimeout(p.s.ctx, p.s.opts.Cluster.ReqTimeout)
+		err := p.s.store.UpdateUsersLastSeen(timeoutCtx, slotId, lastSeens)
+		cancel()
+		if err != nil {
+			p.Error("update last seen failed", zap.Error(err), zap.Uint32("slotId", slotId), zap.Int("count", len(lastSeens)))
+		}
+	}
+
+	nodeActions := make(map[uint64][]UserAction)
+	for uid, changedAt := range changed {
+		online := onlines[uid]
+		user, err := p.s.store.GetUser(uid)
+		if err != nil && err != wkdb.ErrNotFound {
+			p.Error("get user failed", zap.Error(err), zap.String("uid", uid))
+			continue
+		}
+		if !online {
+			user.LastSeen = changedAt
+		}
+		if user.PresenceHidden { // 用户隐藏了在线状态，不通知订阅者
+			continue
+		}
+
+		subscribers := p.getSubscribers(uid)
+		if len(subscribers) == 0 {
+			continue
+		}
+		notify := &presenceNotify{
+			Type:     presenceNotifyType,
+			Uid:      uid,
+			LastSeen: user.LastSeen,
+		}
+		if online {
+			notify.Online = 1
+		}
+		payload := []byte(wkutil.ToJSON(notify))
+		for _, subscriber := range subscribers {
+			nodeId := p.s.opts.Cluster.NodeId
+			if p.s.opts.ClusterOn() {
+				leaderId, err := p.s.cluster.SlotLeaderIdOfChannel(subscriber, wkproto.ChannelTypePerson)
+				if err != nil {
+					p.Warn("get subscriber leader failed", zap.Error(err), zap.String("subscriber", subscriber))
+					continue
+				}
+				nodeId = leaderId
+			}
+			nodeActions[nodeId] = append(nodeActions[nodeId], UserAction{
+				ActionType: UserActionPresence,
+				Uid:        subscriber,
+				Messages: []ReactorUserMessage{
+					{
+						FromNodeId: p.s.opts.Cluster.NodeId,
+						OutBytes:   payload,
+					},
+				},
+			})
+		}
+	}
+
+	for nodeId, actions := range nodeActions {
+		if nodeId == p.s.opts.Cluster.NodeId {
+			p.handlePresenceActions(actions)
+			continue
+		}
+		if _, err := p.s.userReactor.forwardUserAction(nodeId, actions); err != nil {
+			p.Error("forward presence actions failed", zap.Error(err), zap.Uint64("nodeId", nodeId), zap.Int("count", len(actions)))
+		}
+	}
+}
+
+// handlePresenceActions 将在线状态通知投递给订阅者的在线设备（本节点为订阅者的领导节点）
+func (p *presenceManager) handlePresenceActions(actions []UserAction) {
+	for _, action := range actions {
+		if p.s.userReactor.getUser(action.Uid) == nil { // 订阅者不在线
+			continue
+		}
+		for _, msg := range action.Messages {
+			// 投递是异步的，这里复制一份，避免数据被复用
+			payload := make([]byte, len(msg.OutBytes))
+			copy(payload, msg.OutBytes)
+			p.deliver(action.Uid, payload)
+		}
+	}
+}
+
+func (p *presenceManager) deliver(toUid string, payload []byte) {
+	fakeChannelId := p.s.opts.OrginalConvertCmdChannel(GetFakeChannelIDWith(toUid, p.s.opts.SystemUID))
+	p.s.deliverManager.deliver(&deliverReq{
+		ch:          p.s.channelReactor.loadOrCreateChannel(fakeChannelId, wkproto.ChannelTypePerson),
+		channelId:   fakeChannelId,
+		channelType: wkproto.ChannelTypePerson,
+		channelKey:  wkutil.ChannelToKey(fakeChannelId, wkproto.ChannelTypePerson),
+		toUids:      []string{toUid},
+		messages: []ReactorChannelMessage{
+			{
+				FromUid:   p.s.opts.SystemUID,
+				MessageId: p.s.channelReactor.messageIDGen.Generate().Int64(),
+				SendPacket: &wkproto.SendPacket{
+					Framer: wkproto.Framer{
+						SyncOnce:  true,
+						NoPersist: true,
+					},
+					ClientMsgNo: wkutil.GenUUID(),
+					ChannelID:   toUid,
+					ChannelType: wkproto.ChannelTypePerson,
+					Payload:     payload,
+				},
+			},
+		},
+	})
+}
+
+// subscribe 订阅者订阅（或取消订阅）用户的在线状态，返回被订阅用户当前的状态
+func (p *presenceManager) subscribe(subscriber string, uids []string, unsubscribe bool) (PresenceStatusSet, error) {
+	nodeUids := make(map[uint64][]string)
+	for _, uid := range uids {
+		if strings.TrimSpace(uid) == "" || uid == subscriber {
+			continue
+		}
+		nodeId := p.s.opts.Cluster.NodeId
+		if p.s.opts.ClusterOn() {
+			leaderId, err := p.s.cluster.SlotLeaderIdOfChannel(uid, wkproto.ChannelTypePerson)
+			if err != nil {
+				return nil, err
+			}
+			nodeId = leaderId
+		}
+		nodeUids[nodeId] = append(nodeUids[nodeId], uid)
+	}
+
+	statuses := make(PresenceStatusSet, 0, len(uids))
+	for nodeId, nodeUidList := range nodeUids {
+		req := &presenceSubscribeReq{
+			Subscriber:  subscriber,
+			Uids:        nodeUidList,
+			Unsubscribe: unsubscribe,
+		}
+		if nodeId == p.s.opts.Cluster.NodeId {
+			results, err := p.handleSubscribe(req)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, results...)
+			continue
+		}
+		results, err := p.requestSubscribe(nodeId, req)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, results...)
+	}
+	return statuses, nil
+}
+
+func (p *presenceManager) requestSubscribe(nodeId uint64, req *presenceSubscribeReq) (PresenceStatusSet, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	timeoutCtx, cancel := context.WithTimeout(p.s.ctx, p.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := p.s.cluster.RequestWithContext(timeoutCtx, nodeId, "/wk/presenceSubscribe", data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != proto.Status_OK {
+		return nil, fmt.Errorf("request presence subscribe failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	statuses := PresenceStatusSet{}
+	if err = statuses.Unmarshal(resp.Body); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// handleSubscribe 保存订阅关系并返回被订阅用户的当前状态（本节点为被订阅用户的领导节点）
+func (p *presenceManager) handleSubscribe(req *presenceSubscribeReq) (PresenceStatusSet, error) {
+	expireAt := time.Now().Add(p.s.opts.Presence.SubscribeTTL).Unix()
+
+	p.mu.Lock()
+	for _, uid := range req.Uids {
+		subscribers := p.watchers[uid]
+		if req.Unsubscribe {
+			if subscribers != nil {
+				delete(subscribers, req.Subscriber)
+				if len(subscribers) == 0 {
+					delete(p.watchers, uid)
+				}
+			}
+			continue
+		}
+		if subscribers == nil {
+			subscribers = make(map[string]int64)
+			p.watchers[uid] = subscribers
+		}
+		subscribers[req.Subscriber] = expireAt
+	}
+	p.mu.Unlock()
+
+	if req.Unsubscribe {
+		return nil, nil
+	}
+
+	statuses := make(PresenceStatusSet, 0, len(req.Uids))
+	for _, uid := range req.Uids {
+		user, err := p.s.store.GetUser(uid)
+		if err != nil && err != wkdb.ErrNotFound {
+			return nil, err
+		}
+		status := &PresenceStatus{
+			Uid: uid,
+		}
+		if !user.PresenceHidden {
+			status.LastSeen = user.LastSeen
+			if p.isOnline(uid) {
+				status.Online = 1
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// getSubscribers 获取用户未过期的订阅者
+func (p *presenceManager) getSubscribers(uid string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subscribers := p.watchers[uid]
+	if len(subscribers) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	results := make([]string, 0, len(subscribers))
+	for subscriber, expireAt := range subscribers {
+		if expireAt <= now {
+			delete(subscribers, subscriber)
+			continue
+		}
+		results = append(results, subscriber)
+	}
+	if len(subscribers) == 0 {
+		delete(p.watchers, uid)
+	}
+	return results
+}
+
+func (p *presenceManager) removeExpired() {
+	now := time.Now().Unix()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for uid, subscribers := range p.watchers {
+		for subscriber, expireAt := range subscribers {
+			if expireAt <= now {
+				delete(subscribers, subscriber)
+			}
+		}
+		if len(subscribers) == 0 {
+			delete(p.watchers, uid)
+		}
+	}
+}
+
+// isOnline 用户是否有认证通过的连接（本节点为用户领导节点）
+func (p *presenceManager) isOnline(uid string) bool {
+	conns := p.s.userReactor.getConnContexts(uid)
+	for _, conn := range conns {
+		if conn.isAuth.Load() {
+			return true
+		}
+	}
+	return false
+}
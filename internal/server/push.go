@@ -0,0 +1,472 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/panjf2000/ants/v2"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	PushProviderAPNs = "apns" // APNs风格的推送
+	PushProviderFCM  = "fcm"  // FCM风格的推送
+)
+
+const (
+	pushLastSeqCacheSize = 10000           // 计算角标时缓存的频道最新消息序号数量
+	pushLastSeqCacheTTL  = time.Second * 3 // 缓存的频道最新消息序号的有效期
+)
+
+// ErrPushTokenInvalid 推送token已失效，推送服务商返回此错误时将清除设备的推送token
+var ErrPushTokenInvalid = errors.New("push token invalid")
+
+// PushRequest 离线推送请求
+type PushRequest struct {
+	Uid         string // 接收者uid
+	DeviceFlag  wkproto.DeviceFlag
+	Token       string // 设备的推送token
+	Title       string // 推送标题
+	Body        string // 推送内容
+	Badge       int    // 角标数
+	ChannelId   string // 接收者看到的频道id
+	ChannelType uint8
+	MessageId   int64
+	MessageSeq  uint32
+}
+
+// PushProvider 离线推送服务商，设备上报推送token时指定的provider需与Name()一致
+type PushProvider interface {
+	// Name 服务商名称
+	Name() string
+	// Push 推送给设备，token失效时返回ErrPushTokenInvalid
+	Push(ctx context.Context, req *PushRequest) error
+}
+
+// pushManager 离线推送管理，将离线消息推送给用户上报了推送token的设备
+type pushManager struct {
+	s         *Server
+	pool      *ants.Pool
+	mu        sync.RWMutex
+	providers map[string]PushProvider
+	lastSeqs  *lru.Cache[string, pushLastSeq] // 频道最新消息序号，计算角标时避免每个会话都查一次库
+	lastSeqMu sync.Mutex
+	wklog.Log
+}
+
+type pushLastSeq struct {
+	seq       uint64
+	expiredAt time.Time
+}
+
+func newPushManager(s *Server) *pushManager {
+	pool, err := ants.NewPool(s.opts.Push.PoolSize, ants.WithPanicHandler(func(err interface{}) {
+		s.Error("push panic", zap.Any("err", err), zap.Stack("stack"))
+	}))
+	if err != nil {
+		panic(err)
+	}
+	lastSeqs, err := lru.New[string, pushLastSeq](pushLastSeqCacheSize)
+	if err != nil {
+		panic(err)
+	}
+	p := &pushManager{
+		s:         s,
+		pool:      pool,
+		providers: make(map[string]PushProvider),
+		lastSeqs:  lastSeqs,
+		Log:       wklog.NewWKLog("pushManager"),
+	}
+
+	httpClient := newPushHTTPClient(s.opts.Push.Timeout)
+	if strings.TrimSpace(s.opts.Push.APNs.AuthToken) != "" {
+		p.register(newAPNsPushProvider(s.opts.Push.APNs.Endpoint, s.opts.Push.APNs.Topic, s.opts.Push.APNs.AuthToken, httpClient))
+	}
+	if strings.TrimSpace(s.opts.Push.FCM.Endpoint) != "" {
+		p.register(newFCMPushProvider(s.opts.Push.FCM.Endpoint, s.opts.Push.FCM.ServerKey, httpClient))
+	}
+	return p
+}
+
+func (p *pushManager) stop() {
+	p.pool.Release()
+}
+
+func (p *pushManager) register(provider PushProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers[provider.Name()] = provider
+}
+
+func (p *pushManager) provider(name string) PushProvider {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.providers[name]
+}
+
+// push 推送离线消息给离线用户
+func (p *pushManager) push(msg ReactorChannelMessage, offlineUids []string) {
+	if !p.s.opts.Push.On {
+		return
+	}
+	sendPacket := msg.SendPacket
+	if sendPacket == nil || !sendPacket.RedDot || sendPacket.SyncOnce { // 没有红点的消息和cmd消息不推送
+		return
+	}
+	if msg.isStreamChunk() { // 流片段不推送，只推送流的开始消息
+		return
+	}
+	if p.s.opts.Push.BadgeOn {
+		p.updateLastSeq(sendPacket.ChannelID, sendPacket.ChannelType, uint64(msg.MessageSeq))
+	}
+	for _, uid := range offlineUids {
+		if uid == msg.FromUid || p.s.systemUIDManager.SystemUID(uid) {
+			continue
+		}
+		toUid := uid
+		err := p.pool.Submit(func() {
+			p.pushToUser(msg, toUid)
+		})
+		if err != nil {
+			p.Error("submit push failed", zap.Error(err), zap.String("uid", toUid))
+		}
+	}
+}
+
+func (p *pushManager) pushToUser(msg ReactorChannelMessage, uid string) {
+	user, err := p.s.store.GetUser(uid)
+	if err != nil && err != wkdb.ErrNotFound {
+		p.Error("get user failed", zap.Error(err), zap.String("uid", uid))
+		return
+	}
+	if user.PushMute {
+		return
+	}
+
+	var (
+		badge     = -1 // 未计算
+		channelId = msg.SendPacket.ChannelID
+	)
+	if msg.SendPacket.ChannelType == wkproto.ChannelTypePerson && channelId == uid {
+		channelId = msg.FromUid
+	}
+
+	for _, deviceFlag := range []wkproto.DeviceFlag{wkproto.APP, wkproto.PC, wkproto.WEB} {
+		if len(p.s.userReactor.getConnContextByDeviceFlag(uid, deviceFlag)) > 0 { // 设备在线不推送
+			continue
+		}
+		device, err := p.s.store.GetDevice(uid, uint64(deviceFlag))
+		if err != nil {
+			if err != wkdb.ErrNotFound {
+				p.Error("get device failed", zap.Error(err), zap.String("uid", uid), zap.Uint8("deviceFlag", deviceFlag.ToUint8()))
+			}
+			continue
+		}
+		if device.PushToken == "" {
+			continue
+		}
+		provider := p.provider(device.PushProvider)
+		if provider == nil {
+			p.Warn("push provider not found", zap.String("provider", device.PushProvider), zap.String("uid", uid))
+			continue
+		}
+		if badge == -1 {
+			badge = p.badge(uid)
+		}
+		req := &PushRequest{
+			Uid:         uid,
+			DeviceFlag:  deviceFlag,
+			Token:       device.PushToken,
+			Title:       p.title(msg),
+			Body:        p.body(msg),
+			Badge:       badge,
+			ChannelId:   channelId,
+			ChannelType: msg.SendPacket.ChannelType,
+			MessageId:   msg.MessageId,
+			MessageSeq:  msg.MessageSeq,
+		}
+		ctx, cancel := context.WithTimeout(p.s.ctx, p.s.opts.Push.Timeout)
+		err = provider.Push(ctx, req)
+		cancel()
+		if err != nil {
+			if errors.Is(err, ErrPushTokenInvalid) {
+				p.Info("push token invalid, clear it", zap.String("uid", uid), zap.Uint8("deviceFlag", deviceFlag.ToUint8()))
+				if err = p.s.store.ClearDevicePushToken(uid, uint64(deviceFlag), device.PushToken); err != nil {
+					p.Error("clear push token failed", zap.Error(err), zap.String("uid", uid))
+				}
+				continue
+			}
+			p.Error("push failed", zap.Error(err), zap.String("provider", provider.Name()), zap.String("uid", uid), zap.Int64("messageId", msg.MessageId))
+		}
+	}
+}
+
+// badge 用户所有最近会话的未读数之和
+func (p *pushManager) badge(uid string) int {
+	if !p.s.opts.Push.BadgeOn {
+		return 0
+	}
+	conversations, err := p.s.store.GetConversations(uid)
+	if err != nil {
+		p.Error("get conversations failed", zap.Error(err), zap.String("uid", uid))
+		return 0
+	}
+	// 缓存中的最近会话已读位置更新
+	cacheConversations := p.s.conversationManager.GetUserConversationFromCache(uid, wkdb.ConversationTypeChat)
+	for _, cacheConversation := range cacheConversations {
+		exist := false
+		for i, conversation := range conversations {
+			if cacheConversation.ChannelId == conversation.ChannelId && cacheConversation.ChannelType == conversation.ChannelType {
+				if cacheConversation.ReadedToMsgSeq > conversation.ReadedToMsgSeq {
+					conversations[i].ReadedToMsgSeq = cacheConversation.ReadedToMsgSeq
+				}
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			conversations = append(conversations, cacheConversation)
+		}
+	}
+
+	badge := 0
+	for _, conversation := range conversations {
+		if conversation.Type != wkdb.ConversationTypeChat {
+			continue
+		}
+		unread := int(conversation.UnreadCount)
+		lastMsgSeq, err := p.lastSeq(conversation.ChannelId, conversation.ChannelType)
+		if err != nil {
+			p.Warn("get channel last message seq failed", zap.Error(err), zap.String("channelId", conversation.ChannelId))
+		} else if lastMsgSeq > conversation.ReadedToMsgSeq && int(lastMsgSeq-conversation.ReadedToMsgSeq) > unread {
+			unread = int(lastMsgSeq - conversation.ReadedToMsgSeq)
+		}
+		badge += unread
+	}
+	return badge
+}
+
+// lastSeq 频道最新的消息序号，优先从缓存中获取
+func (p *pushManager) lastSeq(channelId string, channelType uint8) (uint64, error) {
+	channelKey := wkutil.ChannelToKey(channelId, channelType)
+	if v, ok := p.lastSeqs.Get(channelKey); ok && time.Now().Before(v.expiredAt) {
+		return v.seq, nil
+	}
+	seq, err := p.s.store.GetChannelLastMessageSeq(channelId, channelType)
+	if err != nil {
+		return 0, err
+	}
+	p.updateLastSeq(channelId, channelType, seq)
+	return seq, nil
+}
+
+// updateLastSeq 更新缓存的频道最新消息序号，序号只增不减
+func (p *pushManager) updateLastSeq(channelId string, channelType uint8, seq uint64) {
+	channelKey := wkutil.ChannelToKey(channelId, channelType)
+	p.lastSeqMu.Lock()
+	defer p.lastSeqMu.Unlock()
+	if v, ok := p.lastSeqs.Peek(channelKey); ok && v.seq > seq {
+		seq = v.seq
+	}
+	p.lastSeqs.Add(channelKey, pushLastSeq{seq: seq, expiredAt: time.Now().Add(pushLastSeqCacheTTL)})
+}
+
+func (p *pushManager) title(msg ReactorChannelMessage) string {
+	if p.s.opts.Push.Title != "" {
+		return p.s.opts.Push.Title
+	}
+	return msg.FromUid
+}
+
+// body 从消息内容里解析出推送内容，消息内容格式为 {"content":"xxx"} 时使用content字段
+func (p *pushManager) body(msg ReactorChannelMessage) string {
+	if msg.IsEncrypt {
+		return p.s.opts.Push.Body
+	}
+	var payload struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(msg.SendPacket.Payload, &payload); err != nil || strings.TrimSpace(payload.Content) == "" {
+		return p.s.opts.Push.Body
+	}
+	return payload.Content
+}
+
+func newPushHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:   true, // APNs只支持HTTP/2
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     300 * time.Second,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// ================== APNs ==================
+
+// apnsPushProvider APNs风格的HTTP/2推送
+type apnsPushProvider struct {
+	endpoint   string
+	topic      string
+	authToken  string
+	httpClient *http.Client
+}
+
+func newAPNsPushProvider(endpoint, topic, authToken string, httpClient *http.Client) *apnsPushProvider {
+	return &apnsPushProvider{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		topic:      topic,
+		authToken:  authToken,
+		httpClient: httpClient,
+	}
+}
+
+func (a *apnsPushProvider) Name() string {
+	return PushProviderAPNs
+}
+
+func (a *apnsPushProvider) Push(ctx context.Context, req *PushRequest) error {
+	aps := map[string]interface{}{
+		"alert": map[string]string{
+			"title": req.Title,
+			"body":  req.Body,
+		},
+		"sound": "default",
+	}
+	if req.Badge >= 0 {
+		aps["badge"] = req.Badge
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"aps":          aps,
+		"channel_id":   req.ChannelId,
+		"channel_type": req.ChannelType,
+		"message_id":   strconv.FormatInt(req.MessageId, 10),
+		"message_seq":  req.MessageSeq,
+	})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/3/device/%s", a.endpoint, req.Token), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("apns-push-type", "alert")
+	httpReq.Header.Set("authorization", "bearer "+a.authToken)
+	if a.topic != "" {
+		httpReq.Header.Set("apns-topic", a.topic)
+	}
+	resp, err := a.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var result struct {
+		Reason string `json:"reason"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = json.Unmarshal(body, &result)
+	if resp.StatusCode == http.StatusGone || result.Reason == "BadDeviceToken" || result.Reason == "Unregistered" {
+		return ErrPushTokenInvalid
+	}
+	return fmt.Errorf("apns push failed, status:%d reason:%s", resp.StatusCode, result.Reason)
+}
+
+// ================== FCM ==================
+
+// fcmPushProvider FCM风格的JSON推送
+type fcmPushProvider struct {
+	endpoint   string
+	serverKey  string
+	httpClient *http.Client
+}
+
+func newFCMPushProvider(endpoint, serverKey string, httpClient *http.Client) *fcmPushProvider {
+	return &fcmPushProvider{
+		endpoint:   endpoint,
+		serverKey:  serverKey,
+		httpClient: httpClient,
+	}
+}
+
+func (f *fcmPushProvider) Name() string {
+	return PushProviderFCM
+}
+
+func (f *fcmPushProvider) Push(ctx context.Context, req *PushRequest) error {
+	pushData := map[string]string{
+		"channel_id":   req.ChannelId,
+		"channel_type": strconv.Itoa(int(req.ChannelType)),
+		"message_id":   strconv.FormatInt(req.MessageId, 10),
+		"message_seq":  strconv.FormatUint(uint64(req.MessageSeq), 10),
+	}
+	if req.Badge >= 0 {
+		pushData["badge"] = strconv.Itoa(req.Badge)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": req.Token,
+			"notification": map[string]string{
+				"title": req.Title,
+				"body":  req.Body,
+			},
+			"data": pushData, // fcm的data只支持字符串
+		},
+	})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if f.serverKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+f.serverKey)
+	}
+	resp, err := f.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var result struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = json.Unmarshal(body, &result)
+	if resp.StatusCode == http.StatusNotFound || result.Error.Status == "NOT_FOUND" || result.Error.Status == "UNREGISTERED" {
+		return ErrPushTokenInvalid
+	}
+	return fmt.Errorf("fcm push failed, status:%d message:%s", resp.StatusCode, result.Error.Message)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPNsPushProvider(t *testing.T) {
+	var (
+		proto  string
+		path   string
+		header http.Header
+		body   map[string]interface{}
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		path = r.URL.Path
+		header = r.Header
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/3/device/expired" {
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	p := newAPNsPushProvider(srv.URL, "com.example.app", "testAuthToken", srv.Client())
+	err := p.Push(context.Background(), &PushRequest{
+		Uid:         "u1",
+		DeviceFlag:  wkproto.APP,
+		Token:       "deviceToken",
+		Title:       "u2",
+		Body:        "hello",
+		Badge:       3,
+		ChannelId:   "u2",
+		ChannelType: wkproto.ChannelTypePerson,
+		MessageId:   100,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", proto)
+	assert.Equal(t, "/3/device/deviceToken", path)
+	assert.Equal(t, "bearer testAuthToken", header.Get("authorization"))
+	assert.Equal(t, "com.example.app", header.Get("apns-topic"))
+
+	aps := body["aps"].(map[string]interface{})
+	assert.Equal(t, float64(3), aps["badge"])
+	assert.Equal(t, "hello", aps["alert"].(map[string]interface{})["body"])
+	assert.Equal(t, "u2", body["channel_id"])
+
+	err = p.Push(context.Background(), &PushRequest{Token: "expired"})
+	assert.ErrorIs(t, err, ErrPushTokenInvalid)
+}
+
+func TestFCMPushProvider(t *testing.T) {
+	var (
+		header http.Header
+		body   struct {
+			Message struct {
+				Token        string            `json:"token"`
+				Notification map[string]string `json:"notification"`
+				Data         map[string]string `json:"data"`
+			} `json:"message"`
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Message.Token == "expired" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","message":"Requested entity was not found."}}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p := newFCMPushProvider(srv.URL, "testServerKey", srv.Client())
+	err := p.Push(context.Background(), &PushRequest{
+		Uid:         "u1",
+		Token:       "deviceToken",
+		Title:       "u2",
+		Body:        "hello",
+		Badge:       5,
+		ChannelId:   "g1",
+		ChannelType: wkproto.ChannelTypeGroup,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer testServerKey", header.Get("Authorization"))
+	assert.Equal(t, "deviceToken", body.Message.Token)
+	assert.Equal(t, "hello", body.Message.Notification["body"])
+	assert.Equal(t, "5", body.Message.Data["badge"])
+	assert.Equal(t, "g1", body.Message.Data["channel_id"])
+
+	err = p.Push(context.Background(), &PushRequest{Token: "expired"})
+	assert.ErrorIs(t, err, ErrPushTokenInvalid)
+}
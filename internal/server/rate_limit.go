@@ -0,0 +1,146 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.uber.org/zap"
+)
+
+// tokenBucket 令牌桶，按rate的速度补充令牌，最多存burst个令牌
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// allow 取出n个令牌，令牌不足时不取出并返回false
+// n超过桶容量时按容量计算，桶满时放行整批并取空令牌，避免一批消息数大于容量时永远被拒绝
+func (b *tokenBucket) allow(n int, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	need := math.Min(float64(n), b.burst)
+	if b.tokens < need {
+		return false
+	}
+	b.tokens -= need
+	return true
+}
+
+// setLimit 修改速率和容量，已有的令牌数不超过新的容量
+func (b *tokenBucket) setLimit(rate, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == float64(rate) && b.burst == float64(burst) {
+		return
+	}
+	b.rate = float64(rate)
+	b.burst = float64(burst)
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+// sendRateLimiter 发送消息限速，用户和频道各自一个令牌桶
+// 令牌桶只保存在本节点，用户维度按连接所在节点限速，频道维度在频道领导节点限速
+type sendRateLimiter struct {
+	s        *Server
+	users    *lru.Cache[string, *tokenBucket]
+	channels *lru.Cache[string, *tokenBucket]
+	events   *lru.Cache[string, *tokenBucket] // 用户发送临时事件的令牌桶
+	mu       sync.Mutex
+	wklog.Log
+}
+
+func newSendRateLimiter(s *Server) *sendRateLimiter {
+	l := &sendRateLimiter{
+		s:   s,
+		Log: wklog.NewWKLog("sendRateLimiter"),
+	}
+	var err error
+	if l.users, err = lru.New[string, *tokenBucket](s.opts.SendRateLimit.CacheSize); err != nil {
+		l.Panic("new user rate limit cache failed", zap.Error(err))
+	}
+	if l.channels, err = lru.New[string, *tokenBucket](s.opts.SendRateLimit.CacheSize); err != nil {
+		l.Panic("new channel rate limit cache failed", zap.Error(err))
+	}
+	if l.events, err = lru.New[string, *tokenBucket](s.opts.SendRateLimit.CacheSize); err != nil {
+		l.Panic("new event rate limit cache failed", zap.Error(err))
+	}
+	return l
+}
+
+// allowUser 用户是否可以发送n条消息
+func (l *sendRateLimiter) allowUser(uid string, n int) bool {
+	rate, burst := l.s.opts.userSendRateLimit()
+	if rate <= 0 {
+		return true
+	}
+	if l.bucket(l.users, uid, rate, burst).allow(n, time.Now()) {
+		return true
+	}
+	l.s.trace.Metrics.App().UserSendRateLimitedCountAdd(int64(n))
+	return false
+}
+
+// allowUserEvent 用户是否可以发送n个临时事件，事件和消息分开限速
+func (l *sendRateLimiter) allowUserEvent(uid string, n int) bool {
+	rate, burst := l.s.opts.Event.UserRate, l.s.opts.Event.UserBurst
+	if rate <= 0 {
+		return true
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return l.bucket(l.events, uid, rate, burst).allow(n, time.Now())
+}
+
+// allowChannel 频道是否可以发送n条消息，频道信息里设置了限速则使用频道的，否则使用全局配置
+func (l *sendRateLimiter) allowChannel(channelKey string, channelInfo wkdb.ChannelInfo, n int) bool {
+	rate, burst := l.s.opts.SendRateLimit.ChannelRate, l.s.opts.SendRateLimit.ChannelBurst
+	if channelInfo.SendRateLimit > 0 {
+		rate, burst = channelInfo.SendRateLimit, channelInfo.SendRateBurst
+	}
+	if rate <= 0 {
+		return true
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	if l.bucket(l.channels, channelKey, rate, burst).allow(n, time.Now()) {
+		return true
+	}
+	l.s.trace.Metrics.App().ChannelSendRateLimitedCountAdd(int64(n))
+	return false
+}
+
+func (l *sendRateLimiter) bucket(cache *lru.Cache[string, *tokenBucket], key string, rate, burst int) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := cache.Get(key)
+	if ok {
+		b.setLimit(rate, burst)
+		return b
+	}
+	b = newTokenBucket(rate, burst, time.Now())
+	cache.Add(key, b)
+	return b
+}
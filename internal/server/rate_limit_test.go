@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 5, now)
+
+	// 桶满时可以突发5条
+	assert.True(t, b.allow(5, now))
+	assert.False(t, b.allow(1, now))
+
+	// 100毫秒补充1个令牌
+	now = now.Add(time.Millisecond * 100)
+	assert.True(t, b.allow(1, now))
+	assert.False(t, b.allow(1, now))
+
+	// 令牌不会超过容量
+	now = now.Add(time.Second * 10)
+	assert.True(t, b.allow(5, now))
+	assert.False(t, b.allow(1, now))
+
+	// 超过容量的一批在桶满时放行，并取空令牌
+	now = now.Add(time.Second * 10)
+	assert.True(t, b.allow(6, now))
+	assert.False(t, b.allow(1, now))
+	now = now.Add(time.Millisecond * 200)
+	assert.False(t, b.allow(6, now))
+	assert.True(t, b.allow(2, now))
+
+	// 调小容量后已有令牌不超过新容量
+	now = now.Add(time.Second * 10)
+	b.setLimit(1, 2)
+	assert.True(t, b.allow(3, now))
+	assert.False(t, b.allow(1, now))
+}
+
+func TestUserSendRateLimit(t *testing.T) {
+	opts := NewOptions()
+	rate, _ := opts.userSendRateLimit()
+	assert.Equal(t, 0, rate)
+
+	opts.UserMsgQueueMaxSize = 100
+	rate, burst := opts.userSendRateLimit()
+	assert.Equal(t, 100, rate)
+	assert.Equal(t, 100, burst)
+
+	opts.SendRateLimit.UserRate = 10
+	rate, burst = opts.userSendRateLimit()
+	assert.Equal(t, 10, rate)
+	assert.Equal(t, 100, burst)
+}
+
+func TestUserEventRateLimit(t *testing.T) {
+	s := &Server{opts: NewOptions(WithEventUserRate(1, 2))}
+	l := newSendRateLimiter(s)
+
+	// 事件和消息分开限速
+	assert.True(t, l.allowUserEvent("u1", 2))
+	assert.False(t, l.allowUserEvent("u1", 1))
+	assert.True(t, l.allowUserEvent("u2", 1))
+	assert.True(t, l.allowUser("u1", 1))
+
+	s.opts.Event.UserRate = 0
+	assert.True(t, l.allowUserEvent("u1", 100))
+}
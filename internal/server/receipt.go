@@ -0,0 +1,351 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/lni/goutils/syncutil"
+	"go.uber.org/zap"
+)
+
+// receiptManager 消息回执管理
+// 成员的已读位置（recvack、清除未读等）先缓存在内存，定时批量交给频道领导节点，
+// 由频道领导节点保存已读位置，并将回执通知推送给消息发送者的在线设备
+type receiptManager struct {
+	s *Server
+
+	mu      sync.Mutex
+	pending map[string]*receiptReadedReq // channelKey -> 待处理的已读位置
+
+	notified *lru.Cache[string, uint64] // 已通知过的已读位置 key为channelKey+uid，避免重复通知
+
+	stopper *syncutil.Stopper
+	wklog.Log
+}
+
+func newReceiptManager(s *Server) *receiptManager {
+	notified, err := lru.New[string, uint64](s.opts.Receipt.CacheSize)
+	if err != nil {
+		panic(err)
+	}
+	return &receiptManager{
+		s:        s,
+		pending:  make(map[string]*receiptReadedReq),
+		notified: notified,
+		stopper:  syncutil.NewStopper(),
+		Log:      wklog.NewWKLog("receiptManager"),
+	}
+}
+
+func (r *receiptManager) start() {
+	if !r.s.opts.Receipt.On {
+		return
+	}
+	r.stopper.RunWorker(r.loop)
+}
+
+func (r *receiptManager) stop() {
+	if !r.s.opts.Receipt.On {
+		return
+	}
+	r.stopper.Stop()
+}
+
+// readed 记录成员在频道内已读到的消息序号
+func (r *receiptManager) readed(uid string, channelId string, channelType uint8, readedToSeq uint64) {
+	if !r.s.opts.Receipt.On {
+		return
+	}
+	if uid == "" || readedToSeq == 0 || r.s.opts.IsCmdChannel(channelId) || r.s.systemUIDManager.SystemUID(uid) {
+		return
+	}
+	channelKey := wkutil.ChannelToKey(channelId, channelType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req := r.pending[channelKey]
+	if req == nil {
+		req = &receiptReadedReq{
+			ChannelId:   channelId,
+			ChannelType: channelType,
+		}
+		r.pending[channelKey] = req
+	}
+	for i, cursor := range req.Cursors {
+		if cursor.Uid == uid {
+			if cursor.ReadedToSeq < readedToSeq {
+				req.Cursors[i].ReadedToSeq = readedToSeq
+			}
+			return
+		}
+	}
+	req.Cursors = append(req.Cursors, wkdb.ReadCursor{
+		Uid:         uid,
+		ReadedToSeq: readedToSeq,
+	})
+}
+
+func (r *receiptManager) loop() {
+	tk := time.NewTicker(r.s.opts.Receipt.FlushInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			r.flush()
+		case <-r.stopper.ShouldStop():
+			r.flush()
+			return
+		}
+	}
+}
+
+func (r *receiptManager) flush() {
+	r.mu.Lock()
+	if len(r.pending) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	pending := r.pending
+	r.pending = make(map[string]*receiptReadedReq)
+	r.mu.Unlock()
+
+	// 按频道领导节点分组，非本节点领导的转发给领导节点
+	nodeReqs := make(map[uint64]receiptReadedReqSet)
+	for _, req := range pending {
+		if !r.s.opts.ClusterOn() {
+			r.handleReaded(req)
+			continue
+		}
+		leader, err := r.s.cluster.LeaderOfChannelForRead(req.ChannelId, req.ChannelType)
+		if err != nil {
+			r.Warn("get channel leader failed, ignore readed", zap.Error(err), zap.String("channelId", req.ChannelId), zap.Uint8("channelType", req.ChannelType))
+			continue
+		}
+		if leader.Id == r.s.opts.Cluster.NodeId {
+			r.handleReaded(req)
+			continue
+		}
+		nodeReqs[leader.Id] = append(nodeReqs[leader.Id], req)
+	}
+
+	for nodeId, reqs := range nodeReqs {
+		if err := r.forwardReaded(nodeId, reqs); err != nil {
+			r.Error("forward readed failed", zap.Error(err), zap.Uint64("nodeId", nodeId), zap.Int("channelCount", len(reqs)))
+		}
+	}
+}
+
+func (r *receiptManager) forwardReaded(nodeId uint64, reqs receiptReadedReqSet) error {
+	data, err := reqs.Marshal()
+	if err != nil {
+		return err
+	}
+	timeoutCtx, cancel := context.WithTimeout(r.s.ctx, r.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := r.s.cluster.RequestWithContext(timeoutCtx, nodeId, "/wk/receiptReaded", data)
+	if err != nil {
+		return err
+	}
+	if resp.Status != proto.Status_OK {
+		return fmt.Errorf("forward readed failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	return nil
+}
+
+// handleReaded 保存频道成员的已读位置并通知消息发送者（本节点为频道领导节点）
+func (r *receiptManager) handleReaded(req *receiptReadedReq) {
+	err := r.s.store.UpdateReadCursors(req.ChannelId, req.ChannelType, req.Cursors)
+	if err != nil {
+		r.Error("UpdateReadCursors failed", zap.Error(err), zap.String("channelId", req.ChannelId), zap.Uint8("channelType", req.ChannelType))
+		return
+	}
+	if r.s.opts.Receipt.NotifyMaxMessages <= 0 {
+		return
+	}
+
+	channelKey := wkutil.ChannelToKey(req.ChannelId, req.ChannelType)
+	nodeNotifies := make(map[uint64]receiptNotifyReqSet)
+	for _, cursor := range req.Cursors {
+		notifiedKey := fmt.Sprintf("%s-%s", channelKey, cursor.Uid)
+		notifiedSeq, _ := r.notified.Get(notifiedKey)
+		if notifiedSeq >= cursor.ReadedToSeq {
+			continue
+		}
+		r.notified.Add(notifiedKey, cursor.ReadedToSeq)
+
+		notifies, err := r.makeNotifies(req.ChannelId, req.ChannelType, cursor, notifiedSeq)
+		if err != nil {
+			r.Error("make receipt notifies failed", zap.Error(err), zap.String("channelId", req.ChannelId), zap.Uint8("channelType", req.ChannelType), zap.String("uid", cursor.Uid))
+			continue
+		}
+		for _, notify := range notifies {
+			nodeId := r.s.opts.Cluster.NodeId
+			if r.s.opts.ClusterOn() {
+				leader, err := r.s.cluster.SlotLeaderOfChannel(notify.ToUid, wkproto.ChannelTypePerson)
+				if err != nil {
+					r.Warn("get user leader failed", zap.Error(err), zap.String("uid", notify.ToUid))
+					continue
+				}
+				nodeId = leader.Id
+			}
+			nodeNotifies[nodeId] = append(nodeNotifies[nodeId], notify)
+		}
+	}
+
+	for nodeId, notifies := range nodeNotifies {
+		if nodeId == r.s.opts.Cluster.NodeId {
+			r.deliverNotifies(notifies)
+			continue
+		}
+		if err := r.forwardNotifies(nodeId, notifies); err != nil {
+			r.Error("forward receipt notifies failed", zap.Error(err), zap.Uint64("nodeId", nodeId), zap.Int("count", len(notifies)))
+		}
+	}
+}
+
+// makeNotifies 生成成员已读位置从notifiedSeq推进到cursor.ReadedToSeq后需要通知各发送者的回执
+func (r *receiptManager) makeNotifies(channelId string, channelType uint8, cursor wkdb.ReadCursor, notifiedSeq uint64) (receiptNotifyReqSet, error) {
+	startSeq := notifiedSeq + 1
+	maxCount := uint64(r.s.opts.Receipt.NotifyMaxMessages)
+	if cursor.ReadedToSeq-notifiedSeq > maxCount { // 只通知最近的消息
+		startSeq = cursor.ReadedToSeq - maxCount + 1
+	}
+	messages, err := r.s.store.LoadNextRangeMsgs(channelId, channelType, startSeq, cursor.ReadedToSeq+1, int(maxCount))
+	if err != nil {
+		return nil, err
+	}
+
+	notifyMap := make(map[string]*receiptNotify)
+	senders := make([]string, 0)
+	for _, msg := range messages {
+		if msg.FromUID == "" || msg.FromUID == cursor.Uid || msg.IsOp() {
+			continue
+		}
+		if msg.Setting.IsSet(wkproto.SettingStream) && msg.StreamFlag != wkproto.StreamFlagStart { // 流片段不通知
+			continue
+		}
+		if r.s.systemUIDManager.SystemUID(msg.FromUID) {
+			continue
+		}
+		notify := notifyMap[msg.FromUID]
+		if notify == nil {
+			notifyChannelId := channelId
+			if channelType == wkproto.ChannelTypePerson { // 个人频道发送者看到的频道是已读的成员
+				notifyChannelId = cursor.Uid
+			}
+			notify = &receiptNotify{
+				Type:        messageReceiptNotifyType,
+				ChannelID:   notifyChannelId,
+				ChannelType: channelType,
+				Uid:         cursor.Uid,
+				ReadedToSeq: cursor.ReadedToSeq,
+			}
+			notifyMap[msg.FromUID] = notify
+			senders = append(senders, msg.FromUID)
+		}
+		notify.MessageIds = append(notify.MessageIds, msg.MessageID)
+		notify.MessageSeqs = append(notify.MessageSeqs, uint64(msg.MessageSeq))
+	}
+
+	notifies := make(receiptNotifyReqSet, 0, len(senders))
+	for _, sender := range senders {
+		notifies = append(notifies, &receiptNotifyReq{
+			ToUid:   sender,
+			Payload: []byte(wkutil.ToJSON(notifyMap[sender])),
+		})
+	}
+	return notifies, nil
+}
+
+func (r *receiptManager) forwardNotifies(nodeId uint64, notifies receiptNotifyReqSet) error {
+	data, err := notifies.Marshal()
+	if err != nil {
+		return err
+	}
+	timeoutCtx, cancel := context.WithTimeout(r.s.ctx, r.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := r.s.cluster.RequestWithContext(timeoutCtx, nodeId, "/wk/receiptNotify", data)
+	if err != nil {
+		return err
+	}
+	if resp.Status != proto.Status_OK {
+		return fmt.Errorf("forward receipt notifies failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	return nil
+}
+
+// deliverNotifies 通过投递管理将回执通知投递给发送者的在线设备（本节点为发送者的槽领导节点）
+func (r *receiptManager) deliverNotifies(notifies receiptNotifyReqSet) {
+	for _, notify := range notifies {
+		if r.s.userReactor.getUser(notify.ToUid) == nil { // 发送者不在线
+			continue
+		}
+		fakeChannelId := r.s.opts.OrginalConvertCmdChannel(GetFakeChannelIDWith(notify.ToUid, r.s.opts.SystemUID))
+		r.s.deliverManager.deliver(&deliverReq{
+			ch:          r.s.channelReactor.loadOrCreateChannel(fakeChannelId, wkproto.ChannelTypePerson),
+			channelId:   fakeChannelId,
+			channelType: wkproto.ChannelTypePerson,
+			channelKey:  wkutil.ChannelToKey(fakeChannelId, wkproto.ChannelTypePerson),
+			toUids:      []string{notify.ToUid},
+			messages: []ReactorChannelMessage{
+				{
+					FromUid:   r.s.opts.SystemUID,
+					MessageId: r.s.channelReactor.messageIDGen.Generate().Int64(),
+					SendPacket: &wkproto.SendPacket{
+						Framer: wkproto.Framer{
+							SyncOnce:  true,
+							NoPersist: true,
+						},
+						ClientMsgNo: wkutil.GenUUID(),
+						ChannelID:   notify.ToUid,
+						ChannelType: wkproto.ChannelTypePerson,
+						Payload:     notify.Payload,
+					},
+				},
+			},
+		})
+	}
+}
+
+// channelReceipts 获取频道成员（不含系统账号）和成员的已读位置，需要在频道的槽领导节点调用
+func (r *receiptManager) channelReceipts(fakeChannelId string, channelType uint8) ([]string, map[string]uint64, error) {
+	var members []string
+	if channelType == wkproto.ChannelTypePerson {
+		from, to := GetFromUIDAndToUIDWith(fakeChannelId)
+		members = []string{from, to}
+	} else {
+		subscribers, err := r.s.store.GetSubscribers(fakeChannelId, channelType)
+		if err != nil {
+			return nil, nil, err
+		}
+		members = subscribers
+	}
+	validMembers := make([]string, 0, len(members))
+	for _, member := range members {
+		if strings.TrimSpace(member) == "" || r.s.systemUIDManager.SystemUID(member) {
+			continue
+		}
+		validMembers = append(validMembers, member)
+	}
+	sort.Strings(validMembers)
+
+	cursors, err := r.s.store.GetReadCursors(fakeChannelId, channelType)
+	if err != nil {
+		return nil, nil, err
+	}
+	cursorMap := make(map[string]uint64, len(cursors))
+	for _, cursor := range cursors {
+		cursorMap[cursor.Uid] = cursor.ReadedToSeq
+	}
+	return validMembers, cursorMap, nil
+}
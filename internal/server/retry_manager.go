@@ -44,7 +44,8 @@ func (r *retryManager) addRetry(msg *retryMessage) {
 	r.retryQueues[index].startInFlightTimeout(msg)
 }
 
-func (r *retryManager) removeRetry(connId int64, messageId int64) error {
+// removeRetry 移除重试消息，返回被移除的消息
+func (r *retryManager) removeRetry(connId int64, messageId int64) (*retryMessage, error) {
 	index := messageId % int64(len(r.retryQueues))
 	return r.retryQueues[index].finishMessage(connId, messageId)
 }
@@ -85,6 +86,9 @@ type retryMessage struct {
 	uid            string // 用户id
 	connId         int64  // 需要接受的连接id
 	messageId      int64  // 消息id
+	channelId      string // 频道id（个人频道为fakeChannelId）
+	channelType    uint8  // 频道类型
+	messageSeq     uint32 // 消息序号
 	retry          int    // 重试次数
 	index          int    //在切片中的索引值
 	pri            int64  // 优先级的时间点 值越小越优先
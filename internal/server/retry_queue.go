@@ -86,14 +86,14 @@ func (r *RetryQueue) getInFlightKey(connId int64, messageId int64) string {
 	b.WriteString(strconv.FormatInt(messageId, 10))
 	return b.String()
 }
-func (r *RetryQueue) finishMessage(connId int64, messageId int64) error {
+func (r *RetryQueue) finishMessage(connId int64, messageId int64) (*retryMessage, error) {
 	msg, err := r.popInFlightMessage(connId, messageId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	r.removeFromInFlightPQ(msg)
 
-	return nil
+	return msg, nil
 }
 func (r *RetryQueue) removeFromInFlightPQ(msg *retryMessage) {
 	r.inFlightMutex.Lock()
@@ -114,7 +114,7 @@ func (r *RetryQueue) processInFlightQueue(t int64) {
 		if msg == nil {
 			break
 		}
-		err := r.finishMessage(msg.connId, msg.messageId)
+		_, err := r.finishMessage(msg.connId, msg.messageId)
 		if err != nil {
 			r.Error("processInFlightQueue-finishMessage失败", zap.Error(err), zap.Int64("connId", msg.connId), zap.Int64("messageId", msg.messageId))
 			break
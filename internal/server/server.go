@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -21,6 +22,7 @@ import (
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wknet"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wktls"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
 	"github.com/WuKongIM/WuKongIM/version"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
@@ -54,12 +56,23 @@ type Server struct {
 	managerServer *ManagerServer // 管理者api服务
 
 	systemUIDManager *SystemUIDManager // 系统账号管理
+	datasource       IDatasource       // 第三方数据源
 
 	tagManager     *tagManager     // tag管理，用来管理频道订阅者的tag，用于快速查找订阅者所在节点
 	deliverManager *deliverManager // 消息投递管理
 	retryManager   *retryManager   // 消息重试管理
 
+	sendRateLimiter *sendRateLimiter // 发送消息限速
+	pushManager     *pushManager     // 离线推送管理
+	receiptManager  *receiptManager  // 消息回执管理
+	eventManager    *eventManager    // 临时事件管理
+	presenceManager *presenceManager // 在线状态订阅管理
+
 	conversationManager *ConversationManager // 会话管理
+
+	deviceTokenVerifier *deviceTokenVerifier // 设备token（jwt）校验，设备token认证方式为jwt时才有
+	apiKeyManager       *apiKeyManager       // http api密钥管理
+	tenantManager       *tenantManager       // 多租户管理
 }
 
 func New(opts *Options) *Server {
@@ -100,6 +113,10 @@ func New(opts *Options) *Server {
 	storeOpts.GetSlotId = s.getSlotId
 	storeOpts.IsCmdChannel = opts.IsCmdChannel
 	storeOpts.Db.ShardNum = s.opts.Db.ShardNum
+	storeOpts.Db.ExpireCheckInterval = s.opts.Db.ExpireCheckInterval
+	storeOpts.Db.MessageSearchIndexOn = s.opts.Db.MessageSearchIndexOn
+	storeOpts.OnPayloadRemoved = s.onPayloadRemoved
+	storeOpts.ReqTimeout = s.opts.Cluster.ReqTimeout
 	s.store = clusterstore.NewStore(storeOpts)
 
 	// 初始化tag管理
@@ -110,6 +127,7 @@ func New(opts *Options) *Server {
 		wknet.WithAddr(s.opts.Addr),
 		wknet.WithWSAddr(s.opts.WSAddr),
 		wknet.WithWSSAddr(s.opts.WSSAddr),
+		wknet.WithMQTTAddr(s.opts.MQTT.Addr),
 		wknet.WithWSTLSConfig(s.opts.WSTLSConfig),
 		wknet.WithOnReadBytes(func(n int) {
 			trace.GlobalTrace.Metrics.System().ExtranetIncomingAdd(int64(n))
@@ -122,11 +140,26 @@ func New(opts *Options) *Server {
 	s.channelReactor = newChannelReactor(s, opts)     // 频道的reactor
 	s.userReactor = newUserReactor(s)                 // 用户的reactor
 	s.demoServer = NewDemoServer(s)                   // demo server
+	s.datasource = NewDatasource(s)                   // 第三方数据源
 	s.systemUIDManager = NewSystemUIDManager(s)       // 系统账号管理
 	s.apiServer = NewAPIServer(s)                     // api服务
 	s.managerServer = NewManagerServer(s)             // 管理者的api服务
 	s.retryManager = newRetryManager(s)               // 消息重试管理
 	s.conversationManager = NewConversationManager(s) // 会话管理
+	s.sendRateLimiter = newSendRateLimiter(s)         // 发送消息限速
+	s.pushManager = newPushManager(s)                 // 离线推送管理
+	s.receiptManager = newReceiptManager(s)           // 消息回执管理
+	s.eventManager = newEventManager(s)               // 临时事件管理
+	s.presenceManager = newPresenceManager(s)         // 在线状态订阅管理
+	s.apiKeyManager = newAPIKeyManager(s)             // http api密钥管理
+	s.tenantManager = newTenantManager(s)             // 多租户管理
+
+	if s.opts.TokenAuthOn && s.opts.DeviceToken.Mode == DeviceTokenModeJWT {
+		s.deviceTokenVerifier, err = newDeviceTokenVerifier(s)
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	// 初始化分布式服务
 	initNodes := make(map[uint64]string)
@@ -152,16 +185,28 @@ func New(opts *Options) *Server {
 			cluster.WithServerAddr(s.opts.Cluster.ServerAddr),
 			cluster.WithMessageLogStorage(s.store.GetMessageShardLogStorage()),
 			cluster.WithApiServerAddr(s.opts.Cluster.APIUrl),
+			cluster.WithZone(s.opts.Cluster.Zone),
+			cluster.WithRack(s.opts.Cluster.Rack),
+			cluster.WithPreferredLeaderZones(s.opts.Cluster.PreferredLeaderZones),
 			cluster.WithChannelMaxReplicaCount(s.opts.Cluster.ChannelReplicaCount),
 			cluster.WithSlotMaxReplicaCount(uint32(s.opts.Cluster.SlotReplicaCount)),
 			cluster.WithLogLevel(s.opts.Logger.Level),
 			cluster.WithAppVersion(version.Version),
 			cluster.WithDB(s.store.DB()),
 			cluster.WithSlotDbShardNum(s.opts.Db.ShardNum),
+			cluster.WithOnChannelApply(s.store.ApplyMessages),
 			cluster.WithOnSlotApply(func(slotId uint32, logs []replica.Log) error {
 
 				return s.store.OnMetaApply(slotId, logs)
 			}),
+			cluster.WithOnSlotSnapshot(func(slotId uint32) (cluster.SlotSnapshot, error) {
+				return s.store.SlotSnapshot(slotId), nil
+			}),
+			cluster.WithOnSlotInstallSnapshot(func(slotId uint32, r io.Reader) error {
+				return s.store.InstallSlotSnapshot(slotId, r)
+			}),
+			cluster.WithSlotLogCompactInterval(s.opts.Cluster.SlotLogCompactInterval),
+			cluster.WithSlotLogRetainCount(uint64(s.opts.Cluster.SlotLogRetainCount)),
 			cluster.WithChannelClusterStorage(clusterstore.NewChannelClusterConfigStore(s.store)),
 			cluster.WithElectionIntervalTick(s.opts.Cluster.ElectionIntervalTick),
 			cluster.WithHeartbeatIntervalTick(s.opts.Cluster.HeartbeatIntervalTick),
@@ -170,6 +215,13 @@ func New(opts *Options) *Server {
 			cluster.WithSlotReactorSubCount(s.opts.Cluster.SlotReactorSubCount),
 			cluster.WithPongMaxTick(s.opts.Cluster.PongMaxTick),
 			cluster.WithAuth(s.opts.Auth),
+			cluster.WithTLS(s.opts.Cluster.TLS.On, wktls.Options{
+				CAFile:         s.opts.Cluster.TLS.CAFile,
+				CertFile:       s.opts.Cluster.TLS.CertFile,
+				KeyFile:        s.opts.Cluster.TLS.KeyFile,
+				ReloadInterval: s.opts.Cluster.TLS.ReloadInterval,
+			}),
+			cluster.WithSecret(s.opts.Cluster.Secret),
 		),
 
 		// cluster.WithOnChannelMetaApply(func(channelID string, channelType uint8, logs []replica.Log) error {
@@ -223,6 +275,9 @@ func (s *Server) Start() error {
 	if s.opts.WSSAddr != "" {
 		s.Info(fmt.Sprintf("Listening  for WSS client on %s", s.opts.WSSAddr))
 	}
+	if s.opts.MQTT.Addr != "" {
+		s.Info(fmt.Sprintf("Listening  for MQTT client on %s", s.opts.MQTT.Addr))
+	}
 	s.Info(fmt.Sprintf("Listening  for Manager http api on %s", fmt.Sprintf("http://%s", s.opts.HTTPAddr)))
 
 	if s.opts.Manager.On {
@@ -298,6 +353,14 @@ func (s *Server) Start() error {
 
 	s.conversationManager.Start()
 
+	s.webhook.Start()
+
+	s.receiptManager.start()
+
+	s.presenceManager.start()
+
+	s.tenantManager.start()
+
 	return nil
 }
 
@@ -315,6 +378,12 @@ func (s *Server) Stop() error {
 	s.deliverManager.stop()
 
 	s.retryManager.stop()
+	s.receiptManager.stop()
+	s.eventManager.stop()
+	s.presenceManager.stop()
+	s.tenantManager.stop()
+	s.webhook.Stop()
+	s.pushManager.stop()
 	s.conversationManager.Stop()
 	s.cluster.Stop()
 	s.apiServer.Stop()
@@ -367,11 +436,27 @@ func (s *Server) MigrateSlot(slotId uint32, fromNodeId, toNodeId uint64) error {
 	return s.clusterServer.MigrateSlot(slotId, fromNodeId, toNodeId)
 }
 
+// RegisterPushProvider 注册离线推送服务商，同名的服务商将被替换
+func (s *Server) RegisterPushProvider(provider PushProvider) {
+	s.pushManager.register(provider)
+}
+
 func (s *Server) getSlotId(v string) uint32 {
 	return s.cluster.GetSlotId(v)
 }
 
+// onPayloadRemoved 消息内容被清理（过期、撤回），在存储的回调里执行，只入队不做耗时操作
+func (s *Server) onPayloadRemoved(channelId string, channelType uint8, bytes int64) {
+	if !s.opts.Tenant.On {
+		return
+	}
+	s.tenantManager.payloadRemoved(channelId, channelType, bytes)
+}
+
 func (s *Server) onData(conn wknet.Conn) error {
+	if _, ok := conn.(wknet.IMQTTConn); ok { // mqtt连接
+		return s.onMQTTData(conn)
+	}
 	buff, err := conn.Peek(-1)
 	if err != nil {
 		return err
@@ -395,6 +480,11 @@ func (s *Server) onData(conn wknet.Conn) error {
 	}
 
 	if !isAuth {
+		if connCtx != nil { // 已经收到过连接包，认证完成之前不能再发送任何包
+			s.Warn("received packet before auth finished,conn will be closed", zap.String("uid", connCtx.uid))
+			conn.Close()
+			return nil
+		}
 		packet, _, err := s.opts.Proto.DecodeFrame(data, wkproto.LatestVersion)
 		if err != nil {
 			s.Warn("Failed to decode the message,conn will be closed", zap.Error(err))
@@ -435,6 +525,17 @@ func (s *Server) onData(conn wknet.Conn) error {
 		connCtx = newConnContext(connInfo, conn, sub)
 		conn.SetContext(connCtx)
 
+		// 租户校验（uid需要属于已配置的租户，并且租户的连接数没有超限）
+		appId, reasonCode := s.tenantManager.connect(connectPacket.UID)
+		if reasonCode != wkproto.ReasonSuccess {
+			s.Warn("tenant refused the conn,conn will be closed", zap.String("uid", connectPacket.UID), zap.String("reasonCode", reasonCode.String()))
+			_ = connCtx.writeDirectlyPacket(&wkproto.ConnackPacket{ReasonCode: reasonCode})
+			_, _ = conn.Discard(len(data))
+			conn.Close()
+			return nil
+		}
+		connCtx.appId = appId
+
 		s.userReactor.addConnContext(connCtx)
 
 		connCtx.addConnectPacket(connectPacket)
@@ -479,6 +580,9 @@ func (s *Server) onClose(conn wknet.Conn) {
 	if connCtxObj != nil {
 		connCtx := connCtxObj.(*connContext)
 		s.userReactor.removeConnContextById(connCtx.uid, connCtx.connId)
+		if connCtx.appId != "" {
+			s.tenantManager.disconnect(connCtx.appId)
+		}
 
 		if connCtx.isAuth.Load() {
 			deviceOnlineCount := s.userReactor.getConnContextCountByDeviceFlag(connCtx.uid, connCtx.deviceFlag)
@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"time"
 
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
@@ -55,6 +57,24 @@ func (s *Server) setClusterRoutes() {
 	s.cluster.Route("/wk/getNodeUidsByTag", s.getNodeUidsByTag)
 	// 是否允许发送消息
 	s.cluster.Route("/wk/allowSend", s.handleAllowSend)
+	// 临时事件（转发给频道领导节点）
+	s.cluster.Route("/wk/channelEvent", s.handleChannelEvent)
+	// 成员已读位置（转发给频道领导节点）
+	s.cluster.Route("/wk/receiptReaded", s.handleReceiptReaded)
+	// 回执通知（转发给消息发送者的槽领导节点）
+	s.cluster.Route("/wk/receiptNotify", s.handleReceiptNotify)
+	// 在线状态订阅（转发给被订阅用户的领导节点）
+	s.cluster.Route("/wk/presenceSubscribe", s.handlePresenceSubscribe)
+	// 清除数据源缓存（广播给所有节点）
+	s.cluster.Route("/wk/datasourceInvalidate", s.handleDatasourceInvalidate)
+	// 获取http api密钥（转发给密钥所在槽的领导节点）
+	s.cluster.Route("/wk/apiKeyGet", s.handleAPIKeyGet)
+	// 清除http api密钥缓存（广播给所有节点）
+	s.cluster.Route("/wk/apiKeyInvalidate", s.handleAPIKeyInvalidate)
+	// 获取租户的资源使用量（本节点为租户所在槽的领导节点）
+	s.cluster.Route("/wk/tenantUsage", s.handleTenantUsage)
+	// 获取频道最后一条消息的序号（本节点为频道领导节点）
+	s.cluster.Route("/wk/channelLastMsgSeq", s.handleChannelLastMsgSeq)
 
 }
 
@@ -90,7 +110,7 @@ func (s *Server) handleChannelForward(c *wkserver.Context) {
 		sendPacket := reactorChannelMessage.SendPacket
 		// 提案频道消息
 		ch := s.channelReactor.loadOrCreateChannel(req.ChannelId, req.ChannelType)
-		_, err = ch.proposeSend(reactorChannelMessage.FromUid, reactorChannelMessage.FromDeviceId, reactorChannelMessage.FromConnId, reactorChannelMessage.FromNodeId, false, sendPacket)
+		_, err = ch.proposeStreamSend(reactorChannelMessage.FromUid, reactorChannelMessage.FromDeviceId, reactorChannelMessage.FromConnId, reactorChannelMessage.FromNodeId, false, reactorChannelMessage.StreamFlag, sendPacket)
 		if err != nil {
 			s.Error("handleChannelForward: proposeSend failed")
 			c.WriteErr(err)
@@ -178,6 +198,11 @@ func (s *Server) handleUserAction(c *wkserver.Context) {
 	}
 	// actions 是同一批uid的操作，所以这里取第一个action的uid判断即可
 	firstAction := actions[0]
+	if firstAction.ActionType == UserActionPresence { // 在线状态通知是多个订阅者的，直接投递给本节点在线的订阅者
+		s.presenceManager.handlePresenceActions(actions)
+		c.WriteOk()
+		return
+	}
 	uid := firstAction.Uid
 	leaderId, err := s.cluster.SlotLeaderIdOfChannel(uid, wkproto.ChannelTypePerson)
 	if err != nil {
@@ -479,3 +504,167 @@ func (s *Server) handleAllowSend(c *wkserver.Context) {
 	}
 	c.WriteErrorAndStatus(errors.New("not allow send"), proto.Status(reasonCode))
 }
+
+func (s *Server) handleReceiptReaded(c *wkserver.Context) {
+	var reqs receiptReadedReqSet
+	err := reqs.Unmarshal(c.Body())
+	if err != nil {
+		s.Error("handleReceiptReaded Unmarshal err", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	for _, req := range reqs {
+		for _, cursor := range req.Cursors {
+			s.receiptManager.readed(cursor.Uid, req.ChannelId, req.ChannelType, cursor.ReadedToSeq)
+		}
+	}
+	c.WriteOk()
+}
+
+func (s *Server) handleReceiptNotify(c *wkserver.Context) {
+	var notifies receiptNotifyReqSet
+	err := notifies.Unmarshal(c.Body())
+	if err != nil {
+		s.Error("handleReceiptNotify Unmarshal err", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	s.receiptManager.deliverNotifies(notifies)
+	c.WriteOk()
+}
+
+func (s *Server) handlePresenceSubscribe(c *wkserver.Context) {
+	req := &presenceSubscribeReq{}
+	err := req.Unmarshal(c.Body())
+	if err != nil {
+		s.Error("handlePresenceSubscribe Unmarshal err", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	statuses, err := s.presenceManager.handleSubscribe(req)
+	if err != nil {
+		s.Error("handlePresenceSubscribe err", zap.Error(err), zap.String("subscriber", req.Subscriber))
+		c.WriteErr(err)
+		return
+	}
+	data, err := statuses.Marshal()
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+}
+
+func (s *Server) handleChannelEvent(c *wkserver.Context) {
+	var msg ReactorChannelMessage
+	err := msg.Unmarshal(c.Body())
+	if err != nil {
+		s.Error("handleChannelEvent Unmarshal err", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	if msg.SendPacket == nil {
+		c.WriteErr(errors.New("sendPacket is nil"))
+		return
+	}
+	fakeChannelId := msg.SendPacket.ChannelID
+	if msg.SendPacket.ChannelType == wkproto.ChannelTypePerson {
+		fakeChannelId = GetFakeChannelIDWith(msg.FromUid, msg.SendPacket.ChannelID)
+	}
+	reasonCode := s.eventManager.handleEvent(fakeChannelId, msg.SendPacket.ChannelType, msg)
+	if reasonCode == wkproto.ReasonSuccess {
+		c.WriteOk()
+		return
+	}
+	c.WriteErrorAndStatus(errors.New("event not allow send"), proto.Status(reasonCode))
+}
+
+func (s *Server) handleDatasourceInvalidate(c *wkserver.Context) {
+	req := &datasourceInvalidateReq{}
+	if err := wkutil.ReadJSONByByte(c.Body(), req); err != nil {
+		s.Error("handleDatasourceInvalidate Unmarshal err", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	s.invalidateDatasource(req.ChannelID, req.ChannelType)
+	c.WriteOk()
+}
+
+func (s *Server) handleAPIKeyGet(c *wkserver.Context) {
+	apiKey, err := s.store.GetAPIKey(string(c.Body()))
+	if err != nil {
+		if err == wkdb.ErrNotFound {
+			c.WriteErrorAndStatus(err, proto.Status_NotFound)
+			return
+		}
+		s.Error("handleAPIKeyGet: get api key failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	data, err := apiKey.Marshal()
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+}
+
+func (s *Server) handleAPIKeyInvalidate(c *wkserver.Context) {
+	s.apiKeyManager.invalidate(string(c.Body()))
+	c.WriteOk()
+}
+
+func (s *Server) handleTenantUsage(c *wkserver.Context) {
+	usage, err := s.store.GetTenantUsage(string(c.Body()))
+	if err != nil {
+		s.Error("handleTenantUsage: get tenant usage failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	data, err := usage.Marshal()
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+}
+
+func (s *Server) handleChannelLastMsgSeq(c *wkserver.Context) {
+	req := &channelLastMsgSeqReq{}
+	if err := req.Unmarshal(c.Body()); err != nil {
+		s.Error("handleChannelLastMsgSeq: unmarshal failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	lastMsgSeq, err := s.store.GetLastMsgSeq(req.ChannelId, req.ChannelType)
+	if err != nil {
+		s.Error("handleChannelLastMsgSeq: get last msg seq failed", zap.Error(err), zap.String("channelId", req.ChannelId), zap.Uint8("channelType", req.ChannelType))
+		c.WriteErr(err)
+		return
+	}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, lastMsgSeq)
+	c.Write(data)
+}
+
+// broadcastRequest 将请求发送给其他所有节点（未开启分布式时不发送），失败只记录日志
+func (s *Server) broadcastRequest(path string, data []byte) {
+	if !s.opts.ClusterOn() {
+		return
+	}
+	for _, node := range s.cluster.Nodes() {
+		if node.Id == s.opts.Cluster.NodeId {
+			continue
+		}
+		timeoutCtx, cancel := context.WithTimeout(s.ctx, s.opts.Cluster.ReqTimeout)
+		resp, err := s.cluster.RequestWithContext(timeoutCtx, node.Id, path, data)
+		cancel()
+		if err != nil {
+			s.Warn("broadcast request failed", zap.Error(err), zap.String("path", path), zap.Uint64("nodeId", node.Id))
+			continue
+		}
+		if resp.Status != proto.Status_OK {
+			s.Warn("broadcast request failed", zap.String("path", path), zap.Uint64("nodeId", node.Id), zap.String("err", string(resp.Body)))
+		}
+	}
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"net/http"
-	"strings"
 
 	cluster "github.com/WuKongIM/WuKongIM/pkg/cluster/clusterserver"
 	"github.com/WuKongIM/WuKongIM/pkg/trace"
@@ -41,18 +40,8 @@ func NewAPIServer(s *Server) *APIServer {
 // Start 开始
 func (s *APIServer) Start() {
 
-	s.r.Use(func(c *wkhttp.Context) { // 管理者权限判断
-		if strings.TrimSpace(s.s.opts.ManagerToken) == "" {
-			c.Next()
-			return
-		}
-		managerToken := c.GetHeader("token")
-		if managerToken != s.s.opts.ManagerToken {
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		c.Next()
-	})
+	// 管理者token和api密钥的认证鉴权
+	s.r.Use(s.apiAuthMiddleware())
 
 	// 跨域
 	s.r.Use(wkhttp.CORSMiddleware())
@@ -106,6 +95,10 @@ func (s *APIServer) setRoutes() {
 	routeapi := NewRouteAPI(s.s)
 	routeapi.Route(s.r)
 
+	// api密钥
+	apiKeyAPI := NewAPIKeyAPI(s.s)
+	apiKeyAPI.Route(s.r)
+
 	// 分布式api
 	clusterServer, ok := s.s.cluster.(*cluster.Server)
 	if ok {
@@ -40,8 +40,10 @@ func (m *ManagerServer) Start() {
 	m.r.Use(wkhttp.CORSMiddleware())
 	// jwt和token认证中间件
 	m.r.Use(m.jwtAndTokenAuthMiddleware())
+	// 资源权限校验
+	m.r.Use(m.permissionMiddleware())
 
-	m.r.GetGinRoute().Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/metrics"})))
+	m.r.GetGinRoute().Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/metrics", "/backup", "/manager/export"})))
 
 	st, _ := fs.Sub(version.WebFs, "web/dist")
 	m.r.GetGinRoute().NoRoute(func(c *gin.Context) {
@@ -90,6 +92,18 @@ func (m *ManagerServer) setRoutes() {
 	manager := NewManagerAPI(m.s)
 	manager.Route(m.r)
 
+	// webhook事件管理api
+	webhookAPI := NewWebhookAPI(m.s)
+	webhookAPI.Route(m.r)
+
+	// 备份api
+	backupAPI := NewBackupAPI(m.s)
+	backupAPI.Route(m.r)
+
+	// 数据导入导出api
+	exportAPI := NewExportAPI(m.s)
+	exportAPI.Route(m.r)
+
 	// // 系统api
 	// system := NewSystemAPI(s.s)
 	// system.Route(s.r)
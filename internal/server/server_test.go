@@ -2,12 +2,14 @@ package server
 
 import (
 	"context"
+	"net"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/client"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/WuKongIM/WuKongIM/pkg/mqtt"
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
@@ -61,6 +63,87 @@ func TestSingleSendMessage(t *testing.T) {
 
 }
 
+// 测试mqtt客户端与悟空客户端互发消息
+func TestMQTTSendMessage(t *testing.T) {
+	s := NewTestServer(t, WithMQTTAddr("tcp://127.0.0.1:11883"))
+	s.opts.Mode = TestMode
+	err := s.Start()
+	assert.Nil(t, err)
+	defer s.StopNoErr()
+
+	s.MustWaitClusterReady() // 等待服务准备好
+
+	// mqtt client test2
+	conn, err := net.Dial("tcp", s.engine.MQTTRealListenAddr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	writePacket := func(packet mqtt.ControlPacket) {
+		data, err := mqtt.EncodePacket(packet)
+		assert.Nil(t, err)
+		_, err = conn.Write(data)
+		assert.Nil(t, err)
+	}
+	readPacket := func() mqtt.ControlPacket {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		packet, err := mqtt.ReadFrom(conn, mqtt.Version5)
+		assert.Nil(t, err)
+		return packet
+	}
+
+	writePacket(&mqtt.ConnectPacket{ProtocolName: "MQTT", Version: mqtt.Version5, CleanStart: true, KeepAlive: 30, ClientID: "test2"})
+	connack := readPacket().(*mqtt.ConnackPacket)
+	assert.Equal(t, mqtt.Success, connack.ReasonCode)
+
+	writePacket(&mqtt.SubscribePacket{Version: mqtt.Version5, PacketID: 1, Subscriptions: []mqtt.Subscription{{Topic: "1/+", QoS: 1}}})
+	suback := readPacket().(*mqtt.SubackPacket)
+	assert.Equal(t, []mqtt.ReasonCode{mqtt.GrantedQoS1}, suback.ReasonCodes)
+
+	// wukong client test1
+	cli1 := client.New(s.opts.External.TCPAddr, client.WithUID("test1"))
+	err = cli1.Connect()
+	assert.Nil(t, err)
+
+	var wait sync.WaitGroup
+	wait.Add(1)
+	cli1.SetOnRecv(func(recv *wkproto.RecvPacket) error {
+		assert.Equal(t, "hi", string(recv.Payload))
+		wait.Done()
+		return nil
+	})
+
+	// test1 -> test2
+	err = cli1.SendMessage(client.NewChannel("test2", 1), []byte("hello"))
+	assert.Nil(t, err)
+
+	publish := readPacket().(*mqtt.PublishPacket)
+	assert.Equal(t, "1/test1", publish.Topic)
+	assert.Equal(t, "hello", string(publish.Payload))
+	assert.Equal(t, byte(1), publish.QoS)
+	assert.Equal(t, "test1", publish.Properties.GetUser("from_uid"))
+	writePacket(&mqtt.PubackPacket{Version: mqtt.Version5, PacketID: publish.PacketID})
+
+	// test2 -> test1
+	writePacket(&mqtt.PublishPacket{Version: mqtt.Version5, QoS: 1, PacketID: 10, Topic: "1/test1", Payload: []byte("hi")})
+	puback := readPacket().(*mqtt.PubackPacket)
+	assert.Equal(t, uint16(10), puback.PacketID)
+	assert.Equal(t, mqtt.Success, puback.ReasonCode)
+
+	wait.Wait()
+}
+
+func TestParseMQTTTopic(t *testing.T) {
+	channelId, channelType, ok := parseMQTTTopic("2/group1")
+	assert.True(t, ok)
+	assert.Equal(t, "group1", channelId)
+	assert.Equal(t, uint8(2), channelType)
+
+	for _, topic := range []string{"group1", "0/group1", "a/group1", "2/", "2/+"} {
+		_, _, ok = parseMQTTTopic(topic)
+		assert.False(t, ok, topic)
+	}
+}
+
 func TestClusterSendMessage(t *testing.T) {
 	s1, s2 := NewTestClusterServerTwoNode(t)
 	err := s1.Start()
@@ -19,7 +19,7 @@ func NewSystemUIDManager(s *Server) *SystemUIDManager {
 
 	return &SystemUIDManager{
 		s:          s,
-		datasource: NewDatasource(s),
+		datasource: s.datasource,
 		systemUIDs: sync.Map{},
 	}
 }
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/lni/goutils/syncutil"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// 租户id与uid、频道id的分隔符，开启多租户后uid和频道id的格式为 <appId>:<id>
+const tenantSeparator = ":"
+
+type tenant struct {
+	app           TenantApp
+	connCount     atomic.Int64 // 本节点的连接数
+	messageBucket *tokenBucket // 发送消息的令牌桶，为nil表示不限速
+
+	mu             sync.Mutex
+	storagePending int64 // 本节点存储了但还没提交的消息字节数
+	storageUsed    int64 // 最近一次从租户所在槽获取的已存储消息字节数
+}
+
+func (t *tenant) storageExceeded() bool {
+	if t.app.MaxStorage <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.storageUsed+t.storagePending >= t.app.MaxStorage
+}
+
+// tenantManager 多租户管理
+// 连接数在连接所在节点限制，发送速率在频道领导节点限制，
+// 存储用量由频道领导节点定时提交到租户id所在的槽，各节点定时从槽领导节点刷新
+type tenantManager struct {
+	s       *Server
+	tenants map[string]*tenant // appId -> 租户
+
+	removedMu sync.Mutex
+	removed   map[string]*payloadRemoved // 待计入的消息内容清理，按频道合并
+	removedC  chan struct{}
+
+	stopper *syncutil.Stopper
+	wklog.Log
+}
+
+type payloadRemoved struct {
+	channelId   string
+	channelType uint8
+	bytes       int64
+}
+
+func newTenantManager(s *Server) *tenantManager {
+	t := &tenantManager{
+		s:        s,
+		tenants:  make(map[string]*tenant),
+		removed:  make(map[string]*payloadRemoved),
+		removedC: make(chan struct{}, 1),
+		stopper:  syncutil.NewStopper(),
+		Log:      wklog.NewWKLog("tenantManager"),
+	}
+	if !s.opts.Tenant.On {
+		return t
+	}
+	for _, app := range s.opts.Tenant.Apps {
+		tn := &tenant{app: app}
+		if app.MessageRate > 0 {
+			tn.messageBucket = newTokenBucket(app.MessageRate, app.MessageRate, time.Now())
+		}
+		t.tenants[app.AppId] = tn
+	}
+	return t
+}
+
+func (t *tenantManager) start() {
+	if !t.s.opts.Tenant.On {
+		return
+	}
+	t.stopper.RunWorker(t.loop)
+	t.stopper.RunWorker(t.loopRemoved)
+}
+
+func (t *tenantManager) stop() {
+	if !t.s.opts.Tenant.On {
+		return
+	}
+	t.stopper.Stop()
+	t.handleRemoved()
+	t.flushStorage()
+}
+
+func (t *tenantManager) loop() {
+	tk := time.NewTicker(t.s.opts.Tenant.UsageSyncInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			t.flushStorage()
+			t.refreshStorage()
+		case <-t.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+func (t *tenantManager) get(appId string) *tenant {
+	return t.tenants[appId]
+}
+
+// connect 连接的uid是否属于已配置的租户以及租户的连接数是否超限，通过后计入连接数并返回租户id
+func (t *tenantManager) connect(uid string) (string, wkproto.ReasonCode) {
+	if !t.s.opts.Tenant.On || uid == t.s.opts.ManagerUID {
+		return "", wkproto.ReasonSuccess
+	}
+	appId := t.s.opts.AppIdOf(uid)
+	tn := t.get(appId)
+	if tn == nil {
+		return "", wkproto.ReasonAuthFail
+	}
+	if tn.app.MaxConnections > 0 && tn.connCount.Load() >= int64(tn.app.MaxConnections) {
+		return "", wkproto.ReasonRateLimit
+	}
+	tn.connCount.Inc()
+	t.s.trace.Metrics.App().TenantConnCountAdd(appId, 1)
+	return appId, wkproto.ReasonSuccess
+}
+
+// disconnect 连接关闭，从租户的连接数中减去
+func (t *tenantManager) disconnect(appId string) {
+	tn := t.get(appId)
+	if tn == nil {
+		return
+	}
+	tn.connCount.Dec()
+	t.s.trace.Metrics.App().TenantConnCountAdd(appId, -1)
+}
+
+// allowSend 频道领导节点判断消息是否可以发送：发送者和频道（个人频道的双方）必须属于同一个租户，并且租户没有超过发送速率和存储用量
+func (t *tenantManager) allowSend(fromUid string, channelId string, channelType uint8, messages []ReactorChannelMessage) wkproto.ReasonCode {
+	if !t.s.opts.Tenant.On {
+		return wkproto.ReasonSuccess
+	}
+	appId := t.s.opts.AppIdOf(channelId)
+	systemUid := fromUid == "" || t.s.systemUIDManager.SystemUID(fromUid)
+	if !systemUid && t.s.opts.AppIdOf(fromUid) != appId {
+		return wkproto.ReasonNotAllowSend
+	}
+	if !systemUid && channelType == wkproto.ChannelTypePerson {
+		uid1, uid2 := GetFromUIDAndToUIDWith(channelId)
+		if t.s.opts.AppIdOf(uid1) != appId || t.s.opts.AppIdOf(uid2) != appId {
+			return wkproto.ReasonNotAllowSend
+		}
+	}
+	tn := t.get(appId)
+	if tn == nil {
+		if systemUid { // 系统账号可以给不属于租户的频道发消息
+			return wkproto.ReasonSuccess
+		}
+		return wkproto.ReasonNotAllowSend
+	}
+
+	n := len(messages)
+	if tn.storageExceeded() {
+		t.s.trace.Metrics.App().TenantStorageLimitedCountAdd(appId, int64(n))
+		return wkproto.ReasonNotAllowSend
+	}
+	if !systemUid && tn.messageBucket != nil && !tn.messageBucket.allow(n, time.Now()) {
+		t.s.trace.Metrics.App().TenantRateLimitedCountAdd(appId, int64(n))
+		return wkproto.ReasonRateLimit
+	}
+	var bytes int64
+	for _, msg := range messages {
+		if msg.SendPacket != nil {
+			bytes += int64(len(msg.SendPacket.Payload))
+		}
+	}
+	t.s.trace.Metrics.App().TenantSendMessageCountAdd(appId, int64(n))
+	t.s.trace.Metrics.App().TenantSendMessageBytesAdd(appId, bytes)
+	return wkproto.ReasonSuccess
+}
+
+// addStorage 频道的消息存储成功后记录租户的存储用量
+func (t *tenantManager) addStorage(channelId string, messages []wkdb.Message) {
+	tn := t.get(t.s.opts.AppIdOf(channelId))
+	if tn == nil {
+		return
+	}
+	var bytes int64
+	for _, msg := range messages {
+		bytes += int64(len(msg.Payload))
+	}
+	if bytes == 0 {
+		return
+	}
+	tn.mu.Lock()
+	tn.storagePending += bytes
+	tn.mu.Unlock()
+}
+
+// payloadRemoved 消息内容被清理（过期、撤回）后放入队列，异步判断领导节点后计入，不阻塞存储的回调
+func (t *tenantManager) payloadRemoved(channelId string, channelType uint8, bytes int64) {
+	if bytes <= 0 || t.get(t.s.opts.AppIdOf(channelId)) == nil {
+		return
+	}
+	channelKey := wkutil.ChannelToKey(channelId, channelType)
+	t.removedMu.Lock()
+	if r := t.removed[channelKey]; r != nil {
+		r.bytes += bytes
+	} else {
+		t.removed[channelKey] = &payloadRemoved{channelId: channelId, channelType: channelType, bytes: bytes}
+	}
+	t.removedMu.Unlock()
+	select {
+	case t.removedC <- struct{}{}:
+	default:
+	}
+}
+
+func (t *tenantManager) loopRemoved() {
+	for {
+		select {
+		case <-t.removedC:
+			t.handleRemoved()
+		case <-t.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+// handleRemoved 每个副本都会清理消息内容，只在频道领导节点计入租户的存储用量，和存储时一致
+func (t *tenantManager) handleRemoved() {
+	t.removedMu.Lock()
+	removed := t.removed
+	t.removed = make(map[string]*payloadRemoved)
+	t.removedMu.Unlock()
+
+	for _, r := range removed {
+		if t.s.opts.ClusterOn() {
+			leader, err := t.s.cluster.LeaderOfChannelForRead(r.channelId, r.channelType)
+			if err != nil || leader == nil || leader.Id != t.s.opts.Cluster.NodeId {
+				continue
+			}
+		}
+		t.removeStorage(r.channelId, r.bytes)
+	}
+}
+
+// removeStorage 频道的消息内容被清理（过期、撤回）后从租户的存储用量中减去
+func (t *tenantManager) removeStorage(channelId string, bytes int64) {
+	tn := t.get(t.s.opts.AppIdOf(channelId))
+	if tn == nil || bytes <= 0 {
+		return
+	}
+	tn.mu.Lock()
+	tn.storagePending -= bytes
+	tn.mu.Unlock()
+}
+
+// flushStorage 将本节点未提交的存储用量提交到租户所在的槽
+func (t *tenantManager) flushStorage() {
+	for appId, tn := range t.tenants {
+		tn.mu.Lock()
+		pending := tn.storagePending
+		tn.storagePending = 0
+		tn.mu.Unlock()
+		if pending == 0 {
+			continue
+		}
+		if err := t.s.store.IncTenantStorage(appId, pending); err != nil {
+			t.Warn("inc tenant storage failed", zap.Error(err), zap.String("appId", appId), zap.Int64("bytes", pending))
+			tn.mu.Lock()
+			tn.storagePending += pending // 下次再提交
+			tn.mu.Unlock()
+			continue
+		}
+		tn.mu.Lock()
+		tn.storageUsed += pending // 刷新前先计入，避免超额
+		tn.mu.Unlock()
+	}
+}
+
+// refreshStorage 从租户所在槽的领导节点刷新已存储的消息字节数
+func (t *tenantManager) refreshStorage() {
+	for appId, tn := range t.tenants {
+		if tn.app.MaxStorage <= 0 {
+			continue
+		}
+		usage, err := t.getUsage(appId)
+		if err != nil {
+			t.Warn("get tenant usage failed", zap.Error(err), zap.String("appId", appId))
+			continue
+		}
+		tn.mu.Lock()
+		tn.storageUsed = usage.StorageBytes
+		tn.mu.Unlock()
+	}
+}
+
+// getUsage 获取租户的资源使用量，本节点不是租户所在槽的领导节点时向领导节点获取
+func (t *tenantManager) getUsage(appId string) (wkdb.TenantUsage, error) {
+	leaderId := t.s.opts.Cluster.NodeId
+	if t.s.opts.ClusterOn() {
+		var err error
+		leaderId, err = t.s.cluster.SlotLeaderIdOfChannel(appId, wkproto.ChannelTypePerson)
+		if err != nil {
+			return wkdb.TenantUsage{}, err
+		}
+	}
+	if leaderId == t.s.opts.Cluster.NodeId {
+		return t.s.store.GetTenantUsage(appId)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(t.s.ctx, t.s.opts.Cluster.ReqTimeout)
+	defer cancel()
+	resp, err := t.s.cluster.RequestWithContext(timeoutCtx, leaderId, "/wk/tenantUsage", []byte(appId))
+	if err != nil {
+		return wkdb.TenantUsage{}, err
+	}
+	if resp.Status != proto.Status_OK {
+		return wkdb.TenantUsage{}, fmt.Errorf("get tenant usage failed, status: %d err:%s", resp.Status, string(resp.Body))
+	}
+	usage := wkdb.TenantUsage{}
+	if err = usage.Unmarshal(resp.Body); err != nil {
+		return wkdb.TenantUsage{}, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/auth"
+	"github.com/WuKongIM/WuKongIM/pkg/trace"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTenantTestServer(apps ...TenantApp) *Server {
+	s := &Server{opts: NewOptions(WithTenantApps(apps...))}
+	s.trace = trace.New(context.Background(), trace.NewOptions())
+	s.systemUIDManager = NewSystemUIDManager(s)
+	s.tenantManager = newTenantManager(s)
+	return s
+}
+
+func TestAppIdOf(t *testing.T) {
+	opts := NewOptions()
+	assert.Equal(t, "", opts.AppIdOf("app1:u1"))
+
+	opts = NewOptions(WithTenantApps(TenantApp{AppId: "app1"}))
+	assert.Equal(t, "app1", opts.AppIdOf("app1:u1"))
+	assert.Equal(t, "app1", opts.AppIdOf("app1:u1@app1:u2"))
+	assert.Equal(t, "", opts.AppIdOf("u1"))
+}
+
+func TestTenantConnect(t *testing.T) {
+	s := newTenantTestServer(TenantApp{AppId: "app1", MaxConnections: 1})
+
+	appId, reason := s.tenantManager.connect("app1:u1")
+	assert.Equal(t, wkproto.ReasonSuccess, reason)
+	assert.Equal(t, "app1", appId)
+
+	_, reason = s.tenantManager.connect("app1:u2")
+	assert.Equal(t, wkproto.ReasonRateLimit, reason)
+
+	_, reason = s.tenantManager.connect("app2:u1")
+	assert.Equal(t, wkproto.ReasonAuthFail, reason)
+	_, reason = s.tenantManager.connect("u1")
+	assert.Equal(t, wkproto.ReasonAuthFail, reason)
+
+	s.tenantManager.disconnect(appId)
+	_, reason = s.tenantManager.connect("app1:u2")
+	assert.Equal(t, wkproto.ReasonSuccess, reason)
+}
+
+func TestTenantAllowSend(t *testing.T) {
+	s := newTenantTestServer(TenantApp{AppId: "app1", MessageRate: 2, MaxStorage: 10}, TenantApp{AppId: "app2"})
+	messages := []ReactorChannelMessage{{SendPacket: &wkproto.SendPacket{Payload: []byte("hello")}}}
+
+	assert.Equal(t, wkproto.ReasonSuccess, s.tenantManager.allowSend("app1:u1", "app1:g1", wkproto.ChannelTypeGroup, messages))
+	// 跨租户
+	assert.Equal(t, wkproto.ReasonNotAllowSend, s.tenantManager.allowSend("app2:u1", "app1:g1", wkproto.ChannelTypeGroup, messages))
+	assert.Equal(t, wkproto.ReasonNotAllowSend, s.tenantManager.allowSend("app1:u1", "app1:u1@app2:u2", wkproto.ChannelTypePerson, messages))
+
+	// 限速
+	assert.Equal(t, wkproto.ReasonSuccess, s.tenantManager.allowSend("app1:u1", "app1:g1", wkproto.ChannelTypeGroup, messages))
+	assert.Equal(t, wkproto.ReasonRateLimit, s.tenantManager.allowSend("app1:u1", "app1:g1", wkproto.ChannelTypeGroup, messages))
+	assert.Equal(t, wkproto.ReasonSuccess, s.tenantManager.allowSend("app2:u1", "app2:g1", wkproto.ChannelTypeGroup, messages))
+
+	// 存储超限
+	s.tenantManager.addStorage("app1:g1", []wkdb.Message{{RecvPacket: wkproto.RecvPacket{Payload: []byte("0123456789")}}})
+	assert.Equal(t, wkproto.ReasonNotAllowSend, s.tenantManager.allowSend("app1:u1", "app1:g1", wkproto.ChannelTypeGroup, messages))
+
+	// 消息过期或撤回后释放存储用量
+	assert.Equal(t, wkproto.ReasonNotAllowSend, s.tenantManager.allowSend("", "app1:g1", wkproto.ChannelTypeGroup, messages))
+	s.tenantManager.removeStorage("app1:g1", 5)
+	assert.Equal(t, wkproto.ReasonSuccess, s.tenantManager.allowSend("", "app1:g1", wkproto.ChannelTypeGroup, messages))
+}
+
+func TestAPIAuthMiddlewareTenant(t *testing.T) {
+	opts := NewOptions(WithAPIKeyOn(true), WithTenantApps(TenantApp{AppId: "app1"}))
+	s := &Server{opts: opts}
+	s.apiKeyManager = newAPIKeyManager(s)
+
+	keyId, err := generateAPIKeyId()
+	assert.NoError(t, err)
+	key, secretHash, err := generateAPIKey(keyId)
+	assert.NoError(t, err)
+	s.apiKeyManager.cache.Add(keyId, apiKeyCacheItem{
+		apiKey: wkdb.APIKey{
+			KeyId:       keyId,
+			SecretHash:  secretHash,
+			Permissions: "*:*",
+			AppId:       "app1",
+		},
+		permissions: auth.ParsePermissions("*:*"),
+		expireAt:    time.Now().Add(time.Minute),
+	})
+
+	apiServer := &APIServer{r: wkhttp.New(), s: s}
+	apiServer.r.Use(apiServer.apiAuthMiddleware())
+	var body string
+	ok := func(c *wkhttp.Context) {
+		data, _ := c.GetRawData()
+		body = string(data)
+		c.ResponseOK()
+	}
+	apiServer.r.POST("/message/send", ok)
+	apiServer.r.POST("/channel/subscriber_add", ok)
+	apiServer.r.POST("/user/systemuids_add", ok)
+
+	request := func(path string, data string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		apiServer.r.GetGinRoute().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	data := `{"from_uid":"app1:u1","channel_id":"app1:g1","channel_type":2}`
+	assert.Equal(t, http.StatusOK, request("/message/send", data))
+	assert.Equal(t, data, body) // 请求体可以被后续处理读取
+	assert.Equal(t, http.StatusForbidden, request("/message/send", `{"from_uid":"app2:u1","channel_id":"app1:g1"}`))
+	assert.Equal(t, http.StatusOK, request("/channel/subscriber_add", `{"channel_id":"app1:g1","subscribers":["app1:u1","app1:u2"]}`))
+	assert.Equal(t, http.StatusForbidden, request("/channel/subscriber_add", `{"channel_id":"app1:g1","subscribers":["app1:u1","u2"]}`))
+	assert.Equal(t, http.StatusForbidden, request("/user/systemuids_add", `{"uids":["app1:u1"]}`))
+}
@@ -128,6 +128,16 @@ func (r *userReactor) handleAuth(uid string, msg ReactorUserMessage) (wkproto.Re
 			return wkproto.ReasonAuthFail, nil
 		}
 		devceLevel = wkproto.DeviceLevelSlave // 默认都是slave设备
+	} else if r.s.opts.TokenAuthOn && r.s.deviceTokenVerifier != nil {
+		claims, err := r.s.deviceTokenVerifier.verify(uid, wkproto.DeviceFlag(connectPacket.DeviceFlag), connectPacket.Token)
+		if err != nil {
+			r.Error("device token verify fail", zap.Error(err), zap.String("uid", uid), zap.Any("conn", connCtx))
+			r.authResponseConnackAuthFail(connCtx)
+			return wkproto.ReasonAuthFail, err
+		}
+		devceLevel = wkproto.DeviceLevel(claims.DeviceLevel)
+		connCtx.tokenId = claims.ID
+		connCtx.tokenIssuedAt = claims.issuedAt()
 	} else if r.s.opts.TokenAuthOn {
 		if connectPacket.Token == "" {
 			r.Error("token is empty")
@@ -263,6 +273,7 @@ func (r *userReactor) handleAuth(uid string, msg ReactorUserMessage) (wkproto.Re
 	r.s.webhook.Online(uid, connectPacket.DeviceFlag, connCtx.connId, deviceOnlineCount, totalOnlineCount)
 	if totalOnlineCount <= 1 {
 		r.s.trace.Metrics.App().OnlineUserCountAdd(1) // 统计在线用户数
+		r.s.presenceManager.statusChanged(uid)        // 通知在线状态订阅者
 	}
 	r.s.trace.Metrics.App().OnlineDeviceCountAdd(1) // 统计在线设备数
 
@@ -515,10 +526,13 @@ func (r *userReactor) processRecvack(req *recvackReq) {
 	for _, msg := range req.messages {
 		recvackPacket := msg.InPacket.(*wkproto.RecvackPacket)
 		// r.Debug("remove retry", zap.String("uid", req.uid), zap.Int64("connId", msg.ConnId), zap.Int64("messageID", recvackPacket.MessageID))
-		err := r.s.retryManager.removeRetry(msg.ConnId, recvackPacket.MessageID)
+		retryMsg, err := r.s.retryManager.removeRetry(msg.ConnId, recvackPacket.MessageID)
 		if err != nil {
 			r.Warn("removeRetry error", zap.Error(err), zap.Int64("connId", msg.ConnId), zap.Int64("messageID", recvackPacket.MessageID))
+			continue
 		}
+		// 收到消息即视为已读到此消息
+		r.s.receiptManager.readed(req.uid, retryMsg.channelId, retryMsg.channelType, uint64(retryMsg.messageSeq))
 	}
 	lastMsg := req.messages[len(req.messages)-1]
 	r.reactorSub(req.uid).step(req.uid, UserAction{
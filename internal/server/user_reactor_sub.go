@@ -374,6 +374,9 @@ func (u *userReactorSub) removeConnContextById(uid string, id int64) *connContex
 			u.Error("removeConnContextById: close user error", zap.String("uid", uid), zap.Int64("connId", id), zap.Error(err))
 		}
 		u.users.remove(uh.uid)
+		if uh.role == userRoleLeader && conn != nil && conn.isAuth.Load() { // 用户最后一个连接断开，通知在线状态订阅者
+			u.r.s.presenceManager.statusChanged(uid)
+		}
 	}
 	return conn
 }
@@ -394,6 +397,9 @@ func (u *userReactorSub) removeConnsByNodeId(uid string, nodeId uint64) []*connC
 			u.Error("removeConnsByNodeId: close user error", zap.String("uid", uid), zap.Uint64("nodeId", nodeId), zap.Error(err))
 		}
 		u.users.remove(uh.uid)
+		if uh.role == userRoleLeader && len(conns) > 0 { // 用户最后一个连接断开，通知在线状态订阅者
+			u.r.s.presenceManager.statusChanged(uid)
+		}
 	}
 	return conns
 }
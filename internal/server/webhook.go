@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/grpcpool"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkhook"
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
@@ -23,17 +28,27 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 )
 
+// webhookEventFlushInterval 触发的事件攒批写入待发送队列的间隔
+const webhookEventFlushInterval = time.Millisecond * 100
+
 type webhook struct {
 	s *Server
 	wklog.Log
-	eventPool        *ants.Pool
 	httpClient       *http.Client
+	eventPool        *ants.Pool
 	webhookGRPCPool  *grpcpool.Pool // webhook grpc客户端
 	stoped           chan struct{}
 	onlinestatusLock sync.RWMutex
 	onlinestatusList []string
+
+	pendingLock    sync.Mutex
+	pendingEvents  []wkdb.WebhookEvent // 已触发还没写入待发送队列的事件
+	pendingFlushC  chan struct{}
+	retryingLock   sync.Mutex
+	retryingGroups map[string]time.Time // 有事件在等待重试的租户事件（appId@event），value为重试时间，之后的事件排在它后面
 }
 
 func newWebhook(s *Server) *webhook {
@@ -65,6 +80,8 @@ func newWebhook(s *Server) *webhook {
 		webhookGRPCPool:  webhookGRPCPool,
 		onlinestatusList: make([]string, 0),
 		stoped:           make(chan struct{}),
+		pendingFlushC:    make(chan struct{}, 1),
+		retryingGroups:   make(map[string]time.Time),
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				DialContext: (&net.Dialer{
@@ -86,6 +103,8 @@ func newWebhook(s *Server) *webhook {
 func (w *webhook) Start() {
 	go w.notifyQueueLoop()
 	go w.loopOnlineStatus()
+	go w.loopPendingEvents()
+	go w.outboxLoop()
 }
 
 func (w *webhook) Stop() {
@@ -112,31 +131,69 @@ func (w *webhook) Offline(uid string, deviceFlag wkproto.DeviceFlag, connId int6
 	w.Debug("User offline", zap.String("uid", uid), zap.String("deviceFlag", deviceFlag.String()))
 }
 
-// TriggerEvent 触发事件
+// TriggerEvent 触发事件，事件攒批写入本节点的webhook待发送队列，再由outboxLoop发送
 func (w *webhook) TriggerEvent(event *Event) {
 	if !w.s.opts.WebhookOn() { // 没设置webhook直接忽略
 		return
 	}
-	err := w.eventPool.Submit(func() {
-		jsonData, err := json.Marshal(event.Data)
-		if err != nil {
-			w.Error("webhook的event数据不能json化！", zap.Error(err))
-			return
+	jsonData, err := json.Marshal(event.Data)
+	if err != nil {
+		w.Error("webhook的event数据不能json化！", zap.Error(err))
+		return
+	}
+	now := uint64(time.Now().UnixMilli())
+	w.pendingLock.Lock()
+	w.pendingEvents = append(w.pendingEvents, wkdb.WebhookEvent{
+		Event:       event.Event,
+		Data:        jsonData,
+		NextRetryAt: now,
+		CreatedAt:   now,
+		AppId:       event.AppId,
+	})
+	full := len(w.pendingEvents) >= w.s.opts.Webhook.MsgNotifyEventCountPerPush
+	w.pendingLock.Unlock()
+	if full {
+		select {
+		case w.pendingFlushC <- struct{}{}:
+		default:
 		}
+	}
+}
 
-		if w.s.opts.WebhookGRPCOn() {
-			err = w.sendWebhookForGRPC(event.Event, jsonData)
-		} else {
-			err = w.sendWebhookForHttp(event.Event, jsonData)
-		}
-		if err != nil {
-			w.Error("请求webhook失败！", zap.Error(err), zap.String("event", event.Event))
+// loopPendingEvents 定时将触发的事件一批写入待发送队列，避免每个事件都同步提交一次
+func (w *webhook) loopPendingEvents() {
+	if !w.s.opts.WebhookOn() {
+		return
+	}
+	ticker := time.NewTicker(webhookEventFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flushPendingEvents()
+		case <-w.pendingFlushC:
+			w.flushPendingEvents()
+		case <-w.stoped:
+			w.flushPendingEvents()
 			return
 		}
+	}
+}
 
-	})
-	if err != nil {
-		w.Error("提交事件失败", zap.Error(err))
+func (w *webhook) flushPendingEvents() {
+	w.pendingLock.Lock()
+	events := w.pendingEvents
+	w.pendingEvents = nil
+	w.pendingLock.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	if err := w.s.store.AppendWebhookEvents(events); err != nil {
+		w.Error("webhook事件写入待发送队列失败！", zap.Error(err), zap.Int("count", len(events)))
+		// 放回去下次再写入
+		w.pendingLock.Lock()
+		w.pendingEvents = append(events, w.pendingEvents...)
+		w.pendingLock.Unlock()
 	}
 }
 
@@ -160,6 +217,7 @@ func (w *webhook) notifyOfflineMsg(msg ReactorChannelMessage, subscribers []stri
 	// 推送离线到上层应用
 	w.TriggerEvent(&Event{
 		Event: EventMsgOffline,
+		AppId: w.s.opts.AppIdOf(msg.SendPacket.ChannelID),
 		Data: MessageOfflineNotify{
 			MessageResp: MessageResp{
 				Header: MessageHeader{
@@ -202,59 +260,23 @@ func (w *webhook) notifyQueueLoop() {
 				continue
 			}
 			if len(messages) > 0 {
-				messageResps := make([]*MessageResp, 0, len(messages))
+				// 按频道所属的租户分组通知，未开启多租户时只有一组
+				appMessages := make(map[string][]wkdb.Message)
+				appIds := make([]string, 0, 1)
 				for _, msg := range messages {
-					resp := &MessageResp{}
-					resp.from(msg)
-					messageResps = append(messageResps, resp)
-				}
-				messageData, err := json.Marshal(messageResps)
-				if err != nil {
-					w.Error("第三方消息通知的event数据不能json化！", zap.Error(err))
-					time.Sleep(errorSleepTime) // 如果报错就休息下
-					continue
-				}
-
-				if w.s.opts.WebhookGRPCOn() {
-					err = w.sendWebhookForGRPC(EventMsgNotify, messageData)
-				} else {
-					err = w.sendWebhookForHttp(EventMsgNotify, messageData)
-				}
-				if err != nil {
-					w.Error("请求所有消息通知webhook失败！", zap.Error(err))
-					errMessageIDs := make([]int64, 0, len(messages))
-					for _, message := range messages {
-						errCount := errMessageIDMap[message.MessageID]
-						errCount++
-						errMessageIDMap[message.MessageID] = errCount
-						if errCount >= w.s.opts.Webhook.MsgNotifyEventRetryMaxCount {
-							errMessageIDs = append(errMessageIDs, message.MessageID)
-						}
+					appId := w.s.opts.AppIdOf(msg.ChannelID)
+					if _, ok := appMessages[appId]; !ok {
+						appIds = append(appIds, appId)
 					}
-					if len(errMessageIDs) > 0 {
-						w.Error("消息通知失败超过最大次数！", zap.Int64s("messageIDs", errMessageIDs))
-						err = w.s.store.RemoveMessagesOfNotifyQueue(errMessageIDs)
-						if err != nil {
-							w.Warn("从通知队列里移除消息失败！", zap.Error(err), zap.Int64s("messageIDs", errMessageIDs))
-						}
-						for _, errMessageID := range errMessageIDs {
-							delete(errMessageIDMap, errMessageID)
-						}
-					}
-					time.Sleep(errorSleepTime) // 如果报错就休息下
-					continue
+					appMessages[appId] = append(appMessages[appId], msg)
 				}
-
-				messageIDs := make([]int64, 0, len(messages))
-				for _, message := range messages {
-					messageID := message.MessageID
-					messageIDs = append(messageIDs, messageID)
-
-					delete(errMessageIDMap, messageID)
+				failed := false
+				for _, appId := range appIds {
+					if !w.notifyMessages(appId, appMessages[appId], errMessageIDMap) {
+						failed = true
+					}
 				}
-				err = w.s.store.RemoveMessagesOfNotifyQueue(messageIDs)
-				if err != nil {
-					w.Warn("从通知队列里移除消息失败！", zap.Error(err), zap.Int64s("messageIDs", messageIDs), zap.String("Webhook", w.s.opts.Webhook.HTTPAddr))
+				if failed {
 					time.Sleep(errorSleepTime) // 如果报错就休息下
 					continue
 				}
@@ -269,83 +291,375 @@ func (w *webhook) notifyQueueLoop() {
 	}
 }
 
+// notifyMessages 将租户的消息通知到第三方，失败超过最大次数的消息移入死信，返回是否成功
+func (w *webhook) notifyMessages(appId string, messages []wkdb.Message, errMessageIDMap map[int64]int) bool {
+	messageResps := make([]*MessageResp, 0, len(messages))
+	for _, msg := range messages {
+		resp := &MessageResp{}
+		resp.from(msg)
+		messageResps = append(messageResps, resp)
+	}
+	messageData, err := json.Marshal(messageResps)
+	if err != nil {
+		w.Error("第三方消息通知的event数据不能json化！", zap.Error(err))
+		return false
+	}
+
+	err = w.sendWebhook(appId, 0, EventMsgNotify, messageData)
+	if err != nil {
+		w.Error("请求所有消息通知webhook失败！", zap.Error(err), zap.String("appId", appId))
+		errMessageIDs := make([]int64, 0, len(messages))
+		errMessageResps := make([]*MessageResp, 0, len(messages))
+		for i, message := range messages {
+			errCount := errMessageIDMap[message.MessageID]
+			errCount++
+			errMessageIDMap[message.MessageID] = errCount
+			if errCount >= w.s.opts.Webhook.MsgNotifyEventRetryMaxCount {
+				errMessageIDs = append(errMessageIDs, message.MessageID)
+				errMessageResps = append(errMessageResps, messageResps[i])
+			}
+		}
+		if len(errMessageIDs) > 0 {
+			w.Error("消息通知失败超过最大次数，移入死信！", zap.Int64s("messageIDs", errMessageIDs))
+			if err = w.addDeadLetter(appId, EventMsgNotify, errMessageResps, err); err != nil {
+				w.Error("消息通知移入死信失败！", zap.Error(err), zap.Int64s("messageIDs", errMessageIDs))
+			}
+			err = w.s.store.RemoveMessagesOfNotifyQueue(errMessageIDs)
+			if err != nil {
+				w.Warn("从通知队列里移除消息失败！", zap.Error(err), zap.Int64s("messageIDs", errMessageIDs))
+			}
+			for _, errMessageID := range errMessageIDs {
+				delete(errMessageIDMap, errMessageID)
+			}
+		}
+		return false
+	}
+
+	messageIDs := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		messageID := message.MessageID
+		messageIDs = append(messageIDs, messageID)
+
+		delete(errMessageIDMap, messageID)
+	}
+	err = w.s.store.RemoveMessagesOfNotifyQueue(messageIDs)
+	if err != nil {
+		w.Warn("从通知队列里移除消息失败！", zap.Error(err), zap.Int64s("messageIDs", messageIDs), zap.String("appId", appId))
+		return false
+	}
+	return true
+}
+
+// loopOnlineStatus 定时将用户在线状态合并成一个事件写入待发送队列
 func (w *webhook) loopOnlineStatus() {
 	if !w.s.opts.WebhookOn() {
 		return
 	}
-	opLen := 0    // 最后一次操作在线状态数组的长度
-	errCount := 0 // webhook请求失败重试次数
+	ticker := time.NewTicker(time.Second * 2)
+	defer ticker.Stop()
 	for {
-		if opLen == 0 {
-			w.onlinestatusLock.Lock()
-			opLen = len(w.onlinestatusList)
-			w.onlinestatusLock.Unlock()
+		select {
+		case <-ticker.C:
+			w.flushOnlineStatus()
+		case <-w.stoped:
+			w.flushOnlineStatus()
+			return
 		}
-		if opLen == 0 {
-			time.Sleep(time.Second * 2) // 没有数据就休息2秒
-			continue
+	}
+}
+
+func (w *webhook) flushOnlineStatus() {
+	w.onlinestatusLock.Lock()
+	opLen := len(w.onlinestatusList)
+	data := w.onlinestatusList[:opLen]
+	w.onlinestatusLock.Unlock()
+	if opLen == 0 {
+		return
+	}
+	// 按用户所属的租户分组，每个租户一个事件
+	appData := make(map[string][]string)
+	appIds := make([]string, 0, 1)
+	for _, status := range data {
+		appId := w.s.opts.AppIdOf(status)
+		if _, ok := appData[appId]; !ok {
+			appIds = append(appIds, appId)
 		}
-		w.onlinestatusLock.Lock()
-		data := w.onlinestatusList[:opLen]
-		w.onlinestatusLock.Unlock()
-		jsonData, err := json.Marshal(data)
+		appData[appId] = append(appData[appId], status)
+	}
+	events := make([]wkdb.WebhookEvent, 0, len(appIds))
+	now := uint64(time.Now().UnixMilli())
+	for _, appId := range appIds {
+		jsonData, err := json.Marshal(appData[appId])
 		if err != nil {
 			w.Error("webhook的event数据不能json化！", zap.Error(err))
-			time.Sleep(time.Second * 1)
-			continue
+			return
+		}
+		events = append(events, wkdb.WebhookEvent{
+			Event:       EventOnlineStatus,
+			Data:        jsonData,
+			NextRetryAt: now,
+			CreatedAt:   now,
+			AppId:       appId,
+		})
+	}
+	if err := w.s.store.AppendWebhookEvents(events); err != nil {
+		w.Error("在线状态写入待发送队列失败！", zap.Error(err))
+		return
+	}
+	w.onlinestatusLock.Lock()
+	w.onlinestatusList = w.onlinestatusList[opLen:]
+	w.onlinestatusLock.Unlock()
+}
+
+// outboxLoop 发送待发送队列里到期的事件，失败的事件按指数退避重试，超过最大次数移入死信
+func (w *webhook) outboxLoop() {
+	if !w.s.opts.WebhookOn() {
+		return
+	}
+	ticker := time.NewTicker(w.s.opts.Webhook.MsgNotifyEventPushInterval)
+	defer ticker.Stop()
+	for {
+		w.sendDueEvents()
+		select {
+		case <-ticker.C:
+		case <-w.stoped:
+			return
 		}
+	}
+}
 
-		if w.s.opts.WebhookGRPCOn() {
-			err = w.sendWebhookForGRPC(EventOnlineStatus, jsonData)
-		} else {
-			err = w.sendWebhookForHttp(EventOnlineStatus, jsonData)
+func (w *webhook) sendDueEvents() {
+	now := time.Now()
+	events, err := w.s.store.GetWebhookEvents(uint64(now.UnixMilli()), w.s.opts.Webhook.MsgNotifyEventCountPerPush)
+	if err != nil {
+		w.Error("获取webhook待发送事件失败！", zap.Error(err))
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+	// 同一个租户的同一种事件发送到同一个地址，按顺序发送，不同的租户或事件并发发送
+	groupKeys := make([]string, 0)
+	groups := make(map[string][]wkdb.WebhookEvent)
+	blockedEvents := make(map[string][]wkdb.WebhookEvent) // 前面有事件在等待重试，排到重试的事件后面
+	w.retryingLock.Lock()
+	for _, e := range events {
+		groupKey := webhookGroupKey(e)
+		if retryAt, ok := w.retryingGroups[groupKey]; ok {
+			if now.Before(retryAt) {
+				blockedEvents[groupKey] = append(blockedEvents[groupKey], e)
+				continue
+			}
+			delete(w.retryingGroups, groupKey)
 		}
-		if err != nil {
-			errCount++
-			w.Error("请求在线状态webhook失败！", zap.Error(err))
-			if errCount >= w.s.opts.Webhook.MsgNotifyEventRetryMaxCount {
-				w.Error("请求在线状态webhook失败通知超过最大次数！", zap.Int("MsgNotifyEventRetryMaxCount", w.s.opts.Webhook.MsgNotifyEventRetryMaxCount))
+		if _, ok := groups[groupKey]; !ok {
+			groupKeys = append(groupKeys, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], e)
+	}
+	w.retryingLock.Unlock()
 
-				w.onlinestatusLock.Lock()
-				w.onlinestatusList = w.onlinestatusList[opLen:]
-				opLen = 0
-				w.onlinestatusLock.Unlock()
+	var (
+		wg           sync.WaitGroup
+		resultLock   sync.Mutex
+		sentEvents   = make([]wkdb.WebhookEvent, 0, len(events))
+		failedGroups = make([]webhookFailedGroup, 0)
+	)
+	for _, groupKey := range groupKeys {
+		groupEvents := groups[groupKey]
+		wg.Add(1)
+		err = w.eventPool.Submit(func() {
+			defer wg.Done()
+			for i, e := range groupEvents {
+				sendErr := w.sendWebhook(e.AppId, e.Id, e.Event, e.Data)
+				resultLock.Lock()
+				if sendErr == nil {
+					sentEvents = append(sentEvents, e)
+					resultLock.Unlock()
+					continue
+				}
+				// 失败后同组后面的事件不再发送，等失败的事件重试成功后再按顺序发送
+				failedGroups = append(failedGroups, webhookFailedGroup{
+					groupKey:  groupKey,
+					event:     e,
+					err:       sendErr,
+					remaining: groupEvents[i+1:],
+				})
+				resultLock.Unlock()
+				return
+			}
+		})
+		if err != nil { // 提交失败的事件还在待发送队列里，下一轮再发送
+			wg.Done()
+			w.Error("提交webhook事件失败！", zap.Error(err), zap.String("group", groupKey))
+		}
+	}
+	wg.Wait()
+
+	if len(sentEvents) > 0 {
+		if err = w.s.store.RemoveWebhookEvents(sentEvents); err != nil {
+			w.Error("从待发送队列里移除webhook事件失败！", zap.Error(err))
+		}
+	}
 
-				errCount = 0
+	for _, failed := range failedGroups {
+		e := failed.event
+		e.RetryCount++
+		e.LastError = webhookErrorString(failed.err)
+		if int(e.RetryCount) >= w.s.opts.Webhook.EventRetryMaxCount {
+			w.Error("webhook事件发送失败超过最大次数，移入死信！", zap.Uint64("id", e.Id), zap.String("event", e.Event), zap.Error(failed.err))
+			if err = w.s.store.MoveWebhookEventsToDeadLetter([]wkdb.WebhookEvent{e}); err != nil {
+				w.Error("webhook事件移入死信失败！", zap.Error(err), zap.Uint64("id", e.Id))
 			}
+			continue // 同组后面的事件还在待发送队列里，下一轮继续发送
+		}
+		nextRetryAt := now.Add(w.retryInterval(e.RetryCount))
+		w.Warn("webhook事件发送失败，稍后重试！", zap.Uint64("id", e.Id), zap.String("event", e.Event), zap.Uint32("retryCount", e.RetryCount), zap.Time("nextRetryAt", nextRetryAt), zap.Error(failed.err))
+		// 失败的事件和同组后面的事件一起延后，延后后还按id排序
+		rescheduleEvents := append([]wkdb.WebhookEvent{e}, failed.remaining...)
+		if err = w.s.store.RescheduleWebhookEvents(rescheduleEvents, uint64(nextRetryAt.UnixMilli())); err != nil {
+			w.Error("webhook事件设置重试时间失败！", zap.Error(err), zap.Uint64("id", e.Id))
+			continue
+		}
+		w.retryingLock.Lock()
+		w.retryingGroups[failed.groupKey] = nextRetryAt
+		w.retryingLock.Unlock()
+	}
 
-			time.Sleep(time.Second * 1) // 如果报错就休息下
+	for groupKey, blocked := range blockedEvents {
+		w.retryingLock.Lock()
+		retryAt, ok := w.retryingGroups[groupKey]
+		w.retryingLock.Unlock()
+		if !ok {
 			continue
 		}
+		if err = w.s.store.RescheduleWebhookEvents(blocked, uint64(retryAt.UnixMilli())); err != nil {
+			w.Error("webhook事件设置发送时间失败！", zap.Error(err), zap.String("group", groupKey))
+		}
+	}
+}
+
+// webhookFailedGroup 发送失败的一组事件
+type webhookFailedGroup struct {
+	groupKey  string
+	event     wkdb.WebhookEvent   // 发送失败的事件
+	err       error               // 失败原因
+	remaining []wkdb.WebhookEvent // 同组里排在失败事件后面还没发送的事件
+}
+
+func webhookGroupKey(e wkdb.WebhookEvent) string {
+	return e.AppId + "@" + e.Event
+}
+
+// retryInterval 第retryCount次重试的间隔，从EventRetryBaseInterval开始每次翻倍，最大为EventRetryMaxInterval
+func (w *webhook) retryInterval(retryCount uint32) time.Duration {
+	interval := w.s.opts.Webhook.EventRetryBaseInterval
+	for i := uint32(1); i < retryCount; i++ {
+		interval *= 2
+		if interval >= w.s.opts.Webhook.EventRetryMaxInterval {
+			return w.s.opts.Webhook.EventRetryMaxInterval
+		}
+	}
+	if interval > w.s.opts.Webhook.EventRetryMaxInterval {
+		return w.s.opts.Webhook.EventRetryMaxInterval
+	}
+	return interval
+}
+
+// addDeadLetter 直接添加一个死信事件
+func (w *webhook) addDeadLetter(appId string, event string, data interface{}, sendErr error) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := uint64(time.Now().UnixMilli())
+	e := wkdb.WebhookEvent{
+		Id:          w.s.store.DB().NextPrimaryKey(),
+		Event:       event,
+		Data:        jsonData,
+		RetryCount:  uint32(w.s.opts.Webhook.MsgNotifyEventRetryMaxCount),
+		NextRetryAt: now,
+		LastError:   webhookErrorString(sendErr),
+		CreatedAt:   now,
+		AppId:       appId,
+	}
+	return w.s.store.MoveWebhookEventsToDeadLetter([]wkdb.WebhookEvent{e})
+}
+
+// sendWebhook 发送事件，租户配置了webhook地址时发送到租户的地址，否则发送到全局的地址
+func (w *webhook) sendWebhook(appId string, eventId uint64, event string, data []byte) error {
+	if appId != "" {
+		if app, ok := w.s.opts.TenantApp(appId); ok && app.WebhookHTTPAddr != "" {
+			return w.sendWebhookForHttp(app.WebhookHTTPAddr, appId, eventId, event, data)
+		}
+	}
+	if w.s.opts.WebhookGRPCOn() {
+		return w.sendWebhookForGRPC(appId, eventId, event, data)
+	}
+	if w.s.opts.Webhook.HTTPAddr == "" { // 只有部分租户配置了webhook，其他租户的事件直接丢弃
+		w.Debug("没有webhook地址，忽略事件", zap.String("appId", appId), zap.String("event", event))
+		return nil
+	}
+	return w.sendWebhookForHttp(w.s.opts.Webhook.HTTPAddr, appId, eventId, event, data)
+}
 
-		w.onlinestatusLock.Lock()
-		w.onlinestatusList = w.onlinestatusList[opLen:]
-		opLen = 0
-		w.onlinestatusLock.Unlock()
+// sign 对请求签名，签名内容为 时间戳.请求数据
+func (w *webhook) sign(timestamp string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.s.opts.Webhook.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
+// webhookErrorString 错误信息过长时截断
+func webhookErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	errStr := err.Error()
+	if len(errStr) > 500 {
+		errStr = errStr[:500]
 	}
+	return errStr
 }
 
-func (w *webhook) sendWebhookForHttp(event string, data []byte) error {
-	eventURL := fmt.Sprintf("%s?event=%s", w.s.opts.Webhook.HTTPAddr, event)
+func (w *webhook) sendWebhookForHttp(addr string, appId string, eventId uint64, event string, data []byte) error {
+	eventURL := fmt.Sprintf("%s?event=%s", addr, event)
 	startTime := time.Now().UnixNano() / 1000 / 1000
 	w.Debug("webhook开始请求", zap.String("eventURL", eventURL))
-	resp, err := w.httpClient.Post(eventURL, "application/json", bytes.NewBuffer(data))
+	req, err := http.NewRequest(http.MethodPost, eventURL, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	if eventId != 0 {
+		req.Header.Set(WebhookHeaderEventId, strconv.FormatUint(eventId, 10))
+	}
+	if appId != "" {
+		req.Header.Set(WebhookHeaderAppId, appId)
+	}
+	if w.s.opts.Webhook.Secret != "" {
+		req.Header.Set(WebhookHeaderSignature, w.sign(timestamp, data))
+	}
+	resp, err := w.httpClient.Do(req)
 	w.Debug("webhook请求结束 耗时", zap.Int64("mill", time.Now().UnixNano()/1000/1000-startTime))
 	if err != nil {
-		w.Warn("调用第三方消息通知失败！", zap.String("Webhook", w.s.opts.Webhook.HTTPAddr), zap.Error(err))
+		w.Warn("调用第三方消息通知失败！", zap.String("Webhook", addr), zap.Error(err))
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		w.Warn("第三方消息通知接口返回状态错误！", zap.Int("status", resp.StatusCode), zap.String("Webhook", w.s.opts.Webhook.HTTPAddr))
+		w.Warn("第三方消息通知接口返回状态错误！", zap.Int("status", resp.StatusCode), zap.String("Webhook", addr))
 		return errors.New("第三方消息通知接口返回状态错误！")
 	}
 	return nil
 }
 
-func (w *webhook) sendWebhookForGRPC(event string, data []byte) error {
+func (w *webhook) sendWebhookForGRPC(appId string, eventId uint64, event string, data []byte) error {
 
 	startNow := time.Now()
 	startTime := startNow.UnixNano() / 1000 / 1000
@@ -366,6 +680,18 @@ func (w *webhook) sendWebhookForGRPC(event string, data []byte) error {
 
 	sendCtx, sendCancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer sendCancel()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	md := []string{strings.ToLower(WebhookHeaderTimestamp), timestamp}
+	if eventId != 0 {
+		md = append(md, strings.ToLower(WebhookHeaderEventId), strconv.FormatUint(eventId, 10))
+	}
+	if appId != "" {
+		md = append(md, strings.ToLower(WebhookHeaderAppId), appId)
+	}
+	if w.s.opts.Webhook.Secret != "" {
+		md = append(md, strings.ToLower(WebhookHeaderSignature), w.sign(timestamp, data))
+	}
+	sendCtx = metadata.AppendToOutgoingContext(sendCtx, md...)
 	resp, err := cli.SendWebhook(sendCtx, &wkhook.EventReq{
 		Event: event,
 		Data:  data,
@@ -381,6 +707,17 @@ func (w *webhook) sendWebhookForGRPC(event string, data []byte) error {
 	return nil
 }
 
+const (
+	// WebhookHeaderEventId 事件id，重试时不变，可用于去重
+	WebhookHeaderEventId = "X-WK-Event-Id"
+	// WebhookHeaderTimestamp 请求时间戳（秒）
+	WebhookHeaderTimestamp = "X-WK-Timestamp"
+	// WebhookHeaderSignature 请求签名 hex(HMAC-SHA256(secret, 时间戳 + "." + 请求数据))
+	WebhookHeaderSignature = "X-WK-Signature"
+	// WebhookHeaderAppId 事件所属的租户id，开启多租户时才有
+	WebhookHeaderAppId = "X-WK-App-Id"
+)
+
 const (
 	// EventMsgOffline 离线消息
 	EventMsgOffline = "msg.offline"
@@ -394,6 +731,7 @@ const (
 type Event struct {
 	Event string      `json:"event"` // 事件标示
 	Data  interface{} `json:"data"`  // 事件数据
+	AppId string      `json:"-"`     // 事件所属的租户
 }
 
 func (e *Event) String() string {
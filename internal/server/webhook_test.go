@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRetryInterval(t *testing.T) {
+	opts := NewOptions(WithWebhookEventRetry(10, time.Second, time.Second*10))
+	w := &webhook{s: &Server{opts: opts}}
+
+	assert.Equal(t, time.Second, w.retryInterval(1))
+	assert.Equal(t, time.Second*2, w.retryInterval(2))
+	assert.Equal(t, time.Second*8, w.retryInterval(4))
+	assert.Equal(t, time.Second*10, w.retryInterval(5))
+	assert.Equal(t, time.Second*10, w.retryInterval(100))
+}
+
+func TestWebhookSign(t *testing.T) {
+	var (
+		header http.Header
+		body   []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	opts := NewOptions(WithWebhookSecret("testSecret"))
+	opts.Webhook.HTTPAddr = srv.URL
+	w := &webhook{
+		s:          &Server{opts: opts},
+		Log:        wklog.NewWKLog("Webhook"),
+		httpClient: srv.Client(),
+	}
+	err := w.sendWebhook("", 100, EventMsgOffline, []byte(`{"a":1}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "100", header.Get(WebhookHeaderEventId))
+	mac := hmac.New(sha256.New, []byte("testSecret"))
+	mac.Write([]byte(header.Get(WebhookHeaderTimestamp) + "." + string(body)))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), header.Get(WebhookHeaderSignature))
+}
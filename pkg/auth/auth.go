@@ -2,6 +2,7 @@ package auth
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/WuKongIM/WuKongIM/pkg/auth/resource"
 	"github.com/WuKongIM/WuKongIM/pkg/wkhttp"
@@ -58,15 +59,7 @@ func (a AuthConfig) HasPermission(username string, rs resource.Id, action Action
 	}
 	for _, user := range a.Users {
 		if user.Username == username {
-			for _, permission := range user.Permissions {
-				if permission.Resource == rs || permission.Resource == resource.All {
-					for _, a := range permission.Actions {
-						if a == ActionAll || a == action {
-							return true
-						}
-					}
-				}
-			}
+			return user.Permissions.HasPermission(rs, action)
 		}
 	}
 	return false
@@ -101,6 +94,44 @@ type PermissionConfig struct {
 
 type PermissionConfigs []PermissionConfig
 
+// ParsePermissions 解析权限配置 格式 resource:actions,resource:actions 例如 message:rw,channelInfo:r
+func ParsePermissions(str string) PermissionConfigs {
+	permissionCfgs := make(PermissionConfigs, 0)
+	for _, permission := range strings.Split(str, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" {
+			continue
+		}
+		permissionSplits := strings.Split(permission, ":")
+		if len(permissionSplits) < 2 {
+			continue
+		}
+		actionConfigs := make([]Action, 0)
+		for _, r := range permissionSplits[1] {
+			actionConfigs = append(actionConfigs, Action(string(r)))
+		}
+		permissionCfgs = append(permissionCfgs, PermissionConfig{
+			Resource: resource.Id(permissionSplits[0]),
+			Actions:  actionConfigs,
+		})
+	}
+	return permissionCfgs
+}
+
+// HasPermission 是否有资源的操作权限
+func (p PermissionConfigs) HasPermission(rs resource.Id, action Action) bool {
+	for _, permission := range p {
+		if permission.Resource == rs || permission.Resource == resource.All {
+			for _, a := range permission.Actions {
+				if a == ActionAll || a == action {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func (p PermissionConfigs) Format() string {
 	var str string
 	for i, permission := range p {
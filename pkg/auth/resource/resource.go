@@ -14,6 +14,79 @@ var ClusterChannel = channel{
 	Stop:    "clusterchannelStop",    // 停止频道
 }
 
+// 节点资源
+var ClusterNode = node{
+	Leave: "clusternodeLeave", // 节点离开集群
+}
+
+// 用户资源
+var User = user{
+	Token:     "userToken",     // 用户token、设备退出、token拒绝名单
+	Status:    "userStatus",    // 在线状态、在线状态订阅
+	SystemUID: "userSystemUID", // 系统账号
+	Push:      "userPush",      // 离线推送设置
+}
+
+// 业务频道资源
+var Channel = businessChannel{
+	Info:       "channelInfo",       // 频道和频道基础信息
+	Subscriber: "channelSubscriber", // 订阅者
+	Blacklist:  "channelBlacklist",  // 黑名单
+	Whitelist:  "channelWhitelist",  // 白名单
+	Message:    "channelMessage",    // 频道消息同步
+	Datasource: "channelDatasource", // 数据源缓存
+}
+
+// 消息资源
+var Message = message{
+	Message: "message",        // 发送、撤回、编辑、查询消息
+	Stream:  "messageStream",  // 流消息
+	Receipt: "messageReceipt", // 消息回执
+}
+
+// 最近会话资源
+var Conversation Id = "conversation"
+
+// 用户所在节点的路由资源
+var Route Id = "route"
+
+// 连接资源
+var Connz Id = "connz"
+
+// webhook事件资源
+var Webhook Id = "webhook"
+
+// api密钥资源
+var APIKey Id = "apikey"
+
+// 节点数据备份资源
+var Backup Id = "backup"
+
+// 数据导入导出资源
+var Data Id = "data"
+
+type user struct {
+	Token     Id
+	Status    Id
+	SystemUID Id
+	Push      Id
+}
+
+type businessChannel struct {
+	Info       Id
+	Subscriber Id
+	Blacklist  Id
+	Whitelist  Id
+	Message    Id
+	Datasource Id
+}
+
+type message struct {
+	Message Id
+	Stream  Id
+	Receipt Id
+}
+
 type slot struct {
 	Migrate Id
 }
@@ -24,4 +97,8 @@ type channel struct {
 	Stop    Id
 }
 
+type node struct {
+	Leave Id
+}
+
 var All Id = "*"
@@ -21,6 +21,9 @@ const (
 	CMDTypeSlotMigrate                       // 槽迁移
 	CMDTypeSlotUpdate                        // 槽更新
 	CMDTypeNodeStatusChange                  // 节点状态改变
+	CMDTypeNodeLeave                         // 节点离开（开始迁出）
+	CMDTypeNodeLeft                          // 节点已离开（从配置中移除）
+	CMDTypeNodeLocationChange                // 节点位置（可用区和机架）变更
 
 )
 
@@ -48,6 +51,12 @@ func (c CMDType) String() string {
 		return "CMDTypeSlotUpdate"
 	case CMDTypeNodeStatusChange:
 		return "CMDTypeNodeStatusChange"
+	case CMDTypeNodeLeave:
+		return "CMDTypeNodeLeave"
+	case CMDTypeNodeLeft:
+		return "CMDTypeNodeLeft"
+	case CMDTypeNodeLocationChange:
+		return "CMDTypeNodeLocationChange"
 	}
 	return "CMDTypeUnknown"
 }
@@ -169,6 +178,21 @@ func (c *CMD) CMDContent() (string, error) {
 			"nodeId": nodeId,
 			"status": status,
 		}), nil
+	case CMDTypeNodeLeave, CMDTypeNodeLeft:
+		nodeId := binary.BigEndian.Uint64(c.Data)
+		return wkutil.ToJSON(map[string]interface{}{
+			"nodeId": nodeId,
+		}), nil
+	case CMDTypeNodeLocationChange:
+		nodeId, zone, rack, err := DecodeNodeLocationChange(c.Data)
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"nodeId": nodeId,
+			"zone":   zone,
+			"rack":   rack,
+		}), nil
 	}
 
 	return "", nil
@@ -193,6 +217,27 @@ func DecodeApiServerAddrChange(data []byte) (uint64, string, error) {
 	return nodeId, apiServerAddr, err
 }
 
+func EncodeNodeLocationChange(nodeId uint64, zone, rack string) ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint64(nodeId)
+	enc.WriteString(zone)
+	enc.WriteString(rack)
+	return enc.Bytes(), nil
+}
+
+func DecodeNodeLocationChange(data []byte) (nodeId uint64, zone, rack string, err error) {
+	dec := wkproto.NewDecoder(data)
+	if nodeId, err = dec.Uint64(); err != nil {
+		return
+	}
+	if zone, err = dec.String(); err != nil {
+		return
+	}
+	rack, err = dec.String()
+	return
+}
+
 func EncodeNodeOnlineStatusChange(nodeId uint64, online bool) ([]byte, error) {
 	enc := wkproto.NewEncoder()
 	defer enc.End()
@@ -182,6 +182,18 @@ func (c *Config) updateApiServerAddr(nodeId uint64, addr string) {
 	}
 }
 
+func (c *Config) updateNodeLocation(nodeId uint64, zone, rack string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, node := range c.cfg.Nodes {
+		if node.Id == nodeId {
+			node.Zone = zone
+			node.Rack = rack
+			return
+		}
+	}
+}
+
 func (c *Config) updateNodeOnlineStatus(nodeId uint64, online bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -276,6 +288,35 @@ func (c *Config) updateNodeStatus(nodeId uint64, status pb.NodeStatus) {
 	}
 }
 
+// 移除节点
+func (c *Config) removeNode(nodeId uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, node := range c.cfg.Nodes {
+		if node.Id == nodeId {
+			c.cfg.Nodes = append(c.cfg.Nodes[:i], c.cfg.Nodes[i+1:]...)
+			break
+		}
+	}
+	c.cfg.Learners = wkutil.RemoveUint64(c.cfg.Learners, nodeId)
+	if c.cfg.MigrateFrom == nodeId || c.cfg.MigrateTo == nodeId {
+		c.cfg.MigrateFrom = 0
+		c.cfg.MigrateTo = 0
+	}
+}
+
+// 获取正在离开的节点
+func (c *Config) leavingNode() *pb.Node {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, node := range c.cfg.Nodes {
+		if node.Status == pb.NodeStatus_NodeStatusLeaving {
+			return node
+		}
+	}
+	return nil
+}
+
 func (c *Config) config() *pb.Config {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -431,6 +472,13 @@ func (c *Config) hasWillJoinNode() bool {
 	return false
 }
 
+// saveTo 将当前配置写入文件path
+func (c *Config) saveTo(path string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return os.WriteFile(path, []byte(wkutil.ToJSON(c.cfg)), 0644)
+}
+
 func (c *Config) saveConfig() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,56 @@
+package clusterconfig
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigNodeLeave(t *testing.T) {
+	cfg := NewConfig(NewOptions(WithConfigPath(t.TempDir() + "/config.json")))
+	cfg.addNode(&pb.Node{Id: 1, Status: pb.NodeStatus_NodeStatusJoined, AllowVote: true})
+	cfg.addNode(&pb.Node{Id: 2, Status: pb.NodeStatus_NodeStatusJoined, AllowVote: true})
+	cfg.addNode(&pb.Node{Id: 3, Status: pb.NodeStatus_NodeStatusJoined, AllowVote: true})
+
+	assert.Nil(t, cfg.leavingNode())
+
+	// 离开中的节点不再属于已加入的节点
+	cfg.updateNodeStatus(2, pb.NodeStatus_NodeStatusLeaving)
+	assert.Equal(t, uint64(2), cfg.leavingNode().Id)
+	assert.Equal(t, 2, cfg.allowVoteAndJoinedNodeCount())
+
+	// 离开后从节点列表中移除
+	cfg.removeNode(2)
+	assert.Nil(t, cfg.leavingNode())
+	assert.Nil(t, cfg.node(2))
+	assert.Equal(t, 2, len(cfg.nodes()))
+}
+
+func TestReplicaConfigOfProxyNode(t *testing.T) {
+	cfg := &pb.Config{
+		Nodes: []*pb.Node{
+			{Id: 1, Status: pb.NodeStatus_NodeStatusJoined, AllowVote: true},
+			{Id: 2, Status: pb.NodeStatus_NodeStatusJoined, AllowVote: true},
+			{Id: 3, Status: pb.NodeStatus_NodeStatusWillJoin, Role: pb.NodeRole_NodeRoleProxy},
+		},
+		Learners:    []uint64{3},
+		MigrateFrom: 3,
+		MigrateTo:   3,
+	}
+
+	// 加入中的代理节点作为学习者追赶日志
+	replicaCfg := replicaConfigOf(cfg)
+	assert.Equal(t, []uint64{1, 2}, replicaCfg.Replicas)
+	assert.Equal(t, []uint64{3}, replicaCfg.Learners)
+	assert.Equal(t, uint64(3), replicaCfg.MigrateTo)
+
+	// 加入后的代理节点仍然是学习者，不参与选举
+	cfg.Nodes[2].Status = pb.NodeStatus_NodeStatusJoined
+	cfg.Learners = nil
+	replicaCfg = replicaConfigOf(cfg)
+	assert.Equal(t, []uint64{1, 2}, replicaCfg.Replicas)
+	assert.Equal(t, []uint64{3}, replicaCfg.Learners)
+	assert.Equal(t, uint64(0), replicaCfg.MigrateFrom)
+	assert.Equal(t, uint64(0), replicaCfg.MigrateTo)
+}
@@ -295,3 +295,12 @@ func (h *handler) DeleteLeaderTermStartIndexGreaterThanTerm(term uint32) error {
 func (h *handler) TruncateLogTo(index uint64) error {
 	return h.storage.TruncateLogTo(index)
 }
+
+// 配置日志不压缩，所以不需要快照
+func (h *handler) GetSnapshot() (uint64, uint32, []byte, error) {
+	return 0, 0, nil, replica.ErrSnapshotNotSupported
+}
+
+func (h *handler) InstallSnapshot(index uint64, term uint32, data []byte) error {
+	return replica.ErrSnapshotNotSupported
+}
@@ -79,28 +79,40 @@ func New(opts *Options) *Server {
 
 func (s *Server) SwitchConfig(cfg *pb.Config) error {
 
+	err := s.configReactor.StepWait(s.handlerKey, replica.Message{
+		MsgType: replica.MsgConfigResp,
+		Config:  replicaConfigOf(cfg),
+	})
+	return err
+}
+
+// 分布式配置对应的副本配置
+func replicaConfigOf(cfg *pb.Config) replica.Config {
 	replicas := make([]uint64, 0, len(cfg.Nodes))
+	learners := append([]uint64(nil), cfg.Learners...)
+	migrateFrom, migrateTo := cfg.MigrateFrom, cfg.MigrateTo
 	for _, node := range cfg.Nodes {
 		if len(cfg.Learners) > 0 && wkutil.ArrayContainsUint64(cfg.Learners, node.Id) {
 			continue
 		}
+		if !node.AllowVote { // 不允许投票的节点（代理节点）一直作为学习者同步配置，不参与选举
+			learners = append(learners, node.Id)
+			if migrateTo == node.Id { // 已经加入集群，不再需要转换角色
+				migrateFrom, migrateTo = 0, 0
+			}
+			continue
+		}
 		replicas = append(replicas, node.Id)
 	}
 
-	replicaCfg := replica.Config{
-		MigrateFrom: cfg.MigrateFrom,
-		MigrateTo:   cfg.MigrateTo,
-		Learners:    cfg.Learners,
+	return replica.Config{
+		MigrateFrom: migrateFrom,
+		MigrateTo:   migrateTo,
+		Learners:    learners,
 		Replicas:    replicas,
 		Term:        cfg.Term,
 		Version:     cfg.Version,
 	}
-
-	err := s.configReactor.StepWait(s.handlerKey, replica.Message{
-		MsgType: replica.MsgConfigResp,
-		Config:  replicaCfg,
-	})
-	return err
 }
 
 func (s *Server) Start() error {
@@ -158,6 +170,14 @@ func (s *Server) Stop() {
 	}
 }
 
+// Checkpoint 将配置日志和当前配置写入目录dir，配置文件名与ConfigPath的文件名一致
+func (s *Server) Checkpoint(dir string) error {
+	if err := s.storage.Checkpoint(path.Join(dir, "cfglogdb")); err != nil {
+		return err
+	}
+	return s.cfg.saveTo(path.Join(dir, path.Base(s.opts.ConfigPath)))
+}
+
 // AddMessage 添加消息
 func (s *Server) AddMessage(m reactor.Message) {
 	s.configReactor.AddMessage(m)
@@ -230,6 +250,11 @@ func (s *Server) OnlineNodes() []*pb.Node {
 	return s.cfg.onlineNodes()
 }
 
+// LeavingNode 获取正在离开的节点
+func (s *Server) LeavingNode() *pb.Node {
+	return s.cfg.leavingNode()
+}
+
 func (s *Server) IsLeader() bool {
 	return s.handler.isLeader()
 }
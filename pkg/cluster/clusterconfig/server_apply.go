@@ -69,6 +69,12 @@ func (s *Server) handleCmd(cmd *CMD) error {
 		return s.handleSlotUpdate(cmd)
 	case CMDTypeNodeStatusChange: // 节点状态改变
 		return s.handleNodeStatusChange(cmd)
+	case CMDTypeNodeLeave: // 节点离开
+		return s.handleNodeLeave(cmd)
+	case CMDTypeNodeLeft: // 节点已离开
+		return s.handleNodeLeft(cmd)
+	case CMDTypeNodeLocationChange: // 节点位置变更
+		return s.handleNodeLocationChange(cmd)
 	}
 	return nil
 }
@@ -97,6 +103,16 @@ func (s *Server) handleApiServerAddrChange(cmd *CMD) error {
 	return nil
 }
 
+func (s *Server) handleNodeLocationChange(cmd *CMD) error {
+	nodeId, zone, rack, err := DecodeNodeLocationChange(cmd.Data)
+	if err != nil {
+		s.Error("decode node location change err", zap.Error(err))
+		return err
+	}
+	s.cfg.updateNodeLocation(nodeId, zone, rack)
+	return nil
+}
+
 func (s *Server) handleNodeJoin(cmd *CMD) error {
 
 	newNode := &pb.Node{}
@@ -180,3 +196,15 @@ func (s *Server) handleNodeStatusChange(cmd *CMD) error {
 	s.cfg.updateNodeStatus(nodeId, status)
 	return nil
 }
+
+func (s *Server) handleNodeLeave(cmd *CMD) error {
+	nodeId := binary.BigEndian.Uint64(cmd.Data)
+	s.cfg.updateNodeStatus(nodeId, pb.NodeStatus_NodeStatusLeaving)
+	return nil
+}
+
+func (s *Server) handleNodeLeft(cmd *CMD) error {
+	nodeId := binary.BigEndian.Uint64(cmd.Data)
+	s.cfg.removeNode(nodeId)
+	return s.SwitchConfig(s.cfg.cfg)
+}
@@ -64,6 +64,34 @@ func (s *Server) ProposeApiServerAddr(nodeId uint64, apiServerAddr string) error
 	return nil
 }
 
+// ProposeNodeLocation 提案节点位置（可用区和机架）变更
+func (s *Server) ProposeNodeLocation(nodeId uint64, zone, rack string) error {
+
+	data, err := EncodeNodeLocationChange(nodeId, zone, rack)
+	if err != nil {
+		return err
+	}
+
+	cmd := NewCMD(CMDTypeNodeLocationChange, data)
+	cmdBytes, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = s.proposeAndWait([]replica.Log{
+		{
+			Id:   uint64(s.cfgGenId.Generate().Int64()),
+			Data: cmdBytes,
+		},
+	})
+	if err != nil {
+		s.Error("ProposeNodeLocation failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
 // ProposeJoin 提案节点加入
 func (s *Server) ProposeJoin(node *pb.Node) error {
 
@@ -244,3 +272,49 @@ func (s *Server) ProposeNodeStatus(nodeId uint64, status pb.NodeStatus) error {
 	}
 	return nil
 }
+
+// ProposeNodeLeave 提案节点离开，节点会进入离开中状态，等节点上的槽和频道迁出后再移除
+func (s *Server) ProposeNodeLeave(nodeId uint64) error {
+	nodeIdBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(nodeIdBytes, nodeId)
+
+	cmd := NewCMD(CMDTypeNodeLeave, nodeIdBytes)
+	cmdBytes, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	err = s.proposeAndWait([]replica.Log{
+		{
+			Id:   uint64(s.cfgGenId.Generate().Int64()),
+			Data: cmdBytes,
+		},
+	})
+	if err != nil {
+		s.Error("ProposeNodeLeave failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ProposeNodeLeft 提案节点已离开，节点会从配置中移除
+func (s *Server) ProposeNodeLeft(nodeId uint64) error {
+	nodeIdBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(nodeIdBytes, nodeId)
+
+	cmd := NewCMD(CMDTypeNodeLeft, nodeIdBytes)
+	cmdBytes, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	err = s.proposeAndWait([]replica.Log{
+		{
+			Id:   uint64(s.cfgGenId.Generate().Int64()),
+			Data: cmdBytes,
+		},
+	})
+	if err != nil {
+		s.Error("ProposeNodeLeft failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
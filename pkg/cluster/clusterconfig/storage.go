@@ -41,6 +41,11 @@ func (p *PebbleShardLogStorage) Open() error {
 	return nil
 }
 
+// Checkpoint 将配置日志的一致性快照写入目录dir
+func (p *PebbleShardLogStorage) Checkpoint(dir string) error {
+	return p.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
+
 func (p *PebbleShardLogStorage) Close() error {
 	err := p.db.Close()
 	if err != nil {
@@ -1,6 +1,7 @@
 package clusterevent
 
 import (
+	"sort"
 	"strings"
 	"time"
 
@@ -52,6 +53,20 @@ func (s *Server) checkClusterConfig() error {
 			return err
 		}
 
+		// 处理正在离开的节点
+		err = s.handleNodeLeaving()
+		if err != nil {
+			s.Error("handleNodeLeaving failed", zap.Error(err))
+			return err
+		}
+
+		// 将没有按可用区（机架）分散的槽副本迁移到其他故障域
+		err = s.handleSlotReplicaSpread()
+		if err != nil {
+			s.Error("handleSlotReplicaSpread failed", zap.Error(err))
+			return err
+		}
+
 		// 检查和均衡槽领导
 		err = s.handleSlotLeaderAutoBalance()
 		if err != nil {
@@ -119,13 +134,17 @@ func (s *Server) handleClusterConfigInit() error {
 	var replicas []uint64
 	for nodeId, addr := range s.opts.InitNodes {
 		apiAddr := ""
+		zone, rack := "", ""
 		if nodeId == s.opts.NodeId {
 			apiAddr = s.opts.ApiServerAddr
+			zone, rack = s.opts.Zone, s.opts.Rack
 		}
 		nodes = append(nodes, &pb.Node{
 			Id:            nodeId,
 			ClusterAddr:   addr,
 			ApiServerAddr: apiAddr,
+			Zone:          zone,
+			Rack:          rack,
 			Online:        true,
 			AllowVote:     true,
 			Role:          pb.NodeRole_NodeRoleReplica,
@@ -201,6 +220,16 @@ func (s *Server) handleCompareLocalClusterConfig() error {
 		}
 	}
 
+	// 如果配置里自己节点的可用区或机架与本地配置不同，则提案配置
+	localNode := s.cfgServer.Node(s.opts.NodeId)
+	if localNode != nil && (localNode.Zone != s.opts.Zone || localNode.Rack != s.opts.Rack) {
+		err := s.cfgServer.ProposeNodeLocation(s.opts.NodeId, s.opts.Zone, s.opts.Rack)
+		if err != nil {
+			s.Error("ProposeNodeLocation failed", zap.Error(err))
+			return err
+		}
+	}
+
 	if s.IsLeader() {
 		// 节点在线状态改变
 		err := s.handleNodeOnlineStatusChange()
@@ -237,6 +266,57 @@ func (s *Server) autoBalanceSlotLeaders(cfg *pb.Config) []*pb.Slot {
 		}
 	}
 
+	var nodeOf = func(nodeId uint64) *pb.Node {
+		for _, node := range cfg.Nodes {
+			if node.Id == nodeId {
+				return node
+			}
+		}
+		return nil
+	}
+
+	var nodeOnline = func(nodeId uint64) bool {
+		node := nodeOf(nodeId)
+		return node != nil && node.Online
+	}
+
+	// ==================== 优先将槽领导迁移到首选可用区 ====================
+	preferredZones := s.opts.PreferredLeaderZones
+	if len(preferredZones) > 0 {
+		nodeLeaderCountMap := make(map[uint64]uint32)
+		for _, slot := range slots {
+			nodeLeaderCountMap[slot.Leader]++
+		}
+		var newSlots []*pb.Slot
+		for _, slot := range slots {
+			if slot.Leader == 0 || inZones(nodeOf(slot.Leader), preferredZones) {
+				continue
+			}
+			// 选择首选可用区里领导数量最少的在线副本
+			var toNodeId uint64
+			for _, replicaId := range slot.Replicas {
+				if !nodeOnline(replicaId) || !inZones(nodeOf(replicaId), preferredZones) {
+					continue
+				}
+				if toNodeId == 0 || nodeLeaderCountMap[replicaId] < nodeLeaderCountMap[toNodeId] {
+					toNodeId = replicaId
+				}
+			}
+			if toNodeId == 0 {
+				continue
+			}
+			newSlot := slot.Clone()
+			newSlot.MigrateFrom = slot.Leader
+			newSlot.MigrateTo = toNodeId
+			newSlots = append(newSlots, newSlot)
+			nodeLeaderCountMap[slot.Leader]--
+			nodeLeaderCountMap[toNodeId]++
+		}
+		if len(newSlots) > 0 { // 等迁移到首选可用区完成后再按数量均衡
+			return newSlots
+		}
+	}
+
 	// 计算每个节点的槽数量和领导数量
 	nodeSlotCountMap := make(map[uint64]uint32)   // 每个节点槽数量
 	nodeLeaderCountMap := make(map[uint64]uint32) // 每个节点槽领导数量
@@ -282,15 +362,6 @@ func (s *Server) autoBalanceSlotLeaders(cfg *pb.Config) []*pb.Slot {
 
 	// ==================== 迁移槽领导 ====================
 
-	var nodeOnline = func(nodeId uint64) bool {
-		for _, node := range cfg.Nodes {
-			if node.Id == nodeId {
-				return node.Online
-			}
-		}
-		return false
-	}
-
 	var newSlots []*pb.Slot
 	for exportNodeId, exportLeaderCount := range exportNodeLeaderCountMap {
 		if exportLeaderCount == 0 {
@@ -308,6 +379,11 @@ func (s *Server) autoBalanceSlotLeaders(cfg *pb.Config) []*pb.Slot {
 			if !nodeOnline(importNodeId) { // 节点不在线 不参与
 				continue
 			}
+
+			// 不将槽领导从首选可用区迁移到非首选可用区
+			if len(preferredZones) > 0 && inZones(nodeOf(exportNodeId), preferredZones) && !inZones(nodeOf(importNodeId), preferredZones) {
+				continue
+			}
 			// 从exportNodeId迁移一个槽领导到importNodeId
 			for _, slot := range slots {
 				if slot.MigrateFrom != 0 || slot.MigrateTo != 0 { // 已经需要转移的不参与计算
@@ -348,6 +424,10 @@ func (s *Server) handleNodeJoining() error {
 		return nil
 	}
 
+	if !joiningNode.AllowVote { // 不允许投票的节点（代理节点）不分配槽副本，直接加入
+		return s.ProposeJoined(joiningNode.Id, nil)
+	}
+
 	firstSlot := slots[0]
 
 	var migrateSlots []*pb.Slot // 迁移的槽列表
@@ -412,7 +492,21 @@ func (s *Server) handleNodeJoining() error {
 				continue
 			}
 
+			// 副本迁到新节点后更分散的槽优先迁移，更集中的槽不迁移
+			spreadMap := make(map[uint32]int, len(slots))
+			orderedSlots := make([]*pb.Slot, len(slots))
+			copy(orderedSlots, slots)
 			for _, slot := range slots {
+				spreadMap[slot.Id] = compareSpreadMove(slot.Replicas, node, joiningNode, voteNodes)
+			}
+			sort.SliceStable(orderedSlots, func(i, j int) bool {
+				return spreadMap[orderedSlots[i].Id] > spreadMap[orderedSlots[j].Id]
+			})
+
+			for _, slot := range orderedSlots {
+				if spreadMap[slot.Id] < 0 {
+					continue
+				}
 				exist := false // 是否存在迁移，如果存在则忽略
 
 				for _, migrateSlot := range migrateSlots {
@@ -474,6 +568,152 @@ func (s *Server) handleNodeJoining() error {
 
 }
 
+// 将离开中的节点上的槽副本迁移到其他节点，槽全部迁出后交给上层处理频道
+func (s *Server) handleNodeLeaving() error {
+	leavingNode := s.cfgServer.LeavingNode()
+	if leavingNode == nil {
+		return nil
+	}
+	slots := s.cfgServer.Slots()
+
+	// 可以迁入槽的节点（离开中的节点不属于已加入的节点）
+	targetNodes := s.cfgServer.AllowVoteAndJoinedOnlineNodes()
+
+	nodeSlotCountMap := make(map[uint64]uint32) // 每个节点目前的槽数量
+	for _, slot := range slots {
+		for _, replicaId := range slot.Replicas {
+			nodeSlotCountMap[replicaId]++
+		}
+	}
+
+	var (
+		migrateSlots []*pb.Slot // 迁移的槽列表
+		remaining    bool       // 是否还有槽在离开的节点上
+	)
+	for _, slot := range slots {
+		if !wkutil.ArrayContainsUint64(slot.Replicas, leavingNode.Id) && !wkutil.ArrayContainsUint64(slot.Learners, leavingNode.Id) {
+			continue
+		}
+		remaining = true
+
+		if slot.MigrateFrom != 0 || slot.MigrateTo != 0 || slot.Status == pb.SlotStatus_SlotStatusCandidate { // 正在迁移或选举中，等待完成
+			continue
+		}
+
+		// 选择槽数量最少并且不是此槽副本的节点作为迁入节点
+		var toNodeId uint64
+		for _, node := range targetNodes {
+			if wkutil.ArrayContainsUint64(slot.Replicas, node.Id) || wkutil.ArrayContainsUint64(slot.Learners, node.Id) {
+				continue
+			}
+			if toNodeId == 0 || nodeSlotCountMap[node.Id] < nodeSlotCountMap[toNodeId] {
+				toNodeId = node.Id
+			}
+		}
+
+		newSlot := slot.Clone()
+		if toNodeId != 0 { // 迁移到新节点，新节点追上日志后会替换掉离开的节点
+			newSlot.MigrateFrom = leavingNode.Id
+			newSlot.MigrateTo = toNodeId
+			newSlot.Learners = append(newSlot.Learners, toNodeId)
+			nodeSlotCountMap[toNodeId]++
+		} else if slot.Leader == leavingNode.Id { // 没有可迁入的节点，先将领导转移给其他在线的副本
+			for _, replicaId := range slot.Replicas {
+				if replicaId != leavingNode.Id && s.cfgServer.NodeOnline(replicaId) {
+					toNodeId = replicaId
+					break
+				}
+			}
+			if toNodeId == 0 {
+				s.Warn("no replica can take over slot leader", zap.Uint32("slotId", slot.Id), zap.Uint64("leavingNodeId", leavingNode.Id))
+				continue
+			}
+			newSlot.MigrateFrom = leavingNode.Id
+			newSlot.MigrateTo = toNodeId
+		} else { // 没有可迁入的节点，直接从副本中移除
+			newSlot.Replicas = wkutil.RemoveUint64(newSlot.Replicas, leavingNode.Id)
+			newSlot.Learners = wkutil.RemoveUint64(newSlot.Learners, leavingNode.Id)
+		}
+		migrateSlots = append(migrateSlots, newSlot)
+	}
+
+	if len(migrateSlots) > 0 {
+		s.Info("migrate slots off leaving node", zap.Uint64("nodeId", leavingNode.Id), zap.Int("slotCount", len(migrateSlots)))
+		return s.ProposeSlots(migrateSlots)
+	}
+	if remaining { // 等待槽迁移完成
+		return nil
+	}
+
+	if s.opts.OnNodeLeaving != nil {
+		s.opts.OnNodeLeaving(leavingNode.Id)
+	}
+	return nil
+}
+
+// slotReplicaSpreadBatchSize 每次最多迁移的未分散的槽数量，迁移完成后下次检查再继续
+const slotReplicaSpreadBatchSize = 4
+
+// 将没有按可用区（机架）分散的槽副本迁移到其他故障域的节点，每次最多迁移slotReplicaSpreadBatchSize个槽
+func (s *Server) handleSlotReplicaSpread() error {
+	cfg := s.cfgServer.Config()
+
+	// 有未加入的节点或者有槽正在迁移，则不处理
+	for _, node := range cfg.Nodes {
+		if node.Status != pb.NodeStatus_NodeStatusJoined {
+			return nil
+		}
+		// 滚动配置可用区的过程中只有部分节点有可用区，此时不迁移，避免来回迁移
+		if node.AllowVote && node.Zone == "" {
+			return nil
+		}
+	}
+	for _, slot := range cfg.Slots {
+		if slot.MigrateFrom != 0 || slot.MigrateTo != 0 {
+			return nil
+		}
+		if slot.Status == pb.SlotStatus_SlotStatusCandidate {
+			return nil
+		}
+	}
+
+	targetNodes := s.cfgServer.AllowVoteAndJoinedOnlineNodes()
+	nodeSlotCountMap := make(map[uint64]uint32) // 每个节点目前的槽数量
+	for _, slot := range cfg.Slots {
+		for _, replicaId := range slot.Replicas {
+			nodeSlotCountMap[replicaId]++
+		}
+	}
+
+	var migrateSlots []*pb.Slot
+	for _, slot := range cfg.Slots {
+		// 槽数量少的节点优先迁入
+		sort.SliceStable(targetNodes, func(i, j int) bool {
+			return nodeSlotCountMap[targetNodes[i].Id] < nodeSlotCountMap[targetNodes[j].Id]
+		})
+		fromNodeId, toNodeId, violated := spreadMove(slot.Replicas, slot.Learners, slot.Leader, targetNodes)
+		if !violated || toNodeId == 0 {
+			continue
+		}
+		newSlot := slot.Clone()
+		newSlot.MigrateFrom = fromNodeId
+		newSlot.MigrateTo = toNodeId
+		newSlot.Learners = append(newSlot.Learners, toNodeId)
+		migrateSlots = append(migrateSlots, newSlot)
+		nodeSlotCountMap[fromNodeId]--
+		nodeSlotCountMap[toNodeId]++
+		if len(migrateSlots) >= slotReplicaSpreadBatchSize {
+			break
+		}
+	}
+
+	if len(migrateSlots) > 0 {
+		s.Info("migrate slot replicas across zones", zap.Int("slotCount", len(migrateSlots)))
+		return s.ProposeSlots(migrateSlots)
+	}
+	return nil
+}
+
 func (s *Server) handleNodeOnlineStatusChange() error {
 	// 判断节点在线状态是否改变
 	for _, node := range s.remoteCfg.Nodes {
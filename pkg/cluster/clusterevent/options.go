@@ -17,8 +17,12 @@ type Options struct {
 	ChannelMaxReplicaCount uint32 // 每个频道最大副本数量
 	ConfigDir              string
 	ApiServerAddr          string                       // api服务地址
+	Zone                   string                       // 节点所在的可用区
+	Rack                   string                       // 节点所在的机架
+	PreferredLeaderZones   []string                     // 槽领导优先分布的可用区
 	OnClusterConfigChange  func(cfg *pb.Config)         // 分布式配置改变
 	OnSlotElection         func(slots []*pb.Slot) error // 槽位选举
+	OnNodeLeaving          func(nodeId uint64)          // 离开中的节点的槽已全部迁出，由上层继续迁出频道并移除节点
 	Send                   func(m reactor.Message)      // 发送消息
 	// PongMaxTick 节点超过多少tick没有回应心跳就认为是掉线
 	PongMaxTick int
@@ -105,6 +109,24 @@ func WithApiServerAddr(apiServerAddr string) Option {
 	}
 }
 
+func WithZone(zone string) Option {
+	return func(o *Options) {
+		o.Zone = zone
+	}
+}
+
+func WithRack(rack string) Option {
+	return func(o *Options) {
+		o.Rack = rack
+	}
+}
+
+func WithPreferredLeaderZones(zones []string) Option {
+	return func(o *Options) {
+		o.PreferredLeaderZones = zones
+	}
+}
+
 func WithCluster(cluster icluster.Cluster) Option {
 	return func(o *Options) {
 		o.Cluster = cluster
@@ -152,3 +174,9 @@ func WithOnSlotElection(f func(slots []*pb.Slot) error) Option {
 		o.OnSlotElection = f
 	}
 }
+
+func WithOnNodeLeaving(f func(nodeId uint64)) Option {
+	return func(o *Options) {
+		o.OnNodeLeaving = f
+	}
+}
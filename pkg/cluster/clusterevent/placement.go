@@ -0,0 +1,152 @@
+package clusterevent
+
+import (
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+)
+
+// 故障域的层级，副本先按可用区分散，可用区分散后再按机架分散
+var domainLevels = []func(n *pb.Node) string{
+	func(n *pb.Node) string { return n.Zone },
+	func(n *pb.Node) string {
+		if n.Zone == "" && n.Rack == "" {
+			return ""
+		}
+		return n.Zone + "/" + n.Rack
+	},
+}
+
+// SpreadViolated 副本是否没有按故障域分散
+// 副本占用的可用区（机架）数量少于min(副本数量, 候选节点的可用区（机架）数量)时视为违反分散约束，没有配置可用区和机架的集群不做约束
+func SpreadViolated(replicas []uint64, nodes []*pb.Node) bool {
+	_, _, violated := spreadMove(replicas, nil, 0, nodes)
+	return violated
+}
+
+// spreadMove 找出违反分散约束时需要迁出的副本和迁入的节点（迁入节点为0表示没有可迁入的节点）
+// 迁出的副本在副本最多的故障域里选（尽量不选领导），迁入的节点必须在副本还没有占用的故障域里，nodes的顺序决定迁入节点的优先级
+func spreadMove(replicas []uint64, learners []uint64, leader uint64, nodes []*pb.Node) (from uint64, to uint64, violated bool) {
+	nodeMap := make(map[uint64]*pb.Node, len(nodes))
+	for _, n := range nodes {
+		nodeMap[n.Id] = n
+	}
+	for _, domainOf := range domainLevels {
+		domains := make(map[string]bool)
+		for _, n := range nodes {
+			domains[domainOf(n)] = true
+		}
+		if len(domains) <= 1 { // 只有一个故障域（或者都没有配置），无法分散
+			continue
+		}
+		replicaDomains := make(map[string][]uint64)
+		for _, replicaId := range replicas {
+			n := nodeMap[replicaId]
+			if n == nil {
+				continue
+			}
+			replicaDomains[domainOf(n)] = append(replicaDomains[domainOf(n)], replicaId)
+		}
+		expect := len(domains)
+		if len(replicas) < expect {
+			expect = len(replicas)
+		}
+		if len(replicaDomains) >= expect {
+			continue
+		}
+
+		// 副本最多的故障域
+		var crowded []uint64
+		for _, ids := range replicaDomains {
+			if len(ids) > len(crowded) {
+				crowded = ids
+			}
+		}
+		for _, replicaId := range crowded {
+			if from == 0 || from == leader {
+				from = replicaId
+			}
+		}
+		for _, n := range nodes {
+			if _, ok := replicaDomains[domainOf(n)]; ok {
+				continue
+			}
+			if wkutil.ArrayContainsUint64(replicas, n.Id) || wkutil.ArrayContainsUint64(learners, n.Id) {
+				continue
+			}
+			to = n.Id
+			break
+		}
+		return from, to, true
+	}
+	return 0, 0, false
+}
+
+// SelectSpreadNodes 按candidates的顺序选出count个节点，优先选择与selected以及已选出的节点不在同一可用区的节点，其次是不在同一机架的节点
+func SelectSpreadNodes(candidates []*pb.Node, selected []*pb.Node, count int) []*pb.Node {
+	used := make([]map[string]bool, len(domainLevels))
+	for i, domainOf := range domainLevels {
+		used[i] = make(map[string]bool)
+		for _, n := range selected {
+			used[i][domainOf(n)] = true
+		}
+	}
+	remaining := make([]*pb.Node, len(candidates))
+	copy(remaining, candidates)
+	result := make([]*pb.Node, 0, count)
+	for len(result) < count && len(remaining) > 0 {
+		best := 0
+		bestScore := -1
+		for i, n := range remaining {
+			score := 0
+			for level, domainOf := range domainLevels {
+				if !used[level][domainOf(n)] {
+					score += 1 << (len(domainLevels) - level) // 可用区不同的优先级高于机架不同
+				}
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		n := remaining[best]
+		result = append(result, n)
+		for level, domainOf := range domainLevels {
+			used[level][domainOf(n)] = true
+		}
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return result
+}
+
+// compareSpreadMove 将副本从from迁移到to后副本的分散程度的变化：1为更分散，0为不变，-1为更集中
+func compareSpreadMove(replicas []uint64, from *pb.Node, to *pb.Node, nodes []*pb.Node) int {
+	rest := make([]*pb.Node, 0, len(replicas))
+	for _, n := range nodes {
+		if n.Id != from.Id && wkutil.ArrayContainsUint64(replicas, n.Id) {
+			rest = append(rest, n)
+		}
+	}
+	// 分散程度相同时SelectSpreadNodes选择排在前面的节点
+	if SelectSpreadNodes([]*pb.Node{to, from}, rest, 1)[0] == from {
+		return -1
+	}
+	if SelectSpreadNodes([]*pb.Node{from, to}, rest, 1)[0] == to {
+		return 1
+	}
+	return 0
+}
+
+// inZones 节点是否在zones里，zones为空表示不限制
+func inZones(n *pb.Node, zones []string) bool {
+	if n == nil {
+		return false
+	}
+	if len(zones) == 0 {
+		return true
+	}
+	for _, zone := range zones {
+		if n.Zone == zone {
+			return true
+		}
+	}
+	return false
+}
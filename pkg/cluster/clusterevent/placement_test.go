@@ -0,0 +1,113 @@
+package clusterevent
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNodes() []*pb.Node {
+	return []*pb.Node{
+		{Id: 1, Zone: "az1", Rack: "r1", Online: true},
+		{Id: 2, Zone: "az1", Rack: "r2", Online: true},
+		{Id: 3, Zone: "az2", Rack: "r1", Online: true},
+		{Id: 4, Zone: "az2", Rack: "r2", Online: true},
+		{Id: 5, Zone: "az3", Rack: "r1", Online: true},
+	}
+}
+
+func TestSpreadViolated(t *testing.T) {
+	nodes := testNodes()
+
+	assert.False(t, SpreadViolated([]uint64{1, 3, 5}, nodes))
+	assert.True(t, SpreadViolated([]uint64{1, 2, 3}, nodes))
+	assert.False(t, SpreadViolated([]uint64{1, 3}, nodes))
+	assert.True(t, SpreadViolated([]uint64{1, 2}, nodes))
+
+	// 只有一个可用区时按机架分散
+	sameZone := []*pb.Node{{Id: 1, Zone: "az1", Rack: "r1"}, {Id: 2, Zone: "az1", Rack: "r1"}, {Id: 3, Zone: "az1", Rack: "r2"}}
+	assert.True(t, SpreadViolated([]uint64{1, 2}, sameZone))
+	assert.False(t, SpreadViolated([]uint64{1, 3}, sameZone))
+
+	// 没有配置可用区和机架不做约束
+	noLabel := []*pb.Node{{Id: 1}, {Id: 2}, {Id: 3}}
+	assert.False(t, SpreadViolated([]uint64{1, 2, 3}, noLabel))
+}
+
+func TestSpreadMove(t *testing.T) {
+	nodes := testNodes()
+
+	from, to, violated := spreadMove([]uint64{1, 2, 3}, nil, 1, nodes)
+	assert.True(t, violated)
+	assert.Equal(t, uint64(2), from) // 不迁移领导
+	assert.Equal(t, uint64(5), to)
+
+	_, to, violated = spreadMove([]uint64{1, 2, 3}, []uint64{5}, 1, nodes)
+	assert.True(t, violated)
+	assert.Equal(t, uint64(0), to) // 唯一可迁入的节点已经是学习者
+}
+
+func TestCompareSpreadMove(t *testing.T) {
+	nodes := testNodes()
+
+	assert.Equal(t, 1, compareSpreadMove([]uint64{1, 2, 3}, nodes[1], nodes[4], nodes))  // 迁到新的可用区
+	assert.Equal(t, 0, compareSpreadMove([]uint64{1, 3, 5}, nodes[2], nodes[3], nodes))  // 同一个可用区内迁移
+	assert.Equal(t, -1, compareSpreadMove([]uint64{1, 3, 5}, nodes[4], nodes[1], nodes)) // 迁到已有副本的可用区
+}
+
+func TestSelectSpreadNodes(t *testing.T) {
+	nodes := testNodes()
+
+	selected := SelectSpreadNodes(nodes[1:], nodes[:1], 2)
+	assert.Len(t, selected, 2)
+	assert.Equal(t, uint64(3), selected[0].Id)
+	assert.Equal(t, uint64(5), selected[1].Id)
+
+	// 可用区都已使用时选择不同机架的节点
+	selected = SelectSpreadNodes([]*pb.Node{nodes[2], nodes[3]}, []*pb.Node{nodes[0], nodes[2]}, 1)
+	assert.Equal(t, uint64(4), selected[0].Id)
+
+	// 候选节点不够时全部返回
+	selected = SelectSpreadNodes(nodes[:2], nil, 3)
+	assert.Len(t, selected, 2)
+}
+
+func TestAutoBalanceSlotLeadersPreferredZones(t *testing.T) {
+	s := &Server{opts: NewOptions(WithPreferredLeaderZones([]string{"az1"}))}
+	cfg := &pb.Config{
+		Nodes: testNodes(),
+		Slots: []*pb.Slot{
+			{Id: 0, Leader: 3, Replicas: []uint64{1, 3, 5}},
+			{Id: 1, Leader: 1, Replicas: []uint64{1, 3, 5}},
+			{Id: 2, Leader: 5, Replicas: []uint64{2, 4, 5}},
+		},
+	}
+
+	newSlots := s.autoBalanceSlotLeaders(cfg)
+	assert.Len(t, newSlots, 2)
+	for _, slot := range newSlots {
+		switch slot.Id {
+		case 0:
+			assert.Equal(t, uint64(3), slot.MigrateFrom)
+			assert.Equal(t, uint64(1), slot.MigrateTo)
+		case 2:
+			assert.Equal(t, uint64(5), slot.MigrateFrom)
+			assert.Equal(t, uint64(2), slot.MigrateTo)
+		default:
+			t.Fatalf("unexpected slot %d", slot.Id)
+		}
+	}
+
+	// 领导都在首选可用区时，不会迁移到非首选可用区
+	for _, slot := range cfg.Slots {
+		if slot.Id == 0 {
+			slot.Leader = 1
+		} else if slot.Id == 2 {
+			slot.Leader = 2
+		}
+	}
+	for _, slot := range s.autoBalanceSlotLeaders(cfg) {
+		assert.True(t, inZones(cfg.Nodes[slot.MigrateTo-1], []string{"az1"}))
+	}
+}
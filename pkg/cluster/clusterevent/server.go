@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
@@ -201,6 +202,16 @@ func (s *Server) ProposeJoin(node *pb.Node) error {
 	return s.cfgServer.ProposeJoin(node)
 }
 
+func (s *Server) ProposeNodeLeave(nodeId uint64) error {
+
+	return s.cfgServer.ProposeNodeLeave(nodeId)
+}
+
+func (s *Server) ProposeNodeLeft(nodeId uint64) error {
+
+	return s.cfgServer.ProposeNodeLeft(nodeId)
+}
+
 func (s *Server) ProposeMigrateSlot(slotId uint32, fromNodeId, toNodeId uint64) error {
 
 	return s.cfgServer.ProposeMigrateSlot(slotId, fromNodeId, toNodeId)
@@ -223,6 +234,21 @@ func (s *Server) GetLogsInReverseOrder(startLogIndex uint64, endLogIndex uint64,
 	return s.cfgServer.GetLogsInReverseOrder(startLogIndex, endLogIndex, limit)
 }
 
+// Checkpoint 将本地配置、远程配置和配置日志写入目录dir
+func (s *Server) Checkpoint(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := s.cfgServer.Checkpoint(dir); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.localCfgPath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, path.Base(s.localCfgPath)), data, 0644)
+}
+
 func (s *Server) saveLocalConfig(cfg *pb.Config) error {
 
 	err := s.localCfgFile.Truncate(0)
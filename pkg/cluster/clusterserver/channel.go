@@ -104,6 +104,7 @@ func (c *channel) switchConfig(cfg wkdb.ChannelClusterConfig) error {
 		Leader:      cfg.LeaderId,
 		Role:        role,
 		Term:        cfg.Term,
+		AckMode:     replicaAckMode(cfg.AckMode),
 	}
 
 	c.s.channelManager.channelReactor.Step(c.key, replica.Message{
@@ -157,6 +158,13 @@ func (c *channel) GetLogs(startIndex uint64, endIndex uint64) ([]replica.Log, er
 }
 
 func (c *channel) ApplyLogs(startIndex, endIndex uint64) (uint64, error) {
+	if c.opts.OnChannelApply == nil {
+		return 0, nil
+	}
+	if err := c.opts.OnChannelApply(c.channelId, c.channelType, startIndex, endIndex); err != nil {
+		c.Error("on channel apply error", zap.Error(err), zap.Uint64("startIndex", startIndex), zap.Uint64("endIndex", endIndex))
+		return 0, err
+	}
 	return 0, nil
 }
 
@@ -266,6 +274,15 @@ func (c *channel) TruncateLogTo(index uint64) error {
 	return c.opts.MessageLogStorage.TruncateLogTo(c.key, index)
 }
 
+// 频道日志即消息，不做压缩，所以不需要快照
+func (c *channel) GetSnapshot() (uint64, uint32, []byte, error) {
+	return 0, 0, nil, replica.ErrSnapshotNotSupported
+}
+
+func (c *channel) InstallSnapshot(index uint64, term uint32, data []byte) error {
+	return replica.ErrSnapshotNotSupported
+}
+
 func (c *channel) LearnerToFollower(learnerId uint64) error {
 	c.Info("learner to  follower", zap.String("channelId", c.channelId), zap.Uint8("channelType", c.channelType), zap.Uint64("learnerId", learnerId))
 
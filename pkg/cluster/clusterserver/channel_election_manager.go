@@ -126,8 +126,8 @@ func (c *channelElectionManager) election(reqs []electionReq) {
 				}
 			}
 		}
-		if len(lastInfoResps) < c.quorum() { // 如果参与选举的节点数小于法定数量，则直接返回错误
-			c.Error("not enough replicas", zap.Int("num", len(lastInfoResps)), zap.Int("lastLogInfoNum", len(channelLastLogInfoMap)), zap.Int("quorum", c.quorum()))
+		if len(lastInfoResps) < c.quorum(req.cfg) { // 如果参与选举的节点数小于法定数量，则直接返回错误
+			c.Error("not enough replicas", zap.Int("num", len(lastInfoResps)), zap.Int("lastLogInfoNum", len(channelLastLogInfoMap)), zap.Int("quorum", c.quorum(req.cfg)))
 			select {
 			case req.resultC <- electionResp{
 				err: ErrNotEnoughReplicas,
@@ -137,7 +137,7 @@ func (c *channelElectionManager) election(reqs []electionReq) {
 			}
 			continue
 		}
-		newLeaderId := c.channelLeaderIDByLogInfo(lastInfoResps) // 通过日志信息选举频道领导
+		newLeaderId := c.channelLeaderIDByLogInfo(lastInfoResps, req.cfg.PreferredLeader) // 通过日志信息选举频道领导
 		if newLeaderId == 0 {
 			select {
 			case req.resultC <- electionResp{
@@ -162,8 +162,8 @@ func (c *channelElectionManager) election(reqs []electionReq) {
 	}
 }
 
-// 通过日志高度选举频道领导
-func (c *channelElectionManager) channelLeaderIDByLogInfo(resps []*replicaChannelLastLogInfoResponse) uint64 {
+// 通过日志高度选举频道领导，优先领导节点的日志与选出的节点一样新时选择优先领导节点
+func (c *channelElectionManager) channelLeaderIDByLogInfo(resps []*replicaChannelLastLogInfoResponse, preferredLeader uint64) uint64 {
 
 	fmt.Println("channelLeaderIDByLogInfo----->", len(resps))
 
@@ -193,14 +193,25 @@ func (c *channelElectionManager) channelLeaderIDByLogInfo(resps []*replicaChanne
 			}
 		}
 	}
+	if preferredLeader != 0 && preferredLeader != leaderID {
+		for _, resp := range resps {
+			if resp.replicaId == preferredLeader && resp.Term == maxTerm && resp.LogTerm == maxLogTerm && resp.LogIndex == maxLogIndex {
+				leaderID = preferredLeader
+				break
+			}
+		}
+	}
 	fmt.Println("leaderID---->", leaderID)
 
 	return leaderID
 }
 
-func (c *channelElectionManager) quorum() int {
-
-	return int(c.s.opts.ChannelMaxReplicaCount/2) + 1
+func (c *channelElectionManager) quorum(cfg wkdb.ChannelClusterConfig) int {
+	replicaCount := int(cfg.ReplicaMaxCount) // 频道设置了副本数量时按频道的副本数量计算
+	if replicaCount == 0 {
+		replicaCount = c.s.opts.ChannelMaxReplicaCount
+	}
+	return replicaCount/2 + 1
 }
 
 func (c *channelElectionManager) requestChannelLastLogInfos(reqs []electionReq) (map[uint64][]*ChannelLastLogInfoResponse, error) {
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	"go.uber.org/zap"
+)
+
+// channelPolicy 频道的副本策略
+type channelPolicy struct {
+	ReplicaCount    uint16              // 副本数量
+	AckMode         wkdb.ChannelAckMode // 消息确认模式
+	PreferredLeader uint64              // 优先作为领导的节点
+}
+
+// 获取频道的副本策略，频道没有设置的使用全局配置
+func (s *Server) channelReplicaPolicy(channelId string, channelType uint8) (channelPolicy, error) {
+	policy := channelPolicy{
+		ReplicaCount: uint16(s.opts.ChannelMaxReplicaCount),
+	}
+	if s.opts.DB == nil {
+		return policy, nil
+	}
+	channelInfo, err := s.opts.DB.GetChannel(channelId, channelType)
+	if err != nil {
+		return policy, err
+	}
+	return newChannelPolicy(channelInfo, policy.ReplicaCount), nil
+}
+
+func newChannelPolicy(channelInfo wkdb.ChannelInfo, defaultReplicaCount uint16) channelPolicy {
+	policy := channelPolicy{
+		ReplicaCount:    defaultReplicaCount,
+		AckMode:         channelInfo.AckMode,
+		PreferredLeader: channelInfo.PreferredLeader,
+	}
+	if channelInfo.ReplicaCount > 0 {
+		policy.ReplicaCount = uint16(channelInfo.ReplicaCount)
+	}
+	return policy
+}
+
+// 频道确认模式对应的副本确认模式
+func replicaAckMode(mode wkdb.ChannelAckMode) *replica.AckMode {
+	ackMode := replica.AckModeMajority
+	switch mode {
+	case wkdb.ChannelAckModeNone:
+		ackMode = replica.AckModeNone
+	case wkdb.ChannelAckModeAll:
+		ackMode = replica.AckModeAll
+	}
+	return &ackMode
+}
+
+// 将副本策略应用到频道的分布式配置，返回新的配置和配置是否有变化
+// 副本数量减少时移除多余的追随者，优先领导节点在线时将领导转移给它，正在迁移中的配置只更新策略字段
+func applyChannelPolicy(cfg wkdb.ChannelClusterConfig, policy channelPolicy, nodeOnline func(nodeId uint64) bool) (wkdb.ChannelClusterConfig, bool) {
+	newCfg := cfg.Clone()
+	newCfg.Replicas = append([]uint64(nil), cfg.Replicas...)
+	newCfg.Learners = append([]uint64(nil), cfg.Learners...)
+	newCfg.ReplicaMaxCount = policy.ReplicaCount
+	newCfg.AckMode = policy.AckMode
+	newCfg.PreferredLeader = policy.PreferredLeader
+
+	if cfg.MigrateFrom == 0 && cfg.MigrateTo == 0 && len(cfg.Learners) == 0 {
+		// 移除多余的副本（不移除领导和优先领导节点）
+		for i := len(newCfg.Replicas) - 1; i >= 0 && len(newCfg.Replicas) > int(policy.ReplicaCount); i-- {
+			replicaId := newCfg.Replicas[i]
+			if replicaId == newCfg.LeaderId || replicaId == newCfg.PreferredLeader {
+				continue
+			}
+			newCfg.Replicas = wkutil.RemoveUint64(newCfg.Replicas, replicaId)
+		}
+
+		// 将领导转移给优先领导节点，优先领导节点不是副本时先作为学习者加入，追上日志后替换当前领导
+		preferredLeader := newCfg.PreferredLeader
+		if preferredLeader != 0 && newCfg.LeaderId != 0 && preferredLeader != newCfg.LeaderId && nodeOnline(preferredLeader) {
+			newCfg.MigrateFrom = newCfg.LeaderId
+			newCfg.MigrateTo = preferredLeader
+			if !wkutil.ArrayContainsUint64(newCfg.Replicas, preferredLeader) {
+				newCfg.Learners = append(newCfg.Learners, preferredLeader)
+			}
+		}
+	}
+	return newCfg, !cfg.Equal(newCfg)
+}
+
+// UpdateChannelReplicaPolicy 将频道信息里的副本策略（副本数量、确认模式、优先领导节点）应用到频道的分布式配置，需要在频道所属槽的领导节点上调用
+func (s *Server) UpdateChannelReplicaPolicy(ctx context.Context, channelInfo wkdb.ChannelInfo) error {
+	channelId, channelType := channelInfo.ChannelId, channelInfo.ChannelType
+	s.channelKeyLock.Lock(channelId)
+	defer s.channelKeyLock.Unlock(channelId)
+
+	clusterCfg, err := s.getChannelClusterConfig(channelId, channelType)
+	if err == wkdb.ErrNotFound { // 还没有分布式配置，创建配置时会读取频道的副本策略
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	policy := newChannelPolicy(channelInfo, uint16(s.opts.ChannelMaxReplicaCount))
+	newClusterCfg, changed := applyChannelPolicy(clusterCfg, policy, s.clusterEventServer.NodeOnline)
+	if !changed {
+		return nil
+	}
+	newClusterCfg.ConfVersion = uint64(time.Now().UnixNano())
+
+	s.Info("update channel replica policy", zap.String("channelId", channelId), zap.Uint8("channelType", channelType), zap.String("cfg", newClusterCfg.String()))
+
+	// 提案保存配置
+	err = s.opts.ChannelClusterStorage.Propose(ctx, newClusterCfg)
+	if err != nil {
+		return err
+	}
+	s.clusterCfgCache.Add(wkutil.ChannelToKey(channelId, channelType), newClusterCfg)
+
+	// 发送最新配置给频道领导（发送失败也没问题，频道领导会间隔比对自己与槽领导的配置）
+	if newClusterCfg.LeaderId != s.opts.NodeId {
+		err = s.SendChannelClusterConfigUpdate(channelId, channelType, newClusterCfg.LeaderId)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.UpdateChannelClusterConfig(newClusterCfg)
+	}
+
+	// 领导转移的目标节点不是当前节点，则发送最新配置给目标节点
+	migrateTo := newClusterCfg.MigrateTo
+	if migrateTo != 0 && migrateTo != s.opts.NodeId && migrateTo != newClusterCfg.LeaderId {
+		err = s.SendChannelClusterConfigUpdate(channelId, channelType, migrateTo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewChannelPolicy(t *testing.T) {
+	policy := newChannelPolicy(wkdb.ChannelInfo{}, 3)
+	assert.Equal(t, uint16(3), policy.ReplicaCount)
+	assert.Equal(t, replica.AckModeMajority, *replicaAckMode(policy.AckMode))
+
+	policy = newChannelPolicy(wkdb.ChannelInfo{ReplicaCount: 5, AckMode: wkdb.ChannelAckModeAll, PreferredLeader: 2}, 3)
+	assert.Equal(t, uint16(5), policy.ReplicaCount)
+	assert.Equal(t, uint64(2), policy.PreferredLeader)
+	assert.Equal(t, replica.AckModeAll, *replicaAckMode(policy.AckMode))
+	assert.Equal(t, replica.AckModeNone, *replicaAckMode(wkdb.ChannelAckModeNone))
+}
+
+func TestApplyChannelPolicy(t *testing.T) {
+	online := func(nodeId uint64) bool { return nodeId != 4 }
+	cfg := wkdb.ChannelClusterConfig{
+		ChannelId:       "test",
+		ChannelType:     2,
+		ReplicaMaxCount: 3,
+		Replicas:        []uint64{1, 2, 3},
+		LeaderId:        3,
+	}
+
+	// 没有变化
+	_, changed := applyChannelPolicy(cfg, channelPolicy{ReplicaCount: 3}, online)
+	assert.False(t, changed)
+
+	// 减少副本数量，不移除领导和优先领导节点
+	newCfg, changed := applyChannelPolicy(cfg, channelPolicy{ReplicaCount: 2, AckMode: wkdb.ChannelAckModeAll, PreferredLeader: 1}, online)
+	assert.True(t, changed)
+	assert.Equal(t, []uint64{1, 3}, newCfg.Replicas)
+	assert.Equal(t, wkdb.ChannelAckModeAll, newCfg.AckMode)
+	assert.Equal(t, uint64(3), newCfg.MigrateFrom)
+	assert.Equal(t, uint64(1), newCfg.MigrateTo)
+	assert.Equal(t, []uint64{1, 2, 3}, cfg.Replicas) // 不修改原配置
+
+	// 优先领导节点不是副本时作为学习者加入
+	newCfg, _ = applyChannelPolicy(cfg, channelPolicy{ReplicaCount: 3, PreferredLeader: 5}, online)
+	assert.Equal(t, []uint64{5}, newCfg.Learners)
+	assert.Equal(t, uint64(5), newCfg.MigrateTo)
+
+	// 优先领导节点离线时不转移领导
+	newCfg, _ = applyChannelPolicy(cfg, channelPolicy{ReplicaCount: 3, PreferredLeader: 4}, online)
+	assert.Equal(t, uint64(0), newCfg.MigrateTo)
+	assert.Len(t, newCfg.Learners, 0)
+}
@@ -25,6 +25,9 @@ var (
 	errChanIsFull                   = fmt.Errorf("channel is full")
 )
 
+// 处理离开中的节点的频道迁移的检查间隔
+const nodeLeavingCheckInterval = time.Second * 5
+
 func SlotIdToKey(slotId uint32) string {
 	return strconv.FormatUint(uint64(slotId), 10)
 }
@@ -10,6 +10,7 @@ const (
 	maxIndexKeySize             uint64 = 12
 	appliedIndexKeySize         uint64 = 12
 	leaderTermStartIndexKeySize uint64 = 16
+	compactedIndexKeySize       uint64 = 12
 )
 
 var (
@@ -17,6 +18,7 @@ var (
 	appliedIndexKey               = [2]byte{0x2, 0x2}
 	maxIndexKeyHeader             = [2]byte{0x3, 0x3}
 	leaderTermStartIndexKeyHeader = [2]byte{0x4, 0x4}
+	compactedIndexKeyHeader       = [2]byte{0x5, 0x5}
 )
 
 func NewLogKey(shardNo string, index uint64) []byte {
@@ -69,6 +71,18 @@ func NewAppliedIndexKey(shardNo string) []byte {
 	return key
 }
 
+// NewCompactedIndexKey 已压缩的日志下标（下标及之前的日志已被删除）
+func NewCompactedIndexKey(shardNo string) []byte {
+	key := make([]byte, compactedIndexKeySize)
+	shardID := shardNoToShardID(shardNo)
+	key[0] = compactedIndexKeyHeader[0]
+	key[1] = compactedIndexKeyHeader[1]
+	key[2] = 0
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], shardID)
+	return key
+}
+
 func shardNoToShardID(shardNo string) uint64 {
 	h := fnv.New64a()
 	_, err := h.Write([]byte(shardNo))
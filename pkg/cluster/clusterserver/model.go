@@ -757,6 +757,47 @@ func (s *SlotMigrateFinishReq) Unmarshal(data []byte) error {
 	return nil
 }
 
+// ChannelMigrateOffNodeReq 将频道迁出指定节点的请求
+type ChannelMigrateOffNodeReq struct {
+	NodeId uint64 // 离开的节点
+}
+
+func (c *ChannelMigrateOffNodeReq) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint64(c.NodeId)
+	return enc.Bytes(), nil
+}
+
+func (c *ChannelMigrateOffNodeReq) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if c.NodeId, err = dec.Uint64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type ChannelMigrateOffNodeResp struct {
+	Remaining uint32 // 还在节点上的频道数量
+}
+
+func (c *ChannelMigrateOffNodeResp) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(c.Remaining)
+	return enc.Bytes(), nil
+}
+
+func (c *ChannelMigrateOffNodeResp) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if c.Remaining, err = dec.Uint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
 type UpdateApiServerAddrReq struct {
 	NodeId        uint64
 	ApiServerAddr string
@@ -971,6 +1012,19 @@ type SlotRespTotal struct {
 	Data  []*SlotResp `json:"data"`  // 槽位信息
 }
 
+type SlotSpreadResp struct {
+	Id       uint32   `json:"id"`        // 槽位ID
+	LeaderId uint64   `json:"leader_id"` // 槽领导
+	Replicas []uint64 `json:"replicas"`  // 副本节点
+	Zones    []string `json:"zones"`     // 副本节点对应的可用区
+	Racks    []string `json:"racks"`     // 副本节点对应的机架
+}
+
+type SlotSpreadRespTotal struct {
+	Total int               `json:"total"` // 违反分散约束的槽数量
+	Data  []*SlotSpreadResp `json:"data"`  // 槽位信息
+}
+
 func (s *Server) requestSlotInfo(nodeId uint64, slotIds []uint32, headers map[string]string) ([]*SlotResp, error) {
 	node := s.clusterEventServer.Node(nodeId)
 	if node == nil {
@@ -1082,6 +1136,8 @@ type NodeConfig struct {
 	Role            pb.NodeRole    `json:"role"`                        // 节点角色
 	ClusterAddr     string         `json:"cluster_addr"`                // 集群地址
 	ApiServerAddr   string         `json:"api_server_addr,omitempty"`   // API服务地址
+	Zone            string         `json:"zone,omitempty"`              // 可用区
+	Rack            string         `json:"rack,omitempty"`              // 机架
 	Online          int            `json:"online,omitempty"`            // 是否在线
 	OfflineCount    int            `json:"offline_count,omitempty"`     // 下线次数
 	LastOffline     string         `json:"last_offline,omitempty"`      // 最后一次下线时间
@@ -1114,12 +1170,16 @@ func NewNodeConfigFromNode(n *pb.Node) *NodeConfig {
 		status = "加入中"
 	} else if n.Status == pb.NodeStatus_NodeStatusWillJoin {
 		status = "将加入"
+	} else if n.Status == pb.NodeStatus_NodeStatusLeaving {
+		status = "离开中"
 	}
 	return &NodeConfig{
 		Id:            n.Id,
 		Role:          n.Role,
 		ClusterAddr:   n.ClusterAddr,
 		ApiServerAddr: n.ApiServerAddr,
+		Zone:          n.Zone,
+		Rack:          n.Rack,
 		Online:        wkutil.BoolToInt(n.Online),
 		OfflineCount:  int(n.OfflineCount),
 		LastOffline:   lastOffline,
@@ -1155,6 +1215,11 @@ type channelInfoResp struct {
 	LastMsgTime       uint64 `json:"last_msg_time"`        // 频道最新消息时间
 	LastMsgTimeFormat string `json:"last_msg_time_format"` // 频道最新消息时间格式化
 	StatusFormat      string `json:"status_format"`        // 状态格式化
+	SendRateLimit     int    `json:"send_rate_limit"`      // 每秒允许发送的消息数量
+	SendRateBurst     int    `json:"send_rate_burst"`      // 允许突发发送的消息数量
+	ReplicaCount      int    `json:"replica_count"`        // 副本数量（0为使用全局配置）
+	AckMode           uint8  `json:"ack_mode"`             // 消息确认模式
+	PreferredLeader   uint64 `json:"preferred_leader"`     // 优先作为领导的节点
 }
 
 func newChannelInfoResp(ch wkdb.ChannelInfo, slotId uint32) *channelInfoResp {
@@ -1186,6 +1251,11 @@ func newChannelInfoResp(ch wkdb.ChannelInfo, slotId uint32) *channelInfoResp {
 		LastMsgTime:       ch.LastMsgTime,
 		LastMsgTimeFormat: lastMsgTimeFormat,
 		StatusFormat:      statusFormat,
+		SendRateLimit:     ch.SendRateLimit,
+		SendRateBurst:     ch.SendRateBurst,
+		ReplicaCount:      ch.ReplicaCount,
+		AckMode:           uint8(ch.AckMode),
+		PreferredLeader:   ch.PreferredLeader,
 	}
 }
 
@@ -1472,3 +1542,75 @@ type LogRespTotal struct {
 	More    int        `json:"more"`    // 是否有更多
 	Logs    []*LogResp `json:"logs"`    // 日志信息
 }
+
+// SlotSnapshotMeta 槽快照的描述信息，快照内容存在领导节点的文件里，副本按块拉取
+type SlotSnapshotMeta struct {
+	NodeId uint64 // 快照所在的节点
+	SlotId uint32
+	Index  uint64 // 快照对应的日志下标
+	Size   uint64 // 快照文件大小
+}
+
+func (s *SlotSnapshotMeta) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint64(s.NodeId)
+	enc.WriteUint32(s.SlotId)
+	enc.WriteUint64(s.Index)
+	enc.WriteUint64(s.Size)
+	return enc.Bytes(), nil
+}
+
+func (s *SlotSnapshotMeta) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if s.NodeId, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if s.SlotId, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if s.Index, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if s.Size, err = dec.Uint64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SlotSnapshotChunkReq 拉取槽快照的一块数据
+type SlotSnapshotChunkReq struct {
+	SlotId uint32
+	Index  uint64 // 快照对应的日志下标
+	Offset uint64 // 块在快照文件里的偏移
+	Limit  uint32 // 块的最大字节数
+}
+
+func (s *SlotSnapshotChunkReq) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(s.SlotId)
+	enc.WriteUint64(s.Index)
+	enc.WriteUint64(s.Offset)
+	enc.WriteUint32(s.Limit)
+	return enc.Bytes(), nil
+}
+
+func (s *SlotSnapshotChunkReq) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if s.SlotId, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if s.Index, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if s.Offset, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if s.Limit, err = dec.Uint32(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/client"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wktls"
 	"github.com/lni/goutils/netutil"
 	circuit "github.com/lni/goutils/netutil/rubyist/circuitbreaker"
 	"github.com/lni/goutils/syncutil"
@@ -32,7 +34,7 @@ type node struct {
 	opts *Options
 }
 
-func newNode(id uint64, uid string, addr string, opts *Options) *node {
+func newNode(id uint64, uid string, addr string, tlsConfig *tls.Config, opts *Options) *node {
 
 	n := &node{
 		id:                  id,
@@ -48,7 +50,16 @@ func newNode(id uint64, uid string, addr string, opts *Options) *node {
 			rl: NewRateLimiter(opts.MaxSendQueueSize),
 		},
 	}
-	n.client = client.New(addr, client.WithUID(uid), client.WithOnConnectStatus(n.connectStatusChange), client.WithRequestTimeout(opts.ReqTimeout))
+	clientOpts := []client.Option{client.WithUID(uid), client.WithOnConnectStatus(n.connectStatusChange), client.WithRequestTimeout(opts.ReqTimeout)}
+	if tlsConfig != nil {
+		clientOpts = append(clientOpts, client.WithTLSConfig(tlsConfig))
+	}
+	if opts.Secret != "" {
+		clientOpts = append(clientOpts, client.WithTokenFunc(func() string {
+			return wktls.SignToken(opts.Secret, uid, time.Now()) // 每次连接重新签名，token过期后不能重放
+		}))
+	}
+	n.client = client.New(addr, clientOpts...)
 	return n
 }
 
@@ -306,6 +317,41 @@ func (n *node) requestChangeSlotRole(ctx context.Context, req *ChangeSlotRoleReq
 	return nil
 }
 
+func (n *node) requestSlotSnapshotChunk(ctx context.Context, req *SlotSnapshotChunkReq) ([]byte, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.client.RequestWithContext(ctx, "/slot/snapshotChunk", data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != proto.Status_OK {
+		return nil, fmt.Errorf("requestSlotSnapshotChunk is failed, status:%d", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (n *node) requestChannelMigrateOffNode(ctx context.Context, req *ChannelMigrateOffNodeReq) (*ChannelMigrateOffNodeResp, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.client.RequestWithContext(ctx, "/channel/migrateOffNode", data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != proto.Status_OK {
+		return nil, fmt.Errorf("requestChannelMigrateOffNode is failed, status:%d", resp.Status)
+	}
+	migrateResp := &ChannelMigrateOffNodeResp{}
+	err = migrateResp.Unmarshal(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return migrateResp, nil
+}
+
 type sendQueue struct {
 	ch    chan *proto.Message
 	rl    *RateLimiter
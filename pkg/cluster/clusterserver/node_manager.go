@@ -98,6 +98,26 @@ func (n *nodeManager) requestSlotLogInfo(ctx context.Context, to uint64, req *Sl
 	return node.requestSlotLogInfo(timeoutCtx, req)
 }
 
+func (n *nodeManager) requestSlotSnapshotChunk(ctx context.Context, to uint64, req *SlotSnapshotChunkReq) ([]byte, error) {
+	node := n.node(to)
+	if node == nil {
+		return nil, fmt.Errorf("node[%d] not found", to)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, n.opts.ReqTimeout)
+	defer cancel()
+	return node.requestSlotSnapshotChunk(timeoutCtx, req)
+}
+
+func (n *nodeManager) requestChannelMigrateOffNode(ctx context.Context, to uint64, req *ChannelMigrateOffNodeReq) (*ChannelMigrateOffNodeResp, error) {
+	node := n.node(to)
+	if node == nil {
+		return nil, fmt.Errorf("node[%d] not found", to)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, n.opts.ReqTimeout)
+	defer cancel()
+	return node.requestChannelMigrateOffNode(timeoutCtx, req)
+}
+
 func (n *nodeManager) requestClusterJoin(to uint64, req *ClusterJoinReq) (*ClusterJoinResp, error) {
 	node := n.node(to)
 	if node == nil {
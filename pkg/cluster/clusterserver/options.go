@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"io"
 	"strings"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/reactor"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wktls"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -19,6 +21,10 @@ type Options struct {
 	ServerAddr    string      // 分布式可访问地址
 	ApiServerAddr string      // api服务地址
 	AppVersion    string      // 当前应用版本
+	Zone          string      // 节点所在的可用区
+	Rack          string      // 节点所在的机架
+	// PreferredLeaderZones 槽领导优先分布的可用区
+	PreferredLeaderZones []string
 	// InitNodes 集群初始节点，key为节点id，value为节点内网通信地址
 	InitNodes map[uint64]string
 	// SlotCount 槽位数量
@@ -59,6 +65,16 @@ type Options struct {
 	// MessageLogStorage 消息日志存储
 	MessageLogStorage IShardLogStorage
 	OnSlotApply       func(slotId uint32, logs []replica.Log) error
+	// OnChannelApply 应用频道已提交的日志[startIndex,endIndex)，需要同时记录频道已应用的日志下标
+	OnChannelApply func(channelId string, channelType uint8, startIndex, endIndex uint64) error
+	// OnSlotSnapshot 获取槽的状态快照（日志压缩后，落后太多的副本通过快照追赶），调用期间槽不会应用日志
+	OnSlotSnapshot func(slotId uint32) (SlotSnapshot, error)
+	// OnSlotInstallSnapshot 安装槽的状态快照，r为快照的内容
+	OnSlotInstallSnapshot func(slotId uint32, r io.Reader) error
+	// SlotLogCompactInterval 槽日志压缩的检查间隔，0表示不压缩
+	SlotLogCompactInterval time.Duration
+	// SlotLogRetainCount 槽日志压缩时保留的已应用日志数量，日志差距在此范围内的副本依然通过日志追赶
+	SlotLogRetainCount uint64
 	// Send 发送消息
 	Send func(shardType ShardType, m reactor.Message)
 	// ChannelElectionPoolSize 频道选举协程池大小(意味着同时在选举的频道数量)
@@ -94,6 +110,10 @@ type Options struct {
 	PongMaxTick int // 节点超过多少tick没有回应心跳就认为是掉线
 
 	Auth auth.AuthConfig
+
+	TLSOn  bool          // 节点之间是否使用mTLS通讯
+	TLS    wktls.Options // 节点之间mTLS的证书配置
+	Secret string        // 集群共享密钥，不为空时节点连接需要携带密钥签名的token
 }
 
 func NewOptions(opt ...Option) *Options {
@@ -126,6 +146,8 @@ func NewOptions(opt ...Option) *Options {
 		SlotReactorSubCount:    128,
 		PongMaxTick:            30,
 		SlotDbShardNum:         16,
+		SlotLogCompactInterval: time.Minute * 10,
+		SlotLogRetainCount:     10000,
 	}
 	for _, o := range opt {
 		o(opts)
@@ -158,12 +180,42 @@ func WithSlotMaxReplicaCount(slotMaxReplicaCount uint32) Option {
 	}
 }
 
+func WithOnChannelApply(fn func(channelId string, channelType uint8, startIndex, endIndex uint64) error) Option {
+	return func(o *Options) {
+		o.OnChannelApply = fn
+	}
+}
+
 func WithOnSlotApply(fn func(slotId uint32, logs []replica.Log) error) Option {
 	return func(o *Options) {
 		o.OnSlotApply = fn
 	}
 }
 
+func WithOnSlotSnapshot(fn func(slotId uint32) (SlotSnapshot, error)) Option {
+	return func(o *Options) {
+		o.OnSlotSnapshot = fn
+	}
+}
+
+func WithOnSlotInstallSnapshot(fn func(slotId uint32, r io.Reader) error) Option {
+	return func(o *Options) {
+		o.OnSlotInstallSnapshot = fn
+	}
+}
+
+func WithSlotLogCompactInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.SlotLogCompactInterval = interval
+	}
+}
+
+func WithSlotLogRetainCount(count uint64) Option {
+	return func(o *Options) {
+		o.SlotLogRetainCount = count
+	}
+}
+
 func WithLogSyncLimitSizeOfEach(size int) Option {
 	return func(o *Options) {
 		o.LogSyncLimitSizeOfEach = size
@@ -305,6 +357,24 @@ func WithApiServerAddr(addr string) Option {
 	}
 }
 
+func WithZone(zone string) Option {
+	return func(o *Options) {
+		o.Zone = zone
+	}
+}
+
+func WithRack(rack string) Option {
+	return func(o *Options) {
+		o.Rack = rack
+	}
+}
+
+func WithPreferredLeaderZones(zones []string) Option {
+	return func(o *Options) {
+		o.PreferredLeaderZones = zones
+	}
+}
+
 func WithLogLevel(level zapcore.Level) Option {
 	return func(o *Options) {
 		o.LogLevel = level
@@ -395,3 +465,16 @@ func WithAuth(auth auth.AuthConfig) Option {
 		o.Auth = auth
 	}
 }
+
+func WithTLS(on bool, tlsOpts wktls.Options) Option {
+	return func(o *Options) {
+		o.TLSOn = on
+		o.TLS = tlsOpts
+	}
+}
+
+func WithSecret(secret string) Option {
+	return func(o *Options) {
+		o.Secret = secret
+	}
+}
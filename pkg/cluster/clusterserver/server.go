@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"path"
@@ -21,7 +22,9 @@ import (
 	"github.com/WuKongIM/WuKongIM/pkg/wknet"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wktls"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkcryptotls "github.com/WuKongIM/crypto/tls"
 	"github.com/bwmarrin/snowflake"
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/lni/goutils/syncutil"
@@ -41,6 +44,7 @@ type Server struct {
 
 	channelKeyLock         *keylock.KeyLock        // 频道锁
 	netServer              *wkserver.Server        // 节点之间通讯的网络服务
+	tlsReloader            *wktls.Reloader         // 节点之间mTLS的证书，未开启mTLS为nil
 	channelElectionPool    *ants.Pool              // 频道选举的协程池
 	channelElectionManager *channelElectionManager // 频道选举管理者
 	channelLoadPool        *ants.Pool              // 加载频道的协程池
@@ -51,6 +55,7 @@ type Server struct {
 	onMessageFnc           func(fromNodeId uint64, msg *proto.Message) // 上层处理消息的函数
 	logIdGen               *snowflake.Node                             // 日志id生成
 	slotStorage            *PebbleShardLogStorage
+	slotApplyLock          sync.RWMutex // 应用槽日志时持读锁，备份时持写锁，保证备份里的槽日志和db一致
 	apiPrefix              string    // api前缀
 	uptime                 time.Time // 服务器启动时间
 	wklog.Log
@@ -59,6 +64,9 @@ type Server struct {
 
 	stopper *syncutil.Stopper
 
+	nodeLeavingChecking atomic.Bool // 是否正在处理离开的节点
+	nodeLeavingCheckAt  time.Time   // 上次处理离开的节点的时间
+
 	clusterCfgCache *lru.Cache[string, wkdb.ChannelClusterConfig]
 }
 
@@ -121,9 +129,13 @@ func New(opts *Options) *Server {
 		clusterevent.WithChannelMaxReplicaCount(uint32(opts.ChannelMaxReplicaCount)),
 		clusterevent.WithOnClusterConfigChange(s.onClusterConfigChange),
 		clusterevent.WithOnSlotElection(s.onSlotElection),
+		clusterevent.WithOnNodeLeaving(s.onNodeLeaving),
 		clusterevent.WithSend(s.onSend),
 		clusterevent.WithConfigDir(cfgDir),
 		clusterevent.WithApiServerAddr(opts.ApiServerAddr),
+		clusterevent.WithZone(opts.Zone),
+		clusterevent.WithRack(opts.Rack),
+		clusterevent.WithPreferredLeaderZones(opts.PreferredLeaderZones),
 		clusterevent.WithCluster(s),
 		clusterevent.WithElectionIntervalTick(opts.ElectionIntervalTick),
 		clusterevent.WithHeartbeatIntervalTick(opts.HeartbeatIntervalTick),
@@ -146,15 +158,26 @@ func New(opts *Options) *Server {
 		s.Panic("new channelLoadPool failed", zap.Error(err))
 	}
 
-	s.netServer = wkserver.New(
-		opts.Addr, wkserver.WithMessagePoolOn(false),
+	netServerOpts := []wkserver.Option{
+		wkserver.WithMessagePoolOn(false),
 		wkserver.WithOnRequest(func(conn wknet.Conn, req *proto.Request) {
 			trace.GlobalTrace.Metrics.System().IntranetIncomingAdd(int64(len(req.Body)))
 		}),
 		wkserver.WithOnResponse(func(conn wknet.Conn, resp *proto.Response) {
 			trace.GlobalTrace.Metrics.System().IntranetOutgoingAdd(int64(len(resp.Body)))
 		}),
-	)
+	}
+	if opts.TLSOn {
+		s.tlsReloader, err = wktls.NewReloader(opts.TLS)
+		if err != nil {
+			s.Panic("load cluster tls certificate failed", zap.Error(err))
+		}
+		netServerOpts = append(netServerOpts, wkserver.WithTLSConfig(s.tlsReloader.ServerConfig()))
+	}
+	if opts.TLSOn || opts.Secret != "" {
+		netServerOpts = append(netServerOpts, wkserver.WithOnAuth(s.authNode))
+	}
+	s.netServer = wkserver.New(opts.Addr, netServerOpts...)
 	s.channelElectionManager = newChannelElectionManager(s)
 	s.cancelCtx, s.cancelFnc = context.WithCancel(context.Background())
 	return s
@@ -236,6 +259,22 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Checkpoint 将槽日志和集群配置的快照写入目录dir，槽日志在dir/logdb，集群配置在dir/config
+// 生成槽日志快照和调用checkpointDb期间暂停应用槽日志，这样db的快照和槽日志里已应用的下标一致，
+// 恢复后不会重复应用非幂等的日志（比如累加租户存储用量、追加用户消息队列）
+func (s *Server) Checkpoint(dir string, checkpointDb func() error) error {
+	s.slotApplyLock.Lock()
+	err := s.slotStorage.Checkpoint(path.Join(dir, "logdb"))
+	if err == nil && checkpointDb != nil {
+		err = checkpointDb()
+	}
+	s.slotApplyLock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.clusterEventServer.Checkpoint(path.Join(dir, "config"))
+}
+
 func (s *Server) Stop() {
 
 	s.stopped.Store(true)
@@ -338,7 +377,11 @@ func (s *Server) AddChannelMessage(m reactor.Message) {
 }
 
 func (s *Server) newNodeByNodeInfo(nodeID uint64, addr string) *node {
-	n := newNode(nodeID, s.serverUid(s.opts.NodeId), addr, s.opts)
+	var tlsConfig *tls.Config
+	if s.tlsReloader != nil {
+		tlsConfig = s.tlsReloader.ClientConfig(nodeID)
+	}
+	n := newNode(nodeID, s.serverUid(s.opts.NodeId), addr, tlsConfig, s.opts)
 	n.start()
 	return n
 }
@@ -370,6 +413,31 @@ func (s *Server) serverUid(id uint64) string {
 	return fmt.Sprintf("%d", id)
 }
 
+// authNode 校验连接的节点：开启了mTLS时对端证书必须属于连接的节点，配置了集群密钥时token必须是密钥签名的
+func (s *Server) authNode(conn wknet.Conn, req *proto.Connect) error {
+	if s.opts.Secret != "" && !wktls.VerifyToken(s.opts.Secret, req.Uid, req.Token, time.Now()) {
+		return errors.New("invalid cluster token")
+	}
+	if s.tlsReloader == nil {
+		return nil
+	}
+	nodeId, err := strconv.ParseUint(req.Uid, 10, 64)
+	if err != nil {
+		return err
+	}
+	tlsConn, ok := conn.(interface {
+		ConnectionState() wkcryptotls.ConnectionState
+	})
+	if !ok {
+		return errors.New("not a tls connection")
+	}
+	peerCertificates := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return wktls.ErrNoPeerCertificate
+	}
+	return wktls.VerifyNodeId(peerCertificates[0], nodeId)
+}
+
 func (s *Server) uidToServerId(uid string) uint64 {
 	id, _ := strconv.ParseUint(uid, 10, 64)
 	return id
@@ -14,6 +14,8 @@ import (
 
 	"github.com/WuKongIM/WuKongIM/pkg/auth"
 	"github.com/WuKongIM/WuKongIM/pkg/auth/resource"
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterevent"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
 	"github.com/WuKongIM/WuKongIM/pkg/network"
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
@@ -30,10 +32,12 @@ func (s *Server) ServerAPI(route *wkhttp.WKHttp, prefix string) {
 	route.GET(s.formatPath("/node"), s.nodeGet)                       // 获取当前节点信息
 	route.GET(s.formatPath("/simpleNodes"), s.simpleNodesGet)         // 获取简单节点信息
 	route.GET(s.formatPath("/nodes/:id/channels"), s.nodeChannelsGet) // 获取节点的所有频道信息
+	route.POST(s.formatPath("/nodes/:id/leave"), s.nodeLeave)         // 节点离开集群
 
 	// route.GET(s.formatPath("/channels/:channel_id/:channel_type/config"), s.channelClusterConfigGet) // 获取频道分布式配置
 	route.GET(s.formatPath("/slots"), s.slotsGet)                                                      // 获取指定的槽信息
 	route.GET(s.formatPath("/allslot"), s.allSlotsGet)                                                 // 获取所有槽信息
+	route.GET(s.formatPath("/slots/spread"), s.slotSpreadGet)                                          // 获取副本没有按可用区（机架）分散的槽
 	route.GET(s.formatPath("/slots/:id/config"), s.slotClusterConfigGet)                               // 槽分布式配置
 	route.GET(s.formatPath("/slots/:id/channels"), s.slotChannelsGet)                                  // 获取某个槽的所有频道信息
 	route.POST(s.formatPath("/slots/:id/migrate"), s.slotMigrate)                                      // 迁移槽
@@ -107,6 +111,62 @@ func (s *Server) nodesGet(c *wkhttp.Context) {
 	})
 }
 
+// 节点离开集群，节点上的槽和频道迁出后会从分布式配置中移除（通过节点状态查看进度）
+func (s *Server) nodeLeave(c *wkhttp.Context) {
+	if !s.opts.Auth.HasPermissionWithContext(c, resource.ClusterNode.Leave, auth.ActionWrite) {
+		c.ResponseStatus(http.StatusUnauthorized)
+		return
+	}
+
+	leaderId := s.clusterEventServer.LeaderId()
+	if leaderId == 0 {
+		c.ResponseError(errors.New("leader not found"))
+		return
+	}
+	if leaderId != s.opts.NodeId {
+		leaderNode := s.clusterEventServer.Node(leaderId)
+		c.Forward(fmt.Sprintf("%s%s", leaderNode.ApiServerAddr, c.Request.URL.Path))
+		return
+	}
+
+	nodeId := wkutil.ParseUint64(c.Param("id"))
+	node := s.clusterEventServer.Node(nodeId)
+	if node == nil {
+		c.ResponseError(errors.New("node not found"))
+		return
+	}
+	if node.Status == pb.NodeStatus_NodeStatusLeaving {
+		c.ResponseOK()
+		return
+	}
+	if nodeId == leaderId {
+		c.ResponseError(errors.New("the leader node of the cluster config cannot leave"))
+		return
+	}
+	if node.Status != pb.NodeStatus_NodeStatusJoined {
+		c.ResponseError(errors.New("node is not joined"))
+		return
+	}
+	for _, n := range s.clusterEventServer.Nodes() {
+		if n.Id != nodeId && n.Status != pb.NodeStatus_NodeStatusJoined {
+			c.ResponseError(fmt.Errorf("node[%d] is joining or leaving", n.Id))
+			return
+		}
+	}
+	if node.AllowVote && s.clusterEventServer.AllowVoteAndJoinedNodeCount() <= 1 {
+		c.ResponseError(errors.New("no other node can take over"))
+		return
+	}
+
+	err := s.clusterEventServer.ProposeNodeLeave(nodeId)
+	if err != nil {
+		s.Error("nodeLeave: ProposeNodeLeave error", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
 func (s *Server) nodeGet(c *wkhttp.Context) {
 	nodeCfg := s.getLocalNodeInfo()
 	c.JSON(http.StatusOK, nodeCfg)
@@ -617,6 +677,36 @@ func (s *Server) allSlotsGet(c *wkhttp.Context) {
 	})
 }
 
+// 获取副本没有按可用区（机架）分散的槽，分布式配置每个节点都有，不需要转发到领导
+func (s *Server) slotSpreadGet(c *wkhttp.Context) {
+	clusterCfg := s.clusterEventServer.Config()
+	resps := make([]*SlotSpreadResp, 0)
+	nodes := s.clusterEventServer.AllowVoteAndJoinedOnlineNodes()
+	for _, st := range clusterCfg.Slots {
+		if !clusterevent.SpreadViolated(st.Replicas, nodes) {
+			continue
+		}
+		resp := &SlotSpreadResp{
+			Id:       st.Id,
+			LeaderId: st.Leader,
+			Replicas: st.Replicas,
+		}
+		for _, replicaId := range st.Replicas {
+			zone, rack := "", ""
+			if node := s.clusterEventServer.Node(replicaId); node != nil {
+				zone, rack = node.Zone, node.Rack
+			}
+			resp.Zones = append(resp.Zones, zone)
+			resp.Racks = append(resp.Racks, rack)
+		}
+		resps = append(resps, resp)
+	}
+	c.JSON(http.StatusOK, SlotSpreadRespTotal{
+		Total: len(resps),
+		Data:  resps,
+	})
+}
+
 func (s *Server) getSlotInfo(slotId uint32) (*SlotResp, error) {
 	slot := s.clusterEventServer.Slot(slotId)
 	if slot == nil {
@@ -692,6 +782,14 @@ func (s *Server) messageSearch(c *wkhttp.Context) {
 	payloadStr := strings.TrimSpace(c.Query("payload"))                   // base64编码的消息内容
 	messageId := wkutil.ParseInt64(c.Query("message_id"))
 	clientMsgNo := strings.TrimSpace(c.Query("client_msg_no"))
+	keywordOr := wkutil.ParseInt(c.Query("keyword_or"))   // 关键词之间是否为或的关系
+	startTime := wkutil.ParseInt64(c.Query("start_time")) // 消息时间下限（秒）
+	endTime := wkutil.ParseInt64(c.Query("end_time"))     // 消息时间上限（秒）
+	keywordsStr := strings.TrimSpace(c.Query("keywords")) // 关键词，多个用空格分隔
+	var keywords []string
+	if keywordsStr != "" {
+		keywords = strings.Fields(keywordsStr)
+	}
 
 	// 解密payload
 	var payload []byte
@@ -735,6 +833,10 @@ func (s *Server) messageSearch(c *wkhttp.Context) {
 			Pre:              pre == 1,
 			Payload:          payload,
 			ClientMsgNo:      clientMsgNo,
+			Keywords:         keywords,
+			KeywordOr:        keywordOr == 1,
+			StartTime:        startTime,
+			EndTime:          endTime,
 		})
 		if err != nil {
 			s.Error("查询消息失败！", zap.Error(err))
@@ -1712,55 +1814,17 @@ func (s *Server) channelMigrate(c *wkhttp.Context) {
 		return
 	}
 
-	newClusterConfig := clusterConfig.Clone()
-	if newClusterConfig.MigrateFrom != 0 || newClusterConfig.MigrateTo != 0 {
+	if clusterConfig.MigrateFrom != 0 || clusterConfig.MigrateTo != 0 {
 		c.ResponseError(errors.New("migrate is in progress"))
 		return
 	}
 
-	// 保存配置
-	newClusterConfig.MigrateFrom = req.MigrateFrom
-	newClusterConfig.MigrateTo = req.MigrateTo
-	newClusterConfig.ConfVersion = uint64(time.Now().UnixNano())
-
-	if !wkutil.ArrayContainsUint64(clusterConfig.Replicas, req.MigrateTo) {
-		// 将要目标节点加入学习者中
-		newClusterConfig.Learners = append(newClusterConfig.Learners, req.MigrateTo)
-	}
-
-	timeoutCtx, cancel := context.WithTimeout(s.cancelCtx, s.opts.ReqTimeout)
-	defer cancel()
-
-	// 提案保存配置
-	err = s.opts.ChannelClusterStorage.Propose(timeoutCtx, newClusterConfig)
+	err = s.migrateChannel(clusterConfig, req.MigrateFrom, req.MigrateTo)
 	if err != nil {
-		s.Error("channelMigrate: Save error", zap.Error(err))
+		s.Error("channelMigrate: migrateChannel error", zap.Error(err))
 		c.ResponseError(err)
 		return
 	}
-	s.clusterCfgCache.Add(wkutil.ChannelToKey(channelId, channelType), newClusterConfig)
-
-	// 如果频道领导不是当前节点，则发送最新配置给频道领导 （这里就算发送失败也没问题，因为频道领导会间隔比对自己与槽领导的配置）
-	if newClusterConfig.LeaderId != s.opts.NodeId {
-		err = s.SendChannelClusterConfigUpdate(channelId, channelType, newClusterConfig.LeaderId)
-		if err != nil {
-			s.Error("channelMigrate: sendChannelClusterConfigUpdate error", zap.Error(err))
-			c.ResponseError(err)
-			return
-		}
-	} else {
-		s.UpdateChannelClusterConfig(newClusterConfig)
-	}
-
-	// 如果目标节点不是当前节点，则发送最新配置给目标节点
-	if req.MigrateTo != s.opts.NodeId {
-		err = s.SendChannelClusterConfigUpdate(channelId, channelType, req.MigrateTo)
-		if err != nil {
-			s.Error("channelMigrate: sendChannelClusterConfigUpdate error", zap.Error(err))
-			c.ResponseError(err)
-			return
-		}
-	}
 	c.ResponseOK()
 
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterevent"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/icluster"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/reactor"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
@@ -138,6 +139,10 @@ func (s *Server) NodeIsOnline(nodeId uint64) bool {
 	return s.clusterEventServer.NodeOnline(nodeId)
 }
 
+func (s *Server) Nodes() []*pb.Node {
+	return s.clusterEventServer.Nodes()
+}
+
 func (s *Server) ProposeChannelMessages(ctx context.Context, channelId string, channelType uint8, logs []replica.Log) ([]icluster.ProposeResult, error) {
 	if s.stopped.Load() {
 		return nil, ErrStopped
@@ -369,16 +374,24 @@ func (s *Server) loadOrCreateChannelClusterConfigNoLock(ctx context.Context, cha
 		s.Info("loadOrCreateChannelClusterConfig: need add new node to replicas", zap.String("channelId", channelId), zap.Uint8("channelType", channelType), zap.Int("currentReplicaCount", currentReplicaCount), zap.Uint64s("replicas", clusterCfg.Replicas), zap.Uint16("replicaMaxCount", clusterCfg.ReplicaMaxCount), zap.Int("allowVoteAndJoinedNodeCount", allowVoteAndJoinedNodeCount))
 
 		nodes := s.clusterEventServer.AllowVoteAndJoinedNodes()
-		newReplicaIds := make([]uint64, 0, allowVoteAndJoinedNodeCount-len(clusterCfg.Replicas))
+		newReplicaNodes := make([]*pb.Node, 0, allowVoteAndJoinedNodeCount-len(clusterCfg.Replicas))
+		replicaNodes := make([]*pb.Node, 0, len(clusterCfg.Replicas))
 		for _, node := range nodes {
 			if !wkutil.ArrayContainsUint64(clusterCfg.Replicas, node.Id) {
-				newReplicaIds = append(newReplicaIds, node.Id)
+				newReplicaNodes = append(newReplicaNodes, node)
+			} else {
+				replicaNodes = append(replicaNodes, node)
 			}
 		}
 		// 打乱顺序，防止每次都是相同的节点加入
-		rand.Shuffle(len(newReplicaIds), func(i, j int) {
-			newReplicaIds[i], newReplicaIds[j] = newReplicaIds[j], newReplicaIds[i]
+		rand.Shuffle(len(newReplicaNodes), func(i, j int) {
+			newReplicaNodes[i], newReplicaNodes[j] = newReplicaNodes[j], newReplicaNodes[i]
 		})
+		// 优先选择与现有副本不在同一可用区（机架）的节点
+		newReplicaIds := make([]uint64, 0, len(newReplicaNodes))
+		for _, node := range clusterevent.SelectSpreadNodes(newReplicaNodes, replicaNodes, len(newReplicaNodes)) {
+			newReplicaIds = append(newReplicaIds, node.Id)
+		}
 
 		// 将新节点加入到学习者列表
 		for _, newReplicaId := range newReplicaIds {
@@ -484,15 +497,33 @@ func (s *Server) createChannelClusterConfig(channelId string, channelType uint8)
 		return wkdb.EmptyChannelClusterConfig, ErrNoAllowVoteNode
 	}
 
+	// 频道的副本策略（当前节点是槽领导，频道信息在本地）
+	policy, err := s.channelReplicaPolicy(channelId, channelType)
+	if err != nil {
+		return wkdb.EmptyChannelClusterConfig, err
+	}
+
+	leaderId := s.opts.NodeId // 默认当前节点是领导
+	if policy.PreferredLeader != 0 && policy.PreferredLeader != leaderId && s.clusterEventServer.NodeOnline(policy.PreferredLeader) {
+		for _, allowVoteNode := range allowVoteNodes {
+			if allowVoteNode.Id == policy.PreferredLeader {
+				leaderId = policy.PreferredLeader
+				break
+			}
+		}
+	}
+
 	clusterConfig := wkdb.ChannelClusterConfig{
 		ChannelId:       channelId,
 		ChannelType:     channelType,
-		ReplicaMaxCount: uint16(s.opts.ChannelMaxReplicaCount),
+		ReplicaMaxCount: policy.ReplicaCount,
 		Term:            1,
-		LeaderId:        s.opts.NodeId,
+		LeaderId:        leaderId,
+		AckMode:         policy.AckMode,
+		PreferredLeader: policy.PreferredLeader,
 	}
-	replicaIds := make([]uint64, 0, s.opts.ChannelMaxReplicaCount)
-	replicaIds = append(replicaIds, s.opts.NodeId) // 默认当前节点是领导，所以加入到副本列表中
+	replicaIds := make([]uint64, 0, policy.ReplicaCount)
+	replicaIds = append(replicaIds, leaderId) // 领导加入到副本列表中
 
 	// 随机选择副本
 	newAllowVoteNodes := make([]*pb.Node, 0, len(allowVoteNodes))
@@ -501,15 +532,19 @@ func (s *Server) createChannelClusterConfig(channelId string, channelType uint8)
 		newAllowVoteNodes[i], newAllowVoteNodes[j] = newAllowVoteNodes[j], newAllowVoteNodes[i]
 	})
 
+	var selectedNodes []*pb.Node
+	candidateNodes := make([]*pb.Node, 0, len(newAllowVoteNodes))
 	for _, allowVoteNode := range newAllowVoteNodes {
-		if allowVoteNode.Id == s.opts.NodeId {
+		if allowVoteNode.Id == leaderId {
+			selectedNodes = append(selectedNodes, allowVoteNode)
 			continue
 		}
-		if len(replicaIds) >= int(s.opts.ChannelMaxReplicaCount) {
-			break
-		}
-		replicaIds = append(replicaIds, allowVoteNode.Id)
+		candidateNodes = append(candidateNodes, allowVoteNode)
+	}
 
+	// 优先选择与领导以及已选副本不在同一可用区（机架）的节点
+	for _, node := range clusterevent.SelectSpreadNodes(candidateNodes, selectedNodes, int(policy.ReplicaCount)-len(replicaIds)) {
+		replicaIds = append(replicaIds, node.Id)
 	}
 	clusterConfig.Replicas = replicaIds
 	return clusterConfig, nil
@@ -557,6 +592,49 @@ func (s *Server) createChannelClusterConfig(channelId string, channelType uint8)
 // 	return clusterCfg, updated, nil
 // }
 
+// 迁移频道，目标节点不是副本时先作为学习者加入，等追上日志后再替换源节点
+func (s *Server) migrateChannel(clusterConfig wkdb.ChannelClusterConfig, migrateFrom, migrateTo uint64) error {
+	newClusterConfig := clusterConfig.Clone()
+	newClusterConfig.MigrateFrom = migrateFrom
+	newClusterConfig.MigrateTo = migrateTo
+	newClusterConfig.ConfVersion = uint64(time.Now().UnixNano())
+
+	if !wkutil.ArrayContainsUint64(clusterConfig.Replicas, migrateTo) {
+		// 将要目标节点加入学习者中
+		newClusterConfig.Learners = append(newClusterConfig.Learners, migrateTo)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(s.cancelCtx, s.opts.ReqTimeout)
+	defer cancel()
+
+	// 提案保存配置
+	err := s.opts.ChannelClusterStorage.Propose(timeoutCtx, newClusterConfig)
+	if err != nil {
+		return err
+	}
+	channelId, channelType := newClusterConfig.ChannelId, newClusterConfig.ChannelType
+	s.clusterCfgCache.Add(wkutil.ChannelToKey(channelId, channelType), newClusterConfig)
+
+	// 如果频道领导不是当前节点，则发送最新配置给频道领导 （这里就算发送失败也没问题，因为频道领导会间隔比对自己与槽领导的配置）
+	if newClusterConfig.LeaderId != s.opts.NodeId {
+		err = s.SendChannelClusterConfigUpdate(channelId, channelType, newClusterConfig.LeaderId)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.UpdateChannelClusterConfig(newClusterConfig)
+	}
+
+	// 如果目标节点不是当前节点，则发送最新配置给目标节点
+	if migrateTo != s.opts.NodeId {
+		err = s.SendChannelClusterConfigUpdate(channelId, channelType, migrateTo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Server) getChannelClusterConfig(channelId string, channelType uint8) (wkdb.ChannelClusterConfig, error) {
 	return s.opts.ChannelClusterStorage.Get(channelId, channelType)
 }
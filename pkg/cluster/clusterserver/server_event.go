@@ -2,10 +2,15 @@ package cluster
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterevent"
+	"github.com/WuKongIM/WuKongIM/pkg/trace"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -38,6 +43,28 @@ func (s *Server) onSlotElection(slots []*pb.Slot) error {
 	return nil
 }
 
+// 离开中的节点的槽已全部迁出（只有分布式配置的领导会调用）
+func (s *Server) onNodeLeaving(nodeId uint64) {
+	if s.stopped.Load() {
+		return
+	}
+	// 频道迁移需要请求各个槽领导，间隔一段时间检查一次
+	if time.Since(s.nodeLeavingCheckAt) < nodeLeavingCheckInterval {
+		return
+	}
+	if !s.nodeLeavingChecking.CompareAndSwap(false, true) {
+		return
+	}
+	s.nodeLeavingCheckAt = time.Now()
+	s.stopper.RunWorker(func() {
+		defer s.nodeLeavingChecking.Store(false)
+		err := s.handleNodeLeaving(nodeId)
+		if err != nil {
+			s.Error("handleNodeLeaving failed", zap.Error(err), zap.Uint64("nodeId", nodeId))
+		}
+	})
+}
+
 func (s *Server) handleClusterConfigChange(cfg *pb.Config) error {
 
 	// ================== 处理节点 ==================
@@ -397,3 +424,193 @@ func (s *Server) calculateSlotLeaderBySlot(slotLogInfos map[uint64]map[uint32]Sl
 	}
 	return leader
 }
+
+// 让所有槽领导将频道迁出离开的节点，频道全部迁出后将节点从分布式配置中移除
+func (s *Server) handleNodeLeaving(nodeId uint64) error {
+	slotLeaderIds := make([]uint64, 0)
+	for _, slot := range s.clusterEventServer.Slots() {
+		if slot.Leader == 0 {
+			return fmt.Errorf("slot[%d] has no leader", slot.Id)
+		}
+		if !wkutil.ArrayContainsUint64(slotLeaderIds, slot.Leader) {
+			slotLeaderIds = append(slotLeaderIds, slot.Leader)
+		}
+	}
+
+	remaining := 0
+	for _, slotLeaderId := range slotLeaderIds {
+		if slotLeaderId == s.opts.NodeId {
+			n, err := s.migrateChannelsOffNode(nodeId)
+			if err != nil {
+				return err
+			}
+			remaining += n
+			continue
+		}
+		resp, err := s.nodeManager.requestChannelMigrateOffNode(s.cancelCtx, slotLeaderId, &ChannelMigrateOffNodeReq{
+			NodeId: nodeId,
+		})
+		if err != nil {
+			return err
+		}
+		remaining += int(resp.Remaining)
+	}
+	if remaining > 0 {
+		s.Info("waiting for channels to migrate off leaving node", zap.Uint64("nodeId", nodeId), zap.Int("remaining", remaining))
+		return nil
+	}
+
+	s.Info("node left", zap.Uint64("nodeId", nodeId))
+	return s.clusterEventServer.ProposeNodeLeft(nodeId)
+}
+
+// 将本节点作为槽领导的频道迁出指定节点，返回还在此节点上的频道数量
+func (s *Server) migrateChannelsOffNode(nodeId uint64) (int, error) {
+	targetNodes := s.clusterEventServer.AllowVoteAndJoinedOnlineNodes()
+	nodeOnline := s.clusterEventServer.NodeOnline(nodeId)
+
+	var slotCfgs [][]wkdb.ChannelClusterConfig
+	nodeReplicaCountMap := make(map[uint64]int) // 每个节点目前的频道副本数量（本节点领导的槽内）
+	for _, slot := range s.clusterEventServer.Slots() {
+		if slot.Leader != s.opts.NodeId {
+			continue
+		}
+		cfgs, err := s.opts.ChannelClusterStorage.GetWithSlotId(slot.Id)
+		if err != nil {
+			return 0, err
+		}
+		for _, cfg := range cfgs {
+			for _, replicaId := range cfg.Replicas {
+				nodeReplicaCountMap[replicaId]++
+			}
+			for _, learnerId := range cfg.Learners {
+				nodeReplicaCountMap[learnerId]++
+			}
+		}
+		slotCfgs = append(slotCfgs, cfgs)
+	}
+
+	remaining := 0
+	for _, cfgs := range slotCfgs {
+		for _, cfg := range cfgs {
+			if cfg.LeaderId != nodeId && !wkutil.ArrayContainsUint64(cfg.Replicas, nodeId) && !wkutil.ArrayContainsUint64(cfg.Learners, nodeId) {
+				continue
+			}
+			remaining++
+
+			if cfg.MigrateFrom != 0 || cfg.MigrateTo != 0 { // 迁移中，通知频道领导加载频道，防止频道没有活跃导致迁移一直没有进行
+				if cfg.LeaderId != 0 && cfg.LeaderId != s.opts.NodeId {
+					if err := s.SendChannelClusterConfigUpdate(cfg.ChannelId, cfg.ChannelType, cfg.LeaderId); err != nil {
+						s.Warn("migrateChannelsOffNode: sendChannelClusterConfigUpdate failed", zap.Error(err), zap.String("channelId", cfg.ChannelId), zap.Uint8("channelType", cfg.ChannelType))
+					}
+				}
+				continue
+			}
+
+			// 离开的节点在线，则通过迁移让数据追上后再替换
+			if nodeOnline {
+				toNodeId := s.selectChannelMigrateTarget(cfg, nodeId, targetNodes, nodeReplicaCountMap)
+				if toNodeId != 0 {
+					nodeReplicaCountMap[toNodeId]++
+				}
+				if toNodeId == 0 && cfg.LeaderId == nodeId { // 没有可迁入的节点，先将领导转移给其他在线的副本
+					for _, replicaId := range cfg.Replicas {
+						if replicaId != nodeId && s.clusterEventServer.NodeOnline(replicaId) {
+							toNodeId = replicaId
+							break
+						}
+					}
+				}
+				if toNodeId != 0 {
+					if err := s.migrateChannel(cfg, nodeId, toNodeId); err != nil {
+						s.Warn("migrateChannelsOffNode: migrateChannel failed", zap.Error(err), zap.String("channelId", cfg.ChannelId), zap.Uint8("channelType", cfg.ChannelType))
+					}
+					continue
+				}
+			}
+
+			// 离开的节点不在线或没有可迁入的节点，则直接从副本中移除，如果是领导则重新选举
+			// 同一个提案里加入一个学习者替换离开的副本，学习者追上后转为副本，只有没有可加入的节点时副本数量才会减少
+			newCfg := cfg.Clone()
+			var (
+				learnerId uint64
+				shrink    bool
+			)
+			if wkutil.ArrayContainsUint64(cfg.Replicas, nodeId) {
+				if !nodeOnline {
+					learnerId = s.selectChannelMigrateTarget(cfg, nodeId, targetNodes, nodeReplicaCountMap)
+				}
+				if learnerId != 0 {
+					nodeReplicaCountMap[learnerId]++
+					newCfg.Learners = append(newCfg.Learners, learnerId)
+					newCfg.MigrateFrom = learnerId
+					newCfg.MigrateTo = learnerId
+				} else {
+					shrink = true
+				}
+			}
+			newCfg.Replicas = wkutil.RemoveUint64(newCfg.Replicas, nodeId)
+			newCfg.Learners = wkutil.RemoveUint64(newCfg.Learners, nodeId)
+			if newCfg.LeaderId == nodeId {
+				newCfg.LeaderId = 0
+				newCfg.Term++
+			}
+			newCfg.ConfVersion = uint64(time.Now().UnixNano())
+			timeoutCtx, cancel := context.WithTimeout(s.cancelCtx, s.opts.ReqTimeout)
+			err := s.opts.ChannelClusterStorage.Propose(timeoutCtx, newCfg)
+			cancel()
+			if err != nil {
+				s.Warn("migrateChannelsOffNode: propose channel cluster config failed", zap.Error(err), zap.String("channelId", cfg.ChannelId), zap.Uint8("channelType", cfg.ChannelType))
+				continue
+			}
+			if shrink {
+				s.Warn("migrateChannelsOffNode: no node to replace the leaving replica, replica count shrinks", zap.Uint64("nodeId", nodeId), zap.String("channelId", cfg.ChannelId), zap.Uint8("channelType", cfg.ChannelType), zap.Uint64s("replicas", newCfg.Replicas))
+				trace.GlobalTrace.Metrics.Cluster().ChannelReplicaShrinkCountAdd(1)
+			}
+			if learnerId != 0 && newCfg.LeaderId != 0 { // 通知频道领导开始向学习者同步
+				if newCfg.LeaderId == s.opts.NodeId {
+					s.UpdateChannelClusterConfig(newCfg)
+				} else if err = s.SendChannelClusterConfigUpdate(newCfg.ChannelId, newCfg.ChannelType, newCfg.LeaderId); err != nil {
+					s.Warn("migrateChannelsOffNode: sendChannelClusterConfigUpdate failed", zap.Error(err), zap.String("channelId", cfg.ChannelId), zap.Uint8("channelType", cfg.ChannelType))
+				}
+			}
+			s.clusterCfgCache.Add(wkutil.ChannelToKey(newCfg.ChannelId, newCfg.ChannelType), newCfg)
+			remaining--
+		}
+	}
+	return remaining, nil
+}
+
+// selectChannelMigrateTarget 为频道选择替换离开节点的迁入节点
+// 优先选择与频道其他副本不在同一可用区（机架）的节点，同等条件下选择频道副本数量最少的节点
+func (s *Server) selectChannelMigrateTarget(cfg wkdb.ChannelClusterConfig, leavingNodeId uint64, targetNodes []*pb.Node, nodeReplicaCountMap map[uint64]int) uint64 {
+	candidates := make([]*pb.Node, 0, len(targetNodes))
+	for _, node := range targetNodes {
+		if wkutil.ArrayContainsUint64(cfg.Replicas, node.Id) || wkutil.ArrayContainsUint64(cfg.Learners, node.Id) {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	if len(candidates) == 0 {
+		return 0
+	}
+	// 副本数量少的节点优先迁入
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return nodeReplicaCountMap[candidates[i].Id] < nodeReplicaCountMap[candidates[j].Id]
+	})
+
+	selected := make([]*pb.Node, 0, len(cfg.Replicas))
+	for _, replicaId := range cfg.Replicas {
+		if replicaId == leavingNodeId {
+			continue
+		}
+		if node := s.clusterEventServer.Node(replicaId); node != nil {
+			selected = append(selected, node)
+		}
+	}
+	nodes := clusterevent.SelectSpreadNodes(candidates, selected, 1)
+	if len(nodes) == 0 {
+		return 0
+	}
+	return nodes[0].Id
+}
@@ -34,6 +34,12 @@ func (s *Server) setRoutes() {
 
 	// 获取槽日志信息
 	s.netServer.Route("/slot/logInfo", s.handleSlotLogInfo)
+
+	// 拉取槽快照的一块数据
+	s.netServer.Route("/slot/snapshotChunk", s.handleSlotSnapshotChunk)
+
+	// 将频道迁出离开的节点
+	s.netServer.Route("/channel/migrateOffNode", s.handleChannelMigrateOffNode)
 }
 
 func (s *Server) handleChannelLastLogInfo(c *wkserver.Context) {
@@ -416,3 +422,44 @@ func (s *Server) handleSlotLogInfo(c *wkserver.Context) {
 	}
 	c.Write(data)
 }
+
+func (s *Server) handleSlotSnapshotChunk(c *wkserver.Context) {
+	req := &SlotSnapshotChunkReq{}
+	if err := req.Unmarshal(c.Body()); err != nil {
+		s.Error("unmarshal SlotSnapshotChunkReq failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	data, err := s.slotManager.readSnapshotChunk(req)
+	if err != nil {
+		s.Error("read slot snapshot chunk failed", zap.Error(err), zap.Uint32("slotId", req.SlotId), zap.Uint64("index", req.Index), zap.Uint64("offset", req.Offset))
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+}
+
+func (s *Server) handleChannelMigrateOffNode(c *wkserver.Context) {
+	req := &ChannelMigrateOffNodeReq{}
+	if err := req.Unmarshal(c.Body()); err != nil {
+		s.Error("unmarshal ChannelMigrateOffNodeReq failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	remaining, err := s.migrateChannelsOffNode(req.NodeId)
+	if err != nil {
+		s.Error("migrateChannelsOffNode failed", zap.Error(err), zap.Uint64("nodeId", req.NodeId))
+		c.WriteErr(err)
+		return
+	}
+	resp := &ChannelMigrateOffNodeResp{
+		Remaining: uint32(remaining),
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		s.Error("marshal ChannelMigrateOffNodeResp failed", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+}
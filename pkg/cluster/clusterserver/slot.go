@@ -28,6 +28,7 @@ type slot struct {
 
 	mu             sync.Mutex
 	learnerToLock  sync.Mutex
+	applyLock      sync.Mutex // 应用日志和生成快照互斥，保证快照内容和已应用的下标一致
 	s              *Server
 	pausePropopose atomic.Bool // 是否暂停提案
 
@@ -167,11 +168,17 @@ func (s *slot) ApplyLogs(startIndex, endIndex uint64) (uint64, error) {
 			appliedSize += uint64(log.LogSize())
 		}
 
+		s.s.slotApplyLock.RLock()
+		s.applyLock.Lock()
 		err = s.opts.OnSlotApply(s.st.Id, logs)
 		if err != nil {
+			s.applyLock.Unlock()
+			s.s.slotApplyLock.RUnlock()
 			s.Panic("on slot apply error", zap.Error(err))
 		}
 		err = s.opts.SlotLogStorage.SetAppliedIndex(s.key, logs[len(logs)-1].Index)
+		s.applyLock.Unlock()
+		s.s.slotApplyLock.RUnlock()
 		if err != nil {
 			s.Error("set applied index error", zap.Error(err))
 			return 0, err
@@ -358,3 +365,24 @@ func (s *slot) DeleteLeaderTermStartIndexGreaterThanTerm(term uint32) error {
 func (s *slot) TruncateLogTo(index uint64) error {
 	return s.opts.SlotLogStorage.TruncateLogTo(s.key, index)
 }
+
+// compactLog 压缩已应用的日志，保留最近的retainCount条
+func (s *slot) compactLog(retainCount uint64) error {
+	appliedIdx, err := s.opts.SlotLogStorage.AppliedIndex(s.key)
+	if err != nil {
+		return err
+	}
+	if appliedIdx <= retainCount {
+		return nil
+	}
+	compactIdx := appliedIdx - retainCount
+	firstIdx, err := s.opts.SlotLogStorage.FirstIndex(s.key)
+	if err != nil {
+		return err
+	}
+	if firstIdx > compactIdx {
+		return nil
+	}
+	s.Debug("compact log", zap.Uint64("compactIndex", compactIdx), zap.Uint64("appliedIndex", appliedIdx))
+	return s.opts.SlotLogStorage.CompactLogTo(s.key, compactIdx)
+}
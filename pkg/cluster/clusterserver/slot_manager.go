@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/reactor"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/lni/goutils/syncutil"
+	"go.uber.org/zap"
 )
 
 var _ reactor.IRequest = &slotManager{}
@@ -16,13 +20,17 @@ type slotManager struct {
 	slotReactor *reactor.Reactor
 	opts        *Options
 	s           *Server
+	stopper     *syncutil.Stopper
+	wklog.Log
 }
 
 func newSlotManager(s *Server) *slotManager {
 
 	sm := &slotManager{
-		opts: s.opts,
-		s:    s,
+		opts:    s.opts,
+		s:       s,
+		stopper: syncutil.NewStopper(),
+		Log:     wklog.NewWKLog(fmt.Sprintf("slotManager[%d]", s.opts.NodeId)),
 	}
 
 	sm.slotReactor = reactor.New(reactor.NewOptions(
@@ -38,14 +46,36 @@ func newSlotManager(s *Server) *slotManager {
 }
 
 func (s *slotManager) start() error {
-
+	if s.opts.SlotLogCompactInterval > 0 {
+		s.stopper.RunWorker(s.compactLoop)
+	}
 	return s.slotReactor.Start()
 }
 
 func (s *slotManager) stop() {
+	s.stopper.Stop()
 	s.slotReactor.Stop()
 }
 
+// compactLoop 定时压缩槽的已应用日志，落后太多的副本通过快照追赶
+func (s *slotManager) compactLoop() {
+	tk := time.NewTicker(s.opts.SlotLogCompactInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			s.iterate(func(st *slot) bool {
+				if err := st.compactLog(s.opts.SlotLogRetainCount); err != nil {
+					s.Error("compact slot log failed", zap.Error(err), zap.Uint32("slotId", st.st.Id))
+				}
+				return true
+			})
+		case <-s.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
 func (s *slotManager) proposeAndWait(ctx context.Context, slotId uint32, logs []replica.Log) ([]reactor.ProposeResult, error) {
 	return s.slotReactor.ProposeAndWait(ctx, SlotIdToKey(slotId), logs)
 }
@@ -0,0 +1,250 @@
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"go.uber.org/zap"
+)
+
+// slotSnapshotChunkSize 副本每次拉取的快照块大小
+const slotSnapshotChunkSize = 1024 * 1024
+
+// SlotSnapshot 槽的状态快照
+type SlotSnapshot interface {
+	// Save 将快照内容写入w
+	Save(w io.Writer) error
+	Close() error
+}
+
+// GetSnapshot 获取槽的状态快照，快照对应当前已应用的日志下标
+// 快照内容写到本地文件，返回的数据只是快照的描述信息，副本根据描述信息分块拉取快照文件
+func (s *slot) GetSnapshot() (uint64, uint32, []byte, error) {
+	if s.opts.OnSlotSnapshot == nil {
+		return 0, 0, nil, replica.ErrSnapshotNotSupported
+	}
+
+	// 读取已应用下标和创建快照期间不能应用日志，否则快照内容和下标对不上
+	s.applyLock.Lock()
+	appliedIdx, err := s.opts.SlotLogStorage.AppliedIndex(s.key)
+	if err != nil {
+		s.applyLock.Unlock()
+		return 0, 0, nil, err
+	}
+	if appliedIdx == 0 {
+		s.applyLock.Unlock()
+		return 0, 0, nil, fmt.Errorf("slot[%d] has no applied log", s.st.Id)
+	}
+	snapshotPath := s.s.slotManager.snapshotPath(s.st.Id, appliedIdx)
+	var snapshot SlotSnapshot
+	if _, err = os.Stat(snapshotPath); os.IsNotExist(err) { // 同一个下标的快照已经生成过则直接复用
+		snapshot, err = s.opts.OnSlotSnapshot(s.st.Id)
+	}
+	s.applyLock.Unlock()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	logs, err := s.getLogs(appliedIdx, appliedIdx+1, 0)
+	if err != nil {
+		if snapshot != nil {
+			_ = snapshot.Close()
+		}
+		return 0, 0, nil, err
+	}
+	if len(logs) == 0 {
+		if snapshot != nil {
+			_ = snapshot.Close()
+		}
+		return 0, 0, nil, fmt.Errorf("slot[%d] applied log[%d] not found", s.st.Id, appliedIdx)
+	}
+
+	if snapshot != nil {
+		err = s.s.slotManager.saveSnapshot(s.st.Id, appliedIdx, snapshot)
+		_ = snapshot.Close()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	stat, err := os.Stat(snapshotPath)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	meta := &SlotSnapshotMeta{
+		NodeId: s.opts.NodeId,
+		SlotId: s.st.Id,
+		Index:  appliedIdx,
+		Size:   uint64(stat.Size()),
+	}
+	data, err := meta.Marshal()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return appliedIdx, logs[0].Term, data, nil
+}
+
+// InstallSnapshot 从领导拉取槽状态快照并安装，然后重置本地日志
+func (s *slot) InstallSnapshot(index uint64, term uint32, data []byte) error {
+	if s.opts.OnSlotInstallSnapshot == nil {
+		return replica.ErrSnapshotNotSupported
+	}
+	meta := &SlotSnapshotMeta{}
+	if err := meta.Unmarshal(data); err != nil {
+		return err
+	}
+	s.Info("install snapshot", zap.Uint64("index", index), zap.Uint32("term", term), zap.Uint64("nodeId", meta.NodeId), zap.Uint64("size", meta.Size))
+
+	recvPath, err := s.s.slotManager.fetchSnapshot(meta)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(recvPath)
+
+	f, err := os.Open(recvPath)
+	if err != nil {
+		return err
+	}
+	s.s.slotApplyLock.RLock()
+	err = s.opts.OnSlotInstallSnapshot(s.st.Id, bufio.NewReader(f))
+	f.Close()
+	if err == nil {
+		err = s.opts.SlotLogStorage.RestoreSnapshot(s.key, index, term)
+	}
+	s.s.slotApplyLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	// 快照之后的日志从快照的任期开始
+	err = s.opts.SlotLogStorage.DeleteLeaderTermStartIndexGreaterThanTerm(s.key, term)
+	if err != nil {
+		return err
+	}
+	termStartIndex, err := s.opts.SlotLogStorage.LeaderTermStartIndex(s.key, term)
+	if err != nil {
+		return err
+	}
+	if termStartIndex == 0 {
+		return s.opts.SlotLogStorage.SetLeaderTermStartIndex(s.key, term, index)
+	}
+	return nil
+}
+
+func (s *slotManager) snapshotDir() string {
+	return path.Join(s.opts.DataDir, "slotsnapshot")
+}
+
+func (s *slotManager) snapshotPath(slotId uint32, index uint64) string {
+	return path.Join(s.snapshotDir(), fmt.Sprintf("%d-%d.snap", slotId, index))
+}
+
+// saveSnapshot 将快照写入文件，并删除这个槽旧的快照文件
+func (s *slotManager) saveSnapshot(slotId uint32, index uint64, snapshot SlotSnapshot) error {
+	if err := os.MkdirAll(s.snapshotDir(), 0755); err != nil {
+		return err
+	}
+	snapshotPath := s.snapshotPath(slotId, index)
+	tmpPath := snapshotPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err = snapshot.Save(w); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, snapshotPath); err != nil {
+		return err
+	}
+
+	oldPaths, err := filepath.Glob(path.Join(s.snapshotDir(), fmt.Sprintf("%d-*.snap", slotId)))
+	if err != nil {
+		return err
+	}
+	for _, oldPath := range oldPaths {
+		if oldPath == snapshotPath {
+			continue
+		}
+		if err = os.Remove(oldPath); err != nil {
+			s.Warn("remove old snapshot failed", zap.Error(err), zap.String("path", oldPath))
+		}
+	}
+	return nil
+}
+
+// readSnapshotChunk 读取快照文件的一块数据，到达文件末尾时返回空数据
+func (s *slotManager) readSnapshotChunk(req *SlotSnapshotChunkReq) ([]byte, error) {
+	f, err := os.Open(s.snapshotPath(req.SlotId, req.Index))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	limit := req.Limit
+	if limit == 0 || limit > slotSnapshotChunkSize {
+		limit = slotSnapshotChunkSize
+	}
+	buf := make([]byte, limit)
+	n, err := f.ReadAt(buf, int64(req.Offset))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// fetchSnapshot 从快照所在的节点分块拉取快照文件，返回本地文件路径
+func (s *slotManager) fetchSnapshot(meta *SlotSnapshotMeta) (string, error) {
+	if err := os.MkdirAll(s.snapshotDir(), 0755); err != nil {
+		return "", err
+	}
+	recvPath := path.Join(s.snapshotDir(), fmt.Sprintf("%d-%d.recv", meta.SlotId, meta.Index))
+	f, err := os.Create(recvPath)
+	if err != nil {
+		return "", err
+	}
+	err = s.fetchSnapshotTo(meta, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(recvPath)
+		return "", err
+	}
+	return recvPath, nil
+}
+
+func (s *slotManager) fetchSnapshotTo(meta *SlotSnapshotMeta, w io.Writer) error {
+	var offset uint64
+	for offset < meta.Size {
+		chunk, err := s.s.nodeManager.requestSlotSnapshotChunk(s.s.cancelCtx, meta.NodeId, &SlotSnapshotChunkReq{
+			SlotId: meta.SlotId,
+			Index:  meta.Index,
+			Offset: offset,
+			Limit:  slotSnapshotChunkSize,
+		})
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			return fmt.Errorf("slot[%d] snapshot[%d] is truncated, offset: %d size: %d", meta.SlotId, meta.Index, offset, meta.Size)
+		}
+		if _, err = w.Write(chunk); err != nil {
+			return err
+		}
+		offset += uint64(len(chunk))
+	}
+	return nil
+}
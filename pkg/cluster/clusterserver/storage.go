@@ -46,6 +46,15 @@ type IShardLogStorage interface {
 
 	AppliedIndex(shardNo string) (uint64, error)
 
+	// FirstIndex 第一条日志的下标，日志没有被压缩过则返回0
+	FirstIndex(shardNo string) (uint64, error)
+
+	// CompactLogTo 压缩日志，删除index及之前的日志（index不能大于已应用的下标）
+	CompactLogTo(shardNo string, index uint64) error
+
+	// RestoreSnapshot 安装快照后重置日志，index作为最后一条日志下标和已应用下标
+	RestoreSnapshot(shardNo string, index uint64, term uint32) error
+
 	Open() error
 
 	Close() error
@@ -195,7 +204,7 @@ func (p *proxyReplicaStorage) LastIndexAndTerm() (uint64, uint32, error) {
 }
 
 func (p *proxyReplicaStorage) FirstIndex() (uint64, error) {
-	return 0, nil
+	return p.storage.FirstIndex(p.shardNo)
 }
 
 func (p *proxyReplicaStorage) LastIndexAndAppendTime() (uint64, uint64, error) {
@@ -92,6 +92,16 @@ func (p *PebbleShardLogStorage) Close() error {
 	return nil
 }
 
+// Checkpoint 依次将每个分片的快照写入目录dir，单个分片的快照是一致的，分片之间不是同一时刻的快照
+func (p *PebbleShardLogStorage) Checkpoint(dir string) error {
+	for i, db := range p.dbs {
+		if err := db.Checkpoint(fmt.Sprintf("%s/shard%03d", dir, i), pebble.WithFlushedWAL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *PebbleShardLogStorage) shardDB(v string) *pebble.DB {
 	shardId := p.shardId(v)
 	return p.dbs[shardId]
@@ -211,6 +221,81 @@ func (p *PebbleShardLogStorage) TruncateLogTo(shardNo string, index uint64) erro
 	return p.saveMaxIndex(shardNo, index-1)
 }
 
+// CompactLogTo 压缩日志，删除index及之前的日志，index不能大于已应用的日志下标
+func (p *PebbleShardLogStorage) CompactLogTo(shardNo string, index uint64) error {
+	if index == 0 {
+		return nil
+	}
+	appliedIdx, err := p.AppliedIndex(shardNo)
+	if err != nil {
+		return err
+	}
+	if index > appliedIdx {
+		return fmt.Errorf("compact index[%d] must be less than or equal to applied index[%d]", index, appliedIdx)
+	}
+	compactedIdx, _, err := p.compactedIndexAndTerm(shardNo)
+	if err != nil {
+		return err
+	}
+	if index <= compactedIdx {
+		return nil
+	}
+	lg, err := p.getLog(shardNo, index)
+	if err != nil {
+		return err
+	}
+	if lg.Index == 0 {
+		return fmt.Errorf("compact log[%d] not found", index)
+	}
+
+	batch := p.shardDB(shardNo).NewBatch()
+	defer batch.Close()
+	err = batch.DeleteRange(key.NewLogKey(shardNo, 0), key.NewLogKey(shardNo, index+1), p.noSync)
+	if err != nil {
+		return err
+	}
+	err = p.saveCompactedIndexWrite(shardNo, index, lg.Term, batch, p.noSync)
+	if err != nil {
+		return err
+	}
+	return batch.Commit(p.wo)
+}
+
+// RestoreSnapshot 安装快照后重置日志，删除本地所有日志，快照的下标作为最后一条日志下标和已应用下标
+func (p *PebbleShardLogStorage) RestoreSnapshot(shardNo string, index uint64, term uint32) error {
+	batch := p.shardDB(shardNo).NewBatch()
+	defer batch.Close()
+	err := batch.DeleteRange(key.NewLogKey(shardNo, 0), key.NewLogKey(shardNo, math.MaxUint64), p.noSync)
+	if err != nil {
+		return err
+	}
+	err = p.saveCompactedIndexWrite(shardNo, index, term, batch, p.noSync)
+	if err != nil {
+		return err
+	}
+	err = p.saveMaxIndexWrite(shardNo, index, batch, p.noSync)
+	if err != nil {
+		return err
+	}
+	err = p.saveAppliedIndexWrite(shardNo, index, batch, p.noSync)
+	if err != nil {
+		return err
+	}
+	return batch.Commit(p.wo)
+}
+
+// FirstIndex 第一条日志的下标，日志没有被压缩过则返回0
+func (p *PebbleShardLogStorage) FirstIndex(shardNo string) (uint64, error) {
+	compactedIdx, _, err := p.compactedIndexAndTerm(shardNo)
+	if err != nil {
+		return 0, err
+	}
+	if compactedIdx == 0 {
+		return 0, nil
+	}
+	return compactedIdx + 1, nil
+}
+
 // func (p *PebbleShardLogStorage) realLastIndex(shardNo string) (uint64, error) {
 // 	iter := p.db.NewIter(&pebble.IterOptions{
 // 		LowerBound: key.NewLogKey(shardNo, 0),
@@ -344,6 +429,15 @@ func (p *PebbleShardLogStorage) LastIndexAndTerm(shardNo string) (uint64, uint32
 	if err != nil {
 		return 0, 0, err
 	}
+	if log.Index == 0 { // 最后一条日志已被压缩，任期从压缩记录里取
+		compactedIdx, compactedTerm, err := p.compactedIndexAndTerm(shardNo)
+		if err != nil {
+			return 0, 0, err
+		}
+		if compactedIdx == lastIndex {
+			return lastIndex, compactedTerm, nil
+		}
+	}
 	return lastIndex, log.Term, nil
 }
 
@@ -382,6 +476,10 @@ func (p *PebbleShardLogStorage) SetLastIndex(shardNo string, index uint64) error
 }
 
 func (p *PebbleShardLogStorage) SetAppliedIndex(shardNo string, index uint64) error {
+	return p.saveAppliedIndexWrite(shardNo, index, p.shardDB(shardNo), p.wo)
+}
+
+func (p *PebbleShardLogStorage) saveAppliedIndexWrite(shardNo string, index uint64, w pebble.Writer, o *pebble.WriteOptions) error {
 	maxIndexKeyData := key.NewAppliedIndexKey(shardNo)
 	maxIndexdata := make([]byte, 8)
 	binary.BigEndian.PutUint64(maxIndexdata, index)
@@ -389,9 +487,7 @@ func (p *PebbleShardLogStorage) SetAppliedIndex(shardNo string, index uint64) er
 	lastTimeData := make([]byte, 8)
 	binary.BigEndian.PutUint64(lastTimeData, uint64(lastTime))
 
-	err := p.shardDB(shardNo).Set(maxIndexKeyData, append(maxIndexdata, lastTimeData...), p.wo)
-	return err
-
+	return w.Set(maxIndexKeyData, append(maxIndexdata, lastTimeData...), o)
 }
 
 func (p *PebbleShardLogStorage) AppliedIndex(shardNo string) (uint64, error) {
@@ -509,6 +605,29 @@ func (p *PebbleShardLogStorage) saveMaxIndexWrite(shardNo string, index uint64,
 	return err
 }
 
+func (p *PebbleShardLogStorage) saveCompactedIndexWrite(shardNo string, index uint64, term uint32, w pebble.Writer, o *pebble.WriteOptions) error {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint64(data, index)
+	binary.BigEndian.PutUint32(data[8:], term)
+	return w.Set(key.NewCompactedIndexKey(shardNo), data, o)
+}
+
+// compactedIndexAndTerm 获取已压缩的最后一条日志的下标和任期
+func (p *PebbleShardLogStorage) compactedIndexAndTerm(shardNo string) (uint64, uint32, error) {
+	data, closer, err := p.shardDB(shardNo).Get(key.NewCompactedIndexKey(shardNo))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	defer closer.Close()
+	if len(data) < 12 {
+		return 0, 0, nil
+	}
+	return binary.BigEndian.Uint64(data), binary.BigEndian.Uint32(data[8:]), nil
+}
+
 // GetMaxIndex 获取最大的index 和最后一次写入的时间
 func (p *PebbleShardLogStorage) getMaxIndex(shardNo string) (uint64, uint64, error) {
 	maxIndexKeyData := key.NewMaxIndexKey(shardNo)
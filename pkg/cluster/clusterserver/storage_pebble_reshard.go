@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/cockroachdb/pebble"
+)
+
+// ReshardPebbleShardLogStorage 离线将srcPath下from个分片的槽日志按槽key重新分配到dstPath下的to个分片，返回迁移的key数量
+// slotCount为集群的槽数量，key里只有槽key的hash，通过槽key（SlotIdToKey）找到原始值，无法确定分片的key会返回错误
+func ReshardPebbleShardLogStorage(srcPath string, dstPath string, from uint32, to uint32, slotCount uint32) (int, error) {
+	if from == 0 || to == 0 {
+		return 0, fmt.Errorf("invalid shard num, from: %d to: %d", from, to)
+	}
+	if _, err := os.Stat(dstPath); !os.IsNotExist(err) {
+		return 0, fmt.Errorf("reshard dir %s already exists", dstPath)
+	}
+	for i := uint32(0); i < from; i++ {
+		if _, err := os.Stat(fmt.Sprintf("%s/shard%03d", srcPath, i)); err != nil {
+			return 0, err
+		}
+	}
+
+	// 槽key的hash -> 新分片
+	shardIds := make(map[uint64]uint32, slotCount)
+	for slotId := uint32(0); slotId < slotCount; slotId++ {
+		shardNo := SlotIdToKey(slotId)
+		h64 := fnv.New64a()
+		h64.Write([]byte(shardNo))
+		shardId := uint32(0)
+		if to > 1 {
+			h := fnv.New32()
+			h.Write([]byte(shardNo))
+			shardId = h.Sum32() % to
+		}
+		shardIds[h64.Sum64()] = shardId
+	}
+
+	src := NewPebbleShardLogStorage(srcPath, from)
+	if err := src.Open(); err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst := NewPebbleShardLogStorage(dstPath, to)
+	if err := dst.Open(); err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	count := 0
+	for _, db := range src.dbs {
+		batches := make([]*pebble.Batch, to)
+		for i, d := range dst.dbs {
+			batches[i] = d.NewBatch()
+		}
+		iter := db.NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+			k := iter.Key()
+			if len(k) < 12 {
+				iter.Close()
+				return 0, fmt.Errorf("invalid key %x", k)
+			}
+			shardId, ok := shardIds[binary.BigEndian.Uint64(k[4:])]
+			if !ok {
+				iter.Close()
+				return 0, fmt.Errorf("can not find the slot of key %x", k)
+			}
+			if err := batches[shardId].Set(k, iter.Value(), nil); err != nil {
+				iter.Close()
+				return 0, err
+			}
+			count++
+			if batches[shardId].Len() >= wkdb.ReshardBatchSize {
+				if err := batches[shardId].Commit(dst.noSync); err != nil {
+					iter.Close()
+					return 0, err
+				}
+				batches[shardId] = dst.dbs[shardId].NewBatch()
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return 0, err
+		}
+		for _, batch := range batches {
+			if err := batch.Commit(dst.wo); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// 校验
+	dstCount := 0
+	for _, db := range dst.dbs {
+		iter := db.NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+			dstCount++
+		}
+		if err := iter.Close(); err != nil {
+			return 0, err
+		}
+	}
+	if count != dstCount {
+		return 0, fmt.Errorf("slot log key count mismatch, source: %d resharded: %d", count, dstCount)
+	}
+	return count, nil
+}
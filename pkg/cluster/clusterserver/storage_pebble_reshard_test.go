@@ -0,0 +1,42 @@
+package cluster_test
+
+import (
+	"testing"
+
+	cluster "github.com/WuKongIM/WuKongIM/pkg/cluster/clusterserver"
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshardPebbleShardLogStorage(t *testing.T) {
+	dir := t.TempDir()
+	slotCount := uint32(16)
+
+	s := cluster.NewPebbleShardLogStorage(dir+"/logdb", 2)
+	assert.NoError(t, s.Open())
+	for slotId := uint32(0); slotId < slotCount; slotId++ {
+		shardNo := cluster.SlotIdToKey(slotId)
+		assert.NoError(t, s.AppendLogs(shardNo, []replica.Log{{Id: 1, Index: 1, Term: 1, Data: []byte(shardNo)}}))
+		assert.NoError(t, s.SetAppliedIndex(shardNo, 1))
+	}
+	assert.NoError(t, s.Close())
+
+	count, err := cluster.ReshardPebbleShardLogStorage(dir+"/logdb", dir+"/logdb-reshard", 2, 3, slotCount)
+	assert.NoError(t, err)
+	assert.True(t, count > 0)
+
+	ns := cluster.NewPebbleShardLogStorage(dir+"/logdb-reshard", 3)
+	assert.NoError(t, ns.Open())
+	defer ns.Close()
+	for slotId := uint32(0); slotId < slotCount; slotId++ {
+		shardNo := cluster.SlotIdToKey(slotId)
+		logs, err := ns.Logs(shardNo, 1, 2, 0)
+		assert.NoError(t, err)
+		assert.Len(t, logs, 1)
+		assert.Equal(t, []byte(shardNo), logs[0].Data)
+
+		appliedIndex, err := ns.AppliedIndex(shardNo)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), appliedIndex)
+	}
+}
@@ -43,8 +43,6 @@ const (
 	CMDRemoveAllAllowlist
 	// 追加消息
 	// CMDAppendMessages
-	// 追加用户消息
-	// CMDAppendMessagesOfUser
 	// 追加通知队列消息
 	CMDAppendMessagesOfNotifyQueue
 	// 移除通知队列消息
@@ -61,11 +59,11 @@ const (
 	CMDSystemUIDsAdd
 	// 移除系统UID
 	CMDSystemUIDsRemove
-	// 保存流元数据
+	// 保存流元数据（已废弃，流数据随频道日志复制）
 	CMDSaveStreamMeta
-	// 流结束
+	// 流结束（已废弃，流数据随频道日志复制）
 	CMDStreamEnd
-	// 追加流元素
+	// 追加流元素（已废弃，流数据随频道日志复制）
 	CMDAppendStreamItem
 	// 频道分布式配置保存
 	CMDChannelClusterConfigSave
@@ -76,6 +74,34 @@ const (
 	CMDBatchUpdateConversation
 	// 	// 添加或更新用户和设备
 	CMDAddOrUpdateUserAndDevice
+	// 追加用户消息（放在最后，避免改变已有命令的值）
+	CMDAppendMessagesOfUser
+	// 更新频道成员的已读位置
+	CMDUpdateReadCursors
+	// 添加设备token拒绝名单
+	CMDAddTokenDenies
+	// 移除设备token拒绝名单
+	CMDRemoveTokenDeny
+	// 添加或更新http api密钥
+	CMDAddOrUpdateAPIKey
+	// 增加租户已存储的消息字节数
+	CMDIncTenantStorage
+	// 设置租户的资源使用量（快照）
+	CMDSetTenantUsage
+	// 批量追加多个用户的消息（同一个槽内的用户）
+	CMDAppendMessagesOfUsers
+	// 重置用户消息队列（安装槽快照）
+	CMDRestoreMessagesOfUser
+	// 更新用户最后在线时间（已由CMDUpdateUsersLastSeen代替，保留用于应用旧的日志）
+	CMDUpdateUserLastSeen
+	// 更新用户离线推送免打扰
+	CMDUpdateUserPushMute
+	// 清除设备失效的推送token
+	CMDClearDevicePushToken
+	// 批量更新同一个槽内用户的最后在线时间
+	CMDUpdateUsersLastSeen
+	// 更新用户是否隐藏在线状态
+	CMDUpdateUserPresenceHidden
 )
 
 func (c CMDType) Uint16() uint16 {
@@ -114,8 +140,6 @@ func (c CMDType) String() string {
 		return "CMDRemoveAllAllowlist"
 	// case CMDAppendMessages:
 	// return "CMDAppendMessages"
-	// case CMDAppendMessagesOfUser:
-	// return "CMDAppendMessagesOfUser"
 	case CMDAppendMessagesOfNotifyQueue:
 		return "CMDAppendMessagesOfNotifyQueue"
 	case CMDRemoveMessagesOfNotifyQueue:
@@ -146,6 +170,34 @@ func (c CMDType) String() string {
 		return "CMDDeleteConversations"
 	case CMDAddOrUpdateUserAndDevice:
 		return "CMDAddOrUpdateUserAndDevice"
+	case CMDAppendMessagesOfUser:
+		return "CMDAppendMessagesOfUser"
+	case CMDUpdateReadCursors:
+		return "CMDUpdateReadCursors"
+	case CMDAddTokenDenies:
+		return "CMDAddTokenDenies"
+	case CMDRemoveTokenDeny:
+		return "CMDRemoveTokenDeny"
+	case CMDAddOrUpdateAPIKey:
+		return "CMDAddOrUpdateAPIKey"
+	case CMDIncTenantStorage:
+		return "CMDIncTenantStorage"
+	case CMDSetTenantUsage:
+		return "CMDSetTenantUsage"
+	case CMDAppendMessagesOfUsers:
+		return "CMDAppendMessagesOfUsers"
+	case CMDRestoreMessagesOfUser:
+		return "CMDRestoreMessagesOfUser"
+	case CMDUpdateUserLastSeen:
+		return "CMDUpdateUserLastSeen"
+	case CMDUpdateUserPushMute:
+		return "CMDUpdateUserPushMute"
+	case CMDClearDevicePushToken:
+		return "CMDClearDevicePushToken"
+	case CMDUpdateUsersLastSeen:
+		return "CMDUpdateUsersLastSeen"
+	case CMDUpdateUserPresenceHidden:
+		return "CMDUpdateUserPresenceHidden"
 	default:
 		return fmt.Sprintf("CMDUnknown[%d]", c)
 	}
@@ -326,7 +378,11 @@ func (c *CMD) CMDContent() (string, error) {
 		}), nil
 
 	case CMDAppendMessagesOfNotifyQueue:
-
+		messages, err := c.DecodeCMDAppendMessagesOfNotifyQueue()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(messages), nil
 	case CMDRemoveMessagesOfNotifyQueue:
 
 	case CMDDeleteChannelAndClearMessages:
@@ -392,6 +448,124 @@ func (c *CMD) CMDContent() (string, error) {
 			return "", err
 		}
 		return wkutil.ToJSON(channelClusterConfig), nil
+	case CMDAppendMessagesOfUser:
+		uid, messages, err := c.DecodeCMDAppendMessagesOfUser()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"uid":      uid,
+			"messages": messages,
+		}), nil
+	case CMDAppendMessagesOfUsers:
+		userMessages, err := c.DecodeCMDAppendMessagesOfUsers()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(userMessages), nil
+	case CMDRestoreMessagesOfUser:
+		uid, cursor, lastSeq, messages, err := c.DecodeCMDRestoreMessagesOfUser()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"uid":      uid,
+			"cursor":   cursor,
+			"lastSeq":  lastSeq,
+			"messages": messages,
+		}), nil
+	case CMDUpdateUserLastSeen:
+		id, uid, lastSeen, err := c.DecodeCMDUpdateUserLastSeen()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"id":       id,
+			"uid":      uid,
+			"lastSeen": lastSeen,
+		}), nil
+	case CMDUpdateUserPushMute:
+		id, uid, pushMute, err := c.DecodeCMDUpdateUserPushMute()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"id":       id,
+			"uid":      uid,
+			"pushMute": pushMute,
+		}), nil
+	case CMDClearDevicePushToken:
+		uid, deviceFlag, pushToken, err := c.DecodeCMDClearDevicePushToken()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"uid":        uid,
+			"deviceFlag": deviceFlag,
+			"pushToken":  pushToken,
+		}), nil
+	case CMDUpdateUsersLastSeen:
+		users, err := c.DecodeCMDUpdateUsersLastSeen()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(users), nil
+	case CMDUpdateUserPresenceHidden:
+		id, uid, hidden, err := c.DecodeCMDUpdateUserPresenceHidden()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"id":     id,
+			"uid":    uid,
+			"hidden": hidden,
+		}), nil
+	case CMDUpdateReadCursors:
+		channelId, channelType, cursors, err := c.DecodeCMDUpdateReadCursors()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"channelId":   channelId,
+			"channelType": channelType,
+			"cursors":     cursors,
+		}), nil
+	case CMDAddTokenDenies:
+		denies, err := c.DecodeCMDAddTokenDenies()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(denies), nil
+	case CMDRemoveTokenDeny:
+		uid, jti, err := c.DecodeCMDRemoveTokenDeny()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"uid": uid,
+			"jti": jti,
+		}), nil
+	case CMDAddOrUpdateAPIKey:
+		apiKey, err := c.DecodeCMDAddOrUpdateAPIKey()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(apiKey), nil
+	case CMDIncTenantStorage:
+		appId, delta, err := c.DecodeCMDIncTenantStorage()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(map[string]interface{}{
+			"app_id": appId,
+			"delta":  delta,
+		}), nil
+	case CMDSetTenantUsage:
+		usage, err := c.DecodeCMDSetTenantUsage()
+		if err != nil {
+			return "", err
+		}
+		return wkutil.ToJSON(usage), nil
 
 	}
 
@@ -464,6 +638,9 @@ func EncodeCMDUser(u wkdb.User) []byte {
 	defer enc.End()
 	enc.WriteUint64(u.Id)
 	enc.WriteString(u.Uid)
+	enc.WriteUint8(wkutil.BoolToUint8(u.PushMute))
+	enc.WriteInt64(u.LastSeen)
+	enc.WriteUint8(wkutil.BoolToUint8(u.PresenceHidden))
 	return enc.Bytes()
 }
 
@@ -475,6 +652,26 @@ func (c *CMD) DecodeCMDUser() (u wkdb.User, err error) {
 	if u.Uid, err = decoder.String(); err != nil {
 		return
 	}
+	if decoder.Len() == 0 { // 兼容旧版本没有推送设置的数据
+		return
+	}
+	var pushMute uint8
+	if pushMute, err = decoder.Uint8(); err != nil {
+		return
+	}
+	u.PushMute = wkutil.Uint8ToBool(pushMute)
+
+	if decoder.Len() == 0 { // 兼容旧版本没有在线状态的数据
+		return
+	}
+	if u.LastSeen, err = decoder.Int64(); err != nil {
+		return
+	}
+	var presenceHidden uint8
+	if presenceHidden, err = decoder.Uint8(); err != nil {
+		return
+	}
+	u.PresenceHidden = wkutil.Uint8ToBool(presenceHidden)
 	return
 }
 
@@ -487,6 +684,8 @@ func EncodeCMDDevice(d wkdb.Device) []byte {
 	enc.WriteUint64(d.DeviceFlag)
 	enc.WriteUint8(d.DeviceLevel)
 	enc.WriteString(d.Token)
+	enc.WriteString(d.PushProvider)
+	enc.WriteString(d.PushToken)
 	return enc.Bytes()
 }
 
@@ -510,6 +709,15 @@ func (c *CMD) DecodeCMDDevice() (d wkdb.Device, err error) {
 	if d.Token, err = decoder.String(); err != nil {
 		return
 	}
+	if decoder.Len() == 0 { // 兼容旧版本没有推送token的数据
+		return
+	}
+	if d.PushProvider, err = decoder.String(); err != nil {
+		return
+	}
+	if d.PushToken, err = decoder.String(); err != nil {
+		return
+	}
 	return
 }
 
@@ -720,37 +928,6 @@ func (c *CMD) DecodeCMDStreamEnd() (channelID string, channelType uint8, streamN
 	return
 }
 
-// func EncodeCMDAppendStreamItem(channelID string, channelType uint8, streamNo string, item *wkstore.StreamItem) []byte {
-// 	encoder := wkproto.NewEncoder()
-// 	defer encoder.End()
-
-// 	encoder.WriteString(channelID)
-// 	encoder.WriteUint8(channelType)
-// 	encoder.WriteString(streamNo)
-// 	encoder.WriteBinary(wkstore.EncodeStreamItem(item))
-
-// 	return encoder.Bytes()
-// }
-// func (c *CMD) DecodeCMDAppendStreamItem() (channelID string, channelType uint8, streamNo string, item *wkstore.StreamItem, err error) {
-// 	decoder := wkproto.NewDecoder(c.Data)
-// 	if channelID, err = decoder.String(); err != nil {
-// 		return
-// 	}
-// 	if channelType, err = decoder.Uint8(); err != nil {
-// 		return
-// 	}
-// 	if streamNo, err = decoder.String(); err != nil {
-// 		return
-// 	}
-// 	var itemBytes []byte
-// 	itemBytes, err = decoder.Binary()
-// 	if err != nil {
-// 		return
-// 	}
-// 	item, err = wkstore.DecodeStreamItem(itemBytes)
-// 	return
-// }
-
 func EncodeCMDChannelClusterConfigSave(channelID string, channelType uint8, data []byte) ([]byte, error) {
 	encoder := wkproto.NewEncoder()
 	defer encoder.End()
@@ -812,6 +989,276 @@ func (c *CMD) DecodeCMDAppendMessagesOfUser() (uid string, messages []wkdb.Messa
 	return
 }
 
+func EncodeCMDAppendMessagesOfUsers(userMessages map[string][]wkdb.Message) ([]byte, error) {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint32(uint32(len(userMessages)))
+	for uid, messages := range userMessages {
+		encoder.WriteString(uid)
+		encoder.WriteUint32(uint32(len(messages)))
+		for _, message := range messages {
+			msgData, err := message.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			encoder.WriteBinary(msgData)
+		}
+	}
+	return encoder.Bytes(), nil
+}
+
+func (c *CMD) DecodeCMDAppendMessagesOfUsers() (map[string][]wkdb.Message, error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	userCount, err := decoder.Uint32()
+	if err != nil {
+		return nil, err
+	}
+	userMessages := make(map[string][]wkdb.Message, userCount)
+	for i := uint32(0); i < userCount; i++ {
+		uid, err := decoder.String()
+		if err != nil {
+			return nil, err
+		}
+		count, err := decoder.Uint32()
+		if err != nil {
+			return nil, err
+		}
+		messages := make([]wkdb.Message, 0, count)
+		for j := uint32(0); j < count; j++ {
+			messageBytes, err := decoder.Binary()
+			if err != nil {
+				return nil, err
+			}
+			var msg wkdb.Message
+			if err = msg.Unmarshal(messageBytes); err != nil {
+				return nil, err
+			}
+			messages = append(messages, msg)
+		}
+		userMessages[uid] = messages
+	}
+	return userMessages, nil
+}
+
+func EncodeCMDAppendMessagesOfNotifyQueue(messages []wkdb.Message) ([]byte, error) {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint32(uint32(len(messages)))
+	for _, message := range messages {
+		msgData, err := message.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		encoder.WriteBinary(msgData)
+	}
+	return encoder.Bytes(), nil
+}
+
+func (c *CMD) DecodeCMDAppendMessagesOfNotifyQueue() (messages []wkdb.Message, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	var count uint32
+	if count, err = decoder.Uint32(); err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var messageBytes []byte
+		if messageBytes, err = decoder.Binary(); err != nil {
+			return
+		}
+		var msg wkdb.Message
+		if err = msg.Unmarshal(messageBytes); err != nil {
+			return
+		}
+		messages = append(messages, msg)
+	}
+	return
+}
+
+// EncodeCMDRestoreMessagesOfUser 消息的QueueSeq为队列内的序号
+func EncodeCMDRestoreMessagesOfUser(uid string, cursor uint64, lastSeq uint64, messages []wkdb.Message) ([]byte, error) {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteString(uid)
+	encoder.WriteUint64(cursor)
+	encoder.WriteUint64(lastSeq)
+	encoder.WriteUint32(uint32(len(messages)))
+	for _, message := range messages {
+		msgData, err := message.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		encoder.WriteUint64(message.QueueSeq)
+		encoder.WriteBinary(msgData)
+	}
+	return encoder.Bytes(), nil
+}
+
+func (c *CMD) DecodeCMDRestoreMessagesOfUser() (uid string, cursor uint64, lastSeq uint64, messages []wkdb.Message, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	if cursor, err = decoder.Uint64(); err != nil {
+		return
+	}
+	if lastSeq, err = decoder.Uint64(); err != nil {
+		return
+	}
+	var count uint32
+	if count, err = decoder.Uint32(); err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var queueSeq uint64
+		if queueSeq, err = decoder.Uint64(); err != nil {
+			return
+		}
+		var messageBytes []byte
+		if messageBytes, err = decoder.Binary(); err != nil {
+			return
+		}
+		var msg wkdb.Message
+		if err = msg.Unmarshal(messageBytes); err != nil {
+			return
+		}
+		msg.QueueSeq = queueSeq
+		messages = append(messages, msg)
+	}
+	return
+}
+
+func EncodeCMDUpdateReadCursors(channelId string, channelType uint8, cursors []wkdb.ReadCursor) ([]byte, error) {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteString(channelId)
+	encoder.WriteUint8(channelType)
+	encoder.WriteUint32(uint32(len(cursors)))
+	for _, cursor := range cursors {
+		cursorData, err := cursor.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		encoder.WriteBinary(cursorData)
+	}
+	return encoder.Bytes(), nil
+}
+
+func (c *CMD) DecodeCMDUpdateReadCursors() (channelId string, channelType uint8, cursors []wkdb.ReadCursor, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if channelId, err = decoder.String(); err != nil {
+		return
+	}
+	if channelType, err = decoder.Uint8(); err != nil {
+		return
+	}
+	var count uint32
+	if count, err = decoder.Uint32(); err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var cursorBytes []byte
+		if cursorBytes, err = decoder.Binary(); err != nil {
+			return
+		}
+		var cursor wkdb.ReadCursor
+		if err = cursor.Unmarshal(cursorBytes); err != nil {
+			return
+		}
+		cursors = append(cursors, cursor)
+	}
+	return
+}
+
+func EncodeCMDAddTokenDenies(denies []wkdb.TokenDeny) ([]byte, error) {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint32(uint32(len(denies)))
+	for _, deny := range denies {
+		denyData, err := deny.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		encoder.WriteBinary(denyData)
+	}
+	return encoder.Bytes(), nil
+}
+
+func (c *CMD) DecodeCMDAddTokenDenies() (denies []wkdb.TokenDeny, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	var count uint32
+	if count, err = decoder.Uint32(); err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var denyBytes []byte
+		if denyBytes, err = decoder.Binary(); err != nil {
+			return
+		}
+		var deny wkdb.TokenDeny
+		if err = deny.Unmarshal(denyBytes); err != nil {
+			return
+		}
+		denies = append(denies, deny)
+	}
+	return
+}
+
+func EncodeCMDRemoveTokenDeny(uid string, jti string) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteString(uid)
+	encoder.WriteString(jti)
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDRemoveTokenDeny() (uid string, jti string, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	if jti, err = decoder.String(); err != nil {
+		return
+	}
+	return
+}
+
+func EncodeCMDAddOrUpdateAPIKey(apiKey wkdb.APIKey) ([]byte, error) {
+	return apiKey.Marshal()
+}
+
+func (c *CMD) DecodeCMDAddOrUpdateAPIKey() (apiKey wkdb.APIKey, err error) {
+	err = apiKey.Unmarshal(c.Data)
+	return
+}
+
+func EncodeCMDIncTenantStorage(appId string, delta int64) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteString(appId)
+	encoder.WriteInt64(delta)
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDIncTenantStorage() (appId string, delta int64, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if appId, err = decoder.String(); err != nil {
+		return
+	}
+	if delta, err = decoder.Int64(); err != nil {
+		return
+	}
+	return
+}
+
+func EncodeCMDSetTenantUsage(usage wkdb.TenantUsage) ([]byte, error) {
+	return usage.Marshal()
+}
+
+func (c *CMD) DecodeCMDSetTenantUsage() (usage wkdb.TenantUsage, err error) {
+	err = usage.Unmarshal(c.Data)
+	return
+}
+
 func EncodeCMDDeleteSession(uid string, sessionId uint64) []byte {
 	encoder := wkproto.NewEncoder()
 	defer encoder.End()
@@ -938,3 +1385,125 @@ func (c *CMD) DecodeCMDBatchUpdateConversation() (models []*wkdb.BatchUpdateConv
 }
 
 var ErrStoreStopped = fmt.Errorf("store stopped")
+var ErrMessageLogNotCompactable = fmt.Errorf("message log not compactable")
+
+func (c *CMD) DecodeCMDUpdateUserLastSeen() (id uint64, uid string, lastSeen int64, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if id, err = decoder.Uint64(); err != nil {
+		return
+	}
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	lastSeen, err = decoder.Int64()
+	return
+}
+
+// EncodeCMDUpdateUserPushMute id为用户不存在时创建用户使用的主键
+func EncodeCMDUpdateUserPushMute(id uint64, uid string, pushMute bool) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint64(id)
+	encoder.WriteString(uid)
+	encoder.WriteUint8(wkutil.BoolToUint8(pushMute))
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDUpdateUserPushMute() (id uint64, uid string, pushMute bool, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if id, err = decoder.Uint64(); err != nil {
+		return
+	}
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	var pushMuteI uint8
+	if pushMuteI, err = decoder.Uint8(); err != nil {
+		return
+	}
+	pushMute = wkutil.Uint8ToBool(pushMuteI)
+	return
+}
+
+// EncodeCMDUpdateUsersLastSeen users里的Id为用户不存在时创建用户使用的主键
+func EncodeCMDUpdateUsersLastSeen(users []wkdb.User) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint32(uint32(len(users)))
+	for _, u := range users {
+		encoder.WriteUint64(u.Id)
+		encoder.WriteString(u.Uid)
+		encoder.WriteInt64(u.LastSeen)
+	}
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDUpdateUsersLastSeen() ([]wkdb.User, error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	count, err := decoder.Uint32()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]wkdb.User, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var u wkdb.User
+		if u.Id, err = decoder.Uint64(); err != nil {
+			return nil, err
+		}
+		if u.Uid, err = decoder.String(); err != nil {
+			return nil, err
+		}
+		if u.LastSeen, err = decoder.Int64(); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// EncodeCMDUpdateUserPresenceHidden id为用户不存在时创建用户使用的主键
+func EncodeCMDUpdateUserPresenceHidden(id uint64, uid string, hidden bool) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteUint64(id)
+	encoder.WriteString(uid)
+	encoder.WriteUint8(wkutil.BoolToUint8(hidden))
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDUpdateUserPresenceHidden() (id uint64, uid string, hidden bool, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if id, err = decoder.Uint64(); err != nil {
+		return
+	}
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	var hiddenI uint8
+	if hiddenI, err = decoder.Uint8(); err != nil {
+		return
+	}
+	hidden = wkutil.Uint8ToBool(hiddenI)
+	return
+}
+
+func EncodeCMDClearDevicePushToken(uid string, deviceFlag uint64, pushToken string) []byte {
+	encoder := wkproto.NewEncoder()
+	defer encoder.End()
+	encoder.WriteString(uid)
+	encoder.WriteUint64(deviceFlag)
+	encoder.WriteString(pushToken)
+	return encoder.Bytes()
+}
+
+func (c *CMD) DecodeCMDClearDevicePushToken() (uid string, deviceFlag uint64, pushToken string, err error) {
+	decoder := wkproto.NewDecoder(c.Data)
+	if uid, err = decoder.String(); err != nil {
+		return
+	}
+	if deviceFlag, err = decoder.Uint64(); err != nil {
+		return
+	}
+	pushToken, err = decoder.String()
+	return
+}
@@ -1,6 +1,8 @@
 package clusterstore
 
 import (
+	"time"
+
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/icluster"
 )
 
@@ -14,8 +16,14 @@ type Options struct {
 
 	IsCmdChannel func(string) bool // 是否是cmd频道
 
+	OnPayloadRemoved func(channelId string, channelType uint8, bytes int64) // 消息内容被清理（过期、撤回）的回调
+
+	ReqTimeout time.Duration // 提案请求超时时间
+
 	Db struct {
-		ShardNum int // 分片数量
+		ShardNum             int           // 分片数量
+		ExpireCheckInterval  time.Duration // 过期消息清理的检查间隔
+		MessageSearchIndexOn bool          // 是否开启消息全文检索的倒排索引
 	}
 }
 
@@ -30,11 +38,15 @@ func NewOptions(nodeID uint64, opts ...Option) *Options {
 
 func newOptions() *Options {
 	return &Options{
-		SlotCount: 64,
+		SlotCount:  64,
+		ReqTimeout: time.Second * 10,
 		Db: struct {
-			ShardNum int
+			ShardNum             int
+			ExpireCheckInterval  time.Duration
+			MessageSearchIndexOn bool
 		}{
-			ShardNum: 16,
+			ShardNum:            16,
+			ExpireCheckInterval: time.Minute,
 		},
 	}
 }
@@ -65,12 +77,24 @@ func WithIsCmdChannel(f func(string) bool) Option {
 	}
 }
 
+func WithOnPayloadRemoved(f func(channelId string, channelType uint8, bytes int64)) Option {
+	return func(o *Options) {
+		o.OnPayloadRemoved = f
+	}
+}
+
 func WithGetSlotId(f func(uid string) uint32) Option {
 	return func(o *Options) {
 		o.GetSlotId = f
 	}
 }
 
+func WithReqTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ReqTimeout = timeout
+	}
+}
+
 func WithDbShardNum(num int) Option {
 	return func(o *Options) {
 		o.Db.ShardNum = num
@@ -0,0 +1,24 @@
+package clusterstore
+
+import "github.com/WuKongIM/WuKongIM/pkg/wkdb"
+
+// AddOrUpdateAPIKey 添加或更新http api密钥
+func (s *Store) AddOrUpdateAPIKey(apiKey wkdb.APIKey) error {
+	data, err := EncodeCMDAddOrUpdateAPIKey(apiKey)
+	if err != nil {
+		return err
+	}
+	cmd := NewCMD(CMDAddOrUpdateAPIKey, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(apiKey.KeyId)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// GetAPIKey 获取http api密钥
+func (s *Store) GetAPIKey(keyId string) (wkdb.APIKey, error) {
+	return s.wdb.GetAPIKey(keyId)
+}
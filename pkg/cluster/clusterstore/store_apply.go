@@ -71,12 +71,40 @@ func (s *Store) onMetaApply(slotId uint32, log replica.Log) error {
 		return s.handleDeleteConversations(cmd)
 	case CMDChannelClusterConfigSave: // 保存频道分布式配置
 		return s.handleChannelClusterConfigSave(cmd)
-	// case CMDAppendMessagesOfUser: // 向用户队列里增加消息
-	// 	return s.handleAppendMessagesOfUser(cmd)
+	case CMDAppendMessagesOfUser: // 向用户队列里增加消息
+		return s.handleAppendMessagesOfUser(cmd)
+	case CMDAppendMessagesOfUsers: // 批量向多个用户队列里增加消息
+		return s.handleAppendMessagesOfUsers(cmd)
+	case CMDUpdateUserLastSeen: // 更新用户最后在线时间
+		return s.handleUpdateUserLastSeen(cmd)
+	case CMDUpdateUserPushMute: // 更新用户离线推送免打扰
+		return s.handleUpdateUserPushMute(cmd)
+	case CMDClearDevicePushToken: // 清除设备失效的推送token
+		return s.handleClearDevicePushToken(cmd)
+	case CMDUpdateUsersLastSeen: // 批量更新用户最后在线时间
+		return s.handleUpdateUsersLastSeen(cmd)
+	case CMDUpdateUserPresenceHidden: // 更新用户是否隐藏在线状态
+		return s.handleUpdateUserPresenceHidden(cmd)
+	case CMDRestoreMessagesOfUser: // 重置用户消息队列
+		return s.handleRestoreMessagesOfUser(cmd)
+	case CMDAppendMessagesOfNotifyQueue: // 向消息通知队列里增加消息
+		return s.handleAppendMessagesOfNotifyQueue(cmd)
 	case CMDBatchUpdateConversation:
 		return s.handleBatchUpdateConversation(cmd)
 	case CMDAddOrUpdateUserAndDevice: // 添加或更新用户和设备
 		return s.handleAddOrUpdateUserAndDevice(cmd)
+	case CMDUpdateReadCursors: // 更新频道成员的已读位置
+		return s.handleUpdateReadCursors(cmd)
+	case CMDAddTokenDenies: // 添加设备token拒绝名单
+		return s.handleAddTokenDenies(cmd)
+	case CMDRemoveTokenDeny: // 移除设备token拒绝名单
+		return s.handleRemoveTokenDeny(cmd)
+	case CMDAddOrUpdateAPIKey: // 添加或更新http api密钥
+		return s.handleAddOrUpdateAPIKey(cmd)
+	case CMDIncTenantStorage: // 增加租户已存储的消息字节数
+		return s.handleIncTenantStorage(cmd)
+	case CMDSetTenantUsage: // 设置租户的资源使用量
+		return s.handleSetTenantUsage(cmd)
 		// case CMDChannelClusterConfigDelete: // 删除频道分布式配置
 		// return s.handleChannelClusterConfigDelete(cmd)
 
@@ -268,6 +296,156 @@ func (s *Store) handleAppendMessagesOfUser(cmd *CMD) error {
 	return s.wdb.AppendMessagesOfUserQueue(uid, messages)
 }
 
+func (s *Store) handleAppendMessagesOfUsers(cmd *CMD) error {
+	userMessages, err := cmd.DecodeCMDAppendMessagesOfUsers()
+	if err != nil {
+		return err
+	}
+	for uid, messages := range userMessages {
+		if err = s.wdb.AppendMessagesOfUserQueue(uid, messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) handleRestoreMessagesOfUser(cmd *CMD) error {
+	uid, cursor, lastSeq, messages, err := cmd.DecodeCMDRestoreMessagesOfUser()
+	if err != nil {
+		return err
+	}
+	return s.wdb.RestoreMessagesOfUserQueue(uid, cursor, lastSeq, messages)
+}
+
+func (s *Store) handleAppendMessagesOfNotifyQueue(cmd *CMD) error {
+	messages, err := cmd.DecodeCMDAppendMessagesOfNotifyQueue()
+	if err != nil {
+		return err
+	}
+	return s.wdb.AppendMessageOfNotifyQueue(messages)
+}
+
+func (s *Store) handleUpdateUserLastSeen(cmd *CMD) error {
+	id, uid, lastSeen, err := cmd.DecodeCMDUpdateUserLastSeen()
+	if err != nil {
+		return err
+	}
+	exist, err := s.wdb.ExistUser(uid)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.wdb.AddOrUpdateUser(wkdb.User{
+			Id:       id,
+			Uid:      uid,
+			LastSeen: lastSeen,
+		})
+	}
+	return s.wdb.UpdateUserLastSeen(uid, lastSeen)
+}
+
+func (s *Store) handleUpdateUserPushMute(cmd *CMD) error {
+	id, uid, pushMute, err := cmd.DecodeCMDUpdateUserPushMute()
+	if err != nil {
+		return err
+	}
+	exist, err := s.wdb.ExistUser(uid)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.wdb.AddOrUpdateUser(wkdb.User{
+			Id:       id,
+			Uid:      uid,
+			PushMute: pushMute,
+		})
+	}
+	return s.wdb.UpdateUserPushMute(uid, pushMute)
+}
+
+func (s *Store) handleUpdateUsersLastSeen(cmd *CMD) error {
+	users, err := cmd.DecodeCMDUpdateUsersLastSeen()
+	if err != nil {
+		return err
+	}
+	return s.wdb.UpdateUsersLastSeen(users)
+}
+
+func (s *Store) handleUpdateUserPresenceHidden(cmd *CMD) error {
+	id, uid, hidden, err := cmd.DecodeCMDUpdateUserPresenceHidden()
+	if err != nil {
+		return err
+	}
+	exist, err := s.wdb.ExistUser(uid)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.wdb.AddOrUpdateUser(wkdb.User{
+			Id:             id,
+			Uid:            uid,
+			PresenceHidden: hidden,
+		})
+	}
+	return s.wdb.UpdateUserPresenceHidden(uid, hidden)
+}
+
+func (s *Store) handleClearDevicePushToken(cmd *CMD) error {
+	uid, deviceFlag, pushToken, err := cmd.DecodeCMDClearDevicePushToken()
+	if err != nil {
+		return err
+	}
+	return s.wdb.ClearDevicePushToken(uid, deviceFlag, pushToken)
+}
+
+func (s *Store) handleUpdateReadCursors(cmd *CMD) error {
+	channelId, channelType, cursors, err := cmd.DecodeCMDUpdateReadCursors()
+	if err != nil {
+		return err
+	}
+	return s.wdb.UpdateReadCursors(channelId, channelType, cursors)
+}
+
+func (s *Store) handleAddTokenDenies(cmd *CMD) error {
+	denies, err := cmd.DecodeCMDAddTokenDenies()
+	if err != nil {
+		return err
+	}
+	return s.wdb.AddTokenDenies(denies)
+}
+
+func (s *Store) handleRemoveTokenDeny(cmd *CMD) error {
+	uid, jti, err := cmd.DecodeCMDRemoveTokenDeny()
+	if err != nil {
+		return err
+	}
+	return s.wdb.RemoveTokenDeny(uid, jti)
+}
+
+func (s *Store) handleAddOrUpdateAPIKey(cmd *CMD) error {
+	apiKey, err := cmd.DecodeCMDAddOrUpdateAPIKey()
+	if err != nil {
+		return err
+	}
+	return s.wdb.AddOrUpdateAPIKey(apiKey)
+}
+
+func (s *Store) handleIncTenantStorage(cmd *CMD) error {
+	appId, delta, err := cmd.DecodeCMDIncTenantStorage()
+	if err != nil {
+		return err
+	}
+	return s.wdb.IncTenantStorage(appId, delta)
+}
+
+func (s *Store) handleSetTenantUsage(cmd *CMD) error {
+	usage, err := cmd.DecodeCMDSetTenantUsage()
+	if err != nil {
+		return err
+	}
+	return s.wdb.SetTenantUsage(usage)
+}
+
 func (s *Store) handleBatchUpdateConversation(cmd *CMD) error {
 	models, err := cmd.DecodeCMDBatchUpdateConversation()
 	if err != nil {
@@ -318,11 +496,21 @@ func (s *Store) handleAddOrUpdateUserAndDevice(cmd *CMD) error {
 		}
 	}
 
-	return s.wdb.AddOrUpdateDevice(wkdb.Device{
+	device := wkdb.Device{
 		Id:          id,
 		Uid:         uid,
 		DeviceFlag:  deviceFlag,
 		DeviceLevel: uint8(deviceLevel),
 		Token:       token,
-	})
+	}
+	// 更新token时保留设备的离线推送token
+	oldDevice, err := s.wdb.GetDevice(uid, deviceFlag)
+	if err != nil && err != wkdb.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		device.PushProvider = oldDevice.PushProvider
+		device.PushToken = oldDevice.PushToken
+	}
+	return s.wdb.AddOrUpdateDevice(device)
 }
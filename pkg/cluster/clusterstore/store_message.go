@@ -79,64 +79,68 @@ func (s *Store) GetMessageShardLogStorage() *MessageShardLogStorage {
 	return s.messageShardLogStorage
 }
 
-// // SaveStreamMeta 保存消息流元数据
-// func (s *Store) SaveStreamMeta(meta *wkstore.StreamMeta) error {
-// 	return nil
-// }
-
-// // StreamEnd 结束流
-// func (s *Store) StreamEnd(channelID string, channelType uint8, streamNo string) error {
-// 	return nil
-// }
+// ApplyMessages 频道日志提交后应用消息的派生数据
+func (s *Store) ApplyMessages(channelId string, channelType uint8, startMessageSeq, endMessageSeq uint64) error {
+	return s.wdb.ApplyMessages(channelId, channelType, startMessageSeq, endMessageSeq)
+}
 
-// func (s *Store) GetStreamMeta(channelID string, channelType uint8, streamNo string) (*wkstore.StreamMeta, error) {
-// 	return nil, nil
-// }
+// GetStreamMeta 获取消息流元数据（流数据随频道日志复制，所以在频道副本节点上查询）
+func (s *Store) GetStreamMeta(channelId string, channelType uint8, streamNo string) (wkdb.StreamMeta, error) {
+	return s.wdb.GetStreamMeta(channelId, channelType, streamNo)
+}
 
-// func (s *Store) GetStreamItems(channelID string, channelType uint8, streamNo string) ([]*wkstore.StreamItem, error) {
-// 	return nil, nil
-// }
+// LastStreamSeq 流最后一个片段的序号，包含已追加还没提交的片段（在频道领导节点上分配流序号时使用）
+func (s *Store) LastStreamSeq(channelId string, channelType uint8, streamNo string) (uint32, error) {
+	return s.wdb.LastStreamSeq(channelId, channelType, streamNo)
+}
 
-// // AppendStreamItem 追加消息流
-// func (s *Store) AppendStreamItem(channelID string, channelType uint8, streamNo string, item *wkstore.StreamItem) (uint32, error) {
-// 	return 0, nil
-// }
+// GetStreamItems 获取消息流的所有片段
+func (s *Store) GetStreamItems(channelId string, channelType uint8, streamNo string) ([]wkdb.StreamItem, error) {
+	return s.wdb.GetStreamItems(channelId, channelType, streamNo)
+}
 
+// UpdateMessageOfUserCursorIfNeed 更新用户消息队列的游标，游标之前的消息会被清理
 func (s *Store) UpdateMessageOfUserCursorIfNeed(uid string, messageSeq uint64) error {
-	return nil
+	data := EncodeCMDUpdateMessageOfUserCursorIfNeed(uid, messageSeq)
+	cmd := NewCMD(CMDUpdateMessageOfUserCursorIfNeed, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
 }
 
 func (s *Store) GetMessageOfUserCursor(uid string) (uint64, error) {
-	return 0, nil
+	return s.wdb.GetMessageOfUserQueueCursor(uid)
 }
 
-func (s *Store) AppendMessagesOfUser(subscriber string, messages []wkdb.Message) ([]icluster.ProposeResult, error) {
-	// if len(messages) == 0 {
-	// 	return nil, nil
-	// }
-
-	// logs := make([]replica.Log, 0, len(messages))
-	// for _, message := range messages {
-	// 	data, err := EncodeCMDAppendMessagesOfUser(subscriber, []wkdb.Message{message})
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	cmd := NewCMD(CMDAppendMessagesOfUser, data)
-	// 	cmdData, err := cmd.Marshal()
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	logs = append(logs, replica.Log{
-	// 		Id:   uint64(message.MessageID),
-	// 		Data: cmdData,
-	// 	})
-
-	// }
+func (s *Store) GetMessageOfUserLastSeq(uid string) (uint64, error) {
+	return s.wdb.GetMessageOfUserQueueLastSeq(uid)
+}
 
-	// slotId := s.getChannelSlotId(subscriber)
-	// return s.opts.Cluster.ProposeToSlot(s.ctx, slotId, logs)
+// LoadMessagesOfUser 获取用户消息队列里序号大于等于startMessageSeq的消息
+func (s *Store) LoadMessagesOfUser(uid string, startMessageSeq uint64, limit int) ([]wkdb.Message, error) {
+	return s.wdb.LoadMessagesOfUserQueue(uid, startMessageSeq, limit)
+}
 
-	return nil, nil
+// AppendMessagesOfUsers 向同一个槽内多个用户的消息队列里追加消息（写扩散），一次提案同步到各副本
+func (s *Store) AppendMessagesOfUsers(ctx context.Context, slotId uint32, userMessages map[string][]wkdb.Message) error {
+	if len(userMessages) == 0 {
+		return nil
+	}
+	data, err := EncodeCMDAppendMessagesOfUsers(userMessages)
+	if err != nil {
+		return err
+	}
+	cmd := NewCMD(CMDAppendMessagesOfUsers, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = s.opts.Cluster.ProposeDataToSlot(ctx, slotId, cmdData)
+	return err
 }
 
 func (s *Store) SyncMessageOfUser(uid string, messageSeq uint64, limit uint32) ([]wkdb.Message, error) {
@@ -316,6 +320,15 @@ func (m *MessageShardLogStorage) FirstIndex(shardNo string) (uint64, error) {
 	return 0, nil
 }
 
+// 频道日志即消息，消息的清理走过期机制，不做日志压缩
+func (m *MessageShardLogStorage) CompactLogTo(shardNo string, index uint64) error {
+	return ErrMessageLogNotCompactable
+}
+
+func (m *MessageShardLogStorage) RestoreSnapshot(shardNo string, index uint64, term uint32) error {
+	return replica.ErrSnapshotNotSupported
+}
+
 // 设置成功被状态机应用的日志索引
 func (m *MessageShardLogStorage) SetAppliedIndex(shardNo string, index uint64) error {
 	channelId, channelType := wkutil.ChannelFromlKey(shardNo)
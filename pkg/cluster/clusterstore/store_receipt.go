@@ -0,0 +1,30 @@
+package clusterstore
+
+import (
+	"context"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+)
+
+// UpdateReadCursors 更新频道成员的已读位置
+func (s *Store) UpdateReadCursors(channelId string, channelType uint8, cursors []wkdb.ReadCursor) error {
+	data, err := EncodeCMDUpdateReadCursors(channelId, channelType, cursors)
+	if err != nil {
+		return err
+	}
+	cmd := NewCMD(CMDUpdateReadCursors, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(channelId)
+	timeoutCtx, cancel := context.WithTimeout(s.ctx, s.opts.ReqTimeout)
+	defer cancel()
+	_, err = s.opts.Cluster.ProposeDataToSlot(timeoutCtx, slotId, cmdData)
+	return err
+}
+
+// GetReadCursors 获取频道成员的已读位置
+func (s *Store) GetReadCursors(channelId string, channelType uint8) ([]wkdb.ReadCursor, error) {
+	return s.wdb.GetReadCursors(channelId, channelType)
+}
@@ -0,0 +1,345 @@
+package clusterstore
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"go.uber.org/zap"
+)
+
+// 安装快照时每批应用的命令数量
+const slotSnapshotApplyBatchSize = 1000
+
+// 快照里每条最近会话、通知队列命令包含的最大数量
+const slotSnapshotCMDBatchSize = 1000
+
+// SlotSnapshot 槽的状态快照
+// 创建时只拿数据库快照，保存时按槽索引只遍历槽内的uid和频道，生成能重建槽状态的命令（用户、设备、频道及其订阅者/黑白名单/已读位置、
+// 最近会话、用户消息队列、token拒绝名单、api密钥、租户用量、消息通知队列、频道分布式配置），边生成边写出，不会把整个槽的数据放进内存
+type SlotSnapshot struct {
+	s      *Store
+	slotId uint32
+	snap   *wkdb.Snapshot
+}
+
+// SlotSnapshot 创建槽的状态快照，调用期间槽不能应用日志，这样快照才和已应用的日志下标一致
+func (s *Store) SlotSnapshot(slotId uint32) *SlotSnapshot {
+	return &SlotSnapshot{
+		s:      s,
+		slotId: slotId,
+		snap:   s.wdb.NewSnapshot(),
+	}
+}
+
+func (ss *SlotSnapshot) Close() error {
+	return ss.snap.Close()
+}
+
+func (ss *SlotSnapshot) inSlot(v string) bool {
+	return ss.s.opts.GetSlotId(v) == ss.slotId
+}
+
+// Save 将快照写入w，格式为连续的 命令长度(uint32) + 命令
+func (ss *SlotSnapshot) Save(w io.Writer) error {
+	var (
+		cmdCount int
+		sizeBuf  [4]byte
+	)
+	appendCMD := func(cmdType CMDType, data []byte) error {
+		cmdData, err := NewCMD(cmdType, data).Marshal()
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(sizeBuf[:], uint32(len(cmdData)))
+		if _, err = w.Write(sizeBuf[:]); err != nil {
+			return err
+		}
+		if _, err = w.Write(cmdData); err != nil {
+			return err
+		}
+		cmdCount++
+		return nil
+	}
+
+	// 用户相关的数据
+	err := ss.snap.ForEachSlotUid(ss.slotId, func(uid string) error {
+		return ss.saveUid(uid, appendCMD)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 频道
+	err = ss.snap.ForEachSlotChannel(ss.slotId, func(channelId string, channelType uint8) error {
+		return ss.saveChannel(channelId, channelType, appendCMD)
+	})
+	if err != nil {
+		return err
+	}
+
+	// http api密钥
+	apiKeys, err := ss.snap.GetAPIKeys()
+	if err != nil {
+		return err
+	}
+	for _, apiKey := range apiKeys {
+		if !ss.inSlot(apiKey.KeyId) {
+			continue
+		}
+		apiKeyData, err := EncodeCMDAddOrUpdateAPIKey(apiKey)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDAddOrUpdateAPIKey, apiKeyData); err != nil {
+			return err
+		}
+	}
+
+	// 租户的资源使用量
+	usages, err := ss.snap.GetTenantUsages()
+	if err != nil {
+		return err
+	}
+	for _, usage := range usages {
+		if !ss.inSlot(usage.AppId) {
+			continue
+		}
+		usageData, err := EncodeCMDSetTenantUsage(usage)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDSetTenantUsage, usageData); err != nil {
+			return err
+		}
+	}
+
+	// 消息通知队列（按频道所在的槽）
+	notifyMessages, err := ss.snap.GetMessagesOfNotifyQueue()
+	if err != nil {
+		return err
+	}
+	slotMessages := make([]wkdb.Message, 0)
+	for _, msg := range notifyMessages {
+		if ss.inSlot(msg.ChannelID) {
+			slotMessages = append(slotMessages, msg)
+		}
+	}
+	for len(slotMessages) > 0 {
+		n := len(slotMessages)
+		if n > slotSnapshotCMDBatchSize {
+			n = slotSnapshotCMDBatchSize
+		}
+		data, err := EncodeCMDAppendMessagesOfNotifyQueue(slotMessages[:n])
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDAppendMessagesOfNotifyQueue, data); err != nil {
+			return err
+		}
+		slotMessages = slotMessages[n:]
+	}
+
+	// 频道分布式配置
+	cfgs, err := ss.snap.GetChannelClusterConfigWithSlotId(ss.slotId)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range cfgs {
+		cfgData, err := cfg.Marshal()
+		if err != nil {
+			return err
+		}
+		data, err := EncodeCMDChannelClusterConfigSave(cfg.ChannelId, cfg.ChannelType, cfgData)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDChannelClusterConfigSave, data); err != nil {
+			return err
+		}
+	}
+
+	ss.s.Info("slot snapshot", zap.Uint32("slotId", ss.slotId), zap.Int("cmdCount", cmdCount))
+	return nil
+}
+
+// saveUid 写出用户、设备、最近会话、用户消息队列和token拒绝名单
+func (ss *SlotSnapshot) saveUid(uid string, appendCMD func(cmdType CMDType, data []byte) error) error {
+	u, err := ss.snap.GetUser(uid)
+	if err != nil && err != wkdb.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		if err = appendCMD(CMDAddOrUpdateUser, EncodeCMDUser(u)); err != nil {
+			return err
+		}
+	}
+	devices, err := ss.snap.GetDevices(uid)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if err = appendCMD(CMDAddOrUpdateDevice, EncodeCMDDevice(d)); err != nil {
+			return err
+		}
+	}
+
+	// 最近会话
+	conversations, err := ss.snap.GetConversations(uid)
+	if err != nil {
+		return err
+	}
+	for len(conversations) > 0 {
+		n := len(conversations)
+		if n > slotSnapshotCMDBatchSize {
+			n = slotSnapshotCMDBatchSize
+		}
+		data, err := EncodeCMDAddOrUpdateConversations(uid, conversations[:n])
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDAddOrUpdateConversations, data); err != nil {
+			return err
+		}
+		conversations = conversations[n:]
+	}
+
+	// 用户消息队列（整个队列重置，包括游标和最大序号）
+	cursor, lastSeq, messages, err := ss.snap.GetUserQueue(uid)
+	if err != nil {
+		return err
+	}
+	if lastSeq > 0 {
+		data, err := EncodeCMDRestoreMessagesOfUser(uid, cursor, lastSeq, messages)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDRestoreMessagesOfUser, data); err != nil {
+			return err
+		}
+	}
+
+	// 设备token拒绝名单
+	denies, err := ss.snap.GetTokenDenies(uid)
+	if err != nil {
+		return err
+	}
+	if len(denies) > 0 {
+		denyData, err := EncodeCMDAddTokenDenies(denies)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDAddTokenDenies, denyData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveChannel 写出频道信息、订阅者、黑白名单和已读位置
+func (ss *SlotSnapshot) saveChannel(channelId string, channelType uint8, appendCMD func(cmdType CMDType, data []byte) error) error {
+	ch, err := ss.snap.GetChannel(channelId, channelType)
+	if err != nil {
+		return err
+	}
+	if ch.Id != 0 {
+		data, err := EncodeAddOrUpdateChannel(ch)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDAddOrUpdateChannel, data); err != nil {
+			return err
+		}
+	}
+
+	subscribers, err := ss.snap.GetSubscribers(channelId, channelType)
+	if err != nil {
+		return err
+	}
+	if len(subscribers) > 0 {
+		if err = appendCMD(CMDAddSubscribers, EncodeSubscribers(channelId, channelType, subscribers)); err != nil {
+			return err
+		}
+	}
+
+	denylist, err := ss.snap.GetDenylist(channelId, channelType)
+	if err != nil {
+		return err
+	}
+	if len(denylist) > 0 {
+		if err = appendCMD(CMDAddDenylist, EncodeSubscribers(channelId, channelType, denylist)); err != nil {
+			return err
+		}
+	}
+
+	allowlist, err := ss.snap.GetAllowlist(channelId, channelType)
+	if err != nil {
+		return err
+	}
+	if len(allowlist) > 0 {
+		if err = appendCMD(CMDAddAllowlist, EncodeSubscribers(channelId, channelType, allowlist)); err != nil {
+			return err
+		}
+	}
+
+	cursors, err := ss.snap.GetReadCursors(channelId, channelType)
+	if err != nil {
+		return err
+	}
+	if len(cursors) > 0 {
+		cursorData, err := EncodeCMDUpdateReadCursors(channelId, channelType, cursors)
+		if err != nil {
+			return err
+		}
+		if err = appendCMD(CMDUpdateReadCursors, cursorData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstallSlotSnapshot 安装槽的状态快照，先删除本地槽内的所有数据，再按批读取快照里的命令并应用
+func (s *Store) InstallSlotSnapshot(slotId uint32, r io.Reader) error {
+	if err := s.wdb.ClearSlot(slotId); err != nil {
+		return err
+	}
+	var (
+		sizeBuf  [4]byte
+		index    uint64
+		cmdCount int
+	)
+	logs := make([]replica.Log, 0, slotSnapshotApplyBatchSize)
+	for {
+		if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		cmdData := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+		if _, err := io.ReadFull(r, cmdData); err != nil {
+			return err
+		}
+		index++
+		logs = append(logs, replica.Log{
+			Index: index,
+			Data:  cmdData,
+		})
+		if len(logs) >= slotSnapshotApplyBatchSize {
+			if err := s.OnMetaApply(slotId, logs); err != nil {
+				return err
+			}
+			cmdCount += len(logs)
+			logs = make([]replica.Log, 0, slotSnapshotApplyBatchSize)
+		}
+	}
+	if len(logs) > 0 {
+		if err := s.OnMetaApply(slotId, logs); err != nil {
+			return err
+		}
+		cmdCount += len(logs)
+	}
+	s.Info("install slot snapshot", zap.Uint32("slotId", slotId), zap.Int("cmdCount", cmdCount))
+	return nil
+}
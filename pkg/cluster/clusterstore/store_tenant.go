@@ -0,0 +1,20 @@
+package clusterstore
+
+import "github.com/WuKongIM/WuKongIM/pkg/wkdb"
+
+// IncTenantStorage 增加租户已存储的消息字节数
+func (s *Store) IncTenantStorage(appId string, delta int64) error {
+	cmd := NewCMD(CMDIncTenantStorage, EncodeCMDIncTenantStorage(appId, delta))
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(appId)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// GetTenantUsage 获取租户的资源使用量
+func (s *Store) GetTenantUsage(appId string) (wkdb.TenantUsage, error) {
+	return s.wdb.GetTenantUsage(appId)
+}
@@ -0,0 +1,36 @@
+package clusterstore
+
+import "github.com/WuKongIM/WuKongIM/pkg/wkdb"
+
+// AddTokenDeny 添加设备token拒绝名单
+func (s *Store) AddTokenDeny(deny wkdb.TokenDeny) error {
+	data, err := EncodeCMDAddTokenDenies([]wkdb.TokenDeny{deny})
+	if err != nil {
+		return err
+	}
+	cmd := NewCMD(CMDAddTokenDenies, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(deny.Uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// RemoveTokenDeny 移除设备token拒绝名单
+func (s *Store) RemoveTokenDeny(uid string, jti string) error {
+	cmd := NewCMD(CMDRemoveTokenDeny, EncodeCMDRemoveTokenDeny(uid, jti))
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	slotId := s.opts.GetSlotId(uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// GetTokenDenies 获取用户未过期的设备token拒绝名单
+func (s *Store) GetTokenDenies(uid string) ([]wkdb.TokenDeny, error) {
+	return s.wdb.GetTokenDenies(uid)
+}
@@ -1,6 +1,8 @@
 package clusterstore
 
 import (
+	"context"
+
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
 	"go.uber.org/zap"
@@ -56,7 +58,79 @@ func (s *Store) AddOrUpdateUserAndDevice(uid string, deviceFlag wkproto.DeviceFl
 	return err
 }
 
+// UpdateUsersLastSeen 批量更新同一个槽内用户的最后在线时间（只更新这一列，不会覆盖用户的其他设置）
+func (s *Store) UpdateUsersLastSeen(ctx context.Context, slotId uint32, lastSeens map[string]int64) error {
+	if len(lastSeens) == 0 {
+		return nil
+	}
+	users := make([]wkdb.User, 0, len(lastSeens))
+	for uid, lastSeen := range lastSeens {
+		users = append(users, wkdb.User{
+			Id:       s.wdb.NextPrimaryKey(), // 用户不存在时创建用户使用
+			Uid:      uid,
+			LastSeen: lastSeen,
+		})
+	}
+	cmd := NewCMD(CMDUpdateUsersLastSeen, EncodeCMDUpdateUsersLastSeen(users))
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		s.Error("marshal cmd failed", zap.Error(err))
+		return err
+	}
+	_, err = s.opts.Cluster.ProposeDataToSlot(ctx, slotId, cmdData)
+	return err
+}
+
+// UpdateUserPresenceHidden 更新用户是否隐藏在线状态（只更新这一列，不会覆盖用户的其他设置）
+func (s *Store) UpdateUserPresenceHidden(uid string, hidden bool) error {
+	primaryKey := s.wdb.NextPrimaryKey() // 用户不存在时创建用户使用
+	data := EncodeCMDUpdateUserPresenceHidden(primaryKey, uid, hidden)
+	cmd := NewCMD(CMDUpdateUserPresenceHidden, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		s.Error("marshal cmd failed", zap.Error(err))
+		return err
+	}
+	slotId := s.opts.GetSlotId(uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// UpdateUserPushMute 更新用户离线推送免打扰（只更新这一列，不会覆盖用户的其他设置）
+func (s *Store) UpdateUserPushMute(uid string, pushMute bool) error {
+	primaryKey := s.wdb.NextPrimaryKey() // 用户不存在时创建用户使用
+	data := EncodeCMDUpdateUserPushMute(primaryKey, uid, pushMute)
+	cmd := NewCMD(CMDUpdateUserPushMute, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		s.Error("marshal cmd failed", zap.Error(err))
+		return err
+	}
+	slotId := s.opts.GetSlotId(uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
+// ClearDevicePushToken 清除设备失效的推送token，设备已经上报了新的推送token时不清除
+func (s *Store) ClearDevicePushToken(uid string, deviceFlag uint64, pushToken string) error {
+	data := EncodeCMDClearDevicePushToken(uid, deviceFlag, pushToken)
+	cmd := NewCMD(CMDClearDevicePushToken, data)
+	cmdData, err := cmd.Marshal()
+	if err != nil {
+		s.Error("marshal cmd failed", zap.Error(err))
+		return err
+	}
+	slotId := s.opts.GetSlotId(uid)
+	_, err = s.opts.Cluster.ProposeDataToSlot(s.ctx, slotId, cmdData)
+	return err
+}
+
 // GetDevice 获取设备信息
 func (s *Store) GetDevice(uid string, deviceFlag uint64) (wkdb.Device, error) {
 	return s.wdb.GetDevice(uid, deviceFlag)
 }
+
+// GetUser 获取用户信息
+func (s *Store) GetUser(uid string) (wkdb.User, error) {
+	return s.wdb.GetUser(uid)
+}
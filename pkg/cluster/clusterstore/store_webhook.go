@@ -0,0 +1,42 @@
+package clusterstore
+
+import "github.com/WuKongIM/WuKongIM/pkg/wkdb"
+
+// webhook事件只保存在本节点，不需要提案
+
+func (s *Store) AppendWebhookEvents(events []wkdb.WebhookEvent) error {
+	for i := range events {
+		if events[i].Id == 0 {
+			events[i].Id = s.wdb.NextPrimaryKey()
+		}
+	}
+	return s.wdb.AppendWebhookEvents(events)
+}
+
+func (s *Store) GetWebhookEvents(maxNextRetryAt uint64, limit int) ([]wkdb.WebhookEvent, error) {
+	return s.wdb.GetWebhookEvents(maxNextRetryAt, limit)
+}
+
+func (s *Store) RemoveWebhookEvents(events []wkdb.WebhookEvent) error {
+	return s.wdb.RemoveWebhookEvents(events)
+}
+
+func (s *Store) RescheduleWebhookEvents(events []wkdb.WebhookEvent, nextRetryAt uint64) error {
+	return s.wdb.RescheduleWebhookEvents(events, nextRetryAt)
+}
+
+func (s *Store) MoveWebhookEventsToDeadLetter(events []wkdb.WebhookEvent) error {
+	return s.wdb.MoveWebhookEventsToDeadLetter(events)
+}
+
+func (s *Store) GetWebhookDeadLetters(startId uint64, limit int) ([]wkdb.WebhookEvent, error) {
+	return s.wdb.GetWebhookDeadLetters(startId, limit)
+}
+
+func (s *Store) ReplayWebhookDeadLetters(ids []uint64, nextRetryAt uint64) (int, error) {
+	return s.wdb.ReplayWebhookDeadLetters(ids, nextRetryAt)
+}
+
+func (s *Store) RemoveWebhookDeadLetters(ids []uint64) error {
+	return s.wdb.RemoveWebhookDeadLetters(ids)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/clusterconfig/pb"
 	"github.com/WuKongIM/WuKongIM/pkg/cluster/replica"
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
 )
@@ -40,12 +41,17 @@ type Cluster interface {
 	OnMessage(f func(fromNodeId uint64, msg *proto.Message))
 	// NodeIsOnline 节点是否在线
 	NodeIsOnline(nodeId uint64) bool
+	// Nodes 获取集群的所有节点
+	Nodes() []*pb.Node
 	//  GetSlotId 获取槽ID
 	GetSlotId(v string) uint32
 
 	// 领导者Id
 	LeaderId() uint64
 
+	// UpdateChannelReplicaPolicy 将频道的副本策略应用到频道的分布式配置（需要在频道所属槽的领导节点上调用）
+	UpdateChannelReplicaPolicy(ctx context.Context, channelInfo wkdb.ChannelInfo) error
+
 	// 等待集群准备好
 	MustWaitClusterReady()
 	// Monitor 获取监控信息
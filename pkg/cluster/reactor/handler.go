@@ -74,6 +74,11 @@ type IHandler interface {
 	// TruncateLog 截断日志, 从index开始截断,index不能等于0 （保留下来的内容不包含index）
 	// [1,2,3,4,5,6] truncate to 4 = [1,2,3]
 	TruncateLogTo(index uint64) error
+
+	// GetSnapshot 获取状态快照，返回快照对应的日志下标和任期（日志被压缩后，落后太多的副本通过快照追赶）
+	GetSnapshot() (index uint64, term uint32, data []byte, err error)
+	// InstallSnapshot 安装状态快照，安装后index及之前的日志视为已应用
+	InstallSnapshot(index uint64, term uint32, data []byte) error
 }
 
 type handler struct {
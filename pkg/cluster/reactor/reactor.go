@@ -28,6 +28,8 @@ type Reactor struct {
 	processLearnerToFollowerC chan *learnerToFollowerReq // 从learner转为follower
 	processLearnerToLeaderC   chan *learnerToLeaderReq   // 从learner转为leader
 	processFollowerToLeaderC  chan *followerToLeaderReq  // 从follower转为leader
+	processGetSnapshotC       chan *getSnapshotReq       // 获取快照请求
+	processInstallSnapshotC   chan *installSnapshotReq   // 安装快照请求
 
 	stopper *syncutil.Stopper
 
@@ -48,6 +50,8 @@ func New(opts *Options) *Reactor {
 		processLearnerToFollowerC: make(chan *learnerToFollowerReq, 1024),
 		processLearnerToLeaderC:   make(chan *learnerToLeaderReq, 1024),
 		processFollowerToLeaderC:  make(chan *followerToLeaderReq, 1024),
+		processGetSnapshotC:       make(chan *getSnapshotReq, 1024),
+		processInstallSnapshotC:   make(chan *installSnapshotReq, 1024),
 		request:                   opts.Request,
 	}
 	taskPool, err := ants.NewPool(opts.TaskPoolSize, ants.WithPanicHandler(func(err interface{}) {
@@ -77,6 +81,8 @@ func (r *Reactor) Start() error {
 		r.stopper.RunWorker(r.processLearnerToFollowerLoop)
 		r.stopper.RunWorker(r.processLearnerToLeaderLoop)
 		r.stopper.RunWorker(r.processFollowerToLeaderLoop)
+		r.stopper.RunWorker(r.processGetSnapshotLoop)
+		r.stopper.RunWorker(r.processInstallSnapshotLoop)
 	}
 
 	for i := 0; i < 100; i++ {
@@ -558,3 +558,98 @@ type followerToLeaderReq struct {
 	h          *handler
 	followerId uint64
 }
+
+// =================================== 获取快照 ===================================
+
+func (r *Reactor) addGetSnapshotReq(req *getSnapshotReq) {
+	select {
+	case r.processGetSnapshotC <- req:
+	case <-r.stopper.ShouldStop():
+		return
+	}
+}
+
+func (r *Reactor) processGetSnapshotLoop() {
+	for {
+		select {
+		case req := <-r.processGetSnapshotC:
+			r.processGetSnapshot(req)
+		case <-r.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+func (r *Reactor) processGetSnapshot(req *getSnapshotReq) {
+	index, term, data, err := req.h.handler.GetSnapshot()
+	if err != nil {
+		r.Error("get snapshot failed", zap.Error(err), zap.String("handlerKey", req.h.key), zap.Uint64("to", req.to))
+		r.Step(req.h.key, replica.Message{
+			MsgType: replica.MsgSnapshotGetResp,
+			To:      req.to,
+			Reject:  true,
+		})
+		return
+	}
+	r.Info("get snapshot", zap.String("handlerKey", req.h.key), zap.Uint64("to", req.to), zap.Uint64("index", index), zap.Uint32("term", term), zap.Int("size", len(data)))
+	r.Step(req.h.key, replica.Message{
+		MsgType: replica.MsgSnapshotGetResp,
+		To:      req.to,
+		Index:   index,
+		Logs: []replica.Log{
+			{
+				Index: index,
+				Term:  term,
+				Data:  data,
+			},
+		},
+	})
+}
+
+type getSnapshotReq struct {
+	h  *handler
+	to uint64
+}
+
+// =================================== 安装快照 ===================================
+
+func (r *Reactor) addInstallSnapshotReq(req *installSnapshotReq) {
+	select {
+	case r.processInstallSnapshotC <- req:
+	case <-r.stopper.ShouldStop():
+		return
+	}
+}
+
+func (r *Reactor) processInstallSnapshotLoop() {
+	for {
+		select {
+		case req := <-r.processInstallSnapshotC:
+			r.processInstallSnapshot(req)
+		case <-r.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+func (r *Reactor) processInstallSnapshot(req *installSnapshotReq) {
+	snapshot := req.snapshot
+	err := req.h.handler.InstallSnapshot(snapshot.Index, snapshot.Term, snapshot.Data)
+	if err != nil {
+		r.Error("install snapshot failed", zap.Error(err), zap.String("handlerKey", req.h.key), zap.Uint64("index", snapshot.Index))
+		r.Step(req.h.key, replica.Message{
+			MsgType: replica.MsgSnapshotInstallResp,
+			Reject:  true,
+		})
+		return
+	}
+	r.Step(req.h.key, replica.Message{
+		MsgType: replica.MsgSnapshotInstallResp,
+		Index:   snapshot.Index,
+	})
+}
+
+type installSnapshotReq struct {
+	h        *handler
+	snapshot replica.Log
+}
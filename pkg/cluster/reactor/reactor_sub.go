@@ -398,6 +398,18 @@ func (r *ReactorSub) handleReady(handler *handler) bool {
 				logs:       m.Logs,
 				to:         m.From,
 			})
+		case replica.MsgSnapshotGet: // 获取快照
+			r.mr.addGetSnapshotReq(&getSnapshotReq{
+				h:  handler,
+				to: m.From,
+			})
+		case replica.MsgSnapshotInstall: // 安装快照
+			if len(m.Logs) > 0 {
+				r.mr.addInstallSnapshotReq(&installSnapshotReq{
+					h:        handler,
+					snapshot: m.Logs[0],
+				})
+			}
 		case replica.MsgApplyLogs: // 应用日志
 			r.mr.addApplyLogReq(&applyLogReq{
 				h:              handler,
@@ -67,6 +67,15 @@ func (r *replicaLog) updateLastIndex(lastIndex uint64) {
 
 }
 
+// restoreSnapshot 安装快照后，快照下标及之前的日志都视为已存储、已提交、已应用
+func (r *replicaLog) restoreSnapshot(index uint64) {
+	r.unstable.logs = nil
+	r.committedIndex = index
+	r.applyingIndex = index
+	r.appliedIndex = index
+	r.updateLastIndex(index)
+}
+
 func (r *replicaLog) appendLog(logs ...Log) {
 	lastLog := logs[len(logs)-1]
 	r.unstable.truncateAndAppend(logs)
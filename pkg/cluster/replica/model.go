@@ -50,6 +50,11 @@ const (
 	MsgSpeedLevelSet            // 设置速度
 	MsgSpeedLevelChange         // 速度变更
 	MsgChangeRole               // 变更角色
+	MsgSnapshotGet              // 快照获取（领导，本地）
+	MsgSnapshotGetResp          // 快照获取响应（领导，本地）
+	MsgSnapshot                 // 发送快照（领导）
+	MsgSnapshotInstall          // 安装快照（追随者，本地）
+	MsgSnapshotInstallResp      // 安装快照响应（追随者，本地）
 	MsgMaxValue
 )
 
@@ -119,6 +124,16 @@ func (m MsgType) String() string {
 		return "MsgChangeRole"
 	case MsgFollowerToLeader:
 		return "MsgFollowerToLeader"
+	case MsgSnapshotGet:
+		return "MsgSnapshotGet"
+	case MsgSnapshotGetResp:
+		return "MsgSnapshotGetResp"
+	case MsgSnapshot:
+		return "MsgSnapshot"
+	case MsgSnapshotInstall:
+		return "MsgSnapshotInstall"
+	case MsgSnapshotInstallResp:
+		return "MsgSnapshotInstallResp"
 	default:
 		return fmt.Sprintf("MsgUnkown[%d]", m)
 	}
@@ -443,7 +458,8 @@ type Config struct {
 	Version     uint64   // 配置版本
 
 	// 不参与编码
-	Leader uint64 // 领导ID
+	Leader  uint64   // 领导ID
+	AckMode *AckMode // 确认模式，为nil时不改变当前的确认模式
 }
 
 func NewConfig() *Config {
@@ -580,6 +596,7 @@ var (
 	ErrProposalDropped              = errors.New("replica proposal dropped")
 	ErrLeaderTermStartIndexNotFound = errors.New("leader term start index not found")
 	ErrCompacted                    = errors.New("log compacted")
+	ErrSnapshotNotSupported         = errors.New("snapshot not supported")
 )
 
 type SyncInfo struct {
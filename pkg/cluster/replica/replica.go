@@ -39,6 +39,9 @@ type Replica struct {
 
 	syncing bool // 日志同步中
 
+	snapshotInstalling bool            // 快照安装中（追随者）
+	snapshotGetting    map[uint64]bool // 正在获取快照的副本（领导）
+
 	logConflictCheckTick int // 日志冲突检查技术
 
 	// -------------------- election --------------------
@@ -67,6 +70,7 @@ func New(nodeId uint64, optList ...Option) *Replica {
 		opts:            opts,
 		nodeId:          nodeId,
 		lastSyncInfoMap: make(map[uint64]*SyncInfo),
+		snapshotGetting: make(map[uint64]bool),
 		no:              wkutil.GenUUID(),
 	}
 	rc.syncIntervalTick = opts.SyncIntervalTick
@@ -95,7 +99,7 @@ func (r *Replica) HasReady() bool {
 	}
 
 	if isFollower && r.leader != 0 {
-		if r.syncTick >= r.syncIntervalTick && !r.syncing {
+		if r.syncTick >= r.syncIntervalTick && !r.syncing && !r.snapshotInstalling {
 			return true
 		}
 	}
@@ -160,7 +164,7 @@ func (r *Replica) Ready() Ready {
 
 	// ==================== 发起同步 ====================
 	if isFollower && r.leader != 0 {
-		if r.syncTick >= r.syncIntervalTick && !r.syncing {
+		if r.syncTick >= r.syncIntervalTick && !r.syncing && !r.snapshotInstalling {
 			r.syncTick = 0
 			r.msgs = append(r.msgs, r.newSyncMsg())
 			r.syncing = true
@@ -232,6 +236,9 @@ func (r *Replica) switchConfig(cfg Config) {
 	r.Info("switch config", zap.String("cfg", cfg.String()))
 
 	r.cfg = cfg
+	if cfg.AckMode != nil {
+		r.opts.AckMode = *cfg.AckMode
+	}
 	term := r.term
 	if term == 0 {
 		term = 1
@@ -410,6 +417,8 @@ func (r *Replica) reset(term uint32) {
 
 	r.replicaLog.storaging = false
 	r.replicaLog.applying = false
+
+	r.snapshotGetting = make(map[uint64]bool)
 }
 
 // 开始选举
@@ -681,6 +690,37 @@ func (r *Replica) newMsgSyncResp(to uint64, index uint64, logs []Log) Message {
 	}
 }
 
+func (r *Replica) newMsgSnapshotGet(from uint64) Message {
+	return Message{
+		MsgType: MsgSnapshotGet,
+		From:    from,
+		To:      r.nodeId,
+	}
+}
+
+// 快照放在Logs[0]里，日志下标和任期为快照对应的下标和任期
+func (r *Replica) newMsgSnapshot(to uint64, snapshot Log) Message {
+	return Message{
+		MsgType:        MsgSnapshot,
+		From:           r.nodeId,
+		To:             to,
+		Term:           r.term,
+		Index:          snapshot.Index,
+		CommittedIndex: r.replicaLog.committedIndex,
+		Logs:           []Log{snapshot},
+	}
+}
+
+func (r *Replica) newMsgSnapshotInstall(snapshot Log) Message {
+	return Message{
+		MsgType: MsgSnapshotInstall,
+		From:    r.nodeId,
+		To:      r.nodeId,
+		Index:   snapshot.Index,
+		Logs:    []Log{snapshot},
+	}
+}
+
 func (r *Replica) newPong(to uint64) Message {
 	return Message{
 		MsgType:        MsgPong,
@@ -11,7 +11,7 @@ func (r *Replica) Step(m Message) error {
 	case m.Term > r.term: // 高于当前任期
 		r.Info("received message with higher term", zap.Uint32("term", m.Term), zap.Uint32("currentTerm", r.term), zap.Uint64("from", m.From), zap.Uint64("to", m.To), zap.String("msgType", m.MsgType.String()))
 		// 高任期消息
-		if m.MsgType == MsgPing || m.MsgType == MsgLeaderTermStartIndexResp || m.MsgType == MsgSyncResp {
+		if m.MsgType == MsgPing || m.MsgType == MsgLeaderTermStartIndexResp || m.MsgType == MsgSyncResp || m.MsgType == MsgSnapshot {
 			if r.role == RoleLearner {
 				r.becomeLearner(m.Term, m.From)
 			} else {
@@ -76,6 +76,14 @@ func (r *Replica) Step(m Message) error {
 
 		}
 
+	case MsgSnapshotInstallResp: // 快照安装返回
+		r.snapshotInstalling = false
+		if !m.Reject {
+			r.Info("snapshot installed", zap.Uint64("index", m.Index), zap.Uint64("lastLogIndex", r.replicaLog.lastLogIndex))
+			r.replicaLog.restoreSnapshot(m.Index)
+			r.syncTick = r.syncIntervalTick // 立马从快照之后开始同步
+		}
+
 	case MsgConfigResp:
 		if !m.Reject {
 			cfg := Config{}
@@ -158,7 +166,22 @@ func (r *Replica) stepLeader(m Message) error {
 			r.send(r.newMsgSyncResp(m.To, m.Index, m.Logs))
 		}
 
+	case MsgSnapshotGetResp:
+		delete(r.snapshotGetting, m.To)
+		if !m.Reject && len(m.Logs) > 0 {
+			r.send(r.newMsgSnapshot(m.To, m.Logs[0]))
+		}
+
 	case MsgSyncReq:
+		// 副本需要的日志已经被压缩，只能通过快照追赶
+		if firstIndex := r.replicaLog.firstIndex(); firstIndex > 0 && m.Index < firstIndex {
+			if !r.snapshotGetting[m.From] {
+				r.Info("log compacted, send snapshot", zap.Uint64("to", m.From), zap.Uint64("syncIndex", m.Index), zap.Uint64("firstIndex", firstIndex))
+				r.snapshotGetting[m.From] = true
+				r.send(r.newMsgSnapshotGet(m.From))
+			}
+			return nil
+		}
 		lastIndex := r.replicaLog.lastLogIndex
 		if m.Index <= lastIndex {
 			unstableLogs, exceed, err := r.replicaLog.getLogsFromUnstable(m.Index, lastIndex+1, logEncodingSize(r.opts.SyncLimitSize))
@@ -289,7 +312,8 @@ func (r *Replica) stepFollower(m Message) error {
 			r.syncTick = 0
 		}
 		r.updateFollowCommittedIndex(m.CommittedIndex) // 更新提交索引
-
+	case MsgSnapshot: // 收到领导的快照
+		r.handleSnapshot(m)
 	}
 	return nil
 }
@@ -348,11 +372,33 @@ func (r *Replica) stepLearner(m Message) error {
 			r.syncTick = 0
 		}
 		r.updateFollowCommittedIndex(m.CommittedIndex) // 更新提交索引
+	case MsgSnapshot: // 收到领导的快照
+		r.handleSnapshot(m)
 	}
 
 	return nil
 }
 
+// handleSnapshot 追随者或学习者收到领导的快照，交给上层安装
+func (r *Replica) handleSnapshot(m Message) {
+	r.syncing = false
+	r.electionElapsed = 0
+	if len(m.Logs) == 0 || r.snapshotInstalling {
+		return
+	}
+	snapshot := m.Logs[0]
+	if snapshot.Index <= r.replicaLog.lastLogIndex {
+		r.Warn("snapshot is older than local log, ignore", zap.Uint64("snapshotIndex", snapshot.Index), zap.Uint64("lastLogIndex", r.replicaLog.lastLogIndex))
+		return
+	}
+	// 还有日志在存储或应用中，等下次同步再安装
+	if r.replicaLog.storaging || r.replicaLog.applying {
+		return
+	}
+	r.snapshotInstalling = true
+	r.send(r.newMsgSnapshotInstall(snapshot))
+}
+
 func (r *Replica) stepCandidate(m Message) error {
 	switch m.MsgType {
 	case MsgPing:
@@ -476,7 +522,10 @@ func (r *Replica) committedIndexForLeader() uint64 {
 
 	committed := r.replicaLog.committedIndex
 	quorum := r.quorum() // r.replicas 不包含本节点
-	if quorum <= 1 {     // 如果少于或等于一个节点，那么直接返回最后一条日志下标
+	if r.opts.AckMode == AckModeAll {
+		quorum = len(r.replicas) + 1 // 所有节点确认
+	}
+	if quorum <= 1 { // 如果少于或等于一个节点，那么直接返回最后一条日志下标
 		return r.replicaLog.lastLogIndex
 	}
 
@@ -521,3 +521,77 @@ func TestFollowerToLeader(t *testing.T) {
 	assert.True(t, hasMsg(rd.Messages, MsgSyncResp))
 	assert.True(t, hasMsg(rd.Messages, MsgFollowerToLeader))
 }
+
+// 测试追随者通过快照追赶日志
+func TestFollowerInstallSnapshot(t *testing.T) {
+	r := New(1, WithSyncIntervalTick(1))
+	initReplica(r, Config{Role: RoleFollower, Term: 1, Leader: 2}, t)
+
+	r.Tick()
+	rd := r.Ready()
+	assert.True(t, hasMsg(rd.Messages, MsgSyncReq))
+
+	// 领导的日志已压缩，返回快照
+	err := r.Step(Message{
+		MsgType: MsgSnapshot,
+		From:    2,
+		Term:    1,
+		Index:   100,
+		Logs:    []Log{{Index: 100, Term: 1, Data: []byte("snapshot")}},
+	})
+	assert.NoError(t, err)
+
+	rd = r.Ready()
+	assert.True(t, hasMsg(rd.Messages, MsgSnapshotInstall))
+	installMsg := getMsg(rd.Messages, MsgSnapshotInstall)
+	assert.Equal(t, uint64(100), installMsg.Logs[0].Index)
+
+	// 安装中不会再发起同步
+	r.Tick()
+	assert.False(t, hasMsg(r.Ready().Messages, MsgSyncReq))
+
+	err = r.Step(Message{
+		MsgType: MsgSnapshotInstallResp,
+		Index:   100,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(100), r.replicaLog.lastLogIndex)
+	assert.Equal(t, uint64(100), r.replicaLog.appliedIndex)
+
+	// 安装完成后从快照之后开始同步
+	rd = r.Ready()
+	assert.True(t, hasMsg(rd.Messages, MsgSyncReq))
+	syncMsg := getMsg(rd.Messages, MsgSyncReq)
+	assert.Equal(t, uint64(101), syncMsg.Index)
+}
+
+// 测试所有节点确认模式下的提交下标
+func TestAckModeAllCommittedIndex(t *testing.T) {
+	r := New(1)
+	cfg := Config{
+		Role:     RoleLeader,
+		Term:     1,
+		Replicas: []uint64{1, 2, 3},
+	}
+	initReplica(r, cfg, t)
+
+	r.replicaLog.appendLog(Log{Index: 1, Term: 1, Data: []byte("hello")})
+	r.lastSyncInfoMap[2].LastSyncIndex = 2 // 节点2已同步到下标1
+	r.lastSyncInfoMap[3].LastSyncIndex = 1 // 节点3还没有同步
+
+	// 默认大多数节点确认
+	assert.Equal(t, uint64(1), r.committedIndexForLeader())
+
+	ackMode := AckModeAll
+	cfg.AckMode = &ackMode
+	err := r.Step(Message{
+		MsgType: MsgConfigResp,
+		Config:  cfg,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), r.committedIndexForLeader())
+
+	r.lastSyncInfoMap[3].LastSyncIndex = 2
+	assert.Equal(t, uint64(1), r.committedIndexForLeader())
+}
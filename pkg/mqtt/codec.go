@@ -0,0 +1,164 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"io"
+	"unicode/utf8"
+)
+
+// decoder 按MQTT的数据类型读取报文内容，出错后后续读取都返回零值，最后统一检查err
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.off
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrMalformedPacket
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.remaining() < 1 {
+		d.fail()
+		return 0
+	}
+	b := d.buf[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || d.remaining() < 2 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.buf[d.off:])
+	d.off += 2
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || d.remaining() < 4 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.buf[d.off:])
+	d.off += 4
+	return v
+}
+
+func (d *decoder) varInt() uint32 {
+	var (
+		value      uint32
+		multiplier uint32
+	)
+	for {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		value |= uint32(b&0x7f) << multiplier
+		if b&0x80 == 0 {
+			return value
+		}
+		multiplier += 7
+		if multiplier > 21 {
+			d.fail()
+			return 0
+		}
+	}
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n < 0 || d.remaining() < n {
+		d.fail()
+		return nil
+	}
+	v := make([]byte, n)
+	copy(v, d.buf[d.off:d.off+n])
+	d.off += n
+	return v
+}
+
+// binary 两字节长度前缀的二进制数据
+func (d *decoder) binary() []byte {
+	n := d.uint16()
+	return d.bytes(int(n))
+}
+
+// string 两字节长度前缀的UTF-8字符串
+func (d *decoder) string() string {
+	v := d.binary()
+	if d.err != nil {
+		return ""
+	}
+	if !utf8.Valid(v) {
+		d.fail()
+		return ""
+	}
+	return string(v)
+}
+
+// rest 剩余的所有数据
+func (d *decoder) rest() []byte {
+	return d.bytes(d.remaining())
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendVarInt(buf []byte, v uint32) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if v == 0 {
+			return buf
+		}
+	}
+}
+
+func appendBinary(buf []byte, v []byte) []byte {
+	buf = appendUint16(buf, uint16(len(v)))
+	return append(buf, v...)
+}
+
+func appendString(buf []byte, v string) []byte {
+	buf = appendUint16(buf, uint16(len(v)))
+	return append(buf, v...)
+}
+
+func readVarInt(r io.ByteReader) (uint32, error) {
+	var (
+		value      uint32
+		multiplier uint32
+	)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << multiplier
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		multiplier += 7
+		if multiplier > 21 {
+			return 0, ErrMalformedPacket
+		}
+	}
+}
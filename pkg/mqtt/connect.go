@@ -1,4 +1,185 @@
 package mqtt
 
+import (
+	"errors"
+	"io"
+)
+
+// ErrUnsupportedVersion 不支持的协议级别，服务端需要回复CONNACK(0x01)后断开连接
+var ErrUnsupportedVersion = errors.New("mqtt: unsupported protocol version")
+
+// ConnectPacket 连接报文
 type ConnectPacket struct {
+	ProtocolName string
+	Version      byte // 协议级别
+	CleanStart   bool
+	KeepAlive    uint16 // 保持连接的时间（秒）
+	Properties   *Properties
+
+	ClientID string
+
+	WillFlag       bool
+	WillQoS        byte
+	WillRetain     bool
+	WillProperties *Properties
+	WillTopic      string
+	WillPayload    []byte
+
+	UsernameFlag bool
+	Username     string
+	PasswordFlag bool
+	Password     []byte
+}
+
+func (c *ConnectPacket) Type() PacketType {
+	return CONNECT
+}
+
+func (c *ConnectPacket) Encode(w io.Writer) error {
+	protocolName := c.ProtocolName
+	if protocolName == "" {
+		protocolName = "MQTT"
+		if c.Version == Version31 {
+			protocolName = "MQIsdp"
+		}
+	}
+	var flags byte
+	if c.UsernameFlag {
+		flags |= 0x80
+	}
+	if c.PasswordFlag {
+		flags |= 0x40
+	}
+	if c.WillFlag {
+		flags |= 0x04 | (c.WillQoS&0x03)<<3
+		if c.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if c.CleanStart {
+		flags |= 0x02
+	}
+
+	body := appendString(nil, protocolName)
+	body = append(body, c.Version, flags)
+	body = appendUint16(body, c.KeepAlive)
+	if c.Version == Version5 {
+		body = append(body, c.Properties.encode()...)
+	}
+	body = appendString(body, c.ClientID)
+	if c.WillFlag {
+		if c.Version == Version5 {
+			body = append(body, c.WillProperties.encode()...)
+		}
+		body = appendString(body, c.WillTopic)
+		body = appendBinary(body, c.WillPayload)
+	}
+	if c.UsernameFlag {
+		body = appendString(body, c.Username)
+	}
+	if c.PasswordFlag {
+		body = appendBinary(body, c.Password)
+	}
+	return writePacket(w, CONNECT, 0, body)
+}
+
+func (c *ConnectPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	c.ProtocolName = d.string()
+	c.Version = d.byte()
+	if d.err != nil {
+		return d.err
+	}
+	switch c.Version {
+	case Version31:
+		if c.ProtocolName != "MQIsdp" {
+			return ErrProtocolError
+		}
+	case Version311, Version5:
+		if c.ProtocolName != "MQTT" {
+			return ErrProtocolError
+		}
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	flags := d.byte()
+	if flags&0x01 != 0 { // 保留位必须为0
+		return ErrMalformedPacket
+	}
+	c.UsernameFlag = flags&0x80 != 0
+	c.PasswordFlag = flags&0x40 != 0
+	c.WillRetain = flags&0x20 != 0
+	c.WillQoS = (flags >> 3) & 0x03
+	c.WillFlag = flags&0x04 != 0
+	c.CleanStart = flags&0x02 != 0
+	if c.WillQoS > 2 || (!c.WillFlag && (c.WillQoS != 0 || c.WillRetain)) {
+		return ErrMalformedPacket
+	}
+	c.KeepAlive = d.uint16()
+	if c.Version == Version5 {
+		c.Properties = d.properties()
+	}
+	c.ClientID = d.string()
+	if c.WillFlag {
+		if c.Version == Version5 {
+			c.WillProperties = d.properties()
+		}
+		c.WillTopic = d.string()
+		c.WillPayload = d.binary()
+	}
+	if c.UsernameFlag {
+		c.Username = d.string()
+	}
+	if c.PasswordFlag {
+		c.Password = d.binary()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if d.remaining() != 0 {
+		return ErrMalformedPacket
+	}
+	return nil
+}
+
+// ConnackPacket 连接确认报文
+type ConnackPacket struct {
+	Version        byte
+	SessionPresent bool
+	// ReasonCode MQTT 5.0为原因码，MQTT 3.1.1为返回码（ConnAccepted等）
+	ReasonCode ReasonCode
+	Properties *Properties
+}
+
+func (c *ConnackPacket) Type() PacketType {
+	return CONNACK
+}
+
+func (c *ConnackPacket) Encode(w io.Writer) error {
+	var ackFlags byte
+	if c.SessionPresent {
+		ackFlags = 0x01
+	}
+	body := []byte{ackFlags, byte(c.ReasonCode)}
+	if c.Version == Version5 {
+		body = append(body, c.Properties.encode()...)
+	}
+	return writePacket(w, CONNACK, 0, body)
+}
+
+func (c *ConnackPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	c.SessionPresent = d.byte()&0x01 != 0
+	c.ReasonCode = ReasonCode(d.byte())
+	if c.Version == Version5 && d.remaining() > 0 {
+		c.Properties = d.properties()
+	}
+	return d.err
 }
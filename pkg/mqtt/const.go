@@ -4,18 +4,27 @@ type ReasonCode byte
 
 const (
 	Success                           ReasonCode = 0x00 // CONNACK, PUBACK, PUBREC, PUBREL, PUBCOMP, UNSUBACK, AUTH
+	GrantedQoS1                       ReasonCode = 0x01 // SUBACK
+	GrantedQoS2                       ReasonCode = 0x02 // SUBACK
 	NoMatchingSubscribers             ReasonCode = 0x10 // PUBACK, PUBREC
+	NoSubscriptionExisted             ReasonCode = 0x11 // UNSUBACK
 	UnspecifiedError                  ReasonCode = 0x80 // CONNACK, PUBACK, PUBREC, SUBACK, UNSUBACK, DISCONNECT
 	MalformedPacket                   ReasonCode = 0x81 // CONNACK, DISCONNECT
 	ProtocolError                     ReasonCode = 0x82 // CONNACK, DISCONNECT
 	ImplSpecificError                 ReasonCode = 0x83 // CONNACK, PUBACK, PUBREC, SUBACK, UNSUBACK, DISCONNECT
+	UnsupportedProtocolVersion        ReasonCode = 0x84 // CONNACK
 	NotAuthorized                     ReasonCode = 0x87 // CONNACK, PUBACK, PUBREC, SUBACK, UNSUBACK, DISCONNECT
+	ServerUnavailable                 ReasonCode = 0x88 // CONNACK
 	ServerBusy                        ReasonCode = 0x89 // CONNACK, DISCONNECT
+	Banned                            ReasonCode = 0x8A // CONNACK
 	BadAuthMethod                     ReasonCode = 0x8C // CONNACK, DISCONNECT
+	KeepAliveTimeout                  ReasonCode = 0x8D // DISCONNECT
+	SessionTakenOver                  ReasonCode = 0x8E // DISCONNECT
 	TopicFilterInvalid                ReasonCode = 0x8F // SUBACK, UNSUBACK, DISCONNECT
 	TopicNameInvalid                  ReasonCode = 0x90 // CONNACK, PUBACK, PUBREC, DISCONNECT
 	PacketIdentifierInUse             ReasonCode = 0x91 // PUBACK, SUBACK, UNSUBACK
 	PacketIdentifierNotFound          ReasonCode = 0x92 // PUBREL, PUBCOMP
+	TopicAliasInvalid                 ReasonCode = 0x94 // DISCONNECT
 	PacketTooLarge                    ReasonCode = 0x95 // CONNACK, PUBACK, PUBREC, DISCONNECT
 	QuotaExceeded                     ReasonCode = 0x97 // PUBACK, PUBREC, SUBACK, DISCONNECT
 	PayloadFormatInvalid              ReasonCode = 0x99 // CONNACK, DISCONNECT
@@ -28,3 +37,16 @@ const (
 	SubscriptionIdsNotSupported       ReasonCode = 0xA1 // SUBACK, DISCONNECT
 	WildcardSubscriptionsNotSupported ReasonCode = 0xA2 // SUBACK, DISCONNECT
 )
+
+// MQTT 3.1.1 CONNACK的返回码
+const (
+	ConnAccepted                   byte = 0x00
+	ConnRefusedBadProtocolVersion  byte = 0x01
+	ConnRefusedIDRejected          byte = 0x02
+	ConnRefusedServerUnavailable   byte = 0x03
+	ConnRefusedBadUsernamePassword byte = 0x04
+	ConnRefusedNotAuthorized       byte = 0x05
+)
+
+// SUBACK里表示订阅失败的返回码（MQTT 3.1.1）
+const SubackFailure byte = 0x80
@@ -4,6 +4,8 @@ import "io"
 
 // controlPacket MQTT control packet codec interface
 type ControlPacket interface {
+	// Type 报文类型
+	Type() PacketType
 	Encode(w io.Writer) error
 	Decode(r io.Reader, remainingLen uint32) error
 }
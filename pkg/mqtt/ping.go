@@ -0,0 +1,79 @@
+package mqtt
+
+import "io"
+
+// PingreqPacket 心跳请求报文
+type PingreqPacket struct {
+}
+
+func (p *PingreqPacket) Type() PacketType {
+	return PINGREQ
+}
+
+func (p *PingreqPacket) Encode(w io.Writer) error {
+	return writePacket(w, PINGREQ, 0, nil)
+}
+
+func (p *PingreqPacket) Decode(r io.Reader, remainingLen uint32) error {
+	if remainingLen != 0 {
+		return ErrMalformedPacket
+	}
+	return nil
+}
+
+// PingrespPacket 心跳响应报文
+type PingrespPacket struct {
+}
+
+func (p *PingrespPacket) Type() PacketType {
+	return PINGRESP
+}
+
+func (p *PingrespPacket) Encode(w io.Writer) error {
+	return writePacket(w, PINGRESP, 0, nil)
+}
+
+func (p *PingrespPacket) Decode(r io.Reader, remainingLen uint32) error {
+	if remainingLen != 0 {
+		return ErrMalformedPacket
+	}
+	return nil
+}
+
+// DisconnectPacket 断开连接报文
+type DisconnectPacket struct {
+	Version    byte
+	ReasonCode ReasonCode // MQTT 5.0
+	Properties *Properties
+}
+
+func (p *DisconnectPacket) Type() PacketType {
+	return DISCONNECT
+}
+
+func (p *DisconnectPacket) Encode(w io.Writer) error {
+	var body []byte
+	if p.Version == Version5 && (p.ReasonCode != Success || p.Properties != nil) {
+		body = append(body, byte(p.ReasonCode))
+		if p.Properties != nil {
+			body = append(body, p.Properties.encode()...)
+		}
+	}
+	return writePacket(w, DISCONNECT, 0, body)
+}
+
+func (p *DisconnectPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	if p.Version == Version5 {
+		if d.remaining() > 0 {
+			p.ReasonCode = ReasonCode(d.byte())
+		}
+		if d.remaining() > 0 {
+			p.Properties = d.properties()
+		}
+	}
+	return d.err
+}
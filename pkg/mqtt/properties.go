@@ -0,0 +1,238 @@
+package mqtt
+
+// MQTT 5.0 属性标识
+const (
+	PropPayloadFormat          byte = 0x01
+	PropMessageExpiry          byte = 0x02
+	PropContentType            byte = 0x03
+	PropResponseTopic          byte = 0x08
+	PropCorrelationData        byte = 0x09
+	PropSubscriptionIdentifier byte = 0x0B
+	PropSessionExpiryInterval  byte = 0x11
+	PropAssignedClientID       byte = 0x12
+	PropServerKeepAlive        byte = 0x13
+	PropAuthMethod             byte = 0x15
+	PropAuthData               byte = 0x16
+	PropRequestProblemInfo     byte = 0x17
+	PropWillDelayInterval      byte = 0x18
+	PropRequestResponseInfo    byte = 0x19
+	PropResponseInfo           byte = 0x1A
+	PropServerReference        byte = 0x1C
+	PropReasonString           byte = 0x1F
+	PropReceiveMaximum         byte = 0x21
+	PropTopicAliasMaximum      byte = 0x22
+	PropTopicAlias             byte = 0x23
+	PropMaximumQoS             byte = 0x24
+	PropRetainAvailable        byte = 0x25
+	PropUser                   byte = 0x26
+	PropMaximumPacketSize      byte = 0x27
+	PropWildcardSubAvailable   byte = 0x28
+	PropSubIDAvailable         byte = 0x29
+	PropSharedSubAvailable     byte = 0x2A
+)
+
+// UserProperty 用户属性
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// Properties MQTT 5.0 的属性，为nil的字段表示未设置
+type Properties struct {
+	PayloadFormat          *byte
+	MessageExpiry          *uint32
+	ContentType            string
+	ResponseTopic          string
+	CorrelationData        []byte
+	SubscriptionIdentifier []uint32
+	SessionExpiryInterval  *uint32
+	AssignedClientID       string
+	ServerKeepAlive        *uint16
+	AuthMethod             string
+	AuthData               []byte
+	RequestProblemInfo     *byte
+	WillDelayInterval      *uint32
+	RequestResponseInfo    *byte
+	ResponseInfo           string
+	ServerReference        string
+	ReasonString           string
+	ReceiveMaximum         *uint16
+	TopicAliasMaximum      *uint16
+	TopicAlias             *uint16
+	MaximumQoS             *byte
+	RetainAvailable        *byte
+	User                   []UserProperty
+	MaximumPacketSize      *uint32
+	WildcardSubAvailable   *byte
+	SubIDAvailable         *byte
+	SharedSubAvailable     *byte
+}
+
+// GetUser 获取用户属性的值
+func (p *Properties) GetUser(key string) string {
+	if p == nil {
+		return ""
+	}
+	for _, u := range p.User {
+		if u.Key == key {
+			return u.Value
+		}
+	}
+	return ""
+}
+
+func (p *Properties) encode() []byte {
+	var buf []byte
+	if p != nil {
+		appendByteProp := func(id byte, v *byte) {
+			if v != nil {
+				buf = append(buf, id, *v)
+			}
+		}
+		appendUint16Prop := func(id byte, v *uint16) {
+			if v != nil {
+				buf = appendUint16(append(buf, id), *v)
+			}
+		}
+		appendUint32Prop := func(id byte, v *uint32) {
+			if v != nil {
+				buf = appendUint32(append(buf, id), *v)
+			}
+		}
+		appendStringProp := func(id byte, v string) {
+			if v != "" {
+				buf = appendString(append(buf, id), v)
+			}
+		}
+		appendBinaryProp := func(id byte, v []byte) {
+			if len(v) > 0 {
+				buf = appendBinary(append(buf, id), v)
+			}
+		}
+
+		appendByteProp(PropPayloadFormat, p.PayloadFormat)
+		appendUint32Prop(PropMessageExpiry, p.MessageExpiry)
+		appendStringProp(PropContentType, p.ContentType)
+		appendStringProp(PropResponseTopic, p.ResponseTopic)
+		appendBinaryProp(PropCorrelationData, p.CorrelationData)
+		for _, id := range p.SubscriptionIdentifier {
+			buf = appendVarInt(append(buf, PropSubscriptionIdentifier), id)
+		}
+		appendUint32Prop(PropSessionExpiryInterval, p.SessionExpiryInterval)
+		appendStringProp(PropAssignedClientID, p.AssignedClientID)
+		appendUint16Prop(PropServerKeepAlive, p.ServerKeepAlive)
+		appendStringProp(PropAuthMethod, p.AuthMethod)
+		appendBinaryProp(PropAuthData, p.AuthData)
+		appendByteProp(PropRequestProblemInfo, p.RequestProblemInfo)
+		appendUint32Prop(PropWillDelayInterval, p.WillDelayInterval)
+		appendByteProp(PropRequestResponseInfo, p.RequestResponseInfo)
+		appendStringProp(PropResponseInfo, p.ResponseInfo)
+		appendStringProp(PropServerReference, p.ServerReference)
+		appendStringProp(PropReasonString, p.ReasonString)
+		appendUint16Prop(PropReceiveMaximum, p.ReceiveMaximum)
+		appendUint16Prop(PropTopicAliasMaximum, p.TopicAliasMaximum)
+		appendUint16Prop(PropTopicAlias, p.TopicAlias)
+		appendByteProp(PropMaximumQoS, p.MaximumQoS)
+		appendByteProp(PropRetainAvailable, p.RetainAvailable)
+		for _, u := range p.User {
+			buf = appendString(appendString(append(buf, PropUser), u.Key), u.Value)
+		}
+		appendUint32Prop(PropMaximumPacketSize, p.MaximumPacketSize)
+		appendByteProp(PropWildcardSubAvailable, p.WildcardSubAvailable)
+		appendByteProp(PropSubIDAvailable, p.SubIDAvailable)
+		appendByteProp(PropSharedSubAvailable, p.SharedSubAvailable)
+	}
+	return append(appendVarInt(nil, uint32(len(buf))), buf...)
+}
+
+func (d *decoder) properties() *Properties {
+	length := int(d.varInt())
+	if d.err != nil {
+		return nil
+	}
+	if length > d.remaining() {
+		d.fail()
+		return nil
+	}
+	p := &Properties{}
+	end := d.off + length
+	for d.off < end && d.err == nil {
+		id := d.byte()
+		switch id {
+		case PropPayloadFormat:
+			p.PayloadFormat = bytePtr(d.byte())
+		case PropMessageExpiry:
+			p.MessageExpiry = uint32Ptr(d.uint32())
+		case PropContentType:
+			p.ContentType = d.string()
+		case PropResponseTopic:
+			p.ResponseTopic = d.string()
+		case PropCorrelationData:
+			p.CorrelationData = d.binary()
+		case PropSubscriptionIdentifier:
+			p.SubscriptionIdentifier = append(p.SubscriptionIdentifier, d.varInt())
+		case PropSessionExpiryInterval:
+			p.SessionExpiryInterval = uint32Ptr(d.uint32())
+		case PropAssignedClientID:
+			p.AssignedClientID = d.string()
+		case PropServerKeepAlive:
+			p.ServerKeepAlive = uint16Ptr(d.uint16())
+		case PropAuthMethod:
+			p.AuthMethod = d.string()
+		case PropAuthData:
+			p.AuthData = d.binary()
+		case PropRequestProblemInfo:
+			p.RequestProblemInfo = bytePtr(d.byte())
+		case PropWillDelayInterval:
+			p.WillDelayInterval = uint32Ptr(d.uint32())
+		case PropRequestResponseInfo:
+			p.RequestResponseInfo = bytePtr(d.byte())
+		case PropResponseInfo:
+			p.ResponseInfo = d.string()
+		case PropServerReference:
+			p.ServerReference = d.string()
+		case PropReasonString:
+			p.ReasonString = d.string()
+		case PropReceiveMaximum:
+			p.ReceiveMaximum = uint16Ptr(d.uint16())
+		case PropTopicAliasMaximum:
+			p.TopicAliasMaximum = uint16Ptr(d.uint16())
+		case PropTopicAlias:
+			p.TopicAlias = uint16Ptr(d.uint16())
+		case PropMaximumQoS:
+			p.MaximumQoS = bytePtr(d.byte())
+		case PropRetainAvailable:
+			p.RetainAvailable = bytePtr(d.byte())
+		case PropUser:
+			key := d.string()
+			value := d.string()
+			p.User = append(p.User, UserProperty{Key: key, Value: value})
+		case PropMaximumPacketSize:
+			p.MaximumPacketSize = uint32Ptr(d.uint32())
+		case PropWildcardSubAvailable:
+			p.WildcardSubAvailable = bytePtr(d.byte())
+		case PropSubIDAvailable:
+			p.SubIDAvailable = bytePtr(d.byte())
+		case PropSharedSubAvailable:
+			p.SharedSubAvailable = bytePtr(d.byte())
+		default:
+			d.fail()
+		}
+	}
+	if d.off != end {
+		d.fail()
+	}
+	return p
+}
+
+func bytePtr(v byte) *byte {
+	return &v
+}
+
+func uint16Ptr(v uint16) *uint16 {
+	return &v
+}
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
@@ -1,8 +1,253 @@
 package mqtt
 
-import "io"
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
 
-func ReadFrom(r io.Reader) (ControlPacket, error) {
+// PacketType MQTT控制报文类型
+type PacketType byte
 
-	return nil, nil
+const (
+	CONNECT PacketType = iota + 1
+	CONNACK
+	PUBLISH
+	PUBACK
+	PUBREC
+	PUBREL
+	PUBCOMP
+	SUBSCRIBE
+	SUBACK
+	UNSUBSCRIBE
+	UNSUBACK
+	PINGREQ
+	PINGRESP
+	DISCONNECT
+	AUTH
+)
+
+func (p PacketType) String() string {
+	switch p {
+	case CONNECT:
+		return "CONNECT"
+	case CONNACK:
+		return "CONNACK"
+	case PUBLISH:
+		return "PUBLISH"
+	case PUBACK:
+		return "PUBACK"
+	case PUBREC:
+		return "PUBREC"
+	case PUBREL:
+		return "PUBREL"
+	case PUBCOMP:
+		return "PUBCOMP"
+	case SUBSCRIBE:
+		return "SUBSCRIBE"
+	case SUBACK:
+		return "SUBACK"
+	case UNSUBSCRIBE:
+		return "UNSUBSCRIBE"
+	case UNSUBACK:
+		return "UNSUBACK"
+	case PINGREQ:
+		return "PINGREQ"
+	case PINGRESP:
+		return "PINGRESP"
+	case DISCONNECT:
+		return "DISCONNECT"
+	case AUTH:
+		return "AUTH"
+	}
+	return fmt.Sprintf("UNKNOWN[%d]", p)
+}
+
+// 协议级别
+const (
+	Version31  byte = 3 // MQTT 3.1
+	Version311 byte = 4 // MQTT 3.1.1
+	Version5   byte = 5 // MQTT 5.0
+)
+
+// MaxRemainingLength 剩余长度的最大值
+const MaxRemainingLength = 268435455
+
+var (
+	ErrMalformedPacket = errors.New("mqtt: malformed packet")
+	ErrProtocolError   = errors.New("mqtt: protocol error")
+	ErrUnknownPacket   = errors.New("mqtt: unknown packet type")
+)
+
+// FixedHeader 固定报头
+type FixedHeader struct {
+	Type            PacketType
+	Flags           byte
+	RemainingLength uint32
+}
+
+func (h FixedHeader) encode(w io.Writer) error {
+	buf := make([]byte, 0, 5)
+	buf = append(buf, byte(h.Type)<<4|h.Flags&0x0f)
+	buf = appendVarInt(buf, h.RemainingLength)
+	_, err := w.Write(buf)
+	return err
+}
+
+// NewControlPacket 根据固定报头创建对应的报文，version为连接的协议级别（CONNECT报文自带协议级别，忽略此参数）
+func NewControlPacket(header FixedHeader, version byte) (ControlPacket, error) {
+	switch header.Type {
+	case CONNECT:
+		return &ConnectPacket{}, nil
+	case CONNACK:
+		return &ConnackPacket{Version: version}, nil
+	case PUBLISH:
+		qos := (header.Flags >> 1) & 0x03
+		if qos > 2 {
+			return nil, ErrMalformedPacket
+		}
+		return &PublishPacket{
+			Version: version,
+			Dup:     header.Flags&0x08 != 0,
+			QoS:     qos,
+			Retain:  header.Flags&0x01 != 0,
+		}, nil
+	case PUBACK, PUBREC, PUBREL, PUBCOMP:
+		if header.Type == PUBREL && header.Flags != 0x02 {
+			return nil, ErrMalformedPacket
+		}
+		return &PubackPacket{Version: version, PacketType: header.Type}, nil
+	case SUBSCRIBE:
+		if header.Flags != 0x02 {
+			return nil, ErrMalformedPacket
+		}
+		return &SubscribePacket{Version: version}, nil
+	case SUBACK:
+		return &SubackPacket{Version: version}, nil
+	case UNSUBSCRIBE:
+		if header.Flags != 0x02 {
+			return nil, ErrMalformedPacket
+		}
+		return &UnsubscribePacket{Version: version}, nil
+	case UNSUBACK:
+		return &UnsubackPacket{Version: version}, nil
+	case PINGREQ:
+		return &PingreqPacket{}, nil
+	case PINGRESP:
+		return &PingrespPacket{}, nil
+	case DISCONNECT:
+		return &DisconnectPacket{Version: version}, nil
+	}
+	return nil, ErrUnknownPacket
+}
+
+// ReadFrom 从r中读取一个完整的报文（阻塞读取）
+func ReadFrom(r io.Reader, version byte) (ControlPacket, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+		r = br.(io.Reader)
+	}
+	first, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	remainingLen, err := readVarInt(br)
+	if err != nil {
+		return nil, err
+	}
+	header := FixedHeader{
+		Type:            PacketType(first >> 4),
+		Flags:           first & 0x0f,
+		RemainingLength: remainingLen,
+	}
+	packet, err := NewControlPacket(header, version)
+	if err != nil {
+		return nil, err
+	}
+	if err = packet.Decode(r, remainingLen); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// DecodePacket 从data中解码一个报文，返回报文和报文占用的字节数
+// 数据不完整时返回nil, 0, nil
+func DecodePacket(data []byte, version byte) (ControlPacket, int, error) {
+	if len(data) < 2 {
+		return nil, 0, nil
+	}
+	var (
+		remainingLen uint32
+		multiplier   uint32
+		offset       = 1
+	)
+	for {
+		if offset >= len(data) {
+			return nil, 0, nil
+		}
+		digit := data[offset]
+		offset++
+		remainingLen |= uint32(digit&0x7f) << multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier += 7
+		if multiplier > 21 {
+			return nil, 0, ErrMalformedPacket
+		}
+	}
+	size := offset + int(remainingLen)
+	if len(data) < size {
+		return nil, 0, nil
+	}
+	header := FixedHeader{
+		Type:            PacketType(data[0] >> 4),
+		Flags:           data[0] & 0x0f,
+		RemainingLength: remainingLen,
+	}
+	packet, err := NewControlPacket(header, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = packet.Decode(bytes.NewReader(data[offset:size]), remainingLen); err != nil {
+		return nil, 0, err
+	}
+	return packet, size, nil
+}
+
+// EncodePacket 编码报文
+func EncodePacket(packet ControlPacket) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := packet.Encode(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePacket 写入固定报头和可变报头+载荷
+func writePacket(w io.Writer, packetType PacketType, flags byte, body []byte) error {
+	if len(body) > MaxRemainingLength {
+		return ErrMalformedPacket
+	}
+	header := FixedHeader{Type: packetType, Flags: flags, RemainingLength: uint32(len(body))}
+	if err := header.encode(w); err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// readBody 读取报文的可变报头+载荷
+func readBody(r io.Reader, remainingLen uint32) (*decoder, error) {
+	body := make([]byte, remainingLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &decoder{buf: body}, nil
 }
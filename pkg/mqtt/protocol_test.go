@@ -0,0 +1,143 @@
+package mqtt_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectEncodeAndDecode(t *testing.T) {
+	for _, version := range []byte{mqtt.Version311, mqtt.Version5} {
+		p := &mqtt.ConnectPacket{
+			Version:      version,
+			CleanStart:   true,
+			KeepAlive:    60,
+			ClientID:     "device1",
+			UsernameFlag: true,
+			Username:     "uid1",
+			PasswordFlag: true,
+			Password:     []byte("token1"),
+		}
+		if version == mqtt.Version5 {
+			receiveMaximum := uint16(10)
+			p.Properties = &mqtt.Properties{
+				ReceiveMaximum: &receiveMaximum,
+				User:           []mqtt.UserProperty{{Key: "k", Value: "v"}},
+			}
+		}
+		data, err := mqtt.EncodePacket(p)
+		assert.NoError(t, err)
+
+		packet, size, err := mqtt.DecodePacket(data, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, len(data), size)
+		result := packet.(*mqtt.ConnectPacket)
+		assert.Equal(t, "MQTT", result.ProtocolName)
+		assert.Equal(t, version, result.Version)
+		assert.True(t, result.CleanStart)
+		assert.Equal(t, uint16(60), result.KeepAlive)
+		assert.Equal(t, "device1", result.ClientID)
+		assert.Equal(t, "uid1", result.Username)
+		assert.Equal(t, []byte("token1"), result.Password)
+		if version == mqtt.Version5 {
+			assert.Equal(t, uint16(10), *result.Properties.ReceiveMaximum)
+			assert.Equal(t, "v", result.Properties.GetUser("k"))
+		}
+	}
+}
+
+func TestConnectUnsupportedVersion(t *testing.T) {
+	data, err := mqtt.EncodePacket(&mqtt.ConnectPacket{ProtocolName: "MQTT", Version: 6, ClientID: "c"})
+	assert.NoError(t, err)
+	_, _, err = mqtt.DecodePacket(data, 0)
+	assert.Equal(t, mqtt.ErrUnsupportedVersion, err)
+}
+
+func TestPublishEncodeAndDecode(t *testing.T) {
+	for _, version := range []byte{mqtt.Version311, mqtt.Version5} {
+		p := &mqtt.PublishPacket{
+			Version:  version,
+			QoS:      1,
+			Dup:      true,
+			Topic:    "2/group1",
+			PacketID: 12,
+			Payload:  []byte("hello"),
+		}
+		if version == mqtt.Version5 {
+			p.Properties = &mqtt.Properties{User: []mqtt.UserProperty{{Key: "from_uid", Value: "u1"}}}
+		}
+		data, err := mqtt.EncodePacket(p)
+		assert.NoError(t, err)
+
+		packet, err := mqtt.ReadFrom(bytes.NewReader(data), version)
+		assert.NoError(t, err)
+		result := packet.(*mqtt.PublishPacket)
+		assert.Equal(t, byte(1), result.QoS)
+		assert.True(t, result.Dup)
+		assert.False(t, result.Retain)
+		assert.Equal(t, "2/group1", result.Topic)
+		assert.Equal(t, uint16(12), result.PacketID)
+		assert.Equal(t, []byte("hello"), result.Payload)
+		if version == mqtt.Version5 {
+			assert.Equal(t, "u1", result.Properties.GetUser("from_uid"))
+		}
+	}
+}
+
+func TestDecodePacketIncomplete(t *testing.T) {
+	data, err := mqtt.EncodePacket(&mqtt.PublishPacket{Version: mqtt.Version311, Topic: "a/b", Payload: bytes.Repeat([]byte("x"), 200)})
+	assert.NoError(t, err)
+
+	data = append(data, 0xc0, 0x00) // PINGREQ
+
+	for i := 0; i < len(data)-2; i++ {
+		packet, size, err := mqtt.DecodePacket(data[:i], mqtt.Version311)
+		assert.NoError(t, err)
+		assert.Nil(t, packet)
+		assert.Equal(t, 0, size)
+	}
+	packet, size, err := mqtt.DecodePacket(data, mqtt.Version311)
+	assert.NoError(t, err)
+	assert.Equal(t, mqtt.PUBLISH, packet.Type())
+
+	packet, _, err = mqtt.DecodePacket(data[size:], mqtt.Version311)
+	assert.NoError(t, err)
+	assert.Equal(t, mqtt.PINGREQ, packet.Type())
+}
+
+func TestSubscribeEncodeAndDecode(t *testing.T) {
+	for _, version := range []byte{mqtt.Version311, mqtt.Version5} {
+		data, err := mqtt.EncodePacket(&mqtt.SubscribePacket{
+			Version:  version,
+			PacketID: 3,
+			Subscriptions: []mqtt.Subscription{
+				{Topic: "1/#", QoS: 1},
+				{Topic: "2/+", QoS: 0},
+			},
+		})
+		assert.NoError(t, err)
+		packet, _, err := mqtt.DecodePacket(data, version)
+		assert.NoError(t, err)
+		result := packet.(*mqtt.SubscribePacket)
+		assert.Equal(t, uint16(3), result.PacketID)
+		assert.Len(t, result.Subscriptions, 2)
+		assert.Equal(t, "1/#", result.Subscriptions[0].Topic)
+		assert.Equal(t, byte(1), result.Subscriptions[0].QoS)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	assert.True(t, mqtt.MatchTopic("#", "1/u1"))
+	assert.True(t, mqtt.MatchTopic("1/#", "1/u1"))
+	assert.True(t, mqtt.MatchTopic("1/#", "1"))
+	assert.True(t, mqtt.MatchTopic("+/u1", "1/u1"))
+	assert.False(t, mqtt.MatchTopic("2/+", "1/u1"))
+	assert.False(t, mqtt.MatchTopic("1/+", "1/u1/x"))
+	assert.False(t, mqtt.MatchTopic("#", "$SYS/x"))
+
+	assert.True(t, mqtt.ValidTopicFilter("a/+/#"))
+	assert.False(t, mqtt.ValidTopicFilter("a/#/b"))
+	assert.False(t, mqtt.ValidTopicFilter("a/b+"))
+}
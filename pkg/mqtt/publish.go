@@ -0,0 +1,116 @@
+package mqtt
+
+import (
+	"io"
+	"strings"
+)
+
+// PublishPacket 发布消息报文
+type PublishPacket struct {
+	Version    byte
+	Dup        bool
+	QoS        byte
+	Retain     bool
+	Topic      string
+	PacketID   uint16 // QoS大于0时才有
+	Properties *Properties
+	Payload    []byte
+}
+
+func (p *PublishPacket) Type() PacketType {
+	return PUBLISH
+}
+
+func (p *PublishPacket) Encode(w io.Writer) error {
+	var flags byte
+	if p.Dup {
+		flags |= 0x08
+	}
+	flags |= (p.QoS & 0x03) << 1
+	if p.Retain {
+		flags |= 0x01
+	}
+	body := appendString(nil, p.Topic)
+	if p.QoS > 0 {
+		body = appendUint16(body, p.PacketID)
+	}
+	if p.Version == Version5 {
+		body = append(body, p.Properties.encode()...)
+	}
+	body = append(body, p.Payload...)
+	return writePacket(w, PUBLISH, flags, body)
+}
+
+func (p *PublishPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	p.Topic = d.string()
+	if p.QoS > 0 {
+		p.PacketID = d.uint16()
+		if d.err == nil && p.PacketID == 0 {
+			return ErrProtocolError
+		}
+	}
+	if p.Version == Version5 {
+		p.Properties = d.properties()
+	}
+	p.Payload = d.rest()
+	if d.err != nil {
+		return d.err
+	}
+	// 发布的主题不能包含通配符
+	if strings.ContainsAny(p.Topic, "+#") {
+		return ErrProtocolError
+	}
+	return nil
+}
+
+// PubackPacket PUBACK/PUBREC/PUBREL/PUBCOMP 报文，格式相同
+type PubackPacket struct {
+	Version    byte
+	PacketType PacketType // 默认为PUBACK
+	PacketID   uint16
+	ReasonCode ReasonCode // MQTT 5.0
+	Properties *Properties
+}
+
+func (p *PubackPacket) Type() PacketType {
+	if p.PacketType == 0 {
+		return PUBACK
+	}
+	return p.PacketType
+}
+
+func (p *PubackPacket) Encode(w io.Writer) error {
+	body := appendUint16(nil, p.PacketID)
+	if p.Version == Version5 && (p.ReasonCode != Success || p.Properties != nil) {
+		body = append(body, byte(p.ReasonCode))
+		if p.Properties != nil {
+			body = append(body, p.Properties.encode()...)
+		}
+	}
+	var flags byte
+	if p.Type() == PUBREL {
+		flags = 0x02
+	}
+	return writePacket(w, p.Type(), flags, body)
+}
+
+func (p *PubackPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	p.PacketID = d.uint16()
+	if p.Version == Version5 {
+		if d.remaining() > 0 {
+			p.ReasonCode = ReasonCode(d.byte())
+		}
+		if d.remaining() > 0 {
+			p.Properties = d.properties()
+		}
+	}
+	return d.err
+}
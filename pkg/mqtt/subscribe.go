@@ -0,0 +1,247 @@
+package mqtt
+
+import (
+	"io"
+	"strings"
+)
+
+// Subscription 订阅的主题过滤器和订阅选项
+type Subscription struct {
+	Topic             string
+	QoS               byte
+	NoLocal           bool // MQTT 5.0
+	RetainAsPublished bool // MQTT 5.0
+	RetainHandling    byte // MQTT 5.0
+}
+
+// SubscribePacket 订阅报文
+type SubscribePacket struct {
+	Version       byte
+	PacketID      uint16
+	Properties    *Properties
+	Subscriptions []Subscription
+}
+
+func (s *SubscribePacket) Type() PacketType {
+	return SUBSCRIBE
+}
+
+func (s *SubscribePacket) Encode(w io.Writer) error {
+	body := appendUint16(nil, s.PacketID)
+	if s.Version == Version5 {
+		body = append(body, s.Properties.encode()...)
+	}
+	for _, sub := range s.Subscriptions {
+		body = appendString(body, sub.Topic)
+		opts := sub.QoS & 0x03
+		if s.Version == Version5 {
+			if sub.NoLocal {
+				opts |= 0x04
+			}
+			if sub.RetainAsPublished {
+				opts |= 0x08
+			}
+			opts |= (sub.RetainHandling & 0x03) << 4
+		}
+		body = append(body, opts)
+	}
+	return writePacket(w, SUBSCRIBE, 0x02, body)
+}
+
+func (s *SubscribePacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	s.PacketID = d.uint16()
+	if s.Version == Version5 {
+		s.Properties = d.properties()
+	}
+	for d.err == nil && d.remaining() > 0 {
+		topic := d.string()
+		opts := d.byte()
+		if d.err != nil {
+			break
+		}
+		if opts&0xc0 != 0 || opts&0x03 > 2 {
+			return ErrMalformedPacket
+		}
+		if s.Version != Version5 && opts&0xfc != 0 {
+			return ErrMalformedPacket
+		}
+		s.Subscriptions = append(s.Subscriptions, Subscription{
+			Topic:             topic,
+			QoS:               opts & 0x03,
+			NoLocal:           opts&0x04 != 0,
+			RetainAsPublished: opts&0x08 != 0,
+			RetainHandling:    (opts >> 4) & 0x03,
+		})
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if s.PacketID == 0 || len(s.Subscriptions) == 0 {
+		return ErrProtocolError
+	}
+	return nil
+}
+
+// SubackPacket 订阅确认报文
+type SubackPacket struct {
+	Version    byte
+	PacketID   uint16
+	Properties *Properties
+	// ReasonCodes 每个订阅的结果，MQTT 3.1.1为授予的QoS或SubackFailure
+	ReasonCodes []ReasonCode
+}
+
+func (s *SubackPacket) Type() PacketType {
+	return SUBACK
+}
+
+func (s *SubackPacket) Encode(w io.Writer) error {
+	body := appendUint16(nil, s.PacketID)
+	if s.Version == Version5 {
+		body = append(body, s.Properties.encode()...)
+	}
+	for _, code := range s.ReasonCodes {
+		body = append(body, byte(code))
+	}
+	return writePacket(w, SUBACK, 0, body)
+}
+
+func (s *SubackPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	s.PacketID = d.uint16()
+	if s.Version == Version5 {
+		s.Properties = d.properties()
+	}
+	for _, code := range d.rest() {
+		s.ReasonCodes = append(s.ReasonCodes, ReasonCode(code))
+	}
+	return d.err
+}
+
+// UnsubscribePacket 取消订阅报文
+type UnsubscribePacket struct {
+	Version    byte
+	PacketID   uint16
+	Properties *Properties
+	Topics     []string
+}
+
+func (u *UnsubscribePacket) Type() PacketType {
+	return UNSUBSCRIBE
+}
+
+func (u *UnsubscribePacket) Encode(w io.Writer) error {
+	body := appendUint16(nil, u.PacketID)
+	if u.Version == Version5 {
+		body = append(body, u.Properties.encode()...)
+	}
+	for _, topic := range u.Topics {
+		body = appendString(body, topic)
+	}
+	return writePacket(w, UNSUBSCRIBE, 0x02, body)
+}
+
+func (u *UnsubscribePacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	u.PacketID = d.uint16()
+	if u.Version == Version5 {
+		u.Properties = d.properties()
+	}
+	for d.err == nil && d.remaining() > 0 {
+		u.Topics = append(u.Topics, d.string())
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if u.PacketID == 0 || len(u.Topics) == 0 {
+		return ErrProtocolError
+	}
+	return nil
+}
+
+// UnsubackPacket 取消订阅确认报文
+type UnsubackPacket struct {
+	Version     byte
+	PacketID    uint16
+	Properties  *Properties
+	ReasonCodes []ReasonCode // MQTT 5.0
+}
+
+func (u *UnsubackPacket) Type() PacketType {
+	return UNSUBACK
+}
+
+func (u *UnsubackPacket) Encode(w io.Writer) error {
+	body := appendUint16(nil, u.PacketID)
+	if u.Version == Version5 {
+		body = append(body, u.Properties.encode()...)
+		for _, code := range u.ReasonCodes {
+			body = append(body, byte(code))
+		}
+	}
+	return writePacket(w, UNSUBACK, 0, body)
+}
+
+func (u *UnsubackPacket) Decode(r io.Reader, remainingLen uint32) error {
+	d, err := readBody(r, remainingLen)
+	if err != nil {
+		return err
+	}
+	u.PacketID = d.uint16()
+	if u.Version == Version5 {
+		u.Properties = d.properties()
+		for _, code := range d.rest() {
+			u.ReasonCodes = append(u.ReasonCodes, ReasonCode(code))
+		}
+	}
+	return d.err
+}
+
+// ValidTopicFilter 检查主题过滤器是否合法（+只能占据一整层，#只能在最后一层）
+func ValidTopicFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTopic 主题是否匹配主题过滤器
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	// 以$开头的主题不能被通配符开头的过滤器匹配
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "#" || filterLevels[0] == "+") {
+		return false
+	}
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
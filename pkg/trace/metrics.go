@@ -209,6 +209,22 @@ type IAppMetrics interface {
 	ConnackPacketBytesAdd(v int64)
 	// ConnackPacketCountAdd 连接应答包数量
 	ConnackPacketCountAdd(v int64)
+
+	// UserSendRateLimitedCountAdd 因用户发送限速被拒绝的消息数量
+	UserSendRateLimitedCountAdd(v int64)
+	// ChannelSendRateLimitedCountAdd 因频道发送限速被拒绝的消息数量
+	ChannelSendRateLimitedCountAdd(v int64)
+
+	// TenantConnCountAdd 租户的连接数
+	TenantConnCountAdd(appId string, v int64)
+	// TenantSendMessageCountAdd 租户发送的消息数量
+	TenantSendMessageCountAdd(appId string, v int64)
+	// TenantSendMessageBytesAdd 租户发送的消息流量
+	TenantSendMessageBytesAdd(appId string, v int64)
+	// TenantRateLimitedCountAdd 因租户发送限速被拒绝的消息数量
+	TenantRateLimitedCountAdd(appId string, v int64)
+	// TenantStorageLimitedCountAdd 因租户存储超额被拒绝的消息数量
+	TenantStorageLimitedCountAdd(appId string, v int64)
 }
 
 // IClusterMetrics 分布式监控
@@ -339,6 +355,9 @@ type IClusterMetrics interface {
 	// ChannelActiveCountAdd 频道激活数量
 	ChannelActiveCountAdd(v int64)
 
+	// ChannelReplicaShrinkCountAdd 节点离开时没有可替换的节点，频道副本数量减少的次数
+	ChannelReplicaShrinkCountAdd(v int64)
+
 	// ChannelElectionCountAdd 频道选举次数
 	ChannelElectionCountAdd(v int64)
 	// ChannelElectionSuccessCountAdd 频道选举成功次数
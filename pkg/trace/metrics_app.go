@@ -2,8 +2,10 @@ package trace
 
 import (
 	"context"
+	"sync"
 
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
@@ -33,6 +35,20 @@ type appMetrics struct {
 	connPacketCount    atomic.Int64
 	connackPacketBytes atomic.Int64
 	connackPacketCount atomic.Int64
+
+	userSendRateLimitedCount    atomic.Int64
+	channelSendRateLimitedCount atomic.Int64
+
+	tenants sync.Map // 租户的监控数据 appId -> *tenantAppMetrics
+}
+
+// tenantAppMetrics 租户的监控数据，上报时带上tenant标签
+type tenantAppMetrics struct {
+	connCount           atomic.Int64
+	sendMessageCount    atomic.Int64
+	sendMessageBytes    atomic.Int64
+	rateLimitedCount    atomic.Int64
+	storageLimitedCount atomic.Int64
 }
 
 func newAppMetrics(opts *Options) *appMetrics {
@@ -61,6 +77,8 @@ func newAppMetrics(opts *Options) *appMetrics {
 	connPacketCount := NewInt64ObservableCounter("app_conn_packet_count")
 	connackPacketBytes := NewInt64ObservableCounter("app_connack_packet_bytes")
 	connackPacketCount := NewInt64ObservableCounter("app_connack_packet_count")
+	userSendRateLimitedCount := NewInt64ObservableCounter("app_user_send_rate_limited_count")
+	channelSendRateLimitedCount := NewInt64ObservableCounter("app_channel_send_rate_limited_count")
 
 	RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
 		obs.ObserveInt64(connCount, a.connCount.Load())
@@ -82,8 +100,30 @@ func newAppMetrics(opts *Options) *appMetrics {
 		obs.ObserveInt64(connPacketCount, a.connPacketCount.Load())
 		obs.ObserveInt64(connackPacketBytes, a.connackPacketBytes.Load())
 		obs.ObserveInt64(connackPacketCount, a.connackPacketCount.Load())
+		obs.ObserveInt64(userSendRateLimitedCount, a.userSendRateLimitedCount.Load())
+		obs.ObserveInt64(channelSendRateLimitedCount, a.channelSendRateLimitedCount.Load())
+		return nil
+	}, connCount, onlineUserCount, onlineDeviceCount, pingBytes, pingCount, pongBytes, pongCount, sendPacketBytes, sendPacketCount, sendackPacketBytes, sendackPacketCount, recvPacketBytes, recvPacketCount, recvackPacketBytes, recvackPacketCount, connPacketBytes, connPacketCount, connackPacketBytes, connackPacketCount, userSendRateLimitedCount, channelSendRateLimitedCount)
+
+	tenantConnCount := NewInt64ObservableCounter("app_tenant_conn_count")
+	tenantSendMessageCount := NewInt64ObservableCounter("app_tenant_send_message_count")
+	tenantSendMessageBytes := NewInt64ObservableCounter("app_tenant_send_message_bytes")
+	tenantRateLimitedCount := NewInt64ObservableCounter("app_tenant_rate_limited_count")
+	tenantStorageLimitedCount := NewInt64ObservableCounter("app_tenant_storage_limited_count")
+	RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
+		a.tenants.Range(func(key, value any) bool {
+			attrs := metric.WithAttributes(attribute.String("tenant", key.(string)))
+			t := value.(*tenantAppMetrics)
+			obs.ObserveInt64(tenantConnCount, t.connCount.Load(), attrs)
+			obs.ObserveInt64(tenantSendMessageCount, t.sendMessageCount.Load(), attrs)
+			obs.ObserveInt64(tenantSendMessageBytes, t.sendMessageBytes.Load(), attrs)
+			obs.ObserveInt64(tenantRateLimitedCount, t.rateLimitedCount.Load(), attrs)
+			obs.ObserveInt64(tenantStorageLimitedCount, t.storageLimitedCount.Load(), attrs)
+			return true
+		})
 		return nil
-	}, connCount, onlineUserCount, onlineDeviceCount, pingBytes, pingCount, pongBytes, pongCount, sendPacketBytes, sendPacketCount, sendackPacketBytes, sendackPacketCount, recvPacketBytes, recvPacketCount, recvackPacketBytes, recvackPacketCount, connPacketBytes, connPacketCount, connackPacketBytes, connackPacketCount)
+	}, tenantConnCount, tenantSendMessageCount, tenantSendMessageBytes, tenantRateLimitedCount, tenantStorageLimitedCount)
+
 	var err error
 	a.messageLatency, err = meter.Int64Histogram("app_message_latency", metric.WithDescription("The latency of message processing in the app layer"), metric.WithUnit("ms"))
 	if err != nil {
@@ -170,3 +210,39 @@ func (a *appMetrics) ConnackPacketBytesAdd(v int64) {
 func (a *appMetrics) ConnackPacketCountAdd(v int64) {
 	a.connackPacketCount.Add(v)
 }
+
+func (a *appMetrics) UserSendRateLimitedCountAdd(v int64) {
+	a.userSendRateLimitedCount.Add(v)
+}
+
+func (a *appMetrics) ChannelSendRateLimitedCountAdd(v int64) {
+	a.channelSendRateLimitedCount.Add(v)
+}
+
+func (a *appMetrics) tenant(appId string) *tenantAppMetrics {
+	if v, ok := a.tenants.Load(appId); ok {
+		return v.(*tenantAppMetrics)
+	}
+	v, _ := a.tenants.LoadOrStore(appId, &tenantAppMetrics{})
+	return v.(*tenantAppMetrics)
+}
+
+func (a *appMetrics) TenantConnCountAdd(appId string, v int64) {
+	a.tenant(appId).connCount.Add(v)
+}
+
+func (a *appMetrics) TenantSendMessageCountAdd(appId string, v int64) {
+	a.tenant(appId).sendMessageCount.Add(v)
+}
+
+func (a *appMetrics) TenantSendMessageBytesAdd(appId string, v int64) {
+	a.tenant(appId).sendMessageBytes.Add(v)
+}
+
+func (a *appMetrics) TenantRateLimitedCountAdd(appId string, v int64) {
+	a.tenant(appId).rateLimitedCount.Add(v)
+}
+
+func (a *appMetrics) TenantStorageLimitedCountAdd(appId string, v int64) {
+	a.tenant(appId).storageLimitedCount.Add(v)
+}
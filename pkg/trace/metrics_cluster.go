@@ -33,7 +33,8 @@ type clusterMetrics struct {
 	sendPacketOutgoingCount atomic.Int64
 
 	// channel
-	channelActiveCount metric.Int64UpDownCounter
+	channelActiveCount        metric.Int64UpDownCounter
+	channelReplicaShrinkCount metric.Int64Counter
 
 	// channel log
 	channelLogIncomingBytes atomic.Int64
@@ -142,6 +143,7 @@ func newClusterMetrics(opts *Options) IClusterMetrics {
 	channelLogOutgoingCount := NewInt64ObservableCounter("cluster_channel_log_outgoing_count")
 
 	c.channelActiveCount = NewInt64UpDownCounter("cluster_channel_active_count")
+	c.channelReplicaShrinkCount = NewInt64Counter("cluster_channel_replica_shrink_count")
 	RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
 		obs.ObserveInt64(channelLogIncomingBytes, c.channelLogIncomingBytes.Load())
 		obs.ObserveInt64(channelLogIncomingCount, c.channelLogIncomingCount.Load())
@@ -484,6 +486,10 @@ func (c *clusterMetrics) ChannelActiveCountAdd(v int64) {
 	c.channelActiveCount.Add(c.ctx, v)
 }
 
+func (c *clusterMetrics) ChannelReplicaShrinkCountAdd(v int64) {
+	c.channelReplicaShrinkCount.Add(c.ctx, v)
+}
+
 func (c *clusterMetrics) ChannelElectionCountAdd(v int64) {
 
 }
@@ -0,0 +1,235 @@
+package wkbackup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestName 备份包里清单文件的名称，始终是备份包的第一个文件
+const ManifestName = "manifest.json"
+
+// ManifestVersion 当前的清单格式版本
+const ManifestVersion = 1
+
+var (
+	ErrNoManifest       = errors.New("backup manifest not found")
+	ErrChecksumMismatch = errors.New("backup file checksum mismatch")
+)
+
+// Manifest 备份清单
+type Manifest struct {
+	Version        int    `json:"version"`           // 清单格式版本
+	NodeId         uint64 `json:"node_id"`           // 备份的节点id
+	AppVersion     string `json:"app_version"`       // 备份时的程序版本
+	CreatedAt      int64  `json:"created_at"`        // 备份时间（unix秒）
+	DbShardNum     int    `json:"db_shard_num"`      // 数据库的分区数量
+	SlotDbShardNum int    `json:"slot_db_shard_num"` // 槽日志的分片数量
+	Files          []File `json:"files"`             // 备份的文件，路径相对于数据目录
+}
+
+// File 备份的文件
+type File struct {
+	Path   string `json:"path"`   // 相对路径，使用/分隔
+	Size   int64  `json:"size"`   // 文件大小
+	Sha256 string `json:"sha256"` // 文件内容的sha256
+}
+
+// Write 将目录dir下的所有文件打包为tar.gz写入w，清单中的Files由目录内容生成
+func Write(w io.Writer, dir string, manifest Manifest) error {
+	files, err := scan(dir)
+	if err != nil {
+		return err
+	}
+	manifest.Version = ManifestVersion
+	manifest.Files = files
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{
+		Name: ManifestName,
+		Mode: 0644,
+		Size: int64(len(manifestData)),
+	}); err != nil {
+		return err
+	}
+	if _, err = tw.Write(manifestData); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err = writeFile(tw, dir, file); err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// scan 计算目录dir下所有文件的大小和sha256
+func scan(dir string) ([]File, error) {
+	var files []File
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sum, size, err := checksum(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{
+			Path:   filepath.ToSlash(rel),
+			Size:   size,
+			Sha256: sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+func checksum(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func writeFile(tw *tar.Writer, dir string, file File) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = tw.WriteHeader(&tar.Header{
+		Name: file.Path,
+		Mode: 0644,
+		Size: file.Size,
+	}); err != nil {
+		return err
+	}
+	// 备份的是快照，文件不会再变化，按清单中的大小写入
+	_, err = io.CopyN(tw, f, file.Size)
+	return err
+}
+
+// Extract 将备份包解压到目录dir，并校验每个文件的大小和sha256以及文件是否完整
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrNoManifest
+		}
+		return nil, err
+	}
+	if hdr.Name != ManifestName {
+		return nil, ErrNoManifest
+	}
+	manifest := &Manifest{}
+	if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("unsupported backup manifest version %d", manifest.Version)
+	}
+
+	files := make(map[string]File, len(manifest.Files))
+	for _, file := range manifest.Files {
+		files[file.Path] = file
+	}
+	extracted := make(map[string]struct{}, len(manifest.Files))
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected backup entry %s", hdr.Name)
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid backup entry %s", hdr.Name)
+		}
+		file, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("backup entry %s not in manifest", hdr.Name)
+		}
+		if _, ok = extracted[name]; ok {
+			return nil, fmt.Errorf("duplicate backup entry %s", hdr.Name)
+		}
+		if err = extractFile(tr, filepath.Join(dir, filepath.FromSlash(name)), file); err != nil {
+			return nil, err
+		}
+		extracted[name] = struct{}{}
+	}
+	for _, file := range manifest.Files {
+		if _, ok := extracted[file.Path]; !ok {
+			return nil, fmt.Errorf("backup file %s is missing", file.Path)
+		}
+	}
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, p string, file File) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return err
+	}
+	if size != file.Size || hex.EncodeToString(h.Sum(nil)) != file.Sha256 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.Path)
+	}
+	return f.Sync()
+}
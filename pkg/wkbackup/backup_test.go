@@ -0,0 +1,72 @@
+package wkbackup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkbackup"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAndExtract(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "db", "wukongimdb", "shard000"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "db", "wukongimdb", "shard000", "000001.sst"), []byte("sst"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "conversation"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "conversation", "conversation.json"), []byte("{}"), 0644))
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, wkbackup.Write(buf, src, wkbackup.Manifest{NodeId: 1001, DbShardNum: 1}))
+
+	dst := t.TempDir()
+	manifest, err := wkbackup.Extract(bytes.NewReader(buf.Bytes()), dst)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1001), manifest.NodeId)
+	assert.Equal(t, wkbackup.ManifestVersion, manifest.Version)
+	assert.Len(t, manifest.Files, 2)
+
+	data, err := os.ReadFile(filepath.Join(dst, "db", "wukongimdb", "shard000", "000001.sst"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("sst"), data)
+}
+
+// writeTar 使用自定义的清单和文件生成备份包
+func writeTar(t *testing.T, manifest wkbackup.Manifest, files map[string][]byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	manifestData, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: wkbackup.ManifestName, Mode: 0644, Size: int64(len(manifestData))}))
+	_, err = tw.Write(manifestData)
+	assert.NoError(t, err)
+	for name, data := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+		_, err = tw.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestExtractVerify(t *testing.T) {
+	// 与文件内容不一致的sha256
+	sum := "8d8bbd6ef2ecd2c5f3fa0e7e0c2d2f0bf8e6bba3f06f1f7a5cd9d5bd27a6fbc1"
+	manifest := wkbackup.Manifest{Files: []wkbackup.File{{Path: "a.sst", Size: 3, Sha256: sum}}}
+
+	_, err := wkbackup.Extract(bytes.NewReader(writeTar(t, manifest, map[string][]byte{"a.sst": []byte("sst")})), t.TempDir())
+	assert.True(t, errors.Is(err, wkbackup.ErrChecksumMismatch))
+
+	_, err = wkbackup.Extract(bytes.NewReader(writeTar(t, manifest, nil)), t.TempDir())
+	assert.Error(t, err)
+
+	_, err = wkbackup.Extract(bytes.NewReader(writeTar(t, wkbackup.Manifest{}, map[string][]byte{"../a.sst": []byte("sst")})), t.TempDir())
+	assert.Error(t, err)
+}
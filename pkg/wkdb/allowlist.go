@@ -45,7 +45,11 @@ func (wk *wukongDB) AddAllowlist(channelId string, channelType uint8, uids []str
 }
 
 func (wk *wukongDB) GetAllowlist(channelId string, channelType uint8) ([]string, error) {
-	iter := wk.channelDb(channelId, channelType).NewIter(&pebble.IterOptions{
+	return wk.getAllowlist(wk.channelDb(channelId, channelType), channelId, channelType)
+}
+
+func (wk *wukongDB) getAllowlist(r pebble.Reader, channelId string, channelType uint8) ([]string, error) {
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewAllowlistPrimaryKey(channelId, channelType, 0),
 		UpperBound: key.NewAllowlistPrimaryKey(channelId, channelType, math.MaxUint64),
 	})
@@ -0,0 +1,63 @@
+package wkdb
+
+import (
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+func (wk *wukongDB) AddOrUpdateAPIKey(apiKey APIKey) error {
+	data, err := apiKey.Marshal()
+	if err != nil {
+		return err
+	}
+	return wk.shardDB(apiKey.KeyId).Set(key.NewAPIKeyKey(apiKey.KeyId), data, wk.sync)
+}
+
+func (wk *wukongDB) GetAPIKey(keyId string) (APIKey, error) {
+	result, closer, err := wk.shardDB(keyId).Get(key.NewAPIKeyKey(keyId))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return APIKey{}, ErrNotFound
+		}
+		return APIKey{}, err
+	}
+	defer closer.Close()
+
+	var apiKey APIKey
+	if err = apiKey.Unmarshal(result); err != nil {
+		return APIKey{}, err
+	}
+	if apiKey.KeyId != keyId { // keyId的hash冲突
+		return APIKey{}, ErrNotFound
+	}
+	return apiKey, nil
+}
+
+func (wk *wukongDB) GetAPIKeys() ([]APIKey, error) {
+	apiKeys := make([]APIKey, 0)
+	for _, db := range wk.dbs {
+		results, err := wk.getAPIKeys(db)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, results...)
+	}
+	return apiKeys, nil
+}
+
+func (wk *wukongDB) getAPIKeys(r pebble.Reader) ([]APIKey, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewAPIKeyLowKey(),
+		UpperBound: key.NewAPIKeyHighKey(),
+	})
+	defer iter.Close()
+	apiKeys := make([]APIKey, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		var apiKey APIKey
+		if err := apiKey.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, nil
+}
@@ -0,0 +1,55 @@
+package wkdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(2)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	now := time.Now().Unix()
+	apiKey := wkdb.APIKey{
+		KeyId:       "k1",
+		SecretHash:  "hash1",
+		Name:        "backend",
+		Permissions: "message:rw,channelInfo:r",
+		CreatedAt:   now,
+		AppId:       "app1",
+	}
+	err = d.AddOrUpdateAPIKey(apiKey)
+	assert.NoError(t, err)
+	err = d.AddOrUpdateAPIKey(wkdb.APIKey{KeyId: "k2", SecretHash: "hash2", CreatedAt: now})
+	assert.NoError(t, err)
+
+	result, err := d.GetAPIKey("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, apiKey, result)
+	assert.True(t, result.Valid(now))
+
+	// 吊销
+	apiKey.RevokedAt = now
+	err = d.AddOrUpdateAPIKey(apiKey)
+	assert.NoError(t, err)
+	result, err = d.GetAPIKey("k1")
+	assert.NoError(t, err)
+	assert.False(t, result.Valid(now))
+
+	_, err = d.GetAPIKey("k3")
+	assert.Equal(t, wkdb.ErrNotFound, err)
+
+	apiKeys, err := d.GetAPIKeys()
+	assert.NoError(t, err)
+	assert.Len(t, apiKeys, 2)
+}
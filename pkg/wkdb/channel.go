@@ -40,8 +40,12 @@ func (wk *wukongDB) AddOrUpdateChannel(channelInfo ChannelInfo) (uint64, error)
 }
 
 func (wk *wukongDB) GetChannel(channelId string, channelType uint8) (ChannelInfo, error) {
+	return wk.getChannel(wk.channelDb(channelId, channelType), channelId, channelType)
+}
 
-	id, err := wk.getChannelPrimaryKey(channelId, channelType)
+func (wk *wukongDB) getChannel(r pebble.Reader, channelId string, channelType uint8) (ChannelInfo, error) {
+
+	id, err := wk.getChannelPrimaryKeyWith(r, channelId, channelType)
 	if err != nil {
 		return EmptyChannelInfo, err
 	}
@@ -49,7 +53,7 @@ func (wk *wukongDB) GetChannel(channelId string, channelType uint8) (ChannelInfo
 		return EmptyChannelInfo, nil
 	}
 
-	iter := wk.channelDb(channelId, channelType).NewIter(&pebble.IterOptions{
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewChannelInfoColumnKey(id, key.MinColumnKey),
 		UpperBound: key.NewChannelInfoColumnKey(id, key.MaxColumnKey),
 	})
@@ -304,10 +308,13 @@ func (wk *wukongDB) DeleteChannel(channelId string, channelType uint8) error {
 }
 
 func (wk *wukongDB) UpdateChannelAppliedIndex(channelId string, channelType uint8, index uint64) error {
+	return wk.setChannelAppliedIndex(channelId, channelType, index, wk.channelDb(channelId, channelType), wk.sync)
+}
 
+func (wk *wukongDB) setChannelAppliedIndex(channelId string, channelType uint8, index uint64, w pebble.Writer, o *pebble.WriteOptions) error {
 	indexBytes := make([]byte, 8)
 	wk.endian.PutUint64(indexBytes, index)
-	return wk.channelDb(channelId, channelType).Set(key.NewChannelCommonColumnKey(channelId, channelType, key.TableChannelCommon.Column.AppliedIndex), indexBytes, wk.sync)
+	return w.Set(key.NewChannelCommonColumnKey(channelId, channelType, key.TableChannelCommon.Column.AppliedIndex), indexBytes, o)
 }
 
 func (wk *wukongDB) GetChannelAppliedIndex(channelId string, channelType uint8) (uint64, error) {
@@ -402,6 +409,39 @@ func (wk *wukongDB) writeChannelInfo(primaryKey uint64, channelInfo ChannelInfo,
 		return err
 	}
 
+	// sendRateLimit
+	sendRateLimitBytes := make([]byte, 4)
+	wk.endian.PutUint32(sendRateLimitBytes, uint32(channelInfo.SendRateLimit))
+	if err = w.Set(key.NewChannelInfoColumnKey(primaryKey, key.TableChannelInfo.Column.SendRateLimit), sendRateLimitBytes, wk.noSync); err != nil {
+		return err
+	}
+
+	// sendRateBurst
+	sendRateBurstBytes := make([]byte, 4)
+	wk.endian.PutUint32(sendRateBurstBytes, uint32(channelInfo.SendRateBurst))
+	if err = w.Set(key.NewChannelInfoColumnKey(primaryKey, key.TableChannelInfo.Column.SendRateBurst), sendRateBurstBytes, wk.noSync); err != nil {
+		return err
+	}
+
+	// replicaCount
+	replicaCountBytes := make([]byte, 2)
+	wk.endian.PutUint16(replicaCountBytes, uint16(channelInfo.ReplicaCount))
+	if err = w.Set(key.NewChannelInfoColumnKey(primaryKey, key.TableChannelInfo.Column.ReplicaCount), replicaCountBytes, wk.noSync); err != nil {
+		return err
+	}
+
+	// ackMode
+	if err = w.Set(key.NewChannelInfoColumnKey(primaryKey, key.TableChannelInfo.Column.AckMode), []byte{uint8(channelInfo.AckMode)}, wk.noSync); err != nil {
+		return err
+	}
+
+	// preferredLeader
+	preferredLeaderBytes := make([]byte, 8)
+	wk.endian.PutUint64(preferredLeaderBytes, channelInfo.PreferredLeader)
+	if err = w.Set(key.NewChannelInfoColumnKey(primaryKey, key.TableChannelInfo.Column.PreferredLeader), preferredLeaderBytes, wk.noSync); err != nil {
+		return err
+	}
+
 	// channel index
 	idBytes := make([]byte, 8)
 	wk.endian.PutUint64(idBytes, primaryKey)
@@ -419,7 +459,8 @@ func (wk *wukongDB) writeChannelInfo(primaryKey uint64, channelInfo ChannelInfo,
 		return err
 	}
 
-	return nil
+	// slot index
+	return wk.writeSlotIndexOfChannel(channelInfo.ChannelId, channelInfo.ChannelType, w)
 }
 
 func (wk *wukongDB) iterChannelInfo(iter *pebble.Iterator, iterFnc func(channelInfo ChannelInfo) bool) error {
@@ -464,6 +505,16 @@ func (wk *wukongDB) iterChannelInfo(iter *pebble.Iterator, iterFnc func(channelI
 			preChannelInfo.AllowlistCount = int(wk.endian.Uint32(iter.Value()))
 		case key.TableChannelInfo.Column.DenylistCount:
 			preChannelInfo.DenylistCount = int(wk.endian.Uint32(iter.Value()))
+		case key.TableChannelInfo.Column.SendRateLimit:
+			preChannelInfo.SendRateLimit = int(wk.endian.Uint32(iter.Value()))
+		case key.TableChannelInfo.Column.SendRateBurst:
+			preChannelInfo.SendRateBurst = int(wk.endian.Uint32(iter.Value()))
+		case key.TableChannelInfo.Column.ReplicaCount:
+			preChannelInfo.ReplicaCount = int(wk.endian.Uint16(iter.Value()))
+		case key.TableChannelInfo.Column.AckMode:
+			preChannelInfo.AckMode = ChannelAckMode(iter.Value()[0])
+		case key.TableChannelInfo.Column.PreferredLeader:
+			preChannelInfo.PreferredLeader = wk.endian.Uint64(iter.Value())
 
 		}
 		hasData = true
@@ -523,8 +574,12 @@ func (wk *wukongDB) iterChannelInfo(iter *pebble.Iterator, iterFnc func(channelI
 // }
 
 func (wk *wukongDB) getChannelPrimaryKey(channelId string, channelType uint8) (uint64, error) {
+	return wk.getChannelPrimaryKeyWith(wk.channelDb(channelId, channelType), channelId, channelType)
+}
+
+func (wk *wukongDB) getChannelPrimaryKeyWith(r pebble.Reader, channelId string, channelType uint8) (uint64, error) {
 	primaryKey := key.NewChannelInfoIndexKey(channelId, channelType)
-	indexValue, closer, err := wk.channelDb(channelId, channelType).Get(primaryKey)
+	indexValue, closer, err := r.Get(primaryKey)
 	if err != nil {
 		if err == pebble.ErrNotFound {
 			return 0, nil
@@ -233,7 +233,11 @@ func (wk *wukongDB) GetChannelClusterConfigCountWithSlotId(slotId uint32) (int,
 }
 
 func (wk *wukongDB) GetChannelClusterConfigWithSlotId(slotId uint32) ([]ChannelClusterConfig, error) {
-	iter := wk.defaultShardDB().NewIter(&pebble.IterOptions{
+	return wk.getChannelClusterConfigWithSlotId(wk.defaultShardDB(), slotId)
+}
+
+func (wk *wukongDB) getChannelClusterConfigWithSlotId(r pebble.Reader, slotId uint32) ([]ChannelClusterConfig, error) {
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewChannelClusterConfigColumnKey(0, key.MinColumnKey),
 		UpperBound: key.NewChannelClusterConfigColumnKey(math.MaxUint64, key.MaxColumnKey),
 	})
@@ -368,6 +372,18 @@ func (wk *wukongDB) writeChannelClusterConfig(primaryKey uint64, channelClusterC
 		return err
 	}
 
+	// ackMode
+	if err := w.Set(key.NewChannelClusterConfigColumnKey(primaryKey, key.TableChannelClusterConfig.Column.AckMode), []byte{uint8(channelClusterConfig.AckMode)}, wk.noSync); err != nil {
+		return err
+	}
+
+	// preferredLeader
+	preferredLeaderBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(preferredLeaderBytes, channelClusterConfig.PreferredLeader)
+	if err := w.Set(key.NewChannelClusterConfigColumnKey(primaryKey, key.TableChannelClusterConfig.Column.PreferredLeader), preferredLeaderBytes, wk.noSync); err != nil {
+		return err
+	}
+
 	//version
 	versionBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(versionBytes, channelClusterConfig.version)
@@ -451,6 +467,10 @@ func (wk *wukongDB) iteratorChannelClusterConfig(iter *pebble.Iterator, iterFnc
 			preChannelClusterConfig.ConfVersion = wk.endian.Uint64(iter.Value())
 		case key.TableChannelClusterConfig.Column.Version:
 			preChannelClusterConfig.version = wk.endian.Uint16(iter.Value())
+		case key.TableChannelClusterConfig.Column.AckMode:
+			preChannelClusterConfig.AckMode = ChannelAckMode(iter.Value()[0])
+		case key.TableChannelClusterConfig.Column.PreferredLeader:
+			preChannelClusterConfig.PreferredLeader = wk.endian.Uint64(iter.Value())
 		}
 		hasData = true
 	}
@@ -54,6 +54,8 @@ func TestGetChannelClusterConfig(t *testing.T) {
 		Replicas:        []uint64{1, 2, 3},
 		LeaderId:        1001,
 		Term:            1,
+		AckMode:         wkdb.ChannelAckModeNone,
+		PreferredLeader: 2,
 	}
 
 	err = d.SaveChannelClusterConfig(config)
@@ -68,6 +70,8 @@ func TestGetChannelClusterConfig(t *testing.T) {
 	assert.Equal(t, config.LeaderId, config2.LeaderId)
 	assert.Equal(t, config.Term, config2.Term)
 	assert.Equal(t, config.Replicas, config2.Replicas)
+	assert.Equal(t, config.AckMode, config2.AckMode)
+	assert.Equal(t, config.PreferredLeader, config2.PreferredLeader)
 
 }
 
@@ -132,11 +132,16 @@ func TestGetChannel(t *testing.T) {
 	}()
 
 	channelInfo := wkdb.ChannelInfo{
-		ChannelId:   "channel1",
-		ChannelType: 1,
-		Ban:         true,
-		Large:       true,
-		Disband:     true,
+		ChannelId:       "channel1",
+		ChannelType:     1,
+		Ban:             true,
+		Large:           true,
+		Disband:         true,
+		SendRateLimit:   10,
+		SendRateBurst:   20,
+		ReplicaCount:    5,
+		AckMode:         wkdb.ChannelAckModeAll,
+		PreferredLeader: 1002,
 	}
 	_, err = d.AddOrUpdateChannel(channelInfo)
 	assert.NoError(t, err)
@@ -149,6 +154,11 @@ func TestGetChannel(t *testing.T) {
 	assert.Equal(t, channelInfo.Ban, channelInfo2.Ban)
 	assert.Equal(t, channelInfo.Large, channelInfo2.Large)
 	assert.Equal(t, channelInfo.Disband, channelInfo2.Disband)
+	assert.Equal(t, channelInfo.SendRateLimit, channelInfo2.SendRateLimit)
+	assert.Equal(t, channelInfo.SendRateBurst, channelInfo2.SendRateBurst)
+	assert.Equal(t, channelInfo.ReplicaCount, channelInfo2.ReplicaCount)
+	assert.Equal(t, channelInfo.AckMode, channelInfo2.AckMode)
+	assert.Equal(t, channelInfo.PreferredLeader, channelInfo2.PreferredLeader)
 }
 
 func TestExistChannel(t *testing.T) {
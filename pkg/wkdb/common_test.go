@@ -6,6 +6,6 @@ import (
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 )
 
-func newTestDB(t testing.TB) wkdb.DB {
-	return wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir()), wkdb.WithShardNum(1)))
+func newTestDB(t testing.TB, opts ...wkdb.Option) wkdb.DB {
+	return wkdb.NewWukongDB(wkdb.NewOptions(append([]wkdb.Option{wkdb.WithDir(t.TempDir()), wkdb.WithShardNum(1)}, opts...)...))
 }
@@ -24,6 +24,10 @@ func (wk *wukongDB) AddOrUpdateConversations(uid string, conversations []Convers
 	batch := wk.shardDB(uid).NewBatch()
 	defer batch.Close()
 
+	if err := wk.writeSlotIndexOfUid(uid, batch); err != nil {
+		return err
+	}
+
 	var createCount int
 
 	for _, cn := range conversations {
@@ -53,9 +57,11 @@ func (wk *wukongDB) AddOrUpdateConversations(uid string, conversations []Convers
 
 // GetConversations 获取指定用户的最近会话
 func (wk *wukongDB) GetConversations(uid string) ([]Conversation, error) {
+	return wk.getConversations(wk.shardDB(uid), uid)
+}
 
-	db := wk.shardDB(uid)
-	iter := db.NewIter(&pebble.IterOptions{
+func (wk *wukongDB) getConversations(r pebble.Reader, uid string) ([]Conversation, error) {
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewConversationPrimaryKey(uid, 0),
 		UpperBound: key.NewConversationPrimaryKey(uid, math.MaxUint64),
 	})
@@ -1,8 +1,14 @@
 package wkdb
 
+import "time"
+
 type DB interface {
 	Open() error
 	Close() error
+	// Checkpoint 依次将每个分区的快照写入目录dir，单个分区的快照是一致的，分区之间不是同一时刻的快照
+	Checkpoint(dir string) error
+	// NewSnapshot 创建数据库的只读快照
+	NewSnapshot() *Snapshot
 	// 获取下一个主键
 	NextPrimaryKey() uint64
 	// 消息
@@ -23,6 +29,21 @@ type DB interface {
 	// SessionDB
 	// 数据统计
 	TotalDB
+	// webhook事件
+	WebhookDB
+	// 消息流
+	StreamDB
+	// 消息回执
+	ReceiptDB
+	// 设备token拒绝名单
+	TokenDenyDB
+	// http api密钥
+	APIKeyDB
+
+	// 租户
+	TenantUsageDB
+	// 数据导出
+	ExportDB
 }
 
 type MessageDB interface {
@@ -34,6 +55,8 @@ type MessageDB interface {
 	AppendMessages(channelId string, channelType uint8, msgs []Message) error
 	// AppendMessagesBatch 批量添加消息
 	AppendMessagesBatch(reqs []AppendMessagesReq) error
+	// ApplyMessages 应用已提交的消息[startMessageSeq,endMessageSeq)的派生数据（撤回/编辑等）并记录已应用的下标
+	ApplyMessages(channelId string, channelType uint8, startMessageSeq, endMessageSeq uint64) error
 	// LoadPrevRangeMsgs 向上加载指定范围的消息 end=0表示不做限制 比如 start=100 end=0 limit=10 则返回的消息seq为91-100的消息, 比如 start=100 end=95 limit=10 则返回的消息seq为96-100的消息
 	// 结果包含start,不包含end
 	LoadPrevRangeMsgs(channelId string, channelType uint8, startMessageSeq, endMessageSeq uint64, limit int) ([]Message, error)
@@ -74,9 +97,23 @@ type MessageDB interface {
 	AppendMessagesOfUserQueue(uid string, messages []Message) error
 	// UpdateMessageOfUserQueueCursorIfNeed 更新用户队列的游标
 	UpdateMessageOfUserQueueCursorIfNeed(uid string, messageSeq uint64) error
+	// LoadMessagesOfUserQueue 获取用户队列里序号大于等于startMessageSeq的消息
+	LoadMessagesOfUserQueue(uid string, startMessageSeq uint64, limit int) ([]Message, error)
+	// GetMessageOfUserQueueCursor 获取用户队列的游标
+	GetMessageOfUserQueueCursor(uid string) (uint64, error)
+	// GetMessageOfUserQueueLastSeq 获取用户队列的最大序号
+	GetMessageOfUserQueueLastSeq(uid string) (uint64, error)
+	// RestoreMessagesOfUserQueue 用快照里的数据重置用户队列
+	RestoreMessagesOfUserQueue(uid string, cursor uint64, lastSeq uint64, messages []Message) error
 
 	// 搜索消息
 	SearchMessages(req MessageSearchReq) ([]Message, error)
+
+	// PurgeExpiredMessages 抹掉now之前已过期的消息的内容（保留消息在频道日志里的位置），返回清理的数量
+	PurgeExpiredMessages(now time.Time) (int, error)
+
+	// RebuildMessageSearchIndex 重建所有消息的全文检索倒排索引，返回建立索引的消息数量
+	RebuildMessageSearchIndex() (int, error)
 }
 
 type DeviceDB interface {
@@ -91,6 +128,9 @@ type DeviceDB interface {
 
 	// AddOrUpdateDevice 添加或更新设备
 	AddOrUpdateDevice(device Device) error
+
+	// ClearDevicePushToken 设备的推送token还是pushToken时清除推送服务商和推送token，只更新这两列
+	ClearDevicePushToken(uid string, deviceFlag uint64, pushToken string) error
 }
 
 type UserDB interface {
@@ -108,6 +148,18 @@ type UserDB interface {
 
 	// AddOrUpdateUser 添加或更新用户
 	AddOrUpdateUser(u User) error
+
+	// UpdateUserLastSeen 只更新用户的最后在线时间，用户不存在返回ErrNotFound
+	UpdateUserLastSeen(uid string, lastSeen int64) error
+
+	// UpdateUsersLastSeen 批量更新用户的最后在线时间，用户不存在时用User.Id创建用户
+	UpdateUsersLastSeen(users []User) error
+
+	// UpdateUserPushMute 只更新用户的离线推送免打扰，用户不存在返回ErrNotFound
+	UpdateUserPushMute(uid string, pushMute bool) error
+
+	// UpdateUserPresenceHidden 只更新用户是否隐藏在线状态，用户不存在返回ErrNotFound
+	UpdateUserPresenceHidden(uid string, hidden bool) error
 }
 
 type ChannelDB interface {
@@ -231,6 +283,9 @@ type ChannelClusterConfigDB interface {
 	// GetChannelClusterConfigWithSlotId 获取某个槽的频道的分布式配置
 	GetChannelClusterConfigWithSlotId(slotId uint32) ([]ChannelClusterConfig, error)
 
+	// ClearSlot 删除槽内的所有数据
+	ClearSlot(slotId uint32) error
+
 	// GetChannelClusterConfigVersion 获取频道的分布式配置版本
 	GetChannelClusterConfigVersion(channelId string, channelType uint8) (uint64, error)
 
@@ -336,6 +391,11 @@ type MessageSearchReq struct {
 	OffsetMessageSeq uint64 // 偏移的消息seq(如果按频道查询，则分页需要传入这个值)
 	Pre              bool   // 是否向前搜索
 
+	Keywords  []string // 关键词（开启倒排索引并指定频道时走索引查询）
+	KeywordOr bool     // 关键词之间是否为或的关系，默认为且
+	StartTime int64    // 消息时间下限（单位秒，包含）
+	EndTime   int64    // 消息时间上限（单位秒，包含）
+
 	ClientMsgNo string // 客户端消息编号
 }
 
@@ -389,3 +449,84 @@ type ChannelClusterConfigSearchReq struct {
 	SlotLeaderId uint64 // 槽领导者id
 
 }
+
+type WebhookDB interface {
+	// AppendWebhookEvents 添加webhook事件到待发送队列
+	AppendWebhookEvents(events []WebhookEvent) error
+	// GetWebhookEvents 获取下次发送时间小于等于maxNextRetryAt的webhook事件，limit为0表示不限制
+	GetWebhookEvents(maxNextRetryAt uint64, limit int) ([]WebhookEvent, error)
+	// RemoveWebhookEvents 从待发送队列里移除webhook事件
+	RemoveWebhookEvents(events []WebhookEvent) error
+	// RescheduleWebhookEvents 修改webhook事件的下次发送时间
+	RescheduleWebhookEvents(events []WebhookEvent, nextRetryAt uint64) error
+	// MoveWebhookEventsToDeadLetter 将webhook事件移入死信表
+	MoveWebhookEventsToDeadLetter(events []WebhookEvent) error
+	// GetWebhookDeadLetters 获取id大于startId的死信事件，limit为0表示不限制
+	GetWebhookDeadLetters(startId uint64, limit int) ([]WebhookEvent, error)
+	// ReplayWebhookDeadLetters 将死信事件重新放回待发送队列，ids为空则分批重放所有死信
+	ReplayWebhookDeadLetters(ids []uint64, nextRetryAt uint64) (int, error)
+	// RemoveWebhookDeadLetters 删除死信事件
+	RemoveWebhookDeadLetters(ids []uint64) error
+}
+
+type StreamDB interface {
+	// GetStreamMeta 获取消息流元数据
+	GetStreamMeta(channelId string, channelType uint8, streamNo string) (StreamMeta, error)
+	// LastStreamSeq 流最后一个片段的序号，包含已追加还没应用的日志里的片段
+	LastStreamSeq(channelId string, channelType uint8, streamNo string) (uint32, error)
+	// GetStreamItems 获取消息流的所有片段，按streamSeq排序
+	GetStreamItems(channelId string, channelType uint8, streamNo string) ([]StreamItem, error)
+}
+
+type ReceiptDB interface {
+	// UpdateReadCursors 更新频道成员的已读位置，已读位置只增不减
+	UpdateReadCursors(channelId string, channelType uint8, cursors []ReadCursor) error
+	// GetReadCursors 获取频道所有成员的已读位置
+	GetReadCursors(channelId string, channelType uint8) ([]ReadCursor, error)
+}
+
+type TokenDenyDB interface {
+	// AddTokenDenies 添加设备token拒绝名单，同时清理这些用户已过期的记录
+	AddTokenDenies(denies []TokenDeny) error
+	// RemoveTokenDeny 移除设备token拒绝名单
+	RemoveTokenDeny(uid string, jti string) error
+	// GetTokenDenies 获取用户未过期的拒绝名单
+	GetTokenDenies(uid string) ([]TokenDeny, error)
+	// GetAllTokenDenies 获取所有未过期的拒绝名单
+	GetAllTokenDenies() ([]TokenDeny, error)
+	// PurgeExpiredTokenDenies 删除now之前已过期的拒绝名单，返回删除的数量
+	PurgeExpiredTokenDenies(now time.Time) (int, error)
+}
+
+type APIKeyDB interface {
+	// AddOrUpdateAPIKey 添加或更新api密钥
+	AddOrUpdateAPIKey(apiKey APIKey) error
+	// GetAPIKey 获取api密钥，不存在返回ErrNotFound
+	GetAPIKey(keyId string) (APIKey, error)
+	// GetAPIKeys 获取所有api密钥
+	GetAPIKeys() ([]APIKey, error)
+}
+
+type TenantUsageDB interface {
+	// IncTenantStorage 增加租户已存储的消息字节数（delta可以为负数）
+	IncTenantStorage(appId string, delta int64) error
+	// SetTenantUsage 设置租户的资源使用量
+	SetTenantUsage(usage TenantUsage) error
+	// GetTenantUsage 获取租户的资源使用量，不存在返回空的使用量
+	GetTenantUsage(appId string) (TenantUsage, error)
+	// GetTenantUsages 获取所有租户的资源使用量
+	GetTenantUsages() ([]TenantUsage, error)
+}
+
+type ExportDB interface {
+	// ForEachUser 遍历所有用户，fnc返回错误时停止遍历并返回这个错误
+	ForEachUser(fnc func(u User) error) error
+	// ForEachDevice 遍历所有设备
+	ForEachDevice(fnc func(d Device) error) error
+	// ForEachChannel 遍历所有频道信息
+	ForEachChannel(fnc func(channelInfo ChannelInfo) error) error
+	// ForEachConversation 遍历所有最近会话
+	ForEachConversation(fnc func(conversation Conversation) error) error
+	// ForEachMessageChannel 遍历所有存有消息的频道
+	ForEachMessageChannel(fnc func(channelId string, channelType uint8) error) error
+}
@@ -44,7 +44,11 @@ func (wk *wukongDB) AddDenylist(channelId string, channelType uint8, uids []stri
 }
 
 func (wk *wukongDB) GetDenylist(channelId string, channelType uint8) ([]string, error) {
-	iter := wk.channelDb(channelId, channelType).NewIter(&pebble.IterOptions{
+	return wk.getDenylist(wk.channelDb(channelId, channelType), channelId, channelType)
+}
+
+func (wk *wukongDB) getDenylist(r pebble.Reader, channelId string, channelType uint8) ([]string, error) {
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewDenylistPrimaryKey(channelId, channelType, 0),
 		UpperBound: key.NewDenylistPrimaryKey(channelId, channelType, math.MaxUint64),
 	})
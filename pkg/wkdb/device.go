@@ -63,21 +63,32 @@ func (wk *wukongDB) GetDevice(uid string, deviceFlag uint64) (Device, error) {
 }
 
 func (wk *wukongDB) GetDevices(uid string) ([]Device, error) {
+	return wk.getDevices(wk.shardDB(uid), uid)
+}
 
-	db := wk.shardDB(uid)
-	iter := db.NewIter(&pebble.IterOptions{
+func (wk *wukongDB) getDevices(r pebble.Reader, uid string) ([]Device, error) {
+	// 索引的值是设备id，再按id读取设备的列
+	indexIter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewDeviceIndexUidAndDeviceFlagKey(uid, 0),
 		UpperBound: key.NewDeviceIndexUidAndDeviceFlagKey(uid, math.MaxUint64),
 	})
-	defer iter.Close()
+	defer indexIter.Close()
 
 	var devices []Device
-	err := wk.iterDevice(iter, func(d Device) bool {
-		devices = append(devices, d)
-		return true
-	})
-	if err != nil {
-		return nil, err
+	for indexIter.First(); indexIter.Valid(); indexIter.Next() {
+		id := wk.endian.Uint64(indexIter.Value())
+		iter := r.NewIter(&pebble.IterOptions{
+			LowerBound: key.NewDeviceColumnKey(id, key.MinColumnKey),
+			UpperBound: key.NewDeviceColumnKey(id, key.MaxColumnKey),
+		})
+		err := wk.iterDevice(iter, func(d Device) bool {
+			devices = append(devices, d)
+			return true
+		})
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
 	return devices, nil
 }
@@ -134,6 +145,38 @@ func (wk *wukongDB) AddOrUpdateDevice(d Device) error {
 	return nil
 }
 
+func (wk *wukongDB) ClearDevicePushToken(uid string, deviceFlag uint64, pushToken string) error {
+	id, err := wk.getDeviceId(uid, deviceFlag)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return nil
+	}
+	db := wk.shardDB(uid)
+	current, closer, err := db.Get(key.NewDeviceColumnKey(id, key.TableDevice.Column.PushToken))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	same := string(current) == pushToken
+	closer.Close()
+	if !same { // 设备已经上报了新的推送token
+		return nil
+	}
+	batch := db.NewBatch()
+	defer batch.Close()
+	if err = batch.Set(key.NewDeviceColumnKey(id, key.TableDevice.Column.PushProvider), nil, wk.noSync); err != nil {
+		return err
+	}
+	if err = batch.Set(key.NewDeviceColumnKey(id, key.TableDevice.Column.PushToken), nil, wk.noSync); err != nil {
+		return err
+	}
+	return batch.Commit(wk.sync)
+}
+
 func (wk *wukongDB) existDevice(uid string, id uint64) (bool, error) {
 	db := wk.shardDB(uid)
 	iter := db.NewIter(&pebble.IterOptions{
@@ -295,6 +338,16 @@ func (wk *wukongDB) writeDevice(d Device, isCreate bool, w pebble.Writer) error
 		return err
 	}
 
+	// pushProvider
+	if err = w.Set(key.NewDeviceColumnKey(d.Id, key.TableDevice.Column.PushProvider), []byte(d.PushProvider), wk.noSync); err != nil {
+		return err
+	}
+
+	// pushToken
+	if err = w.Set(key.NewDeviceColumnKey(d.Id, key.TableDevice.Column.PushToken), []byte(d.PushToken), wk.noSync); err != nil {
+		return err
+	}
+
 	// updatedAt
 	var nowBytes = make([]byte, 8)
 	wk.endian.PutUint64(nowBytes, uint64(time.Now().Unix()))
@@ -317,7 +370,8 @@ func (wk *wukongDB) writeDevice(d Device, isCreate bool, w pebble.Writer) error
 		return err
 	}
 
-	return nil
+	// slot index
+	return wk.writeSlotIndexOfUid(d.Uid, w)
 }
 
 // 解析出设备信息
@@ -362,7 +416,10 @@ func (wk *wukongDB) iterDevice(iter *pebble.Iterator, iterFnc func(d Device) boo
 		case key.TableDevice.Column.CreatedAt:
 			ct := time.Unix(int64(wk.endian.Uint64(iter.Value())), 0)
 			preDevice.CreatedAt = &ct
-
+		case key.TableDevice.Column.PushProvider:
+			preDevice.PushProvider = string(iter.Value())
+		case key.TableDevice.Column.PushToken:
+			preDevice.PushToken = string(iter.Value())
 		}
 		lastNeedAppend = true
 		hasData = true
@@ -57,3 +57,64 @@ func TestGetDevice(t *testing.T) {
 	assert.Equal(t, u.DeviceFlag, u2.DeviceFlag)
 	assert.Equal(t, u.DeviceLevel, u2.DeviceLevel)
 }
+
+func TestDevicePushToken(t *testing.T) {
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir())))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	u := wkdb.Device{
+		Id:           1,
+		Uid:          "test",
+		Token:        "token",
+		DeviceFlag:   1,
+		DeviceLevel:  1,
+		PushProvider: "apns",
+		PushToken:    "pushToken",
+	}
+
+	err = d.AddOrUpdateDevice(u)
+	assert.NoError(t, err)
+
+	u2, err := d.GetDevice("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, u.PushProvider, u2.PushProvider)
+	assert.Equal(t, u.PushToken, u2.PushToken)
+
+	u.PushProvider = ""
+	u.PushToken = ""
+	err = d.AddOrUpdateDevice(u)
+	assert.NoError(t, err)
+
+	u2, err = d.GetDevice("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", u2.PushToken)
+
+	// 推送token已经更换时不清除
+	u.PushProvider = "fcm"
+	u.PushToken = "newPushToken"
+	err = d.AddOrUpdateDevice(u)
+	assert.NoError(t, err)
+	err = d.ClearDevicePushToken("test", 1, "pushToken")
+	assert.NoError(t, err)
+	u2, err = d.GetDevice("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "newPushToken", u2.PushToken)
+
+	// 只清除推送服务商和推送token
+	err = d.ClearDevicePushToken("test", 1, "newPushToken")
+	assert.NoError(t, err)
+	u2, err = d.GetDevice("test", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", u2.PushProvider)
+	assert.Equal(t, "", u2.PushToken)
+	assert.Equal(t, u.Token, u2.Token)
+
+	err = d.ClearDevicePushToken("notexist", 1, "pushToken")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,175 @@
+package wkdb
+
+import (
+	"math"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+// ForEachUser 遍历所有用户，fnc返回错误时停止遍历并返回这个错误
+func (wk *wukongDB) ForEachUser(fnc func(u User) error) error {
+	for _, db := range wk.dbs {
+		if err := wk.forEachUser(db, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) forEachUser(r pebble.Reader, fnc func(u User) error) error {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewUserColumnKey(0, key.MinColumnKey),
+		UpperBound: key.NewUserColumnKey(math.MaxUint64, key.MaxColumnKey),
+	})
+	defer iter.Close()
+	var fncErr error
+	err := wk.iteratorUser(iter, false, func(u User) bool {
+		fncErr = fnc(u)
+		return fncErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fncErr
+}
+
+// ForEachDevice 遍历所有设备，fnc返回错误时停止遍历并返回这个错误
+func (wk *wukongDB) ForEachDevice(fnc func(d Device) error) error {
+	for _, db := range wk.dbs {
+		iter := db.NewIter(&pebble.IterOptions{
+			LowerBound: key.NewDeviceColumnKey(0, key.MinColumnKey),
+			UpperBound: key.NewDeviceColumnKey(math.MaxUint64, key.MaxColumnKey),
+		})
+		var fncErr error
+		err := wk.iterDevice(iter, func(d Device) bool {
+			fncErr = fnc(d)
+			return fncErr == nil
+		})
+		iter.Close()
+		if err != nil {
+			return err
+		}
+		if fncErr != nil {
+			return fncErr
+		}
+	}
+	return nil
+}
+
+// ForEachChannel 遍历所有频道信息，fnc返回错误时停止遍历并返回这个错误
+func (wk *wukongDB) ForEachChannel(fnc func(channelInfo ChannelInfo) error) error {
+	for _, db := range wk.dbs {
+		if err := wk.forEachChannel(db, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) forEachChannel(r pebble.Reader, fnc func(channelInfo ChannelInfo) error) error {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewChannelInfoColumnKey(0, key.MinColumnKey),
+		UpperBound: key.NewChannelInfoColumnKey(math.MaxUint64, key.MaxColumnKey),
+	})
+	defer iter.Close()
+	var fncErr error
+	err := wk.iterChannelInfo(iter, func(channelInfo ChannelInfo) bool {
+		fncErr = fnc(channelInfo)
+		return fncErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fncErr
+}
+
+// ForEachConversation 遍历所有最近会话，fnc返回错误时停止遍历并返回这个错误
+func (wk *wukongDB) ForEachConversation(fnc func(conversation Conversation) error) error {
+	for _, db := range wk.dbs {
+		if err := wk.forEachConversation(db, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) forEachConversation(r pebble.Reader, fnc func(conversation Conversation) error) error {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewConversationUidHashKey(0),
+		UpperBound: key.NewConversationUidHashKey(math.MaxUint64),
+	})
+	defer iter.Close()
+	var fncErr error
+	err := wk.iterateConversation(iter, func(conversation Conversation) bool {
+		fncErr = fnc(conversation)
+		return fncErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fncErr
+}
+
+// ForEachMessageChannel 遍历所有存有消息的频道，fnc返回错误时停止遍历并返回这个错误
+// 消息按频道hash和消息序号存储，每个频道只读取第一条消息的频道id和频道类型，然后跳到下一个频道
+func (wk *wukongDB) ForEachMessageChannel(fnc func(channelId string, channelType uint8) error) error {
+	for _, db := range wk.dbs {
+		if err := wk.forEachMessageChannel(db, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) forEachMessageChannel(db *pebble.DB, fnc func(channelId string, channelType uint8) error) error {
+	var primaryKey, maxPrimaryKey [16]byte
+	for i := range maxPrimaryKey {
+		maxPrimaryKey[i] = 0xff
+	}
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageColumnKeyWithPrimary(primaryKey, key.MinColumnKey),
+		UpperBound: key.NewMessageColumnKeyWithPrimary(maxPrimaryKey, key.MaxColumnKey),
+	})
+	defer iter.Close()
+
+	for valid := iter.First(); valid; {
+		copy(primaryKey[:], iter.Key()[4:20])
+		channelHash := wk.endian.Uint64(primaryKey[:8])
+
+		channelId, err := wk.getMessageColumn(db, primaryKey, key.TableMessage.Column.ChannelId)
+		if err != nil {
+			return err
+		}
+		channelType, err := wk.getMessageColumn(db, primaryKey, key.TableMessage.Column.ChannelType)
+		if err != nil {
+			return err
+		}
+		if len(channelId) > 0 && len(channelType) > 0 {
+			if err = fnc(string(channelId), channelType[0]); err != nil {
+				return err
+			}
+		}
+		if channelHash == math.MaxUint64 {
+			break
+		}
+		var next [16]byte
+		wk.endian.PutUint64(next[:8], channelHash+1)
+		valid = iter.SeekGE(key.NewMessageColumnKeyWithPrimary(next, key.MinColumnKey))
+	}
+	return nil
+}
+
+func (wk *wukongDB) getMessageColumn(db *pebble.DB, primaryKey [16]byte, columnName [2]byte) ([]byte, error) {
+	value, closer, err := db.Get(key.NewMessageColumnKeyWithPrimary(primaryKey, columnName))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer closer.Close()
+	data := make([]byte, len(value))
+	copy(data, value)
+	return data, nil
+}
@@ -0,0 +1,85 @@
+package wkdb_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEach(t *testing.T) {
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir()), wkdb.WithShardNum(2)))
+	err := d.Open()
+	assert.NoError(t, err)
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	num := 10
+	for i := 0; i < num; i++ {
+		uid := fmt.Sprintf("user%d", i)
+		channelId := fmt.Sprintf("group%d", i)
+		assert.NoError(t, d.AddOrUpdateUser(wkdb.User{Id: uint64(i + 1), Uid: uid}))
+		assert.NoError(t, d.AddOrUpdateDevice(wkdb.Device{Id: uint64(i + 1), Uid: uid, DeviceFlag: 1}))
+		_, err = d.AddOrUpdateChannel(wkdb.ChannelInfo{ChannelId: channelId, ChannelType: 2})
+		assert.NoError(t, err)
+		assert.NoError(t, d.AddOrUpdateConversations(uid, []wkdb.Conversation{{Uid: uid, ChannelId: channelId, ChannelType: 2}}))
+		assert.NoError(t, d.AppendMessages(channelId, 2, []wkdb.Message{
+			{RecvPacket: wkproto.RecvPacket{MessageID: int64(i*2 + 1), ChannelID: channelId, ChannelType: 2, MessageSeq: 1, Payload: []byte("hello")}},
+			{RecvPacket: wkproto.RecvPacket{MessageID: int64(i*2 + 2), ChannelID: channelId, ChannelType: 2, MessageSeq: 2, Payload: []byte("hello")}},
+		}))
+	}
+
+	var uids []string
+	assert.NoError(t, d.ForEachUser(func(u wkdb.User) error {
+		uids = append(uids, u.Uid)
+		return nil
+	}))
+	assert.Len(t, uids, num)
+
+	devices := 0
+	assert.NoError(t, d.ForEachDevice(func(dv wkdb.Device) error {
+		devices++
+		return nil
+	}))
+	assert.Equal(t, num, devices)
+
+	channels := 0
+	assert.NoError(t, d.ForEachChannel(func(ch wkdb.ChannelInfo) error {
+		channels++
+		return nil
+	}))
+	assert.Equal(t, num, channels)
+
+	conversations := 0
+	assert.NoError(t, d.ForEachConversation(func(c wkdb.Conversation) error {
+		conversations++
+		return nil
+	}))
+	assert.Equal(t, num, conversations)
+
+	// 每个有消息的频道只遍历一次
+	var channelIds []string
+	assert.NoError(t, d.ForEachMessageChannel(func(channelId string, channelType uint8) error {
+		assert.Equal(t, uint8(2), channelType)
+		channelIds = append(channelIds, channelId)
+		return nil
+	}))
+	sort.Strings(channelIds)
+	assert.Len(t, channelIds, num)
+	assert.Equal(t, "group0", channelIds[0])
+
+	// 返回错误时停止遍历
+	stopErr := fmt.Errorf("stop")
+	count := 0
+	err = d.ForEachUser(func(u wkdb.User) error {
+		count++
+		return stopErr
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 1, count)
+}
@@ -207,6 +207,30 @@ func NewMessageIndexTimestampKey(timestamp uint64, primaryKey [16]byte) []byte {
 
 }
 
+// NewMessageSecondIndexExpireAtKey 消息过期索引 (按过期时间排序，值为空)
+func NewMessageSecondIndexExpireAtKey(expireAt uint64, primaryKey [16]byte) []byte {
+	key := make([]byte, TableMessage.SecondIndexSize)
+	key[0] = TableMessage.Id[0]
+	key[1] = TableMessage.Id[1]
+	key[2] = dataTypeSecondIndex
+	key[3] = 0
+	key[4] = TableMessage.SecondIndex.ExpireAt[0]
+	key[5] = TableMessage.SecondIndex.ExpireAt[1]
+	binary.BigEndian.PutUint64(key[6:], expireAt)
+	copy(key[14:], primaryKey[:])
+	return key
+}
+
+func ParseMessageSecondIndexExpireAtKey(key []byte) (expireAt uint64, primaryKey [16]byte, err error) {
+	if len(key) != TableMessage.SecondIndexSize {
+		err = fmt.Errorf("message: invalid expire index key length, keyLen: %d", len(key))
+		return
+	}
+	expireAt = binary.BigEndian.Uint64(key[6:])
+	copy(primaryKey[:], key[14:])
+	return
+}
+
 func ParseMessageSecondIndexKey(key []byte) (primaryKey [16]byte, err error) {
 	if len(key) != TableMessage.SecondIndexSize {
 		return [16]byte{}, fmt.Errorf("message: invalid index key length, keyLen: %d", len(key))
@@ -957,3 +981,422 @@ func NewTotalColumnKey(columnName [2]byte) []byte {
 	key[13] = columnName[1]
 	return key
 }
+
+// ---------------------- MessageUserQueue ----------------------
+
+// NewMessageUserQueueKey 用户队列里的消息key
+func NewMessageUserQueueKey(uid string, seq uint64) []byte {
+	key := make([]byte, TableMessageUserQueue.Size)
+	key[0] = TableMessageUserQueue.Id[0]
+	key[1] = TableMessageUserQueue.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(uid))
+	binary.BigEndian.PutUint64(key[12:], seq)
+	return key
+}
+
+// ParseMessageUserQueueKey 解析用户队列里的消息key，返回队列序号
+func ParseMessageUserQueueKey(key []byte) (seq uint64, err error) {
+	if len(key) != TableMessageUserQueue.Size {
+		err = fmt.Errorf("messageUserQueue: invalid key length, keyLen: %d", len(key))
+		return
+	}
+	seq = binary.BigEndian.Uint64(key[12:])
+	return
+}
+
+// NewMessageUserQueueColumnKey 用户队列的属性key（最大序号，游标）
+func NewMessageUserQueueColumnKey(uid string, columnName [2]byte) []byte {
+	key := make([]byte, 2+2+8+2)
+	key[0] = TableMessageUserQueue.Id[0]
+	key[1] = TableMessageUserQueue.Id[1]
+	key[2] = dataTypeOther
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(uid))
+	key[12] = columnName[0]
+	key[13] = columnName[1]
+	return key
+}
+
+// NewMessageUserQueueColumnLowKey 用户队列属性的最小key
+func NewMessageUserQueueColumnLowKey() []byte {
+	key := make([]byte, 2+2+8+2)
+	key[0] = TableMessageUserQueue.Id[0]
+	key[1] = TableMessageUserQueue.Id[1]
+	key[2] = dataTypeOther
+	return key
+}
+
+// NewMessageUserQueueColumnHighKey 用户队列属性的最大key
+func NewMessageUserQueueColumnHighKey() []byte {
+	key := make([]byte, 2+2+8+2)
+	key[0] = TableMessageUserQueue.Id[0]
+	key[1] = TableMessageUserQueue.Id[1]
+	key[2] = dataTypeOther
+	key[3] = 0xff
+	binary.BigEndian.PutUint64(key[4:], math.MaxUint64)
+	key[12] = 0xff
+	key[13] = 0xff
+	return key
+}
+
+// ParseMessageUserQueueColumnKey 解析用户队列的属性key，返回属性名
+func ParseMessageUserQueueColumnKey(key []byte) (columnName [2]byte, err error) {
+	if len(key) != 2+2+8+2 {
+		err = fmt.Errorf("messageUserQueue: invalid column key length, keyLen: %d", len(key))
+		return
+	}
+	columnName[0] = key[12]
+	columnName[1] = key[13]
+	return
+}
+
+// ---------------------- MessageSearch ----------------------
+
+// NewMessageSearchTokenKey 消息倒排索引key，按频道和词分组，组内按messageSeq排序（值为空）
+func NewMessageSearchTokenKey(channelHash uint64, token string, messageSeq uint64) []byte {
+	key := make([]byte, TableMessageSearch.Size)
+	key[0] = TableMessageSearch.Id[0]
+	key[1] = TableMessageSearch.Id[1]
+	key[2] = dataTypeIndex
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], channelHash)
+	binary.BigEndian.PutUint64(key[12:], HashWithString(token))
+	binary.BigEndian.PutUint64(key[20:], messageSeq)
+	return key
+}
+
+// ParseMessageSearchTokenKey 解析消息倒排索引key，返回messageSeq
+func ParseMessageSearchTokenKey(key []byte) (messageSeq uint64, err error) {
+	if len(key) != TableMessageSearch.Size {
+		err = fmt.Errorf("messageSearch: invalid key length, keyLen: %d", len(key))
+		return
+	}
+	messageSeq = binary.BigEndian.Uint64(key[20:])
+	return
+}
+
+// NewMessageSearchLowKey 消息倒排索引的最小key
+func NewMessageSearchLowKey() []byte {
+	key := make([]byte, 4)
+	key[0] = TableMessageSearch.Id[0]
+	key[1] = TableMessageSearch.Id[1]
+	key[2] = dataTypeIndex
+	key[3] = 0
+	return key
+}
+
+// NewMessageSearchHighKey 消息倒排索引的最大key
+func NewMessageSearchHighKey() []byte {
+	key := make([]byte, TableMessageSearch.Size)
+	key[0] = TableMessageSearch.Id[0]
+	key[1] = TableMessageSearch.Id[1]
+	key[2] = dataTypeIndex
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], math.MaxUint64)
+	binary.BigEndian.PutUint64(key[12:], math.MaxUint64)
+	binary.BigEndian.PutUint64(key[20:], math.MaxUint64)
+	return key
+}
+
+// ---------------------- WebhookOutbox ----------------------
+
+// NewWebhookOutboxKey webhook待发送事件key，按下次发送时间排序
+func NewWebhookOutboxKey(nextRetryAt uint64, eventId uint64) []byte {
+	key := make([]byte, TableWebhookOutbox.Size)
+	key[0] = TableWebhookOutbox.Id[0]
+	key[1] = TableWebhookOutbox.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], nextRetryAt)
+	binary.BigEndian.PutUint64(key[12:], eventId)
+	return key
+}
+
+// ---------------------- WebhookDeadLetter ----------------------
+
+func NewWebhookDeadLetterKey(eventId uint64) []byte {
+	key := make([]byte, TableWebhookDeadLetter.Size)
+	key[0] = TableWebhookDeadLetter.Id[0]
+	key[1] = TableWebhookDeadLetter.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], eventId)
+	return key
+}
+
+// ---------------------- StreamMeta ----------------------
+
+// NewStreamMetaKey 消息流元数据key
+func NewStreamMetaKey(channelId string, channelType uint8, streamNo string) []byte {
+	key := make([]byte, TableStreamMeta.Size)
+	key[0] = TableStreamMeta.Id[0]
+	key[1] = TableStreamMeta.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], ChannelIdToNum(channelId, channelType))
+	binary.BigEndian.PutUint64(key[12:], HashWithString(streamNo))
+	return key
+}
+
+// ---------------------- StreamItem ----------------------
+
+// NewStreamItemKey 消息流片段key，同一个流的片段按streamSeq排序
+func NewStreamItemKey(channelId string, channelType uint8, streamNo string, streamSeq uint32) []byte {
+	key := make([]byte, TableStreamItem.Size)
+	key[0] = TableStreamItem.Id[0]
+	key[1] = TableStreamItem.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], ChannelIdToNum(channelId, channelType))
+	binary.BigEndian.PutUint64(key[12:], HashWithString(streamNo))
+	binary.BigEndian.PutUint32(key[20:], streamSeq)
+	return key
+}
+
+// ---------------------- ChannelReadCursor ----------------------
+
+// NewChannelReadCursorKey 频道成员已读位置key
+func NewChannelReadCursorKey(channelId string, channelType uint8, uid string) []byte {
+	key := make([]byte, TableChannelReadCursor.Size)
+	key[0] = TableChannelReadCursor.Id[0]
+	key[1] = TableChannelReadCursor.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], ChannelIdToNum(channelId, channelType))
+	binary.BigEndian.PutUint64(key[12:], HashWithString(uid))
+	return key
+}
+
+// NewChannelReadCursorLowKey 频道已读位置的最小key
+func NewChannelReadCursorLowKey(channelId string, channelType uint8) []byte {
+	key := make([]byte, TableChannelReadCursor.Size)
+	key[0] = TableChannelReadCursor.Id[0]
+	key[1] = TableChannelReadCursor.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], ChannelIdToNum(channelId, channelType))
+	binary.BigEndian.PutUint64(key[12:], 0)
+	return key
+}
+
+// NewChannelReadCursorHighKey 频道已读位置的最大key
+func NewChannelReadCursorHighKey(channelId string, channelType uint8) []byte {
+	key := make([]byte, TableChannelReadCursor.Size)
+	key[0] = TableChannelReadCursor.Id[0]
+	key[1] = TableChannelReadCursor.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], ChannelIdToNum(channelId, channelType))
+	binary.BigEndian.PutUint64(key[12:], math.MaxUint64)
+	return key
+}
+
+// ---------------------- TokenDeny ----------------------
+
+// NewTokenDenyKey 设备token拒绝名单key
+func NewTokenDenyKey(uid string, jti string) []byte {
+	key := make([]byte, TableTokenDeny.Size)
+	key[0] = TableTokenDeny.Id[0]
+	key[1] = TableTokenDeny.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(uid))
+	binary.BigEndian.PutUint64(key[12:], HashWithString(jti))
+	return key
+}
+
+// NewTokenDenyLowKey 用户拒绝名单的最小key
+func NewTokenDenyLowKey(uid string) []byte {
+	key := make([]byte, TableTokenDeny.Size)
+	key[0] = TableTokenDeny.Id[0]
+	key[1] = TableTokenDeny.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(uid))
+	binary.BigEndian.PutUint64(key[12:], 0)
+	return key
+}
+
+// NewTokenDenyHighKey 用户拒绝名单的最大key
+func NewTokenDenyHighKey(uid string) []byte {
+	key := make([]byte, TableTokenDeny.Size)
+	key[0] = TableTokenDeny.Id[0]
+	key[1] = TableTokenDeny.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(uid))
+	binary.BigEndian.PutUint64(key[12:], math.MaxUint64)
+	return key
+}
+
+// NewTokenDenyTableLowKey 拒绝名单表的最小key
+func NewTokenDenyTableLowKey() []byte {
+	key := make([]byte, TableTokenDeny.Size)
+	key[0] = TableTokenDeny.Id[0]
+	key[1] = TableTokenDeny.Id[1]
+	key[2] = dataTypeTable
+	return key
+}
+
+// NewTokenDenyTableHighKey 拒绝名单表的最大key
+func NewTokenDenyTableHighKey() []byte {
+	key := make([]byte, TableTokenDeny.Size)
+	key[0] = TableTokenDeny.Id[0]
+	key[1] = TableTokenDeny.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0xff
+	binary.BigEndian.PutUint64(key[4:], math.MaxUint64)
+	binary.BigEndian.PutUint64(key[12:], math.MaxUint64)
+	return key
+}
+
+// ---------------------- APIKey ----------------------
+
+// NewAPIKeyKey api密钥key
+func NewAPIKeyKey(keyId string) []byte {
+	key := make([]byte, TableAPIKey.Size)
+	key[0] = TableAPIKey.Id[0]
+	key[1] = TableAPIKey.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(keyId))
+	return key
+}
+
+// NewAPIKeyLowKey api密钥表的最小key
+func NewAPIKeyLowKey() []byte {
+	key := make([]byte, TableAPIKey.Size)
+	key[0] = TableAPIKey.Id[0]
+	key[1] = TableAPIKey.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], 0)
+	return key
+}
+
+// NewAPIKeyHighKey api密钥表的最大key
+func NewAPIKeyHighKey() []byte {
+	key := make([]byte, TableAPIKey.Size)
+	key[0] = TableAPIKey.Id[0]
+	key[1] = TableAPIKey.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], math.MaxUint64)
+	return key
+}
+
+// ---------------------- TenantUsage ----------------------
+
+// NewTenantUsageKey 租户资源使用量key
+func NewTenantUsageKey(appId string) []byte {
+	key := make([]byte, TableTenantUsage.Size)
+	key[0] = TableTenantUsage.Id[0]
+	key[1] = TableTenantUsage.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], HashWithString(appId))
+	return key
+}
+
+// NewTenantUsageLowKey 租户资源使用量表的最小key
+func NewTenantUsageLowKey() []byte {
+	key := make([]byte, TableTenantUsage.Size)
+	key[0] = TableTenantUsage.Id[0]
+	key[1] = TableTenantUsage.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], 0)
+	return key
+}
+
+// NewTenantUsageHighKey 租户资源使用量表的最大key
+func NewTenantUsageHighKey() []byte {
+	key := make([]byte, TableTenantUsage.Size)
+	key[0] = TableTenantUsage.Id[0]
+	key[1] = TableTenantUsage.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint64(key[4:], math.MaxUint64)
+	return key
+}
+
+// ---------------------- SlotIndex ----------------------
+
+// NewSlotIndexUidKey 槽内的uid（值为空）
+func NewSlotIndexUidKey(slotId uint32, uid string) []byte {
+	key := make([]byte, 2+2+4+1+len(uid))
+	key[0] = TableSlotIndex.Id[0]
+	key[1] = TableSlotIndex.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint32(key[4:], slotId)
+	key[8] = TableSlotIndex.Kind.Uid
+	copy(key[9:], uid)
+	return key
+}
+
+// NewSlotIndexChannelKey 槽内的频道（值为空）
+func NewSlotIndexChannelKey(slotId uint32, channelId string, channelType uint8) []byte {
+	key := make([]byte, 2+2+4+1+1+len(channelId))
+	key[0] = TableSlotIndex.Id[0]
+	key[1] = TableSlotIndex.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint32(key[4:], slotId)
+	key[8] = TableSlotIndex.Kind.Channel
+	key[9] = channelType
+	copy(key[10:], channelId)
+	return key
+}
+
+// NewSlotIndexLowKey 槽内某一类索引的最小key
+func NewSlotIndexLowKey(slotId uint32, kind byte) []byte {
+	key := make([]byte, 2+2+4+1)
+	key[0] = TableSlotIndex.Id[0]
+	key[1] = TableSlotIndex.Id[1]
+	key[2] = dataTypeTable
+	key[3] = 0
+	binary.BigEndian.PutUint32(key[4:], slotId)
+	key[8] = kind
+	return key
+}
+
+// NewSlotIndexHighKey 槽内某一类索引的最大key（不包含）
+func NewSlotIndexHighKey(slotId uint32, kind byte) []byte {
+	return NewSlotIndexLowKey(slotId, kind+1)
+}
+
+// ParseSlotIndexKey 解析槽索引key，kind为Uid时返回uid，为Channel时返回频道
+func ParseSlotIndexKey(key []byte) (kind byte, v string, channelType uint8, err error) {
+	if len(key) < 2+2+4+1 {
+		err = fmt.Errorf("slotIndex: invalid key length, keyLen: %d", len(key))
+		return
+	}
+	kind = key[8]
+	switch kind {
+	case TableSlotIndex.Kind.Uid:
+		v = string(key[9:])
+	case TableSlotIndex.Kind.Channel:
+		if len(key) < 2+2+4+1+1 {
+			err = fmt.Errorf("slotIndex: invalid channel key length, keyLen: %d", len(key))
+			return
+		}
+		channelType = key[9]
+		v = string(key[10:])
+	default:
+		err = fmt.Errorf("slotIndex: unknown kind %d", kind)
+	}
+	return
+}
+
+// NewSlotIndexBuiltKey 标记已为已有数据建立过槽索引，只存在默认分区
+func NewSlotIndexBuiltKey() []byte {
+	key := make([]byte, 2+2)
+	key[0] = TableSlotIndex.Id[0]
+	key[1] = TableSlotIndex.Id[1]
+	key[2] = dataTypeOther
+	key[3] = 0
+	return key
+}
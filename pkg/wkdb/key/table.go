@@ -7,13 +7,21 @@ package key
 // ---------------------
 
 // 数据类型
-var (
+const (
 	dataTypeTable       byte = 0x01 // 表
 	dataTypeIndex       byte = 0x02 // 唯一索引 key结构一般是：  (tableId + dataType + indexName + columnHash) 值一般为primaryKey
 	dataTypeSecondIndex byte = 0x03 // 非唯一二级索引 key结构一般是： (tableId + dataType + uid hash + secondIndexName + columnValue + primaryKey) 值一般为空
 	dataTypeOther       byte = 0x04 // 其他
 )
 
+// 导出的数据类型，供按key结构解析数据的地方使用（例如重新分区）
+const (
+	DataTypeTable       = dataTypeTable
+	DataTypeIndex       = dataTypeIndex
+	DataTypeSecondIndex = dataTypeSecondIndex
+	DataTypeOther       = dataTypeOther
+)
+
 // ======================== Message ========================
 // ---------------------
 // | tableID  | dataType	| channel hash | messageSeq   | columnKey |
@@ -39,6 +47,15 @@ var TableMessage = struct {
 		FromUid     [2]byte
 		Payload     [2]byte
 		Term        [2]byte
+		Revoke      [2]byte
+		EditVersion [2]byte
+		EditorUid   [2]byte
+		EditedAt    [2]byte
+		OpType      [2]byte
+		OpTargetSeq [2]byte
+		StreamNo    [2]byte
+		StreamSeq   [2]byte
+		StreamFlag  [2]byte
 	}
 	Index struct {
 		MessageId [2]byte
@@ -48,6 +65,7 @@ var TableMessage = struct {
 		ClientMsgNo [2]byte
 		Timestamp   [2]byte
 		Channel     [2]byte
+		ExpireAt    [2]byte
 	}
 }{
 	Id:              [2]byte{0x01, 0x01},
@@ -68,6 +86,15 @@ var TableMessage = struct {
 		FromUid     [2]byte
 		Payload     [2]byte
 		Term        [2]byte
+		Revoke      [2]byte
+		EditVersion [2]byte
+		EditorUid   [2]byte
+		EditedAt    [2]byte
+		OpType      [2]byte
+		OpTargetSeq [2]byte
+		StreamNo    [2]byte
+		StreamSeq   [2]byte
+		StreamFlag  [2]byte
 	}{
 		Header:      [2]byte{0x01, 0x01},
 		Setting:     [2]byte{0x01, 0x02},
@@ -82,6 +109,15 @@ var TableMessage = struct {
 		FromUid:     [2]byte{0x01, 0x0B},
 		Payload:     [2]byte{0x01, 0x0C},
 		Term:        [2]byte{0x01, 0x0D},
+		Revoke:      [2]byte{0x01, 0x0E},
+		EditVersion: [2]byte{0x01, 0x0F},
+		EditorUid:   [2]byte{0x01, 0x10},
+		EditedAt:    [2]byte{0x01, 0x11},
+		OpType:      [2]byte{0x01, 0x12},
+		OpTargetSeq: [2]byte{0x01, 0x13},
+		StreamNo:    [2]byte{0x01, 0x14},
+		StreamSeq:   [2]byte{0x01, 0x15},
+		StreamFlag:  [2]byte{0x01, 0x16},
 	},
 	Index: struct {
 		MessageId [2]byte
@@ -93,11 +129,13 @@ var TableMessage = struct {
 		ClientMsgNo [2]byte
 		Timestamp   [2]byte
 		Channel     [2]byte
+		ExpireAt    [2]byte
 	}{
 		FromUid:     [2]byte{0x01, 0x01},
 		ClientMsgNo: [2]byte{0x01, 0x02},
 		Timestamp:   [2]byte{0x01, 0x03},
 		Channel:     [2]byte{0x01, 0x04},
+		ExpireAt:    [2]byte{0x01, 0x05},
 	},
 }
 
@@ -118,6 +156,9 @@ var TableUser = struct {
 		RecvMsgBytes      [2]byte // 接受消息字节数量
 		CreatedAt         [2]byte // 创建时间
 		UpdatedAt         [2]byte // 更新时间
+		PushMute          [2]byte // 离线推送免打扰
+		LastSeen          [2]byte // 最后在线时间
+		PresenceHidden    [2]byte // 隐藏在线状态
 	}
 	Index struct {
 		Uid [2]byte
@@ -137,6 +178,9 @@ var TableUser = struct {
 		RecvMsgBytes      [2]byte // 接受消息字节数量
 		CreatedAt         [2]byte
 		UpdatedAt         [2]byte
+		PushMute          [2]byte
+		LastSeen          [2]byte
+		PresenceHidden    [2]byte
 	}{
 		Uid:               [2]byte{0x02, 0x01},
 		DeviceCount:       [2]byte{0x02, 0x02},
@@ -148,6 +192,9 @@ var TableUser = struct {
 		RecvMsgBytes:      [2]byte{0x02, 0x08},
 		CreatedAt:         [2]byte{0x02, 0x09},
 		UpdatedAt:         [2]byte{0x02, 0x0A},
+		PushMute:          [2]byte{0x02, 0x0B},
+		LastSeen:          [2]byte{0x02, 0x0C},
+		PresenceHidden:    [2]byte{0x02, 0x0D},
 	},
 	Index: struct {
 		Uid [2]byte
@@ -164,12 +211,14 @@ var TableDevice = struct {
 	IndexSize       int
 	SecondIndexSize int
 	Column          struct {
-		Uid         [2]byte // 用户uid
-		Token       [2]byte // 设备Token
-		DeviceFlag  [2]byte // 设备标识
-		DeviceLevel [2]byte // 设备等级
-		CreatedAt   [2]byte // 创建时间
-		UpdatedAt   [2]byte // 更新时间
+		Uid          [2]byte // 用户uid
+		Token        [2]byte // 设备Token
+		DeviceFlag   [2]byte // 设备标识
+		DeviceLevel  [2]byte // 设备等级
+		CreatedAt    [2]byte // 创建时间
+		UpdatedAt    [2]byte // 更新时间
+		PushProvider [2]byte // 离线推送服务商
+		PushToken    [2]byte // 离线推送token
 	}
 	Index struct {
 		Device [2]byte
@@ -186,19 +235,23 @@ var TableDevice = struct {
 	IndexSize:       2 + 2 + 2 + 8 + 8, // tableId + dataType + indexName + uid hash + deviceFlag
 	SecondIndexSize: 2 + 2 + 2 + 8 + 8, // tableId + dataType + secondIndexName + columnValue + primaryKey
 	Column: struct {
-		Uid         [2]byte
-		Token       [2]byte
-		DeviceFlag  [2]byte
-		DeviceLevel [2]byte
-		CreatedAt   [2]byte
-		UpdatedAt   [2]byte
+		Uid          [2]byte
+		Token        [2]byte
+		DeviceFlag   [2]byte
+		DeviceLevel  [2]byte
+		CreatedAt    [2]byte
+		UpdatedAt    [2]byte
+		PushProvider [2]byte
+		PushToken    [2]byte
 	}{
-		Uid:         [2]byte{0x03, 0x01},
-		Token:       [2]byte{0x03, 0x02},
-		DeviceFlag:  [2]byte{0x03, 0x03},
-		DeviceLevel: [2]byte{0x03, 0x04},
-		CreatedAt:   [2]byte{0x03, 0x05},
-		UpdatedAt:   [2]byte{0x03, 0x06},
+		Uid:          [2]byte{0x03, 0x01},
+		Token:        [2]byte{0x03, 0x02},
+		DeviceFlag:   [2]byte{0x03, 0x03},
+		DeviceLevel:  [2]byte{0x03, 0x04},
+		CreatedAt:    [2]byte{0x03, 0x05},
+		UpdatedAt:    [2]byte{0x03, 0x06},
+		PushProvider: [2]byte{0x03, 0x07},
+		PushToken:    [2]byte{0x03, 0x08},
 	},
 	Index: struct {
 		Device [2]byte
@@ -284,6 +337,11 @@ var TableChannelInfo = struct {
 		SubscriberCount [2]byte // 订阅者数量
 		AllowlistCount  [2]byte // 白名单数量
 		DenylistCount   [2]byte // 黑名单数量
+		SendRateLimit   [2]byte // 每秒允许发送的消息数量
+		SendRateBurst   [2]byte // 允许突发发送的消息数量
+		ReplicaCount    [2]byte // 副本数量
+		AckMode         [2]byte // 消息确认模式
+		PreferredLeader [2]byte // 优先作为领导的节点
 	}
 	Index struct {
 		Channel [2]byte
@@ -310,6 +368,11 @@ var TableChannelInfo = struct {
 		SubscriberCount [2]byte
 		AllowlistCount  [2]byte
 		DenylistCount   [2]byte
+		SendRateLimit   [2]byte
+		SendRateBurst   [2]byte
+		ReplicaCount    [2]byte
+		AckMode         [2]byte
+		PreferredLeader [2]byte
 	}{
 		Id:              [2]byte{0x06, 0x01},
 		ChannelId:       [2]byte{0x06, 0x02},
@@ -320,6 +383,11 @@ var TableChannelInfo = struct {
 		SubscriberCount: [2]byte{0x06, 0x07},
 		AllowlistCount:  [2]byte{0x06, 0x08},
 		DenylistCount:   [2]byte{0x06, 0x09},
+		SendRateLimit:   [2]byte{0x06, 0x0A},
+		SendRateBurst:   [2]byte{0x06, 0x0B},
+		ReplicaCount:    [2]byte{0x06, 0x0C},
+		AckMode:         [2]byte{0x06, 0x0D},
+		PreferredLeader: [2]byte{0x06, 0x0E},
 	},
 	Index: struct {
 		Channel [2]byte
@@ -502,6 +570,8 @@ var TableChannelClusterConfig = struct {
 		Status          [2]byte
 		ConfVersion     [2]byte
 		Version         [2]byte
+		AckMode         [2]byte
+		PreferredLeader [2]byte
 	}
 }{
 	Id:              [2]byte{0x0B, 0x01},
@@ -536,6 +606,8 @@ var TableChannelClusterConfig = struct {
 		Status          [2]byte
 		ConfVersion     [2]byte
 		Version         [2]byte
+		AckMode         [2]byte
+		PreferredLeader [2]byte
 	}{
 		ChannelId:       [2]byte{0x0B, 0x01},
 		ChannelType:     [2]byte{0x0B, 0x02},
@@ -549,6 +621,8 @@ var TableChannelClusterConfig = struct {
 		Status:          [2]byte{0x0B, 0x0A},
 		ConfVersion:     [2]byte{0x0B, 0x0B},
 		Version:         [2]byte{0x0B, 0x0C},
+		AckMode:         [2]byte{0x0B, 0x0D},
+		PreferredLeader: [2]byte{0x0B, 0x0E},
 	},
 }
 
@@ -674,3 +748,136 @@ var TableTotal = struct {
 		ChannelClusterConfig: [2]byte{0x0F, 0x07},
 	},
 }
+
+// ======================== MessageUserQueue 用户消息队列 ========================
+
+var TableMessageUserQueue = struct {
+	Id     [2]byte
+	Size   int
+	Column struct {
+		LastSeq [2]byte
+		Cursor  [2]byte
+		Uid     [2]byte
+	}
+}{
+	Id:   [2]byte{0x10, 0x01},
+	Size: 2 + 2 + 8 + 8, // tableId + dataType + uid hash + queue seq
+	Column: struct {
+		LastSeq [2]byte
+		Cursor  [2]byte
+		Uid     [2]byte
+	}{
+		LastSeq: [2]byte{0x10, 0x01},
+		Cursor:  [2]byte{0x10, 0x02},
+		Uid:     [2]byte{0x10, 0x03}, // 队列所属的uid（uid只存了hash，遍历所有队列时需要）
+	},
+}
+
+// ======================== MessageSearch 消息全文检索倒排索引 ========================
+
+var TableMessageSearch = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x11, 0x01},
+	Size: 2 + 2 + 8 + 8 + 8, // tableId + dataType + channel hash + token hash + messageSeq
+}
+
+// ======================== WebhookOutbox webhook待发送事件 ========================
+
+var TableWebhookOutbox = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x12, 0x01},
+	Size: 2 + 2 + 8 + 8, // tableId + dataType + nextRetryAt + eventId
+}
+
+// ======================== WebhookDeadLetter webhook发送失败的事件 ========================
+
+var TableWebhookDeadLetter = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x13, 0x01},
+	Size: 2 + 2 + 8, // tableId + dataType + eventId
+}
+
+// ======================== StreamMeta 消息流元数据 ========================
+
+var TableStreamMeta = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x14, 0x01},
+	Size: 2 + 2 + 8 + 8, // tableId + dataType + channel hash + streamNo hash
+}
+
+// ======================== StreamItem 消息流片段 ========================
+
+var TableStreamItem = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x15, 0x01},
+	Size: 2 + 2 + 8 + 8 + 4, // tableId + dataType + channel hash + streamNo hash + streamSeq
+}
+
+// ======================== ChannelReadCursor 频道成员已读位置 ========================
+
+var TableChannelReadCursor = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x16, 0x01},
+	Size: 2 + 2 + 8 + 8, // tableId + dataType + channel hash + uid hash
+}
+
+// ======================== TokenDeny 设备token的拒绝名单 ========================
+
+var TableTokenDeny = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x17, 0x01},
+	Size: 2 + 2 + 8 + 8, // tableId + dataType + uid hash + jti hash
+}
+
+// ======================== APIKey http api的密钥 ========================
+
+var TableAPIKey = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x18, 0x01},
+	Size: 2 + 2 + 8, // tableId + dataType + keyId hash
+}
+
+// ======================== TenantUsage 租户的资源使用量 ========================
+
+var TableTenantUsage = struct {
+	Id   [2]byte
+	Size int
+}{
+	Id:   [2]byte{0x19, 0x01},
+	Size: 2 + 2 + 8, // tableId + dataType + appId hash
+}
+
+// ======================== SlotIndex 槽内的uid和频道 ========================
+
+var TableSlotIndex = struct {
+	Id   [2]byte
+	Kind struct {
+		Uid     byte
+		Channel byte
+	}
+}{
+	Id: [2]byte{0x1A, 0x01}, // tableId + dataType + slotId + kind + uid或(channelType + channelId)
+	Kind: struct {
+		Uid     byte
+		Channel byte
+	}{
+		Uid:     0x01,
+		Channel: 0x02,
+	},
+}
@@ -15,7 +15,9 @@ type dblock struct {
 	totalLock            *totalLock
 
 	updateSessionUpdatedAtLock sync.Mutex
+	tenantUsageLock            sync.Mutex
 	userLock                   *userLock
+	userQueueLock              *userQueueLock
 }
 
 func newDBLock() *dblock {
@@ -25,6 +27,7 @@ func newDBLock() *dblock {
 		allowlistCountLock:   newAllowlistCountLock(),
 		denylistCountLock:    newDenylistCountLock(),
 		userLock:             newUserLock(),
+		userQueueLock:        newUserQueueLock(),
 		totalLock:            newTotalLock(),
 	}
 
@@ -36,6 +39,7 @@ func (d *dblock) start() {
 	d.allowlistCountLock.StartCleanLoop()
 	d.denylistCountLock.StartCleanLoop()
 	d.userLock.StartCleanLoop()
+	d.userQueueLock.StartCleanLoop()
 }
 
 func (d *dblock) stop() {
@@ -44,6 +48,7 @@ func (d *dblock) stop() {
 	d.allowlistCountLock.StopCleanLoop()
 	d.denylistCountLock.StopCleanLoop()
 	d.userLock.StopCleanLoop()
+	d.userQueueLock.StopCleanLoop()
 }
 
 type channelClusterConfigLock struct {
@@ -139,6 +144,24 @@ func (u *userLock) unlock(uid string) {
 	u.Unlock(uid)
 }
 
+type userQueueLock struct {
+	*keylock.KeyLock
+}
+
+func newUserQueueLock() *userQueueLock {
+	return &userQueueLock{
+		keylock.NewKeyLock(),
+	}
+}
+
+func (u *userQueueLock) lock(uid string) {
+	u.Lock(uid)
+}
+
+func (u *userQueueLock) unlock(uid string) {
+	u.Unlock(uid)
+}
+
 type totalLock struct {
 	*keylock.KeyLock
 }
@@ -51,6 +51,34 @@ func (wk *wukongDB) AppendMessages(channelId string, channelType uint8, msgs []M
 	return batch.Commit(wk.sync)
 }
 
+// payloadRemoved 通知消息内容被清理
+func (wk *wukongDB) payloadRemoved(channelId string, channelType uint8, bytes int64) {
+	if bytes > 0 && wk.opts.OnPayloadRemoved != nil {
+		wk.opts.OnPayloadRemoved(channelId, channelType, bytes)
+	}
+}
+
+// readsInBatch 消息里是否有需要读取同批次内写入数据的消息（操作消息读取目标消息，流片段读取流元数据）
+func readsInBatch(msgs []Message) bool {
+	for _, msg := range msgs {
+		if msg.IsOp() {
+			return true
+		}
+		if msg.Setting.IsSet(wkproto.SettingStream) && msg.StreamNo != "" && msg.StreamFlag != wkproto.StreamFlagStart {
+			return true
+		}
+	}
+	return false
+}
+
+// newMessageBatch 只有需要读取同批次内写入的数据时才使用带索引的批次，普通消息使用普通批次以减少写入开销
+func newMessageBatch(db *pebble.DB, indexed bool) *pebble.Batch {
+	if indexed {
+		return db.NewIndexedBatch()
+	}
+	return db.NewBatch()
+}
+
 func (wk *wukongDB) channelDb(channelId string, channelType uint8) *pebble.DB {
 	dbIndex := wk.channelDbIndex(channelId, channelType)
 	return wk.shardDBById(uint32(dbIndex))
@@ -181,7 +209,7 @@ func (wk *wukongDB) GetMessage(messageId uint64) (Message, error) {
 		if err != nil {
 			return EmptyMessage, err
 		}
-		if IsEmptyMessage(msg) {
+		if IsEmptyMessage(msg) || msg.IsExpired(time.Now()) {
 			return EmptyMessage, ErrNotFound
 		}
 		return msg, nil
@@ -189,6 +217,9 @@ func (wk *wukongDB) GetMessage(messageId uint64) (Message, error) {
 	return EmptyMessage, ErrNotFound
 }
 
+// prevRangeMaxExpiredScan 往前加载消息时最多跳过的过期消息数量
+const prevRangeMaxExpiredScan = 1000
+
 // 情况1: startMessageSeq=100, endMessageSeq=0, limit=10 返回的消息seq为91-100的消息 (limit生效)
 // 情况2: startMessageSeq=5, endMessageSeq=0, limit=10 返回的消息seq为1-5的消息（消息无）
 
@@ -204,24 +235,11 @@ func (wk *wukongDB) LoadPrevRangeMsgs(channelId string, channelType uint8, start
 		return nil, fmt.Errorf("end messageSeq[%d] must be less than start messageSeq[%d]", endMessageSeq, startMessageSeq)
 	}
 
-	var minSeq uint64
-	var maxSeq uint64
-
-	if endMessageSeq == 0 {
-		maxSeq = startMessageSeq + 1
-		if startMessageSeq < uint64(limit) {
-			minSeq = 1
-		} else {
-			minSeq = startMessageSeq - uint64(limit) + 1
-		}
-	} else {
-		maxSeq = startMessageSeq + 1
-		if startMessageSeq-endMessageSeq > uint64(limit) {
-			minSeq = startMessageSeq - uint64(limit) + 1
-		} else {
-			minSeq = endMessageSeq + 1
-		}
-
+	maxSeq := startMessageSeq + 1
+	minSeq := endMessageSeq + 1 // endMessageSeq为0时从第一条消息开始
+	// 过期消息不计入limit，但最多多扫描prevRangeMaxExpiredScan条，避免频道大部分消息过期时遍历整个频道
+	if limit > 0 && maxSeq > uint64(limit)+prevRangeMaxExpiredScan && maxSeq-uint64(limit)-prevRangeMaxExpiredScan > minSeq {
+		minSeq = maxSeq - uint64(limit) - prevRangeMaxExpiredScan
 	}
 
 	// 获取频道的最大的messageSeq，超过这个的消息都视为无效
@@ -242,14 +260,24 @@ func (wk *wukongDB) LoadPrevRangeMsgs(channelId string, channelType uint8, start
 	})
 	defer iter.Close()
 
+	now := time.Now()
 	msgs := make([]Message, 0)
-	err = wk.iteratorChannelMessages(iter, limit, func(m Message) bool {
+
+	// 从后往前取，过期消息不计入limit
+	err = wk.iteratorChannelMessagesDirection(iter, 0, true, func(m Message) bool {
+		if m.IsExpired(now) {
+			return true
+		}
 		msgs = append(msgs, m)
-		return true
+		return limit == 0 || len(msgs) < limit
 	})
 	if err != nil {
 		return nil, err
 	}
+	// 按seq从小到大返回
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
 	return msgs, nil
 }
 
@@ -278,11 +306,16 @@ func (wk *wukongDB) LoadNextRangeMsgs(channelId string, channelType uint8, start
 	})
 	defer iter.Close()
 
+	now := time.Now()
 	msgs := make([]Message, 0)
 
-	err = wk.iteratorChannelMessages(iter, limit, func(m Message) bool {
+	// 过期消息不计入limit，所以这里在回调里自己控制数量
+	err = wk.iteratorChannelMessages(iter, 0, func(m Message) bool {
+		if m.IsExpired(now) {
+			return true
+		}
 		msgs = append(msgs, m)
-		return true
+		return limit == 0 || len(msgs) < limit
 	})
 	if err != nil {
 		return nil, err
@@ -556,26 +589,55 @@ func (wk *wukongDB) SearchMessages(req MessageSearchReq) ([]Message, error) {
 		return []Message{msg}, nil
 	}
 
-	iterFnc := func(msgs *[]Message) func(m Message) bool {
-		currSize := 0
-		return func(m Message) bool {
-			if strings.TrimSpace(req.ChannelId) != "" && m.ChannelID != req.ChannelId {
-				return true
-			}
+	now := time.Now()
+	// 消息是否满足搜索条件
+	matchFnc := func(m Message) bool {
+		if m.IsExpired(now) {
+			return false
+		}
 
-			if req.ChannelType != 0 && req.ChannelType != m.ChannelType {
-				return true
-			}
+		if strings.TrimSpace(req.ChannelId) != "" && m.ChannelID != req.ChannelId {
+			return false
+		}
 
-			if strings.TrimSpace(req.FromUid) != "" && m.FromUID != req.FromUid {
-				return true
-			}
+		if req.ChannelType != 0 && req.ChannelType != m.ChannelType {
+			return false
+		}
 
-			if len(req.Payload) > 0 && !bytes.Contains(m.Payload, req.Payload) {
-				return true
-			}
+		if strings.TrimSpace(req.FromUid) != "" && m.FromUID != req.FromUid {
+			return false
+		}
 
-			if req.MessageId > 0 && req.MessageId != m.MessageID {
+		if len(req.Payload) > 0 && !bytes.Contains(m.Payload, req.Payload) {
+			return false
+		}
+
+		if len(req.Keywords) > 0 && (m.Revoke || m.IsOp() || !matchKeywords(m.Payload, req.Keywords, req.KeywordOr)) {
+			return false
+		}
+
+		if req.StartTime > 0 && int64(m.Timestamp) < req.StartTime {
+			return false
+		}
+
+		if req.EndTime > 0 && int64(m.Timestamp) > req.EndTime {
+			return false
+		}
+
+		if req.MessageId > 0 && req.MessageId != m.MessageID {
+			return false
+		}
+		return true
+	}
+
+	if wk.canSearchByKeywordIndex(req) {
+		return wk.searchMessagesByKeywordIndex(req, matchFnc)
+	}
+
+	iterFnc := func(msgs *[]Message) func(m Message) bool {
+		currSize := 0
+		return func(m Message) bool {
+			if !matchFnc(m) {
 				return true
 			}
 
@@ -738,25 +800,13 @@ func (wk *wukongDB) iteratorChannelMessagesDirection(iter *pebble.Iterator, limi
 		hasData        bool = false
 	)
 
+	next := iter.Next
+	valid := iter.First()
 	if reverse {
-		if !iter.Last() {
-			return nil
-		}
-	} else {
-		if !iter.First() {
-			return nil
-		}
+		next = iter.Prev
+		valid = iter.Last()
 	}
-	for iter.Valid() {
-		if reverse {
-			if !iter.Prev() {
-				break
-			}
-		} else {
-			if !iter.Next() {
-				break
-			}
-		}
+	for ; valid; valid = next() {
 		messageSeq, coulmnName, err := key.ParseMessageColumnKey(iter.Key())
 		if err != nil {
 			return err
@@ -810,6 +860,24 @@ func (wk *wukongDB) iteratorChannelMessagesDirection(iter *pebble.Iterator, limi
 			preMessage.Payload = payload
 		case key.TableMessage.Column.Term:
 			preMessage.Term = wk.endian.Uint64(iter.Value())
+		case key.TableMessage.Column.Revoke:
+			preMessage.Revoke = iter.Value()[0] == 1
+		case key.TableMessage.Column.EditVersion:
+			preMessage.EditVersion = wk.endian.Uint32(iter.Value())
+		case key.TableMessage.Column.EditorUid:
+			preMessage.EditorUid = string(iter.Value())
+		case key.TableMessage.Column.EditedAt:
+			preMessage.EditedAt = int64(wk.endian.Uint64(iter.Value()))
+		case key.TableMessage.Column.OpType:
+			preMessage.OpType = MessageOpType(iter.Value()[0])
+		case key.TableMessage.Column.OpTargetSeq:
+			preMessage.OpTargetSeq = wk.endian.Uint64(iter.Value())
+		case key.TableMessage.Column.StreamNo:
+			preMessage.StreamNo = string(iter.Value())
+		case key.TableMessage.Column.StreamSeq:
+			preMessage.StreamSeq = wk.endian.Uint32(iter.Value())
+		case key.TableMessage.Column.StreamFlag:
+			preMessage.StreamFlag = wkproto.StreamFlag(iter.Value()[0])
 
 		}
 		hasData = true
@@ -888,6 +956,24 @@ func (wk *wukongDB) parseChannelMessagesWithLimitSize(iter *pebble.Iterator, lim
 			preMessage.Payload = payload
 		case key.TableMessage.Column.Term:
 			preMessage.Term = wk.endian.Uint64(iter.Value())
+		case key.TableMessage.Column.Revoke:
+			preMessage.Revoke = iter.Value()[0] == 1
+		case key.TableMessage.Column.EditVersion:
+			preMessage.EditVersion = wk.endian.Uint32(iter.Value())
+		case key.TableMessage.Column.EditorUid:
+			preMessage.EditorUid = string(iter.Value())
+		case key.TableMessage.Column.EditedAt:
+			preMessage.EditedAt = int64(wk.endian.Uint64(iter.Value()))
+		case key.TableMessage.Column.OpType:
+			preMessage.OpType = MessageOpType(iter.Value()[0])
+		case key.TableMessage.Column.OpTargetSeq:
+			preMessage.OpTargetSeq = wk.endian.Uint64(iter.Value())
+		case key.TableMessage.Column.StreamNo:
+			preMessage.StreamNo = string(iter.Value())
+		case key.TableMessage.Column.StreamSeq:
+			preMessage.StreamSeq = wk.endian.Uint32(iter.Value())
+		case key.TableMessage.Column.StreamFlag:
+			preMessage.StreamFlag = wkproto.StreamFlag(iter.Value()[0])
 		}
 	}
 
@@ -982,6 +1068,33 @@ func (wk *wukongDB) writeMessage(channelId string, channelType uint8, msg Messag
 		return err
 	}
 
+	// 操作消息
+	if msg.IsOp() {
+		if err = w.Set(key.NewMessageColumnKey(channelId, channelType, uint64(msg.MessageSeq), key.TableMessage.Column.OpType), []byte{uint8(msg.OpType)}, wk.noSync); err != nil {
+			return err
+		}
+		opTargetSeqBytes := make([]byte, 8)
+		wk.endian.PutUint64(opTargetSeqBytes, msg.OpTargetSeq)
+		if err = w.Set(key.NewMessageColumnKey(channelId, channelType, uint64(msg.MessageSeq), key.TableMessage.Column.OpTargetSeq), opTargetSeqBytes, wk.noSync); err != nil {
+			return err
+		}
+	}
+
+	// 流消息
+	if msg.Setting.IsSet(wkproto.SettingStream) {
+		if err = w.Set(key.NewMessageColumnKey(channelId, channelType, uint64(msg.MessageSeq), key.TableMessage.Column.StreamNo), []byte(msg.StreamNo), wk.noSync); err != nil {
+			return err
+		}
+		streamSeqBytes := make([]byte, 4)
+		wk.endian.PutUint32(streamSeqBytes, msg.StreamSeq)
+		if err = w.Set(key.NewMessageColumnKey(channelId, channelType, uint64(msg.MessageSeq), key.TableMessage.Column.StreamSeq), streamSeqBytes, wk.noSync); err != nil {
+			return err
+		}
+		if err = w.Set(key.NewMessageColumnKey(channelId, channelType, uint64(msg.MessageSeq), key.TableMessage.Column.StreamFlag), []byte{uint8(msg.StreamFlag)}, wk.noSync); err != nil {
+			return err
+		}
+	}
+
 	var primaryValue = [16]byte{}
 	wk.endian.PutUint64(primaryValue[:], key.ChannelIdToNum(channelId, channelType))
 	wk.endian.PutUint64(primaryValue[8:], uint64(msg.MessageSeq))
@@ -1006,5 +1119,12 @@ func (wk *wukongDB) writeMessage(channelId string, channelType uint8, msg Messag
 		return err
 	}
 
+	// index expireAt
+	if expireAt := msg.ExpireAt(); expireAt > 0 {
+		if err = w.Set(key.NewMessageSecondIndexExpireAtKey(expireAt, primaryValue), nil, wk.noSync); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,143 @@
+package wkdb
+
+import (
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// expireLoop 定时清理过期消息和过期的token拒绝名单
+func (wk *wukongDB) expireLoop() {
+	if wk.opts.ExpireCheckInterval <= 0 {
+		return
+	}
+	tk := time.NewTicker(wk.opts.ExpireCheckInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+			for shardId := range wk.dbs {
+				if _, err := wk.purgeExpiredMessages(uint32(shardId), time.Now(), wk.opts.ExpireBatchSize); err != nil {
+					wk.Error("purge expired messages failed", zap.Error(err), zap.Int("shardId", shardId))
+				}
+			}
+			if _, err := wk.PurgeExpiredTokenDenies(time.Now()); err != nil {
+				wk.Error("purge expired token denies failed", zap.Error(err))
+			}
+		case <-wk.cancelCtx.Done():
+			return
+		}
+	}
+}
+
+// PurgeExpiredMessages 清理所有分区内已过期的消息，返回清理的数量
+func (wk *wukongDB) PurgeExpiredMessages(now time.Time) (int, error) {
+	total := 0
+	for shardId := range wk.dbs {
+		count, err := wk.purgeExpiredMessages(uint32(shardId), now, 0)
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// purgeExpiredMessages 按过期索引清理指定分区的过期消息，limit=0表示不限制
+// 消息是频道日志的一部分，各副本清理的时机不同，所以只抹掉payload（墓碑），保留消息的其他列，
+// 这样频道日志不会出现空洞，落后的副本依然能从领导同步到连续的日志
+func (wk *wukongDB) purgeExpiredMessages(shardId uint32, now time.Time, limit int) (int, error) {
+	db := wk.shardDBById(shardId)
+
+	var minPrimaryKey, maxPrimaryKey [16]byte
+	for i := range maxPrimaryKey {
+		maxPrimaryKey[i] = 0xff
+	}
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageSecondIndexExpireAtKey(0, minPrimaryKey),
+		UpperBound: key.NewMessageSecondIndexExpireAtKey(uint64(now.Unix()), maxPrimaryKey),
+	})
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	var count int
+	removedBytes := make(map[string]int64) // 每个频道清理的消息内容字节数
+	for iter.First(); iter.Valid(); iter.Next() {
+		_, primaryKey, err := key.ParseMessageSecondIndexExpireAtKey(iter.Key())
+		if err != nil {
+			wk.Warn("parse expire index key failed", zap.Error(err))
+			continue
+		}
+		// 索引对应的消息已不需要再检查
+		if err = batch.Delete(iter.Key(), wk.noSync); err != nil {
+			return count, err
+		}
+
+		msg, err := wk.loadMessageByPrimaryKey(db, primaryKey)
+		if err != nil {
+			return count, err
+		}
+		if IsEmptyMessage(msg) { // 消息已被截断
+			continue
+		}
+		if !msg.IsExpired(now) {
+			continue
+		}
+		if err = wk.tombstoneMessage(primaryKey, msg, batch); err != nil {
+			return count, err
+		}
+		removedBytes[wkutil.ChannelToKey(msg.ChannelID, msg.ChannelType)] += int64(len(msg.Payload))
+		count++
+		if limit > 0 && count >= limit {
+			break
+		}
+	}
+	if batch.Empty() {
+		return 0, nil
+	}
+	if err := batch.Commit(wk.sync); err != nil {
+		return 0, err
+	}
+	for channelKey, bytes := range removedBytes {
+		channelId, channelType := wkutil.ChannelFromlKey(channelKey)
+		wk.payloadRemoved(channelId, channelType, bytes)
+	}
+	if count > 0 {
+		wk.Debug("purge expired messages", zap.Uint32("shardId", shardId), zap.Int("count", count))
+	}
+	return count, nil
+}
+
+func (wk *wukongDB) loadMessageByPrimaryKey(db *pebble.DB, primaryKey [16]byte) (Message, error) {
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageColumnKeyWithPrimary(primaryKey, key.MinColumnKey),
+		UpperBound: key.NewMessageColumnKeyWithPrimary(primaryKey, key.MaxColumnKey),
+	})
+	defer iter.Close()
+
+	var msg Message
+	err := wk.iteratorChannelMessages(iter, 0, func(m Message) bool {
+		msg = m
+		return false
+	})
+	return msg, err
+}
+
+// tombstoneMessage 抹掉消息的payload和全文索引，保留消息在频道日志里的位置
+func (wk *wukongDB) tombstoneMessage(primaryKey [16]byte, msg Message, w pebble.Writer) error {
+	if err := w.Set(key.NewMessageColumnKeyWithPrimary(primaryKey, key.TableMessage.Column.Payload), nil, wk.noSync); err != nil {
+		return err
+	}
+	if wk.opts.MessageSearchIndexOn && !msg.IsOp() && len(msg.Payload) > 0 {
+		if err := wk.deleteMessageSearchIndex(wk.endian.Uint64(primaryKey[:8]), uint64(msg.MessageSeq), msg.Payload, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
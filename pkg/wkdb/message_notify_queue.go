@@ -45,6 +45,16 @@ func (wk *wukongDB) RemoveMessagesOfNotifyQueue(messageIDs []int64) error {
 	return batch.Commit(wk.sync)
 }
 
+// getAllMessagesOfNotifyQueue 获取通知队列里的所有消息
+func (wk *wukongDB) getAllMessagesOfNotifyQueue(r pebble.Reader) ([]Message, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageNotifyQueueKey(0),
+		UpperBound: key.NewMessageNotifyQueueKey(math.MaxUint64),
+	})
+	defer iter.Close()
+	return wk.parseMessageOfNotifyQueue(iter, 0)
+}
+
 func (wk *wukongDB) writeMessageOfNotifyQueue(msg Message, w *pebble.Batch) error {
 	data, err := msg.Marshal()
 	if err != nil {
@@ -0,0 +1,193 @@
+package wkdb
+
+import (
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// ApplyMessages 应用频道已提交的消息[startMessageSeq,endMessageSeq)，写入撤回/编辑、消息流、全文检索索引等派生数据，同时记录已应用的下标
+// 派生数据只在日志提交后写入，未提交的日志被截断时不会留下派生数据
+func (wk *wukongDB) ApplyMessages(channelId string, channelType uint8, startMessageSeq, endMessageSeq uint64) error {
+	msgs, err := wk.LoadNextRangeMsgsForSize(channelId, channelType, startMessageSeq, endMessageSeq, 0)
+	if err != nil {
+		return err
+	}
+	db := wk.channelDb(channelId, channelType)
+	batch := newMessageBatch(db, readsInBatch(msgs))
+	defer batch.Close()
+	var removedBytes int64
+	for _, msg := range msgs {
+		// 全文检索索引
+		if wk.opts.MessageSearchIndexOn && !msg.IsOp() && !msg.Revoke {
+			if err = wk.writeMessageSearchIndex(key.ChannelIdToNum(channelId, channelType), uint64(msg.MessageSeq), msg.Payload, batch); err != nil {
+				return err
+			}
+		}
+		if err = wk.applyMessageStream(channelId, channelType, msg, batch); err != nil {
+			return err
+		}
+		opRemovedBytes, err := wk.applyMessageOp(channelId, channelType, msg, batch)
+		if err != nil {
+			return err
+		}
+		removedBytes += opRemovedBytes
+	}
+	if err = wk.setChannelAppliedIndex(channelId, channelType, endMessageSeq-1, batch, wk.noSync); err != nil {
+		return err
+	}
+	if err = batch.Commit(wk.sync); err != nil {
+		return err
+	}
+	wk.payloadRemoved(channelId, channelType, removedBytes)
+	return nil
+}
+
+// applyMessageOp 将操作消息（撤回/编辑）应用到目标消息上，返回撤回清理的消息内容字节数
+// 操作消息和普通消息一样走频道日志，各副本按日志顺序应用，所以编辑版本在副本间是一致的
+func (wk *wukongDB) applyMessageOp(channelId string, channelType uint8, msg Message, batch *pebble.Batch) (int64, error) {
+	if !msg.IsOp() {
+		return 0, nil
+	}
+	if msg.OpTargetSeq == 0 || msg.OpTargetSeq >= uint64(msg.MessageSeq) {
+		wk.Warn("invalid message op target", zap.String("channelId", channelId), zap.Uint8("channelType", channelType), zap.Uint32("messageSeq", msg.MessageSeq), zap.Uint64("opTargetSeq", msg.OpTargetSeq))
+		return 0, nil
+	}
+
+	// 目标消息不存在（可能已过期清理），忽略
+	_, closer, err := batch.Get(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.MessageId))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	closer.Close()
+
+	var editVersion uint32
+	result, closer, err := batch.Get(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.EditVersion))
+	if err != nil && err != pebble.ErrNotFound {
+		return 0, err
+	}
+	if err == nil {
+		editVersion = wk.endian.Uint32(result)
+		closer.Close()
+	}
+	editVersion++
+
+	// 撤回或编辑后旧内容不应再被搜索到
+	if wk.opts.MessageSearchIndexOn {
+		if err = wk.updateMessageSearchIndexOfOp(channelId, channelType, msg, batch); err != nil {
+			return 0, err
+		}
+	}
+
+	var removedBytes int64
+	switch msg.OpType {
+	case MessageOpRevoke:
+		if err = batch.Set(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.Revoke), []byte{1}, wk.noSync); err != nil {
+			return 0, err
+		}
+		// 撤回后不再保留原内容，之前编辑操作消息里的内容也一并抹掉
+		payloadKey := key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.Payload)
+		if removedBytes, err = payloadSize(batch, payloadKey); err != nil {
+			return 0, err
+		}
+		if err = batch.Set(payloadKey, nil, wk.noSync); err != nil {
+			return 0, err
+		}
+		editBytes, err := wk.clearEditPayloadsOf(channelId, channelType, msg.OpTargetSeq, uint64(msg.MessageSeq), batch)
+		if err != nil {
+			return 0, err
+		}
+		removedBytes += editBytes
+	case MessageOpEdit:
+		if err = batch.Set(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.Payload), msg.Payload, wk.noSync); err != nil {
+			return 0, err
+		}
+	default:
+		wk.Warn("unknown message op type", zap.Uint8("opType", uint8(msg.OpType)))
+		return 0, nil
+	}
+
+	editVersionBytes := make([]byte, 4)
+	wk.endian.PutUint32(editVersionBytes, editVersion)
+	if err = batch.Set(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.EditVersion), editVersionBytes, wk.noSync); err != nil {
+		return 0, err
+	}
+
+	if err = batch.Set(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.EditorUid), []byte(msg.FromUID), wk.noSync); err != nil {
+		return 0, err
+	}
+
+	editedAtBytes := make([]byte, 8)
+	wk.endian.PutUint64(editedAtBytes, uint64(msg.Timestamp))
+	return removedBytes, batch.Set(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.EditedAt), editedAtBytes, wk.noSync)
+}
+
+func payloadSize(batch *pebble.Batch, payloadKey []byte) (int64, error) {
+	result, closer, err := batch.Get(payloadKey)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer closer.Close()
+	return int64(len(result)), nil
+}
+
+// clearEditPayloadsOf 抹掉(targetSeq, endSeq)之间编辑targetSeq的操作消息的内容，返回抹掉的字节数
+func (wk *wukongDB) clearEditPayloadsOf(channelId string, channelType uint8, targetSeq, endSeq uint64, batch *pebble.Batch) (int64, error) {
+	iter := batch.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessagePrimaryKey(channelId, channelType, targetSeq+1),
+		UpperBound: key.NewMessagePrimaryKey(channelId, channelType, endSeq),
+	})
+	defer iter.Close()
+
+	var editSeqs []uint64
+	for iter.First(); iter.Valid(); iter.Next() {
+		messageSeq, columnName, err := key.ParseMessageColumnKey(iter.Key())
+		if err != nil {
+			return 0, err
+		}
+		if columnName != key.TableMessage.Column.OpTargetSeq || len(iter.Value()) != 8 {
+			continue
+		}
+		if wk.endian.Uint64(iter.Value()) == targetSeq {
+			editSeqs = append(editSeqs, messageSeq)
+		}
+	}
+	var removedBytes int64
+	for _, editSeq := range editSeqs {
+		payloadKey := key.NewMessageColumnKey(channelId, channelType, editSeq, key.TableMessage.Column.Payload)
+		size, err := payloadSize(batch, payloadKey)
+		if err != nil {
+			return 0, err
+		}
+		removedBytes += size
+		if err = batch.Set(payloadKey, nil, wk.noSync); err != nil {
+			return 0, err
+		}
+	}
+	return removedBytes, nil
+}
+
+func (wk *wukongDB) updateMessageSearchIndexOfOp(channelId string, channelType uint8, msg Message, batch *pebble.Batch) error {
+	result, closer, err := batch.Get(key.NewMessageColumnKey(channelId, channelType, msg.OpTargetSeq, key.TableMessage.Column.Payload))
+	if err != nil && err != pebble.ErrNotFound {
+		return err
+	}
+	channelHash := key.ChannelIdToNum(channelId, channelType)
+	if err == nil {
+		err = wk.deleteMessageSearchIndex(channelHash, msg.OpTargetSeq, result, batch)
+		closer.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if msg.OpType == MessageOpEdit {
+		return wk.writeMessageSearchIndex(channelHash, msg.OpTargetSeq, msg.Payload, batch)
+	}
+	return nil
+}
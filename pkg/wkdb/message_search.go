@@ -0,0 +1,327 @@
+package wkdb
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// 重建索引时每批提交的消息数量
+const rebuildSearchIndexBatchSize = 1000
+
+// 通过索引查询时每段每个词最多读取的消息序号数量
+const maxSearchCandidates = 10000
+
+// writeMessageSearchIndex 写入消息内容的倒排索引
+func (wk *wukongDB) writeMessageSearchIndex(channelHash uint64, messageSeq uint64, payload []byte, w pebble.Writer) error {
+	for _, token := range tokenize(string(payload)) {
+		if err := w.Set(key.NewMessageSearchTokenKey(channelHash, token, messageSeq), nil, wk.noSync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMessageSearchIndex 删除消息内容的倒排索引
+func (wk *wukongDB) deleteMessageSearchIndex(channelHash uint64, messageSeq uint64, payload []byte, w pebble.Writer) error {
+	for _, token := range tokenize(string(payload)) {
+		if err := w.Delete(key.NewMessageSearchTokenKey(channelHash, token, messageSeq), wk.noSync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canSearchByKeywordIndex 是否可以通过倒排索引查询
+// 截断或清理过的消息可能在索引里残留，所以索引只用来缩小范围，命中后还会校验消息内容
+// 关键词分不出词（例如单个汉字、单个字母）时索引无法缩小范围，且查询至少要有一个关键词能分词，或查询要所有关键词都能分词，否则走扫描
+func (wk *wukongDB) canSearchByKeywordIndex(req MessageSearchReq) bool {
+	if !wk.opts.MessageSearchIndexOn || len(req.Keywords) == 0 {
+		return false
+	}
+	if strings.TrimSpace(req.ChannelId) == "" || req.ChannelType == 0 {
+		return false
+	}
+	hasToken := false
+	for _, keyword := range req.Keywords {
+		if len(tokenizeKeyword(keyword)) > 0 {
+			hasToken = true
+		} else if req.KeywordOr { // 或查询时，只要有一个关键词无法分词就无法通过索引查全
+			return false
+		}
+	}
+	return hasToken
+}
+
+// searchMessagesByKeywordIndex 通过倒排索引查询频道内包含关键词的消息
+// 默认按messageSeq从大到小返回，Pre为true时从小到大返回，OffsetMessageSeq和OffsetMessageId为分页游标（不包含）
+// 按返回顺序分段查询，每段每个词最多读取maxSearchCandidates个序号，结果不够时再查下一段，避免高频词把整个频道的序号读进内存
+func (wk *wukongDB) searchMessagesByKeywordIndex(req MessageSearchReq, filter func(m Message) bool) ([]Message, error) {
+	db := wk.channelDb(req.ChannelId, req.ChannelType)
+	channelHash := key.ChannelIdToNum(req.ChannelId, req.ChannelType)
+
+	// 查询的序号范围[startSeq, endSeq)
+	var startSeq, endSeq uint64 = 0, math.MaxUint64
+	if req.OffsetMessageSeq > 0 {
+		if req.Pre {
+			startSeq = req.OffsetMessageSeq + 1
+		} else {
+			endSeq = req.OffsetMessageSeq
+		}
+	}
+
+	keywordTokens := make([][]string, 0, len(req.Keywords))
+	for _, keyword := range req.Keywords {
+		keywordTokens = append(keywordTokens, tokenizeKeyword(keyword))
+	}
+
+	msgs := make([]Message, 0, req.Limit)
+	for startSeq < endSeq {
+		// 所有词在[completeStart, completeEnd)内的序号都读全了
+		completeStart, completeEnd := startSeq, endSeq
+		tokenSeqs := func(token string) map[uint64]struct{} {
+			seqs, boundary, full := wk.searchTokenSeqs(db, channelHash, token, startSeq, endSeq, req.Pre)
+			if full {
+				if req.Pre && boundary+1 < completeEnd {
+					completeEnd = boundary + 1
+				} else if !req.Pre && boundary > completeStart {
+					completeStart = boundary
+				}
+			}
+			return seqs
+		}
+
+		var candidates map[uint64]struct{}
+		for _, tokens := range keywordTokens {
+			if len(tokens) == 0 { // 且查询时无法分词的关键词只在内容校验时过滤
+				continue
+			}
+			// 一个关键词的所有词都命中才算命中
+			var keywordSeqs map[uint64]struct{}
+			for _, token := range tokens {
+				seqs := tokenSeqs(token)
+				if keywordSeqs == nil {
+					keywordSeqs = seqs
+				} else {
+					keywordSeqs = intersectSeqs(keywordSeqs, seqs)
+				}
+			}
+			if candidates == nil {
+				candidates = keywordSeqs
+			} else if req.KeywordOr {
+				for seq := range keywordSeqs {
+					candidates[seq] = struct{}{}
+				}
+			} else {
+				candidates = intersectSeqs(candidates, keywordSeqs)
+			}
+		}
+
+		seqs := make([]uint64, 0, len(candidates))
+		for seq := range candidates {
+			if seq >= completeStart && seq < completeEnd {
+				seqs = append(seqs, seq)
+			}
+		}
+		sort.Slice(seqs, func(i, j int) bool {
+			if req.Pre {
+				return seqs[i] < seqs[j]
+			}
+			return seqs[i] > seqs[j]
+		})
+
+		for _, seq := range seqs {
+			msg, err := wk.LoadMsg(req.ChannelId, req.ChannelType, seq)
+			if err != nil {
+				if err == ErrNotFound {
+					continue
+				}
+				return nil, err
+			}
+			if !filter(msg) {
+				continue
+			}
+			if req.OffsetMessageId > 0 { // 只返回messageId游标之后（Pre为true）或之前的消息
+				if req.Pre && msg.MessageID <= req.OffsetMessageId {
+					continue
+				}
+				if !req.Pre && msg.MessageID >= req.OffsetMessageId {
+					continue
+				}
+			}
+			msgs = append(msgs, msg)
+			if req.Limit > 0 && len(msgs) >= req.Limit {
+				return msgs, nil
+			}
+		}
+
+		// 下一段
+		if req.Pre {
+			startSeq = completeEnd
+		} else {
+			endSeq = completeStart
+		}
+	}
+	return msgs, nil
+}
+
+// searchTokenSeqs 按返回顺序读取词在[startSeq, endSeq)内的消息序号，最多读取maxSearchCandidates个
+// full为true表示读满了，boundary为读到的最后一个序号，范围内boundary之后（按返回顺序）的序号没有读取
+func (wk *wukongDB) searchTokenSeqs(db *pebble.DB, channelHash uint64, token string, startSeq, endSeq uint64, asc bool) (seqs map[uint64]struct{}, boundary uint64, full bool) {
+	seqs = make(map[uint64]struct{})
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageSearchTokenKey(channelHash, token, startSeq),
+		UpperBound: key.NewMessageSearchTokenKey(channelHash, token, endSeq),
+	})
+	defer iter.Close()
+	valid := iter.Last
+	next := iter.Prev
+	if asc {
+		valid = iter.First
+		next = iter.Next
+	}
+	for ok := valid(); ok; ok = next() {
+		seq, err := key.ParseMessageSearchTokenKey(iter.Key())
+		if err != nil {
+			wk.Warn("parse message search key failed", zap.Error(err))
+			continue
+		}
+		seqs[seq] = struct{}{}
+		if len(seqs) >= maxSearchCandidates {
+			return seqs, seq, true
+		}
+	}
+	return seqs, 0, false
+}
+
+// RebuildMessageSearchIndex 重建所有消息的倒排索引，返回建立索引的消息数量
+func (wk *wukongDB) RebuildMessageSearchIndex() (int, error) {
+	total := 0
+	for shardId, db := range wk.dbs {
+		start := time.Now()
+		count, err := wk.rebuildMessageSearchIndex(db)
+		if err != nil {
+			return total, err
+		}
+		total += count
+		wk.Info("rebuild message search index", zap.Int("shardId", shardId), zap.Int("count", count), zap.Duration("cost", time.Since(start)))
+	}
+	return total, nil
+}
+
+func (wk *wukongDB) rebuildMessageSearchIndex(db *pebble.DB) (int, error) {
+	if err := db.DeleteRange(key.NewMessageSearchLowKey(), key.NewMessageSearchHighKey(), wk.sync); err != nil {
+		return 0, err
+	}
+
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageSearchLowKeWith("", 0, 0),
+		UpperBound: key.NewMessageSearchHighKeWith("", 0, math.MaxUint64),
+	})
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	defer func() {
+		batch.Close()
+	}()
+
+	var (
+		count      int
+		batchCount int
+		hasMsg     bool
+		primaryKey [16]byte
+		payload    []byte
+		skip       bool // 操作消息和已撤回的消息不建立索引
+	)
+	flush := func() error {
+		if !hasMsg || skip || len(payload) == 0 {
+			return nil
+		}
+		channelHash := wk.endian.Uint64(primaryKey[:8])
+		messageSeq := wk.endian.Uint64(primaryKey[8:])
+		if err := wk.writeMessageSearchIndex(channelHash, messageSeq, payload, batch); err != nil {
+			return err
+		}
+		count++
+		batchCount++
+		if batchCount >= rebuildSearchIndexBatchSize {
+			if err := batch.Commit(wk.sync); err != nil {
+				return err
+			}
+			batch.Close()
+			batch = db.NewBatch()
+			batchCount = 0
+		}
+		return nil
+	}
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		k := iter.Key()
+		if len(k) != key.TableMessage.Size {
+			continue
+		}
+		if !hasMsg || !bytes.Equal(primaryKey[:], k[4:20]) {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			copy(primaryKey[:], k[4:20])
+			hasMsg = true
+			payload = nil
+			skip = false
+		}
+		var columnName [2]byte
+		copy(columnName[:], k[20:22])
+		switch columnName {
+		case key.TableMessage.Column.Payload:
+			payload = append([]byte(nil), iter.Value()...)
+		case key.TableMessage.Column.Revoke:
+			skip = skip || (len(iter.Value()) > 0 && iter.Value()[0] == 1)
+		case key.TableMessage.Column.OpType:
+			skip = true
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	if batch.Empty() {
+		return count, nil
+	}
+	return count, batch.Commit(wk.sync)
+}
+
+// matchKeywords 消息内容是否包含关键词（不区分大小写）
+func matchKeywords(payload []byte, keywords []string, or bool) bool {
+	if len(keywords) == 0 {
+		return true
+	}
+	content := strings.ToLower(string(payload))
+	for _, keyword := range keywords {
+		matched := strings.Contains(content, strings.ToLower(keyword))
+		if or && matched {
+			return true
+		}
+		if !or && !matched {
+			return false
+		}
+	}
+	return !or
+}
+
+func intersectSeqs(a, b map[uint64]struct{}) map[uint64]struct{} {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	result := make(map[uint64]struct{}, len(a))
+	for seq := range a {
+		if _, ok := b[seq]; ok {
+			result[seq] = struct{}{}
+		}
+	}
+	return result
+}
@@ -0,0 +1,213 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMessagesByKeywords(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(1), wkdb.WithMessageSearchIndexOn(true)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	channelId := "channel"
+	channelType := uint8(2)
+
+	payloads := []string{
+		"Hello World",
+		"今天天气很好",
+		"hello 悟空IM",
+		"明天天气不好",
+		"goodbye world, ok",
+	}
+	messages := make([]wkdb.Message, 0, len(payloads))
+	for i, payload := range payloads {
+		fromUid := "u1"
+		if i%2 == 1 {
+			fromUid = "u2"
+		}
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   int64(i + 1),
+				MessageSeq:  uint32(i + 1),
+				FromUID:     fromUid,
+				Timestamp:   int32(1000 + i),
+				Payload:     []byte(payload),
+			},
+		})
+	}
+	err = d.AppendMessages(channelId, channelType, messages)
+	assert.NoError(t, err)
+
+	// 日志提交后才建立索引
+	msgs, err := d.SearchMessages(wkdb.MessageSearchReq{ChannelId: channelId, ChannelType: channelType, Keywords: []string{"hello"}, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	err = d.ApplyMessages(channelId, channelType, 1, uint64(len(payloads)+1))
+	assert.NoError(t, err)
+
+	search := func(req wkdb.MessageSearchReq) []uint32 {
+		req.ChannelId = channelId
+		req.ChannelType = channelType
+		if req.Limit == 0 {
+			req.Limit = 10
+		}
+		msgs, err := d.SearchMessages(req)
+		assert.NoError(t, err)
+		seqs := make([]uint32, 0, len(msgs))
+		for _, m := range msgs {
+			seqs = append(seqs, m.MessageSeq)
+		}
+		return seqs
+	}
+
+	// 且
+	assert.Equal(t, []uint32{3, 1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}}))
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello", "world"}}))
+	assert.Equal(t, []uint32{4, 2}, search(wkdb.MessageSearchReq{Keywords: []string{"天气"}}))
+	assert.Equal(t, []uint32{2}, search(wkdb.MessageSearchReq{Keywords: []string{"天气很好"}}))
+	assert.Equal(t, []uint32{3}, search(wkdb.MessageSearchReq{Keywords: []string{"悟空"}}))
+
+	// 或
+	assert.Equal(t, []uint32{5, 3, 2}, search(wkdb.MessageSearchReq{Keywords: []string{"悟空", "goodbye", "很好"}, KeywordOr: true}))
+
+	// 发送者和时间范围
+	assert.Equal(t, []uint32{4}, search(wkdb.MessageSearchReq{Keywords: []string{"天气"}, FromUid: "u2", StartTime: 1002}))
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}, EndTime: 1001}))
+
+	// 游标分页
+	assert.Equal(t, []uint32{5}, search(wkdb.MessageSearchReq{Keywords: []string{"world", "hello"}, KeywordOr: true, Limit: 1}))
+	assert.Equal(t, []uint32{3}, search(wkdb.MessageSearchReq{Keywords: []string{"world", "hello"}, KeywordOr: true, Limit: 1, OffsetMessageSeq: 5}))
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"world", "hello"}, KeywordOr: true, Limit: 1, OffsetMessageSeq: 3}))
+
+	// 按子串匹配，和未开启索引时的扫描结果一致
+	assert.Equal(t, []uint32{3, 1}, search(wkdb.MessageSearchReq{Keywords: []string{"hel"}}))
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"llo wor"}}))
+	assert.Equal(t, []uint32{4, 2}, search(wkdb.MessageSearchReq{Keywords: []string{"气"}}))
+	assert.Equal(t, []uint32{4, 2}, search(wkdb.MessageSearchReq{Keywords: []string{"气", "天气"}}))
+	assert.Equal(t, []uint32{5, 4, 2}, search(wkdb.MessageSearchReq{Keywords: []string{"天", "bye"}, KeywordOr: true}))
+
+	// 短词按整词匹配
+	assert.Equal(t, []uint32{5}, search(wkdb.MessageSearchReq{Keywords: []string{"OK"}}))
+	assert.Equal(t, []uint32{5}, search(wkdb.MessageSearchReq{Keywords: []string{"ok", "world"}}))
+
+	// messageId游标
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}, OffsetMessageId: 3}))
+	assert.Equal(t, []uint32{3}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}, OffsetMessageId: 1, Pre: true}))
+
+	// 编辑后旧内容搜不到，新内容可以搜到
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{
+			RecvPacket: wkproto.RecvPacket{
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   6,
+				MessageSeq:  6,
+				FromUID:     "u1",
+				Payload:     []byte("再见"),
+			},
+			OpType:      wkdb.MessageOpEdit,
+			OpTargetSeq: 5,
+		},
+	})
+	assert.NoError(t, err)
+	err = d.ApplyMessages(channelId, channelType, 6, 7)
+	assert.NoError(t, err)
+	assert.Empty(t, search(wkdb.MessageSearchReq{Keywords: []string{"goodbye"}}))
+	assert.Equal(t, []uint32{5}, search(wkdb.MessageSearchReq{Keywords: []string{"再见"}}))
+
+	err = d.Close()
+	assert.NoError(t, err)
+
+	// 未开启索引时写入的消息，重建索引后可以通过索引搜到
+	d = wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(1)))
+	err = d.Open()
+	assert.NoError(t, err)
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{
+			RecvPacket: wkproto.RecvPacket{
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   7,
+				MessageSeq:  7,
+				Payload:     []byte("hello again"),
+			},
+		},
+	})
+	assert.NoError(t, err)
+	err = d.Close()
+	assert.NoError(t, err)
+
+	d = wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(1), wkdb.WithMessageSearchIndexOn(true)))
+	err = d.Open()
+	assert.NoError(t, err)
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, []uint32{3, 1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}}))
+
+	count, err := d.RebuildMessageSearchIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, count)
+	assert.Equal(t, []uint32{7, 3, 1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}}))
+	assert.Equal(t, []uint32{5}, search(wkdb.MessageSearchReq{Keywords: []string{"再见"}}))
+}
+
+func TestSearchMessagesByKeywordsWithManyCandidates(t *testing.T) {
+	d := newTestDB(t, wkdb.WithMessageSearchIndexOn(true))
+	err := d.Open()
+	assert.NoError(t, err)
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "channel"
+	channelType := uint8(2)
+
+	// 高频词命中的消息超过单次读取的上限，分段查询后结果依然完整
+	count := 25000
+	messages := make([]wkdb.Message, 0, count)
+	for i := 1; i <= count; i++ {
+		payload := "hello"
+		if i == 1 || i == count/2 {
+			payload = "hello world"
+		}
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   int64(i),
+				MessageSeq:  uint32(i),
+				Payload:     []byte(payload),
+			},
+		})
+	}
+	err = d.AppendMessages(channelId, channelType, messages)
+	assert.NoError(t, err)
+	err = d.ApplyMessages(channelId, channelType, 1, uint64(count+1))
+	assert.NoError(t, err)
+
+	search := func(req wkdb.MessageSearchReq) []uint32 {
+		req.ChannelId = channelId
+		req.ChannelType = channelType
+		msgs, err := d.SearchMessages(req)
+		assert.NoError(t, err)
+		seqs := make([]uint32, 0, len(msgs))
+		for _, m := range msgs {
+			seqs = append(seqs, m.MessageSeq)
+		}
+		return seqs
+	}
+	assert.Equal(t, []uint32{uint32(count / 2), 1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello", "world"}, Limit: 10}))
+	assert.Equal(t, []uint32{1, uint32(count / 2)}, search(wkdb.MessageSearchReq{Keywords: []string{"world", "hello"}, Limit: 10, Pre: true}))
+	assert.Equal(t, []uint32{1}, search(wkdb.MessageSearchReq{Keywords: []string{"hello", "world"}, Limit: 10, OffsetMessageSeq: uint64(count / 2)}))
+	assert.Equal(t, []uint32{uint32(count), uint32(count - 1)}, search(wkdb.MessageSearchReq{Keywords: []string{"hello"}, Limit: 2}))
+}
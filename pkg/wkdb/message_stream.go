@@ -0,0 +1,147 @@
+package wkdb
+
+import (
+	"math"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// applyMessageStream 将已提交的流消息写入消息流元数据和片段表
+// 流消息和普通消息一样走频道日志，各副本按日志顺序应用，所以流数据在副本间是一致的
+func (wk *wukongDB) applyMessageStream(channelId string, channelType uint8, msg Message, batch *pebble.Batch) error {
+	if !msg.Setting.IsSet(wkproto.SettingStream) || msg.StreamNo == "" {
+		return nil
+	}
+
+	metaKey := key.NewStreamMetaKey(channelId, channelType, msg.StreamNo)
+
+	if msg.StreamFlag == wkproto.StreamFlagStart {
+		meta := StreamMeta{
+			StreamNo:    msg.StreamNo,
+			ChannelId:   channelId,
+			ChannelType: channelType,
+			FromUid:     msg.FromUID,
+			ClientMsgNo: msg.ClientMsgNo,
+			MessageId:   msg.MessageID,
+			MessageSeq:  uint64(msg.MessageSeq),
+			StreamFlag:  wkproto.StreamFlagStart,
+			CreatedAt:   int64(msg.Timestamp),
+		}
+		return wk.writeStreamMeta(metaKey, meta, batch)
+	}
+
+	meta, err := wk.getStreamMeta(metaKey, batch)
+	if err != nil {
+		if err == ErrNotFound { // 流没有开始消息（可能已过期清理），忽略
+			wk.Warn("stream meta not found", zap.String("channelId", channelId), zap.Uint8("channelType", channelType), zap.String("streamNo", msg.StreamNo), zap.Uint32("messageSeq", msg.MessageSeq))
+			return nil
+		}
+		return err
+	}
+	if meta.StreamFlag == wkproto.StreamFlagEnd { // 流已结束，后续片段忽略
+		wk.Warn("stream already end", zap.String("channelId", channelId), zap.Uint8("channelType", channelType), zap.String("streamNo", msg.StreamNo), zap.Uint32("messageSeq", msg.MessageSeq))
+		return nil
+	}
+
+	if len(msg.Payload) > 0 {
+		item := StreamItem{
+			StreamSeq:   msg.StreamSeq,
+			ClientMsgNo: msg.ClientMsgNo,
+			MessageSeq:  uint64(msg.MessageSeq),
+			Blob:        msg.Payload,
+		}
+		data, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(key.NewStreamItemKey(channelId, channelType, msg.StreamNo, msg.StreamSeq), data, wk.noSync); err != nil {
+			return err
+		}
+	}
+
+	if msg.StreamSeq > meta.LastStreamSeq {
+		meta.LastStreamSeq = msg.StreamSeq
+	}
+	meta.StreamFlag = msg.StreamFlag
+	return wk.writeStreamMeta(metaKey, meta, batch)
+}
+
+func (wk *wukongDB) GetStreamMeta(channelId string, channelType uint8, streamNo string) (StreamMeta, error) {
+	return wk.getStreamMeta(key.NewStreamMetaKey(channelId, channelType, streamNo), wk.channelDb(channelId, channelType))
+}
+
+// LastStreamSeq 流最后一个片段的序号，包含已追加还没应用的日志里的片段，流不存在返回0
+func (wk *wukongDB) LastStreamSeq(channelId string, channelType uint8, streamNo string) (uint32, error) {
+	meta, err := wk.GetStreamMeta(channelId, channelType, streamNo)
+	if err != nil && err != ErrNotFound {
+		return 0, err
+	}
+	lastStreamSeq := meta.LastStreamSeq
+	appliedIndex, err := wk.GetChannelAppliedIndex(channelId, channelType)
+	if err != nil {
+		return 0, err
+	}
+	msgs, err := wk.LoadNextRangeMsgsForSize(channelId, channelType, appliedIndex+1, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		if !msg.Setting.IsSet(wkproto.SettingStream) || msg.StreamNo != streamNo {
+			continue
+		}
+		if msg.StreamSeq > lastStreamSeq {
+			lastStreamSeq = msg.StreamSeq
+		}
+	}
+	return lastStreamSeq, nil
+}
+
+func (wk *wukongDB) GetStreamItems(channelId string, channelType uint8, streamNo string) ([]StreamItem, error) {
+	db := wk.channelDb(channelId, channelType)
+	iter := db.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewStreamItemKey(channelId, channelType, streamNo, 0),
+		UpperBound: key.NewStreamItemKey(channelId, channelType, streamNo, math.MaxUint32),
+	})
+	defer iter.Close()
+
+	items := make([]StreamItem, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		// 这里必须复制一份，否则会被pebble覆盖
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+		var item StreamItem
+		if err := item.Unmarshal(value); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (wk *wukongDB) getStreamMeta(metaKey []byte, r pebble.Reader) (StreamMeta, error) {
+	result, closer, err := r.Get(metaKey)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return EmptyStreamMeta, ErrNotFound
+		}
+		return EmptyStreamMeta, err
+	}
+	defer closer.Close()
+
+	var meta StreamMeta
+	if err = meta.Unmarshal(result); err != nil {
+		return EmptyStreamMeta, err
+	}
+	return meta, nil
+}
+
+func (wk *wukongDB) writeStreamMeta(metaKey []byte, meta StreamMeta, w pebble.Writer) error {
+	data, err := meta.Marshal()
+	if err != nil {
+		return err
+	}
+	return w.Set(metaKey, data, wk.noSync)
+}
@@ -0,0 +1,101 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageStream(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(1)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "channel"
+	channelType := uint8(2)
+	streamNo := "stream1"
+
+	newStreamMessage := func(seq uint32, streamSeq uint32, streamFlag wkproto.StreamFlag, payload string) wkdb.Message {
+		return wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				Setting:     wkproto.SettingStream,
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   int64(seq),
+				MessageSeq:  seq,
+				ClientMsgNo: "client",
+				StreamNo:    streamNo,
+				StreamSeq:   streamSeq,
+				StreamFlag:  streamFlag,
+				FromUID:     "bot",
+				Timestamp:   1000,
+				Payload:     []byte(payload),
+			},
+		}
+	}
+
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		newStreamMessage(1, 0, wkproto.StreamFlagStart, "start"),
+		newStreamMessage(2, 1, wkproto.StreamFlagIng, "hello"),
+	})
+	assert.NoError(t, err)
+
+	// 日志提交前流元数据还没写入，但可以拿到已追加的最后一个片段序号
+	_, err = d.GetStreamMeta(channelId, channelType, streamNo)
+	assert.Equal(t, wkdb.ErrNotFound, err)
+	lastStreamSeq, err := d.LastStreamSeq(channelId, channelType, streamNo)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), lastStreamSeq)
+	err = d.ApplyMessages(channelId, channelType, 1, 3)
+	assert.NoError(t, err)
+
+	meta, err := d.GetStreamMeta(channelId, channelType, streamNo)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), meta.MessageSeq)
+	assert.Equal(t, "bot", meta.FromUid)
+	assert.Equal(t, uint32(1), meta.LastStreamSeq)
+	assert.Equal(t, wkproto.StreamFlagIng, meta.StreamFlag)
+
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		newStreamMessage(3, 2, wkproto.StreamFlagIng, " world"),
+		newStreamMessage(4, 3, wkproto.StreamFlagEnd, ""),
+		newStreamMessage(5, 4, wkproto.StreamFlagIng, "ignored"), // 流结束后的片段忽略
+	})
+	assert.NoError(t, err)
+	lastStreamSeq, err = d.LastStreamSeq(channelId, channelType, streamNo)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), lastStreamSeq)
+	err = d.ApplyMessages(channelId, channelType, 3, 6)
+	assert.NoError(t, err)
+
+	meta, err = d.GetStreamMeta(channelId, channelType, streamNo)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), meta.LastStreamSeq)
+	assert.Equal(t, wkproto.StreamFlagEnd, meta.StreamFlag)
+
+	items, err := d.GetStreamItems(channelId, channelType, streamNo)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, uint32(1), items[0].StreamSeq)
+	assert.Equal(t, []byte("hello"), items[0].Blob)
+	assert.Equal(t, uint64(3), items[1].MessageSeq)
+	assert.Equal(t, []byte(" world"), items[1].Blob)
+
+	// 消息本身也保存了流信息
+	msg, err := d.LoadMsg(channelId, channelType, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, streamNo, msg.StreamNo)
+	assert.Equal(t, uint32(2), msg.StreamSeq)
+	assert.Equal(t, wkproto.StreamFlagIng, msg.StreamFlag)
+
+	_, err = d.GetStreamMeta(channelId, channelType, "notexist")
+	assert.Equal(t, wkdb.ErrNotFound, err)
+}
@@ -2,6 +2,7 @@ package wkdb_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
@@ -56,6 +57,47 @@ func TestLoadPrevRangeMsgs(t *testing.T) {
 
 }
 
+func TestLoadPrevRangeMsgsSkipExpired(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "channel"
+	channelType := uint8(2)
+	now := time.Now()
+
+	num := 1100
+	messages := make([]wkdb.Message, 0, num)
+	for i := 0; i < num; i++ {
+		var expire uint32
+		if i >= 50 {
+			expire = 10 // 前50条之后的消息都已过期
+		}
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageSeq: uint32(i + 1), Timestamp: int32(now.Add(-time.Minute).Unix()), Expire: expire, Payload: []byte("hello")},
+		})
+	}
+	err = d.AppendMessages(channelId, channelType, messages)
+	assert.NoError(t, err)
+
+	// 跳过的过期消息不计入limit
+	resultMessages, err := d.LoadPrevRangeMsgs(channelId, channelType, 900, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, resultMessages, 10)
+	assert.Equal(t, uint32(41), resultMessages[0].MessageSeq)
+	assert.Equal(t, uint32(50), resultMessages[9].MessageSeq)
+
+	// 最多跳过prevRangeMaxExpiredScan条过期消息，不会遍历整个频道
+	resultMessages, err = d.LoadPrevRangeMsgs(channelId, channelType, uint64(num), 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, resultMessages, 0)
+}
+
 func TestGetChannelMaxMessageSeq(t *testing.T) {
 	d := newTestDB(t)
 	err := d.Open()
@@ -210,3 +252,226 @@ func TestSearchMessages(t *testing.T) {
 	assert.Equal(t, 10, len(resultMessages))
 
 }
+
+func TestExpiredMessages(t *testing.T) {
+	removedBytes := make(map[string]int64)
+	d := newTestDB(t, wkdb.WithOnPayloadRemoved(func(channelId string, channelType uint8, bytes int64) {
+		removedBytes[channelId] += bytes
+	}))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	messages := []wkdb.Message{}
+
+	channelId := "channel"
+	channelType := uint8(2)
+
+	num := 10
+	now := time.Now()
+
+	for i := 0; i < num; i++ {
+		var expire uint32
+		if i < 5 {
+			expire = 10 // 前5条消息已过期
+		}
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				ChannelID:   channelId,
+				ChannelType: channelType,
+				MessageID:   int64(i + 1),
+				MessageSeq:  uint32(i + 1),
+				Timestamp:   int32(now.Add(-time.Minute).Unix()),
+				Expire:      expire,
+				Payload:     []byte("hello"),
+			},
+		})
+	}
+
+	err = d.AppendMessages(channelId, channelType, messages)
+	assert.NoError(t, err)
+
+	resultMessages, err := d.LoadNextRangeMsgs(channelId, channelType, 1, 0, 3)
+	assert.NoError(t, err)
+	assert.Len(t, resultMessages, 3)
+	assert.Equal(t, uint32(6), resultMessages[0].MessageSeq)
+
+	resultMessages, err = d.LoadLastMsgs(channelId, channelType, num)
+	assert.NoError(t, err)
+	assert.Len(t, resultMessages, 5)
+
+	count, err := d.PurgeExpiredMessages(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, int64(25), removedBytes[channelId]) // 清理的内容字节数需要回调，用于扣减租户存储用量
+
+	_, err = d.GetMessage(1)
+	assert.Equal(t, wkdb.ErrNotFound, err)
+
+	msg, err := d.GetMessage(6)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+
+	// 已清理过的消息不会重复清理
+	count, err = d.PurgeExpiredMessages(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, int64(25), removedBytes[channelId])
+
+	// 清理后频道日志依然连续，过期消息只抹掉了payload
+	logs, err := d.LoadNextRangeMsgsForSize(channelId, channelType, 1, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, logs, num)
+	assert.Len(t, logs[0].Payload, 0)
+	assert.Equal(t, []byte("hello"), logs[5].Payload)
+
+	// 末尾的过期消息不计入limit
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 11, MessageSeq: 11, Timestamp: int32(now.Add(-time.Minute).Unix()), Expire: 10, Payload: []byte("hello")}},
+		{RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 12, MessageSeq: 12, Timestamp: int32(now.Add(-time.Minute).Unix()), Expire: 10, Payload: []byte("hello")}},
+	})
+	assert.NoError(t, err)
+	resultMessages, err = d.LoadLastMsgs(channelId, channelType, 2)
+	assert.NoError(t, err)
+	assert.Len(t, resultMessages, 2)
+	assert.Equal(t, uint32(9), resultMessages[0].MessageSeq)
+	assert.Equal(t, uint32(10), resultMessages[1].MessageSeq)
+}
+
+func TestMessageOp(t *testing.T) {
+	var removedBytes int64
+	d := newTestDB(t, wkdb.WithOnPayloadRemoved(func(channelId string, channelType uint8, bytes int64) {
+		removedBytes += bytes
+	}))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "channel"
+	channelType := uint8(2)
+
+	messages := []wkdb.Message{
+		{
+			RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 1, MessageSeq: 1, FromUID: "u1", Payload: []byte("hello")},
+		},
+		{
+			RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 2, MessageSeq: 2, FromUID: "u1", Payload: []byte("world")},
+		},
+		// 同一批次内编辑
+		{
+			RecvPacket:  wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 3, MessageSeq: 3, FromUID: "u1", Timestamp: 100, Payload: []byte("hello2")},
+			OpType:      wkdb.MessageOpEdit,
+			OpTargetSeq: 1,
+		},
+	}
+	err = d.AppendMessages(channelId, channelType, messages)
+	assert.NoError(t, err)
+
+	// 操作在日志提交后才应用
+	msg, err := d.LoadMsg(channelId, channelType, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+	err = d.ApplyMessages(channelId, channelType, 1, 4)
+	assert.NoError(t, err)
+	appliedIndex, err := d.GetChannelAppliedIndex(channelId, channelType)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), appliedIndex)
+
+	msg, err = d.LoadMsg(channelId, channelType, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello2"), msg.Payload)
+
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{
+			RecvPacket:  wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 4, MessageSeq: 4, FromUID: "admin", Timestamp: 200},
+			OpType:      wkdb.MessageOpRevoke,
+			OpTargetSeq: 1,
+		},
+	})
+	assert.NoError(t, err)
+	err = d.ApplyMessages(channelId, channelType, 4, 5)
+	assert.NoError(t, err)
+
+	msg, err = d.LoadMsg(channelId, channelType, 1)
+	assert.NoError(t, err)
+	assert.Len(t, msg.Payload, 0) // 撤回后不保留内容
+	assert.Equal(t, int64(12), removedBytes)
+	assert.True(t, msg.Revoke)
+	assert.Equal(t, uint32(2), msg.EditVersion)
+	assert.Equal(t, "admin", msg.EditorUid)
+	assert.Equal(t, int64(200), msg.EditedAt)
+
+	msgs, err := d.LoadNextRangeMsgsForSize(channelId, channelType, 1, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 4)
+	assert.Equal(t, wkdb.MessageOpEdit, msgs[2].OpType)
+	assert.Equal(t, uint64(1), msgs[2].OpTargetSeq)
+	assert.Len(t, msgs[2].Payload, 0) // 编辑操作里的内容也被抹掉
+	assert.Equal(t, []byte("world"), msgs[1].Payload)
+
+	// 操作信息需要随日志同步到副本
+	data, err := msgs[3].Marshal()
+	assert.NoError(t, err)
+	var m wkdb.Message
+	err = m.Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, wkdb.MessageOpRevoke, m.OpType)
+	assert.Equal(t, uint64(1), m.OpTargetSeq)
+}
+
+func TestTruncateMessageOp(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "channel"
+	channelType := uint8(2)
+
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 1, MessageSeq: 1, FromUID: "u1", Payload: []byte("hello")}},
+	})
+	assert.NoError(t, err)
+	err = d.ApplyMessages(channelId, channelType, 1, 2)
+	assert.NoError(t, err)
+
+	// 没有提交的编辑被截断（领导变更后副本截断分歧的日志），目标消息不受影响
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{
+			RecvPacket:  wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 2, MessageSeq: 2, FromUID: "u1", Payload: []byte("hello2")},
+			OpType:      wkdb.MessageOpEdit,
+			OpTargetSeq: 1,
+		},
+	})
+	assert.NoError(t, err)
+	err = d.TruncateLogTo(channelId, channelType, 2)
+	assert.NoError(t, err)
+
+	msg, err := d.LoadMsg(channelId, channelType, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+	assert.Equal(t, uint32(0), msg.EditVersion)
+
+	// 新领导的日志提交后正常应用
+	err = d.AppendMessages(channelId, channelType, []wkdb.Message{
+		{RecvPacket: wkproto.RecvPacket{ChannelID: channelId, ChannelType: channelType, MessageID: 3, MessageSeq: 2, FromUID: "u1", Payload: []byte("world")}},
+	})
+	assert.NoError(t, err)
+	err = d.ApplyMessages(channelId, channelType, 2, 3)
+	assert.NoError(t, err)
+	msg, err = d.LoadMsg(channelId, channelType, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+}
@@ -1,9 +1,203 @@
 package wkdb
 
+import (
+	"math"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+// AppendMessagesOfUserQueue 向用户队列里追加消息
+// 每个用户的队列有自己递增的序号，消息的MessageSeq依然是频道内的序号
 func (wk *wukongDB) AppendMessagesOfUserQueue(uid string, messages []Message) error {
-	return nil
+	if len(messages) == 0 {
+		return nil
+	}
+
+	wk.dblock.userQueueLock.lock(uid)
+	defer wk.dblock.userQueueLock.unlock(uid)
+
+	db := wk.shardDB(uid)
+
+	lastSeq, err := wk.getUserQueueColumn(db, uid, key.TableMessageUserQueue.Column.LastSeq)
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	if lastSeq == 0 { // 第一次写入队列时记录uid
+		if err = batch.Set(key.NewMessageUserQueueColumnKey(uid, key.TableMessageUserQueue.Column.Uid), []byte(uid), wk.noSync); err != nil {
+			return err
+		}
+		if err = wk.writeSlotIndexOfUid(uid, batch); err != nil {
+			return err
+		}
+	}
+	for _, msg := range messages {
+		lastSeq++
+		data, err := msg.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(key.NewMessageUserQueueKey(uid, lastSeq), data, wk.noSync); err != nil {
+			return err
+		}
+	}
+	if err = wk.setUserQueueColumn(batch, uid, key.TableMessageUserQueue.Column.LastSeq, lastSeq); err != nil {
+		return err
+	}
+	return batch.Commit(wk.sync)
+}
+
+// LoadMessagesOfUserQueue 获取用户队列里序号大于等于startMessageSeq的消息，limit=0表示不限制
+func (wk *wukongDB) LoadMessagesOfUserQueue(uid string, startMessageSeq uint64, limit int) ([]Message, error) {
+	return wk.loadMessagesOfUserQueue(wk.shardDB(uid), uid, startMessageSeq, limit)
+}
+
+func (wk *wukongDB) loadMessagesOfUserQueue(r pebble.Reader, uid string, startMessageSeq uint64, limit int) ([]Message, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageUserQueueKey(uid, startMessageSeq),
+		UpperBound: key.NewMessageUserQueueKey(uid, math.MaxUint64),
+	})
+	defer iter.Close()
+
+	msgs := make([]Message, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		queueSeq, err := key.ParseMessageUserQueueKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := msg.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		msg.QueueSeq = queueSeq
+		msgs = append(msgs, msg)
+		if limit > 0 && len(msgs) >= limit {
+			break
+		}
+	}
+	return msgs, nil
+}
+
+// GetMessageOfUserQueueCursor 获取用户队列的游标（用户已确认到的序号）
+func (wk *wukongDB) GetMessageOfUserQueueCursor(uid string) (uint64, error) {
+	return wk.getUserQueueColumn(wk.shardDB(uid), uid, key.TableMessageUserQueue.Column.Cursor)
 }
 
+// GetMessageOfUserQueueLastSeq 获取用户队列的最大序号
+func (wk *wukongDB) GetMessageOfUserQueueLastSeq(uid string) (uint64, error) {
+	return wk.getUserQueueColumn(wk.shardDB(uid), uid, key.TableMessageUserQueue.Column.LastSeq)
+}
+
+// UpdateMessageOfUserQueueCursorIfNeed 如果messageSeq大于当前游标则更新游标，并清理已确认的消息
 func (wk *wukongDB) UpdateMessageOfUserQueueCursorIfNeed(uid string, messageSeq uint64) error {
+	wk.dblock.userQueueLock.lock(uid)
+	defer wk.dblock.userQueueLock.unlock(uid)
+
+	db := wk.shardDB(uid)
+
+	cursor, err := wk.getUserQueueColumn(db, uid, key.TableMessageUserQueue.Column.Cursor)
+	if err != nil {
+		return err
+	}
+	if messageSeq <= cursor {
+		return nil
+	}
+	lastSeq, err := wk.getUserQueueColumn(db, uid, key.TableMessageUserQueue.Column.LastSeq)
+	if err != nil {
+		return err
+	}
+	if messageSeq > lastSeq { // 游标不能超过队列的最大序号
+		messageSeq = lastSeq
+	}
+	if messageSeq <= cursor {
+		return nil
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	if err = wk.setUserQueueColumn(batch, uid, key.TableMessageUserQueue.Column.Cursor, messageSeq); err != nil {
+		return err
+	}
+	// 已确认的消息不再需要
+	if err = batch.DeleteRange(key.NewMessageUserQueueKey(uid, 0), key.NewMessageUserQueueKey(uid, messageSeq+1), wk.noSync); err != nil {
+		return err
+	}
+	return batch.Commit(wk.sync)
+}
+
+// RestoreMessagesOfUserQueue 用快照里的数据重置用户队列（消息的QueueSeq为队列内的序号）
+func (wk *wukongDB) RestoreMessagesOfUserQueue(uid string, cursor uint64, lastSeq uint64, messages []Message) error {
+	wk.dblock.userQueueLock.lock(uid)
+	defer wk.dblock.userQueueLock.unlock(uid)
+
+	batch := wk.shardDB(uid).NewBatch()
+	defer batch.Close()
+	if err := batch.DeleteRange(key.NewMessageUserQueueKey(uid, 0), key.NewMessageUserQueueKey(uid, math.MaxUint64), wk.noSync); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		data, err := msg.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(key.NewMessageUserQueueKey(uid, msg.QueueSeq), data, wk.noSync); err != nil {
+			return err
+		}
+	}
+	if err := batch.Set(key.NewMessageUserQueueColumnKey(uid, key.TableMessageUserQueue.Column.Uid), []byte(uid), wk.noSync); err != nil {
+		return err
+	}
+	if err := wk.writeSlotIndexOfUid(uid, batch); err != nil {
+		return err
+	}
+	if err := wk.setUserQueueColumn(batch, uid, key.TableMessageUserQueue.Column.Cursor, cursor); err != nil {
+		return err
+	}
+	if err := wk.setUserQueueColumn(batch, uid, key.TableMessageUserQueue.Column.LastSeq, lastSeq); err != nil {
+		return err
+	}
+	return batch.Commit(wk.sync)
+}
+
+// forEachUserQueue 遍历r里所有用户队列的uid
+func (wk *wukongDB) forEachUserQueue(r pebble.Reader, fnc func(uid string) error) error {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewMessageUserQueueColumnLowKey(),
+		UpperBound: key.NewMessageUserQueueColumnHighKey(),
+	})
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		columnName, err := key.ParseMessageUserQueueColumnKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if columnName != key.TableMessageUserQueue.Column.Uid {
+			continue
+		}
+		if err = fnc(string(iter.Value())); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (wk *wukongDB) getUserQueueColumn(r pebble.Reader, uid string, columnName [2]byte) (uint64, error) {
+	result, closer, err := r.Get(key.NewMessageUserQueueColumnKey(uid, columnName))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer closer.Close()
+	return wk.endian.Uint64(result), nil
+}
+
+func (wk *wukongDB) setUserQueueColumn(w pebble.Writer, uid string, columnName [2]byte, value uint64) error {
+	data := make([]byte, 8)
+	wk.endian.PutUint64(data, value)
+	return w.Set(key.NewMessageUserQueueColumnKey(uid, columnName), data, wk.noSync)
+}
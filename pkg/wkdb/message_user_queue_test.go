@@ -1 +1,77 @@
 package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendMessagesOfUserQueue(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	uid := "u1"
+	messages := make([]wkdb.Message, 0)
+	for i := 0; i < 5; i++ {
+		messages = append(messages, wkdb.Message{
+			RecvPacket: wkproto.RecvPacket{
+				Framer:      wkproto.Framer{SyncOnce: true},
+				MessageID:   int64(i + 1),
+				MessageSeq:  uint32(100 + i), // 频道内的序号保持不变
+				ChannelID:   "cmd",
+				ChannelType: 2,
+				Payload:     []byte("cmd"),
+			},
+		})
+	}
+	err = d.AppendMessagesOfUserQueue(uid, messages)
+	assert.NoError(t, err)
+
+	lastSeq, err := d.GetMessageOfUserQueueLastSeq(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), lastSeq)
+
+	msgs, err := d.LoadMessagesOfUserQueue(uid, 1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, uint64(1), msgs[0].QueueSeq)
+	assert.Equal(t, uint32(100), msgs[0].MessageSeq)
+	assert.Equal(t, int64(1), msgs[0].MessageID)
+	assert.True(t, msgs[0].SyncOnce)
+
+	err = d.UpdateMessageOfUserQueueCursorIfNeed(uid, 3)
+	assert.NoError(t, err)
+
+	cursor, err := d.GetMessageOfUserQueueCursor(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), cursor)
+
+	// 游标不会后退
+	err = d.UpdateMessageOfUserQueueCursorIfNeed(uid, 2)
+	assert.NoError(t, err)
+	cursor, err = d.GetMessageOfUserQueueCursor(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), cursor)
+
+	// 已确认的消息被清理
+	msgs, err = d.LoadMessagesOfUserQueue(uid, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, uint64(4), msgs[0].QueueSeq)
+
+	// 清理后继续追加，序号不重复
+	err = d.AppendMessagesOfUserQueue(uid, messages[:1])
+	assert.NoError(t, err)
+	msgs, err = d.LoadMessagesOfUserQueue(uid, cursor+1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+	assert.Equal(t, uint64(6), msgs[2].QueueSeq)
+}
@@ -23,6 +23,47 @@ func IsEmptyMessage(m Message) bool {
 type Message struct {
 	wkproto.RecvPacket
 	Term uint64 // raft term
+
+	Revoke      bool   // 是否已撤回
+	EditVersion uint32 // 编辑版本（每次撤回或编辑递增）
+	EditorUid   string // 最后一次撤回或编辑的操作者
+	EditedAt    int64  // 最后一次撤回或编辑的时间（unix秒）
+
+	OpType      MessageOpType // 消息操作类型，不为MessageOpNone时表示此消息是对OpTargetSeq消息的操作
+	OpTargetSeq uint64        // 被操作的消息seq
+
+	QueueSeq uint64 // 用户消息队列内的序号（只有从用户消息队列读取的消息才有，不参与编码）
+}
+
+// MessageOpType 消息操作类型
+type MessageOpType uint8
+
+const (
+	MessageOpNone   MessageOpType = iota // 普通消息
+	MessageOpRevoke                      // 撤回消息
+	MessageOpEdit                        // 编辑消息（新内容为操作消息的payload）
+)
+
+// IsOp 是否是操作消息
+func (m *Message) IsOp() bool {
+	return m.OpType != MessageOpNone
+}
+
+// ExpireAt 消息的过期时间点（unix秒），0表示永不过期
+func (m *Message) ExpireAt() uint64 {
+	if m.Expire == 0 {
+		return 0
+	}
+	return uint64(m.Timestamp) + uint64(m.Expire)
+}
+
+// IsExpired 消息在指定时间是否已过期
+func (m *Message) IsExpired(now time.Time) bool {
+	expireAt := m.ExpireAt()
+	if expireAt == 0 {
+		return false
+	}
+	return expireAt <= uint64(now.Unix())
 }
 
 func (m *Message) Unmarshal(data []byte) error {
@@ -51,6 +92,19 @@ func (m *Message) Unmarshal(data []byte) error {
 		return err
 	}
 
+	// 兼容旧数据，旧数据没有操作信息
+	if dec.Len() == 0 {
+		return nil
+	}
+	var opType uint8
+	if opType, err = dec.Uint8(); err != nil {
+		return err
+	}
+	m.OpType = MessageOpType(opType)
+	if m.OpTargetSeq, err = dec.Uint64(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -65,6 +119,10 @@ func (m *Message) Marshal() ([]byte, error) {
 	enc.WriteUint8(wkproto.LatestVersion)
 	enc.WriteBinary(data)
 	enc.WriteUint64(m.Term)
+	if m.IsOp() {
+		enc.WriteUint8(uint8(m.OpType))
+		enc.WriteUint64(m.OpTargetSeq)
+	}
 	return enc.Bytes(), nil
 }
 
@@ -83,6 +141,8 @@ type Device struct {
 	RecvMsgBytes uint64     `json:"recv_msg_bytes,omitempty"` // 接收消息字节数
 	CreatedAt    *time.Time `json:"created_at,omitempty"`     // 创建时间
 	UpdatedAt    *time.Time `json:"updated_at,omitempty"`     // 更新时间
+	PushProvider string     `json:"push_provider,omitempty"`  // 离线推送服务商（apns,fcm等）
+	PushToken    string     `json:"push_token,omitempty"`     // 离线推送token
 }
 
 var EmptyUser = User{}
@@ -99,6 +159,9 @@ type User struct {
 	RecvMsgBytes      uint64     `json:"recv_msg_bytes,omitempty"`      // 接收消息字节数
 	CreatedAt         *time.Time `json:"created_at,omitempty"`          // 创建时间
 	UpdatedAt         *time.Time `json:"updated_at,omitempty"`          // 更新时间
+	PushMute          bool       `json:"push_mute,omitempty"`           // 离线推送免打扰
+	LastSeen          int64      `json:"last_seen,omitempty"`           // 最后在线时间（秒）
+	PresenceHidden    bool       `json:"presence_hidden,omitempty"`     // 是否对订阅者隐藏在线状态
 }
 
 var EmptyChannelInfo = ChannelInfo{}
@@ -115,8 +178,26 @@ type ChannelInfo struct {
 	AllowlistCount  int    `json:"allowlist_count,omitempty"`  // 白名单数量
 	LastMsgSeq      uint64 `json:"last_msg_seq,omitempty"`     // 最新消息序号
 	LastMsgTime     uint64 `json:"last_msg_time,omitempty"`    // 最后一次消息时间
+	SendRateLimit   int    `json:"send_rate_limit,omitempty"`  // 频道每秒允许发送的消息数量，0为使用全局配置
+	SendRateBurst   int    `json:"send_rate_burst,omitempty"`  // 频道允许突发发送的消息数量，0为与SendRateLimit相同
+	// ReplicaCount 频道的副本数量，0为使用全局配置
+	ReplicaCount int `json:"replica_count,omitempty"`
+	// AckMode 频道消息的确认模式
+	AckMode ChannelAckMode `json:"ack_mode,omitempty"`
+	// PreferredLeader 优先作为频道领导的节点，0为不指定
+	PreferredLeader uint64 `json:"preferred_leader,omitempty"`
 }
 
+// ChannelAckMode 频道消息的确认模式，对应replica.AckMode，0为使用默认的确认模式
+type ChannelAckMode uint8
+
+const (
+	ChannelAckModeDefault  ChannelAckMode = iota // 默认（大多数节点确认）
+	ChannelAckModeNone                           // 只需要领导确认
+	ChannelAckModeMajority                       // 大多数节点确认
+	ChannelAckModeAll                            // 所有节点确认
+)
+
 func NewChannelInfo(channelId string, channelType uint8) ChannelInfo {
 	return ChannelInfo{
 		ChannelId:   channelId,
@@ -137,6 +218,11 @@ func (c *ChannelInfo) Marshal() ([]byte, error) {
 	enc.WriteUint8(wkutil.BoolToUint8(c.Ban))
 	enc.WriteUint8(wkutil.BoolToUint8(c.Large))
 	enc.WriteUint8(wkutil.BoolToUint8(c.Disband))
+	enc.WriteUint32(uint32(c.SendRateLimit))
+	enc.WriteUint32(uint32(c.SendRateBurst))
+	enc.WriteUint16(uint16(c.ReplicaCount))
+	enc.WriteUint8(uint8(c.AckMode))
+	enc.WriteUint64(c.PreferredLeader)
 	return enc.Bytes(), nil
 }
 
@@ -166,6 +252,38 @@ func (c *ChannelInfo) Unmarshal(data []byte) error {
 	c.Large = wkutil.Uint8ToBool(large)
 
 	c.Disband = wkutil.Uint8ToBool(disband)
+
+	// 兼容旧数据，旧数据没有限速信息
+	if dec.Len() == 0 {
+		return nil
+	}
+	var sendRateLimit, sendRateBurst uint32
+	if sendRateLimit, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if sendRateBurst, err = dec.Uint32(); err != nil {
+		return err
+	}
+	c.SendRateLimit = int(sendRateLimit)
+	c.SendRateBurst = int(sendRateBurst)
+
+	// 兼容旧数据，旧数据没有副本策略
+	if dec.Len() == 0 {
+		return nil
+	}
+	var replicaCount uint16
+	if replicaCount, err = dec.Uint16(); err != nil {
+		return err
+	}
+	var ackMode uint8
+	if ackMode, err = dec.Uint8(); err != nil {
+		return err
+	}
+	if c.PreferredLeader, err = dec.Uint64(); err != nil {
+		return err
+	}
+	c.ReplicaCount = int(replicaCount)
+	c.AckMode = ChannelAckMode(ackMode)
 	return nil
 }
 
@@ -390,6 +508,8 @@ type ChannelClusterConfig struct {
 	MigrateTo       uint64               `json:"migrate_to,omitempty"`        // 迁移目标
 	Status          ChannelClusterStatus `json:"status,omitempty"`            // 状态
 	ConfVersion     uint64               `json:"conf_version,omitempty"`      // 配置文件版本号
+	AckMode         ChannelAckMode       `json:"ack_mode,omitempty"`          // 消息确认模式
+	PreferredLeader uint64               `json:"preferred_leader,omitempty"`  // 优先作为领导的节点
 
 	version uint16 // 数据协议版本
 }
@@ -408,6 +528,8 @@ func (c *ChannelClusterConfig) Clone() ChannelClusterConfig {
 		MigrateTo:       c.MigrateTo,
 		Status:          c.Status,
 		ConfVersion:     c.ConfVersion,
+		AckMode:         c.AckMode,
+		PreferredLeader: c.PreferredLeader,
 		version:         c.version,
 	}
 }
@@ -459,6 +581,12 @@ func (c *ChannelClusterConfig) Equal(cfg ChannelClusterConfig) bool {
 	if c.ConfVersion != cfg.ConfVersion {
 		return false
 	}
+	if c.AckMode != cfg.AckMode {
+		return false
+	}
+	if c.PreferredLeader != cfg.PreferredLeader {
+		return false
+	}
 	return true
 }
 
@@ -488,6 +616,8 @@ func (c *ChannelClusterConfig) Marshal() ([]byte, error) {
 	enc.WriteUint64(c.MigrateTo)
 	enc.WriteUint8(uint8(c.Status))
 	enc.WriteUint64(c.ConfVersion)
+	enc.WriteUint8(uint8(c.AckMode))
+	enc.WriteUint64(c.PreferredLeader)
 	return enc.Bytes(), nil
 }
 
@@ -557,12 +687,25 @@ func (c *ChannelClusterConfig) Unmarshal(data []byte) error {
 		return err
 	}
 
+	// 兼容旧数据，旧数据没有副本策略
+	if dec.Len() == 0 {
+		return nil
+	}
+	var ackMode uint8
+	if ackMode, err = dec.Uint8(); err != nil {
+		return err
+	}
+	c.AckMode = ChannelAckMode(ackMode)
+	if c.PreferredLeader, err = dec.Uint64(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (c *ChannelClusterConfig) String() string {
-	return fmt.Sprintf("ChannelId: %s, ChannelType: %d, ReplicaMaxCount: %d, Replicas: %v, Learners: %v MigrateFrom: %d MigrateTo: %d LeaderId: %d, Term: %d",
-		c.ChannelId, c.ChannelType, c.ReplicaMaxCount, c.Replicas, c.Learners, c.MigrateFrom, c.MigrateTo, c.LeaderId, c.Term)
+	return fmt.Sprintf("ChannelId: %s, ChannelType: %d, ReplicaMaxCount: %d, Replicas: %v, Learners: %v MigrateFrom: %d MigrateTo: %d LeaderId: %d, Term: %d, AckMode: %d, PreferredLeader: %d",
+		c.ChannelId, c.ChannelType, c.ReplicaMaxCount, c.Replicas, c.Learners, c.MigrateFrom, c.MigrateTo, c.LeaderId, c.Term, c.AckMode, c.PreferredLeader)
 }
 
 // 批量更新会话
@@ -656,3 +799,359 @@ type Channel struct {
 	ChannelId   string `json:"channel_id,omitempty"`
 	ChannelType uint8  `json:"channel_type,omitempty"`
 }
+
+// WebhookEvent webhook事件
+type WebhookEvent struct {
+	Id          uint64 `json:"id,omitempty"`            // 事件id
+	Event       string `json:"event,omitempty"`         // 事件类型
+	Data        []byte `json:"data,omitempty"`          // 事件数据
+	RetryCount  uint32 `json:"retry_count,omitempty"`   // 已重试次数
+	NextRetryAt uint64 `json:"next_retry_at,omitempty"` // 下次发送时间（毫秒）
+	LastError   string `json:"last_error,omitempty"`    // 最后一次发送失败的原因
+	CreatedAt   uint64 `json:"created_at,omitempty"`    // 创建时间（毫秒）
+	AppId       string `json:"app_id,omitempty"`        // 事件所属的租户，发送到租户的webhook地址
+}
+
+func (w *WebhookEvent) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint64(w.Id)
+	enc.WriteString(w.Event)
+	enc.WriteUint32(w.RetryCount)
+	enc.WriteUint64(w.NextRetryAt)
+	enc.WriteString(w.LastError)
+	enc.WriteUint64(w.CreatedAt)
+	enc.WriteUint32(uint32(len(w.Data)))
+	enc.WriteBytes(w.Data)
+	enc.WriteString(w.AppId)
+	return enc.Bytes(), nil
+}
+
+func (w *WebhookEvent) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if w.Id, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if w.Event, err = dec.String(); err != nil {
+		return err
+	}
+	if w.RetryCount, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if w.NextRetryAt, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if w.LastError, err = dec.String(); err != nil {
+		return err
+	}
+	if w.CreatedAt, err = dec.Uint64(); err != nil {
+		return err
+	}
+	var dataLen uint32
+	if dataLen, err = dec.Uint32(); err != nil {
+		return err
+	}
+	eventData, err := dec.Bytes(int(dataLen))
+	if err != nil {
+		return err
+	}
+	// 这里必须复制一份，data可能是pebble的内存，会被覆盖
+	w.Data = make([]byte, len(eventData))
+	copy(w.Data, eventData)
+	// 兼容旧数据，旧数据没有租户
+	if dec.Len() == 0 {
+		return nil
+	}
+	if w.AppId, err = dec.String(); err != nil {
+		return err
+	}
+	return nil
+}
+
+var EmptyStreamMeta = StreamMeta{}
+
+// StreamMeta 消息流元数据
+type StreamMeta struct {
+	StreamNo      string             `json:"stream_no,omitempty"`       // 流编号
+	ChannelId     string             `json:"channel_id,omitempty"`      // 频道ID
+	ChannelType   uint8              `json:"channel_type,omitempty"`    // 频道类型
+	FromUid       string             `json:"from_uid,omitempty"`        // 发送者
+	ClientMsgNo   string             `json:"client_msg_no,omitempty"`   // 流开始消息的客户端编号
+	MessageId     int64              `json:"message_id,omitempty"`      // 流开始消息的id
+	MessageSeq    uint64             `json:"message_seq,omitempty"`     // 流开始消息的seq
+	LastStreamSeq uint32             `json:"last_stream_seq,omitempty"` // 最后一个片段的序号
+	StreamFlag    wkproto.StreamFlag `json:"stream_flag,omitempty"`     // 流状态
+	CreatedAt     int64              `json:"created_at,omitempty"`      // 创建时间（unix秒）
+}
+
+func (s *StreamMeta) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(s.StreamNo)
+	enc.WriteString(s.ChannelId)
+	enc.WriteUint8(s.ChannelType)
+	enc.WriteString(s.FromUid)
+	enc.WriteString(s.ClientMsgNo)
+	enc.WriteInt64(s.MessageId)
+	enc.WriteUint64(s.MessageSeq)
+	enc.WriteUint32(s.LastStreamSeq)
+	enc.WriteUint8(uint8(s.StreamFlag))
+	enc.WriteInt64(s.CreatedAt)
+	return enc.Bytes(), nil
+}
+
+func (s *StreamMeta) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if s.StreamNo, err = dec.String(); err != nil {
+		return err
+	}
+	if s.ChannelId, err = dec.String(); err != nil {
+		return err
+	}
+	if s.ChannelType, err = dec.Uint8(); err != nil {
+		return err
+	}
+	if s.FromUid, err = dec.String(); err != nil {
+		return err
+	}
+	if s.ClientMsgNo, err = dec.String(); err != nil {
+		return err
+	}
+	if s.MessageId, err = dec.Int64(); err != nil {
+		return err
+	}
+	if s.MessageSeq, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if s.LastStreamSeq, err = dec.Uint32(); err != nil {
+		return err
+	}
+	var streamFlag uint8
+	if streamFlag, err = dec.Uint8(); err != nil {
+		return err
+	}
+	s.StreamFlag = wkproto.StreamFlag(streamFlag)
+	if s.CreatedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StreamItem 消息流片段
+type StreamItem struct {
+	StreamSeq   uint32 `json:"stream_seq,omitempty"`    // 流序号
+	ClientMsgNo string `json:"client_msg_no,omitempty"` // 片段消息的客户端编号
+	MessageSeq  uint64 `json:"message_seq,omitempty"`   // 片段消息的seq
+	Blob        []byte `json:"blob,omitempty"`          // 片段内容
+}
+
+func (s *StreamItem) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteUint32(s.StreamSeq)
+	enc.WriteString(s.ClientMsgNo)
+	enc.WriteUint64(s.MessageSeq)
+	enc.WriteUint32(uint32(len(s.Blob)))
+	enc.WriteBytes(s.Blob)
+	return enc.Bytes(), nil
+}
+
+func (s *StreamItem) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if s.StreamSeq, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if s.ClientMsgNo, err = dec.String(); err != nil {
+		return err
+	}
+	if s.MessageSeq, err = dec.Uint64(); err != nil {
+		return err
+	}
+	var blobLen uint32
+	if blobLen, err = dec.Uint32(); err != nil {
+		return err
+	}
+	if s.Blob, err = dec.Bytes(int(blobLen)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadCursor 频道成员的已读位置
+type ReadCursor struct {
+	Uid         string `json:"uid,omitempty"`           // 成员uid
+	ReadedToSeq uint64 `json:"readed_to_seq,omitempty"` // 已读到的消息seq（包含）
+	UpdatedAt   int64  `json:"updated_at,omitempty"`    // 更新时间（unix秒）
+}
+
+func (r *ReadCursor) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(r.Uid)
+	enc.WriteUint64(r.ReadedToSeq)
+	enc.WriteInt64(r.UpdatedAt)
+	return enc.Bytes(), nil
+}
+
+func (r *ReadCursor) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if r.Uid, err = dec.String(); err != nil {
+		return err
+	}
+	if r.ReadedToSeq, err = dec.Uint64(); err != nil {
+		return err
+	}
+	if r.UpdatedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TokenDeny 设备token的拒绝名单（设备token为jwt时使用）
+type TokenDeny struct {
+	Uid      string `json:"uid,omitempty"`       // 用户uid
+	Jti      string `json:"jti,omitempty"`       // token的唯一id，为空表示拒绝用户在DeniedAt之前签发的所有token
+	DeniedAt int64  `json:"denied_at,omitempty"` // 加入拒绝名单的时间（unix毫秒）
+	ExpireAt int64  `json:"expire_at,omitempty"` // 过期时间（unix秒），一般为token的过期时间，0表示不过期
+}
+
+// Expired 是否已过期
+func (t TokenDeny) Expired(now int64) bool {
+	return t.ExpireAt > 0 && t.ExpireAt <= now
+}
+
+func (t *TokenDeny) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(t.Uid)
+	enc.WriteString(t.Jti)
+	enc.WriteInt64(t.DeniedAt)
+	enc.WriteInt64(t.ExpireAt)
+	return enc.Bytes(), nil
+}
+
+func (t *TokenDeny) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if t.Uid, err = dec.String(); err != nil {
+		return err
+	}
+	if t.Jti, err = dec.String(); err != nil {
+		return err
+	}
+	if t.DeniedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	if t.ExpireAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// APIKey 调用http api的密钥
+type APIKey struct {
+	KeyId       string `json:"key_id,omitempty"`      // 密钥id（密钥的公开部分）
+	SecretHash  string `json:"-"`                     // 密钥的sha256（不保存明文）
+	Name        string `json:"name,omitempty"`        // 名称
+	Permissions string `json:"permissions,omitempty"` // 权限 格式 resource:actions,resource:actions 例如 message:rw,channelInfo:r
+	CreatedAt   int64  `json:"created_at,omitempty"`  // 创建时间（unix秒）
+	RotatedAt   int64  `json:"rotated_at,omitempty"`  // 最后一次轮换时间（unix秒）
+	ExpireAt    int64  `json:"expire_at,omitempty"`   // 过期时间（unix秒），0表示不过期
+	RevokedAt   int64  `json:"revoked_at,omitempty"`  // 吊销时间（unix秒），0表示未吊销
+	AppId       string `json:"app_id,omitempty"`      // 所属租户，不为空时只能访问此租户的用户和频道
+}
+
+// Valid 密钥是否可用（未吊销且未过期）
+func (a APIKey) Valid(now int64) bool {
+	if a.RevokedAt > 0 {
+		return false
+	}
+	return a.ExpireAt == 0 || a.ExpireAt > now
+}
+
+func (a *APIKey) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(a.KeyId)
+	enc.WriteString(a.SecretHash)
+	enc.WriteString(a.Name)
+	enc.WriteString(a.Permissions)
+	enc.WriteInt64(a.CreatedAt)
+	enc.WriteInt64(a.RotatedAt)
+	enc.WriteInt64(a.ExpireAt)
+	enc.WriteInt64(a.RevokedAt)
+	enc.WriteString(a.AppId)
+	return enc.Bytes(), nil
+}
+
+func (a *APIKey) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if a.KeyId, err = dec.String(); err != nil {
+		return err
+	}
+	if a.SecretHash, err = dec.String(); err != nil {
+		return err
+	}
+	if a.Name, err = dec.String(); err != nil {
+		return err
+	}
+	if a.Permissions, err = dec.String(); err != nil {
+		return err
+	}
+	if a.CreatedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	if a.RotatedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	if a.ExpireAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	if a.RevokedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	// 兼容旧数据，旧数据没有租户
+	if dec.Len() == 0 {
+		return nil
+	}
+	if a.AppId, err = dec.String(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TenantUsage 租户的资源使用量
+type TenantUsage struct {
+	AppId        string `json:"app_id"`
+	StorageBytes int64  `json:"storage_bytes"` // 已存储的消息字节数
+	UpdatedAt    int64  `json:"updated_at"`    // 更新时间（unix秒）
+}
+
+func (t *TenantUsage) Marshal() ([]byte, error) {
+	enc := wkproto.NewEncoder()
+	defer enc.End()
+	enc.WriteString(t.AppId)
+	enc.WriteInt64(t.StorageBytes)
+	enc.WriteInt64(t.UpdatedAt)
+	return enc.Bytes(), nil
+}
+
+func (t *TenantUsage) Unmarshal(data []byte) error {
+	dec := wkproto.NewDecoder(data)
+	var err error
+	if t.AppId, err = dec.String(); err != nil {
+		return err
+	}
+	if t.StorageBytes, err = dec.Int64(); err != nil {
+		return err
+	}
+	if t.UpdatedAt, err = dec.Int64(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package wkdb
 
+import "time"
+
 type Options struct {
 	NodeId            uint64
 	DataDir           string
@@ -7,8 +9,15 @@ type Options struct {
 	SlotCount         int // 槽位数量
 	// 耗时配置开启
 	EnableCost   bool
-	ShardNum     int               // 数据库分区数量，一但设置就不能修改
+	ShardNum     int               // 数据库分区数量，修改需要先停止服务并执行 wk db reshard
 	IsCmdChannel func(string) bool // 是否是cmd频道
+
+	ExpireCheckInterval time.Duration // 过期消息的检查间隔
+	ExpireBatchSize     int           // 每次最多清理的过期消息数量
+
+	MessageSearchIndexOn bool // 是否开启消息全文检索的倒排索引
+
+	OnPayloadRemoved func(channelId string, channelType uint8, bytes int64) // 消息内容被清理（过期、撤回）后回调清理的字节数，每个副本都会回调
 }
 
 func NewOptions(opt ...Option) *Options {
@@ -18,6 +27,9 @@ func NewOptions(opt ...Option) *Options {
 		SlotCount:         128,
 		EnableCost:        true,
 		ShardNum:          16,
+
+		ExpireCheckInterval: time.Minute,
+		ExpireBatchSize:     1000,
 	}
 	for _, f := range opt {
 		f(o)
@@ -68,3 +80,22 @@ func WithIsCmdChannel(f func(string) bool) Option {
 		o.IsCmdChannel = f
 	}
 }
+
+func WithExpireCheckInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.ExpireCheckInterval = interval
+	}
+}
+
+// WithMessageSearchIndexOn 开启后写消息时会同时写入倒排索引，已有消息需要通过RebuildMessageSearchIndex重建
+func WithMessageSearchIndexOn(on bool) Option {
+	return func(o *Options) {
+		o.MessageSearchIndexOn = on
+	}
+}
+
+func WithOnPayloadRemoved(f func(channelId string, channelType uint8, bytes int64)) Option {
+	return func(o *Options) {
+		o.OnPayloadRemoved = f
+	}
+}
@@ -0,0 +1,96 @@
+package wkdb
+
+import (
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+func (wk *wukongDB) UpdateReadCursors(channelId string, channelType uint8, cursors []ReadCursor) error {
+	if len(cursors) == 0 {
+		return nil
+	}
+	db := wk.channelDb(channelId, channelType)
+
+	// 同一个uid只保留最大的已读位置
+	maxCursors := make(map[string]ReadCursor, len(cursors))
+	for _, cursor := range cursors {
+		if cursor.Uid == "" {
+			continue
+		}
+		if exist, ok := maxCursors[cursor.Uid]; ok && exist.ReadedToSeq >= cursor.ReadedToSeq {
+			continue
+		}
+		maxCursors[cursor.Uid] = cursor
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	if err := wk.writeSlotIndexOfChannel(channelId, channelType, batch); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, cursor := range maxCursors {
+		cursorKey := key.NewChannelReadCursorKey(channelId, channelType, cursor.Uid)
+		old, err := wk.getReadCursor(cursorKey, db)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err == nil && old.ReadedToSeq >= cursor.ReadedToSeq { // 已读位置只增不减
+			continue
+		}
+		if cursor.UpdatedAt == 0 {
+			cursor.UpdatedAt = now
+		}
+		data, err := cursor.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(cursorKey, data, wk.noSync); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+func (wk *wukongDB) GetReadCursors(channelId string, channelType uint8) ([]ReadCursor, error) {
+	return wk.getReadCursors(wk.channelDb(channelId, channelType), channelId, channelType)
+}
+
+func (wk *wukongDB) getReadCursors(r pebble.Reader, channelId string, channelType uint8) ([]ReadCursor, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewChannelReadCursorLowKey(channelId, channelType),
+		UpperBound: key.NewChannelReadCursorHighKey(channelId, channelType),
+	})
+	defer iter.Close()
+
+	cursors := make([]ReadCursor, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		var cursor ReadCursor
+		if err := cursor.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, cursor)
+	}
+	return cursors, nil
+}
+
+func (wk *wukongDB) getReadCursor(cursorKey []byte, r pebble.Reader) (ReadCursor, error) {
+	result, closer, err := r.Get(cursorKey)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return ReadCursor{}, ErrNotFound
+		}
+		return ReadCursor{}, err
+	}
+	defer closer.Close()
+
+	var cursor ReadCursor
+	if err = cursor.Unmarshal(result); err != nil {
+		return ReadCursor{}, err
+	}
+	return cursor, nil
+}
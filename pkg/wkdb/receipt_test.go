@@ -0,0 +1,52 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCursors(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(1)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	channelId := "group1"
+	channelType := uint8(2)
+
+	err = d.UpdateReadCursors(channelId, channelType, []wkdb.ReadCursor{
+		{Uid: "u1", ReadedToSeq: 10},
+		{Uid: "u2", ReadedToSeq: 5},
+		{Uid: "u2", ReadedToSeq: 8},
+	})
+	assert.NoError(t, err)
+
+	// 已读位置只增不减
+	err = d.UpdateReadCursors(channelId, channelType, []wkdb.ReadCursor{
+		{Uid: "u1", ReadedToSeq: 3},
+	})
+	assert.NoError(t, err)
+
+	cursors, err := d.GetReadCursors(channelId, channelType)
+	assert.NoError(t, err)
+	assert.Len(t, cursors, 2)
+
+	cursorMap := make(map[string]uint64)
+	for _, cursor := range cursors {
+		cursorMap[cursor.Uid] = cursor.ReadedToSeq
+		assert.NotZero(t, cursor.UpdatedAt)
+	}
+	assert.Equal(t, uint64(10), cursorMap["u1"])
+	assert.Equal(t, uint64(8), cursorMap["u2"])
+
+	cursors, err = d.GetReadCursors("group2", channelType)
+	assert.NoError(t, err)
+	assert.Len(t, cursors, 0)
+}
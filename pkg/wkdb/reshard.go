@@ -0,0 +1,481 @@
+package wkdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	"github.com/cockroachdb/pebble"
+)
+
+// ReshardBatchSize 重新分区（分片）时每个批次写入的最大字节数，槽日志重新分片也使用
+const ReshardBatchSize = 16 * 1024 * 1024
+
+// ReshardStat 重新分区时一个表迁移的key数量
+type ReshardStat struct {
+	Table string
+	Keys  int
+}
+
+// reshardTableNames 表id对应的表名
+var reshardTableNames = map[[2]byte]string{
+	key.TableMessage.Id:                   "message",
+	key.TableUser.Id:                      "user",
+	key.TableDevice.Id:                    "device",
+	key.TableSubscriber.Id:                "subscriber",
+	key.TableSubscriberChannelRelation.Id: "subscriberChannelRelation",
+	key.TableChannelInfo.Id:               "channelInfo",
+	key.TableDenylist.Id:                  "denylist",
+	key.TableAllowlist.Id:                 "allowlist",
+	key.TableConversation.Id:              "conversation",
+	key.TableMessageNotifyQueue.Id:        "messageNotifyQueue",
+	key.TableChannelClusterConfig.Id:      "channelClusterConfig",
+	key.TableLeaderTermSequence.Id:        "leaderTermSequence",
+	key.TableChannelCommon.Id:             "channelCommon",
+	key.TableSession.Id:                   "session",
+	key.TableTotal.Id:                     "total",
+	key.TableMessageUserQueue.Id:          "messageUserQueue",
+	key.TableMessageSearch.Id:             "messageSearch",
+	key.TableWebhookOutbox.Id:             "webhookOutbox",
+	key.TableWebhookDeadLetter.Id:         "webhookDeadLetter",
+	key.TableStreamMeta.Id:                "streamMeta",
+	key.TableStreamItem.Id:                "streamItem",
+	key.TableChannelReadCursor.Id:         "channelReadCursor",
+	key.TableTokenDeny.Id:                 "tokenDeny",
+	key.TableAPIKey.Id:                    "apiKey",
+	key.TableTenantUsage.Id:               "tenantUsage",
+	key.TableSlotIndex.Id:                 "slotIndex",
+}
+
+// Reshard 离线将srcDir下from个分区的数据按原来的路由规则（频道数据按频道hash，用户数据按uid的fnv）重新分配到dstDir下的to个分区，
+// 迁移后校验每个表的key数量和TotalDB的统计数量一致，dstDir必须不存在，目录的替换由调用方完成
+//
+// 很多表的key里只有uid等字符串的hash，所以会先扫描一遍数据收集uid、频道等原始值，无法确定分区的key会返回错误
+func Reshard(srcDir string, dstDir string, from int, to int) ([]ReshardStat, error) {
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("invalid shard num, from: %d to: %d", from, to)
+	}
+	if _, err := os.Stat(dstDir); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reshard dir %s already exists", dstDir)
+	}
+	src, err := openShards(srcDir, from, true)
+	if err != nil {
+		return nil, err
+	}
+	defer closeShards(src)
+	dst, err := openShards(dstDir, to, false)
+	if err != nil {
+		return nil, err
+	}
+	defer closeShards(dst)
+
+	r := newReshardRouter(uint32(to))
+	for _, db := range src {
+		if err = r.collect(db); err != nil {
+			return nil, err
+		}
+	}
+	r.resolveChannelInfos()
+
+	srcCounts, err := r.copy(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range dst {
+		if err = db.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 校验
+	dstCounts, err := countTableKeys(dst)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]ReshardStat, 0, len(srcCounts))
+	for tableId, name := range reshardTableNames {
+		if srcCounts[tableId] != dstCounts[tableId] {
+			return nil, fmt.Errorf("table %s key count mismatch, source: %d resharded: %d", name, srcCounts[tableId], dstCounts[tableId])
+		}
+		if srcCounts[tableId] > 0 {
+			stats = append(stats, ReshardStat{Table: name, Keys: srcCounts[tableId]})
+		}
+	}
+	if err = verifyTotals(src, dst); err != nil {
+		return nil, err
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Table < stats[j].Table
+	})
+	return stats, nil
+}
+
+func openShards(dir string, shardNum int, readOnly bool) ([]*pebble.DB, error) {
+	dbs := make([]*pebble.DB, 0, shardNum)
+	for i := 0; i < shardNum; i++ {
+		shardDir := filepath.Join(dir, fmt.Sprintf("shard%03d", i))
+		if readOnly {
+			if _, err := os.Stat(shardDir); err != nil {
+				closeShards(dbs)
+				return nil, err
+			}
+		}
+		db, err := pebble.Open(shardDir, &pebble.Options{
+			FormatMajorVersion: pebble.FormatNewest,
+			ReadOnly:           readOnly,
+		})
+		if err != nil {
+			closeShards(dbs)
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+func closeShards(dbs []*pebble.DB) {
+	for _, db := range dbs {
+		_ = db.Close()
+	}
+}
+
+func countTableKeys(dbs []*pebble.DB) (map[[2]byte]int, error) {
+	counts := make(map[[2]byte]int)
+	for _, db := range dbs {
+		iter := db.NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+			k := iter.Key()
+			if len(k) < 2 {
+				continue
+			}
+			counts[[2]byte{k[0], k[1]}]++
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// verifyTotals 校验重新分区前后TotalDB统计的数量一致
+func verifyTotals(src []*pebble.DB, dst []*pebble.DB) error {
+	srcDB := NewWukongDB(NewOptions(WithShardNum(len(src)))).(*wukongDB)
+	srcDB.dbs = src
+	dstDB := NewWukongDB(NewOptions(WithShardNum(len(dst)))).(*wukongDB)
+	dstDB.dbs = dst
+
+	totals := []struct {
+		name string
+		get  func(db TotalDB) (int, error)
+	}{
+		{"message", TotalDB.GetTotalMessageCount},
+		{"user", TotalDB.GetTotalUserCount},
+		{"device", TotalDB.GetTotalDeviceCount},
+		{"session", TotalDB.GetTotalSessionCount},
+		{"channel", TotalDB.GetTotalChannelCount},
+		{"conversation", TotalDB.GetTotalConversationCount},
+		{"channelClusterConfig", TotalDB.GetTotalChannelClusterConfigCount},
+	}
+	for _, total := range totals {
+		srcCount, err := total.get(srcDB)
+		if err != nil {
+			return err
+		}
+		dstCount, err := total.get(dstDB)
+		if err != nil {
+			return err
+		}
+		if srcCount != dstCount {
+			return fmt.Errorf("total %s count mismatch, source: %d resharded: %d", total.name, srcCount, dstCount)
+		}
+	}
+	return nil
+}
+
+// reshardRouter 计算key在新分区中的位置
+type reshardRouter struct {
+	shardNum uint32
+
+	names          map[uint64]string // key.HashWithString(s) -> s，s为uid、频道key、密钥id、租户id
+	userIds        map[uint64]string // 用户主键 -> uid
+	deviceIds      map[uint64]string // 设备主键 -> uid
+	channelInfoIds map[uint64]uint64 // 频道信息主键 -> 频道hash
+
+	channelInfoChannelIds   map[uint64]string // 频道信息主键 -> 频道id
+	channelInfoChannelTypes map[uint64]uint8  // 频道信息主键 -> 频道类型
+	clusterConfigChannelIds map[uint64]string // 频道分布式配置主键 -> 频道id
+	clusterConfigTypes      map[uint64]uint8  // 频道分布式配置主键 -> 频道类型
+}
+
+func newReshardRouter(shardNum uint32) *reshardRouter {
+	return &reshardRouter{
+		shardNum:                shardNum,
+		names:                   make(map[uint64]string),
+		userIds:                 make(map[uint64]string),
+		deviceIds:               make(map[uint64]string),
+		channelInfoIds:          make(map[uint64]uint64),
+		channelInfoChannelIds:   make(map[uint64]string),
+		channelInfoChannelTypes: make(map[uint64]uint8),
+		clusterConfigChannelIds: make(map[uint64]string),
+		clusterConfigTypes:      make(map[uint64]uint8),
+	}
+}
+
+func (r *reshardRouter) addName(s string) {
+	if s == "" {
+		return
+	}
+	r.names[key.HashWithString(s)] = s
+}
+
+// collect 收集确定分区需要的uid、频道等原始值
+func (r *reshardRouter) collect(db *pebble.DB) error {
+	iter := db.NewIter(nil)
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		k, v := iter.Key(), iter.Value()
+		if len(k) < 4 || k[2] != key.DataTypeTable {
+			continue
+		}
+		tableId := [2]byte{k[0], k[1]}
+		switch tableId {
+		case key.TableUser.Id:
+			if len(k) == key.TableUser.Size && column(k, 12) == key.TableUser.Column.Uid {
+				r.userIds[binary.BigEndian.Uint64(k[4:])] = string(v)
+				r.addName(string(v))
+			}
+		case key.TableDevice.Id:
+			if len(k) == key.TableDevice.Size && column(k, 12) == key.TableDevice.Column.Uid {
+				r.deviceIds[binary.BigEndian.Uint64(k[4:])] = string(v)
+				r.addName(string(v))
+			}
+		case key.TableChannelInfo.Id:
+			if len(k) != key.TableChannelInfo.Size {
+				continue
+			}
+			id := binary.BigEndian.Uint64(k[4:])
+			switch column(k, 12) {
+			case key.TableChannelInfo.Column.ChannelId:
+				r.channelInfoChannelIds[id] = string(v)
+			case key.TableChannelInfo.Column.ChannelType:
+				if len(v) > 0 {
+					r.channelInfoChannelTypes[id] = v[0]
+				}
+			}
+		case key.TableChannelClusterConfig.Id:
+			if len(k) != key.TableChannelClusterConfig.Size {
+				continue
+			}
+			id := binary.BigEndian.Uint64(k[4:])
+			switch column(k, 12) {
+			case key.TableChannelClusterConfig.Column.ChannelId:
+				r.clusterConfigChannelIds[id] = string(v)
+			case key.TableChannelClusterConfig.Column.ChannelType:
+				if len(v) > 0 {
+					r.clusterConfigTypes[id] = v[0]
+				}
+			}
+		case key.TableConversation.Id:
+			if len(k) == key.TableConversation.Size && column(k, 20) == key.TableConversation.Column.Uid {
+				r.addName(string(v))
+			}
+		case key.TableSession.Id:
+			if len(k) == key.TableSession.Size && column(k, 20) == key.TableSession.Column.Uid {
+				r.addName(string(v))
+			}
+		case key.TableSubscriber.Id:
+			if len(k) == key.TableSubscriber.Size && column(k, 20) == key.TableSubscriber.Column.Uid {
+				r.addName(string(v))
+			}
+		case key.TableMessage.Id:
+			if len(k) == key.TableMessage.Size && column(k, 20) == key.TableMessage.Column.FromUid {
+				r.addName(string(v))
+			}
+		case key.TableTokenDeny.Id:
+			deny := &TokenDeny{}
+			if err := deny.Unmarshal(v); err != nil {
+				return err
+			}
+			r.addName(deny.Uid)
+		case key.TableAPIKey.Id:
+			apiKey := &APIKey{}
+			if err := apiKey.Unmarshal(v); err != nil {
+				return err
+			}
+			r.addName(apiKey.KeyId)
+		case key.TableTenantUsage.Id:
+			usage := &TenantUsage{}
+			if err := usage.Unmarshal(v); err != nil {
+				return err
+			}
+			r.addName(usage.AppId)
+		}
+	}
+	return nil
+}
+
+// resolveChannelInfos 计算频道信息的频道hash，并收集频道key（领导任期表使用频道key作为分区依据）
+func (r *reshardRouter) resolveChannelInfos() {
+	for id, channelId := range r.channelInfoChannelIds {
+		channelType := r.channelInfoChannelTypes[id]
+		r.channelInfoIds[id] = key.ChannelIdToNum(channelId, channelType)
+		r.addName(wkutil.ChannelToKey(channelId, channelType))
+	}
+	for id, channelId := range r.clusterConfigChannelIds {
+		r.addName(wkutil.ChannelToKey(channelId, r.clusterConfigTypes[id]))
+	}
+}
+
+// copy 将src的所有key写入dst中对应的分区，返回每个表的key数量
+func (r *reshardRouter) copy(src []*pebble.DB, dst []*pebble.DB) (map[[2]byte]int, error) {
+	counts := make(map[[2]byte]int)
+	batches := make([]*pebble.Batch, len(dst))
+	for i, db := range dst {
+		batches[i] = db.NewBatch()
+	}
+	for _, db := range src {
+		iter := db.NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+			k, v := iter.Key(), iter.Value()
+			shardId, err := r.route(k, v)
+			if err != nil {
+				iter.Close()
+				return nil, err
+			}
+			batch := batches[shardId]
+			if err = batch.Set(k, v, nil); err != nil {
+				iter.Close()
+				return nil, err
+			}
+			counts[[2]byte{k[0], k[1]}]++
+			if batch.Len() >= ReshardBatchSize {
+				if err = batch.Commit(pebble.NoSync); err != nil {
+					iter.Close()
+					return nil, err
+				}
+				batches[shardId] = dst[shardId].NewBatch()
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	for _, batch := range batches {
+		if err := batch.Commit(pebble.Sync); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// route key在新分区中的分区号，与wukongDB.channelDb和wukongDB.shardDB的路由规则一致
+func (r *reshardRouter) route(k []byte, v []byte) (uint32, error) {
+	if len(k) < 4 {
+		return 0, fmt.Errorf("invalid key %x", k)
+	}
+	tableId := [2]byte{k[0], k[1]}
+	dataType := k[2]
+	switch tableId {
+	case key.TableMessage.Id:
+		if dataType == key.DataTypeIndex && len(k) == key.TableMessage.IndexSize { // 消息id索引，值为消息主键
+			return r.channelShard(v, 0, k)
+		}
+		if dataType == key.DataTypeTable || dataType == key.DataTypeOther {
+			return r.channelShard(k, 4, k)
+		}
+		return r.channelShard(k, 14, k) // 二级索引，key里包含消息主键
+	case key.TableSubscriber.Id, key.TableDenylist.Id, key.TableAllowlist.Id:
+		if dataType == key.DataTypeIndex {
+			return r.channelShard(k, 6, k)
+		}
+		return r.channelShard(k, 4, k)
+	case key.TableChannelCommon.Id, key.TableMessageSearch.Id, key.TableStreamMeta.Id, key.TableStreamItem.Id, key.TableChannelReadCursor.Id:
+		return r.channelShard(k, 4, k)
+	case key.TableChannelInfo.Id:
+		switch {
+		case dataType == key.DataTypeTable && len(k) == key.TableChannelInfo.Size:
+			return r.channelInfoShard(binary.BigEndian.Uint64(k[4:]), k)
+		case len(k) == key.TableChannelInfo.IndexSize:
+			return r.channelShard(k, 6, k)
+		case len(k) == key.TableChannelInfo.SecondIndexSize:
+			return r.channelInfoShard(binary.BigEndian.Uint64(k[14:]), k)
+		}
+	case key.TableUser.Id:
+		if dataType == key.DataTypeTable && len(k) == key.TableUser.Size {
+			return r.stringShard(r.userIds[binary.BigEndian.Uint64(k[4:])], k)
+		}
+		return r.nameShard(k, 6)
+	case key.TableDevice.Id:
+		if dataType == key.DataTypeTable && len(k) == key.TableDevice.Size {
+			return r.stringShard(r.deviceIds[binary.BigEndian.Uint64(k[4:])], k)
+		}
+		if dataType == key.DataTypeSecondIndex && len(k) == key.TableDevice.SecondIndexSize {
+			return r.stringShard(r.deviceIds[binary.BigEndian.Uint64(k[14:])], k)
+		}
+		return r.nameShard(k, 6)
+	case key.TableConversation.Id, key.TableSession.Id, key.TableMessageUserQueue.Id, key.TableTokenDeny.Id,
+		key.TableLeaderTermSequence.Id, key.TableAPIKey.Id, key.TableTenantUsage.Id:
+		return r.nameShard(k, 4)
+	case key.TableMessageNotifyQueue.Id, key.TableChannelClusterConfig.Id, key.TableTotal.Id,
+		key.TableWebhookOutbox.Id, key.TableWebhookDeadLetter.Id, key.TableSubscriberChannelRelation.Id:
+		return 0, nil // 只存在默认分区
+	case key.TableSlotIndex.Id:
+		if dataType == key.DataTypeOther {
+			return 0, nil
+		}
+		kind, v, channelType, err := key.ParseSlotIndexKey(k)
+		if err != nil {
+			return 0, err
+		}
+		if kind == key.TableSlotIndex.Kind.Channel {
+			return uint32(key.ChannelIdToNum(v, channelType) % uint64(r.shardNum)), nil
+		}
+		return r.stringShard(v, k)
+	}
+	return 0, fmt.Errorf("can not reshard key %x", k)
+}
+
+// channelShard 按data[offset:]的频道hash计算分区
+func (r *reshardRouter) channelShard(data []byte, offset int, k []byte) (uint32, error) {
+	if len(data) < offset+8 {
+		return 0, fmt.Errorf("can not get channel hash of key %x", k)
+	}
+	return uint32(binary.BigEndian.Uint64(data[offset:]) % uint64(r.shardNum)), nil
+}
+
+func (r *reshardRouter) channelInfoShard(id uint64, k []byte) (uint32, error) {
+	channelHash, ok := r.channelInfoIds[id]
+	if !ok {
+		return 0, fmt.Errorf("can not find channel of channel info key %x", k)
+	}
+	return uint32(channelHash % uint64(r.shardNum)), nil
+}
+
+// nameShard 按k[offset:]的字符串hash找到原始值计算分区
+func (r *reshardRouter) nameShard(k []byte, offset int) (uint32, error) {
+	if len(k) < offset+8 {
+		return 0, fmt.Errorf("invalid key %x", k)
+	}
+	return r.stringShard(r.names[binary.BigEndian.Uint64(k[offset:])], k)
+}
+
+func (r *reshardRouter) stringShard(v string, k []byte) (uint32, error) {
+	if v == "" {
+		return 0, fmt.Errorf("can not find the shard key of key %x", k)
+	}
+	if r.shardNum == 1 {
+		return 0, nil
+	}
+	h := fnv.New32()
+	h.Write([]byte(v))
+	return h.Sum32() % r.shardNum, nil
+}
+
+func column(k []byte, offset int) [2]byte {
+	return [2]byte{k[offset], k[offset+1]}
+}
@@ -0,0 +1,92 @@
+package wkdb_test
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshard(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(2)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	num := 20
+	for i := 0; i < num; i++ {
+		uid := fmt.Sprintf("user%d", i)
+		channelId := fmt.Sprintf("group%d", i)
+
+		assert.NoError(t, d.AddOrUpdateUser(wkdb.User{Id: uint64(i + 1), Uid: uid}))
+		assert.NoError(t, d.AddOrUpdateDevice(wkdb.Device{Id: uint64(i + 1), Uid: uid, Token: "token", DeviceFlag: 1}))
+		_, err = d.AddOrUpdateChannel(wkdb.ChannelInfo{ChannelId: channelId, ChannelType: 2})
+		assert.NoError(t, err)
+		assert.NoError(t, d.AddSubscribers(channelId, 2, []string{uid}))
+		assert.NoError(t, d.AppendMessages(channelId, 2, []wkdb.Message{
+			{RecvPacket: wkproto.RecvPacket{MessageID: int64(i + 1), ChannelID: channelId, ChannelType: 2, FromUID: uid, MessageSeq: 1, Payload: []byte("hello")}},
+		}))
+		assert.NoError(t, d.AddOrUpdateConversations(uid, []wkdb.Conversation{{Uid: uid, ChannelId: channelId, ChannelType: 2, ReadedToMsgSeq: 1}}))
+		assert.NoError(t, d.AddTokenDenies([]wkdb.TokenDeny{{Uid: uid, Jti: "jti"}}))
+		assert.NoError(t, d.AddOrUpdateAPIKey(wkdb.APIKey{KeyId: fmt.Sprintf("key%d", i), Name: uid}))
+		assert.NoError(t, d.SetLeaderTermStartIndex(fmt.Sprintf("2&%s", channelId), 1, uint64(i+1)))
+	}
+	assert.NoError(t, d.Close())
+
+	newDir := t.TempDir()
+	stats, err := wkdb.Reshard(path.Join(dir, "wukongimdb"), path.Join(newDir, "wukongimdb"), 2, 3)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stats)
+
+	// 目标目录已存在
+	_, err = wkdb.Reshard(path.Join(dir, "wukongimdb"), path.Join(newDir, "wukongimdb"), 2, 3)
+	assert.Error(t, err)
+
+	// 按新的分区数可以读取所有数据
+	nd := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(newDir), wkdb.WithShardNum(3)))
+	assert.NoError(t, nd.Open())
+	defer nd.Close()
+	for i := 0; i < num; i++ {
+		uid := fmt.Sprintf("user%d", i)
+		channelId := fmt.Sprintf("group%d", i)
+
+		user, err := nd.GetUser(uid)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, user.Uid)
+
+		device, err := nd.GetDevice(uid, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "token", device.Token)
+
+		channel, err := nd.GetChannel(channelId, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, channelId, channel.ChannelId)
+
+		exist, err := nd.ExistSubscriber(channelId, 2, uid)
+		assert.NoError(t, err)
+		assert.True(t, exist)
+
+		msg, err := nd.LoadMsg(channelId, 2, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, msg.FromUID)
+
+		conversation, err := nd.GetConversation(uid, channelId, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), conversation.ReadedToMsgSeq)
+
+		denies, err := nd.GetTokenDenies(uid)
+		assert.NoError(t, err)
+		assert.Len(t, denies, 1)
+
+		apiKey, err := nd.GetAPIKey(fmt.Sprintf("key%d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, uid, apiKey.Name)
+
+		index, err := nd.LeaderTermStartIndex(fmt.Sprintf("2&%s", channelId), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i+1), index)
+	}
+}
@@ -0,0 +1,360 @@
+package wkdb
+
+import (
+	"math"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// 清理槽数据时每批删除的uid或频道数量
+const slotClearBatchSize = 1000
+
+// 补建槽索引时每个批次写入的最大字节数
+const slotIndexBuildBatchSize = 16 * 1024 * 1024
+
+func (wk *wukongDB) uidSlotId(uid string) uint32 {
+	return wkutil.GetSlotNum(int(wk.opts.SlotCount), uid)
+}
+
+// writeSlotIndexOfUid 记录uid所在的槽，和uid的数据写在同一个分区
+func (wk *wukongDB) writeSlotIndexOfUid(uid string, w pebble.Writer) error {
+	return w.Set(key.NewSlotIndexUidKey(wk.uidSlotId(uid), uid), nil, wk.noSync)
+}
+
+// writeSlotIndexOfChannel 记录频道所在的槽，和频道的数据写在同一个分区
+func (wk *wukongDB) writeSlotIndexOfChannel(channelId string, channelType uint8, w pebble.Writer) error {
+	return w.Set(key.NewSlotIndexChannelKey(wk.channelSlotId(channelId, channelType), channelId, channelType), nil, wk.noSync)
+}
+
+// forEachSlotUid 遍历r里槽内的uid
+func (wk *wukongDB) forEachSlotUid(r pebble.Reader, slotId uint32, fnc func(uid string) error) error {
+	return wk.forEachSlotIndex(r, slotId, key.TableSlotIndex.Kind.Uid, func(uid string, _ uint8) error {
+		return fnc(uid)
+	})
+}
+
+// forEachSlotChannel 遍历r里槽内的频道
+func (wk *wukongDB) forEachSlotChannel(r pebble.Reader, slotId uint32, fnc func(channelId string, channelType uint8) error) error {
+	return wk.forEachSlotIndex(r, slotId, key.TableSlotIndex.Kind.Channel, fnc)
+}
+
+func (wk *wukongDB) forEachSlotIndex(r pebble.Reader, slotId uint32, kind byte, fnc func(v string, channelType uint8) error) error {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewSlotIndexLowKey(slotId, kind),
+		UpperBound: key.NewSlotIndexHighKey(slotId, kind),
+	})
+	defer iter.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		_, v, channelType, err := key.ParseSlotIndexKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if err = fnc(v, channelType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildSlotIndexIfNeed 为建立槽索引之前写入的数据补建索引，只会执行一次
+func (wk *wukongDB) buildSlotIndexIfNeed() error {
+	builtKey := key.NewSlotIndexBuiltKey()
+	_, closer, err := wk.defaultShardDB().Get(builtKey)
+	if err == nil {
+		closer.Close()
+		return nil
+	}
+	if err != pebble.ErrNotFound {
+		return err
+	}
+
+	var count int
+	for _, db := range wk.dbs {
+		batch := db.NewBatch()
+		commitIfNeed := func() error {
+			count++
+			if batch.Len() < slotIndexBuildBatchSize {
+				return nil
+			}
+			if err := batch.Commit(wk.noSync); err != nil {
+				return err
+			}
+			batch = db.NewBatch()
+			return nil
+		}
+		addUid := func(uid string) error {
+			if uid == "" {
+				return nil
+			}
+			if err := wk.writeSlotIndexOfUid(uid, batch); err != nil {
+				return err
+			}
+			return commitIfNeed()
+		}
+		err = wk.forEachUser(db, func(u User) error {
+			return addUid(u.Uid)
+		})
+		if err == nil {
+			err = wk.forEachConversation(db, func(c Conversation) error {
+				return addUid(c.Uid)
+			})
+		}
+		if err == nil {
+			err = wk.forEachUserQueue(db, addUid)
+		}
+		if err == nil {
+			var denies []TokenDeny
+			if denies, err = wk.getAllTokenDenies(db); err == nil {
+				for _, deny := range denies {
+					if err = addUid(deny.Uid); err != nil {
+						break
+					}
+				}
+			}
+		}
+		if err == nil {
+			err = wk.forEachChannel(db, func(ch ChannelInfo) error {
+				if err := wk.writeSlotIndexOfChannel(ch.ChannelId, ch.ChannelType, batch); err != nil {
+					return err
+				}
+				return commitIfNeed()
+			})
+		}
+		if err == nil {
+			err = batch.Commit(wk.sync)
+		}
+		batch.Close()
+		if err != nil {
+			return err
+		}
+	}
+	wk.Info("build slot index", zap.Int("count", count))
+	return wk.defaultShardDB().Set(builtKey, nil, wk.sync)
+}
+
+// ClearSlot 删除槽内的所有数据，安装槽快照前调用，保证安装后本地只剩快照里的数据
+func (wk *wukongDB) ClearSlot(slotId uint32) error {
+	for _, db := range wk.dbs {
+		uids := make([]string, 0)
+		channels := make([]Channel, 0)
+		err := wk.forEachSlotUid(db, slotId, func(uid string) error {
+			uids = append(uids, uid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = wk.forEachSlotChannel(db, slotId, func(channelId string, channelType uint8) error {
+			channels = append(channels, Channel{ChannelId: channelId, ChannelType: channelType})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for len(uids) > 0 || len(channels) > 0 {
+			uidCount, channelCount := len(uids), len(channels)
+			if uidCount > slotClearBatchSize {
+				uidCount = slotClearBatchSize
+			}
+			if channelCount > slotClearBatchSize {
+				channelCount = slotClearBatchSize
+			}
+			if err = wk.clearSlotBatch(db, slotId, uids[:uidCount], channels[:channelCount]); err != nil {
+				return err
+			}
+			uids = uids[uidCount:]
+			channels = channels[channelCount:]
+		}
+
+		// api密钥和租户用量按id所在的槽清理
+		apiKeys, err := wk.getAPIKeys(db)
+		if err != nil {
+			return err
+		}
+		for _, apiKey := range apiKeys {
+			if wk.uidSlotId(apiKey.KeyId) != slotId {
+				continue
+			}
+			if err = db.Delete(key.NewAPIKeyKey(apiKey.KeyId), wk.noSync); err != nil {
+				return err
+			}
+		}
+		usages, err := wk.getTenantUsages(db)
+		if err != nil {
+			return err
+		}
+		for _, usage := range usages {
+			if wk.uidSlotId(usage.AppId) != slotId {
+				continue
+			}
+			if err = db.Delete(key.NewTenantUsageKey(usage.AppId), wk.noSync); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 频道分布式配置
+	cfgs, err := wk.GetChannelClusterConfigWithSlotId(slotId)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range cfgs {
+		if err = wk.DeleteChannelClusterConfig(cfg.ChannelId, cfg.ChannelType); err != nil {
+			return err
+		}
+	}
+
+	// 消息通知队列
+	messages, err := wk.getAllMessagesOfNotifyQueue(wk.defaultShardDB())
+	if err != nil {
+		return err
+	}
+	messageIds := make([]int64, 0)
+	for _, msg := range messages {
+		if wk.channelSlotId(msg.ChannelID, msg.ChannelType) == slotId {
+			messageIds = append(messageIds, msg.MessageID)
+		}
+	}
+	if len(messageIds) > 0 {
+		return wk.RemoveMessagesOfNotifyQueue(messageIds)
+	}
+	return nil
+}
+
+// clearSlotBatch 删除db里一批uid和频道的数据以及它们的槽索引
+func (wk *wukongDB) clearSlotBatch(db *pebble.DB, slotId uint32, uids []string, channels []Channel) error {
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	for _, uid := range uids {
+		// 用户
+		id, err := wk.getUserIdWith(db, uid)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			if err = batch.DeleteRange(key.NewUserColumnKey(id, key.MinColumnKey), key.NewUserColumnKey(id, key.MaxColumnKey), wk.noSync); err != nil {
+				return err
+			}
+			if err = batch.Delete(key.NewUserIndexUidKey(uid), wk.noSync); err != nil {
+				return err
+			}
+		}
+		// 设备
+		devices, err := wk.getDevices(db, uid)
+		if err != nil {
+			return err
+		}
+		for _, d := range devices {
+			if err = batch.DeleteRange(key.NewDeviceColumnKey(d.Id, key.MinColumnKey), key.NewDeviceColumnKey(d.Id, key.MaxColumnKey), wk.noSync); err != nil {
+				return err
+			}
+			if err = batch.Delete(key.NewDeviceIndexUidAndDeviceFlagKey(uid, d.DeviceFlag), wk.noSync); err != nil {
+				return err
+			}
+		}
+		// 最近会话
+		conversations, err := wk.getConversations(db, uid)
+		if err != nil {
+			return err
+		}
+		for _, c := range conversations {
+			if err = wk.deleteConversation(uid, c.ChannelId, c.ChannelType, batch); err != nil {
+				return err
+			}
+		}
+		// 用户消息队列
+		if err = batch.DeleteRange(key.NewMessageUserQueueKey(uid, 0), key.NewMessageUserQueueKey(uid, math.MaxUint64), wk.noSync); err != nil {
+			return err
+		}
+		for _, columnName := range [][2]byte{key.TableMessageUserQueue.Column.Uid, key.TableMessageUserQueue.Column.Cursor, key.TableMessageUserQueue.Column.LastSeq} {
+			if err = batch.Delete(key.NewMessageUserQueueColumnKey(uid, columnName), wk.noSync); err != nil {
+				return err
+			}
+		}
+		// token拒绝名单
+		denies, err := wk.getTokenDenies(db, uid)
+		if err != nil {
+			return err
+		}
+		for _, deny := range denies {
+			if err = batch.Delete(key.NewTokenDenyKey(deny.Uid, deny.Jti), wk.noSync); err != nil {
+				return err
+			}
+		}
+		if err = batch.Delete(key.NewSlotIndexUidKey(slotId, uid), wk.noSync); err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range channels {
+		channelId, channelType := ch.ChannelId, ch.ChannelType
+		// 频道信息
+		channelInfo, err := wk.getChannel(db, channelId, channelType)
+		if err != nil {
+			return err
+		}
+		if channelInfo.Id != 0 {
+			if err = wk.deleteChannelInfo(channelInfo, batch); err != nil {
+				return err
+			}
+		}
+		// 订阅者、黑白名单
+		if err = batch.DeleteRange(key.NewSubscriberPrimaryKey(channelId, channelType, 0), key.NewSubscriberPrimaryKey(channelId, channelType, math.MaxUint64), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.DeleteRange(key.NewSubscriberIndexUidLowKey(channelId, channelType), key.NewSubscriberIndexUidHighKey(channelId, channelType), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.DeleteRange(key.NewDenylistPrimaryKey(channelId, channelType, 0), key.NewDenylistPrimaryKey(channelId, channelType, math.MaxUint64), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.DeleteRange(key.NewDenylistIndexUidLowKey(channelId, channelType), key.NewDenylistIndexUidHighKey(channelId, channelType), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.DeleteRange(key.NewAllowlistPrimaryKey(channelId, channelType, 0), key.NewAllowlistPrimaryKey(channelId, channelType, math.MaxUint64), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.DeleteRange(key.NewAllowlistIndexUidLowKey(channelId, channelType), key.NewAllowlistIndexUidHighKey(channelId, channelType), wk.noSync); err != nil {
+			return err
+		}
+		// 已读位置
+		if err = batch.DeleteRange(key.NewChannelReadCursorLowKey(channelId, channelType), key.NewChannelReadCursorHighKey(channelId, channelType), wk.noSync); err != nil {
+			return err
+		}
+		if err = batch.Delete(key.NewSlotIndexChannelKey(slotId, channelId, channelType), wk.noSync); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// deleteChannelInfo 删除频道信息和它的索引
+func (wk *wukongDB) deleteChannelInfo(channelInfo ChannelInfo, w pebble.Writer) error {
+	id := channelInfo.Id
+	if err := w.Delete(key.NewChannelInfoIndexKey(channelInfo.ChannelId, channelInfo.ChannelType), wk.noSync); err != nil {
+		return err
+	}
+	if err := w.DeleteRange(key.NewChannelInfoColumnKey(id, key.MinColumnKey), key.NewChannelInfoColumnKey(id, key.MaxColumnKey), wk.noSync); err != nil {
+		return err
+	}
+	secondIndexes := []struct {
+		name  [2]byte
+		value uint64
+	}{
+		{key.TableChannelInfo.SecondIndex.Ban, uint64(wkutil.BoolToInt(channelInfo.Ban))},
+		{key.TableChannelInfo.SecondIndex.Disband, uint64(wkutil.BoolToInt(channelInfo.Disband))},
+		{key.TableChannelInfo.SecondIndex.SubscriberCount, uint64(channelInfo.SubscriberCount)},
+		{key.TableChannelInfo.SecondIndex.AllowlistCount, uint64(channelInfo.AllowlistCount)},
+		{key.TableChannelInfo.SecondIndex.DenylistCount, uint64(channelInfo.DenylistCount)},
+	}
+	for _, index := range secondIndexes {
+		if err := w.Delete(key.NewChannelInfoSecondIndexKey(index.name, index.value, id), wk.noSync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package wkdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClearSlot(t *testing.T) {
+	slotCount := 8
+	d := newTestDB(t, wkdb.WithShardNum(4), wkdb.WithSlotCount(slotCount))
+	err := d.Open()
+	assert.NoError(t, err)
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	// 找两个不在同一个槽的uid
+	uid1, uid2 := "u1", ""
+	slotId := wkutil.GetSlotNum(slotCount, uid1)
+	for i := 2; uid2 == ""; i++ {
+		if v := fmt.Sprintf("u%d", i); wkutil.GetSlotNum(slotCount, v) != slotId {
+			uid2 = v
+		}
+	}
+	channelId := uid1
+
+	for i, uid := range []string{uid1, uid2} {
+		err = d.AddOrUpdateUser(wkdb.User{Id: uint64(i + 1), Uid: uid})
+		assert.NoError(t, err)
+		err = d.AddOrUpdateDevice(wkdb.Device{Id: uint64(i + 1), Uid: uid, DeviceFlag: 1, Token: "token"})
+		assert.NoError(t, err)
+		err = d.AddOrUpdateConversations(uid, []wkdb.Conversation{{Uid: uid, ChannelId: "g1", ChannelType: 2}})
+		assert.NoError(t, err)
+		err = d.AppendMessagesOfUserQueue(uid, []wkdb.Message{{RecvPacket: wkproto.RecvPacket{MessageID: int64(i + 1), MessageSeq: 1, ChannelID: "cmd", ChannelType: 2}}})
+		assert.NoError(t, err)
+	}
+	_, err = d.AddOrUpdateChannel(wkdb.ChannelInfo{ChannelId: channelId, ChannelType: 2})
+	assert.NoError(t, err)
+	err = d.AddSubscribers(channelId, 2, []string{uid1, uid2})
+	assert.NoError(t, err)
+	err = d.AppendMessageOfNotifyQueue([]wkdb.Message{{RecvPacket: wkproto.RecvPacket{MessageID: 10, MessageSeq: 1, ChannelID: channelId, ChannelType: 2}}})
+	assert.NoError(t, err)
+
+	// 快照按槽索引只遍历槽内的数据
+	snap := d.NewSnapshot()
+	uids := make([]string, 0)
+	err = snap.ForEachSlotUid(slotId, func(uid string) error {
+		uids = append(uids, uid)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{uid1}, uids)
+	channelIds := make([]string, 0)
+	err = snap.ForEachSlotChannel(slotId, func(channelId string, channelType uint8) error {
+		channelIds = append(channelIds, channelId)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{channelId}, channelIds)
+	err = snap.Close()
+	assert.NoError(t, err)
+
+	err = d.ClearSlot(slotId)
+	assert.NoError(t, err)
+
+	// 槽内的数据都被删除
+	_, err = d.GetUser(uid1)
+	assert.Equal(t, wkdb.ErrNotFound, err)
+	devices, err := d.GetDevices(uid1)
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+	conversations, err := d.GetConversations(uid1)
+	assert.NoError(t, err)
+	assert.Empty(t, conversations)
+	lastSeq, err := d.GetMessageOfUserQueueLastSeq(uid1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), lastSeq)
+	channelInfo, err := d.GetChannel(channelId, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), channelInfo.Id)
+	subscribers, err := d.GetSubscribers(channelId, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, subscribers)
+	messages, err := d.GetMessagesOfNotifyQueue(10)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	// 其他槽的数据不受影响
+	u, err := d.GetUser(uid2)
+	assert.NoError(t, err)
+	assert.Equal(t, uid2, u.Uid)
+	conversations, err = d.GetConversations(uid2)
+	assert.NoError(t, err)
+	assert.Len(t, conversations, 1)
+	lastSeq, err = d.GetMessageOfUserQueueLastSeq(uid2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), lastSeq)
+
+	// 清理后重新写入，槽索引也会重新建立
+	err = d.AddOrUpdateUser(wkdb.User{Id: 3, Uid: uid1})
+	assert.NoError(t, err)
+	snap = d.NewSnapshot()
+	defer snap.Close()
+	uids = uids[:0]
+	err = snap.ForEachSlotUid(slotId, func(uid string) error {
+		uids = append(uids, uid)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{uid1}, uids)
+}
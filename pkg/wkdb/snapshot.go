@@ -0,0 +1,200 @@
+package wkdb
+
+import (
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+)
+
+// Snapshot 数据库某一时刻的只读快照，读到的都是创建快照时的数据，使用完后需要Close
+type Snapshot struct {
+	wk    *wukongDB
+	snaps []*pebble.Snapshot
+}
+
+// NewSnapshot 创建所有分区的快照
+func (wk *wukongDB) NewSnapshot() *Snapshot {
+	snaps := make([]*pebble.Snapshot, 0, len(wk.dbs))
+	for _, db := range wk.dbs {
+		snaps = append(snaps, db.NewSnapshot())
+	}
+	return &Snapshot{
+		wk:    wk,
+		snaps: snaps,
+	}
+}
+
+func (s *Snapshot) Close() error {
+	for _, snap := range s.snaps {
+		if err := snap.Close(); err != nil {
+			s.wk.Error("close snapshot error", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) shard(v string) *pebble.Snapshot {
+	return s.snaps[s.wk.shardId(v)]
+}
+
+func (s *Snapshot) channelShard(channelId string, channelType uint8) *pebble.Snapshot {
+	return s.snaps[s.wk.channelDbIndex(channelId, channelType)]
+}
+
+// ForEachUser 遍历快照里的所有用户
+func (s *Snapshot) ForEachUser(fnc func(u User) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachUser(snap, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) GetDevices(uid string) ([]Device, error) {
+	return s.wk.getDevices(s.shard(uid), uid)
+}
+
+// ForEachChannel 遍历快照里的所有频道
+func (s *Snapshot) ForEachChannel(fnc func(channelInfo ChannelInfo) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachChannel(snap, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) GetSubscribers(channelId string, channelType uint8) ([]string, error) {
+	return s.wk.getSubscribers(s.channelShard(channelId, channelType), channelId, channelType)
+}
+
+func (s *Snapshot) GetDenylist(channelId string, channelType uint8) ([]string, error) {
+	return s.wk.getDenylist(s.channelShard(channelId, channelType), channelId, channelType)
+}
+
+func (s *Snapshot) GetAllowlist(channelId string, channelType uint8) ([]string, error) {
+	return s.wk.getAllowlist(s.channelShard(channelId, channelType), channelId, channelType)
+}
+
+func (s *Snapshot) GetReadCursors(channelId string, channelType uint8) ([]ReadCursor, error) {
+	return s.wk.getReadCursors(s.channelShard(channelId, channelType), channelId, channelType)
+}
+
+// ForEachConversation 遍历快照里的所有最近会话，同一个用户的会话是连续的
+func (s *Snapshot) ForEachConversation(fnc func(conversation Conversation) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachConversation(snap, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) GetAllTokenDenies() ([]TokenDeny, error) {
+	denies := make([]TokenDeny, 0)
+	for _, snap := range s.snaps {
+		results, err := s.wk.getAllTokenDenies(snap)
+		if err != nil {
+			return nil, err
+		}
+		denies = append(denies, results...)
+	}
+	return s.wk.filterExpiredTokenDenies(denies), nil
+}
+
+func (s *Snapshot) GetAPIKeys() ([]APIKey, error) {
+	apiKeys := make([]APIKey, 0)
+	for _, snap := range s.snaps {
+		results, err := s.wk.getAPIKeys(snap)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, results...)
+	}
+	return apiKeys, nil
+}
+
+func (s *Snapshot) GetTenantUsages() ([]TenantUsage, error) {
+	usages := make([]TenantUsage, 0)
+	for _, snap := range s.snaps {
+		results, err := s.wk.getTenantUsages(snap)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, results...)
+	}
+	return usages, nil
+}
+
+func (s *Snapshot) GetChannelClusterConfigWithSlotId(slotId uint32) ([]ChannelClusterConfig, error) {
+	return s.wk.getChannelClusterConfigWithSlotId(s.snaps[0], slotId)
+}
+
+// ForEachUserQueue 遍历快照里所有用户消息队列的uid
+func (s *Snapshot) ForEachUserQueue(fnc func(uid string) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachUserQueue(snap, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserQueue 获取用户消息队列的游标、最大序号和未确认的消息（消息的QueueSeq为队列内的序号）
+func (s *Snapshot) GetUserQueue(uid string) (cursor uint64, lastSeq uint64, messages []Message, err error) {
+	snap := s.shard(uid)
+	if cursor, err = s.wk.getUserQueueColumn(snap, uid, key.TableMessageUserQueue.Column.Cursor); err != nil {
+		return
+	}
+	if lastSeq, err = s.wk.getUserQueueColumn(snap, uid, key.TableMessageUserQueue.Column.LastSeq); err != nil {
+		return
+	}
+	messages, err = s.wk.loadMessagesOfUserQueue(snap, uid, cursor+1, 0)
+	return
+}
+
+// ForEachSlotUid 遍历快照里槽内的uid
+func (s *Snapshot) ForEachSlotUid(slotId uint32, fnc func(uid string) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachSlotUid(snap, slotId, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachSlotChannel 遍历快照里槽内的频道
+func (s *Snapshot) ForEachSlotChannel(slotId uint32, fnc func(channelId string, channelType uint8) error) error {
+	for _, snap := range s.snaps {
+		if err := s.wk.forEachSlotChannel(snap, slotId, fnc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) GetUser(uid string) (User, error) {
+	return s.wk.getUser(s.shard(uid), uid)
+}
+
+func (s *Snapshot) GetChannel(channelId string, channelType uint8) (ChannelInfo, error) {
+	return s.wk.getChannel(s.channelShard(channelId, channelType), channelId, channelType)
+}
+
+func (s *Snapshot) GetConversations(uid string) ([]Conversation, error) {
+	return s.wk.getConversations(s.shard(uid), uid)
+}
+
+func (s *Snapshot) GetTokenDenies(uid string) ([]TokenDeny, error) {
+	denies, err := s.wk.getTokenDenies(s.shard(uid), uid)
+	if err != nil {
+		return nil, err
+	}
+	return s.wk.filterExpiredTokenDenies(denies), nil
+}
+
+// GetMessagesOfNotifyQueue 获取快照里消息通知队列的所有消息
+func (s *Snapshot) GetMessagesOfNotifyQueue() ([]Message, error) {
+	return s.wk.getAllMessagesOfNotifyQueue(s.snaps[0])
+}
@@ -0,0 +1,86 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir()), wkdb.WithShardNum(4)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	err = d.AddOrUpdateUser(wkdb.User{Id: 1, Uid: "u1"})
+	assert.NoError(t, err)
+	err = d.AppendMessagesOfUserQueue("u1", []wkdb.Message{
+		{RecvPacket: wkproto.RecvPacket{MessageID: 1, MessageSeq: 10, ChannelID: "cmd", ChannelType: 2, Payload: []byte("1")}},
+		{RecvPacket: wkproto.RecvPacket{MessageID: 2, MessageSeq: 11, ChannelID: "cmd", ChannelType: 2, Payload: []byte("2")}},
+	})
+	assert.NoError(t, err)
+	err = d.UpdateMessageOfUserQueueCursorIfNeed("u1", 1)
+	assert.NoError(t, err)
+
+	snap := d.NewSnapshot()
+	defer snap.Close()
+
+	// 快照之后的写入在快照里看不到
+	err = d.AddOrUpdateUser(wkdb.User{Id: 2, Uid: "u2"})
+	assert.NoError(t, err)
+	err = d.AppendMessagesOfUserQueue("u1", []wkdb.Message{
+		{RecvPacket: wkproto.RecvPacket{MessageID: 3, MessageSeq: 12, ChannelID: "cmd", ChannelType: 2, Payload: []byte("3")}},
+	})
+	assert.NoError(t, err)
+
+	uids := make([]string, 0)
+	err = snap.ForEachUser(func(u wkdb.User) error {
+		uids = append(uids, u.Uid)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, uids)
+
+	queueUids := make([]string, 0)
+	err = snap.ForEachUserQueue(func(uid string) error {
+		queueUids = append(queueUids, uid)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, queueUids)
+
+	cursor, lastSeq, messages, err := snap.GetUserQueue("u1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), cursor)
+	assert.Equal(t, uint64(2), lastSeq)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, uint64(2), messages[0].QueueSeq)
+	assert.Equal(t, uint32(11), messages[0].MessageSeq)
+
+	// 用快照里的队列重置另一个库的队列
+	d2 := newTestDB(t)
+	err = d2.Open()
+	assert.NoError(t, err)
+	defer d2.Close()
+
+	err = d2.RestoreMessagesOfUserQueue("u1", cursor, lastSeq, messages)
+	assert.NoError(t, err)
+	msgs, err := d2.LoadMessagesOfUserQueue("u1", cursor+1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, uint64(2), msgs[0].QueueSeq)
+	assert.Equal(t, int64(2), msgs[0].MessageID)
+
+	// 重置后继续追加，序号接着快照里的最大序号
+	err = d2.AppendMessagesOfUserQueue("u1", messages)
+	assert.NoError(t, err)
+	lastSeq, err = d2.GetMessageOfUserQueueLastSeq("u1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), lastSeq)
+}
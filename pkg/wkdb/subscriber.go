@@ -39,7 +39,11 @@ func (wk *wukongDB) AddSubscribers(channelId string, channelType uint8, subscrib
 }
 
 func (wk *wukongDB) GetSubscribers(channelId string, channelType uint8) ([]string, error) {
-	iter := wk.channelDb(channelId, channelType).NewIter(&pebble.IterOptions{
+	return wk.getSubscribers(wk.channelDb(channelId, channelType), channelId, channelType)
+}
+
+func (wk *wukongDB) getSubscribers(r pebble.Reader, channelId string, channelType uint8) ([]string, error) {
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewSubscriberPrimaryKey(channelId, channelType, 0),
 		UpperBound: key.NewSubscriberPrimaryKey(channelId, channelType, math.MaxUint64),
 	})
@@ -0,0 +1,88 @@
+package wkdb
+
+import (
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+func (wk *wukongDB) IncTenantStorage(appId string, delta int64) error {
+	wk.dblock.tenantUsageLock.Lock()
+	defer wk.dblock.tenantUsageLock.Unlock()
+
+	usage, err := wk.GetTenantUsage(appId)
+	if err != nil {
+		return err
+	}
+	usage.AppId = appId
+	usage.StorageBytes += delta
+	if usage.StorageBytes < 0 {
+		usage.StorageBytes = 0
+	}
+	usage.UpdatedAt = time.Now().Unix()
+	return wk.setTenantUsage(usage)
+}
+
+func (wk *wukongDB) SetTenantUsage(usage TenantUsage) error {
+	wk.dblock.tenantUsageLock.Lock()
+	defer wk.dblock.tenantUsageLock.Unlock()
+	return wk.setTenantUsage(usage)
+}
+
+func (wk *wukongDB) setTenantUsage(usage TenantUsage) error {
+	data, err := usage.Marshal()
+	if err != nil {
+		return err
+	}
+	return wk.shardDB(usage.AppId).Set(key.NewTenantUsageKey(usage.AppId), data, wk.sync)
+}
+
+func (wk *wukongDB) GetTenantUsage(appId string) (TenantUsage, error) {
+	result, closer, err := wk.shardDB(appId).Get(key.NewTenantUsageKey(appId))
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return TenantUsage{AppId: appId}, nil
+		}
+		return TenantUsage{}, err
+	}
+	defer closer.Close()
+
+	var usage TenantUsage
+	if err = usage.Unmarshal(result); err != nil {
+		return TenantUsage{}, err
+	}
+	if usage.AppId != appId { // appId的hash冲突
+		return TenantUsage{AppId: appId}, nil
+	}
+	return usage, nil
+}
+
+func (wk *wukongDB) GetTenantUsages() ([]TenantUsage, error) {
+	usages := make([]TenantUsage, 0)
+	for _, db := range wk.dbs {
+		results, err := wk.getTenantUsages(db)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, results...)
+	}
+	return usages, nil
+}
+
+func (wk *wukongDB) getTenantUsages(r pebble.Reader) ([]TenantUsage, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewTenantUsageLowKey(),
+		UpperBound: key.NewTenantUsageHighKey(),
+	})
+	defer iter.Close()
+	usages := make([]TenantUsage, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		var usage TenantUsage
+		if err := usage.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
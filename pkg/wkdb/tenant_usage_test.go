@@ -0,0 +1,47 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantUsage(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(2)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	usage, err := d.GetTenantUsage("app1")
+	assert.NoError(t, err)
+	assert.Equal(t, "app1", usage.AppId)
+	assert.Equal(t, int64(0), usage.StorageBytes)
+
+	err = d.IncTenantStorage("app1", 100)
+	assert.NoError(t, err)
+	err = d.IncTenantStorage("app1", 50)
+	assert.NoError(t, err)
+	err = d.IncTenantStorage("app2", 10)
+	assert.NoError(t, err)
+
+	usage, err = d.GetTenantUsage("app1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), usage.StorageBytes)
+
+	// 不会小于0
+	err = d.IncTenantStorage("app2", -20)
+	assert.NoError(t, err)
+	usage, err = d.GetTenantUsage("app2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), usage.StorageBytes)
+
+	usages, err := d.GetTenantUsages()
+	assert.NoError(t, err)
+	assert.Len(t, usages, 2)
+}
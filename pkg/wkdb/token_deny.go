@@ -0,0 +1,176 @@
+package wkdb
+
+import (
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+func (wk *wukongDB) AddTokenDenies(denies []TokenDeny) error {
+	if len(denies) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	batches := make(map[*pebble.DB]*pebble.Batch)
+	defer func() {
+		for _, batch := range batches {
+			batch.Close()
+		}
+	}()
+	cleaned := make(map[string]struct{})
+	for _, deny := range denies {
+		if deny.Uid == "" {
+			continue
+		}
+		db := wk.shardDB(deny.Uid)
+		batch := batches[db]
+		if batch == nil {
+			batch = db.NewBatch()
+			batches[db] = batch
+		}
+		// 顺便清理用户已过期的记录
+		if _, ok := cleaned[deny.Uid]; !ok {
+			cleaned[deny.Uid] = struct{}{}
+			exists, err := wk.getTokenDenies(db, deny.Uid)
+			if err != nil {
+				return err
+			}
+			for _, exist := range exists {
+				if exist.Expired(now) {
+					if err = batch.Delete(key.NewTokenDenyKey(exist.Uid, exist.Jti), wk.noSync); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if deny.Expired(now) {
+			continue
+		}
+		data, err := deny.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(key.NewTokenDenyKey(deny.Uid, deny.Jti), data, wk.noSync); err != nil {
+			return err
+		}
+		if err = wk.writeSlotIndexOfUid(deny.Uid, batch); err != nil {
+			return err
+		}
+	}
+	for _, batch := range batches {
+		if err := batch.Commit(wk.sync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) RemoveTokenDeny(uid string, jti string) error {
+	return wk.shardDB(uid).Delete(key.NewTokenDenyKey(uid, jti), wk.sync)
+}
+
+func (wk *wukongDB) GetTokenDenies(uid string) ([]TokenDeny, error) {
+	denies, err := wk.getTokenDenies(wk.shardDB(uid), uid)
+	if err != nil {
+		return nil, err
+	}
+	return wk.filterExpiredTokenDenies(denies), nil
+}
+
+func (wk *wukongDB) GetAllTokenDenies() ([]TokenDeny, error) {
+	denies := make([]TokenDeny, 0)
+	for _, db := range wk.dbs {
+		results, err := wk.getAllTokenDenies(db)
+		if err != nil {
+			return nil, err
+		}
+		denies = append(denies, results...)
+	}
+	return wk.filterExpiredTokenDenies(denies), nil
+}
+
+// PurgeExpiredTokenDenies 删除所有分区内now之前已过期的拒绝名单，返回删除的数量
+func (wk *wukongDB) PurgeExpiredTokenDenies(now time.Time) (int, error) {
+	total := 0
+	for _, db := range wk.dbs {
+		denies, err := wk.getAllTokenDenies(db)
+		if err != nil {
+			return total, err
+		}
+		batch := db.NewBatch()
+		count := 0
+		for _, deny := range denies {
+			if !deny.Expired(now.Unix()) {
+				continue
+			}
+			if err = batch.Delete(key.NewTokenDenyKey(deny.Uid, deny.Jti), wk.noSync); err != nil {
+				batch.Close()
+				return total, err
+			}
+			count++
+		}
+		if count > 0 {
+			if err = batch.Commit(wk.sync); err != nil {
+				batch.Close()
+				return total, err
+			}
+		}
+		batch.Close()
+		total += count
+	}
+	return total, nil
+}
+
+func (wk *wukongDB) getAllTokenDenies(r pebble.Reader) ([]TokenDeny, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewTokenDenyTableLowKey(),
+		UpperBound: key.NewTokenDenyTableHighKey(),
+	})
+	defer iter.Close()
+	return wk.iterTokenDenies(iter)
+}
+
+func (wk *wukongDB) getTokenDenies(r pebble.Reader, uid string) ([]TokenDeny, error) {
+	iter := r.NewIter(&pebble.IterOptions{
+		LowerBound: key.NewTokenDenyLowKey(uid),
+		UpperBound: key.NewTokenDenyHighKey(uid),
+	})
+	defer iter.Close()
+	denies, err := wk.iterTokenDenies(iter)
+	if err != nil {
+		return nil, err
+	}
+	// uid的hash可能冲突，这里过滤一下
+	results := denies[:0]
+	for _, deny := range denies {
+		if deny.Uid == uid {
+			results = append(results, deny)
+		}
+	}
+	return results, nil
+}
+
+func (wk *wukongDB) iterTokenDenies(iter *pebble.Iterator) ([]TokenDeny, error) {
+	denies := make([]TokenDeny, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		var deny TokenDeny
+		if err := deny.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		denies = append(denies, deny)
+	}
+	return denies, nil
+}
+
+func (wk *wukongDB) filterExpiredTokenDenies(denies []TokenDeny) []TokenDeny {
+	now := time.Now().Unix()
+	results := make([]TokenDeny, 0, len(denies))
+	for _, deny := range denies {
+		if deny.Expired(now) {
+			continue
+		}
+		results = append(results, deny)
+	}
+	return results
+}
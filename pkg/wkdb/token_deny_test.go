@@ -0,0 +1,54 @@
+package wkdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenDenies(t *testing.T) {
+	dir := t.TempDir()
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(dir), wkdb.WithShardNum(2)))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	now := time.Now().Unix()
+	err = d.AddTokenDenies([]wkdb.TokenDeny{
+		{Uid: "u1", Jti: "t1", DeniedAt: now, ExpireAt: now + 3600},
+		{Uid: "u1", DeniedAt: now},
+		{Uid: "u1", Jti: "t2", DeniedAt: now - 7200, ExpireAt: now - 3600}, // 已过期
+		{Uid: "u2", Jti: "t3", DeniedAt: now, ExpireAt: now + 3600},
+	})
+	assert.NoError(t, err)
+
+	denies, err := d.GetTokenDenies("u1")
+	assert.NoError(t, err)
+	assert.Len(t, denies, 2)
+
+	denies, err = d.GetAllTokenDenies()
+	assert.NoError(t, err)
+	assert.Len(t, denies, 3)
+
+	err = d.RemoveTokenDeny("u1", "t1")
+	assert.NoError(t, err)
+
+	denies, err = d.GetTokenDenies("u1")
+	assert.NoError(t, err)
+	assert.Len(t, denies, 1)
+	assert.Equal(t, "", denies[0].Jti)
+	assert.Equal(t, now, denies[0].DeniedAt)
+	// 过期的记录被删除
+	count, err := d.PurgeExpiredTokenDenies(time.Unix(now+3600, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	denies, err = d.GetAllTokenDenies()
+	assert.NoError(t, err)
+	assert.Len(t, denies, 1)
+}
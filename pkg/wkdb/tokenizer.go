@@ -0,0 +1,90 @@
+package wkdb
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// 中日韩文字按二元切分，其他文字按三元切分
+const (
+	cjkGramSize  = 2
+	wordGramSize = 3
+	// 不足三元切分长度的短词（例如ok、hi）整个词作为一个词，再短的不产生词
+	minWordSize = 2
+)
+
+// tokenize 对要建立索引的文本分词（去重后返回）
+// 中日韩文字按连续二字切分，其他文字先按空白和标点切成词再按连续三字切分，所有词都转为小写
+// 关键词是内容的子串时，关键词分出的n元词一定也是内容分出的词，所以索引可以按子串语义查询
+// 切不出n元词的短词整个词作为一个词，这样短词也能通过索引查询
+func tokenize(text string) []string {
+	grams, words := splitTokens(text)
+	return append(grams, words...)
+}
+
+// tokenizeKeyword 对查询的关键词分词
+// 能切出n元词时只用n元词（按子串匹配），否则用短词（按整词匹配），都没有时返回空，只能通过扫描查询
+func tokenizeKeyword(keyword string) []string {
+	grams, words := splitTokens(keyword)
+	if len(grams) > 0 {
+		return grams
+	}
+	return words
+}
+
+// splitTokens 返回文本的n元词和短词
+func splitTokens(text string) (grams []string, words []string) {
+	if text == "" || !utf8.ValidString(text) {
+		return nil, nil
+	}
+	var (
+		exists = make(map[string]struct{})
+		word   []rune
+		cjk    []rune
+	)
+	add := func(tokens []string, token string) []string {
+		if _, ok := exists[token]; ok {
+			return tokens
+		}
+		exists[token] = struct{}{}
+		return append(tokens, token)
+	}
+	addGrams := func(runes []rune, size int) {
+		for i := 0; i+size <= len(runes); i++ {
+			grams = add(grams, string(runes[i:i+size]))
+		}
+	}
+	flushWord := func() {
+		if len(word) >= minWordSize && len(word) < wordGramSize {
+			words = add(words, string(word))
+		} else {
+			addGrams(word, wordGramSize)
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		addGrams(cjk, cjkGramSize)
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return grams, words
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
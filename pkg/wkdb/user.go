@@ -6,12 +6,17 @@ import (
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/WuKongIM/WuKongIM/pkg/wkutil"
 	"github.com/cockroachdb/pebble"
 )
 
 func (wk *wukongDB) GetUser(uid string) (User, error) {
+	return wk.getUser(wk.shardDB(uid), uid)
+}
 
-	id, err := wk.getUserId(uid)
+func (wk *wukongDB) getUser(r pebble.Reader, uid string) (User, error) {
+
+	id, err := wk.getUserIdWith(r, uid)
 	if err != nil {
 		return EmptyUser, err
 	}
@@ -20,8 +25,7 @@ func (wk *wukongDB) GetUser(uid string) (User, error) {
 		return EmptyUser, ErrNotFound
 	}
 
-	db := wk.shardDB(uid)
-	iter := db.NewIter(&pebble.IterOptions{
+	iter := r.NewIter(&pebble.IterOptions{
 		LowerBound: key.NewUserColumnKey(id, key.MinColumnKey),
 		UpperBound: key.NewUserColumnKey(id, key.MaxColumnKey),
 	})
@@ -156,6 +160,82 @@ func (wk *wukongDB) AddOrUpdateUser(u User) error {
 	return batch.Commit(wk.sync)
 }
 
+func (wk *wukongDB) UpdateUserLastSeen(uid string, lastSeen int64) error {
+	id, err := wk.getUserId(uid)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return ErrNotFound
+	}
+	lastSeenBytes := make([]byte, 8)
+	wk.endian.PutUint64(lastSeenBytes, uint64(lastSeen))
+	return wk.shardDB(uid).Set(key.NewUserColumnKey(id, key.TableUser.Column.LastSeen), lastSeenBytes, wk.sync)
+}
+
+func (wk *wukongDB) UpdateUsersLastSeen(users []User) error {
+	batches := make(map[*pebble.DB]*pebble.Batch)
+	defer func() {
+		for _, batch := range batches {
+			batch.Close()
+		}
+	}()
+	for _, u := range users {
+		db := wk.shardDB(u.Uid)
+		batch := batches[db]
+		if batch == nil {
+			batch = db.NewBatch()
+			batches[db] = batch
+		}
+		id, err := wk.getUserId(u.Uid)
+		if err != nil {
+			return err
+		}
+		if id == 0 { // 用户不存在则创建
+			if u.Id == 0 {
+				return ErrInvalidUserId
+			}
+			if err = wk.writeUser(u, true, batch); err != nil {
+				return err
+			}
+			continue
+		}
+		lastSeenBytes := make([]byte, 8)
+		wk.endian.PutUint64(lastSeenBytes, uint64(u.LastSeen))
+		if err = batch.Set(key.NewUserColumnKey(id, key.TableUser.Column.LastSeen), lastSeenBytes, wk.noSync); err != nil {
+			return err
+		}
+	}
+	for _, batch := range batches {
+		if err := batch.Commit(wk.sync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wk *wukongDB) UpdateUserPresenceHidden(uid string, hidden bool) error {
+	id, err := wk.getUserId(uid)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return ErrNotFound
+	}
+	return wk.shardDB(uid).Set(key.NewUserColumnKey(id, key.TableUser.Column.PresenceHidden), []byte{wkutil.BoolToUint8(hidden)}, wk.sync)
+}
+
+func (wk *wukongDB) UpdateUserPushMute(uid string, pushMute bool) error {
+	id, err := wk.getUserId(uid)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return ErrNotFound
+	}
+	return wk.shardDB(uid).Set(key.NewUserColumnKey(id, key.TableUser.Column.PushMute), []byte{wkutil.BoolToUint8(pushMute)}, wk.sync)
+}
+
 func (wk *wukongDB) incUserDeviceCount(uid string, count int, db *pebble.DB) error {
 
 	wk.dblock.userLock.Lock(uid)
@@ -192,8 +272,12 @@ func (wk *wukongDB) incUserDeviceCount(uid string, count int, db *pebble.DB) err
 }
 
 func (wk *wukongDB) getUserId(uid string) (uint64, error) {
+	return wk.getUserIdWith(wk.shardDB(uid), uid)
+}
+
+func (wk *wukongDB) getUserIdWith(r pebble.Reader, uid string) (uint64, error) {
 	indexKey := key.NewUserIndexUidKey(uid)
-	uidIndexValue, closer, err := wk.shardDB(uid).Get(indexKey)
+	uidIndexValue, closer, err := r.Get(indexKey)
 	if err != nil {
 		if err == pebble.ErrNotFound {
 			return 0, nil
@@ -218,6 +302,23 @@ func (wk *wukongDB) writeUser(u User, isCreate bool, w pebble.Writer) error {
 		return err
 	}
 
+	// pushMute
+	if err = w.Set(key.NewUserColumnKey(u.Id, key.TableUser.Column.PushMute), []byte{wkutil.BoolToUint8(u.PushMute)}, wk.noSync); err != nil {
+		return err
+	}
+
+	// lastSeen
+	var lastSeenBytes = make([]byte, 8)
+	wk.endian.PutUint64(lastSeenBytes, uint64(u.LastSeen))
+	if err = w.Set(key.NewUserColumnKey(u.Id, key.TableUser.Column.LastSeen), lastSeenBytes, wk.noSync); err != nil {
+		return err
+	}
+
+	// presenceHidden
+	if err = w.Set(key.NewUserColumnKey(u.Id, key.TableUser.Column.PresenceHidden), []byte{wkutil.BoolToUint8(u.PresenceHidden)}, wk.noSync); err != nil {
+		return err
+	}
+
 	// updatedAt
 	var nowBytes = make([]byte, 8)
 	wk.endian.PutUint64(nowBytes, uint64(time.Now().Unix()))
@@ -239,7 +340,8 @@ func (wk *wukongDB) writeUser(u User, isCreate bool, w pebble.Writer) error {
 		return err
 	}
 
-	return nil
+	// slot index
+	return wk.writeSlotIndexOfUid(u.Uid, w)
 }
 
 func (wk *wukongDB) iteratorUser(iter *pebble.Iterator, reverse bool, iterFnc func(u User) bool) error {
@@ -302,7 +404,12 @@ func (wk *wukongDB) iteratorUser(iter *pebble.Iterator, reverse bool, iterFnc fu
 		case key.TableUser.Column.UpdatedAt:
 			up := time.Unix(int64(wk.endian.Uint64(iter.Value())), 0)
 			preUser.UpdatedAt = &up
-
+		case key.TableUser.Column.PushMute:
+			preUser.PushMute = wkutil.Uint8ToBool(iter.Value()[0])
+		case key.TableUser.Column.LastSeen:
+			preUser.LastSeen = int64(wk.endian.Uint64(iter.Value()))
+		case key.TableUser.Column.PresenceHidden:
+			preUser.PresenceHidden = wkutil.Uint8ToBool(iter.Value()[0])
 		}
 		lastNeedAppend = true
 		hasData = true
@@ -56,3 +56,98 @@ func TestGetUser(t *testing.T) {
 	assert.Equal(t, u.CreatedAt.Unix(), u2.CreatedAt.Unix())
 	assert.Equal(t, u.UpdatedAt.Unix(), u2.UpdatedAt.Unix())
 }
+
+func TestUserPushMute(t *testing.T) {
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir())))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	u := wkdb.User{
+		Id:       1,
+		Uid:      "test",
+		PushMute: true,
+	}
+	err = d.AddOrUpdateUser(u)
+	assert.NoError(t, err)
+
+	u2, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.True(t, u2.PushMute)
+
+	// 只更新免打扰，其他字段不变
+	err = d.UpdateUserLastSeen("test", 1700000000)
+	assert.NoError(t, err)
+	err = d.UpdateUserPushMute("test", false)
+	assert.NoError(t, err)
+	u3, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.False(t, u3.PushMute)
+	assert.Equal(t, int64(1700000000), u3.LastSeen)
+
+	err = d.UpdateUserPushMute("notexist", true)
+	assert.Equal(t, wkdb.ErrNotFound, err)
+}
+
+func TestUserPresence(t *testing.T) {
+	d := wkdb.NewWukongDB(wkdb.NewOptions(wkdb.WithDir(t.TempDir())))
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	u := wkdb.User{
+		Id:             1,
+		Uid:            "test",
+		LastSeen:       1700000000,
+		PresenceHidden: true,
+	}
+	err = d.AddOrUpdateUser(u)
+	assert.NoError(t, err)
+
+	u2, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1700000000), u2.LastSeen)
+	assert.True(t, u2.PresenceHidden)
+
+	// 只更新最后在线时间，其他字段不变
+	err = d.UpdateUserLastSeen("test", 1700000100)
+	assert.NoError(t, err)
+	u3, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1700000100), u3.LastSeen)
+	assert.True(t, u3.PresenceHidden)
+
+	err = d.UpdateUserLastSeen("notexist", 1700000100)
+	assert.Equal(t, wkdb.ErrNotFound, err)
+
+	// 只更新是否隐藏在线状态
+	err = d.UpdateUserPresenceHidden("test", false)
+	assert.NoError(t, err)
+	u4, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.False(t, u4.PresenceHidden)
+	assert.Equal(t, int64(1700000100), u4.LastSeen)
+
+	// 批量更新最后在线时间，用户不存在时创建
+	err = d.UpdateUsersLastSeen([]wkdb.User{
+		{Id: 2, Uid: "test", LastSeen: 1700000200},
+		{Id: 3, Uid: "test2", LastSeen: 1700000300},
+	})
+	assert.NoError(t, err)
+	u5, err := d.GetUser("test")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), u5.Id)
+	assert.Equal(t, int64(1700000200), u5.LastSeen)
+	u6, err := d.GetUser("test2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), u6.Id)
+	assert.Equal(t, int64(1700000300), u6.LastSeen)
+}
@@ -0,0 +1,196 @@
+package wkdb
+
+import (
+	"math"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb/key"
+	"github.com/cockroachdb/pebble"
+)
+
+// webhookDeadLetterReplayBatchSize 重放所有死信时每批重放的数量
+const webhookDeadLetterReplayBatchSize = 1000
+
+// AppendWebhookEvents 添加webhook事件到待发送队列
+func (wk *wukongDB) AppendWebhookEvents(events []WebhookEvent) error {
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, e := range events {
+		if err := wk.writeWebhookEvent(e, batch); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// GetWebhookEvents 获取下次发送时间小于等于maxNextRetryAt的webhook事件，按发送时间排序
+func (wk *wukongDB) GetWebhookEvents(maxNextRetryAt uint64, limit int) ([]WebhookEvent, error) {
+	iter := wk.defaultShardDB().NewIter(&pebble.IterOptions{
+		LowerBound: key.NewWebhookOutboxKey(0, 0),
+		UpperBound: key.NewWebhookOutboxKey(maxNextRetryAt, math.MaxUint64),
+	})
+	defer iter.Close()
+	return wk.parseWebhookEvents(iter, limit)
+}
+
+// RemoveWebhookEvents 从待发送队列里移除webhook事件
+func (wk *wukongDB) RemoveWebhookEvents(events []WebhookEvent) error {
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, e := range events {
+		if err := batch.Delete(key.NewWebhookOutboxKey(e.NextRetryAt, e.Id), wk.noSync); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// RescheduleWebhookEvents 修改webhook事件的下次发送时间，events里的NextRetryAt为修改前的时间
+func (wk *wukongDB) RescheduleWebhookEvents(events []WebhookEvent, nextRetryAt uint64) error {
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, e := range events {
+		if err := batch.Delete(key.NewWebhookOutboxKey(e.NextRetryAt, e.Id), wk.noSync); err != nil {
+			return err
+		}
+		e.NextRetryAt = nextRetryAt
+		if err := wk.writeWebhookEvent(e, batch); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// MoveWebhookEventsToDeadLetter 将webhook事件移入死信表
+func (wk *wukongDB) MoveWebhookEventsToDeadLetter(events []WebhookEvent) error {
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, e := range events {
+		if err := batch.Delete(key.NewWebhookOutboxKey(e.NextRetryAt, e.Id), wk.noSync); err != nil {
+			return err
+		}
+		data, err := e.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = batch.Set(key.NewWebhookDeadLetterKey(e.Id), data, wk.noSync); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// GetWebhookDeadLetters 获取id大于startId的死信事件
+func (wk *wukongDB) GetWebhookDeadLetters(startId uint64, limit int) ([]WebhookEvent, error) {
+	iter := wk.defaultShardDB().NewIter(&pebble.IterOptions{
+		LowerBound: key.NewWebhookDeadLetterKey(startId + 1),
+		UpperBound: key.NewWebhookDeadLetterKey(math.MaxUint64),
+	})
+	defer iter.Close()
+	return wk.parseWebhookEvents(iter, limit)
+}
+
+// ReplayWebhookDeadLetters 将死信事件重新放回待发送队列，ids为空则分批重放所有死信，返回重放的数量
+func (wk *wukongDB) ReplayWebhookDeadLetters(ids []uint64, nextRetryAt uint64) (int, error) {
+	if len(ids) > 0 {
+		events, err := wk.getWebhookDeadLettersByIds(ids)
+		if err != nil {
+			return 0, err
+		}
+		return len(events), wk.replayWebhookDeadLetters(events, nextRetryAt)
+	}
+	var (
+		count   int
+		startId uint64
+	)
+	for {
+		events, err := wk.GetWebhookDeadLetters(startId, webhookDeadLetterReplayBatchSize)
+		if err != nil {
+			return count, err
+		}
+		if err = wk.replayWebhookDeadLetters(events, nextRetryAt); err != nil {
+			return count, err
+		}
+		count += len(events)
+		if len(events) < webhookDeadLetterReplayBatchSize {
+			return count, nil
+		}
+		startId = events[len(events)-1].Id
+	}
+}
+
+func (wk *wukongDB) replayWebhookDeadLetters(events []WebhookEvent, nextRetryAt uint64) error {
+	if len(events) == 0 {
+		return nil
+	}
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, e := range events {
+		if err := batch.Delete(key.NewWebhookDeadLetterKey(e.Id), wk.noSync); err != nil {
+			return err
+		}
+		e.RetryCount = 0
+		e.NextRetryAt = nextRetryAt
+		if err := wk.writeWebhookEvent(e, batch); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+// RemoveWebhookDeadLetters 删除死信事件
+func (wk *wukongDB) RemoveWebhookDeadLetters(ids []uint64) error {
+	batch := wk.defaultShardDB().NewBatch()
+	defer batch.Close()
+	for _, id := range ids {
+		if err := batch.Delete(key.NewWebhookDeadLetterKey(id), wk.noSync); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(wk.sync)
+}
+
+func (wk *wukongDB) getWebhookDeadLettersByIds(ids []uint64) ([]WebhookEvent, error) {
+	db := wk.defaultShardDB()
+	events := make([]WebhookEvent, 0, len(ids))
+	for _, id := range ids {
+		data, closer, err := db.Get(key.NewWebhookDeadLetterKey(id))
+		if err != nil {
+			if err == pebble.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		var e WebhookEvent
+		err = e.Unmarshal(data)
+		closer.Close()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (wk *wukongDB) writeWebhookEvent(e WebhookEvent, w pebble.Writer) error {
+	data, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	return w.Set(key.NewWebhookOutboxKey(e.NextRetryAt, e.Id), data, wk.noSync)
+}
+
+// parseWebhookEvents 解析webhook事件，limit为0表示不限制
+func (wk *wukongDB) parseWebhookEvents(iter *pebble.Iterator, limit int) ([]WebhookEvent, error) {
+	events := make([]WebhookEvent, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+		var e WebhookEvent
+		if err := e.Unmarshal(iter.Value()); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
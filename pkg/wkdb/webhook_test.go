@@ -0,0 +1,140 @@
+package wkdb_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wkdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookOutbox(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	events := []wkdb.WebhookEvent{
+		{Id: 1, Event: "msg.offline", Data: []byte(`{"a":1}`), NextRetryAt: 100},
+		{Id: 2, Event: "user.onlinestatus", Data: []byte(`["u1-0-1"]`), NextRetryAt: 200},
+	}
+	err = d.AppendWebhookEvents(events)
+	assert.NoError(t, err)
+
+	// 只返回到期的事件
+	dueEvents, err := d.GetWebhookEvents(150, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dueEvents))
+	assert.Equal(t, events[0].Data, dueEvents[0].Data)
+
+	// 延后发送
+	e := dueEvents[0]
+	e.RetryCount = 1
+	e.LastError = "timeout"
+	err = d.RescheduleWebhookEvents([]wkdb.WebhookEvent{e}, 300)
+	assert.NoError(t, err)
+
+	dueEvents, err = d.GetWebhookEvents(250, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dueEvents))
+	assert.Equal(t, uint64(2), dueEvents[0].Id)
+
+	allEvents, err := d.GetWebhookEvents(1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(allEvents))
+	assert.Equal(t, uint64(1), allEvents[1].Id)
+	assert.Equal(t, uint32(1), allEvents[1].RetryCount)
+	assert.Equal(t, "timeout", allEvents[1].LastError)
+
+	err = d.RemoveWebhookEvents(allEvents[:1])
+	assert.NoError(t, err)
+
+	allEvents, err = d.GetWebhookEvents(1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(allEvents))
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	events := []wkdb.WebhookEvent{
+		{Id: 1, Event: "msg.offline", Data: []byte("1"), NextRetryAt: 100, RetryCount: 5},
+		{Id: 2, Event: "msg.offline", Data: []byte("2"), NextRetryAt: 100, RetryCount: 5},
+	}
+	err = d.AppendWebhookEvents(events)
+	assert.NoError(t, err)
+
+	err = d.MoveWebhookEventsToDeadLetter(events)
+	assert.NoError(t, err)
+
+	outbox, err := d.GetWebhookEvents(1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(outbox))
+
+	deadLetters, err := d.GetWebhookDeadLetters(0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(deadLetters))
+
+	deadLetters, err = d.GetWebhookDeadLetters(1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(deadLetters))
+	assert.Equal(t, uint64(2), deadLetters[0].Id)
+
+	count, err := d.ReplayWebhookDeadLetters([]uint64{1}, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	outbox, err = d.GetWebhookEvents(1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(outbox))
+	assert.Equal(t, uint32(0), outbox[0].RetryCount)
+	assert.Equal(t, uint64(500), outbox[0].NextRetryAt)
+
+	err = d.RemoveWebhookDeadLetters([]uint64{2})
+	assert.NoError(t, err)
+
+	deadLetters, err = d.GetWebhookDeadLetters(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(deadLetters))
+}
+
+func TestReplayAllWebhookDeadLetters(t *testing.T) {
+	d := newTestDB(t)
+	err := d.Open()
+	assert.NoError(t, err)
+
+	defer func() {
+		err := d.Close()
+		assert.NoError(t, err)
+	}()
+
+	// 死信数量超过一批，分批全部重放
+	count := 2500
+	events := make([]wkdb.WebhookEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		events = append(events, wkdb.WebhookEvent{Id: uint64(i), Event: "msg.offline", Data: []byte("1"), NextRetryAt: 100, RetryCount: 5})
+	}
+	err = d.MoveWebhookEventsToDeadLetter(events)
+	assert.NoError(t, err)
+
+	replayed, err := d.ReplayWebhookDeadLetters(nil, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, count, replayed)
+
+	outbox, err := d.GetWebhookEvents(1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, count, len(outbox))
+	deadLetters, err := d.GetWebhookDeadLetters(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(deadLetters))
+}
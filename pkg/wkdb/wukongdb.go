@@ -106,7 +106,12 @@ func (wk *wukongDB) Open() error {
 		wk.dbs = append(wk.dbs, db)
 	}
 
+	if err := wk.buildSlotIndexIfNeed(); err != nil {
+		return err
+	}
+
 	go wk.collectMetricsLoop()
+	go wk.expireLoop()
 
 	return nil
 }
@@ -122,6 +127,15 @@ func (wk *wukongDB) Close() error {
 	return nil
 }
 
+func (wk *wukongDB) Checkpoint(dir string) error {
+	for i, db := range wk.dbs {
+		if err := db.Checkpoint(filepath.Join(dir, "wukongimdb", fmt.Sprintf("shard%03d", i)), pebble.WithFlushedWAL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (wk *wukongDB) shardDB(v string) *pebble.DB {
 	shardId := wk.shardId(v)
 	return wk.dbs[shardId]
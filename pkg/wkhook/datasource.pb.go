@@ -0,0 +1,230 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.32.0
+// 	protoc        v3.18.1
+// source: pkg/wkhook/datasource.proto
+
+package wkhook
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DatasourceReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Cmd  string `protobuf:"bytes,1,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *DatasourceReq) Reset() {
+	*x = DatasourceReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_wkhook_datasource_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DatasourceReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DatasourceReq) ProtoMessage() {}
+
+func (x *DatasourceReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_wkhook_datasource_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DatasourceReq.ProtoReflect.Descriptor instead.
+func (*DatasourceReq) Descriptor() ([]byte, []int) {
+	return file_pkg_wkhook_datasource_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DatasourceReq) GetCmd() string {
+	if x != nil {
+		return x.Cmd
+	}
+	return ""
+}
+
+func (x *DatasourceReq) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type DatasourceResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Status int32  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Data   []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *DatasourceResp) Reset() {
+	*x = DatasourceResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_wkhook_datasource_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DatasourceResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DatasourceResp) ProtoMessage() {}
+
+func (x *DatasourceResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_wkhook_datasource_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DatasourceResp.ProtoReflect.Descriptor instead.
+func (*DatasourceResp) Descriptor() ([]byte, []int) {
+	return file_pkg_wkhook_datasource_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DatasourceResp) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *DatasourceResp) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_pkg_wkhook_datasource_proto protoreflect.FileDescriptor
+
+var file_pkg_wkhook_datasource_proto_rawDesc = []byte{
+	0x0a, 0x1b, 0x70, 0x6b, 0x67, 0x2f, 0x77, 0x6b, 0x68, 0x6f, 0x6f, 0x6b, 0x2f, 0x64, 0x61, 0x74,
+	0x61, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x77,
+	0x6b, 0x68, 0x6f, 0x6f, 0x6b, 0x22, 0x35, 0x0a, 0x0d, 0x44, 0x61, 0x74, 0x61, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x52, 0x65, 0x71, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x03, 0x63, 0x6d, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x3c, 0x0a, 0x0e,
+	0x44, 0x61, 0x74, 0x61, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x12, 0x16,
+	0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06,
+	0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x32, 0x4d, 0x0a, 0x11, 0x44, 0x61,
+	0x74, 0x61, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12,
+	0x38, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x15, 0x2e, 0x77, 0x6b, 0x68,
+	0x6f, 0x6f, 0x6b, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x65,
+	0x71, 0x1a, 0x16, 0x2e, 0x77, 0x6b, 0x68, 0x6f, 0x6f, 0x6b, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x42, 0x0b, 0x5a, 0x09, 0x2e, 0x2f, 0x3b,
+	0x77, 0x6b, 0x68, 0x6f, 0x6f, 0x6b, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_pkg_wkhook_datasource_proto_rawDescOnce sync.Once
+	file_pkg_wkhook_datasource_proto_rawDescData = file_pkg_wkhook_datasource_proto_rawDesc
+)
+
+func file_pkg_wkhook_datasource_proto_rawDescGZIP() []byte {
+	file_pkg_wkhook_datasource_proto_rawDescOnce.Do(func() {
+		file_pkg_wkhook_datasource_proto_rawDescData = protoimpl.X.CompressGZIP(file_pkg_wkhook_datasource_proto_rawDescData)
+	})
+	return file_pkg_wkhook_datasource_proto_rawDescData
+}
+
+var file_pkg_wkhook_datasource_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_wkhook_datasource_proto_goTypes = []interface{}{
+	(*DatasourceReq)(nil),  // 0: wkhook.DatasourceReq
+	(*DatasourceResp)(nil), // 1: wkhook.DatasourceResp
+}
+var file_pkg_wkhook_datasource_proto_depIdxs = []int32{
+	0, // 0: wkhook.DatasourceService.Request:input_type -> wkhook.DatasourceReq
+	1, // 1: wkhook.DatasourceService.Request:output_type -> wkhook.DatasourceResp
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_pkg_wkhook_datasource_proto_init() }
+func file_pkg_wkhook_datasource_proto_init() {
+	if File_pkg_wkhook_datasource_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pkg_wkhook_datasource_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DatasourceReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_wkhook_datasource_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DatasourceResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_pkg_wkhook_datasource_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pkg_wkhook_datasource_proto_goTypes,
+		DependencyIndexes: file_pkg_wkhook_datasource_proto_depIdxs,
+		MessageInfos:      file_pkg_wkhook_datasource_proto_msgTypes,
+	}.Build()
+	File_pkg_wkhook_datasource_proto = out.File
+	file_pkg_wkhook_datasource_proto_rawDesc = nil
+	file_pkg_wkhook_datasource_proto_goTypes = nil
+	file_pkg_wkhook_datasource_proto_depIdxs = nil
+}
@@ -0,0 +1,107 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.18.1
+// source: pkg/wkhook/datasource.proto
+
+package wkhook
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// DatasourceServiceClient is the client API for DatasourceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DatasourceServiceClient interface {
+	// 请求数据源，cmd与http数据源一致（getSubscribers、getChannelInfos等）
+	Request(ctx context.Context, in *DatasourceReq, opts ...grpc.CallOption) (*DatasourceResp, error)
+}
+
+type datasourceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDatasourceServiceClient(cc grpc.ClientConnInterface) DatasourceServiceClient {
+	return &datasourceServiceClient{cc}
+}
+
+func (c *datasourceServiceClient) Request(ctx context.Context, in *DatasourceReq, opts ...grpc.CallOption) (*DatasourceResp, error) {
+	out := new(DatasourceResp)
+	err := c.cc.Invoke(ctx, "/wkhook.DatasourceService/Request", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DatasourceServiceServer is the server API for DatasourceService service.
+// All implementations must embed UnimplementedDatasourceServiceServer
+// for forward compatibility
+type DatasourceServiceServer interface {
+	// 请求数据源，cmd与http数据源一致（getSubscribers、getChannelInfos等）
+	Request(context.Context, *DatasourceReq) (*DatasourceResp, error)
+	mustEmbedUnimplementedDatasourceServiceServer()
+}
+
+// UnimplementedDatasourceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDatasourceServiceServer struct {
+}
+
+func (UnimplementedDatasourceServiceServer) Request(context.Context, *DatasourceReq) (*DatasourceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Request not implemented")
+}
+func (UnimplementedDatasourceServiceServer) mustEmbedUnimplementedDatasourceServiceServer() {}
+
+// UnsafeDatasourceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DatasourceServiceServer will
+// result in compilation errors.
+type UnsafeDatasourceServiceServer interface {
+	mustEmbedUnimplementedDatasourceServiceServer()
+}
+
+func RegisterDatasourceServiceServer(s grpc.ServiceRegistrar, srv DatasourceServiceServer) {
+	s.RegisterService(&DatasourceService_ServiceDesc, srv)
+}
+
+func _DatasourceService_Request_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DatasourceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DatasourceServiceServer).Request(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wkhook.DatasourceService/Request",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DatasourceServiceServer).Request(ctx, req.(*DatasourceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DatasourceService_ServiceDesc is the grpc.ServiceDesc for DatasourceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DatasourceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wkhook.DatasourceService",
+	HandlerType: (*DatasourceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Request",
+			Handler:    _DatasourceService_Request_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pkg/wkhook/datasource.proto",
+}
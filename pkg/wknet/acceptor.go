@@ -24,9 +24,11 @@ type Acceptor struct {
 	listenPoller      *netpoll.Poller
 	listenWSPoller    *netpoll.Poller
 	listenWSSPoller   *netpoll.Poller
+	listenMQTTPoller  *netpoll.Poller
 	listen            *listener
 	listenWS          *listener // websocket
 	listenWSS         *listener // websocket
+	listenMQTT        *listener // mqtt
 	tcpRealListenAddr net.Addr  // tcp real listen addr
 	wsRealListenAddr  net.Addr  // websocket real listen addr
 
@@ -39,12 +41,13 @@ func NewAcceptor(eg *Engine) *Acceptor {
 		reactorSubs[i] = NewReactorSub(eg, i)
 	}
 	a := &Acceptor{
-		eg:              eg,
-		reactorSubs:     reactorSubs,
-		listenPoller:    netpoll.NewPoller(0, "listenerPoller"),
-		listenWSPoller:  netpoll.NewPoller(0, "listenWSPoller"),
-		listenWSSPoller: netpoll.NewPoller(0, "listenWSSPoller"),
-		Log:             wklog.NewWKLog("Acceptor"),
+		eg:               eg,
+		reactorSubs:      reactorSubs,
+		listenPoller:     netpoll.NewPoller(0, "listenerPoller"),
+		listenWSPoller:   netpoll.NewPoller(0, "listenWSPoller"),
+		listenWSSPoller:  netpoll.NewPoller(0, "listenWSSPoller"),
+		listenMQTTPoller: netpoll.NewPoller(0, "listenMQTTPoller"),
+		Log:              wklog.NewWKLog("Acceptor"),
 	}
 
 	return a
@@ -89,6 +92,15 @@ func (a *Acceptor) start() error {
 			}
 		}()
 	}
+	if strings.TrimSpace(a.eg.options.MQTTAddr) != "" {
+		wg.Add(1)
+		go func() {
+			err := a.initMQTTListener(wg)
+			if err != nil {
+				a.Panic("initMQTTListener() failed", zap.Error(err))
+			}
+		}()
+	}
 
 	wg.Wait()
 	return nil
@@ -133,6 +145,18 @@ func (a *Acceptor) Stop() error {
 		}
 	}
 
+	// -----------------mqtt-----------------
+	err = a.listenMQTTPoller.Close()
+	if err != nil {
+		a.Warn("listenMQTTPoller.Close() failed", zap.Error(err))
+	}
+	if a.listenMQTT != nil {
+		err = a.listenMQTT.Close()
+		if err != nil {
+			a.Warn("listenMQTT.Close() failed", zap.Error(err))
+		}
+	}
+
 	// -----------------reactor sub-----------------
 	for _, reactorSub := range a.reactorSubs {
 		err = reactorSub.Stop()
@@ -158,7 +182,7 @@ func (a *Acceptor) initTCPListener(wg *sync.WaitGroup) error {
 	wg.Done()
 
 	err = a.listenPoller.Polling(func(fd int, ev netpoll.PollEvent) error {
-		return a.acceptConn(fd, false, false)
+		return a.acceptConn(fd, false, false, false)
 	})
 	return err
 
@@ -177,7 +201,7 @@ func (a *Acceptor) initWSListener(wg *sync.WaitGroup) error {
 	}
 	wg.Done()
 	return a.listenWSPoller.Polling(func(fd int, ev netpoll.PollEvent) error {
-		return a.acceptConn(fd, true, false)
+		return a.acceptConn(fd, true, false, false)
 	})
 }
 
@@ -194,11 +218,26 @@ func (a *Acceptor) initWSSListener(wg *sync.WaitGroup) error {
 	}
 	wg.Done()
 	return a.listenWSSPoller.Polling(func(fd int, ev netpoll.PollEvent) error {
-		return a.acceptConn(fd, false, true)
+		return a.acceptConn(fd, false, true, false)
 	})
 }
 
-func (a *Acceptor) acceptConn(listenFd int, ws bool, wss bool) error {
+func (a *Acceptor) initMQTTListener(wg *sync.WaitGroup) error {
+	a.listenMQTT = newListener(a.eg.options.MQTTAddr, a.eg.options)
+	err := a.listenMQTT.init()
+	if err != nil {
+		return err
+	}
+	if err := a.listenMQTTPoller.AddRead(a.listenMQTT.fd); err != nil {
+		return fmt.Errorf("add mqtt listener fd to poller failed %s", err)
+	}
+	wg.Done()
+	return a.listenMQTTPoller.Polling(func(fd int, ev netpoll.PollEvent) error {
+		return a.acceptConn(fd, false, false, true)
+	})
+}
+
+func (a *Acceptor) acceptConn(listenFd int, ws bool, wss bool, mqtt bool) error {
 	var (
 		conn Conn
 		err  error
@@ -220,7 +259,11 @@ func (a *Acceptor) acceptConn(listenFd int, ws bool, wss bool) error {
 		a.Error("SetKeepAlivePeriod() failed", zap.Error(err))
 	}
 	subReactor := a.reactorSubByConnFd(connFd)
-	if wss {
+	if mqtt {
+		if conn, err = a.eg.eventHandler.OnNewMQTTConn(a.eg.GenClientID(), newNetFd(connFd), a.mqttRealAddr(), remoteAddr, a.eg, subReactor); err != nil {
+			return err
+		}
+	} else if wss {
 		if conn, err = a.eg.eventHandler.OnNewWSSConn(a.eg.GenClientID(), newNetFd(connFd), a.wssRealAddr(), remoteAddr, a.eg, subReactor); err != nil {
 			return err
 		}
@@ -264,3 +307,7 @@ func (a *Acceptor) wsRealAddr() net.Addr {
 func (a *Acceptor) wssRealAddr() net.Addr {
 	return a.listenWSS.realAddr
 }
+
+func (a *Acceptor) mqttRealAddr() net.Addr {
+	return a.listenMQTT.realAddr
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/RussellLuo/timingwheel"
+	"github.com/WuKongIM/WuKongIM/pkg/mqtt"
 	"github.com/WuKongIM/WuKongIM/pkg/ring"
 	wkproto "github.com/WuKongIM/WuKongIMGoProto"
 	"github.com/WuKongIM/crypto/tls"
@@ -122,6 +123,10 @@ type IWSConn interface {
 	WriteServerBinary(data []byte) error
 }
 
+type IMQTTConn interface {
+	WriteMQTTPacket(packet mqtt.ControlPacket) error
+}
+
 type DefaultConn struct {
 	fd             NetFd
 	remoteAddr     net.Addr
@@ -770,6 +775,11 @@ func (t *TLSConn) Fd() NetFd {
 	return t.d.Fd()
 }
 
+// ConnectionState tls连接的状态（包含对端的证书）
+func (t *TLSConn) ConnectionState() tls.ConnectionState {
+	return t.tlsconn.ConnectionState()
+}
+
 func (t *TLSConn) LocalAddr() net.Addr {
 	return t.d.LocalAddr()
 }
@@ -903,8 +913,9 @@ func (t *TLSConn) Uptime() time.Time {
 	return t.d.Uptime()
 }
 
+// WriteToOutboundBuffer 数据经过tls加密后再写入outboundBuffer
 func (t *TLSConn) WriteToOutboundBuffer(b []byte) (int, error) {
-	return t.d.outboundBuffer.Write(b)
+	return t.tlsconn.Write(b)
 }
 
 func (t *TLSConn) SetMaxIdle(maxIdle time.Duration) {
@@ -0,0 +1,33 @@
+package wknet
+
+import (
+	"net"
+
+	"github.com/WuKongIM/WuKongIM/pkg/mqtt"
+)
+
+func CreateMQTTConn(id int64, connFd NetFd, localAddr, remoteAddr net.Addr, eg *Engine, reactorSub *ReactorSub) (Conn, error) {
+	defaultConn := GetDefaultConn(id, connFd, localAddr, remoteAddr, eg, reactorSub)
+	return NewMQTTConn(defaultConn), nil
+}
+
+// MQTTConn MQTT连接，读到的原始数据直接进入inboundBuffer，由上层按MQTT协议解码
+type MQTTConn struct {
+	*DefaultConn
+}
+
+func NewMQTTConn(d *DefaultConn) *MQTTConn {
+	return &MQTTConn{
+		DefaultConn: d,
+	}
+}
+
+// WriteMQTTPacket 编码MQTT报文并写入outboundBuffer（需要调用WakeWrite才会真正写出）
+func (m *MQTTConn) WriteMQTTPacket(packet mqtt.ControlPacket) error {
+	data, err := mqtt.EncodePacket(packet)
+	if err != nil {
+		return err
+	}
+	_, err = m.WriteToOutboundBuffer(data)
+	return err
+}
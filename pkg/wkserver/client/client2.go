@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -113,7 +114,7 @@ func (c *Client) run(connectChan chan struct{}) {
 
 		c.connectStatusChange(CONNECTING)
 		// 建立连接
-		conn, err := net.DialTimeout("tcp", c.addr, c.opts.ConnectTimeout)
+		conn, err := c.dial()
 		if err != nil {
 			// 处理错误
 			c.Debug("connect is error", zap.Error(err))
@@ -145,6 +146,13 @@ func (c *Client) run(connectChan chan struct{}) {
 
 }
 
+func (c *Client) dial() (net.Conn, error) {
+	if c.opts.TLSConfig != nil {
+		return tls.DialWithDialer(&net.Dialer{Timeout: c.opts.ConnectTimeout}, "tcp", c.addr, c.opts.TLSConfig)
+	}
+	return net.DialTimeout("tcp", c.addr, c.opts.ConnectTimeout)
+}
+
 func (c *Client) onOutboundClose() {
 	c.Debug("outbound close")
 	c.stopped.Store(true)
@@ -181,10 +189,14 @@ func (c *Client) processPingTimer() {
 }
 
 func (c *Client) handshake() error {
+	token := c.opts.Token
+	if c.opts.TokenFunc != nil {
+		token = c.opts.TokenFunc()
+	}
 	conn := &proto.Connect{
 		Id:    c.reqIDGen.Next(),
 		Uid:   c.opts.UID,
-		Token: c.opts.Token,
+		Token: token,
 	}
 	data, err := conn.Marshal()
 	if err != nil {
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto/tls"
 	"time"
 )
 
@@ -13,7 +14,8 @@ type Options struct {
 	HandshakeTimeout  time.Duration
 	UID               string
 	Token             string
-	DefaultBufSize    int // The size of the bufio reader/writer on top of the socket.
+	TokenFunc         func() string // 每次连接时生成token，不为nil时代替Token
+	DefaultBufSize    int           // The size of the bufio reader/writer on top of the socket.
 	// ReconnectBufSize is the size of the backing bufio during reconnect.
 	// Once this has been exhausted publish operations will return an error.
 	// Defaults to 8388608 bytes (8MB).
@@ -28,6 +30,8 @@ type Options struct {
 	PingInterval time.Duration
 	// OnConnectStatus is called when the connection status changes.
 	OnConnectStatus func(status ConnectStatus)
+	// TLSConfig 不为nil时使用tls连接
+	TLSConfig *tls.Config
 }
 
 func NewOptions() *Options {
@@ -59,6 +63,12 @@ func WithToken(token string) Option {
 	}
 }
 
+func WithTokenFunc(f func() string) Option {
+	return func(opts *Options) {
+		opts.TokenFunc = f
+	}
+}
+
 func WithConnecTimeout(v time.Duration) Option {
 	return func(opts *Options) {
 		opts.ConnectTimeout = v
@@ -118,3 +128,9 @@ func WithOnConnectStatus(v func(status ConnectStatus)) Option {
 		opts.OnConnectStatus = v
 	}
 }
+
+func WithTLSConfig(v *tls.Config) Option {
+	return func(opts *Options) {
+		opts.TLSConfig = v
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/WuKongIM/WuKongIM/pkg/wknet"
 	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/crypto/tls"
 )
 
 type Options struct {
@@ -22,6 +23,10 @@ type Options struct {
 	TimingWheelSize int64         // Time wheel size
 	OnRequest       func(conn wknet.Conn, req *proto.Request)
 	OnResponse      func(conn wknet.Conn, resp *proto.Response)
+
+	TLSConfig *tls.Config // 不为nil时监听使用tls
+	// OnAuth 连接认证，返回错误时拒绝连接；不为nil时未认证的连接只能发送连接和心跳消息
+	OnAuth func(conn wknet.Conn, req *proto.Connect) error
 }
 
 func NewOptions() *Options {
@@ -119,3 +124,15 @@ func WithOnResponse(onResponse func(conn wknet.Conn, resp *proto.Response)) Opti
 		o.OnResponse = onResponse
 	}
 }
+
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = tlsConfig
+	}
+}
+
+func WithOnAuth(onAuth func(conn wknet.Conn, req *proto.Connect) error) Option {
+	return func(o *Options) {
+		o.OnAuth = onAuth
+	}
+}
@@ -42,9 +42,13 @@ func New(addr string, ops ...Option) *Server {
 		}
 	}
 
+	engineOpts := []wknet.Option{wknet.WithAddr(opts.Addr)}
+	if opts.TLSConfig != nil {
+		engineOpts = append(engineOpts, wknet.WithTCPTLSConfig(opts.TLSConfig))
+	}
 	s := &Server{
 		proto:       proto.New(),
-		engine:      wknet.NewEngine(wknet.WithAddr(opts.Addr)),
+		engine:      wknet.NewEngine(engineOpts...),
 		opts:        opts,
 		routeMap:    make(map[string]Handler),
 		Log:         wklog.NewWKLog("Server"),
@@ -30,6 +30,9 @@ func (s *Server) onData(conn wknet.Conn) error {
 		}
 		newBuff = newBuff[size:]
 
+		if s.opts.OnAuth != nil && conn.UID() == "" && msgType != proto.MsgTypeConnect && msgType != proto.MsgTypeHeartbeat {
+			return errors.New("conn not authenticated")
+		}
 		s.handleMsg(conn, msgType, data)
 	}
 	if len(newBuff) != len(buff) {
@@ -123,6 +126,20 @@ func (s *Server) handleHeartbeat(conn wknet.Conn) {
 
 func (s *Server) handleConnack(conn wknet.Conn, req *proto.Connect) {
 
+	if s.opts.OnAuth != nil {
+		if err := s.opts.OnAuth(conn, req); err != nil {
+			s.Warn("连接认证失败", zap.String("from", req.Uid), zap.String("remoteAddr", conn.RemoteAddr().String()), zap.Error(err))
+			ctx := NewContext(conn)
+			ctx.proto = s.proto
+			ctx.WriteConnack(&proto.Connack{
+				Id:     req.Id,
+				Status: proto.Status_ERROR,
+			})
+			_ = conn.Close()
+			return
+		}
+	}
+
 	s.Debug("连接成功", zap.String("from", req.Uid))
 	conn.SetUID(req.Uid)
 	conn.SetMaxIdle(s.opts.MaxIdle)
@@ -0,0 +1,255 @@
+package wktls
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wklog"
+	wktls "github.com/WuKongIM/crypto/tls"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoPeerCertificate = errors.New("no peer certificate")
+	ErrNodeIdMismatch    = errors.New("node id of certificate mismatch")
+)
+
+// Options 节点之间tls的证书配置
+type Options struct {
+	CAFile         string        // ca证书文件，用于校验对端节点的证书
+	CertFile       string        // 本节点的证书文件，证书的CommonName或DNS名称为节点id
+	KeyFile        string        // 本节点的证书私钥文件
+	ReloadInterval time.Duration // 检查证书文件是否变化的间隔，变化后重新加载证书
+}
+
+// Reloader 加载节点证书和ca证书，证书文件变化后自动重新加载（新建立的连接使用新证书）
+type Reloader struct {
+	opts Options
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	modTime   time.Time // 已加载的证书文件的最后修改时间
+	lastCheck time.Time // 最后一次检查证书文件的时间
+	wklog.Log
+}
+
+func NewReloader(opts Options) (*Reloader, error) {
+	r := &Reloader{
+		opts: opts,
+		Log:  wklog.NewWKLog("tlsReloader"),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	caData, err := os.ReadFile(r.opts.CAFile)
+	if err != nil {
+		return err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caData) {
+		return fmt.Errorf("no ca certificate found in %s", r.opts.CAFile)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.caPool = caPool
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// filesModTime 证书文件里最新的修改时间
+func (r *Reloader) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{r.opts.CAFile, r.opts.CertFile, r.opts.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// maybeReload 距离上次检查超过ReloadInterval并且证书文件有变化时重新加载，加载失败继续使用旧证书
+func (r *Reloader) maybeReload() {
+	if r.opts.ReloadInterval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < r.opts.ReloadInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	loadedModTime := r.modTime
+	r.mu.Unlock()
+
+	modTime, err := r.filesModTime()
+	if err != nil {
+		r.Warn("stat certificate files failed", zap.Error(err))
+		return
+	}
+	if !modTime.After(loadedModTime) {
+		return
+	}
+	if err = r.load(); err != nil {
+		r.Warn("reload certificate failed", zap.Error(err))
+		return
+	}
+	r.Info("certificate reloaded", zap.String("certFile", r.opts.CertFile))
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.caPool
+}
+
+// verify 使用ca证书校验对端的证书链，返回对端的证书
+func (r *Reloader) verify(rawCerts [][]byte) (*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, ErrNoPeerCertificate
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	_, caPool := r.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         caPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, // 节点证书同时作为服务端和客户端证书
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// ServerConfig 集群监听使用的tls配置，要求对端节点提供ca签发的证书
+func (r *Reloader) ServerConfig() *wktls.Config {
+	return &wktls.Config{
+		MinVersion: wktls.VersionTLS12,
+		ClientAuth: wktls.RequireAnyClientCert, // 证书链由VerifyPeerCertificate使用重新加载后的ca校验
+		GetCertificate: func(*wktls.ClientHelloInfo) (*wktls.Certificate, error) {
+			cert, _ := r.current()
+			return &wktls.Certificate{
+				Certificate: cert.Certificate,
+				PrivateKey:  cert.PrivateKey,
+				Leaf:        cert.Leaf,
+			}, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := r.verify(rawCerts)
+			return err
+		},
+	}
+}
+
+// ClientConfig 连接节点nodeId使用的tls配置，校验对端证书是ca签发的并且属于节点nodeId
+func (r *Reloader) ClientConfig(nodeId uint64) *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // 节点地址一般是ip，不校验主机名，证书链和节点id由VerifyPeerCertificate校验
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := r.verify(rawCerts)
+			if err != nil {
+				return err
+			}
+			return VerifyNodeId(cert, nodeId)
+		},
+	}
+}
+
+// VerifyNodeId 证书的CommonName或者DNS名称是否为节点id
+func VerifyNodeId(cert *x509.Certificate, nodeId uint64) error {
+	if cert == nil {
+		return ErrNoPeerCertificate
+	}
+	id := strconv.FormatUint(nodeId, 10)
+	if cert.Subject.CommonName == id {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if name == id {
+			return nil
+		}
+	}
+	return ErrNodeIdMismatch
+}
+
+// TokenMaxAge token的签名时间与校验时间最多相差多久（包含节点之间的时钟偏差），超过后token失效，避免被截获后重放
+const TokenMaxAge = time.Second * 30
+
+// SignToken 使用集群密钥对节点uid和签名时间签名，作为节点连接时的token，格式为 <签名时间(毫秒)>.<签名>
+// 每次连接都需要重新签名
+func SignToken(secret string, uid string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	return timestamp + "." + signToken(secret, uid, timestamp)
+}
+
+func signToken(secret string, uid string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(uid))
+	mac.Write([]byte("."))
+	mac.Write([]byte(timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyToken 校验节点连接时的token，签名时间与now相差超过TokenMaxAge的token无效
+func VerifyToken(secret string, uid string, token string, now time.Time) bool {
+	timestamp, sign, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.UnixMilli(millis))
+	if age > TokenMaxAge || age < -TokenMaxAge {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(signToken(secret, uid, timestamp)), []byte(sign)) == 1
+}
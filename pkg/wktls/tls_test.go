@@ -0,0 +1,162 @@
+package wktls_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/pkg/wknet"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/client"
+	"github.com/WuKongIM/WuKongIM/pkg/wkserver/proto"
+	"github.com/WuKongIM/WuKongIM/pkg/wktls"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCerts 生成ca证书和节点证书，返回节点证书的配置
+func writeCerts(t *testing.T, dir string, nodeIds ...uint64) map[uint64]wktls.Options {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wukongim-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0600))
+
+	optsMap := make(map[uint64]wktls.Options)
+	for i, nodeId := range nodeIds {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: fmt.Sprintf("%d", nodeId)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+		assert.NoError(t, err)
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		assert.NoError(t, err)
+
+		certFile := filepath.Join(dir, fmt.Sprintf("%d.pem", nodeId))
+		keyFile := filepath.Join(dir, fmt.Sprintf("%d-key.pem", nodeId))
+		assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+		assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+		optsMap[nodeId] = wktls.Options{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+	}
+	return optsMap
+}
+
+func TestToken(t *testing.T) {
+	now := time.Now()
+	token := wktls.SignToken("secret", "1001", now)
+	assert.True(t, wktls.VerifyToken("secret", "1001", token, now))
+	assert.True(t, wktls.VerifyToken("secret", "1001", token, now.Add(-time.Second))) // 允许时钟偏差
+	assert.False(t, wktls.VerifyToken("secret", "1002", token, now))
+	assert.False(t, wktls.VerifyToken("secret2", "1001", token, now))
+
+	// 超过有效期的token不能重放
+	assert.False(t, wktls.VerifyToken("secret", "1001", token, now.Add(wktls.TokenMaxAge+time.Second)))
+	assert.False(t, wktls.VerifyToken("secret", "1001", token, now.Add(-wktls.TokenMaxAge-time.Second)))
+
+	// 篡改签名时间
+	_, sign, _ := strings.Cut(token, ".")
+	forged := strconv.FormatInt(now.Add(time.Minute).UnixMilli(), 10) + "." + sign
+	assert.False(t, wktls.VerifyToken("secret", "1001", forged, now.Add(time.Minute)))
+	assert.False(t, wktls.VerifyToken("secret", "1001", "invalid", now))
+}
+
+func TestClientConfigVerifyNodeId(t *testing.T) {
+	optsMap := writeCerts(t, t.TempDir(), 1001)
+	r, err := wktls.NewReloader(optsMap[1001])
+	assert.NoError(t, err)
+
+	cert, err := r.ClientConfig(1001).GetClientCertificate(nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.ClientConfig(1001).VerifyPeerCertificate(cert.Certificate, nil))
+	assert.Equal(t, wktls.ErrNodeIdMismatch, r.ClientConfig(1002).VerifyPeerCertificate(cert.Certificate, nil))
+
+	// 其他ca签发的证书
+	otherOpts := writeCerts(t, t.TempDir(), 1001)
+	other, err := wktls.NewReloader(otherOpts[1001])
+	assert.NoError(t, err)
+	otherCert, err := other.ClientConfig(1001).GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Error(t, r.ClientConfig(1001).VerifyPeerCertificate(otherCert.Certificate, nil))
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	optsMap := writeCerts(t, dir, 1001)
+	opts := optsMap[1001]
+	opts.ReloadInterval = time.Millisecond
+	r, err := wktls.NewReloader(opts)
+	assert.NoError(t, err)
+	cert, err := r.ClientConfig(1001).GetClientCertificate(nil)
+	assert.NoError(t, err)
+
+	// 重新签发证书覆盖原来的文件
+	writeCerts(t, dir, 1001)
+	future := time.Now().Add(time.Second)
+	for _, file := range []string{opts.CAFile, opts.CertFile, opts.KeyFile} {
+		assert.NoError(t, os.Chtimes(file, future, future))
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	newCert, err := r.ClientConfig(1001).GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, cert.Certificate[0], newCert.Certificate[0])
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	optsMap := writeCerts(t, t.TempDir(), 1001, 1002)
+	serverReloader, err := wktls.NewReloader(optsMap[1001])
+	assert.NoError(t, err)
+	clientReloader, err := wktls.NewReloader(optsMap[1002])
+	assert.NoError(t, err)
+
+	s := wkserver.New("tcp://127.0.0.1:0",
+		wkserver.WithTLSConfig(serverReloader.ServerConfig()),
+		wkserver.WithOnAuth(func(conn wknet.Conn, req *proto.Connect) error {
+			if !wktls.VerifyToken("secret", req.Uid, req.Token, time.Now()) {
+				return fmt.Errorf("invalid token")
+			}
+			return nil
+		}),
+	)
+	s.Route("/test", func(c *wkserver.Context) {
+		c.Write([]byte("ok"))
+	})
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	cli := client.New(s.Addr().String(), client.WithUID("1002"), client.WithToken(wktls.SignToken("secret", "1002", time.Now())), client.WithTLSConfig(clientReloader.ClientConfig(1001)))
+	assert.NoError(t, cli.Connect())
+	defer cli.Close()
+
+	resp, err := cli.Request("/test", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ok"), resp.Body)
+}